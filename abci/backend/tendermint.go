@@ -22,50 +22,12 @@ import (
 	cmn "github.com/tendermint/tendermint/libs/common"
 	tmcmn "github.com/tendermint/tendermint/libs/common"
 	dbm "github.com/tendermint/tendermint/libs/db"
-	tmLog "github.com/tendermint/tendermint/libs/log"
 	"github.com/tendermint/tendermint/node"
 	"github.com/tendermint/tendermint/p2p"
 	"github.com/tendermint/tendermint/proxy"
 	"github.com/tendermint/tendermint/types"
 )
 
-func CreateFnConsensusReactor(
-	chainID string,
-	privVal types.PrivValidator,
-	fnRegistry fnConsensus.FnRegistry,
-	cfg *cfg.Config,
-	logger tmLog.Logger,
-	cachedDBProvider node.DBProvider,
-	reactorConfig *fnConsensus.ReactorConfigParsable,
-) (*fnConsensus.FnConsensusReactor, error) {
-	var fnConsensusDB, tmStateDB dbm.DB
-	var err error
-
-	// Non-validators just forward messages, they don't need to read nor write any persistent state
-	if reactorConfig.IsValidator {
-		fnConsensusDB, err = cachedDBProvider(&node.DBContext{ID: "fnConsensus", Config: cfg})
-		if err != nil {
-			return nil, err
-		}
-
-		tmStateDB, err = cachedDBProvider(&node.DBContext{ID: "state", Config: cfg})
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	var fnConsensusReactor *fnConsensus.FnConsensusReactor
-	fnConsensusReactor, err = fnConsensus.NewFnConsensusReactor(
-		chainID, privVal, fnRegistry, fnConsensusDB, tmStateDB, reactorConfig,
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create fnConsensus reactor")
-	}
-
-	fnConsensusReactor.SetLogger(logger.With("module", "FnConsensus"))
-	return fnConsensusReactor, nil
-}
-
 func CreateNewCachedDBProvider(config *cfg.Config) (node.DBProvider, error) {
 	// Let's not intefere with other db's creation, unless required
 	dbsNeedToCache := []string{
@@ -108,6 +70,8 @@ type Backend interface {
 	NodeSigner() (auth.Signer, error)
 	// Returns the TCP or UNIX socket address the backend RPC server listens on
 	RPCAddress() (string, error)
+	// Returns the fnConsensus reactor, or nil if it isn't running on this node
+	FnConsensusReactor() *fnConsensus.FnConsensusReactor
 	EventBus() *types.EventBus // TODO: doesn't seem to be used, remove it
 }
 
@@ -120,7 +84,8 @@ type TendermintBackend struct {
 	socketServer      tmcmn.Service
 	genesisValidators []*loom.Validator
 
-	FnRegistry fnConsensus.FnRegistry
+	FnRegistry         fnConsensus.FnRegistry
+	fnConsensusReactor *fnConsensus.FnConsensusReactor
 }
 
 // ParseConfig retrieves the default environment configuration,
@@ -405,17 +370,20 @@ func (b *TendermintBackend) Start(app abci.Application) error {
 	var fnConsensusReactor *fnConsensus.FnConsensusReactor
 	if b.FnRegistry != nil {
 		reactorConfig := b.OverrideCfg.FnConsensusReactorConfig
-		if reactorConfig.IsValidator {
-			dbProvider, err = CreateNewCachedDBProvider(cfg)
-			if err != nil {
-				return err
-			}
+		// The reactor shares state.db with the node, even on non-validators.
+		dbProvider, err = CreateNewCachedDBProvider(cfg)
+		if err != nil {
+			return err
 		}
 
-		fnConsensusReactor, err = CreateFnConsensusReactor(
-			b.OverrideCfg.ChainID, privVal, b.FnRegistry, cfg, nodeLogger, dbProvider,
-			b.OverrideCfg.FnConsensusReactorConfig,
-		)
+		fnConsensusReactor, err = fnConsensus.AttachToNode(cfg, b.FnRegistry, fnConsensus.NodeOptions{
+			ChainID:       b.OverrideCfg.ChainID,
+			PrivValidator: privVal,
+			Reactor:       reactorConfig,
+			DBProvider:    dbProvider,
+			Reactors:      reactorRegistrationRequests,
+			Logger:        nodeLogger.With("module", "FnConsensus"),
+		})
 
 		if err != nil {
 			return err
@@ -425,6 +393,7 @@ func (b *TendermintBackend) Start(app abci.Application) error {
 			Name:    "FNCONSENSUS",
 			Reactor: fnConsensusReactor,
 		})
+		b.fnConsensusReactor = fnConsensusReactor
 	}
 
 	if b.SocketPath != "" {
@@ -451,6 +420,28 @@ func (b *TendermintBackend) Start(app abci.Application) error {
 			return err
 		}
 
+		if fnConsensusReactor != nil {
+			fnConsensusReactor.SetSyncStatusProvider(
+				fnConsensus.SyncStatusProviderFunc(n.ConsensusReactor().FastSync),
+			)
+			sw := n.Switch()
+			fnConsensusReactor.SetValidatorPeersChangedHandler(func(peers []*fnConsensus.ValidatorPeer) {
+				dialStrings := make([]string, 0, len(peers))
+				for _, peer := range peers {
+					if dialString := peer.DialString(); dialString != "" && !peer.Connected {
+						dialStrings = append(dialStrings, dialString)
+					}
+				}
+				if len(dialStrings) > 0 {
+					// Not persistent, the reactor asks for validator peers to be dialed again if
+					// the connection to them drops, until they leave the validator set.
+					if err := sw.DialPeersAsync(nil, dialStrings, false); err != nil {
+						nodeLogger.Error("Failed to dial fnConsensus validator peers", "err", err)
+					}
+				}
+			})
+		}
+
 		err = n.Start()
 		if err != nil {
 			return err
@@ -460,6 +451,19 @@ func (b *TendermintBackend) Start(app abci.Application) error {
 	return nil
 }
 
+// FnConsensusHealth returns a *fnConsensus.UnhealthyError if the fnConsensus reactor isn't making
+// progress, or nil if it is (or if the reactor isn't running on this node).
+func (b *TendermintBackend) FnConsensusHealth() error {
+	if b.fnConsensusReactor == nil {
+		return nil
+	}
+	return b.fnConsensusReactor.Healthy()
+}
+
+func (b *TendermintBackend) FnConsensusReactor() *fnConsensus.FnConsensusReactor {
+	return b.fnConsensusReactor
+}
+
 func (b *TendermintBackend) EventBus() *types.EventBus {
 	return b.node.EventBus()
 }
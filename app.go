@@ -24,6 +24,7 @@ import (
 	"github.com/loomnetwork/loomchain/store"
 	blockindex "github.com/loomnetwork/loomchain/store/block_index"
 	evmaux "github.com/loomnetwork/loomchain/store/evm_aux"
+	"github.com/pkg/errors"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	abci "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/libs/common"
@@ -317,6 +318,24 @@ func (f TxHandlerFunc) ProcessTx(state State, txBytes []byte, isCheckTx bool) (T
 	return f(state, txBytes, isCheckTx)
 }
 
+// TxError can be implemented by errors returned by tx handlers & middleware to report a failed tx
+// with a specific ABCI response code, so clients can detect the failure without parsing the log.
+// The code is only reported by CheckTx, DeliverTx reports every failed tx with code 1 since the codes
+// of its responses are hashed into the block results all the nodes must agree on.
+type TxError interface {
+	error
+	ABCICode() uint32
+}
+
+// Returns the ABCI response code a tx that failed CheckTx with the given error should be reported
+// with.
+func txErrorCode(err error) uint32 {
+	if txErr, ok := errors.Cause(err).(TxError); ok {
+		return txErr.ABCICode()
+	}
+	return 1
+}
+
 type QueryHandler interface {
 	Handle(state ReadOnlyState, path string, data []byte) ([]byte, error)
 }
@@ -662,10 +681,12 @@ func (a *Application) CheckTx(txBytes []byte) abci.ResponseCheckTx {
 	defer a.ReceiptHandlerProvider.Store().DiscardCurrentReceipt()
 	defer a.EventHandler.Rollback()
 
-	_, err = a.TxHandler.ProcessTx(state, txBytes, true)
+	r, err := a.TxHandler.ProcessTx(state, txBytes, true)
 	if err != nil {
 		log.Error("CheckTx", "tx", hex.EncodeToString(ttypes.Tx(txBytes).Hash()), "err", err)
-		return abci.ResponseCheckTx{Code: 1, Log: err.Error()}
+		// Middleware may describe why the tx was rejected in the Info & Data of the result, e.g. the
+		// throttle state of the origin.
+		return abci.ResponseCheckTx{Code: txErrorCode(err), Log: err.Error(), Info: r.Info, Data: r.Data}
 	}
 
 	return abci.ResponseCheckTx{Code: abci.CodeTypeOK}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loomnetwork/loomchain/cmd/loom/common"
+	"github.com/loomnetwork/loomchain/fnConsensus"
+	"github.com/spf13/cobra"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+func newSetFnEnabledCommand() *cobra.Command {
+	var instanceName string
+	cmd := &cobra.Command{
+		Use:   "set-fn-enabled <path/to/fnConsensus.db> <fnID> <true|false>",
+		Short: "Enable or disable a Fn in fnConsensus.db, the node must be stopped",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := common.ParseConfig()
+			if err != nil {
+				return err
+			}
+			fnID := args[1]
+			enabled, err := strconv.ParseBool(args[2])
+			if err != nil {
+				return fmt.Errorf("Invalid enabled value '%s'", args[2])
+			}
+
+			db, err := openFnConsensusDB(args[0], instanceName)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			signingThreshold := fnConsensus.DefaultReactorConfigParsable().FnVoteSigningThreshold
+			if cfg.FnConsensus != nil && cfg.FnConsensus.Reactor != nil {
+				signingThreshold = cfg.FnConsensus.Reactor.FnVoteSigningThreshold
+			}
+			if err := fnConsensus.SetFnEnabledInDB(db, signingThreshold, fnID, enabled); err != nil {
+				return err
+			}
+
+			fmt.Printf("Fn %s enabled: %v\n", fnID, enabled)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&instanceName, "instance", "", "Name of the fnConsensus reactor instance")
+	return cmd
+}
+
+func newDumpFnRoundTracesCommand() *cobra.Command {
+	var instanceName string
+	cmd := &cobra.Command{
+		Use:   "dump-fn-round-traces <path/to/fnConsensus.db> <fnID> [nonce]",
+		Short: "Displays the execution traces of a Fn stored in fnConsensus.db, the node must be stopped",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fnID := args[1]
+			var nonce int64
+			if len(args) > 2 {
+				var err error
+				if nonce, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+					return fmt.Errorf("Invalid nonce '%s'", args[2])
+				}
+			}
+
+			db, err := openFnConsensusDB(args[0], instanceName)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var traces []*fnConsensus.RoundTrace
+			if nonce > 0 {
+				trace, err := fnConsensus.LoadRoundTrace(db, fnID, nonce)
+				if err != nil {
+					return err
+				}
+				if trace == nil {
+					return fmt.Errorf("No trace found for fn %s at nonce %d", fnID, nonce)
+				}
+				traces = append(traces, trace)
+			} else if traces, err = fnConsensus.LoadRoundTraces(db, fnID); err != nil {
+				return err
+			}
+
+			output, err := json.MarshalIndent(traces, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(output))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&instanceName, "instance", "", "Name of the fnConsensus reactor instance")
+	return cmd
+}
+
+func newCompactFnConsensusDBCommand() *cobra.Command {
+	var instanceName string
+	cmd := &cobra.Command{
+		Use:   "compact-fn-consensus <path/to/fnConsensus.db>",
+		Short: "Deletes expired keys from fnConsensus.db & compacts it, the node must be stopped",
+		Long: "Deletes the archived Maj23 votesets & conflict evidence that are no longer retained according " +
+			"to the fnConsensus reactor config in loom.yml, and then compacts fnConsensus.db.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := common.ParseConfig()
+			if err != nil {
+				return err
+			}
+			reactorCfg := fnConsensus.DefaultReactorConfigParsable()
+			if cfg.FnConsensus != nil && cfg.FnConsensus.Reactor != nil {
+				reactorCfg = cfg.FnConsensus.Reactor
+			}
+			retention := fnConsensus.GCRetention{
+				Maj23VoteSets:    reactorCfg.Maj23ArchiveRetention,
+				ConflictEvidence: time.Duration(reactorCfg.ConflictEvidenceRetention) * time.Second,
+			}
+
+			db, err := openFnConsensusLevelDB(args[0])
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			stats, err := fnConsensus.CollectGarbage(fnConsensus.InstanceDB(db, instanceName), retention, time.Now())
+			if err != nil {
+				return err
+			}
+			for kind, count := range stats.DeletedKeys {
+				fmt.Printf("Deleted %d %s keys\n", count, kind)
+			}
+			fmt.Printf("Reclaimed %d bytes\n", stats.ReclaimedBytes)
+
+			startTime := time.Now()
+			if err := db.DB().CompactRange(util.Range{}); err != nil {
+				return err
+			}
+			fmt.Printf("Compaction complete (took %v secs)\n", time.Since(startTime).Seconds())
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&instanceName, "instance", "", "Name of the fnConsensus reactor instance")
+	return cmd
+}
+
+// Opens fnConsensus.db, and returns the view of it used by the reactor instance with the given name.
+func openFnConsensusDB(dbPath string, instanceName string) (dbm.DB, error) {
+	db, err := openFnConsensusLevelDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return fnConsensus.InstanceDB(db, instanceName), nil
+}
+
+func openFnConsensusLevelDB(dbPath string) (*dbm.GoLevelDB, error) {
+	absPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve fnConsensus.db path '%s'", dbPath)
+	}
+	dbName := strings.TrimSuffix(path.Base(absPath), ".db")
+	return dbm.NewGoLevelDB(dbName, path.Dir(absPath))
+}
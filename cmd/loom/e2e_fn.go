@@ -0,0 +1,92 @@
+// +build e2efn
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	glAuth "github.com/loomnetwork/go-loom/auth"
+	"github.com/loomnetwork/loomchain/config"
+	"github.com/loomnetwork/loomchain/fnConsensus"
+	"github.com/loomnetwork/loomchain/log"
+)
+
+const (
+	// ID of the Fn the e2e tests use to exercise the fnConsensus reactor.
+	e2eCounterFnID = "e2e_counter"
+	// File in the node directory the e2e counter Fn records its events to.
+	e2eCounterFnEventsFile = "e2e-fn-events.log"
+	// The reactor proposes once every 10 seconds, on all the validators at the same time, so
+	// validators running on the same machine compute the same counter value in each round.
+	e2eCounterInterval = 10
+)
+
+// e2eFnEvent is written to the events file of the e2e counter Fn as a JSON line.
+type e2eFnEvent struct {
+	// "sign" when the Fn signs a counter value, "submit" when it submits a converged counter value
+	Event   string
+	Counter string
+	// Number of validators that signed a submitted counter value
+	Signatures int
+	Time       time.Time
+}
+
+// e2eCounterFn is a trivial oracle that signs the number of proposal intervals since the epoch.
+type e2eCounterFn struct {
+	signer     glAuth.Signer
+	eventsPath string
+	mtx        sync.Mutex
+}
+
+var _ fnConsensus.Fn = &e2eCounterFn{}
+
+func (fn *e2eCounterFn) GetMessageAndSignature(ctx []byte) ([]byte, []byte, error) {
+	message := []byte(fmt.Sprintf("%d", time.Now().Unix()/e2eCounterInterval))
+	fn.record(e2eFnEvent{Event: "sign", Counter: string(message)})
+	return message, fn.signer.Sign(message), nil
+}
+
+func (fn *e2eCounterFn) SubmitMultiSignedMessage(ctx []byte, message []byte, signatures [][]byte) {
+	numSigs := 0
+	for _, sig := range signatures {
+		if len(sig) > 0 {
+			numSigs++
+		}
+	}
+	fn.record(e2eFnEvent{Event: "submit", Counter: string(message), Signatures: numSigs})
+}
+
+func (fn *e2eCounterFn) record(event e2eFnEvent) {
+	event.Time = time.Now()
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Error("Failed to marshal e2e Fn event", "err", err)
+		return
+	}
+	fn.mtx.Lock()
+	defer fn.mtx.Unlock()
+	f, err := os.OpenFile(fn.eventsPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Error("Failed to open e2e Fn events file", "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Error("Failed to write e2e Fn event", "err", err)
+	}
+}
+
+func startE2ETestFns(fnRegistry fnConsensus.FnRegistry, cfg *config.Config, nodeSigner glAuth.Signer) error {
+	fn := &e2eCounterFn{
+		signer:     nodeSigner,
+		eventsPath: path.Join(cfg.RootPath(), e2eCounterFnEventsFile),
+	}
+	return fnRegistry.SetWithMetadata(e2eCounterFnID, fn, fnConsensus.FnMetadata{
+		Description: "Signs a counter, only compiled into nodes built for e2e tests",
+	})
+}
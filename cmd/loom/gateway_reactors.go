@@ -1,3 +1,4 @@
+//go:build gateway
 // +build gateway
 
 package main
@@ -79,7 +80,10 @@ func startGatewayFn(
 		return err
 	}
 
-	return fnRegistry.Set("batch_sign_withdrawal", batchSignWithdrawalFn)
+	return fnRegistry.SetWithMetadata("batch_sign_withdrawal", batchSignWithdrawalFn, fnConsensus.FnMetadata{
+		Description: "Signs pending ETH & ERC20/721 withdrawals from the Ethereum Transfer Gateway",
+		Destination: "ethereum",
+	})
 }
 
 func startLoomCoinGatewayFn(
@@ -102,7 +106,10 @@ func startLoomCoinGatewayFn(
 		return err
 	}
 
-	return fnRegistry.Set("loomcoin:batch_sign_withdrawal", batchSignWithdrawalFn)
+	return fnRegistry.SetWithMetadata("loomcoin:batch_sign_withdrawal", batchSignWithdrawalFn, fnConsensus.FnMetadata{
+		Description: "Signs pending LOOM withdrawals from the Loom Coin Transfer Gateway",
+		Destination: "ethereum",
+	})
 }
 
 func startTronGatewayFn(chainID string,
@@ -124,5 +131,8 @@ func startTronGatewayFn(chainID string,
 		return err
 	}
 
-	return fnRegistry.Set("tron:batch_sign_withdrawal", batchSignWithdrawalFn)
+	return fnRegistry.SetWithMetadata("tron:batch_sign_withdrawal", batchSignWithdrawalFn, fnConsensus.FnMetadata{
+		Description: "Signs pending withdrawals from the Tron Transfer Gateway",
+		Destination: "tron",
+	})
 }
@@ -18,6 +18,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus/push"
 	"github.com/tendermint/tendermint/libs/db"
+	rpcserver "github.com/tendermint/tendermint/rpc/lib/server"
 
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	"github.com/gogo/protobuf/proto"
@@ -370,17 +371,27 @@ func newRunCommand() *cobra.Command {
 			}
 			backend := initBackend(cfg, abciServerAddr, fnRegistry)
 			loader := plugin.NewMultiLoader(loaders...)
+			throttleAdmin := throttle.NewAdmin()
 			termChan := make(chan os.Signal)
-			go func(c <-chan os.Signal, l plugin.Loader) {
+			go func(c <-chan os.Signal, l plugin.Loader, throttleAdmin *throttle.Admin) {
 				<-c
 				l.UnloadContracts()
+				// The throttle records kept in memory are snapshotted so they survive the restart.
+				if err := throttleAdmin.Snapshot(); err != nil {
+					log.Error("Failed to snapshot throttle records", "err", err)
+				}
 				os.Exit(0)
-			}(termChan, loader)
+			}(termChan, loader, throttleAdmin)
 
-			signal.Notify(termChan, syscall.SIGHUP,
-				syscall.SIGINT,
-				syscall.SIGTERM,
-				syscall.SIGQUIT)
+			termSignals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+			// When the throttle is enabled SIGHUP reloads its config instead of stopping the node.
+			reloadChan := make(chan os.Signal, 1)
+			if cfg.Karma.Enabled {
+				signal.Notify(reloadChan, syscall.SIGHUP)
+			} else {
+				termSignals = append(termSignals, syscall.SIGHUP)
+			}
+			signal.Notify(termChan, termSignals...)
 
 			chainID, err := backend.ChainID()
 			if err != nil {
@@ -402,10 +413,12 @@ func newRunCommand() *cobra.Command {
 			}
 			appDB.Close()
 
-			app, err := loadApp(chainID, cfg, loader, backend, appHeight)
+			app, err := loadApp(chainID, cfg, loader, backend, appHeight, throttleAdmin)
 			if err != nil {
 				return err
 			}
+			throttleAdmin.SetStateProvider(app.ReadOnlyState)
+			go reloadThrottleOnSignal(reloadChan, throttleAdmin)
 			if err := backend.Start(app); err != nil {
 				return err
 			}
@@ -415,7 +428,9 @@ func newRunCommand() *cobra.Command {
 				return err
 			}
 
-			if err := initQueryService(app, chainID, cfg, loader, app.ReceiptHandlerProvider); err != nil {
+			if err := initQueryService(
+				app, chainID, cfg, loader, app.ReceiptHandlerProvider, throttleAdmin, backend.FnConsensusReactor(),
+			); err != nil {
 				return err
 			}
 
@@ -424,6 +439,10 @@ func newRunCommand() *cobra.Command {
 				if err := startGatewayReactors(chainID, fnRegistry, cfg, nodeSigner); err != nil {
 					return err
 				}
+				// Only registers Fns in nodes built for e2e tests.
+				if err := startE2ETestFns(fnRegistry, cfg, nodeSigner); err != nil {
+					return err
+				}
 			}
 
 			if err := startPlasmaOracle(chainID, cfg.PlasmaCash); err != nil {
@@ -717,12 +736,48 @@ func loadEvmStore(cfg *config.Config, targetVersion int64) (*store.EvmStore, err
 	return evmStore, nil
 }
 
+// Returns the throttle config loaded from the Throttle section of loom.yml, the limits in the Karma
+// section are used where the Throttle section doesn't set any.
+func throttleConfig(cfg *config.Config) *throttle.ThrottleConfig {
+	throttleCfg := cfg.Throttle.Clone()
+	if throttleCfg.MaxCallCount == 0 {
+		throttleCfg.MaxCallCount = cfg.Karma.MaxCallCount
+	}
+	if throttleCfg.SessionDuration == 0 {
+		throttleCfg.SessionDuration = cfg.Karma.SessionDuration
+	}
+	if throttleCfg.SnapshotPath != "" && !filepath.IsAbs(throttleCfg.SnapshotPath) {
+		throttleCfg.SnapshotPath = filepath.Join(cfg.RootPath(), throttleCfg.SnapshotPath)
+	}
+	if throttleCfg.AuditLogPath != "" && !filepath.IsAbs(throttleCfg.AuditLogPath) {
+		throttleCfg.AuditLogPath = filepath.Join(cfg.RootPath(), throttleCfg.AuditLogPath)
+	}
+	return throttleCfg
+}
+
+// Reloads the throttle config from loom.yml each time a signal is received on the given channel, so
+// the limits of the throttle can be tuned without restarting the node. If the config can't be
+// loaded, or is invalid, the throttle keeps running with its current config.
+func reloadThrottleOnSignal(c <-chan os.Signal, admin *throttle.Admin) {
+	for range c {
+		cfg, err := common.ParseConfig()
+		if err != nil {
+			log.Error("Failed to reload throttle config", "err", err)
+			continue
+		}
+		if err := admin.Reload(throttleConfig(cfg)); err != nil {
+			log.Error("Failed to reload throttle config", "err", err)
+		}
+	}
+}
+
 func loadApp(
 	chainID string,
 	cfg *config.Config,
 	loader plugin.Loader,
 	b backend.Backend,
 	appHeight int64,
+	throttleAdmin *throttle.Admin,
 ) (*loomchain.Application, error) {
 	logger := log.Root
 
@@ -864,6 +919,11 @@ func loadApp(
 		},
 	}
 
+	throttleAdminTxHandler := &throttle.AdminTxHandler{
+		CreateKarmaContractCtx: getContractCtx("karma", vmManager),
+		Admin:                  throttleAdmin,
+	}
+
 	gen, err := config.ReadGenesis(cfg.GenesisPath())
 	if err != nil {
 		return nil, err
@@ -936,12 +996,17 @@ func loadApp(
 	router.HandleDeliverTx(2, loomchain.GeneratePassthroughRouteHandler(callTxHandler))
 	router.HandleDeliverTx(3, loomchain.GeneratePassthroughRouteHandler(migrationTxHandler))
 	router.HandleDeliverTx(4, loomchain.GeneratePassthroughRouteHandler(ethTxHandler))
+	router.HandleDeliverTx(throttle.AdminTxID, loomchain.GeneratePassthroughRouteHandler(throttleAdminTxHandler))
 
 	// TODO: Write this in more elegant way
 	router.HandleCheckTx(1, loomchain.GenerateConditionalRouteHandler(isEvmTx, loomchain.NoopTxHandler, deployTxHandler))
 	router.HandleCheckTx(2, loomchain.GenerateConditionalRouteHandler(isEvmTx, loomchain.NoopTxHandler, callTxHandler))
 	router.HandleCheckTx(3, loomchain.GenerateConditionalRouteHandler(isEvmTx, loomchain.NoopTxHandler, migrationTxHandler))
 	router.HandleCheckTx(4, loomchain.GenerateConditionalRouteHandler(isEvmTx, loomchain.NoopTxHandler, ethTxHandler))
+	router.HandleCheckTx(
+		throttle.AdminTxID,
+		loomchain.GenerateConditionalRouteHandler(isEvmTx, loomchain.NoopTxHandler, throttleAdminTxHandler),
+	)
 
 	txMiddleWare := []loomchain.TxMiddleware{
 		loomchain.LogTxMiddleware,
@@ -960,12 +1025,54 @@ func loadApp(
 	createKarmaContractCtx := getContractCtx("karma", vmManager)
 
 	if cfg.Karma.Enabled {
-		txMiddleWare = append(txMiddleWare, throttle.GetKarmaMiddleWare(
-			cfg.Karma.Enabled,
-			cfg.Karma.MaxCallCount,
-			cfg.Karma.SessionDuration,
-			createKarmaContractCtx,
-		))
+		var callLimits throttle.LimitResolver
+		if cfg.StakeTiers.Enabled {
+			if err := cfg.StakeTiers.Validate(); err != nil {
+				return nil, errors.Wrap(err, "invalid StakeTiers config")
+			}
+			var readStake throttle.StakeReader
+			if cfg.StakeTiers.StakeSource == throttle.StakeSourceCoin {
+				readStake = throttle.NewCoinStakeReader(getContractStaticCtx("coin", vmManager))
+			} else {
+				readStake = throttle.NewDPOSStakeReader(getContractStaticCtx("dposV3", vmManager))
+			}
+			tieredLimits, err := throttle.NewTieredLimitResolver(cfg.StakeTiers.Tiers, readStake)
+			if err != nil {
+				return nil, err
+			}
+			callLimits = tieredLimits
+		}
+		throttleCfg := throttleConfig(cfg)
+		throttleCfg.CallLimits = callLimits
+		for _, dim := range throttleCfg.ThrottleKey {
+			if throttle.KeyDimension(dim) == throttle.KeyMappedAccount {
+				throttleCfg.AddressMapperCtx = getContractStaticCtx("addressmapper", vmManager)
+			}
+		}
+		if throttleCfg.OracleContract != "" {
+			throttleCfg.OracleContractCtx = getContractStaticCtx(throttleCfg.OracleContract, vmManager)
+		}
+		if throttleCfg.LimitTableContract != "" {
+			throttleCfg.LimitTableContractCtx = getContractStaticCtx(throttleCfg.LimitTableContract, vmManager)
+		}
+		if throttleCfg.ValidatorOperators || len(throttleCfg.DelegationBoost) > 0 {
+			throttleCfg.DPOSContractCtx = getContractStaticCtx("dposV3", vmManager)
+		}
+		if gen.Throttle != nil {
+			throttleCfg.OriginOverrides = gen.Throttle.Overrides
+		}
+		throttleCfg.Admin = throttleAdmin
+		throttleCfg.Logger = logger.With("module", "throttle")
+		if cfg.Metrics.Throttle {
+			throttleCfg.Metrics = throttle.NewPrometheusMetrics(cfg.Metrics.ThrottlePerOrigin)
+		}
+		karmaMiddleware, err := throttle.GetKarmaMiddleWareWithConfig(
+			cfg.Karma.Enabled, throttleCfg, createKarmaContractCtx,
+		)
+		if err != nil {
+			return nil, err
+		}
+		txMiddleWare = append(txMiddleWare, karmaMiddleware)
 	}
 
 	if cfg.TxLimiter.Enabled {
@@ -1228,7 +1335,8 @@ func initBackend(cfg *config.Config, abciServerAddr string, fnRegistry fnConsens
 
 func initQueryService(
 	app *loomchain.Application, chainID string, cfg *config.Config, loader plugin.Loader,
-	receiptHandlerProvider loomchain.ReceiptHandlerProvider,
+	receiptHandlerProvider loomchain.ReceiptHandlerProvider, throttleAdmin *throttle.Admin,
+	fnConsensusReactor *fnConsensus.FnConsensusReactor,
 ) error {
 	// metrics
 	fieldKeys := []string{"method", "error"}
@@ -1284,6 +1392,8 @@ func initQueryService(
 		EvmAuxStore:            app.EvmAuxStore,
 		Web3Cfg:                cfg.Web3,
 		DPOSCfg:                cfg.DPOS,
+		ThrottleAdmin:          throttleAdmin,
+		FnConsensus:            fnConsensusReactor,
 	}
 	bus := &rpc.QueryEventBus{
 		Subs:    *app.EventHandler.SubscriptionSet(),
@@ -1291,7 +1401,19 @@ func initQueryService(
 	}
 	var qsvc rpc.QueryService = rpc.NewInstrumentingMiddleWare(requestCount, requestLatency, qs)
 	logger := log.Root.With("module", "query-server")
-	err = rpc.RPCServer(qsvc, chainID, logger, bus, cfg.RPCBindAddress, cfg.UnsafeRPCEnabled, cfg.UnsafeRPCBindAddress)
+	unsafeRoutes := map[string]*rpcserver.RPCFunc{
+		"unsafe_throttle_reset_origin": rpcserver.NewRPCFunc(throttleAdmin.UnsafeResetOrigin, "origin"),
+		"unsafe_throttle_stats":        rpcserver.NewRPCFunc(throttleAdmin.UnsafeThrottleStats, "top"),
+	}
+	if fnConsensusReactor != nil {
+		unsafeRoutes["unsafe_fn_consensus_set_fn_enabled"] = rpcserver.NewRPCFunc(
+			fnConsensusReactor.UnsafeSetFnEnabled, "fnID,enabled",
+		)
+	}
+	err = rpc.RPCServer(
+		qsvc, chainID, logger, bus, cfg.RPCBindAddress, cfg.UnsafeRPCEnabled, cfg.UnsafeRPCBindAddress,
+		unsafeRoutes,
+	)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,13 @@
+// +build !e2efn
+
+package main
+
+import (
+	glAuth "github.com/loomnetwork/go-loom/auth"
+	"github.com/loomnetwork/loomchain/config"
+	"github.com/loomnetwork/loomchain/fnConsensus"
+)
+
+func startE2ETestFns(fnRegistry fnConsensus.FnRegistry, cfg *config.Config, nodeSigner glAuth.Signer) error {
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/loomnetwork/loomchain/store"
 	blockindex "github.com/loomnetwork/loomchain/store/block_index"
 	"github.com/loomnetwork/loomchain/throttle"
+	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 
@@ -75,6 +76,10 @@ type Config struct {
 	GoContractDeployerWhitelist *throttle.GoContractDeployerWhitelistConfig
 	TxLimiter                   *throttle.TxLimiterConfig
 	ContractTxLimiter           *throttle.ContractTxLimiterConfig
+	// Stake-tiered call limits for the karma middleware
+	StakeTiers *throttle.StakeTierConfig
+	// Settings of the karma throttle middleware
+	Throttle *throttle.ThrottleConfig
 	// Logging
 	LogDestination          string
 	ContractLogLevel        string
@@ -170,6 +175,11 @@ type Metrics struct {
 	BlockIndexStore bool
 	EventHandling   bool
 	Database        bool
+	// Collect metrics for the karma throttle
+	Throttle bool
+	// Collect per-origin throttle metrics, the number of labelled origins is bounded but this can
+	// still add many series.
+	ThrottlePerOrigin bool
 }
 
 type FnConsensusConfig struct {
@@ -217,10 +227,12 @@ type DBBackendConfig struct {
 }
 
 type KarmaConfig struct {
-	Enabled         bool  // Activate karma module
-	ContractEnabled bool  // Allows you to deploy karma contract to collect data even if chain doesn't use it
-	UpkeepEnabled   bool  // Adds an upkeep cost to deployed and active contracts for each user
-	MaxCallCount    int64 // Maximum number call transactions per session duration
+	Enabled         bool // Activate karma module
+	ContractEnabled bool // Allows you to deploy karma contract to collect data even if chain doesn't use it
+	UpkeepEnabled   bool // Adds an upkeep cost to deployed and active contracts for each user
+	// Deprecated: use Throttle.MaxCallCount & Throttle.SessionDuration instead, these are only used
+	// if the Throttle section doesn't set them.
+	MaxCallCount    int64 // Maximum number call transactions per session duration, zero or -1 for no limit
 	SessionDuration int64 // Session length in seconds
 }
 
@@ -270,6 +282,7 @@ func DefaultMetrics() *Metrics {
 		BlockIndexStore: false,
 		EventHandling:   true,
 		Database:        true,
+		Throttle:        true,
 	}
 }
 
@@ -360,6 +373,9 @@ func ParseConfig() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkThrottleFields(v); err != nil {
+		return nil, err
+	}
 
 	return conf, err
 }
@@ -382,6 +398,9 @@ func ParseConfigFrom(filename string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkThrottleFields(v); err != nil {
+		return nil, err
+	}
 
 	return conf, err
 }
@@ -450,6 +469,8 @@ func DefaultConfig() *Config {
 	cfg.HsmConfig = hsmpv.DefaultConfig()
 	cfg.TxLimiter = throttle.DefaultTxLimiterConfig()
 	cfg.ContractTxLimiter = throttle.DefaultContractTxLimiterConfig()
+	cfg.StakeTiers = throttle.DefaultStakeTierConfig()
+	cfg.Throttle = throttle.DefaultThrottleConfig()
 	cfg.GoContractDeployerWhitelist = throttle.DefaultGoContractDeployerWhitelistConfig()
 	cfg.DPOSv2OracleConfig = DefaultDPOS2OracleConfig()
 	cfg.CachingStoreConfig = store.DefaultCachingStoreConfig()
@@ -475,6 +496,28 @@ func DefaultConfig() *Config {
 	return cfg
 }
 
+// Returns an error naming the offending fields if the Throttle section contains unknown fields, since
+// a misspelled field would otherwise silently leave the throttle with its default settings.
+func checkThrottleFields(v *viper.Viper) error {
+	section := v.Get("Throttle")
+	if section == nil {
+		return nil
+	}
+	var cfg throttle.ThrottleConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           &cfg,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(section); err != nil {
+		return errors.Wrap(err, "invalid Throttle config")
+	}
+	return nil
+}
+
 func (c *Config) AddressMapperContractEnabled() bool {
 	return c.TransferGateway.ContractEnabled ||
 		c.LoomCoinTransferGateway.ContractEnabled ||
@@ -497,6 +540,8 @@ func (c *Config) Clone() *Config {
 	clone.HsmConfig = c.HsmConfig.Clone()
 	clone.TxLimiter = c.TxLimiter.Clone()
 	clone.ContractTxLimiter = c.ContractTxLimiter.Clone()
+	clone.StakeTiers = c.StakeTiers.Clone()
+	clone.Throttle = c.Throttle.Clone()
 	clone.EventStore = c.EventStore.Clone()
 	clone.EventDispatcher = c.EventDispatcher.Clone()
 	clone.Auth = c.Auth.Clone()
@@ -587,6 +632,219 @@ Karma:
   UpkeepEnabled: {{ .Karma.UpkeepEnabled }}
   MaxCallCount: {{ .Karma.MaxCallCount }}
   SessionDuration: {{ .Karma.SessionDuration }}
+Throttle:
+  # Override Karma.MaxCallCount & Karma.SessionDuration if non-zero, zero or -1 for no limit
+  MaxCallCount: {{ .Throttle.MaxCallCount }}
+  SessionDuration: {{ .Throttle.SessionDuration }}
+  MaxDeployCount: {{ .Throttle.MaxDeployCount }}
+  DeploySessionDuration: {{ .Throttle.DeploySessionDuration }}
+  # Max number of deploy txs each origin can send per day (UTC, derived from the block time), zero
+  # or -1 for no limit. The counts are stored in the app state so they survive restarts, this
+  # requires SessionStore state or SessionMode block.
+  MaxDailyDeployCount: {{ .Throttle.MaxDailyDeployCount }}
+  # Throttle deploy txs by the size of their bytecode, each deploy tx falls into the bucket with the
+  # highest MinBytes it reaches. A bucket can charge each deploy Cost units of MaxDeployCount
+  # instead of the usual cost, allow at most Limit deploys per origin per deploy session, or Reject
+  # the deploys outright (with ABCI code 437). Limit requires SessionStore state or SessionMode block.
+  DeployBuckets:
+  {{- range .Throttle.DeployBuckets}}
+    - MinBytes: {{.MinBytes}}
+      Cost: {{.Cost}}
+      Limit: {{.Limit}}
+      Reject: {{.Reject}}
+  {{- end}}
+  # Max total size in bytes of the txs each origin can send per session, zero or -1 for no limit.
+  # Applies to txs of any kind, independently of MaxCallCount & MaxDeployCount.
+  MaxTxBytes: {{ .Throttle.MaxTxBytes }}
+  # Max number of txs each origin can have in a single block, zero or -1 for no limit. In CheckTx
+  # txs are counted against the next block, so the cap is only enforced on a best-effort basis there.
+  MaxBlockTxCount: {{ .Throttle.MaxBlockTxCount }}
+  # Number of recent tx hashes remembered per origin, an origin that resends the exact same tx
+  # during a call session has it rejected in CheckTx without being charged. Zero disables this.
+  MaxRecentTxs: {{ .Throttle.MaxRecentTxs }}
+  # Max number of origins each node keeps session records for in memory, defaults to 100000 if zero.
+  # The records of origins whose sessions have ended are also swept once per session.
+  MaxTrackedOrigins: {{ .Throttle.MaxTrackedOrigins }}
+  # How new origins are treated once records are kept for MaxTrackedOrigins origins: evict | reduce
+  # In evict mode the record of the least recently active origin is evicted to make room, in reduce
+  # mode new origins share a single record with a call & deploy limit of PressureCallCount until
+  # room is made by origins going idle. Either way an error is logged while the store is saturated.
+  # Only applies to records kept in memory, records kept in the app state are pruned once idle.
+  PressurePolicy: "{{ .Throttle.PressurePolicy }}"
+  PressureCallCount: {{ .Throttle.PressureCallCount }}
+  # File the records kept in memory are snapshotted to every SnapshotInterval seconds (defaults to
+  # 60 if zero) & when the node stops, and restored from on startup, so a planned restart doesn't
+  # give every origin a fresh budget. Relative paths are relative to the node's root dir. Records whose sessions have ended
+  # are discarded on startup, and an unreadable snapshot is logged & ignored. Empty disables this.
+  SnapshotPath: "{{ .Throttle.SnapshotPath }}"
+  SnapshotInterval: {{ .Throttle.SnapshotInterval }}
+  # File every throttling decision (rejected txs, cooldowns starting & ending) is appended to as a
+  # JSON line, separately from the node log, allowed txs aren't logged. The file is rotated once it
+  # reaches AuditLogMaxBytes (defaults to 100MB if zero), keeping AuditLogMaxFiles rotated files
+  # (defaults to 5 if zero). Events are written in the background, if more than AuditQueueSize
+  # (defaults to 1024 if zero) are waiting further events are dropped & counted rather than slowing
+  # down txs. Relative paths are relative to the node's root dir. Empty disables the audit log.
+  AuditLogPath: "{{ .Throttle.AuditLogPath }}"
+  AuditLogMaxBytes: {{ .Throttle.AuditLogMaxBytes }}
+  AuditLogMaxFiles: {{ .Throttle.AuditLogMaxFiles }}
+  AuditQueueSize: {{ .Throttle.AuditQueueSize }}
+  # How txs are grouped into sessions: fixed | sliding | leaky
+  # In fixed mode each session starts with the first tx an origin sends, which allows bursts of up
+  # to twice the limit around the end of a session. In sliding mode the limit applies to any period
+  # of SessionDuration seconds (approximately). In leaky mode the call txs of each origin fill a
+  # bucket that holds as many txs as its call limit and leaks LeakRate txs per second (e.g. 0.5 for
+  # one tx every 2 seconds), the other budgets use fixed windows.
+  WindowMode: {{ .Throttle.WindowMode }}
+  LeakRate: {{ .Throttle.LeakRate }}
+  # What session durations are measured in: time | block
+  # In time mode sessions last SessionDuration seconds as measured by the clock of each node, since
+  # node clocks aren't in sync the limits are only reliable in CheckTx. In block mode sessions last
+  # SessionBlocks blocks and tx counts are stored in the app state, so all validators enforce the
+  # limits identically, but they must all use the same settings. WindowMode is ignored in block mode.
+  SessionMode: {{ .Throttle.SessionMode }}
+  SessionBlocks: {{ .Throttle.SessionBlocks }}
+  DeploySessionBlocks: {{ .Throttle.DeploySessionBlocks }}
+  # Where session records are kept in time mode: memory | state
+  # In memory mode each node tracks the txs it has seen itself and the records are lost on restart.
+  # In state mode the records are stored in the app state and sessions are timed by the block time,
+  # so all validators enforce the limits identically, but they must all use the same settings.
+  SessionStore: {{ .Throttle.SessionStore }}
+  # Phase of tx processing txs are counted in: check | deliver | both
+  # In check mode txs are only counted in CheckTx, which protects the mempool of each node but isn't
+  # enforced by consensus, this requires SessionStore memory. In deliver mode txs are only counted in
+  # DeliverTx so all validators enforce the limits, this requires SessionStore state or SessionMode
+  # block. In both mode txs are counted in memory in CheckTx and in the app state in DeliverTx,
+  # against separate budgets, this requires SessionStore state. Defaults to check with SessionStore
+  # memory and to deliver otherwise.
+  CountMode: "{{ .Throttle.CountMode }}"
+  # By default txs that fail after passing the throttle (e.g. due to a bad nonce) don't count
+  # against the limits of the origin, enable this to count them as well.
+  CountFailedTxs: {{ .Throttle.CountFailedTxs }}
+  # In pre mode txs are charged before they're processed and refunded if they fail, txs rejected by
+  # the throttle stay charged. In post mode txs are only checked against the limits before they're
+  # processed and charged once they succeed, so rejected & failed txs never touch the session
+  # records. Post mode is only supported with SessionMode time, and not with CountFailedTxs or
+  # BurstCallCount.
+  ChargeMode: "{{ .Throttle.ChargeMode }}"
+  # How much of the limits of the origin each tx consumes: unit | kind | size
+  # In unit mode every tx costs one, in kind mode call & deploy txs cost CallTxCost & DeployTxCost
+  # respectively, and in size mode txs cost one for every started KB.
+  TxCostMode: {{ .Throttle.TxCostMode }}
+  CallTxCost: {{ .Throttle.CallTxCost }}
+  DeployTxCost: {{ .Throttle.DeployTxCost }}
+  # Throttled txs are logged at info level, enable this to log at most one per origin per session.
+  LogSampling: {{ .Throttle.LogSampling }}
+  # Appended to the messages of the errors txs are rejected with, e.g.
+  # "See https://example.com/rate-limits for details"
+  HelpText: "{{ .Throttle.HelpText }}"
+  # Origins that aren't throttled at all
+  ExemptOrigins:
+  {{- range .Throttle.ExemptOrigins}}
+    - "{{. -}}"
+  {{- end}}
+  # Enable this during emergency upgrades to reject all txs, except those sent by the origins on
+  # MaintenanceAllowlist (e.g. governance & oracles), while the chain keeps producing blocks. Can be
+  # switched at runtime by reloading the config, or with the on-chain params. Every validator must
+  # switch it at the same time, since it affects which txs are included in blocks.
+  MaintenanceMode: {{ .Throttle.MaintenanceMode }}
+  MaintenanceAllowlist:
+  {{- range .Throttle.MaintenanceAllowlist}}
+    - "{{. -}}"
+  {{- end}}
+  # Base64 encoded ed25519 public key of the operator whose signed bypass tokens grant origins a
+  # call limit of their own until the tokens expire, e.g. for partners running a migration. Tokens
+  # are registered with the throttle_register_bypass RPC and only apply on the node they're
+  # registered with, so they're only supported when txs are counted in CheckTx. Empty disables
+  # bypass tokens.
+  BypassOperatorKey: "{{ .Throttle.BypassOperatorKey }}"
+  # Max number of seconds a bypass token can be valid for once it's registered, zero for a day.
+  BypassMaxDuration: {{ .Throttle.BypassMaxDuration }}
+  # Each origin can send up to BurstCallCount call txs in a single session (rather than its call
+  # limit) once every BurstRecoverySessions sessions, e.g. for onboarding flows that send several
+  # setup txs at once. Zero disables bursts, only supported by the memory session store in time mode.
+  BurstCallCount: {{ .Throttle.BurstCallCount }}
+  BurstRecoverySessions: {{ .Throttle.BurstRecoverySessions }}
+  # Origins that send PenaltyThreshold txs over their limits during a call session are put into a
+  # cooldown of PenaltyCooldown seconds, during which their txs are rejected immediately. Every tx
+  # sent during a cooldown doubles its length, up to PenaltyMaxCooldown seconds. Zero disables
+  # cooldowns, only supported by the memory session store in time mode.
+  PenaltyThreshold: {{ .Throttle.PenaltyThreshold }}
+  PenaltyCooldown: {{ .Throttle.PenaltyCooldown }}
+  PenaltyMaxCooldown: {{ .Throttle.PenaltyMaxCooldown }}
+  # Origins that send FailureThreshold consecutive txs that fail after passing the throttle are put
+  # into a cooldown of FailureCooldown seconds, during which their txs are rejected immediately.
+  # Every subsequent cooldown is twice as long, up to FailureMaxCooldown seconds. Failed txs are
+  # still refunded. Zero disables these cooldowns, only supported by the memory session store in
+  # time mode.
+  FailureThreshold: {{ .Throttle.FailureThreshold }}
+  FailureCooldown: {{ .Throttle.FailureCooldown }}
+  FailureMaxCooldown: {{ .Throttle.FailureMaxCooldown }}
+  # Max number of call txs all origins together (ContractCallCount), and each origin
+  # (OriginContractCallCount), can send to each contract per call session, zero or -1 for no limit.
+  # ContractLimits overrides both limits for specific contracts. Deploys aren't counted.
+  ContractCallCount: {{ .Throttle.ContractCallCount }}
+  OriginContractCallCount: {{ .Throttle.OriginContractCallCount }}
+  ContractLimits:
+  {{- range .Throttle.ContractLimits}}
+    - Contract: "{{.Contract}}"
+      CallCount: {{.CallCount}}
+      OriginCallCount: {{.OriginCallCount}}
+  {{- end}}
+  # Limits the call txs sent to specific methods of contracts, by all origins together (CallCount)
+  # and each origin (OriginCallCount), in addition to the contract limits. Method is either the
+  # 4-byte selector of an EVM contract method (0x...), or the name of a Go contract method. Calls to
+  # other methods, and calls whose method can't be decoded, are only subject to the contract limits.
+  MethodLimits:
+  {{- range .Throttle.MethodLimits}}
+    - Contract: "{{.Contract}}"
+      Method: "{{.Method}}"
+      CallCount: {{.CallCount}}
+      OriginCallCount: {{.OriginCallCount}}
+  {{- end}}
+  # Dimensions of the key the txs of each origin are tracked under: chain, address & mapped (which
+  # replaces origins from foreign chains with the local account they're mapped to, so limits apply
+  # per local identity rather than per signing key). Defaults to chain & address.
+  ThrottleKey:
+  {{- range .Throttle.ThrottleKey}}
+    - "{{. -}}"
+  {{- end}}
+  # Name of a contract whose oracle is exempted from the throttle, the oracle address is read from
+  # the contract state (under OracleKey) once per block so the exemption follows key rotations.
+  OracleContract: "{{ .Throttle.OracleContract }}"
+  OracleKey: "{{ .Throttle.OracleKey }}"
+  # Name of a contract whose state holds the limits of specific origins, e.g. so an admin contract
+  # can give an account 500 calls per hour. The entry of each origin is read once per block, exempt
+  # origins & genesis overrides take precedence over the table.
+  LimitTableContract: "{{ .Throttle.LimitTableContract }}"
+  # How txs sent by the current validators are treated: exempt (not throttled at all) or limit (each
+  # validator can send ValidatorCallCount call txs per session). Empty throttles validators like any
+  # other origin. The validator set is read once per block, enable ValidatorOperators to also cover
+  # the operator accounts validators are registered as in the DPOS contract.
+  ValidatorPolicy: "{{ .Throttle.ValidatorPolicy }}"
+  ValidatorCallCount: {{ .Throttle.ValidatorCallCount }}
+  ValidatorOperators: {{ .Throttle.ValidatorOperators }}
+  # Boosts the call limit of each origin by a multiplier (in percent) derived from the total amount
+  # it has delegated in the DPOS contract (in whole tokens). The multiplier is interpolated between
+  # the points, which must start at zero, and stays flat beyond the last one. Changes to delegations
+  # apply from the next block. Limits are boosted to at most DelegationBoostMaxLimit unless it's zero.
+  DelegationBoost:
+  {{- range .Throttle.DelegationBoost}}
+    - Delegation: {{.Delegation}}
+      Multiplier: {{.Multiplier}}
+  {{- end}}
+  DelegationBoostMaxLimit: {{ .Throttle.DelegationBoostMaxLimit }}
+  # Enable this to add the quota the origin has left (throttle.used, throttle.limit,
+  # throttle.remaining & throttle.window_end) to the tags of each tx that succeeds.
+  ResultTags: {{ .Throttle.ResultTags }}
+  # Enable this to add {"code", "limit", "used", "retry_after_unix"} as JSON to the Info & Data of
+  # the CheckTx response of each tx the throttle rejects, so wallets can tell when to resend it.
+  RejectionInfo: {{ .Throttle.RejectionInfo }}
+  # Enable this to read MaxCallCount, SessionDuration, MaxDeployCount, DeploySessionDuration,
+  # ExemptOrigins, MaintenanceMode & MaintenanceAllowlist from the app state once per block, so they
+  # can be changed by a throttle admin tx sent by the Karma oracle (once the tx:throttle-admin feature
+  # is enabled) without restarting the nodes. The values above are used while no valid params are
+  # stored.
+  OnChainParams: {{ .Throttle.OnChainParams }}
 GoContractDeployerWhitelist:
   Enabled: {{ .GoContractDeployerWhitelist.Enabled }}
   DeployerAddressList:
@@ -601,6 +859,17 @@ ContractTxLimiter:
   Enabled: {{ .ContractTxLimiter.Enabled }}
   ContractDataRefreshInterval: {{ .ContractTxLimiter.ContractDataRefreshInterval }}
   TierDataRefreshInterval: {{ .ContractTxLimiter.TierDataRefreshInterval }}
+# Determines the call limit of each origin by its stake rather than its call karma (requires Karma
+# to be enabled), thresholds are in whole tokens and must be in ascending order starting at zero.
+StakeTiers:
+  Enabled: {{ .StakeTiers.Enabled }}
+  # Where the stake of each origin is read from: coin | dpos
+  StakeSource: {{ .StakeTiers.StakeSource }}
+  Tiers:
+  {{- range .StakeTiers.Tiers}}
+    - MinStake: {{ .MinStake }}
+      Limit: {{ .Limit }}
+  {{- end}}
 
 #
 # ContractLoader
@@ -622,6 +891,8 @@ Metrics:
   BlockIndexStore: {{ .Metrics.BlockIndexStore }} 
   EventHandling: {{ .Metrics.EventHandling }}
   Database: {{ .Metrics.Database }}
+  Throttle: {{ .Metrics.Throttle }}
+  ThrottlePerOrigin: {{ .Metrics.ThrottlePerOrigin }}
 
 #
 # ChainConfig
@@ -795,6 +1066,49 @@ FnConsensus:
     # Set to false to make the node forward messages without tracking consensus state
     IsValidator: {{ .FnConsensus.Reactor.IsValidator }}
     FnVoteSigningThreshold: {{ .FnConsensus.Reactor.FnVoteSigningThreshold }}
+    # Number of consecutive voting rounds a Fn can fail to converge before an alert is raised (0 to disable)
+    FailedRoundsAlertThreshold: {{ .FnConsensus.Reactor.FailedRoundsAlertThreshold }}
+    # Number of rounds to keep local execution traces for (per Fn), 0 to disable tracing
+    RoundTracesPerFn: {{ .FnConsensus.Reactor.RoundTracesPerFn }}
+    {{- if .FnConsensus.Reactor.RoundTraceMaxMessageSize }}
+    RoundTraceMaxMessageSize: {{ .FnConsensus.Reactor.RoundTraceMaxMessageSize }}
+    {{- end }}
+    # Seconds the last block can lag behind the wall clock before the node is considered to be
+    # catching up (0 to disable), the reactor only relays messages while catching up
+    MaxBlockTimeLag: {{ .FnConsensus.Reactor.MaxBlockTimeLag }}
+    # Bounds for the number of bytes in the messages generated by Fns (0 max for no upper bound)
+    MinFnMessageSize: {{ .FnConsensus.Reactor.MinFnMessageSize }}
+    MaxFnMessageSize: {{ .FnConsensus.Reactor.MaxFnMessageSize }}
+    {{- if .FnConsensus.Reactor.FnMessageSizeLimits }}
+    # Message size limits that override the ones above for specific Fns
+    FnMessageSizeLimits:
+      {{- range $fnID, $limits := .FnConsensus.Reactor.FnMessageSizeLimits }}
+      "{{ $fnID }}":
+        Min: {{ $limits.Min }}
+        Max: {{ $limits.Max }}
+      {{- end }}
+    {{- end }}
+    # Embed the signing threshold & validator voting powers in votesets, enable only once all the
+    # validators support it
+    EmbedQuorumParams: {{ .FnConsensus.Reactor.EmbedQuorumParams }}
+    # Seconds between garbage collection passes over fnConsensus.db (0 to disable), the number of
+    # archived Maj23 votesets to keep per Fn (0 to keep all), and the seconds to keep evidence of
+    # conflicting Maj23 votesets for (0 to keep forever)
+    GCInterval: {{ .FnConsensus.Reactor.GCInterval }}
+    Maj23ArchiveRetention: {{ .FnConsensus.Reactor.Maj23ArchiveRetention }}
+    ConflictEvidenceRetention: {{ .FnConsensus.Reactor.ConflictEvidenceRetention }}
+    {{- if .FnConsensus.Reactor.InstanceName }}
+    InstanceName: "{{ .FnConsensus.Reactor.InstanceName }}"
+    {{- end }}
+    {{- if .FnConsensus.Reactor.VoteSetChannelID }}
+    VoteSetChannelID: {{ .FnConsensus.Reactor.VoteSetChannelID }}
+    {{- end }}
+    {{- if .FnConsensus.Reactor.MajChannelID }}
+    MajChannelID: {{ .FnConsensus.Reactor.MajChannelID }}
+    {{- end }}
+    # Rebuild the static validator set from the override validators that still exist in the TM
+    # validator set whenever it changes, must be the same on all validators
+    RefreshOverrideValidators: {{ .FnConsensus.Reactor.RefreshOverrideValidators }}
     {{- if .FnConsensus.Reactor.OverrideValidators }}
     OverrideValidators:
       {{- range $i, $v := .FnConsensus.Reactor.OverrideValidators }}
@@ -802,6 +1116,27 @@ FnConsensus:
         VotingPower: {{ $v.VotingPower }}
       {{- end }}
     {{- end }}
+    {{- if .FnConsensus.Reactor.FnHashAlgorithms }}
+    # Algorithm used to hash the messages generated by each Fn: sha512 | sha256 | keccak256
+    FnHashAlgorithms:
+      {{- range $fnID, $algo := .FnConsensus.Reactor.FnHashAlgorithms }}
+      "{{ $fnID }}": {{ $algo }}
+      {{- end }}
+    {{- end }}
+    {{- if .FnConsensus.Reactor.FnInitialNonces }}
+    # Nonce used for the first voting round of each Fn, if no nonce has been persisted for it yet
+    FnInitialNonces:
+      {{- range $fnID, $nonce := .FnConsensus.Reactor.FnInitialNonces }}
+      "{{ $fnID }}": {{ $nonce }}
+      {{- end }}
+    {{- end }}
+    {{- if .FnConsensus.Reactor.FnNonceNamespaces }}
+    # Namespace the nonce of each Fn is persisted under (defaults to the fnID)
+    FnNonceNamespaces:
+      {{- range $fnID, $namespace := .FnConsensus.Reactor.FnNonceNamespaces }}
+      "{{ $fnID }}": "{{ $namespace }}"
+      {{- end }}
+    {{- end }}
   {{- end }}
 {{- end }}
 
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -35,3 +37,19 @@ func TestConfig(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, reflect.DeepEqual(exampleRead, confRead))
 }
+
+func TestThrottleConfigUnknownFields(t *testing.T) {
+	const filename = "testThrottle"
+	defer os.Remove(filename + ".yaml")
+
+	require.NoError(t, ioutil.WriteFile(filename+".yaml", []byte("Throttle:\n  MaxCalCount: 5\n"), 0644))
+	_, err := ParseConfigFrom(filename)
+	require.Error(t, err)
+	require.Contains(t, strings.ToLower(err.Error()), "maxcalcount")
+
+	require.NoError(t, ioutil.WriteFile(filename+".yaml", []byte("Throttle:\n  MaxCallCount: 5\n"), 0644))
+	conf, err := ParseConfigFrom(filename)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), conf.Throttle.MaxCallCount)
+	require.Equal(t, "fixed", conf.Throttle.WindowMode)
+}
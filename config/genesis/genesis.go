@@ -22,7 +22,26 @@ func (c ContractConfig) VMType() lvm.VMType {
 	return lvm.VMType(lvm.VMType_value[c.VMTypeName])
 }
 
+// ThrottleOverride sets the throttle policy of a single origin (e.g. a gateway, oracle or faucet),
+// so every validator starts with the same policy for privileged accounts.
+type ThrottleOverride struct {
+	// chain:0x... address of the origin
+	Address string `json:"address"`
+	// Max number of call txs the origin can send per window, must be positive unless the origin is
+	// exempt
+	Limit int64 `json:"limit,omitempty"`
+	// Window length in seconds the limit applies to, defaults to the call session length if zero
+	Window int64 `json:"window,omitempty"`
+	// Exempts the origin from the throttle entirely, in which case limit & window must not be set
+	Exempt bool `json:"exempt,omitempty"`
+}
+
+type ThrottleGenesis struct {
+	Overrides []ThrottleOverride `json:"overrides"`
+}
+
 type Genesis struct {
 	Contracts []ContractConfig `json:"contracts"`
 	Config    cctypes.Config   `json:"config"`
+	Throttle  *ThrottleGenesis `json:"throttle,omitempty"`
 }
@@ -1,9 +1,6 @@
 package main
 
 import (
-	"fmt"
-	"os/exec"
-	"strings"
 	"testing"
 
 	"github.com/loomnetwork/loomchain/e2e/common"
@@ -30,19 +27,10 @@ func TestContractBlueprint(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		binary, err := exec.LookPath("go")
-		if err != nil {
+		// required binary, built once & shared by all the test cases
+		if err := common.InstallBinary(*config, "blueprint-cli", common.BlueprintCliPkg, common.BlueprintCliBinEv); err != nil {
 			t.Fatal(err)
 		}
-		// required binary
-		cmd := exec.Cmd{
-			Dir:  config.BaseDir,
-			Path: binary,
-			Args: []string{binary, "build", "-o", "blueprint-cli", "github.com/loomnetwork/go-loom/cli/blueprint"},
-		}
-		if err := cmd.Run(); err != nil {
-			t.Fatal(fmt.Errorf("fail to execute command: %s\n%v", strings.Join(cmd.Args, " "), err))
-		}
 
 		if err := common.DoRun(*config); err != nil {
 			t.Fatal(err)
@@ -0,0 +1,134 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/loomnetwork/loomchain/e2e/lib"
+)
+
+const (
+	// BlueprintCliBinEv can be set to the path of a prebuilt blueprint-cli, to skip building it.
+	BlueprintCliBinEv = "LOOM_E2E_CLI_BIN"
+	// BlueprintCliPkg is the package blueprint-cli is built from.
+	BlueprintCliPkg = "github.com/loomnetwork/go-loom/cli/blueprint"
+)
+
+var (
+	// assume that this test runs in e2e directory
+	depsLockFile = "../Gopkg.lock"
+
+	binCacheMtx sync.Mutex
+	binCache    = map[string]*cachedBinary{}
+)
+
+type cachedBinary struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// InstallBinary makes the binary with the given name available in the base directory of a test
+// case, so the test steps can run it. If the given environment variable is set it must point at a
+// prebuilt binary, otherwise the binary is built from pkg, see BuildBinary.
+func InstallBinary(config lib.Config, name, pkg, envVar string) error {
+	src, err := BuildBinary(name, pkg, envVar)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(config.BaseDir, name)
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(src, dst); err != nil {
+		return errors.Wrapf(err, "failed to link %s into %s", name, config.BaseDir)
+	}
+	return nil
+}
+
+// BuildBinary returns the absolute path of the binary with the given name. If the given environment
+// variable is set its value is returned, otherwise the binary is built from pkg at most once per
+// test run. Built binaries are cached in a temp dir keyed by pkg & the hash of the dependency lock
+// file, so later runs reuse them until the dependencies change.
+func BuildBinary(name, pkg, envVar string) (string, error) {
+	if envVar != "" {
+		if binPath := os.Getenv(envVar); binPath != "" {
+			absPath, err := filepath.Abs(binPath)
+			if err != nil {
+				return "", err
+			}
+			if _, err := os.Stat(absPath); err != nil {
+				return "", errors.Wrapf(err, "invalid %s", envVar)
+			}
+			return absPath, nil
+		}
+	}
+
+	binCacheMtx.Lock()
+	b, ok := binCache[pkg]
+	if !ok {
+		b = &cachedBinary{}
+		binCache[pkg] = b
+	}
+	binCacheMtx.Unlock()
+
+	b.once.Do(func() {
+		b.path, b.err = buildCachedBinary(name, pkg)
+	})
+	return b.path, b.err
+}
+
+func buildCachedBinary(name, pkg string) (string, error) {
+	key, err := binaryCacheKey(pkg)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(os.TempDir(), "loom-e2e-bin", key)
+	binPath := filepath.Join(dir, name)
+	if _, err := os.Stat(binPath); err == nil {
+		return binPath, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return "", err
+	}
+	// Build to a temp file & rename it once it's done, so concurrent test runs never pick up a
+	// partially written binary.
+	tmpPath := fmt.Sprintf("%s.%d.tmp", binPath, os.Getpid())
+	cmd := exec.Command(goBin, "build", "-o", tmpPath, pkg)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return "", errors.Errorf(
+			"failed to build %s: %s: %v\n%s", pkg, strings.Join(cmd.Args, " "), err, string(out),
+		)
+	}
+	if err := os.Rename(tmpPath, binPath); err != nil {
+		return "", err
+	}
+	return binPath, nil
+}
+
+// Returns a key that changes whenever the package or the versions of the dependencies change.
+func binaryCacheKey(pkg string) (string, error) {
+	lock, err := ioutil.ReadFile(depsLockFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read dependency lock file")
+	}
+	h := sha256.New()
+	h.Write([]byte(pkg))
+	h.Write(lock)
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loomnetwork/loomchain/e2e/lib"
+)
+
+func TestInstallPrebuiltBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "e2e-binaries")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	prebuilt := filepath.Join(dir, "prebuilt-cli")
+	require.NoError(t, ioutil.WriteFile(prebuilt, []byte("#!/bin/sh\n"), 0755))
+	baseDir := filepath.Join(dir, "test-case")
+	require.NoError(t, os.MkdirAll(baseDir, 0755))
+
+	const envVar = "LOOM_E2E_TEST_CLI_BIN"
+	defer os.Unsetenv(envVar)
+	os.Setenv(envVar, prebuilt)
+
+	config := lib.Config{BaseDir: baseDir}
+	// installing the binary twice in the same test case replaces the link
+	for i := 0; i < 2; i++ {
+		require.NoError(t, InstallBinary(config, "cli", "example.com/does/not/exist", envVar))
+		target, err := os.Readlink(filepath.Join(baseDir, "cli"))
+		require.NoError(t, err)
+		require.Equal(t, prebuilt, target)
+	}
+
+	os.Setenv(envVar, filepath.Join(dir, "missing-cli"))
+	_, err = BuildBinary("cli", "example.com/does/not/exist", envVar)
+	require.Error(t, err)
+}
+
+func TestBinaryCacheKey(t *testing.T) {
+	lockFile, err := ioutil.TempFile("", "e2e-lock")
+	require.NoError(t, err)
+	defer os.Remove(lockFile.Name())
+	_, err = lockFile.WriteString("[[projects]]\n")
+	require.NoError(t, err)
+	require.NoError(t, lockFile.Close())
+
+	origLockFile := depsLockFile
+	defer func() { depsLockFile = origLockFile }()
+	depsLockFile = lockFile.Name()
+
+	key1, err := binaryCacheKey("example.com/cli/a")
+	require.NoError(t, err)
+	key2, err := binaryCacheKey("example.com/cli/b")
+	require.NoError(t, err)
+	require.NotEqual(t, key1, key2)
+
+	key3, err := binaryCacheKey("example.com/cli/a")
+	require.NoError(t, err)
+	require.Equal(t, key1, key3)
+
+	// the key changes when the dependencies change
+	require.NoError(t, ioutil.WriteFile(lockFile.Name(), []byte("[[projects]]\n  name = \"x\"\n"), 0644))
+	key4, err := binaryCacheKey("example.com/cli/a")
+	require.NoError(t, err)
+	require.NotEqual(t, key1, key4)
+}
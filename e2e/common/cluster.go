@@ -0,0 +1,215 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/loomnetwork/loomchain/e2e/lib"
+	"github.com/loomnetwork/loomchain/e2e/node"
+)
+
+// Cluster runs the nodes of a config, and lets tests stop & restart individual nodes while the chain
+// is running, to check that validators recover from crashes. Unlike DoRun a Cluster doesn't run the
+// test cases of the config, the test drives the nodes itself.
+type Cluster struct {
+	Config lib.Config
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Links the p2p connections between the nodes go through, only set if the cluster was started
+	// with StartPartitionableCluster.
+	links map[linkKey]*peerLink
+}
+
+// StartCluster starts every node of the given config, and waits for them to produce a block.
+func StartCluster(config lib.Config) (*Cluster, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cluster{Config: config, ctx: ctx, cancel: cancel}
+	return c.start()
+}
+
+// StartPartitionableCluster starts every node of the given config like StartCluster, but routes the
+// p2p connections between the nodes through the harness, so tests can split the cluster with
+// Partition. Peer exchange is disabled on the nodes so they only connect through the harness.
+func StartPartitionableCluster(config lib.Config) (*Cluster, error) {
+	links, err := routePeersThroughLinks(config)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cluster{Config: config, ctx: ctx, cancel: cancel, links: links}
+	return c.start()
+}
+
+func (c *Cluster) start() (*Cluster, error) {
+	for _, n := range c.nodes() {
+		if err := n.Start(c.ctx); err != nil {
+			c.Stop()
+			return nil, err
+		}
+	}
+	if err := waitForCluster(c.Config, DefaultNodeStartTimeout); err != nil {
+		c.Stop()
+		return nil, withNodeLogs(err, c.Config)
+	}
+	return c, nil
+}
+
+// Node returns the node with the given index.
+func (c *Cluster) Node(i int) (*node.Node, error) {
+	n, ok := c.Config.Nodes[strconv.Itoa(i)]
+	if !ok {
+		return nil, fmt.Errorf("node %d not found", i)
+	}
+	return n, nil
+}
+
+// StopNode shuts down the node with the given index, killing it if it doesn't stop gracefully
+// within node.DefaultStopTimeout, and waits for its RPC to go down.
+func (c *Cluster) StopNode(i int) error {
+	n, err := c.Node(i)
+	if err != nil {
+		return err
+	}
+	if err := n.Stop(node.DefaultStopTimeout); err != nil {
+		return err
+	}
+	return waitForRPCDown(n, DefaultNodeStopTimeout)
+}
+
+// StartNode starts the node with the given index in its existing home directory, and waits for its
+// RPC to come up. The node may still be catching up with the rest of the cluster when StartNode
+// returns, see WaitForCatchUp.
+func (c *Cluster) StartNode(i int) error {
+	n, err := c.Node(i)
+	if err != nil {
+		return err
+	}
+	if err := n.Start(c.ctx); err != nil {
+		return err
+	}
+	return WaitForRPC(n, DefaultNodeStartTimeout)
+}
+
+// RestartNode stops & starts the node with the given index.
+func (c *Cluster) RestartNode(i int) error {
+	if err := c.StopNode(i); err != nil {
+		return errors.Wrapf(err, "failed to stop node %d", i)
+	}
+	return c.StartNode(i)
+}
+
+// WaitForBlocks waits until every running node of the cluster has committed the given number of
+// blocks, see WaitForBlocks.
+func (c *Cluster) WaitForBlocks(blocks int64, timeout time.Duration) error {
+	var running []*node.Node
+	for _, n := range c.nodes() {
+		if n.Running() {
+			running = append(running, n)
+		}
+	}
+	return waitForBlocks(running, blocks, timeout)
+}
+
+// Partition cuts the connections between the nodes in groupA & the nodes in groupB, the nodes
+// within each group stay connected. Nodes in neither group keep their connections to both groups.
+func (c *Cluster) Partition(groupA, groupB []int) error {
+	if c.links == nil {
+		return errors.New("cluster wasn't started with StartPartitionableCluster")
+	}
+	for _, a := range groupA {
+		for _, b := range groupB {
+			if a == b {
+				return fmt.Errorf("node %d is in both groups", a)
+			}
+			if _, err := c.Node(a); err != nil {
+				return err
+			}
+			if _, err := c.Node(b); err != nil {
+				return err
+			}
+		}
+	}
+	for _, a := range groupA {
+		for _, b := range groupB {
+			for _, key := range []linkKey{{from: int64(a), to: int64(b)}, {from: int64(b), to: int64(a)}} {
+				if link, ok := c.links[key]; ok {
+					link.Cut()
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Heal restores the connections cut by Partition. The nodes reconnect to each other on their own,
+// which may take a few seconds.
+func (c *Cluster) Heal() error {
+	if c.links == nil {
+		return errors.New("cluster wasn't started with StartPartitionableCluster")
+	}
+	for _, link := range c.links {
+		link.Restore()
+	}
+	return nil
+}
+
+// CheckAppHashes returns an error if the running nodes of the cluster didn't all commit to the same
+// app hash at the given height.
+func (c *Cluster) CheckAppHashes(height int64) error {
+	var first string
+	var hashes []string
+	mismatch := false
+	for _, n := range c.nodes() {
+		if !n.Running() {
+			continue
+		}
+		appHash, err := NodeAppHash(n, height)
+		if err != nil {
+			return errors.Wrapf(err, "node %d: failed to get app hash at height %d", n.ID, height)
+		}
+		if len(hashes) == 0 {
+			first = appHash
+		} else if appHash != first {
+			mismatch = true
+		}
+		hashes = append(hashes, fmt.Sprintf("node %d app hash 0x%s", n.ID, appHash))
+	}
+	if mismatch {
+		return errors.Errorf("app hash mismatch at height %d\n%s", height, strings.Join(hashes, "\n"))
+	}
+	return nil
+}
+
+// Stop shuts down every node of the cluster.
+func (c *Cluster) Stop() {
+	for _, n := range c.nodes() {
+		if err := n.Stop(node.DefaultStopTimeout); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+	for _, link := range c.links {
+		link.Close()
+	}
+	c.cancel()
+	stopCluster(c.Config)
+}
+
+func (c *Cluster) nodes() []*node.Node {
+	return sortedNodes(c.Config)
+}
+
+// Returns the nodes of the given config ordered by their index.
+func sortedNodes(config lib.Config) []*node.Node {
+	var nodes []*node.Node
+	for _, n := range config.Nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
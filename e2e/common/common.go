@@ -8,8 +8,8 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
+	"sync"
 	"syscall"
-	"time"
 
 	"github.com/pkg/errors"
 
@@ -37,38 +37,82 @@ var (
 	logLevel = flag.String("log-level", "debug", "Contract log level")
 	logDest  = flag.String("log-destination", "file://loom.log", "Log Destination")
 	logAppDb = flag.Bool("log-app-db", false, "Log app db usage to file")
+	Keep     = flag.Bool("keep", false, "Keep the node & step logs of tests that pass")
+	Cleanup  = flag.Bool("cleanup", false, "Kill the nodes left running by test runs that crashed, and exit")
 )
 
+// Paths of the binaries & contracts used by the tests, looked up once per test run since test cases
+// may run in parallel.
+type testBinaries struct {
+	loomPath     string
+	altLoomPath  string
+	contractDir  string
+	checkAppHash bool
+}
+
+var (
+	testBinariesOnce sync.Once
+	binaries         testBinaries
+	binariesErr      error
+)
+
+func lookupTestBinaries() (testBinaries, error) {
+	testBinariesOnce.Do(func() {
+		binaries.checkAppHash = len(os.Getenv(checkAppHash)) > 0
+		binaries.loomPath = os.Getenv(loomExeEv)
+		if len(binaries.loomPath) == 0 {
+			binaries.loomPath = defaultLoomPath
+		}
+		binaries.altLoomPath = os.Getenv(loomExe2Ev)
+		binaries.contractDir, binariesErr = filepath.Abs(defaultContractDir)
+	})
+	return binaries, binariesErr
+}
+
+// NewConfig generates the config of a test case, and the home directories of its nodes. The config
+// of each test case is independent of the others, provided the test cases have different names,
+// so test cases can run in parallel.
 func NewConfig(
 	name, testFile, genesisTmpl, yamlFile string,
 	validators, account, numEthAccounts int,
 	useFnConsensus bool,
 ) (*lib.Config, error) {
-	checkAppHashEV := os.Getenv(checkAppHash)
-	checkAppHash := len(checkAppHashEV) > 0
-
-	loomPath := os.Getenv(loomExeEv)
-	if len(loomPath) == 0 {
-		loomPath = defaultLoomPath
+	bins, err := lookupTestBinaries()
+	if err != nil {
+		return nil, err
 	}
 
-	altLoomPath := os.Getenv(loomExe2Ev)
 	v := uint64(validators)
 	altV := uint64(0)
-	if len(altLoomPath) > 0 {
+	if len(bins.altLoomPath) > 0 {
 		v, altV = splitValidators(uint64(validators))
 	}
 
-	contractdirAbs, err := filepath.Abs(defaultContractDir)
+	return GenerateConfig(
+		name, testFile, genesisTmpl, yamlFile, BaseDir, bins.contractDir, bins.loomPath, bins.altLoomPath,
+		v, altV,
+		account, numEthAccounts,
+		useFnConsensus, *Force, doCheckAppHash(bins.checkAppHash, uint64(v), uint64(altV)),
+	)
+}
+
+// NewConfigWithLoom is like NewConfig, but all the nodes run the given loom executable, for tests
+// that need a loom build with extra features compiled in.
+func NewConfigWithLoom(
+	loomPath, name, testFile, genesisTmpl, yamlFile string,
+	validators, account, numEthAccounts int,
+	useFnConsensus bool,
+) (*lib.Config, error) {
+	bins, err := lookupTestBinaries()
 	if err != nil {
 		return nil, err
 	}
 
 	return GenerateConfig(
-		name, testFile, genesisTmpl, yamlFile, BaseDir, contractdirAbs, loomPath, altLoomPath,
-		v, altV,
+		name, testFile, genesisTmpl, yamlFile, BaseDir, bins.contractDir, loomPath, "",
+		uint64(validators), 0,
 		account, numEthAccounts,
-		useFnConsensus, *Force, doCheckAppHash(checkAppHash, uint64(v), uint64(altV)),
+		useFnConsensus, *Force, false,
 	)
 }
 
@@ -197,6 +241,7 @@ func GenerateConfig(
 		conf.NodeBase64AddressList = append(conf.NodeBase64AddressList, n.Local)
 		conf.NodePubKeyList = append(conf.NodePubKeyList, n.PubKey)
 		conf.NodePrivKeyPathList = append(conf.NodePrivKeyPathList, n.PrivKeyPath)
+		conf.NodeRPCAddressList = append(conf.NodeRPCAddressList, n.RPCAddress)
 		conf.NodeProxyAppAddressList = append(conf.NodeProxyAppAddressList, n.ProxyAppAddress)
 	}
 	for _, account := range accounts {
@@ -258,12 +303,30 @@ func DoRun(config lib.Config) error {
 	}()
 
 	// wait for validators running
-	time.Sleep(3000 * time.Millisecond)
+	readyC := make(chan error, 1)
+	go func() {
+		readyC <- waitForCluster(config, DefaultNodeStartTimeout)
+	}()
+	select {
+	case err := <-readyC:
+		if err != nil {
+			cancel()
+			<-errC
+			return withNodeLogs(err, config)
+		}
+	case err := <-errC:
+		cancel()
+		if err == nil {
+			err = errors.New("validators stopped before they were ready")
+		}
+		return withNodeLogs(err, config)
+	}
 
 	// run test case
 	tc, err := lib.ReadTestCases(config.TestFile)
 	if err != nil {
 		cancel()
+		stopCluster(config)
 		return err
 	}
 
@@ -276,16 +339,34 @@ func DoRun(config lib.Config) error {
 	select {
 	case err := <-errC:
 		cancel()
-		time.Sleep(1000 * time.Millisecond)
-		return err
+		stopCluster(config)
+		if err != nil {
+			return withNodeLogs(err, config)
+		}
+		removeLogs(config)
+		return nil
 	case <-ctx.Done():
 	}
 	cancel()
-	time.Sleep(1000 * time.Millisecond)
+	stopCluster(config)
+	removeLogs(config)
 
 	return nil
 }
 
+// Adds the paths & tails of the logs of the nodes to the error of a failed test.
+func withNodeLogs(err error, config lib.Config) error {
+	return fmt.Errorf("%v\n\n%s", err, NodeLogsReport(config))
+}
+
+// Waits for the nodes to shut down after the context they run in has been cancelled, so the next
+// test can reuse their ports.
+func stopCluster(config lib.Config) {
+	if err := waitForClusterDown(config, DefaultNodeStopTimeout); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
 func runValidators(ctx context.Context, config lib.Config, eventC chan *node.Event) error {
 	// Trap Interrupts, SIGINTs and SIGTERMs.
 	sigC := make(chan os.Signal, 1)
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/loomnetwork/loomchain/e2e/engine"
+	"github.com/loomnetwork/loomchain/e2e/lib"
+	"github.com/loomnetwork/loomchain/e2e/node"
+)
+
+// Number of lines at the end of each node log included in the report of a failed test.
+const logTailLines = 50
+
+// NodeLogsReport returns the paths of the node & step logs of a test, and the last lines of each
+// node log, for inclusion in the failure message of the test.
+func NodeLogsReport(config lib.Config) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "step log: %s\n", path.Join(node.LogDir(config.BaseDir), engine.StepLogName))
+	for _, n := range sortedNodes(config) {
+		fmt.Fprintf(&b, "node %d log: %s\n", n.ID, n.LogPath)
+		tail, err := tailFile(n.LogPath, logTailLines)
+		if err != nil {
+			fmt.Fprintf(&b, "  failed to read log: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(&b, "--- last %d lines of node %d log ---\n%s\n", logTailLines, n.ID, tail)
+	}
+	return b.String()
+}
+
+// FinishLogs reports the logs of the nodes of a test if it failed, otherwise deletes them unless
+// the -keep flag is set.
+func FinishLogs(t testing.TB, config lib.Config) {
+	if t.Failed() {
+		t.Log(NodeLogsReport(config))
+		return
+	}
+	removeLogs(config)
+}
+
+func removeLogs(config lib.Config) {
+	if *Keep {
+		return
+	}
+	if err := os.RemoveAll(node.LogDir(config.BaseDir)); err != nil {
+		fmt.Printf("failed to remove logs: %v\n", err)
+	}
+}
+
+// Returns the last n lines of the given file.
+func tailFile(filename string, n int) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return string(bytes.Join(lines, []byte("\n"))), nil
+}
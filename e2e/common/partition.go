@@ -0,0 +1,225 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/loomnetwork/loomchain/e2e/lib"
+	"github.com/loomnetwork/loomchain/e2e/node"
+)
+
+const peerLinkDialTimeout = 5 * time.Second
+
+// peerLink forwards the p2p connections one node makes to another through a listener the harness
+// controls, so the harness can cut the link between the nodes to simulate a network partition.
+type peerLink struct {
+	from, to int64
+	target   string
+	listener net.Listener
+
+	mtx   sync.Mutex
+	cut   bool
+	conns map[net.Conn]struct{}
+}
+
+func newPeerLink(from, to int64, target string) (*peerLink, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen for link from node %d to node %d", from, to)
+	}
+	link := &peerLink{
+		from:     from,
+		to:       to,
+		target:   target,
+		listener: l,
+		conns:    map[net.Conn]struct{}{},
+	}
+	go link.accept()
+	return link, nil
+}
+
+// Addr returns the address the node the link is from should dial instead of the p2p address of the
+// node the link is to.
+func (l *peerLink) Addr() string {
+	return l.listener.Addr().String()
+}
+
+func (l *peerLink) accept() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			// the listener was closed
+			return
+		}
+		go l.forward(conn)
+	}
+}
+
+func (l *peerLink) forward(conn net.Conn) {
+	if l.isCut() {
+		conn.Close()
+		return
+	}
+	targetConn, err := net.DialTimeout("tcp", l.target, peerLinkDialTimeout)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	// the link may have been cut while dialing
+	if !l.track(conn, targetConn) {
+		conn.Close()
+		targetConn.Close()
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	pipe := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		// unblock the copy in the other direction
+		dst.Close()
+		src.Close()
+	}
+	go pipe(conn, targetConn)
+	go pipe(targetConn, conn)
+	wg.Wait()
+	l.untrack(conn, targetConn)
+}
+
+func (l *peerLink) isCut() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.cut
+}
+
+func (l *peerLink) track(conns ...net.Conn) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.cut {
+		return false
+	}
+	for _, c := range conns {
+		l.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (l *peerLink) untrack(conns ...net.Conn) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for _, c := range conns {
+		delete(l.conns, c)
+	}
+}
+
+// Cut drops the connections forwarded by the link, and refuses new ones until the link is restored.
+func (l *peerLink) Cut() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.cut = true
+	for c := range l.conns {
+		c.Close()
+	}
+	l.conns = map[net.Conn]struct{}{}
+}
+
+// Restore lets the link forward connections again.
+func (l *peerLink) Restore() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.cut = false
+}
+
+// Close stops the link from accepting connections, and drops the ones it's forwarding.
+func (l *peerLink) Close() {
+	l.listener.Close()
+	l.Cut()
+}
+
+type linkKey struct {
+	from, to int64
+}
+
+// Routes the p2p connections between every pair of nodes of the cluster through a peerLink, by
+// rewriting the peers the nodes dial. Must be called before the nodes are started.
+func routePeersThroughLinks(config lib.Config) (map[linkKey]*peerLink, error) {
+	nodes := sortedNodes(config)
+	byNodeKey := make(map[string]*node.Node, len(nodes))
+	for _, n := range nodes {
+		byNodeKey[n.NodeKey] = n
+	}
+
+	links := map[linkKey]*peerLink{}
+	closeLinks := func() {
+		for _, link := range links {
+			link.Close()
+		}
+	}
+	for _, n := range nodes {
+		var peers []string
+		for _, peer := range strings.Split(n.PersistentPeers, ",") {
+			if peer == "" {
+				continue
+			}
+			nodeKey, addr, err := parsePeer(peer)
+			if err != nil {
+				closeLinks()
+				return nil, errors.Wrapf(err, "node %d", n.ID)
+			}
+			to, ok := byNodeKey[nodeKey]
+			if !ok {
+				closeLinks()
+				return nil, errors.Errorf("node %d: peer %s isn't part of the cluster", n.ID, peer)
+			}
+			link, err := newPeerLink(n.ID, to.ID, addr)
+			if err != nil {
+				closeLinks()
+				return nil, err
+			}
+			links[linkKey{from: n.ID, to: to.ID}] = link
+			peers = append(peers, fmt.Sprintf("tcp://%s@%s", nodeKey, link.Addr()))
+		}
+		if err := setPeers(n, strings.Join(peers, ",")); err != nil {
+			closeLinks()
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// Parses a peer address of the form tcp://<node key>@<host>:<port>.
+func parsePeer(peer string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(peer, "tcp://"), "@", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.Errorf("invalid peer address %s", peer)
+	}
+	return parts[0], parts[1], nil
+}
+
+// Makes the node dial the given peers, and only those, when it's started.
+func setPeers(n *node.Node, peers string) error {
+	n.Peers = peers
+	n.PersistentPeers = peers
+	n.Config.Peers = peers
+	n.Config.PersistentPeers = peers
+	loomYamlPath := path.Join(n.Dir, "loom.yaml")
+	if err := n.Config.WriteToFile(loomYamlPath); err != nil {
+		return errors.Wrapf(err, "write config to %s", loomYamlPath)
+	}
+	// Peer exchange would let the nodes learn the p2p addresses of each other, and bypass the links.
+	configPath := path.Join(n.Dir, "chaindata", "config", "config.toml")
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	str := strings.Replace(string(data), "pex = true", "pex = false", -1)
+	return ioutil.WriteFile(configPath, []byte(str), 0644)
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Starts a server that echoes every line it receives.
+func startEchoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte(line)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func echo(conn net.Conn, msg string) (string, error) {
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte(msg + "\n")); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return line[:len(line)-1], nil
+}
+
+func TestPeerLink(t *testing.T) {
+	server := startEchoServer(t)
+	defer server.Close()
+
+	link, err := newPeerLink(0, 1, server.Addr().String())
+	require.NoError(t, err)
+	defer link.Close()
+
+	conn, err := net.Dial("tcp", link.Addr())
+	require.NoError(t, err)
+	defer conn.Close()
+	reply, err := echo(conn, "hello")
+	require.NoError(t, err)
+	require.Equal(t, "hello", reply)
+
+	// cutting the link drops the existing connections, and new ones are closed right away
+	link.Cut()
+	_, err = echo(conn, "hello")
+	require.Error(t, err)
+	conn2, err := net.Dial("tcp", link.Addr())
+	require.NoError(t, err)
+	defer conn2.Close()
+	_, err = echo(conn2, "hello")
+	require.Error(t, err)
+
+	link.Restore()
+	conn3, err := net.Dial("tcp", link.Addr())
+	require.NoError(t, err)
+	defer conn3.Close()
+	reply, err = echo(conn3, "world")
+	require.NoError(t, err)
+	require.Equal(t, "world", reply)
+}
+
+func TestParsePeer(t *testing.T) {
+	nodeKey, addr, err := parsePeer("tcp://abcd@127.0.0.1:26656")
+	require.NoError(t, err)
+	require.Equal(t, "abcd", nodeKey)
+	require.Equal(t, "127.0.0.1:26656", addr)
+
+	_, _, err = parsePeer("tcp://127.0.0.1:26656")
+	require.Error(t, err)
+	_, _, err = parsePeer("tcp://@127.0.0.1:26656")
+	require.Error(t, err)
+}
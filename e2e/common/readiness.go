@@ -0,0 +1,260 @@
+package common
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/loomnetwork/loomchain/e2e/lib"
+	"github.com/loomnetwork/loomchain/e2e/node"
+)
+
+const (
+	// DefaultNodeStartTimeout is how long DoRun waits for the RPC of every node to come up.
+	DefaultNodeStartTimeout = 2 * time.Minute
+	// DefaultNodeStopTimeout is how long DoRun waits for the RPC of every node to go down once the
+	// test is done, so the next test can reuse the ports.
+	DefaultNodeStopTimeout = 30 * time.Second
+
+	readinessPollInterval = 200 * time.Millisecond
+)
+
+var rpcClient = http.Client{
+	Timeout: 500 * time.Millisecond,
+}
+
+type nodeStatus struct {
+	Height     int64
+	CatchingUp bool
+}
+
+func (s *nodeStatus) String() string {
+	return fmt.Sprintf("height %d, catching up %v", s.Height, s.CatchingUp)
+}
+
+// Fetches the tendermint status of the given node.
+func getNodeStatus(n *node.Node) (*nodeStatus, error) {
+	var resp struct {
+		Result struct {
+			SyncInfo struct {
+				LatestBlockHeight string `json:"latest_block_height"`
+				CatchingUp        bool   `json:"catching_up"`
+			} `json:"sync_info"`
+		} `json:"result"`
+	}
+	if err := getRPC(n, "status", &resp); err != nil {
+		return nil, err
+	}
+	height, err := strconv.ParseInt(resp.Result.SyncInfo.LatestBlockHeight, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid latest_block_height")
+	}
+	return &nodeStatus{Height: height, CatchingUp: resp.Result.SyncInfo.CatchingUp}, nil
+}
+
+// Calls the given endpoint of the tendermint RPC of the node, and decodes the response into out.
+func getRPC(n *node.Node, endpoint string, out interface{}) error {
+	return getJSON(&rpcClient, fmt.Sprintf("%s/%s", n.RPCAddress, endpoint), out)
+}
+
+// Calls the given endpoint of the loom query server of the node, and decodes the response into out.
+func getQuery(n *node.Node, endpoint string, out interface{}) error {
+	return getJSON(&rpcClient, fmt.Sprintf("%s/query/%s", n.ProxyAppAddress, endpoint), out)
+}
+
+func getJSON(client *http.Client, addr string, out interface{}) error {
+	resp, err := client.Get(addr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status not OK: %s, response body: %s", resp.Status, string(respBytes))
+	}
+	return json.Unmarshal(respBytes, out)
+}
+
+// Calls check until it returns true or the timeout expires. check returns a description of what it
+// observed, which is included in the error returned on timeout.
+func poll(n *node.Node, condition string, timeout time.Duration, check func() (bool, string)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		done, last := check()
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf(
+				"node %d: timed out after %v waiting for %s, last status: %s", n.ID, timeout, condition, last,
+			)
+		}
+		time.Sleep(readinessPollInterval)
+	}
+}
+
+// WaitForRPC waits until the tendermint RPC of the given node reports a block height of at least 1.
+func WaitForRPC(n *node.Node, timeout time.Duration) error {
+	return poll(n, "RPC to report a block", timeout, func() (bool, string) {
+		status, err := getNodeStatus(n)
+		if err != nil {
+			return false, err.Error()
+		}
+		return status.Height >= 1, status.String()
+	})
+}
+
+// WaitForBlocks waits until every node of the cluster has committed the given number of blocks
+// past the height it was at when WaitForBlocks was called.
+func WaitForBlocks(config lib.Config, blocks int64, timeout time.Duration) error {
+	var nodes []*node.Node
+	for _, n := range config.Nodes {
+		nodes = append(nodes, n)
+	}
+	return waitForBlocks(nodes, blocks, timeout)
+}
+
+func waitForBlocks(nodes []*node.Node, blocks int64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	startHeights := make([]int64, len(nodes))
+	for i, n := range nodes {
+		height, err := NodeHeight(n)
+		if err != nil {
+			return errors.Wrapf(err, "node %d: failed to get status", n.ID)
+		}
+		startHeights[i] = height
+	}
+	for i, n := range nodes {
+		target := startHeights[i] + blocks
+		condition := fmt.Sprintf("height %d", target)
+		err := poll(n, condition, time.Until(deadline), func() (bool, string) {
+			status, err := getNodeStatus(n)
+			if err != nil {
+				return false, err.Error()
+			}
+			return status.Height >= target, status.String()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitForCatchUp waits until the given node has caught up with the chain, and reached at least the
+// given height.
+func WaitForCatchUp(n *node.Node, height int64, timeout time.Duration) error {
+	condition := fmt.Sprintf("catch up to height %d", height)
+	return poll(n, condition, timeout, func() (bool, string) {
+		status, err := getNodeStatus(n)
+		if err != nil {
+			return false, err.Error()
+		}
+		return !status.CatchingUp && status.Height >= height, status.String()
+	})
+}
+
+// NodeHeight returns the latest block height reported by the tendermint RPC of the given node.
+func NodeHeight(n *node.Node) (int64, error) {
+	status, err := getNodeStatus(n)
+	if err != nil {
+		return 0, err
+	}
+	return status.Height, nil
+}
+
+// NodeAppHash returns the app hash the given node committed to in the block at the given height.
+func NodeAppHash(n *node.Node, height int64) (string, error) {
+	var resp struct {
+		Result *struct {
+			SignedHeader struct {
+				Header struct {
+					AppHash string `json:"app_hash"`
+				} `json:"header"`
+			} `json:"signed_header"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	if err := getRPC(n, fmt.Sprintf("commit?height=%d", height), &resp); err != nil {
+		return "", err
+	}
+	if resp.Error != nil {
+		return "", errors.Errorf("%s: %s", resp.Error.Message, resp.Error.Data)
+	}
+	if resp.Result == nil {
+		return "", errors.Errorf("no commit at height %d", height)
+	}
+	return resp.Result.SignedHeader.Header.AppHash, nil
+}
+
+// WaitForTxCommitted waits until the tx with the given hash has been committed to a block by the
+// given node.
+func WaitForTxCommitted(n *node.Node, hash []byte, timeout time.Duration) error {
+	condition := fmt.Sprintf("tx 0x%X to be committed", hash)
+	return poll(n, condition, timeout, func() (bool, string) {
+		var resp struct {
+			Result *struct {
+				Height string `json:"height"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+				Data    string `json:"data"`
+			} `json:"error"`
+		}
+		if err := getRPC(n, "tx?hash=0x"+hex.EncodeToString(hash), &resp); err != nil {
+			return false, err.Error()
+		}
+		if resp.Error != nil {
+			return false, fmt.Sprintf("%s: %s", resp.Error.Message, resp.Error.Data)
+		}
+		if resp.Result == nil {
+			return false, "no result"
+		}
+		return true, fmt.Sprintf("committed at height %s", resp.Result.Height)
+	})
+}
+
+// Waits until the RPC of the given node stops responding.
+func waitForRPCDown(n *node.Node, timeout time.Duration) error {
+	return poll(n, "RPC to go down", timeout, func() (bool, string) {
+		status, err := getNodeStatus(n)
+		if err != nil {
+			return true, err.Error()
+		}
+		return false, status.String()
+	})
+}
+
+// Waits until the RPC of every node of the cluster reports a block.
+func waitForCluster(config lib.Config, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, n := range config.Nodes {
+		if err := WaitForRPC(n, time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Waits until the RPC of every node of the cluster stops responding.
+func waitForClusterDown(config lib.Config, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, n := range config.Nodes {
+		if err := waitForRPCDown(n, time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loomnetwork/loomchain/e2e/lib"
+	"github.com/loomnetwork/loomchain/e2e/node"
+)
+
+// Starts a fake tendermint RPC whose height is returned by height, and whose txs are committed once
+// committed returns true.
+func newFakeRPC(id int64, height func() int64, committed func() bool) (*node.Node, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			fmt.Fprintf(w, `{"result":{"sync_info":{"latest_block_height":"%d","catching_up":false}}}`, height())
+		case "/tx":
+			if committed() {
+				fmt.Fprint(w, `{"result":{"height":"7"}}`)
+			} else {
+				fmt.Fprint(w, `{"error":{"code":-32603,"message":"Internal error","data":"tx not found"}}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return &node.Node{ID: id, RPCAddress: server.URL}, server.Close
+}
+
+func TestWaitForRPC(t *testing.T) {
+	var height int64
+	n, stop := newFakeRPC(3, func() int64 { return atomic.AddInt64(&height, 1) - 1 }, nil)
+	defer stop()
+	require.NoError(t, WaitForRPC(n, 5*time.Second))
+	require.True(t, atomic.LoadInt64(&height) >= 2)
+
+	// The error names the node, the condition & the last status observed.
+	stalled, stopStalled := newFakeRPC(4, func() int64 { return 0 }, nil)
+	defer stopStalled()
+	err := WaitForRPC(stalled, 300*time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "node 4")
+	require.Contains(t, err.Error(), "RPC")
+	require.Contains(t, err.Error(), "height 0")
+
+	// Nodes whose RPC is down report the last error.
+	stopStalled()
+	err = WaitForRPC(stalled, 300*time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "connection refused")
+	require.NoError(t, waitForRPCDown(stalled, time.Second))
+}
+
+func TestWaitForBlocks(t *testing.T) {
+	var height1, height2 int64 = 10, 20
+	var producing int32
+	n1, stop1 := newFakeRPC(1, func() int64 { return atomic.AddInt64(&height1, 1) }, nil)
+	defer stop1()
+	n2, stop2 := newFakeRPC(2, func() int64 {
+		if atomic.LoadInt32(&producing) == 1 {
+			return atomic.AddInt64(&height2, 1)
+		}
+		return atomic.LoadInt64(&height2)
+	}, nil)
+	defer stop2()
+	config := lib.Config{Nodes: map[string]*node.Node{"1": n1, "2": n2}}
+
+	// Node 2 doesn't produce any blocks.
+	err := WaitForBlocks(config, 3, 500*time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "node 2")
+	require.Contains(t, err.Error(), "height 23")
+	require.Contains(t, err.Error(), "height 20")
+
+	atomic.StoreInt32(&producing, 1)
+	require.NoError(t, WaitForBlocks(config, 3, 5*time.Second))
+}
+
+func TestWaitForTxCommitted(t *testing.T) {
+	var polls int32
+	n, stop := newFakeRPC(0, nil, func() bool { return atomic.AddInt32(&polls, 1) > 2 })
+	defer stop()
+	hash := []byte{0xab, 0xcd}
+	require.NoError(t, WaitForTxCommitted(n, hash, 5*time.Second))
+
+	pending, stopPending := newFakeRPC(1, nil, func() bool { return false })
+	defer stopPending()
+	err := WaitForTxCommitted(pending, hash, 300*time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "node 1")
+	require.Contains(t, err.Error(), "tx 0xABCD")
+	require.Contains(t, err.Error(), "tx not found")
+}
@@ -0,0 +1,229 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/auth"
+	"github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/pkg/errors"
+
+	"github.com/loomnetwork/loomchain/e2e/node"
+	"github.com/loomnetwork/loomchain/vm"
+)
+
+// broadcast_tx_commit only returns once the tx has been committed to a block.
+var txClient = http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// TxClient sends txs signed by one of the accounts of a test straight to the tendermint RPC of a
+// node, so tests can check the ABCI codes txs are rejected with, which the loom CLI doesn't report.
+type TxClient struct {
+	node   *node.Node
+	signer auth.Signer
+	caller loom.Address
+}
+
+// TxResult is the outcome of a tx sent by a TxClient.
+type TxResult struct {
+	// ABCI response code, zero if the tx was committed successfully
+	Code uint32
+	Log  string
+	// True if the tx was rejected by CheckTx, in which case it wasn't included in a block
+	CheckTxFailed bool
+	Height        int64
+}
+
+// NewTxClient creates a client that signs txs with the ed25519 key in the given file, e.g. one of
+// the files in lib.Config.AccountPrivKeyPathList.
+func NewTxClient(n *node.Node, privKeyPath string) (*TxClient, error) {
+	data, err := ioutil.ReadFile(privKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid private key %s", privKeyPath)
+	}
+	signer := auth.NewEd25519Signer(privKey)
+	return &TxClient{
+		node:   n,
+		signer: signer,
+		caller: loom.Address{
+			ChainID: n.Config.ChainID,
+			Local:   loom.LocalAddressFromPublicKey(signer.PublicKey()),
+		},
+	}, nil
+}
+
+// Caller returns the address of the account the client signs txs with.
+func (c *TxClient) Caller() loom.Address {
+	return c.caller
+}
+
+// CallGoContract calls a method of the Go contract with the given name, and waits for the tx to be
+// committed. Returns an error only if the tx couldn't be sent, txs rejected by the node are reported
+// by the code of the result.
+func (c *TxClient) CallGoContract(contractName, method string, args proto.Message) (*TxResult, error) {
+	contractAddr, err := c.resolve(contractName)
+	if err != nil {
+		return nil, err
+	}
+	argsBytes, err := proto.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	body, err := proto.Marshal(&plugin.ContractMethodCall{
+		Method: method,
+		Args:   argsBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	input, err := proto.Marshal(&plugin.Request{
+		ContentType: plugin.EncodingType_PROTOBUF3,
+		Accept:      plugin.EncodingType_PROTOBUF3,
+		Body:        body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	callTx, err := proto.Marshal(&vm.CallTx{
+		VmType: vm.VMType_PLUGIN,
+		Input:  input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.commitTx(types.TxID_CALL, contractAddr, callTx)
+}
+
+func (c *TxClient) commitTx(id types.TxID, to loom.Address, data []byte) (*TxResult, error) {
+	msgTx, err := proto.Marshal(&vm.MessageTx{
+		From: c.caller.MarshalPB(),
+		To:   to.MarshalPB(),
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tx, err := proto.Marshal(&types.Transaction{
+		Id:   uint32(id),
+		Data: msgTx,
+	})
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := c.nonce()
+	if err != nil {
+		return nil, err
+	}
+	nonceTx, err := proto.Marshal(&auth.NonceTx{
+		Inner:    tx,
+		Sequence: nonce + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := proto.Marshal(auth.SignTx(c.signer, nonceTx))
+	if err != nil {
+		return nil, err
+	}
+	return broadcastTxCommit(c.node, signedTx)
+}
+
+// Returns the nonce of the last tx the caller committed.
+func (c *TxClient) nonce() (uint64, error) {
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	endpoint := fmt.Sprintf("nonce?key=%s", url.QueryEscape(`"`+hex.EncodeToString(c.signer.PublicKey())+`"`))
+	if err := getQuery(c.node, endpoint, &resp); err != nil {
+		return 0, errors.Wrap(err, "failed to query nonce")
+	}
+	if resp.Error != nil {
+		return 0, errors.Errorf("failed to query nonce: %s: %s", resp.Error.Message, resp.Error.Data)
+	}
+	// the nonce is encoded as a string
+	return strconv.ParseUint(strings.Trim(string(resp.Result), `"`), 10, 64)
+}
+
+// Returns the address of the contract with the given name.
+func (c *TxClient) resolve(name string) (loom.Address, error) {
+	var resp struct {
+		Result string `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	if err := getQuery(c.node, fmt.Sprintf("resolve?name=%s", url.QueryEscape(`"`+name+`"`)), &resp); err != nil {
+		return loom.Address{}, errors.Wrapf(err, "failed to resolve contract %s", name)
+	}
+	if resp.Error != nil {
+		return loom.Address{}, errors.Errorf("failed to resolve contract %s: %s: %s", name, resp.Error.Message, resp.Error.Data)
+	}
+	return loom.ParseAddress(resp.Result)
+}
+
+func broadcastTxCommit(n *node.Node, signedTx []byte) (*TxResult, error) {
+	var resp struct {
+		Result *struct {
+			CheckTx struct {
+				Code uint32 `json:"code"`
+				Log  string `json:"log"`
+			} `json:"check_tx"`
+			DeliverTx struct {
+				Code uint32 `json:"code"`
+				Log  string `json:"log"`
+			} `json:"deliver_tx"`
+			Height string `json:"height"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	endpoint := fmt.Sprintf("%s/broadcast_tx_commit?tx=0x%s", n.RPCAddress, hex.EncodeToString(signedTx))
+	if err := getJSON(&txClient, endpoint, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to broadcast tx")
+	}
+	if resp.Error != nil {
+		return nil, errors.Errorf("failed to broadcast tx: %s: %s", resp.Error.Message, resp.Error.Data)
+	}
+	if resp.Result == nil {
+		return nil, errors.New("failed to broadcast tx: no result")
+	}
+	if resp.Result.CheckTx.Code != 0 {
+		return &TxResult{
+			Code:          resp.Result.CheckTx.Code,
+			Log:           resp.Result.CheckTx.Log,
+			CheckTxFailed: true,
+		}, nil
+	}
+	height, err := strconv.ParseInt(resp.Result.Height, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid height")
+	}
+	return &TxResult{
+		Code:   resp.Result.DeliverTx.Code,
+		Log:    resp.Result.DeliverTx.Log,
+		Height: height,
+	}, nil
+}
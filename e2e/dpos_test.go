@@ -1,10 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/loomnetwork/loomchain/e2e/common"
+	"github.com/loomnetwork/loomchain/e2e/node"
 )
 
 func TestContractDPOS(t *testing.T) {
@@ -23,23 +25,201 @@ func TestContractDPOS(t *testing.T) {
 		{"dpos-2-r2", "dpos-2-validators.toml", 2, 10, "dposv3.genesis.json", "dposv3-test-loom.yaml"},
 		{"dpos-4", "dpos-4-validators.toml", 4, 10, "dposv3-2.genesis.json", "dposv3-test-loom.yaml"},
 		{"dpos-4-r2", "dpos-4-validators.toml", 4, 10, "dposv3-2.genesis.json", "dposv3-test-loom.yaml"},
+		{"dpos-8", "dpos-8-validators.toml", 8, 10, "dposv3-2.genesis.json", "dposv3-test-loom.yaml"},
 		{"dpos-elect-time", "dpos-elect-time-2-validators.toml", 2, 10, "dpos-elect-time.genesis.json", "dposv3-test-loom.yaml"},
 		{"dpos-unbond-all", "dposv3-unbond-all.toml", 4, 10, "dposv3.genesis.json", "dposv3-test-loom.yaml"},
 	}
 
 	for _, test := range tests {
+		test := test
+		// Each case runs its own cluster, in its own directory & with its own ports.
 		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
 			config, err := common.NewConfig(test.name, test.testFile, test.genFile, test.yamlFile, test.validators, test.accounts, 0, false)
 			if err != nil {
 				t.Fatal(err)
 			}
 
+			// DoRun waits for the nodes to come up before running the test, and for them to shut
+			// down before returning, so the next test can start right away.
 			if err := common.DoRun(*config); err != nil {
 				t.Fatal(err)
 			}
-
-			// pause before running the next test
-			time.Sleep(500 * time.Millisecond)
 		})
 	}
 }
+
+// Kills one of four validators for 30 blocks, the other three have enough voting power to keep the
+// chain going without it, and checks that the validator catches up once it's restarted.
+func TestDPOSValidatorRecoversFromCrash(t *testing.T) {
+	t.Parallel()
+	config, err := common.NewConfig(
+		"dpos-crash-recovery", "", "dposv3.genesis.json", "dposv3-test-loom.yaml", 4, 10, 0, false,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := common.StartCluster(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cluster.Stop()
+		common.FinishLogs(t, *config)
+	}()
+
+	if err := cluster.WaitForBlocks(2, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	node0, err := cluster.Node(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopWatching := watchForHalt(node0, 20*time.Second)
+
+	if err := cluster.StopNode(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.WaitForBlocks(30, 3*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.StartNode(3); err != nil {
+		t.Fatal(err)
+	}
+	height, err := common.NodeHeight(node0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node3, err := cluster.Node(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.WaitForCatchUp(node3, height, 2*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// Once it has caught up the validator keeps up with the others.
+	if err := cluster.WaitForBlocks(3, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := stopWatching(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Splits four validators into two groups of two, neither group has enough voting power to commit
+// blocks on its own, so the chain must halt until the partition is healed, and then resume without
+// the groups diverging.
+func TestDPOSNetworkPartition(t *testing.T) {
+	t.Parallel()
+	config, err := common.NewConfig(
+		"dpos-partition", "", "dposv3.genesis.json", "dposv3-test-loom.yaml", 4, 10, 0, true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := common.StartPartitionableCluster(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cluster.Stop()
+		common.FinishLogs(t, *config)
+	}()
+
+	if err := cluster.WaitForBlocks(2, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.Partition([]int{0, 1}, []int{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	// A block that was already being committed when the cluster was split may still make it.
+	time.Sleep(5 * time.Second)
+	splitHeights, err := nodeHeights(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Second)
+	heights, err := nodeHeights(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range heights {
+		if heights[i] != splitHeights[i] {
+			t.Fatalf("node %d committed blocks %d to %d while the cluster was split", i, splitHeights[i]+1, heights[i])
+		}
+	}
+
+	if err := cluster.Heal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.WaitForBlocks(5, 3*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	heights, err = nodeHeights(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minHeight := heights[0]
+	for _, height := range heights {
+		if height < minHeight {
+			minHeight = height
+		}
+	}
+	for height := splitHeights[0]; height <= minHeight; height++ {
+		if err := cluster.CheckAppHashes(height); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Returns the height of every node of the cluster, in the order of their index.
+func nodeHeights(cluster *common.Cluster) ([]int64, error) {
+	var heights []int64
+	for i := 0; i < len(cluster.Config.Nodes); i++ {
+		n, err := cluster.Node(i)
+		if err != nil {
+			return nil, err
+		}
+		height, err := common.NodeHeight(n)
+		if err != nil {
+			return nil, err
+		}
+		heights = append(heights, height)
+	}
+	return heights, nil
+}
+
+// Polls the height of the given node until the returned function is called, which returns an error
+// if the height didn't increase for longer than maxStall at any point.
+func watchForHalt(n *node.Node, maxStall time.Duration) func() error {
+	stopC := make(chan struct{})
+	errC := make(chan error, 1)
+	go func() {
+		var lastHeight int64
+		lastProgress := time.Now()
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopC:
+				errC <- nil
+				return
+			case <-ticker.C:
+			}
+			height, err := common.NodeHeight(n)
+			if err == nil && height > lastHeight {
+				lastHeight = height
+				lastProgress = time.Now()
+				continue
+			}
+			if stall := time.Since(lastProgress); stall > maxStall {
+				errC <- fmt.Errorf("chain halted at height %d for %v", lastHeight, stall)
+				return
+			}
+		}
+	}()
+	return func() error {
+		close(stopC)
+		return <-errC
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"os/exec"
 	"path"
 	"strconv"
@@ -67,7 +69,13 @@ func (e *engineCmd) Run(ctx context.Context, eventC chan *node.Event) error {
 	}
 	fmt.Printf("cluster is ready\n")
 
-	for _, n := range e.tests.TestCases {
+	stepLog, err := openStepLog(e.conf)
+	if err != nil {
+		return err
+	}
+	defer stepLog.Close()
+
+	for step, n := range e.tests.TestCases {
 		dir := e.conf.BaseDir
 		if n.Dir != "" {
 			dir = n.Dir
@@ -110,10 +118,11 @@ func (e *engineCmd) Run(ctx context.Context, eventC chan *node.Event) error {
 						fmt.Printf("--> error: %s\n", err)
 					}
 					fmt.Printf("--> output:\n%s\n", out)
+					logStep(stepLog, step, j, cmd.Args, out, err)
 
 					err = checkConditions(e, n, out)
 					if err != nil {
-						return err
+						return stepError(err, step, j, cmd.Args)
 					}
 				}
 			} else {
@@ -254,10 +263,12 @@ func (e *engineCmd) Run(ctx context.Context, eventC chan *node.Event) error {
 					fmt.Printf("--> error: %s\n", err)
 				}
 				fmt.Printf("--> output:\n%s\n", out)
+				nodeID := fmt.Sprintf("%d", n.Node)
+				logStep(stepLog, step, nodeID, cmd.Args, out, err)
 
 				err = checkConditions(e, n, out)
 				if err != nil {
-					return err
+					return stepError(err, step, nodeID, cmd.Args)
 				}
 
 			}
@@ -272,6 +283,36 @@ func (e *engineCmd) Run(ctx context.Context, eventC chan *node.Event) error {
 	return nil
 }
 
+// StepLogName is the name of the file in the log directory of a test that the commands run by each
+// step of the test, and their output, are written to.
+const StepLogName = "steps.log"
+
+func openStepLog(conf lib.Config) (*os.File, error) {
+	dir := node.LogDir(conf.BaseDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path.Join(dir, StepLogName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open step log")
+	}
+	return f, nil
+}
+
+func logStep(w io.Writer, step int, nodeID string, args []string, out []byte, err error) {
+	fmt.Fprintf(w, "--> step %d, node %s: %s\n", step, nodeID, strings.Join(args, " "))
+	if err != nil {
+		fmt.Fprintf(w, "--> error: %s\n", err)
+	}
+	fmt.Fprintf(w, "--> output:\n%s\n", out)
+}
+
+// Adds the step, node & command to the error of a failed condition, the output of the command is
+// already part of the error.
+func stepError(err error, step int, nodeID string, args []string) error {
+	return errors.Wrapf(err, "step %d failed on node %s: %s", step, nodeID, strings.Join(args, " "))
+}
+
 type AppHash struct {
 	apphash string
 	node    *node.Node
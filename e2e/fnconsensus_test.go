@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/loomchain/e2e/common"
+	"github.com/loomnetwork/loomchain/e2e/node"
+)
+
+const (
+	// Path of a loom executable built with `make loom-e2e-fn`, which registers the e2e_counter Fn.
+	fnLoomExeEv      = "LOOM_E2E_FN_BIN"
+	defaultFnLoomExe = "../loom-e2e-fn"
+
+	// Must match the values in cmd/loom/e2e_fn.go
+	e2eCounterFnID     = "e2e_counter"
+	e2eFnEventsFile    = "e2e-fn-events.log"
+	fnProposalInterval = 10 * time.Second
+)
+
+// Event recorded by the e2e_counter Fn.
+type fnEvent struct {
+	Node       int64 `json:"-"`
+	Event      string
+	Counter    string
+	Signatures int
+	Time       time.Time
+}
+
+// Boots four validators running the e2e_counter Fn with a signing threshold of All, checks that the
+// rounds converge & are submitted by the designated validator, that no round converges while one of
+// the validators is down, and that the validator takes part in the rounds again once restarted.
+func TestFnConsensusReactor(t *testing.T) {
+	t.Parallel()
+	loomPath := os.Getenv(fnLoomExeEv)
+	if loomPath == "" {
+		loomPath = defaultFnLoomExe
+	}
+	loomPath, err := filepath.Abs(loomPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(loomPath); os.IsNotExist(err) {
+		t.Skipf("%s not found, run make loom-e2e-fn or set %s", loomPath, fnLoomExeEv)
+	}
+
+	config, err := common.NewConfigWithLoom(
+		loomPath, "fnconsensus-4", "", "dposv3.genesis.json", "fnconsensus-loom.yaml", 4, 10, 0, true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startedAt := time.Now()
+	cluster, err := common.StartCluster(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := false
+	defer func() {
+		if !stopped {
+			cluster.Stop()
+		}
+		common.FinishLogs(t, *config)
+	}()
+
+	// The rounds converge, each converged round is submitted by a single validator, and the
+	// submitter rotates between the validators.
+	submits, err := waitForFnSubmits(cluster, 4, startedAt, 3*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitters := map[int64]bool{}
+	for _, submit := range submits {
+		if submit.Signatures != 4 {
+			t.Fatalf("node %d submitted counter %s with %d signatures", submit.Node, submit.Counter, submit.Signatures)
+		}
+		submitters[submit.Node] = true
+	}
+	if len(submitters) < 2 {
+		t.Fatalf("expected the submitter to rotate, all rounds submitted by %v", submitters)
+	}
+	// Once the reactor is up & running a round converges every interval.
+	last := submits[len(submits)-3:]
+	for i := 1; i < len(last); i++ {
+		if counterGap(last[i-1], last[i]) != 1 {
+			t.Fatalf("rounds didn't converge every interval: %s", sprintFnEvents(submits))
+		}
+	}
+
+	// Without all the validators the rounds can't converge.
+	if err := cluster.StopNode(3); err != nil {
+		t.Fatal(err)
+	}
+	// Let the round that was in progress when the validator went down run its course.
+	time.Sleep(fnProposalInterval + 2*time.Second)
+	stoppedAt := time.Now()
+	time.Sleep(3 * fnProposalInterval)
+	submits, err = fnSubmits(cluster, stoppedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(submits) > 0 {
+		t.Fatalf("rounds converged while a validator was down: %s", sprintFnEvents(submits))
+	}
+
+	// Once restarted the validator signs again, so the rounds converge again.
+	if err := cluster.StartNode(3); err != nil {
+		t.Fatal(err)
+	}
+	node0, err := cluster.Node(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	height, err := common.NodeHeight(node0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node3, err := cluster.Node(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.WaitForCatchUp(node3, height, 2*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	restartedAt := time.Now()
+	submits, err = waitForFnSubmits(cluster, 2, restartedAt, 3*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, submit := range submits {
+		if submit.Signatures != 4 {
+			t.Fatalf("node %d submitted counter %s with %d signatures", submit.Node, submit.Counter, submit.Signatures)
+		}
+	}
+	events, err := readFnEvents(node3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := false
+	for _, event := range events {
+		if event.Event == "sign" && event.Time.After(restartedAt) {
+			signed = true
+		}
+	}
+	if !signed {
+		t.Fatal("restarted validator didn't sign any counter")
+	}
+
+	// The reactor on each validator advanced the nonce once per converged round.
+	cluster.Stop()
+	stopped = true
+	if err := checkRoundTraces(loomPath, node0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads the events the e2e_counter Fn recorded on the given node.
+func readFnEvents(n *node.Node) ([]fnEvent, error) {
+	f, err := os.Open(filepath.Join(n.Dir, e2eFnEventsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var events []fnEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event fnEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("node %d: invalid Fn event %s: %v", n.ID, scanner.Text(), err)
+		}
+		event.Node = n.ID
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// Returns the counters submitted by the validators since the given time, ordered by counter.
+// Returns an error if a counter was submitted more than once.
+func fnSubmits(cluster *common.Cluster, since time.Time) ([]fnEvent, error) {
+	byCounter := map[string]fnEvent{}
+	for i := 0; i < len(cluster.Config.Nodes); i++ {
+		n, err := cluster.Node(i)
+		if err != nil {
+			return nil, err
+		}
+		events, err := readFnEvents(n)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if event.Event != "submit" || event.Time.Before(since) {
+				continue
+			}
+			if prev, ok := byCounter[event.Counter]; ok {
+				return nil, fmt.Errorf(
+					"counter %s submitted by both node %d & node %d", event.Counter, prev.Node, event.Node,
+				)
+			}
+			byCounter[event.Counter] = event
+		}
+	}
+	var submits []fnEvent
+	for _, event := range byCounter {
+		submits = append(submits, event)
+	}
+	sort.Slice(submits, func(i, j int) bool { return counterGap(submits[j], submits[i]) > 0 })
+	return submits, nil
+}
+
+// Waits until the validators have submitted the given number of counters since the given time.
+func waitForFnSubmits(cluster *common.Cluster, count int, since time.Time, timeout time.Duration) ([]fnEvent, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		submits, err := fnSubmits(cluster, since)
+		if err != nil {
+			return nil, err
+		}
+		if len(submits) >= count {
+			return submits, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf(
+				"timed out after %v waiting for %d counters to be submitted, got: %s",
+				timeout, count, sprintFnEvents(submits),
+			)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Returns how many intervals passed between the counters of the given events.
+func counterGap(from, to fnEvent) int64 {
+	var fromCounter, toCounter int64
+	fmt.Sscan(from.Counter, &fromCounter)
+	fmt.Sscan(to.Counter, &toCounter)
+	return toCounter - fromCounter
+}
+
+func sprintFnEvents(events []fnEvent) string {
+	s := ""
+	for _, event := range events {
+		s += fmt.Sprintf(
+			"\nnode %d %s counter %s with %d signatures at %v",
+			event.Node, event.Event, event.Counter, event.Signatures, event.Time,
+		)
+	}
+	return s
+}
+
+// Checks the round traces the reactor on the given stopped node recorded for the e2e_counter Fn,
+// the validator must have taken part in every round, and the nonce must have advanced by one after
+// each round that converged.
+func checkRoundTraces(loomPath string, n *node.Node) error {
+	cmd := exec.Command(
+		loomPath, "db", "dump-fn-round-traces", filepath.Join("chaindata", "data", "fnConsensus.db"), e2eCounterFnID,
+	)
+	cmd.Dir = n.Dir
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to dump round traces of node %d: %v", n.ID, err)
+	}
+	var traces []struct {
+		Nonce    int64
+		Decision string
+	}
+	if err := json.Unmarshal(out, &traces); err != nil {
+		return fmt.Errorf("invalid round traces: %v\n%s", err, string(out))
+	}
+	// The traces are ordered by nonce, a round that doesn't converge is retried with the same nonce,
+	// so there's only one trace per nonce.
+	agreed := 0
+	for i, trace := range traces {
+		if trace.Decision == "agree" {
+			agreed++
+		}
+		if i > 0 && trace.Nonce != traces[i-1].Nonce+1 {
+			return fmt.Errorf("node %d: nonce jumped from %d to %d", n.ID, traces[i-1].Nonce, trace.Nonce)
+		}
+	}
+	if agreed < 6 {
+		return fmt.Errorf("expected node %d to agree on at least 6 rounds, got %d:\n%s", n.ID, agreed, string(out))
+	}
+	return nil
+}
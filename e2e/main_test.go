@@ -2,11 +2,30 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"testing"
+
+	"github.com/loomnetwork/loomchain/e2e/common"
+	"github.com/loomnetwork/loomchain/e2e/node"
 )
 
 func TestMain(m *testing.M) {
 	flag.Parse()
-	os.Exit(m.Run())
+	if *common.Cleanup {
+		killed, err := node.ReapPIDFiles(common.BaseDir)
+		if err != nil {
+			fmt.Printf("failed to clean up: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("killed %d nodes left running by previous test runs\n", killed)
+		os.Exit(0)
+	}
+	// Nodes run in their own process groups so they don't get the interrupts sent to the tests, make
+	// sure they don't outlive the tests.
+	stopKillOnSignal := node.KillOnSignal()
+	code := m.Run()
+	stopKillOnSignal()
+	node.KillAll()
+	os.Exit(code)
 }
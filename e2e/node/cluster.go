@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"strings"
 	"time"
@@ -32,7 +33,7 @@ var (
 )
 
 func init() {
-	portGen = &portGenerator{}
+	portGen = newPortGenerator(os.Getpid())
 }
 
 func CreateCluster(nodes []*Node, account []*Account, fnconsensus bool) error {
@@ -83,6 +84,7 @@ func CreateCluster(nodes []*Node, account []*Account, fnconsensus bool) error {
 	idToP2P := make(map[int64]string)
 	idToRPCPort := make(map[int64]int)
 	idToProxyPort := make(map[int64]int)
+	idToUnsafeRPCPort := make(map[int64]int)
 	for _, node := range nodes {
 		// HACK: change rpc and p2p listen address so we can run it locally
 		configPath := path.Join(node.Dir, "chaindata", "config", "config.toml")
@@ -94,6 +96,7 @@ func CreateCluster(nodes []*Node, account []*Account, fnconsensus bool) error {
 		rpcPort := portGen.Next()
 		p2pPort := portGen.Next()
 		proxyAppPort := portGen.Next()
+		unsafeRPCPort := portGen.Next()
 		rpcLaddr := fmt.Sprintf("tcp://127.0.0.1:%d", rpcPort)
 		p2pLaddr := fmt.Sprintf("127.0.0.1:%d", p2pPort)
 		proxyAppPortAddr := fmt.Sprintf("tcp://127.0.0.1:%d", proxyAppPort)
@@ -123,6 +126,7 @@ func CreateCluster(nodes []*Node, account []*Account, fnconsensus bool) error {
 		idToP2P[node.ID] = p2pLaddr
 		idToRPCPort[node.ID] = rpcPort
 		idToProxyPort[node.ID] = proxyAppPort
+		idToUnsafeRPCPort[node.ID] = unsafeRPCPort
 		node.ProxyAppAddress = fmt.Sprintf("http://127.0.0.1:%d", proxyAppPort)
 		node.RPCAddress = fmt.Sprintf("http://127.0.0.1:%d", rpcPort)
 	}
@@ -160,6 +164,7 @@ func CreateCluster(nodes []*Node, account []*Account, fnconsensus bool) error {
 		node.Config.LogDestination = node.LogDestination
 		node.Config.RPCListenAddress = fmt.Sprintf("tcp://127.0.0.1:%d", rpcPort)
 		node.Config.RPCBindAddress = fmt.Sprintf("tcp://127.0.0.1:%d", proxyAppPort)
+		node.Config.UnsafeRPCBindAddress = fmt.Sprintf("tcp://127.0.0.1:%d", idToUnsafeRPCPort[node.ID])
 		if len(account) > 0 {
 			node.Config.Oracle = "default:" + account[0].Address
 		}
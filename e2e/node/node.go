@@ -43,7 +43,13 @@ type Node struct {
 	BaseYaml        string
 	RPCAddress      string
 	ProxyAppAddress string
-	Config          config.Config
+	// File the stdout & stderr of the loom process are written to
+	LogPath string
+	// File the pid of the loom process is written to while it's running
+	PIDPath string
+	Config  config.Config
+
+	proc *nodeProcess
 }
 
 func NewNode(ID int64, baseDir, loomPath, contractDir, genesisFile, yamlFile string) *Node {
@@ -52,12 +58,20 @@ func NewNode(ID int64, baseDir, loomPath, contractDir, genesisFile, yamlFile str
 		ContractDir: contractDir,
 		LoomPath:    loomPath,
 		Dir:         path.Join(baseDir, fmt.Sprintf("%d", ID)),
+		LogPath:     path.Join(LogDir(baseDir), fmt.Sprintf("node%d.log", ID)),
+		PIDPath:     path.Join(PIDDir(baseDir), fmt.Sprintf("node%d.pid", ID)),
 		BaseGenesis: genesisFile,
 		BaseYaml:    yamlFile,
 		Config:      *config.DefaultConfig(),
+		proc:        &nodeProcess{},
 	}
 }
 
+// LogDir returns the directory the logs of the nodes & test steps of a test are written to.
+func LogDir(baseDir string) string {
+	return path.Join(baseDir, "logs")
+}
+
 func (n *Node) Init(accounts []*Account) error {
 	if err := os.MkdirAll(n.Dir, 0744); err != nil {
 		return err
@@ -234,18 +248,9 @@ func (n *Node) Run(ctx context.Context, eventC chan *Event) error {
 	//have both the client and server give the previous test a few seconds to
 	//start you can't simply put a sleep here cause the client to the
 	//integration test needs to wait also
-	cmd := exec.CommandContext(ctx, n.LoomPath, "run", "--persistent-peers", n.PersistentPeers)
-	cmd.Dir = n.Dir
-	cmd.Env = append(os.Environ(),
-		"CONTRACT_LOG_DESTINATION=file://contract.log",
-		"CONTRACT_LOG_LEVEL=debug",
-	)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	errC := make(chan error)
-	go func() {
-		errC <- cmd.Run()
-	}()
+	if err := n.Start(ctx); err != nil {
+		return err
+	}
 
 	for {
 		select {
@@ -259,29 +264,22 @@ func (n *Node) Run(ctx context.Context, eventC chan *Event) error {
 					continue
 				}
 
-				err := cmd.Process.Kill()
-				if err != nil {
-					fmt.Printf("error kill process: %v", err)
+				if err := n.Stop(DefaultStopTimeout); err != nil {
+					fmt.Printf("error stopping node: %v\n", err)
 				}
 
 				dur := event.Duration.Duration
-				// consume error when killing process
-				e := <-errC
-				if e != nil {
-					// check error
-				}
 				fmt.Printf("stopped node %d for %v\n", n.ID, dur)
 
 				// restart
 				time.Sleep(dur)
-				cmd = exec.CommandContext(ctx, n.LoomPath, "run", "--persistent-peers", n.PersistentPeers)
-				cmd.Dir = n.Dir
-				go func() {
-					fmt.Printf("starting node %d after %v\n", n.ID, dur)
-					errC <- cmd.Run()
-				}()
+				fmt.Printf("starting node %d after %v\n", n.ID, dur)
+				if err := n.Start(ctx); err != nil {
+					return err
+				}
 			}
-		case err := <-errC:
+		case <-n.exited():
+			err := n.exitErr()
 			if err != nil {
 				fmt.Printf("node %d error %v\n", n.ID, err)
 			}
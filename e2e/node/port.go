@@ -1,26 +1,68 @@
 package node
 
 import (
+	"fmt"
 	"net"
-	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Ports handed out to nodes are allocated from [minPort, maxPort), which is below the ephemeral
+	// port range of linux (32768+) & macOS (49152+), so the kernel doesn't pick them for outgoing
+	// connections while the nodes aren't listening on them yet, or while a node is being restarted.
+	minPort = 20000
+	maxPort = 32000
+	// Each test process allocates ports from its own block, so test binaries run in parallel by go
+	// test don't hand out the same ports.
+	portBlockSize = 500
 )
 
 type portGenerator struct {
-	smap sync.Map
+	// Listens on the first port of the block for as long as the process runs, which claims the block
+	// so other test processes skip it.
+	claim net.Listener
+	// Ports are handed out from [start, end).
+	start int
+	end   int
+	next  int32
+}
+
+// Claims a block of ports for the test process with the given pid, starting from the block chosen
+// by its pid, and moving on to the next block while the block is claimed by another test process.
+func newPortGenerator(pid int) *portGenerator {
+	blocks := (maxPort - minPort) / portBlockSize
+	for i := 0; i < blocks; i++ {
+		start := minPort + ((pid+i)%blocks)*portBlockSize
+		claim, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", start))
+		if err != nil {
+			continue
+		}
+		return &portGenerator{claim: claim, start: start + 1, end: start + portBlockSize}
+	}
+	panic(fmt.Sprintf("no unclaimed block of %d ports in [%d, %d)", portBlockSize, minPort, maxPort))
 }
 
+// Next returns a free port from the block of the generator it hasn't handed out before, it panics
+// once every port in the block has been handed out.
 func (p *portGenerator) Next() int {
-	// make sure that we don't reuse the port
-	var port int
 	for {
-		port = GetPort()
-		_, ok := p.smap.Load(port)
-		if !ok {
-			p.smap.Store(port, port)
-			break
+		port := p.start + int(atomic.AddInt32(&p.next, 1)-1)
+		if port >= p.end {
+			panic(fmt.Sprintf("every port in [%d, %d) has been handed out", p.start, p.end))
+		}
+		if portFree(port) {
+			return port
 		}
 	}
-	return port
+}
+
+func portFree(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
 }
 
 // GetFreePort asks the kernel for a free open port that is ready to use.
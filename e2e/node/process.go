@@ -0,0 +1,182 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultStopTimeout is how long Stop waits for a node to shut down gracefully before killing it.
+const DefaultStopTimeout = 10 * time.Second
+
+// nodeProcess tracks the loom process a node is running, if any.
+type nodeProcess struct {
+	mtx  sync.Mutex
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+// Start runs loom in the home directory of the node, so a restarted node picks up its existing
+// chain data & listens on the same ports. The process is killed, along with any processes it
+// started, if ctx is cancelled.
+func (n *Node) Start(ctx context.Context) error {
+	p := n.process()
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.running() {
+		return errors.Errorf("node %d is already running", n.ID)
+	}
+	cmd := exec.Command(n.LoomPath, "run", "--persistent-peers", n.PersistentPeers)
+	cmd.Dir = n.Dir
+	// Run loom in its own process group so its whole process tree can be killed at once.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = append(os.Environ(),
+		"CONTRACT_LOG_DESTINATION=file://contract.log",
+		"CONTRACT_LOG_LEVEL=debug",
+	)
+	logFile, err := n.openLog()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = logFile
+	cmd.Stdout = logFile
+	closeLog := func() {
+		if logFile != os.Stdout {
+			logFile.Close()
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		closeLog()
+		return errors.Wrapf(err, "failed to start node %d", n.ID)
+	}
+	pid := cmd.Process.Pid
+	if err := tracker.add(pid, n.PIDPath, n.LoomPath); err != nil {
+		killGroup(pid, syscall.SIGKILL)
+		cmd.Wait()
+		closeLog()
+		tracker.remove(pid)
+		return errors.Wrapf(err, "failed to track node %d", n.ID)
+	}
+	done := make(chan struct{})
+	p.cmd = cmd
+	p.done = done
+	p.err = nil
+	go func() {
+		err := cmd.Wait()
+		// Kill whatever loom left running, so it doesn't hold on to ports.
+		if err := killGroup(pid, syscall.SIGKILL); err != nil {
+			fmt.Printf("failed to kill process group of node %d: %v\n", n.ID, err)
+		}
+		tracker.remove(pid)
+		closeLog()
+		p.mtx.Lock()
+		p.err = err
+		p.mtx.Unlock()
+		close(done)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			killGroup(pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	return nil
+}
+
+// Opens the log file of the node for appending, so the logs of a restarted node follow the logs it
+// wrote before it was stopped. Falls back to stdout if the node has no log file.
+func (n *Node) openLog() (*os.File, error) {
+	if n.LogPath == "" {
+		return os.Stdout, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(n.LogPath), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(n.LogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open log of node %d", n.ID)
+	}
+	return f, nil
+}
+
+// Stop asks the loom process of the node to shut down, and kills it if it's still running after
+// the given timeout. Returns once the process has exited, does nothing if the node isn't running.
+func (n *Node) Stop(timeout time.Duration) error {
+	p := n.process()
+	p.mtx.Lock()
+	if !p.running() {
+		p.mtx.Unlock()
+		return nil
+	}
+	cmd, done := p.cmd, p.done
+	p.mtx.Unlock()
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		fmt.Printf("failed to signal node %d: %v\n", n.ID, err)
+	}
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+	fmt.Printf("node %d didn't stop within %v, killing it\n", n.ID, timeout)
+	if err := killGroup(cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		return errors.Wrapf(err, "failed to kill node %d", n.ID)
+	}
+	<-done
+	return nil
+}
+
+// Running returns true if the loom process of the node is running.
+func (n *Node) Running() bool {
+	p := n.process()
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.running()
+}
+
+// Returns a channel that's closed when the current loom process of the node exits, or nil if the
+// node has never been started.
+func (n *Node) exited() <-chan struct{} {
+	p := n.process()
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.done
+}
+
+// Returns the error the last loom process of the node exited with.
+func (n *Node) exitErr() error {
+	p := n.process()
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.err
+}
+
+func (n *Node) process() *nodeProcess {
+	if n.proc == nil {
+		n.proc = &nodeProcess{}
+	}
+	return n.proc
+}
+
+// Must be called with the lock held.
+func (p *nodeProcess) running() bool {
+	if p.done == nil {
+		return false
+	}
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,206 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	helperDirEv   = "LOOM_E2E_HELPER_DIR"
+	helperCrashEv = "LOOM_E2E_HELPER_CRASH"
+)
+
+// Stands in for loom, starts a child process of its own & waits for it, like loom does with
+// contract plugins.
+const fakeLoom = `#!/bin/sh
+sleep 300 &
+echo $! > child.pid
+wait
+`
+
+func newFakeNode(t *testing.T, dir string) *Node {
+	loomPath := filepath.Join(dir, "fake-loom")
+	if err := ioutil.WriteFile(loomPath, []byte(fakeLoom), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &Node{
+		ID:       0,
+		Dir:      dir,
+		LoomPath: loomPath,
+		LogPath:  filepath.Join(LogDir(dir), "node0.log"),
+		PIDPath:  filepath.Join(PIDDir(dir), "node0.pid"),
+	}
+}
+
+// Returns the pids of the fake loom process & its child, once both are running.
+func waitForFakeNode(t *testing.T, n *Node) (int, int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		pid, _, err := readPIDFile(n.PIDPath)
+		childData, childErr := ioutil.ReadFile(filepath.Join(n.Dir, "child.pid"))
+		if err == nil && childErr == nil {
+			child, err := strconv.Atoi(strings.TrimSpace(string(childData)))
+			if err == nil {
+				return pid, child
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("fake node didn't start")
+	return 0, 0
+}
+
+// Returns true if the given process exists & isn't a zombie.
+func processAlive(pid int) bool {
+	out, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+	stat := strings.TrimSpace(string(out))
+	return stat != "" && !strings.HasPrefix(stat, "Z")
+}
+
+func requireDead(t *testing.T, pids ...int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for _, pid := range pids {
+		for processAlive(pid) {
+			if time.Now().After(deadline) {
+				t.Fatalf("process %d survived", pid)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+func TestStopKillsProcessTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "e2e-node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := newFakeNode(t, dir)
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pid, child := waitForFakeNode(t, n)
+	if err := n.Stop(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	requireDead(t, pid, child)
+	if _, err := os.Stat(n.PIDPath); !os.IsNotExist(err) {
+		t.Fatalf("pid file wasn't removed: %v", err)
+	}
+}
+
+func TestCancelKillsProcessTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "e2e-node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := newFakeNode(t, dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := n.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pid, child := waitForFakeNode(t, n)
+	cancel()
+	<-n.exited()
+	requireDead(t, pid, child)
+}
+
+// Runs the fake node in a separate test process, which is then interrupted or crashes.
+func TestHelperRunNode(t *testing.T) {
+	dir := os.Getenv(helperDirEv)
+	if dir == "" {
+		t.Skip("only run by other tests")
+	}
+	defer KillOnSignal()()
+	n := newFakeNode(t, dir)
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitForFakeNode(t, n)
+	if os.Getenv(helperCrashEv) != "" {
+		panic("deliberate failure mid-run")
+	}
+	time.Sleep(time.Minute)
+	t.Fatal("helper wasn't interrupted")
+}
+
+func startHelper(t *testing.T, dir string, crash bool) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestHelperRunNode$")
+	cmd.Env = append(os.Environ(), helperDirEv+"="+dir)
+	if crash {
+		cmd.Env = append(cmd.Env, helperCrashEv+"=1")
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestKillOnInterrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "e2e-node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	helper := startHelper(t, dir, false)
+	pid, child := waitForFakeNode(t, &Node{Dir: dir, PIDPath: filepath.Join(PIDDir(dir), "node0.pid")})
+	if err := helper.Process.Signal(syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	if err := helper.Wait(); err == nil {
+		t.Fatal("expected the interrupted helper to fail")
+	}
+	requireDead(t, pid, child)
+}
+
+func TestReapPIDFilesAfterCrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "e2e-node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	helper := startHelper(t, dir, true)
+	if err := helper.Wait(); err == nil {
+		t.Fatal("expected the helper to crash")
+	}
+	pid, child := waitForFakeNode(t, &Node{Dir: dir, PIDPath: filepath.Join(PIDDir(dir), "node0.pid")})
+	// nothing cleans up after a panic, the next run has to reap the leftovers
+	if !processAlive(pid) || !processAlive(child) {
+		t.Fatal("expected the node to survive the crash")
+	}
+	killed, err := ReapPIDFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if killed != 1 {
+		t.Fatalf("expected 1 process group to be killed, got %d", killed)
+	}
+	requireDead(t, pid, child)
+	if _, err := os.Stat(filepath.Join(PIDDir(dir), "node0.pid")); !os.IsNotExist(err) {
+		t.Fatalf("pid file wasn't removed: %v", err)
+	}
+
+	killed, err = ReapPIDFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if killed != 0 {
+		t.Fatalf("expected no process groups to be killed, got %d", killed)
+	}
+}
@@ -0,0 +1,176 @@
+package node
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Each loom process is started in its own process group, so killing the group also kills any
+// processes loom started itself, e.g. contract plugins.
+
+// processTracker keeps track of the loom processes started by the test process that are still
+// running, so they can be killed if the test process is interrupted.
+type processTracker struct {
+	mtx sync.Mutex
+	// pid of each running process => pid file of the process
+	pidFiles map[int]string
+}
+
+var tracker = &processTracker{pidFiles: map[int]string{}}
+
+// Records the given process, and writes its pid file, so the process can be killed by a later test
+// run if this one crashes.
+func (t *processTracker) add(pid int, pidFile, loomPath string) error {
+	t.mtx.Lock()
+	t.pidFiles[pid] = pidFile
+	t.mtx.Unlock()
+	if pidFile == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(pidFile), 0755); err != nil {
+		return err
+	}
+	data := fmt.Sprintf("%d\n%s\n", pid, loomPath)
+	return ioutil.WriteFile(pidFile, []byte(data), 0644)
+}
+
+func (t *processTracker) remove(pid int) {
+	t.mtx.Lock()
+	pidFile := t.pidFiles[pid]
+	delete(t.pidFiles, pid)
+	t.mtx.Unlock()
+	if pidFile != "" {
+		os.Remove(pidFile)
+	}
+}
+
+func (t *processTracker) pids() []int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	var pids []int
+	for pid := range t.pidFiles {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// Kills the process group led by the given process, ignoring groups that no longer exist.
+func killGroup(pid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pid, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// PIDDir returns the directory the pid files of the nodes of a test are written to.
+func PIDDir(baseDir string) string {
+	return path.Join(baseDir, "pids")
+}
+
+// KillAll kills the process groups of all the nodes started by the test process that are still
+// running. Their pid files are removed once they exit.
+func KillAll() {
+	for _, pid := range tracker.pids() {
+		if err := killGroup(pid, syscall.SIGKILL); err != nil {
+			fmt.Printf("failed to kill process group %d: %v\n", pid, err)
+		}
+	}
+}
+
+// KillOnSignal makes the test process kill every node it started, and exit, when it's interrupted.
+// The returned function uninstalls the signal handler.
+func KillOnSignal() func() {
+	sigC := make(chan os.Signal, 1)
+	stopC := make(chan struct{})
+	signal.Notify(sigC, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigC:
+			fmt.Printf("received %v, killing all nodes\n", sig)
+			KillAll()
+			os.Exit(1)
+		case <-stopC:
+		}
+	}()
+	return func() {
+		signal.Stop(sigC)
+		close(stopC)
+	}
+}
+
+// ReapPIDFiles kills the process groups listed in the pid files found under the given directory,
+// which are left behind by test runs that crashed before they could stop their nodes, and removes
+// the pid files. Returns the number of process groups that were killed.
+func ReapPIDFiles(dir string) (int, error) {
+	var pidFiles []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Base(filepath.Dir(p)) == "pids" && filepath.Ext(p) == ".pid" {
+			pidFiles = append(pidFiles, p)
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	killed := 0
+	for _, pidFile := range pidFiles {
+		pid, loomPath, err := readPIDFile(pidFile)
+		if err != nil {
+			return killed, err
+		}
+		// The pid may have been reused by an unrelated process since the pid file was written.
+		if runningLoom(pid, loomPath) {
+			if err := killGroup(pid, syscall.SIGKILL); err != nil {
+				return killed, errors.Wrapf(err, "failed to kill process group %d", pid)
+			}
+			killed++
+		}
+		if err := os.Remove(pidFile); err != nil {
+			return killed, err
+		}
+	}
+	return killed, nil
+}
+
+func readPIDFile(pidFile string) (int, string, error) {
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, "", err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		return 0, "", errors.Errorf("invalid pid file %s", pidFile)
+	}
+	pid, err := strconv.Atoi(lines[0])
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "invalid pid file %s", pidFile)
+	}
+	return pid, lines[1], nil
+}
+
+// Returns true if the given process is running the given executable.
+func runningLoom(pid int, loomPath string) bool {
+	out, err := exec.Command("ps", "-o", "args=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		// ps exits with an error if the process doesn't exist
+		return false
+	}
+	return strings.Contains(string(out), filepath.Base(loomPath))
+}
@@ -1,10 +1,22 @@
 package main
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/loomnetwork/go-loom"
+	ctypes "github.com/loomnetwork/go-loom/builtin/types/coin"
+	"github.com/loomnetwork/go-loom/types"
+
 	"github.com/loomnetwork/loomchain/e2e/common"
+	"github.com/loomnetwork/loomchain/throttle"
+)
+
+// Must match the limits in throttle-limits-loom.yaml
+const (
+	throttleMaxCallCount    = 5
+	throttleSessionDuration = 30 * time.Second
 )
 
 func TestE2eKarmaThrottle(t *testing.T) {
@@ -35,3 +47,88 @@ func TestE2eKarmaThrottle(t *testing.T) {
 		})
 	}
 }
+
+// Checks that the call limit set in the Throttle section of loom.yaml is enforced per origin: once
+// an origin has used up its txs for the session its txs are rejected with the throttle error code,
+// while another origin can still send txs, and the origin can send txs again once its session ends.
+func TestE2eThrottleCallLimit(t *testing.T) {
+	t.Parallel()
+	config, err := common.NewConfig(
+		"throttle-limits", "", "karma-2-test.json", "throttle-limits-loom.yaml", 1, 3, 0, false,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := common.StartCluster(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cluster.Stop()
+		common.FinishLogs(t, *config)
+	}()
+
+	n, err := cluster.Node(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Account 0 is the karma oracle, which isn't throttled.
+	clientA, err := common.NewTxClient(n, config.AccountPrivKeyPathList[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientB, err := common.NewTxClient(n, config.AccountPrivKeyPathList[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The session of A starts when its first tx is checked, so it ends within the session duration
+	// of the first tx being committed.
+	requireApproved(t, clientA, clientB, 1)
+	sessionEnd := time.Now().Add(throttleSessionDuration)
+	for i := 2; i <= throttleMaxCallCount; i++ {
+		requireApproved(t, clientA, clientB, int64(i))
+	}
+
+	result, err := sendApproval(clientA, clientB, throttleMaxCallCount+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.CheckTxFailed || result.Code != throttle.TxLimitReachedCode {
+		t.Fatalf(
+			"expected tx %d from A to be rejected by CheckTx with code %d, got code %d (CheckTx failed: %v): %s",
+			throttleMaxCallCount+1, throttle.TxLimitReachedCode, result.Code, result.CheckTxFailed, result.Log,
+		)
+	}
+	if !strings.Contains(result.Log, throttle.TxLimitReachedErrorPrefix) {
+		t.Fatalf("unexpected rejection message: %s", result.Log)
+	}
+
+	// B has a session of its own.
+	for i := 1; i <= 3; i++ {
+		requireApproved(t, clientB, clientA, int64(i))
+	}
+
+	time.Sleep(time.Until(sessionEnd) + 2*time.Second)
+	requireApproved(t, clientA, clientB, throttleMaxCallCount+2)
+}
+
+// Sends a tx from one account approving the other to spend the given amount of coins, the amount
+// makes each tx unique.
+func sendApproval(from, to *common.TxClient, amount int64) (*common.TxResult, error) {
+	return from.CallGoContract("coin", "Approve", &ctypes.ApproveRequest{
+		Spender: to.Caller().MarshalPB(),
+		Amount:  &types.BigUInt{Value: *loom.NewBigUIntFromInt(amount)},
+	})
+}
+
+func requireApproved(t *testing.T, from, to *common.TxClient, amount int64) {
+	t.Helper()
+	result, err := sendApproval(from, to, amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Code != 0 {
+		t.Fatalf("approval of %d by %s failed with code %d: %s", amount, from.Caller(), result.Code, result.Log)
+	}
+}
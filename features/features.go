@@ -152,4 +152,8 @@ const (
 
 	// Enables Constantinople hard fork in EVM interpreter
 	EvmConstantinopleFeature = "evm:constantinople"
+
+	// Enables processing of throttle admin txs, which the Karma oracle can send to update the on-chain
+	// throttle params & reset the throttle records of origins.
+	ThrottleAdminTxFeature = "tx:throttle-admin"
 )
@@ -0,0 +1,55 @@
+package fnConsensus
+
+import (
+	"time"
+)
+
+// clock provides the reactor with the current time, so that tests can step the wall clock.
+type clock interface {
+	// Now returns the current wall clock time.
+	Now() time.Time
+	// Monotonic returns a reading of a clock that moves forward at a steady rate, and isn't affected
+	// by the wall clock being stepped. Readings are only meaningful relative to each other.
+	Monotonic() time.Duration
+}
+
+var monotonicEpoch = time.Now()
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Monotonic() time.Duration {
+	return time.Since(monotonicEpoch)
+}
+
+// expiryAnchor tracks the expiry of a voteset with the monotonic clock. ExpiresAt is the reference
+// all the validators agree on, but it's a wall clock time, so the time left until it's reached is
+// captured when the voteset is created or adopted by this node, and the voteset expires once that
+// much time has elapsed on the monotonic clock, regardless of how the wall clock is stepped meanwhile.
+type expiryAnchor struct {
+	// ExpiresAt of the voteset the anchor was captured for.
+	expiresAt  int64
+	anchoredAt time.Duration
+	timeout    time.Duration
+}
+
+// Returns nil if the message doesn't expire.
+func newExpiryAnchor(c clock, expiresAt int64) *expiryAnchor {
+	if expiresAt == 0 {
+		return nil
+	}
+	return &expiryAnchor{
+		expiresAt:  expiresAt,
+		anchoredAt: c.Monotonic(),
+		// FnExecutionRequest.IsExpired only considers the message expired once the second it expires
+		// at is over.
+		timeout: time.Unix(expiresAt+1, 0).Sub(c.Now()),
+	}
+}
+
+func (a *expiryAnchor) isExpired(c clock) bool {
+	return c.Monotonic()-a.anchoredAt >= a.timeout
+}
@@ -3,11 +3,34 @@ package fnConsensus
 import (
 	"encoding/hex"
 	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/p2p"
 )
 
+// Max number of bytes of each message stored in a round trace, unless configured otherwise.
+const DefaultRoundTraceMaxMessageSize = 64 * 1024
+
+// Max number of bytes in a message generated by a Fn, unless configured otherwise.
+const DefaultMaxFnMessageSize = 1024 * 1024
+
+// MessageSizeLimits bound the number of bytes in the messages generated by a Fn, a zero max means
+// there's no upper bound.
+type MessageSizeLimits struct {
+	Min int
+	Max int
+}
+
+func (l *MessageSizeLimits) validate() error {
+	if l.Min < 0 || l.Max < 0 || (l.Max > 0 && l.Max < l.Min) {
+		return fmt.Errorf("invalid message size limits: %d - %d", l.Min, l.Max)
+	}
+	return nil
+}
+
 type OverrideValidatorParsable struct {
 	Address     string
 	VotingPower int64
@@ -18,10 +41,87 @@ type OverrideValidator struct {
 	VotingPower int64
 }
 
+// ValidatorPeerParsable maps the address of a validator to the ID of the node it's running on.
+type ValidatorPeerParsable struct {
+	Address string
+	NodeID  string
+	// Optional host:port the node can be dialed on.
+	NetAddress string
+}
+
 type ReactorConfigParsable struct {
 	OverrideValidators     []*OverrideValidatorParsable
 	FnVoteSigningThreshold SigningThreshold
 	IsValidator            bool
+	// Maps fnIDs to the algorithm that should be used to hash the messages generated by the
+	// corresponding Fn, Fns that implement HashAlgorithmProvider take precedence over this setting.
+	FnHashAlgorithms map[string]HashAlgorithm
+	// Maps validators to the nodes they're running on, used to figure out how much voting power
+	// is reachable via the currently connected peers.
+	ValidatorPeers []*ValidatorPeerParsable
+	// Set to true to skip proposing when the voting power reachable via the currently connected
+	// peers isn't sufficient to reach the signing threshold.
+	RequireReachableQuorum bool
+	// Number of seconds during which a Maj23 voteset that has already been broadcast won't be
+	// broadcast again, set to zero to disable suppression of identical rebroadcasts.
+	Maj23RebroadcastInterval int64
+	// Maps fnIDs to the nonce that should be used for the first voting round of the corresponding
+	// Fn, only used if no nonce has been persisted for the Fn yet. Defaults to 1. The reactor won't
+	// start if an initial nonce is lower than the nonce already persisted for the Fn.
+	FnInitialNonces map[string]int64
+	// Maps fnIDs to the namespace their nonce is persisted under, by default the nonce of each Fn is
+	// persisted under its fnID. When a Fn is renamed its new fnID can be mapped to the old fnID to
+	// carry on from the nonce persisted for the old fnID.
+	FnNonceNamespaces map[string]string
+	// Max number of bytes that can be sent or received in a single message on the reactor's P2P
+	// channels, must be the same on all nodes. Defaults to MaxMsgSize if set to zero.
+	MaxMsgSize int
+	// Bounds (in seconds) for the expiry of messages generated by Fns that implement ExpiryProvider.
+	MinMessageExpiry int64
+	MaxMessageExpiry int64
+	// Number of consecutive voting rounds a Fn can fail to converge before an alert is raised, set
+	// to zero to disable alerts.
+	FailedRoundsAlertThreshold int64
+	// Number of rounds to keep execution traces for (per Fn), set to zero to disable tracing.
+	RoundTracesPerFn int
+	// Max number of bytes of each message stored in a trace, defaults to
+	// DefaultRoundTraceMaxMessageSize if set to zero.
+	RoundTraceMaxMessageSize int
+	// Number of seconds the last block can lag behind the wall clock before the node is considered
+	// to be catching up, set to zero to disable the check. Should be disabled if empty blocks are
+	// disabled, since the last block may be arbitrarily old on an idle chain.
+	MaxBlockTimeLag int64
+	// Bounds for the number of bytes in the messages generated by Fns, messages outside these bounds
+	// are treated as execution failures. Set MaxFnMessageSize to zero to disable the upper bound.
+	MinFnMessageSize int
+	MaxFnMessageSize int
+	// Maps fnIDs to message size limits that override MinFnMessageSize & MaxFnMessageSize.
+	FnMessageSizeLimits map[string]*MessageSizeLimits
+	// Set to true to embed the signing threshold & voting powers the votesets converge under in the
+	// votesets created by this node. Validators that don't support embedded quorum parameters
+	// reject such votesets, so this must only be enabled once all the validators are upgraded.
+	EmbedQuorumParams bool
+	// Name of the reactor instance, must be set when more than one reactor runs in the same node.
+	// The state of a named instance is persisted under its own key prefix in fnConsensus.db, and
+	// the name is included in the instance's logs.
+	InstanceName string
+	// IDs of the P2P channels used by the reactor, must be unique across all the reactors running
+	// in the node, and the same on all nodes. Default to FnVoteSetChannel and FnMajChannel if set to
+	// zero.
+	VoteSetChannelID byte
+	MajChannelID     byte
+	// Set to true to rebuild the static validator set from the override validators that still exist
+	// in the TM validator set whenever the latter changes. The validator set hash changes when the
+	// static validator set is rebuilt, so all the validators must have the same setting.
+	RefreshOverrideValidators bool
+	// Number of seconds between garbage collection passes over fnConsensus.db, set to zero to
+	// disable garbage collection.
+	GCInterval int64
+	// Number of archived Maj23 votesets to keep per Fn, set to zero to keep all of them.
+	Maj23ArchiveRetention int64
+	// Number of seconds to keep evidence of conflicting Maj23 votesets for, set to zero to keep it
+	// forever.
+	ConflictEvidenceRetention int64
 }
 
 func (r *ReactorConfigParsable) Parse() (*ReactorConfig, error) {
@@ -55,18 +155,250 @@ func (r *ReactorConfigParsable) Parse() (*ReactorConfig, error) {
 		}
 	}
 
+	reactorConfig.FnHashAlgorithms = make(map[string]HashAlgorithm, len(r.FnHashAlgorithms))
+	for fnID, hashAlgorithm := range r.FnHashAlgorithms {
+		if !hashAlgorithm.IsValid() {
+			return nil, fmt.Errorf("unknown hash algorithm: %s specified for fn: %s", hashAlgorithm, fnID)
+		}
+		reactorConfig.FnHashAlgorithms[fnID] = hashAlgorithm.Normalize()
+	}
+
+	reactorConfig.ValidatorPeers = make(map[p2p.ID]crypto.Address, len(r.ValidatorPeers))
+	reactorConfig.ValidatorPeerNetAddresses = make(map[p2p.ID]string)
+	for _, validatorPeer := range r.ValidatorPeers {
+		address, err := hex.DecodeString(strings.TrimPrefix(validatorPeer.Address, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse validator peer's address")
+		}
+
+		if validatorPeer.NodeID == "" {
+			return nil, fmt.Errorf("validator peer's node ID cant be empty")
+		}
+
+		reactorConfig.ValidatorPeers[p2p.ID(validatorPeer.NodeID)] = address
+
+		if validatorPeer.NetAddress != "" {
+			if _, _, err := net.SplitHostPort(validatorPeer.NetAddress); err != nil {
+				return nil, fmt.Errorf("invalid net address specified for validator peer: %s", validatorPeer.NodeID)
+			}
+			reactorConfig.ValidatorPeerNetAddresses[p2p.ID(validatorPeer.NodeID)] = validatorPeer.NetAddress
+		}
+	}
+
+	if r.RequireReachableQuorum && len(reactorConfig.ValidatorPeers) == 0 {
+		return nil, fmt.Errorf("validator peers must be specified when reachable quorum is required")
+	}
+
+	if r.Maj23RebroadcastInterval < 0 {
+		return nil, fmt.Errorf("Maj23 rebroadcast interval cant be negative")
+	}
+
+	reactorConfig.FnInitialNonces = make(map[string]int64, len(r.FnInitialNonces))
+	for fnID, initialNonce := range r.FnInitialNonces {
+		if initialNonce < 1 {
+			return nil, fmt.Errorf("initial nonce for fn: %s must be greater than zero", fnID)
+		}
+		reactorConfig.FnInitialNonces[fnID] = initialNonce
+	}
+
+	reactorConfig.FnNonceNamespaces = make(map[string]string, len(r.FnNonceNamespaces))
+	for fnID, namespace := range r.FnNonceNamespaces {
+		if namespace == "" {
+			return nil, fmt.Errorf("nonce namespace for fn: %s cant be empty", fnID)
+		}
+		reactorConfig.FnNonceNamespaces[fnID] = namespace
+	}
+
+	if r.MaxMsgSize < 0 {
+		return nil, fmt.Errorf("max message size cant be negative")
+	}
+	reactorConfig.MaxMsgSize = r.MaxMsgSize
+	if reactorConfig.MaxMsgSize == 0 {
+		reactorConfig.MaxMsgSize = MaxMsgSize
+	}
+
+	if r.MinMessageExpiry < 0 || r.MaxMessageExpiry < r.MinMessageExpiry {
+		return nil, fmt.Errorf("invalid message expiry bounds: %d - %d", r.MinMessageExpiry, r.MaxMessageExpiry)
+	}
+	reactorConfig.MinMessageExpiry = time.Duration(r.MinMessageExpiry) * time.Second
+	reactorConfig.MaxMessageExpiry = time.Duration(r.MaxMessageExpiry) * time.Second
+
+	if r.FailedRoundsAlertThreshold < 0 {
+		return nil, fmt.Errorf("failed rounds alert threshold cant be negative")
+	}
+	reactorConfig.FailedRoundsAlertThreshold = r.FailedRoundsAlertThreshold
+
+	if r.RoundTracesPerFn < 0 || r.RoundTraceMaxMessageSize < 0 {
+		return nil, fmt.Errorf("round trace settings cant be negative")
+	}
+	if r.MaxBlockTimeLag < 0 {
+		return nil, fmt.Errorf("max block time lag cant be negative")
+	}
+	reactorConfig.MaxBlockTimeLag = time.Duration(r.MaxBlockTimeLag) * time.Second
+
+	reactorConfig.MessageSizeLimits = MessageSizeLimits{Min: r.MinFnMessageSize, Max: r.MaxFnMessageSize}
+	if err := reactorConfig.MessageSizeLimits.validate(); err != nil {
+		return nil, err
+	}
+	reactorConfig.FnMessageSizeLimits = make(map[string]*MessageSizeLimits, len(r.FnMessageSizeLimits))
+	for fnID, limits := range r.FnMessageSizeLimits {
+		if limits == nil {
+			return nil, fmt.Errorf("message size limits for fn: %s cant be nil", fnID)
+		}
+		if err := limits.validate(); err != nil {
+			return nil, fmt.Errorf("%v specified for fn: %s", err, fnID)
+		}
+		reactorConfig.FnMessageSizeLimits[fnID] = limits
+	}
+
+	reactorConfig.RoundTracesPerFn = r.RoundTracesPerFn
+	reactorConfig.RoundTraceMaxMessageSize = r.RoundTraceMaxMessageSize
+	if reactorConfig.RoundTraceMaxMessageSize == 0 {
+		reactorConfig.RoundTraceMaxMessageSize = DefaultRoundTraceMaxMessageSize
+	}
+
+	if !isValidInstanceName(r.InstanceName) {
+		return nil, fmt.Errorf("invalid instance name: %s specified", r.InstanceName)
+	}
+	reactorConfig.InstanceName = r.InstanceName
+
+	reactorConfig.VoteSetChannelID = r.VoteSetChannelID
+	if reactorConfig.VoteSetChannelID == 0 {
+		reactorConfig.VoteSetChannelID = FnVoteSetChannel
+	}
+	reactorConfig.MajChannelID = r.MajChannelID
+	if reactorConfig.MajChannelID == 0 {
+		reactorConfig.MajChannelID = FnMajChannel
+	}
+	if reactorConfig.VoteSetChannelID == reactorConfig.MajChannelID {
+		return nil, fmt.Errorf("voteset & Maj23 channels cant have the same ID: %#x", reactorConfig.MajChannelID)
+	}
+	for _, chID := range []byte{reactorConfig.VoteSetChannelID, reactorConfig.MajChannelID} {
+		if chID < minChannelID {
+			return nil, fmt.Errorf("channel ID %#x is reserved, channel IDs must be at least %#x", chID, minChannelID)
+		}
+	}
+
+	if r.GCInterval < 0 || r.Maj23ArchiveRetention < 0 || r.ConflictEvidenceRetention < 0 {
+		return nil, fmt.Errorf("garbage collection settings cant be negative")
+	}
+	reactorConfig.GCInterval = time.Duration(r.GCInterval) * time.Second
+	reactorConfig.GCRetention = GCRetention{
+		Maj23VoteSets:    r.Maj23ArchiveRetention,
+		ConflictEvidence: time.Duration(r.ConflictEvidenceRetention) * time.Second,
+	}
+
+	reactorConfig.Maj23RebroadcastInterval = time.Duration(r.Maj23RebroadcastInterval) * time.Second
+	reactorConfig.RequireReachableQuorum = r.RequireReachableQuorum
+	reactorConfig.EmbedQuorumParams = r.EmbedQuorumParams
+	reactorConfig.RefreshOverrideValidators = r.RefreshOverrideValidators
 	reactorConfig.IsValidator = r.IsValidator
 	return reactorConfig, nil
 }
 
 func DefaultReactorConfigParsable() *ReactorConfigParsable {
 	return &ReactorConfigParsable{
-		FnVoteSigningThreshold: Maj23SigningThreshold,
+		FnVoteSigningThreshold:   Maj23SigningThreshold,
+		Maj23RebroadcastInterval: proposeIntervalInSeconds,
+		MinMessageExpiry:         proposeIntervalInSeconds,
+		MaxMessageExpiry:         60 * 60,
+		// Alert if a Fn hasn't converged for a minute
+		FailedRoundsAlertThreshold: 60 / proposeIntervalInSeconds,
+		MinFnMessageSize:           0,
+		MaxFnMessageSize:           DefaultMaxFnMessageSize,
 	}
 }
 
 type ReactorConfig struct {
 	FnVoteSigningThreshold SigningThreshold
 	OverrideValidators     []*OverrideValidator
-	IsValidator            bool
+	// Set if the static validator set should be rebuilt when the TM validator set changes.
+	RefreshOverrideValidators bool
+	IsValidator               bool
+	FnHashAlgorithms          map[string]HashAlgorithm
+	ValidatorPeers            map[p2p.ID]crypto.Address
+	// host:port the nodes in ValidatorPeers can be dialed on (if known).
+	ValidatorPeerNetAddresses map[p2p.ID]string
+	RequireReachableQuorum    bool
+	Maj23RebroadcastInterval  time.Duration
+	FnInitialNonces           map[string]int64
+	FnNonceNamespaces         map[string]string
+	MaxMsgSize                int
+	MinMessageExpiry          time.Duration
+	MaxMessageExpiry          time.Duration
+	// Zero if alerts are disabled.
+	FailedRoundsAlertThreshold int64
+	// Zero if tracing is disabled.
+	RoundTracesPerFn         int
+	RoundTraceMaxMessageSize int
+	// Zero if the last block time isn't used to check if the node is catching up.
+	MaxBlockTimeLag time.Duration
+	// Zero limits if message sizes aren't checked.
+	MessageSizeLimits   MessageSizeLimits
+	FnMessageSizeLimits map[string]*MessageSizeLimits
+	EmbedQuorumParams   bool
+	// Empty for the default instance.
+	InstanceName string
+	// Zero if the default channel IDs should be used.
+	VoteSetChannelID byte
+	MajChannelID     byte
+	// Zero if garbage collection is disabled.
+	GCInterval  time.Duration
+	GCRetention GCRetention
+}
+
+func (r *ReactorConfig) maxMsgSize() int {
+	if r.MaxMsgSize <= 0 {
+		return MaxMsgSize
+	}
+	return r.MaxMsgSize
+}
+
+func (r *ReactorConfig) voteSetChannelID() byte {
+	if r.VoteSetChannelID == 0 {
+		return FnVoteSetChannel
+	}
+	return r.VoteSetChannelID
+}
+
+func (r *ReactorConfig) majChannelID() byte {
+	if r.MajChannelID == 0 {
+		return FnMajChannel
+	}
+	return r.MajChannelID
+}
+
+// Returns the bounds for the number of bytes in the messages generated by the given Fn.
+func (r *ReactorConfig) messageSizeLimits(fnID string) MessageSizeLimits {
+	if limits, ok := r.FnMessageSizeLimits[fnID]; ok {
+		return *limits
+	}
+	return r.MessageSizeLimits
+}
+
+func (r *ReactorConfig) initialNonce(fnID string) int64 {
+	if initialNonce, ok := r.FnInitialNonces[fnID]; ok {
+		return initialNonce
+	}
+	return 1
+}
+
+// Instance names are used in DB keys, so they're restricted to alphanumeric characters, dashes and
+// underscores.
+func isValidInstanceName(name string) bool {
+	for _, c := range name {
+		isAlphanumeric := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlphanumeric && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the key the nonce of the given Fn should be persisted under.
+func (r *ReactorConfig) nonceKey(fnID string) string {
+	if namespace, ok := r.FnNonceNamespaces[fnID]; ok {
+		return namespace
+	}
+	return fnID
 }
@@ -1,10 +1,29 @@
 package fnConsensus
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
+	tmcfg "github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/consensus"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	cmn "github.com/tendermint/tendermint/libs/common"
 	dbm "github.com/tendermint/tendermint/libs/db"
+	"github.com/tendermint/tendermint/mempool"
+	"github.com/tendermint/tendermint/node"
+	"github.com/tendermint/tendermint/p2p"
+	tmstate "github.com/tendermint/tendermint/state"
+	"github.com/tendermint/tendermint/types"
 )
 
 func TestUnmarshalReactorState(t *testing.T) {
@@ -20,7 +39,1864 @@ func TestUnmarshalReactorState(t *testing.T) {
 	err = saveReactorState(db, rs, false)
 	require.NoError(t, err)
 
-	rs, err = loadReactorState(db)
+	rs, err = loadReactorState(db, Maj23SigningThreshold)
 	require.NoError(t, err)
 	require.NotNil(t, rs.Messages)
 }
+
+func TestCalculateMessageHash(t *testing.T) {
+	message := []byte("hello world")
+
+	legacyHash, err := calculateMessageHash("", message)
+	require.NoError(t, err)
+	sha512Hash, err := calculateMessageHash(SHA512HashAlgorithm, message)
+	require.NoError(t, err)
+	require.Equal(t, legacyHash, sha512Hash)
+
+	sha256Hash, err := calculateMessageHash(SHA256HashAlgorithm, message)
+	require.NoError(t, err)
+	require.Len(t, sha256Hash, 32)
+
+	keccakHash, err := calculateMessageHash(Keccak256HashAlgorithm, message)
+	require.NoError(t, err)
+	require.Equal(t, "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad", hex.EncodeToString(keccakHash))
+
+	_, err = calculateMessageHash("md5", message)
+	require.Error(t, err)
+}
+
+func TestFnExecutionResponseHashAlgorithmMismatch(t *testing.T) {
+	resp := &FnExecutionResponse{
+		HashAlgorithm:     Keccak256HashAlgorithm,
+		Hashes:            make([][]byte, 2),
+		OracleSignatures:  make([][]byte, 2),
+		SignatureBitArray: cmn.NewBitArray(2),
+	}
+	err := resp.AddSignature(&FnIndividualExecutionResponse{
+		Hash:            []byte{1},
+		OracleSignature: []byte{2},
+	}, 0)
+	require.Equal(t, ErrFnVoteHashAlgorithmMismatch, err)
+
+	err = resp.AddSignature(&FnIndividualExecutionResponse{
+		Hash:            []byte{1},
+		OracleSignature: []byte{2},
+		HashAlgorithm:   Keccak256HashAlgorithm,
+	}, 0)
+	require.NoError(t, err)
+}
+
+func TestParseFnHashAlgorithms(t *testing.T) {
+	cfg := DefaultReactorConfigParsable()
+	cfg.FnHashAlgorithms = map[string]HashAlgorithm{"withdrawals": Keccak256HashAlgorithm}
+	parsed, err := cfg.Parse()
+	require.NoError(t, err)
+	require.Equal(t, Keccak256HashAlgorithm, parsed.FnHashAlgorithms["withdrawals"])
+
+	cfg.FnHashAlgorithms["prices"] = "md5"
+	_, err = cfg.Parse()
+	require.Error(t, err)
+}
+
+func TestParseValidatorPeers(t *testing.T) {
+	cfg := DefaultReactorConfigParsable()
+	cfg.RequireReachableQuorum = true
+	_, err := cfg.Parse()
+	require.Error(t, err)
+
+	cfg.ValidatorPeers = []*ValidatorPeerParsable{
+		{Address: "0x0102", NodeID: "abcd"},
+	}
+	parsed, err := cfg.Parse()
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, []byte(parsed.ValidatorPeers["abcd"]))
+	require.True(t, parsed.RequireReachableQuorum)
+}
+
+func TestInitialNoncesAndNamespaces(t *testing.T) {
+	cfg := DefaultReactorConfigParsable()
+	cfg.FnInitialNonces = map[string]int64{"oracle": 4818, "renamed": 10}
+	cfg.FnNonceNamespaces = map[string]string{"renamed": "legacy"}
+	parsed, err := cfg.Parse()
+	require.NoError(t, err)
+
+	reactor := &FnConsensusReactor{cfg: parsed, state: NewReactorState()}
+	require.Equal(t, int64(4818), reactor.currentNonce("oracle"))
+	require.Equal(t, int64(1), reactor.currentNonce("other"))
+
+	// the renamed fn inherits the nonce persisted for its old fnID
+	reactor.state.CurrentNonces["legacy"] = 42
+	require.Equal(t, int64(42), reactor.currentNonce("renamed"))
+	reactor.setCurrentNonce("renamed", 43)
+	require.Equal(t, int64(43), reactor.state.CurrentNonces["legacy"])
+	_, ok := reactor.state.CurrentNonces["renamed"]
+	require.False(t, ok)
+
+	cfg.FnInitialNonces["oracle"] = 0
+	_, err = cfg.Parse()
+	require.Error(t, err)
+}
+
+func TestInitialNonceLowerThanPersisted(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, validators.privValidators[0])
+	reactor.cfg.IsValidator = true
+	reactor.setCurrentNonce("fn", 50)
+	require.NoError(t, saveReactorState(reactor.db, reactor.state, true))
+
+	reactor.cfg.FnInitialNonces = map[string]int64{"fn": 50}
+	require.NoError(t, reactor.checkInitialNonces())
+
+	// the reactor refuses to start rather than silently ignore the setting
+	reactor.cfg.FnInitialNonces["fn"] = 10
+	err := reactor.OnStart()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "initial nonce 10 of fn fn is lower than the persisted nonce 50")
+}
+
+func TestSigningThresholdRequiredVotingPower(t *testing.T) {
+	require.Equal(t, int64(7), Maj23SigningThreshold.requiredVotingPower(9))
+	require.Equal(t, int64(9), AllSigningThreshold.requiredVotingPower(9))
+}
+
+func TestPeerStateTracksKnownVotes(t *testing.T) {
+	newVoteSet := func(nonce int64, votes ...int) *FnVoteSet {
+		voteBitArray := cmn.NewBitArray(4)
+		for _, i := range votes {
+			voteBitArray.SetIndex(i, true)
+		}
+		return &FnVoteSet{
+			Nonce:          nonce,
+			ValidatorsHash: []byte{1},
+			VoteBitArray:   voteBitArray,
+			Payload: &FnVotePayload{
+				Request: &FnExecutionRequest{FnID: "fn"},
+			},
+		}
+	}
+
+	ps := newPeerState()
+	require.False(t, ps.hasVoteSet(newVoteSet(1, 0)))
+
+	ps.markVoteSet(newVoteSet(1, 0))
+	require.True(t, ps.hasVoteSet(newVoteSet(1, 0)))
+	require.False(t, ps.hasVoteSet(newVoteSet(1, 0, 1)))
+
+	ps.markVoteSet(newVoteSet(1, 1, 2))
+	require.True(t, ps.hasVoteSet(newVoteSet(1, 0, 1, 2)))
+	require.False(t, ps.hasVoteSet(newVoteSet(2, 0)))
+
+	// votesets with an older nonce shouldn't overwrite the newer state
+	ps.markVoteSet(newVoteSet(2, 3))
+	ps.markVoteSet(newVoteSet(1, 0, 1, 2, 3))
+	require.True(t, ps.hasVoteSet(newVoteSet(2, 3)))
+	require.False(t, ps.hasVoteSet(newVoteSet(1, 0)))
+
+	// a round re-proposed at the same nonce isn't mistaken for the old one
+	reProposed := newVoteSet(2, 3)
+	reProposed.Payload.Request.ExpiresAt = 1000
+	require.False(t, ps.hasVoteSet(reProposed))
+	ps.markVoteSet(reProposed)
+	require.True(t, ps.hasVoteSet(reProposed))
+	require.False(t, ps.hasVoteSet(newVoteSet(2, 3)))
+
+	ps.forgetVoteSet("fn")
+	require.False(t, ps.hasVoteSet(reProposed))
+}
+
+func TestReProposedRoundIsGossiped(t *testing.T) {
+	validators := newTestValidators(2)
+	pv := validators.privValidators[1]
+	reactor := validators.newReactor(t, pv)
+	peer := newRecordingPeer("peer")
+	reactor.AddPeer(peer)
+	fn := messageFn{message: []byte("message")}
+
+	reactor.vote("fn", fn, validators.valSet, validators.indexOf(pv))
+	require.Len(t, peer.sent[FnVoteSetChannel], 1)
+
+	// the round is dropped because the validator set changed before it could be committed
+	reactor.staticValidators = newTestValidators(2).valSet
+	reactor.commit("fn")
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+	require.Equal(t, int64(1), reactor.currentNonce("fn"))
+
+	// the round re-proposed at the same nonce is identical to the dropped one, but the peer must
+	// still be sent it, since the peer may have dropped the old round too
+	reactor.staticValidators = validators.valSet
+	reactor.vote("fn", fn, validators.valSet, validators.indexOf(pv))
+	require.Len(t, peer.sent[FnVoteSetChannel], 2)
+	require.Equal(t, peer.sent[FnVoteSetChannel][0], peer.sent[FnVoteSetChannel][1])
+}
+
+func TestMigrateLegacyMaj23VoteSets(t *testing.T) {
+	db := dbm.NewMemDB()
+
+	voteSet := &FnVoteSet{
+		Nonce:               5,
+		ValidatorsHash:      []byte{1, 2, 3},
+		ChainID:             "default",
+		VoteBitArray:        cmn.NewBitArray(2),
+		ValidatorSignatures: [][]byte{make([]byte, 64), make([]byte, 64)},
+		ValidatorAddresses:  [][]byte{make([]byte, 20), make([]byte, 20)},
+		Payload: &FnVotePayload{
+			Request: &FnExecutionRequest{FnID: "fn"},
+			Response: &FnExecutionResponse{
+				Hashes:            [][]byte{make([]byte, 64), make([]byte, 64)},
+				OracleSignatures:  [][]byte{make([]byte, 65), make([]byte, 65)},
+				SignatureBitArray: cmn.NewBitArray(2),
+			},
+		},
+	}
+
+	legacyBytes, err := cdc.MarshalBinaryLengthPrefixed(&reactorStateMarshallable{
+		PreviousMajVoteSets: []*FnVoteSet{voteSet},
+	})
+	require.NoError(t, err)
+	db.Set([]byte(reactorStateKey), legacyBytes)
+
+	rs, err := loadReactorState(db, Maj23SigningThreshold)
+	require.NoError(t, err)
+	require.Len(t, rs.PreviousMaj23Summaries, 1)
+	require.Equal(t, int64(5), rs.PreviousMaj23Summaries["fn"].Nonce)
+	require.Equal(t, voteSet.ValidatorsHash, rs.PreviousMaj23Summaries["fn"].ValidatorsHash)
+
+	archived, err := loadMaj23VoteSet(db, "fn", 5)
+	require.NoError(t, err)
+	require.NotNil(t, archived)
+	require.Equal(t, voteSet.Nonce, archived.Nonce)
+
+	// the migrated state should no longer embed the full voteset
+	migratedBytes := db.Get([]byte(reactorStateKey))
+	require.True(t, len(migratedBytes) < len(legacyBytes))
+
+	missing, err := loadMaj23VoteSet(db, "fn", 4)
+	require.NoError(t, err)
+	require.Nil(t, missing)
+}
+
+func TestMaj23RebroadcastSuppression(t *testing.T) {
+	reactor := &FnConsensusReactor{
+		connectedPeers:      make(map[p2p.ID]p2p.Peer),
+		peerStates:          make(map[p2p.ID]*peerState),
+		lastMaj23Broadcasts: make(map[string]*maj23Broadcast),
+		cfg:                 &ReactorConfig{Maj23RebroadcastInterval: time.Minute},
+	}
+	reactor.BaseReactor = *p2p.NewBaseReactor("FnConsensusReactor", reactor)
+
+	voteSet := &FnVoteSet{
+		Nonce:   3,
+		Payload: &FnVotePayload{Request: &FnExecutionRequest{FnID: "fn"}},
+	}
+
+	reactor.broadcastMaj23VoteSet(nil, voteSet, []byte{1})
+	first := reactor.lastMaj23Broadcasts["fn"]
+	require.NotNil(t, first)
+
+	// identical content within the interval is suppressed
+	reactor.broadcastMaj23VoteSet(nil, voteSet, []byte{1})
+	require.True(t, first == reactor.lastMaj23Broadcasts["fn"])
+
+	// different content is broadcast right away
+	reactor.broadcastMaj23VoteSet(nil, voteSet, []byte{2})
+	require.False(t, first == reactor.lastMaj23Broadcasts["fn"])
+
+	// identical content is broadcast again once the interval elapses
+	second := reactor.lastMaj23Broadcasts["fn"]
+	second.SentTime = second.SentTime.Add(-2 * time.Minute)
+	reactor.broadcastMaj23VoteSet(nil, voteSet, []byte{2})
+	require.False(t, second == reactor.lastMaj23Broadcasts["fn"])
+}
+
+// failingDB simulates a DB that panics on writes, like LevelDB does when the disk is full.
+type failingDB struct {
+	dbm.DB
+	fail bool
+}
+
+func (db *failingDB) SetSync(key []byte, value []byte) {
+	if db.fail {
+		panic("disk full")
+	}
+	db.DB.SetSync(key, value)
+}
+
+func TestPersistStateDegradedMode(t *testing.T) {
+	db := &failingDB{DB: dbm.NewMemDB(), fail: true}
+	reactor := &FnConsensusReactor{
+		db:    db,
+		state: NewReactorState(),
+	}
+	reactor.BaseReactor = *p2p.NewBaseReactor("FnConsensusReactor", reactor)
+
+	require.Error(t, reactor.persistState(commitMethodID))
+	require.True(t, reactor.IsDegraded())
+
+	db.fail = false
+	require.NoError(t, reactor.persistState(commitMethodID))
+	require.False(t, reactor.IsDegraded())
+
+	rs, err := loadReactorState(db, Maj23SigningThreshold)
+	require.NoError(t, err)
+	require.NotNil(t, rs)
+}
+
+func TestCompareFnVoteSets(t *testing.T) {
+	validators := make([]*types.Validator, 4)
+	for i := range validators {
+		validators[i] = types.NewValidator(ed25519.GenPrivKey().PubKey(), 10)
+	}
+	valSet := types.NewValidatorSet(validators)
+
+	hashA := []byte{0xa}
+	hashB := []byte{0xb}
+
+	// Creates a voteset in which each validator votes for the corresponding hash, nil means no vote.
+	newVoteSet := func(nonce int64, hashes ...[]byte) *FnVoteSet {
+		voteSet := &FnVoteSet{
+			Nonce:               nonce,
+			VoteBitArray:        cmn.NewBitArray(len(validators)),
+			ValidatorSignatures: make([][]byte, len(validators)),
+			ValidatorAddresses:  make([][]byte, len(validators)),
+			Payload: &FnVotePayload{
+				Request: &FnExecutionRequest{FnID: "fn"},
+				Response: &FnExecutionResponse{
+					Hashes:            make([][]byte, len(validators)),
+					OracleSignatures:  make([][]byte, len(validators)),
+					SignatureBitArray: cmn.NewBitArray(len(validators)),
+				},
+			},
+		}
+		for i, hash := range hashes {
+			if hash == nil {
+				continue
+			}
+			voteSet.VoteBitArray.SetIndex(i, true)
+			voteSet.Payload.Response.SignatureBitArray.SetIndex(i, true)
+			voteSet.Payload.Response.Hashes[i] = hash
+			voteSet.Payload.Response.OracleSignatures[i] = []byte{byte(i)}
+			voteSet.TotalVotingPower += 10
+		}
+		return voteSet
+	}
+
+	reactor := &FnConsensusReactor{
+		cfg: &ReactorConfig{FnVoteSigningThreshold: Maj23SigningThreshold},
+	}
+
+	tests := []struct {
+		name         string
+		remote       *FnVoteSet
+		current      *FnVoteSet
+		currentNonce int64
+		expected     int
+	}{
+		{"no current, same nonce", newVoteSet(1, hashA), nil, 1, 1},
+		{"no current, remote ahead & converged", newVoteSet(2, hashA, hashA, hashA), nil, 1, 1},
+		{"no current, remote ahead & not converged", newVoteSet(2, hashA), nil, 1, -1},
+		{"same nonce", newVoteSet(1, hashA), newVoteSet(1, nil, hashA), 1, 0},
+		{"only remote converged", newVoteSet(2, hashA, hashA, hashA), newVoteSet(1, hashA), 1, 1},
+		{"only current converged", newVoteSet(2, hashA), newVoteSet(1, hashA, hashA, hashA), 1, -1},
+		{"neither converged", newVoteSet(2, hashA, hashA), newVoteSet(1, hashA), 1, -1},
+		{
+			"remote has more votes",
+			newVoteSet(2, hashA, hashA, hashA, hashA), newVoteSet(1, hashA, hashA, hashA), 1, 1,
+		},
+		{
+			"current has more votes",
+			newVoteSet(2, hashA, hashA, hashA), newVoteSet(1, hashA, hashA, hashA, hashA), 1, -1,
+		},
+		{
+			"only remote reached agreement",
+			newVoteSet(2, hashA, hashA, hashA), newVoteSet(1, hashA, hashA, hashB), 1, 1,
+		},
+		{
+			"only current reached agreement",
+			newVoteSet(2, hashA, hashA, hashB), newVoteSet(1, hashA, hashA, hashA), 1, -1,
+		},
+		{
+			"neither reached agreement, remote nonce higher",
+			newVoteSet(2, hashA, hashA, hashB), newVoteSet(1, hashA, hashB, hashB), 1, 1,
+		},
+		{
+			"remote has more agree votes",
+			newVoteSet(2, hashA, hashA, hashA, hashA), newVoteSet(1, hashA, hashA, hashA, hashB), 1, 1,
+		},
+		{
+			"current has more agree votes",
+			newVoteSet(2, hashA, hashA, hashA, hashB), newVoteSet(1, hashA, hashA, hashA, hashA), 1, -1,
+		},
+		{
+			"tie, remote nonce higher",
+			newVoteSet(2, hashA, hashA, hashA), newVoteSet(1, hashA, hashA, hashA), 1, 1,
+		},
+		{
+			"tie, remote nonce lower",
+			newVoteSet(1, hashA, hashA, hashA), newVoteSet(2, hashA, hashA, hashA), 2, -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(
+				t, test.expected,
+				reactor.compareFnVoteSets(test.remote, test.current, test.currentNonce, valSet),
+			)
+		})
+	}
+
+	// The tie-break must be symmetric, so that two nodes holding each other's votesets pick the same one.
+	voteSetA := newVoteSet(1, hashA, hashA, hashA)
+	voteSetB := newVoteSet(1, hashA, hashA, nil, hashA)
+	require.Equal(t, -breakVoteSetTie(voteSetA, voteSetB), breakVoteSetTie(voteSetB, voteSetA))
+	require.NotEqual(t, 0, breakVoteSetTie(voteSetA, voteSetB))
+	require.Equal(t, 0, breakVoteSetTie(voteSetA, newVoteSet(1, hashA, hashA, hashA)))
+	require.Equal(t, 1, breakVoteSetTie(newVoteSet(2, hashA), voteSetA))
+	require.Equal(t, -1, breakVoteSetTie(voteSetA, newVoteSet(2, hashA)))
+
+	require.Equal(t, 1, compareBools(true, false))
+	require.Equal(t, -1, compareBools(false, true))
+	require.Equal(t, 0, compareBools(true, true))
+	require.Equal(t, 0, compareBools(false, false))
+}
+
+func TestConflictEvidenceStore(t *testing.T) {
+	db := dbm.NewMemDB()
+	require.False(t, hasConflictEvidence(db, "fn", 7))
+
+	err := saveConflictEvidence(db, &ConflictEvidence{
+		FnID:       "fn",
+		Nonce:      7,
+		LocalHash:  []byte{1},
+		RemoteHash: []byte{2},
+		DetectedAt: 100,
+	})
+	require.NoError(t, err)
+	require.True(t, hasConflictEvidence(db, "fn", 7))
+
+	evidence, err := loadAllConflictEvidence(db)
+	require.NoError(t, err)
+	require.Len(t, evidence, 1)
+	require.Equal(t, "fn", evidence[0].FnID)
+	require.Equal(t, int64(7), evidence[0].Nonce)
+	require.Equal(t, []byte{2}, evidence[0].RemoteHash)
+}
+
+func TestResultObserver(t *testing.T) {
+	observer := newResultObserver()
+
+	sub := observer.subscribe("fn", 2, nil)
+	require.True(t, observer.hasSubscribers("fn"))
+	require.False(t, observer.hasSubscribers("other"))
+
+	for nonce := int64(1); nonce <= 3; nonce++ {
+		observer.publish(&ConvergedResult{FnID: "fn", Nonce: nonce})
+	}
+	// stale results are ignored
+	observer.publish(&ConvergedResult{FnID: "fn", Nonce: 2})
+
+	// the slow subscriber only gets the latest results
+	require.Equal(t, uint64(1), sub.Dropped())
+	require.Equal(t, int64(2), (<-sub.Results()).Nonce)
+	require.Equal(t, int64(3), (<-sub.Results()).Nonce)
+
+	// new subscribers get the last result straight away
+	lateSub := observer.subscribe("fn", 0, &ConvergedResult{FnID: "fn", Nonce: 1})
+	require.Equal(t, int64(3), (<-lateSub.Results()).Nonce)
+
+	sub.Cancel()
+	sub.Cancel()
+	_, ok := <-sub.Results()
+	require.False(t, ok)
+	require.True(t, observer.hasSubscribers("fn"))
+
+	lateSub.Cancel()
+	require.False(t, observer.hasSubscribers("fn"))
+}
+
+func TestNonValidatorObservesResults(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, nil)
+	reactor.staticValidators = nil
+	reactor.db = nil
+	reactor.tmStateDB = dbm.NewMemDB()
+	require.False(t, reactor.cfg.IsValidator)
+
+	sub := reactor.SubscribeResults("fn", 0)
+	defer sub.Cancel()
+	msgBytes, err := validators.newVoteSetWithVotes(t, 1, 2).Marshal()
+	require.NoError(t, err)
+
+	// results can't be verified until the TM state is populated
+	reactor.Receive(FnMajChannel, newRecordingPeer("sender"), msgBytes)
+	require.Empty(t, sub.Results())
+
+	tmstate.SaveState(reactor.tmStateDB, tmstate.State{
+		Validators:      validators.valSet,
+		NextValidators:  validators.valSet,
+		LastValidators:  validators.valSet,
+		ConsensusParams: *types.DefaultConsensusParams(),
+	})
+	reactor.Receive(FnMajChannel, newRecordingPeer("sender"), msgBytes)
+	require.Len(t, sub.Results(), 1)
+	result := <-sub.Results()
+	require.Equal(t, "fn", result.FnID)
+	require.Equal(t, int64(1), result.Nonce)
+}
+
+type noopFn struct{}
+
+func (noopFn) GetMessageAndSignature(ctx []byte) ([]byte, []byte, error) { return nil, nil, nil }
+
+func (noopFn) SubmitMultiSignedMessage(ctx []byte, key []byte, signatures [][]byte) {}
+
+func TestFnRegistryMetadata(t *testing.T) {
+	registry := NewInMemoryFnRegistry()
+	require.NoError(t, registry.SetWithMetadata("withdrawals", noopFn{}, FnMetadata{
+		Description: "Signs withdrawals", Version: "v2", Destination: "ethereum",
+	}))
+	require.NoError(t, registry.Set("deposits", noopFn{}))
+	require.Nil(t, registry.GetMetadata("unknown"))
+
+	details := registry.ListDetailed()
+	require.Len(t, details, 2)
+	require.Equal(t, "deposits", details[0].FnID)
+	require.Equal(t, "", details[0].Version)
+	require.Equal(t, "withdrawals", details[1].FnID)
+	require.Equal(t, "v2", details[1].Version)
+
+	request, err := NewFnExecutionRequest("withdrawals", registry)
+	require.NoError(t, err)
+	require.Equal(t, "v2", request.FnVersion)
+
+	voteSet := &FnVoteSet{
+		Payload: &FnVotePayload{Request: &FnExecutionRequest{FnID: "withdrawals", FnVersion: "v3"}},
+	}
+	err = voteSet.validateFnVersion(registry.GetMetadata("withdrawals"))
+	require.Equal(t, ErrFnVersionMismatch, errors.Cause(err))
+	require.Contains(t, err.Error(), "peer running withdrawals v3, we run v2")
+	require.False(t, request.CannonicalCompare(voteSet.Payload.Request))
+}
+
+type testValidators struct {
+	privValidators []types.PrivValidator
+	valSet         *types.ValidatorSet
+}
+
+func newTestValidators(count int) *testValidators {
+	privValidators := make([]types.PrivValidator, count)
+	validators := make([]*types.Validator, count)
+	for i := range privValidators {
+		privValidators[i] = types.NewMockPV()
+		validators[i] = types.NewValidator(privValidators[i].GetPubKey(), 10)
+	}
+	return &testValidators{privValidators: privValidators, valSet: types.NewValidatorSet(validators)}
+}
+
+func (v *testValidators) indexOf(pv types.PrivValidator) int {
+	index, _ := v.valSet.GetByAddress(pv.GetAddress())
+	return index
+}
+
+func (v *testValidators) newResponse(index int) *FnIndividualExecutionResponse {
+	return &FnIndividualExecutionResponse{Hash: []byte{1, 2, 3}, OracleSignature: []byte{byte(index + 1)}}
+}
+
+// Creates a voteset for the "fn" Fn with a vote from the first validator.
+func (v *testValidators) newVoteSet(t *testing.T) *FnVoteSet {
+	return v.newVoteSetWithVotes(t, 1, 1)
+}
+
+// Creates a voteset for the "fn" Fn with votes from the given number of validators.
+func (v *testValidators) newVoteSetWithVotes(t testing.TB, nonce int64, numVotes int) *FnVoteSet {
+	firstIndex := v.indexOf(v.privValidators[0])
+	payload := NewFnVotePayload(
+		&FnExecutionRequest{FnID: "fn"},
+		NewFnExecutionResponse(v.newResponse(firstIndex), firstIndex, v.valSet),
+	)
+	voteSet, err := NewVoteSet(nonce, "chain", firstIndex, payload, v.privValidators[0], v.valSet)
+	require.NoError(t, err)
+
+	for _, pv := range v.privValidators[1:numVotes] {
+		index := v.indexOf(pv)
+		require.NoError(t, voteSet.AddVote(nonce, v.newResponse(index), v.valSet, index, pv))
+	}
+	return voteSet
+}
+
+// Creates a validator reactor for the "fn" Fn that hasn't been started.
+func (v *testValidators) newReactor(t *testing.T, privValidator types.PrivValidator) *FnConsensusReactor {
+	registry := NewInMemoryFnRegistry()
+	require.NoError(t, registry.Set("fn", noopFn{}))
+
+	reactor := &FnConsensusReactor{
+		connectedPeers:      make(map[p2p.ID]p2p.Peer),
+		peerStates:          make(map[p2p.ID]*peerState),
+		lastMaj23Broadcasts: make(map[string]*maj23Broadcast),
+		resultObserver:      newResultObserver(),
+		oversizedVoteSetFns: make(map[string]bool),
+		clock:               systemClock{},
+		expiryAnchors:       make(map[string]*expiryAnchor),
+		state:               NewReactorState(),
+		db:                  dbm.NewMemDB(),
+		chainID:             "chain",
+		fnRegistry:          registry,
+		privValidator:       privValidator,
+		staticValidators:    v.valSet,
+		cfg:                 &ReactorConfig{FnVoteSigningThreshold: Maj23SigningThreshold},
+	}
+	reactor.BaseReactor = *p2p.NewBaseReactor("FnConsensusReactor", reactor)
+	return reactor
+}
+
+// recordingPeer records the messages sent to it.
+type recordingPeer struct {
+	p2p.Peer
+	id   p2p.ID
+	sent map[byte][][]byte
+}
+
+func newRecordingPeer(id p2p.ID) *recordingPeer {
+	return &recordingPeer{id: id, sent: make(map[byte][][]byte)}
+}
+
+func (p *recordingPeer) ID() p2p.ID { return p.id }
+
+func (p *recordingPeer) Send(chID byte, msgBytes []byte) bool {
+	p.sent[chID] = append(p.sent[chID], msgBytes)
+	return true
+}
+
+func (p *recordingPeer) TrySend(chID byte, msgBytes []byte) bool {
+	return p.Send(chID, msgBytes)
+}
+
+func TestFnVoteSetMarshalCache(t *testing.T) {
+	validators := newTestValidators(2)
+	privValidators, valSet := validators.privValidators, validators.valSet
+	voteSet := validators.newVoteSet(t)
+
+	before, err := voteSet.Marshal()
+	require.NoError(t, err)
+	cached, err := voteSet.Marshal()
+	require.NoError(t, err)
+	require.True(t, &before[0] == &cached[0])
+
+	secondIndex := validators.indexOf(privValidators[1])
+	require.NoError(t, voteSet.AddVote(1, validators.newResponse(secondIndex), valSet, secondIndex, privValidators[1]))
+
+	after, err := voteSet.Marshal()
+	require.NoError(t, err)
+	fresh, err := cdc.MarshalBinaryLengthPrefixed(voteSet)
+	require.NoError(t, err)
+	require.Equal(t, fresh, after)
+	require.NotEqual(t, before, after)
+
+	decoded := &FnVoteSet{}
+	require.NoError(t, decoded.Unmarshal(after))
+	reencoded, err := decoded.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, after, reencoded)
+}
+
+func TestFnVoteSetIsValidReasons(t *testing.T) {
+	validators := newTestValidators(2)
+	signerIndex := validators.indexOf(validators.privValidators[0])
+
+	registry := NewInMemoryFnRegistry()
+	require.NoError(t, registry.Set("fn", noopFn{}))
+	require.NoError(t, validators.newVoteSet(t).IsValid("chain", validators.valSet, registry))
+
+	versionedRegistry := NewInMemoryFnRegistry()
+	require.NoError(t, versionedRegistry.SetWithMetadata("fn", noopFn{}, FnMetadata{Version: "v2"}))
+
+	tests := []struct {
+		name           string
+		mutate         func(voteSet *FnVoteSet)
+		chainID        string
+		registry       FnRegistry
+		reason         InvalidVoteSetReason
+		validatorIndex int
+	}{
+		{
+			name:           "malformed",
+			mutate:         func(voteSet *FnVoteSet) { voteSet.VoteBitArray = nil },
+			reason:         InvalidVoteSetMalformed,
+			validatorIndex: -1,
+		},
+		{
+			name:           "invalid payload",
+			mutate:         func(voteSet *FnVoteSet) { voteSet.Payload.Response = nil },
+			reason:         InvalidVoteSetPayload,
+			validatorIndex: -1,
+		},
+		{
+			name:           "unknown fn",
+			registry:       NewInMemoryFnRegistry(),
+			reason:         InvalidVoteSetUnknownFn,
+			validatorIndex: -1,
+		},
+		{
+			name:           "fn version mismatch",
+			registry:       versionedRegistry,
+			reason:         InvalidVoteSetFnVersionMismatch,
+			validatorIndex: -1,
+		},
+		{
+			name:           "chain ID mismatch",
+			chainID:        "other-chain",
+			reason:         InvalidVoteSetChainIDMismatch,
+			validatorIndex: -1,
+		},
+		{
+			name:           "validator set mismatch",
+			mutate:         func(voteSet *FnVoteSet) { voteSet.ValidatorsHash = []byte{1} },
+			reason:         InvalidVoteSetValidatorSetMismatch,
+			validatorIndex: -1,
+		},
+		{
+			name:           "invalid signature",
+			mutate:         func(voteSet *FnVoteSet) { voteSet.ValidatorSignatures[signerIndex] = []byte{1} },
+			reason:         InvalidVoteSetSignature,
+			validatorIndex: signerIndex,
+		},
+		{
+			name:           "voting power mismatch",
+			mutate:         func(voteSet *FnVoteSet) { voteSet.TotalVotingPower++ },
+			reason:         InvalidVoteSetVotingPowerMismatch,
+			validatorIndex: -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			voteSet := validators.newVoteSet(t)
+			if test.mutate != nil {
+				test.mutate(voteSet)
+			}
+			chainID := test.chainID
+			if chainID == "" {
+				chainID = "chain"
+			}
+			testRegistry := test.registry
+			if testRegistry == nil {
+				testRegistry = registry
+			}
+
+			err := voteSet.IsValid(chainID, validators.valSet, testRegistry)
+			require.Error(t, err)
+			invalidErr, ok := err.(*InvalidVoteSetError)
+			require.True(t, ok)
+			require.Equal(t, test.reason, invalidErr.Reason)
+			require.Equal(t, test.validatorIndex, invalidErr.ValidatorIndex)
+			require.Equal(t, test.reason, invalidVoteSetReason(err))
+		})
+	}
+}
+
+func TestOversizedVoteSets(t *testing.T) {
+	validators := newTestValidators(2)
+	voteSet := validators.newVoteSet(t)
+	msgBytes, err := voteSet.Marshal()
+	require.NoError(t, err)
+
+	reactor := &FnConsensusReactor{
+		connectedPeers:      make(map[p2p.ID]p2p.Peer),
+		peerStates:          make(map[p2p.ID]*peerState),
+		oversizedVoteSetFns: make(map[string]bool),
+		cfg:                 &ReactorConfig{MaxMsgSize: len(msgBytes) + 1},
+	}
+	reactor.BaseReactor = *p2p.NewBaseReactor("FnConsensusReactor", reactor)
+
+	require.False(t, reactor.isOversizedMsg(FnVoteSetChannel, msgBytes))
+	require.True(t, reactor.isOversizedMsg(FnVoteSetChannel, append(msgBytes, 1, 2)))
+
+	// only one of the two validators has voted, so the fully signed voteset will be twice as large
+	reactor.checkProjectedVoteSetSize(voteSet, msgBytes)
+	require.True(t, reactor.oversizedVoteSetFns["fn"])
+
+	reactor.cfg.MaxMsgSize = len(msgBytes) * 2
+	reactor.oversizedVoteSetFns = make(map[string]bool)
+	reactor.checkProjectedVoteSetSize(voteSet, msgBytes)
+	require.False(t, reactor.oversizedVoteSetFns["fn"])
+}
+
+func TestFastForwardAfterPartition(t *testing.T) {
+	validators := newTestValidators(4)
+	fn := messageFn{message: []byte("message")}
+
+	// The partitioned node voted in the first round, but never heard from the other validators.
+	partitionedPV := validators.privValidators[3]
+	partitioned := validators.newReactor(t, partitionedPV)
+	partitioned.vote("fn", fn, validators.valSet, validators.indexOf(partitionedPV))
+	staleVoteSet := partitioned.state.CurrentVoteSets["fn"]
+	require.NotNil(t, staleVoteSet)
+
+	// Meanwhile the other validators converged on the first four rounds.
+	upToDate := validators.newReactor(t, validators.privValidators[0])
+	for nonce := int64(1); nonce <= 4; nonce++ {
+		upToDate.state.Messages["fn"] = Message{Hash: validators.newResponse(0).Hash}
+		upToDate.state.CurrentVoteSets["fn"] = validators.newVoteSetWithVotes(t, nonce, 3)
+		upToDate.commit("fn")
+	}
+	require.Equal(t, int64(5), upToDate.currentNonce("fn"))
+	require.Equal(t, int64(1), partitioned.currentNonce("fn"))
+
+	// Once the partition heals the outdated voteset of the partitioned node makes the up to date node
+	// send its latest Maj23 voteset, which the partitioned node adopts.
+	staleVoteSetBytes, err := staleVoteSet.Marshal()
+	require.NoError(t, err)
+	partitionedPeer := newRecordingPeer("partitioned")
+	upToDate.handleVoteSetChannelMessage(partitionedPeer, staleVoteSetBytes)
+	require.Len(t, partitionedPeer.sent[FnMajChannel], 1)
+
+	partitioned.handleMaj23VoteSetChannel(newRecordingPeer("upToDate"), partitionedPeer.sent[FnMajChannel][0])
+	require.Equal(t, int64(4), partitioned.state.PreviousMaj23Summaries["fn"].Nonce)
+	require.Equal(t, int64(5), partitioned.currentNonce("fn"))
+	require.Nil(t, partitioned.state.CurrentVoteSets["fn"])
+
+	// The partitioned node falls behind again, and the first thing it hears from the other validators
+	// is a voteset that converged in a later round, which it adopts instead of signing it.
+	otherPeer := newRecordingPeer("other")
+	partitioned.AddPeer(otherPeer)
+	convergedVoteSetBytes, err := validators.newVoteSetWithVotes(t, 6, 3).Marshal()
+	require.NoError(t, err)
+	partitioned.handleVoteSetChannelMessage(newRecordingPeer("upToDate"), convergedVoteSetBytes)
+	require.Equal(t, int64(6), partitioned.state.PreviousMaj23Summaries["fn"].Nonce)
+	require.Equal(t, int64(7), partitioned.currentNonce("fn"))
+	require.Nil(t, partitioned.state.CurrentVoteSets["fn"])
+	require.Empty(t, otherPeer.sent[FnVoteSetChannel])
+	require.Equal(t, [][]byte{convergedVoteSetBytes}, otherPeer.sent[FnMajChannel])
+
+	archived, err := loadMaj23VoteSet(partitioned.db, "fn", 6)
+	require.NoError(t, err)
+	require.NotNil(t, archived)
+
+	// the catch-up survives a restart
+	rs, err := loadReactorState(partitioned.db, Maj23SigningThreshold)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), rs.CurrentNonces["fn"])
+}
+
+func TestDisabledFns(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, validators.privValidators[1])
+	reactor.setCurrentNonce("fn", 3)
+	reactor.state.CurrentVoteSets["fn"] = validators.newVoteSetWithVotes(t, 3, 1)
+
+	require.NoError(t, reactor.SetFnEnabled("fn", false))
+	require.False(t, reactor.IsFnEnabled("fn"))
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+
+	// votesets for disabled fns are relayed without being signed
+	voteSetBytes, err := validators.newVoteSetWithVotes(t, 3, 1).Marshal()
+	require.NoError(t, err)
+	reactor.connectedPeers["other"] = newRecordingPeer("other")
+	reactor.handleVoteSetChannelMessage(newRecordingPeer("sender"), voteSetBytes)
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+	otherPeer := reactor.connectedPeers["other"].(*recordingPeer)
+	require.Equal(t, [][]byte{voteSetBytes}, otherPeer.sent[FnVoteSetChannel])
+
+	// the status API shows the setting, and no new rounds are started for the fn
+	statuses, err := reactor.FnStatuses()
+	require.NoError(t, err)
+	require.Equal(t, []*FnStatus{{FnID: "fn", Enabled: false, Registered: true, Nonce: 3}}, statuses)
+	require.Empty(t, reactor.fnsEligibleForVoting())
+
+	// the setting survives a restart, and so does the nonce
+	rs, err := loadReactorState(reactor.db, Maj23SigningThreshold)
+	require.NoError(t, err)
+	require.False(t, rs.IsFnEnabled("fn"))
+	require.Equal(t, int64(3), rs.CurrentNonces["fn"])
+
+	require.NoError(t, SetFnEnabledInDB(reactor.db, Maj23SigningThreshold, "fn", true))
+	rs, err = loadReactorState(reactor.db, Maj23SigningThreshold)
+	require.NoError(t, err)
+	require.True(t, rs.IsFnEnabled("fn"))
+	require.Equal(t, int64(3), rs.CurrentNonces["fn"])
+
+	// once re-enabled via the admin API the fn resumes voting at the nonce it was disabled at
+	status, err := reactor.UnsafeSetFnEnabled("fn", true)
+	require.NoError(t, err)
+	require.Equal(t, &FnStatus{FnID: "fn", Enabled: true, Registered: true, Nonce: 3}, status)
+	require.Equal(t, []string{"fn"}, reactor.fnsEligibleForVoting())
+
+	pv := validators.privValidators[1]
+	reactor.vote("fn", messageFn{message: []byte("message")}, validators.valSet, validators.indexOf(pv))
+	voteSet := reactor.state.CurrentVoteSets["fn"]
+	require.NotNil(t, voteSet)
+	require.Equal(t, int64(3), voteSet.Nonce)
+	require.True(t, voteSet.HaveWeAlreadySigned(validators.indexOf(pv)))
+	require.Len(t, otherPeer.sent[FnVoteSetChannel], 2)
+}
+
+type expiringFn struct {
+	noopFn
+	expiry time.Duration
+}
+
+func (f expiringFn) MessageExpiry() time.Duration { return f.expiry }
+
+func TestMessageExpiry(t *testing.T) {
+	parsed, err := DefaultReactorConfigParsable().Parse()
+	require.NoError(t, err)
+	reactor := &FnConsensusReactor{cfg: parsed}
+
+	now := time.Unix(1000003, 0)
+	intervalStart := int64(1000000)
+	require.Equal(t, int64(0), reactor.messageExpiresAt(noopFn{}, now))
+	require.Equal(t, int64(0), reactor.messageExpiresAt(expiringFn{}, now))
+	require.Equal(t, intervalStart+20, reactor.messageExpiresAt(expiringFn{expiry: 20 * time.Second}, now))
+	// expiry is clamped to the configured bounds
+	require.Equal(t, intervalStart+10, reactor.messageExpiresAt(expiringFn{expiry: time.Second}, now))
+	require.Equal(t, intervalStart+3600, reactor.messageExpiresAt(expiringFn{expiry: 24 * time.Hour}, now))
+
+	request := &FnExecutionRequest{FnID: "fn", ExpiresAt: intervalStart + 20}
+	require.False(t, request.IsExpired(time.Unix(intervalStart+20, 0)))
+	require.True(t, request.IsExpired(time.Unix(intervalStart+21, 0)))
+	require.False(t, (&FnExecutionRequest{FnID: "fn"}).IsExpired(time.Unix(intervalStart+21, 0)))
+	require.False(t, request.CannonicalCompare(&FnExecutionRequest{FnID: "fn"}))
+
+	cfg := DefaultReactorConfigParsable()
+	cfg.MaxMessageExpiry = cfg.MinMessageExpiry - 1
+	_, err = cfg.Parse()
+	require.Error(t, err)
+}
+
+func TestHandlersRejectMalformedVoteSets(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, validators.privValidators[1])
+	sender := newRecordingPeer("sender")
+
+	brokenBitArray := validators.newVoteSetWithVotes(t, 1, 2)
+	brokenBitArray.VoteBitArray = &cmn.BitArray{Bits: 2}
+	brokenSignatureBitArray := validators.newVoteSetWithVotes(t, 1, 2)
+	brokenSignatureBitArray.Payload.Response.SignatureBitArray = &cmn.BitArray{Bits: 2}
+
+	malformedVoteSets := []*FnVoteSet{
+		{},
+		{Payload: &FnVotePayload{}},
+		brokenBitArray,
+		brokenSignatureBitArray,
+	}
+	for _, voteSet := range malformedVoteSets {
+		msgBytes, err := cdc.MarshalBinaryLengthPrefixed(voteSet)
+		require.NoError(t, err)
+		require.Error(t, voteSet.IsValid("chain", validators.valSet, reactor.fnRegistry))
+		require.NotPanics(t, func() { reactor.handleVoteSetChannelMessage(sender, msgBytes) })
+		require.NotPanics(t, func() { reactor.handleMaj23VoteSetChannel(sender, msgBytes) })
+	}
+	require.Empty(t, reactor.state.CurrentVoteSets)
+	require.Empty(t, reactor.state.PreviousMaj23Summaries)
+}
+
+func TestConsecutiveFailedRounds(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, validators.privValidators[1])
+	reactor.cfg.FailedRoundsAlertThreshold = 2
+	reactor.state.Messages["fn"] = Message{Hash: validators.newResponse(0).Hash}
+
+	// a single vote isn't enough to converge
+	for i := 0; i < 3; i++ {
+		reactor.state.CurrentVoteSets["fn"] = validators.newVoteSetWithVotes(t, 1, 1)
+		reactor.commit("fn")
+	}
+	require.Equal(t, int64(3), reactor.ConsecutiveFailedRounds("fn"))
+	require.Equal(t, int64(1), reactor.currentNonce("fn"))
+
+	// the counter survives a restart
+	rs, err := loadReactorState(reactor.db, Maj23SigningThreshold)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), rs.ConsecutiveFailedRounds["fn"])
+
+	reactor.state.CurrentVoteSets["fn"] = validators.newVoteSetWithVotes(t, 1, 2)
+	reactor.commit("fn")
+	require.Equal(t, int64(0), reactor.ConsecutiveFailedRounds("fn"))
+	require.Equal(t, int64(2), reactor.currentNonce("fn"))
+
+	rs, err = loadReactorState(reactor.db, Maj23SigningThreshold)
+	require.NoError(t, err)
+	require.Empty(t, rs.ConsecutiveFailedRounds)
+
+	cfg := DefaultReactorConfigParsable()
+	cfg.FailedRoundsAlertThreshold = -1
+	_, err = cfg.Parse()
+	require.Error(t, err)
+}
+
+func TestSleepTimeAlignsToSlots(t *testing.T) {
+	slotStart := time.Unix(1000000, 0)
+
+	// sub-second offsets aren't rounded away
+	now := slotStart.Add(2*time.Second + 900*time.Millisecond)
+	require.Equal(t, 2100*time.Millisecond, timeUntilNextSlot(now, commitIntervalInSeconds))
+	require.Equal(t, 7100*time.Millisecond, timeUntilNextSlot(now, proposeIntervalInSeconds))
+	require.Equal(t, 5*time.Second, timeUntilNextSlot(slotStart, commitIntervalInSeconds))
+
+	require.Equal(t, 2200*time.Millisecond, calculateSleepTimeForCommit(now, false))
+	require.Equal(t, 7600*time.Millisecond, calculateSleepTimeForPropose(now, false))
+
+	// validators wake up at a random offset into the slot, but never before it starts
+	for i := 0; i < 10; i++ {
+		sleepTime := calculateSleepTimeForCommit(now, true)
+		require.True(t, sleepTime >= 2200*time.Millisecond && sleepTime < 4200*time.Millisecond)
+	}
+}
+
+// fakeClock is a clock whose wall clock can be stepped independently of the monotonic clock.
+type fakeClock struct {
+	wall      time.Time
+	monotonic time.Duration
+}
+
+func (c *fakeClock) Now() time.Time           { return c.wall }
+func (c *fakeClock) Monotonic() time.Duration { return c.monotonic }
+
+// Advances both the wall & monotonic clocks.
+func (c *fakeClock) advance(d time.Duration) {
+	c.wall = c.wall.Add(d)
+	c.monotonic += d
+}
+
+type expiringMessageFn struct {
+	messageFn
+	expiry time.Duration
+}
+
+func (f expiringMessageFn) MessageExpiry() time.Duration { return f.expiry }
+
+func TestExpiryUnaffectedByWallClockSteps(t *testing.T) {
+	validators := newTestValidators(2)
+	pv := validators.privValidators[1]
+	fn := expiringMessageFn{messageFn: messageFn{message: []byte("message")}, expiry: 20 * time.Second}
+
+	newRound := func() (*FnConsensusReactor, *fakeClock) {
+		reactor := validators.newReactor(t, pv)
+		reactor.cfg.MinMessageExpiry = 10 * time.Second
+		reactor.cfg.MaxMessageExpiry = time.Hour
+		clock := &fakeClock{wall: time.Unix(1000000, 0), monotonic: time.Minute}
+		reactor.clock = clock
+		reactor.vote("fn", fn, validators.valSet, validators.indexOf(pv))
+		require.Equal(t, int64(1000020), reactor.state.CurrentVoteSets["fn"].Payload.Request.ExpiresAt)
+		return reactor, clock
+	}
+
+	// the wall clock is stepped back mid-round, but the round still expires on time
+	reactor, clock := newRound()
+	clock.wall = clock.wall.Add(-time.Hour)
+	clock.advance(20 * time.Second)
+	reactor.commit("fn")
+	require.NotNil(t, reactor.state.CurrentVoteSets["fn"])
+	clock.advance(time.Second)
+	reactor.commit("fn")
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+
+	// the wall clock is stepped forward mid-round, but the round doesn't expire early
+	reactor, clock = newRound()
+	clock.wall = clock.wall.Add(time.Hour)
+	clock.advance(time.Second)
+	require.True(t, reactor.state.CurrentVoteSets["fn"].IsExpired(clock.Now()))
+	reactor.commit("fn")
+	require.NotNil(t, reactor.state.CurrentVoteSets["fn"])
+
+	// votesets that weren't created nor adopted since the node started fall back to the wall clock
+	delete(reactor.expiryAnchors, "fn")
+	reactor.commit("fn")
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+}
+
+func TestReactorHealth(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, validators.privValidators[1])
+	reactor.cfg.FailedRoundsAlertThreshold = 2
+
+	now := time.Unix(1000000, 0)
+	// not started yet
+	require.NoError(t, reactor.health.check(now, reactor.cfg.FailedRoundsAlertThreshold))
+
+	reactor.health.start(now)
+	require.NoError(t, reactor.health.check(now.Add(10*time.Second), reactor.cfg.FailedRoundsAlertThreshold))
+
+	// the routines never ran
+	err := reactor.health.check(now.Add(time.Minute), reactor.cfg.FailedRoundsAlertThreshold)
+	require.Error(t, err)
+	require.Equal(t,
+		[]HealthIssueReason{HealthIssueVoteRoutineStalled, HealthIssueCommitRoutineStalled},
+		err.(*UnhealthyError).Reasons(),
+	)
+
+	now = now.Add(time.Minute)
+	reactor.health.heartbeat(voteMethodID, now)
+	reactor.health.heartbeat(commitMethodID, now)
+	require.NoError(t, reactor.health.check(now, reactor.cfg.FailedRoundsAlertThreshold))
+
+	// the commit routine is wedged
+	reactor.health.heartbeat(voteMethodID, now.Add(20*time.Second))
+	err = reactor.health.check(now.Add(20*time.Second), reactor.cfg.FailedRoundsAlertThreshold)
+	require.Error(t, err)
+	require.Equal(t, []HealthIssueReason{HealthIssueCommitRoutineStalled}, err.(*UnhealthyError).Reasons())
+	reactor.health.heartbeat(commitMethodID, now.Add(20*time.Second))
+
+	// failures recorded by the reactor are picked up without acquiring the state mutex
+	reactor.db = &failingDB{DB: reactor.db, fail: true}
+	for i := 0; i < 2; i++ {
+		reactor.state.CurrentVoteSets["fn"] = validators.newVoteSetWithVotes(t, 1, 1)
+		reactor.commit("fn")
+	}
+	reactor.stateMtx.Lock()
+	defer reactor.stateMtx.Unlock()
+	err = reactor.health.check(now.Add(20*time.Second), reactor.cfg.FailedRoundsAlertThreshold)
+	require.Error(t, err)
+	require.Equal(t,
+		[]HealthIssueReason{HealthIssuePersistenceFailing, HealthIssueFnNotConverging},
+		err.(*UnhealthyError).Reasons(),
+	)
+	require.Equal(t, "fn", err.(*UnhealthyError).Issues[1].FnID)
+}
+
+func TestValidatorPeers(t *testing.T) {
+	validators := newTestValidators(3)
+	reactor := validators.newReactor(t, validators.privValidators[0])
+	reactor.cfg.ValidatorPeers = make(map[p2p.ID]crypto.Address)
+	reactor.cfg.ValidatorPeerNetAddresses = map[p2p.ID]string{"b": "127.0.0.1:46656"}
+	for i, nodeID := range []p2p.ID{"a", "b", "c"} {
+		reactor.cfg.ValidatorPeers[nodeID] = validators.privValidators[i].GetPubKey().Address()
+	}
+	reactor.AddPeer(newRecordingPeer("c"))
+
+	var notified [][]*ValidatorPeer
+	reactor.SetValidatorPeersChangedHandler(func(peers []*ValidatorPeer) {
+		notified = append(notified, peers)
+	})
+
+	// our own node is excluded
+	peers := reactor.ValidatorPeers()
+	require.Len(t, peers, 2)
+	require.Equal(t, p2p.ID("b"), peers[0].NodeID)
+	require.Equal(t, "b@127.0.0.1:46656", peers[0].DialString())
+	require.False(t, peers[0].Connected)
+	require.Equal(t, "", peers[1].DialString())
+	require.True(t, peers[1].Connected)
+
+	// the handler is notified until all the validator peers that can be dialed are connected...
+	reactor.refreshValidatorPeers(validators.valSet)
+	reactor.refreshValidatorPeers(validators.valSet)
+	require.Len(t, notified, 2)
+	peerB := newRecordingPeer("b")
+	reactor.AddPeer(peerB)
+	reactor.refreshValidatorPeers(validators.valSet)
+	require.Len(t, notified, 2)
+	// ...and again once one of them disconnects
+	reactor.RemovePeer(peerB, nil)
+	reactor.refreshValidatorPeers(validators.valSet)
+	require.Len(t, notified, 3)
+	require.Equal(t, "b@127.0.0.1:46656", notified[2][0].DialString())
+	require.False(t, notified[2][0].Connected)
+
+	// validators that leave the validator set are no longer validator peers, so the handler isn't
+	// asked to dial them again
+	_, validator := validators.valSet.GetByAddress(reactor.cfg.ValidatorPeers["a"])
+	reactor.refreshValidatorPeers(types.NewValidatorSet([]*types.Validator{validator}))
+	reactor.refreshValidatorPeers(types.NewValidatorSet([]*types.Validator{validator}))
+	require.Len(t, notified, 4)
+	require.Empty(t, notified[3])
+
+	cfg := DefaultReactorConfigParsable()
+	cfg.ValidatorPeers = []*ValidatorPeerParsable{{Address: "0x0102", NodeID: "abcd", NetAddress: "localhost"}}
+	_, err := cfg.Parse()
+	require.Error(t, err)
+}
+
+// Returns the number of proposals of the given Fn skipped so far.
+func skippedProposals(t *testing.T, fnID string) float64 {
+	families, err := stdprometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "loomchain_fnConsensus_skipped_proposal_count" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "fnID" && label.GetValue() == fnID {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestProposeRequiresReachableQuorum(t *testing.T) {
+	validators := newTestValidators(4)
+	reactor := validators.newReactor(t, validators.privValidators[0])
+	ownIndex := validators.indexOf(validators.privValidators[0])
+	reactor.fnRegistry = NewInMemoryFnRegistry()
+	require.NoError(t, reactor.fnRegistry.Set("fn", messageFn{message: []byte("hello world")}))
+	reactor.cfg.RequireReachableQuorum = true
+	reactor.cfg.ValidatorPeers = make(map[p2p.ID]crypto.Address)
+	var peers []*recordingPeer
+	for i, nodeID := range []p2p.ID{"b", "c", "d"} {
+		reactor.cfg.ValidatorPeers[nodeID] = validators.privValidators[i+1].GetPubKey().Address()
+		peers = append(peers, newRecordingPeer(nodeID))
+	}
+	skipped := skippedProposals(t, "fn")
+
+	// 2 of the 4 validators can't reach the signing threshold, so nothing is proposed...
+	reactor.AddPeer(peers[0])
+	reactor.AddPeer(newRecordingPeer("not-a-validator"))
+	reactor.propose([]string{"fn"}, validators.valSet, ownIndex)
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+	require.Empty(t, peers[0].sent)
+	require.Equal(t, skipped+1, skippedProposals(t, "fn"))
+
+	// ...but 3 of them can.
+	reactor.AddPeer(peers[1])
+	reactor.propose([]string{"fn"}, validators.valSet, ownIndex)
+	require.NotNil(t, reactor.state.CurrentVoteSets["fn"])
+	for _, peer := range peers[:2] {
+		require.Len(t, peer.sent[reactor.cfg.voteSetChannelID()], 1)
+	}
+	require.Equal(t, skipped+1, skippedProposals(t, "fn"))
+}
+
+type voteSignBytesVector struct {
+	Description      string `json:"description"`
+	Nonce            int64  `json:"nonce"`
+	ChainID          string `json:"chain_id"`
+	ValidatorAddress string `json:"validator_address"`
+	ValidatorsHash   string `json:"validators_hash"`
+	FnID             string `json:"fn_id"`
+	FnVersion        string `json:"fn_version"`
+	ExpiresAt        int64  `json:"expires_at"`
+	Hash             string `json:"hash"`
+	OracleSignature  string `json:"oracle_signature"`
+	HashAlgorithm    string `json:"hash_algorithm"`
+	// Only set in vectors with embedded quorum parameters.
+	SigningThreshold    string  `json:"signing_threshold"`
+	RequiredVotingPower int64   `json:"required_voting_power"`
+	VotingPowers        []int64 `json:"voting_powers"`
+	SignBytes           string  `json:"sign_bytes"`
+}
+
+// The sign bytes must never change, otherwise validators running different versions won't be able
+// to verify each other's votes, alternative implementations can use the same vectors.
+func TestVoteSignBytesGoldenVectors(t *testing.T) {
+	// Encoding of FnExecutionRequest{FnID: "fn"} signed by earlier versions of the reactor, which
+	// encoded the request with cdc.MarshalBinaryLengthPrefixed.
+	require.Equal(t, "08ac3ed4800a02666e", hex.EncodeToString(requestSignBytes(&FnExecutionRequest{FnID: "fn"})))
+
+	vectorsJSON, err := ioutil.ReadFile("testdata/vote_sign_bytes.json")
+	require.NoError(t, err)
+	var vectors []voteSignBytesVector
+	require.NoError(t, json.Unmarshal(vectorsJSON, &vectors))
+	require.NotEmpty(t, vectors)
+
+	decodeHex := func(s string) []byte {
+		bz, err := hex.DecodeString(s)
+		require.NoError(t, err)
+		return bz
+	}
+
+	for _, vector := range vectors {
+		voteSet := &FnVoteSet{
+			Nonce:              vector.Nonce,
+			ChainID:            vector.ChainID,
+			ValidatorsHash:     decodeHex(vector.ValidatorsHash),
+			ValidatorAddresses: [][]byte{decodeHex(vector.ValidatorAddress)},
+			Payload: &FnVotePayload{
+				Request: &FnExecutionRequest{
+					FnID:      vector.FnID,
+					FnVersion: vector.FnVersion,
+					ExpiresAt: vector.ExpiresAt,
+				},
+				Response: &FnExecutionResponse{
+					HashAlgorithm:    HashAlgorithm(vector.HashAlgorithm),
+					Hashes:           [][]byte{decodeHex(vector.Hash)},
+					OracleSignatures: [][]byte{decodeHex(vector.OracleSignature)},
+				},
+			},
+		}
+		if vector.SigningThreshold != "" {
+			voteSet.QuorumParams = &QuorumParams{
+				SigningThreshold:    SigningThreshold(vector.SigningThreshold),
+				RequiredVotingPower: vector.RequiredVotingPower,
+				VotingPowers:        vector.VotingPowers,
+			}
+		}
+		signBytes, err := voteSet.SignBytes(0)
+		require.NoError(t, err)
+		require.Equal(t, vector.SignBytes, hex.EncodeToString(signBytes), vector.Description)
+
+		// The request and response are encoded exactly as the codec encodes them.
+		aminoRequest, err := cdc.MarshalBinaryLengthPrefixed(voteSet.Payload.Request)
+		require.NoError(t, err)
+		require.Equal(t, aminoRequest, requestSignBytes(voteSet.Payload.Request), vector.Description)
+		individualResponse := &FnIndividualExecutionResponse{
+			Hash:            voteSet.Payload.Response.Hashes[0],
+			OracleSignature: voteSet.Payload.Response.OracleSignatures[0],
+			HashAlgorithm:   voteSet.Payload.Response.HashAlgorithm,
+		}
+		aminoResponse, err := cdc.MarshalBinaryLengthPrefixed(individualResponse)
+		require.NoError(t, err)
+		require.Equal(t, aminoResponse, individualResponseSignBytes(individualResponse), vector.Description)
+	}
+}
+
+type messageFn struct {
+	noopFn
+	message []byte
+}
+
+func (f messageFn) GetMessageAndSignature(ctx []byte) ([]byte, []byte, error) {
+	return f.message, []byte{1}, nil
+}
+
+func TestVoteOmitsDefaultHashAlgorithm(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, validators.privValidators[1])
+	ownIndex := validators.indexOf(validators.privValidators[1])
+	fn := messageFn{message: []byte("hello world")}
+
+	// votes hashed with the default algorithm are signed the same way as before the algorithm was
+	// recorded in votes, so they can be verified by validators that don't record it
+	reactor.vote("fn", fn, validators.valSet, ownIndex)
+	voteSet := reactor.state.CurrentVoteSets["fn"]
+	require.NotNil(t, voteSet)
+	require.Equal(t, HashAlgorithm(""), voteSet.Payload.Response.HashAlgorithm)
+	require.NoError(t, voteSet.IsValid("chain", validators.valSet, nil))
+
+	reactor.cfg.FnHashAlgorithms = map[string]HashAlgorithm{"fn": Keccak256HashAlgorithm}
+	reactor.setCurrentNonce("fn", 2)
+	reactor.vote("fn", fn, validators.valSet, ownIndex)
+	voteSet = reactor.state.CurrentVoteSets["fn"]
+	require.Equal(t, Keccak256HashAlgorithm, voteSet.Payload.Response.HashAlgorithm)
+	require.NoError(t, voteSet.IsValid("chain", validators.valSet, nil))
+}
+
+func TestRoundTraces(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, validators.privValidators[1])
+	ownIndex := validators.indexOf(validators.privValidators[1])
+	fn := messageFn{message: []byte("hello world")}
+
+	// tracing is disabled by default
+	reactor.vote("fn", fn, validators.valSet, ownIndex)
+	traces, err := LoadRoundTraces(reactor.db, "fn")
+	require.NoError(t, err)
+	require.Empty(t, traces)
+
+	reactor.cfg.RoundTracesPerFn = 2
+	reactor.cfg.RoundTraceMaxMessageSize = 5
+	reactor.vote("fn", fn, validators.valSet, ownIndex)
+	trace, err := LoadRoundTrace(reactor.db, "fn", 1)
+	require.NoError(t, err)
+	require.Equal(t, RoundTraceDecisionPending, trace.Decision)
+	require.Equal(t, []byte("hello"), trace.Message)
+	require.True(t, trace.MessageTruncated)
+	require.Equal(t, reactor.state.Messages["fn"].Hash, trace.Hash)
+
+	// a single vote isn't enough to converge
+	reactor.commit("fn")
+	trace, err = LoadRoundTrace(reactor.db, "fn", 1)
+	require.NoError(t, err)
+	require.Equal(t, RoundTraceDecisionNotConverged, trace.Decision)
+
+	// only the traces of the most recent rounds are kept
+	for _, nonce := range []int64{2, 3} {
+		reactor.setCurrentNonce("fn", nonce)
+		reactor.vote("fn", fn, validators.valSet, ownIndex)
+	}
+	traces, err = LoadRoundTraces(reactor.db, "fn")
+	require.NoError(t, err)
+	require.Len(t, traces, 2)
+	require.Equal(t, int64(2), traces[0].Nonce)
+	require.Equal(t, int64(3), traces[1].Nonce)
+
+	reactor.traceDecision("fn", 2, traces[0].Hash)
+	reactor.traceDecision("fn", 3, []byte{1, 2, 3})
+	traces, err = LoadRoundTraces(reactor.db, "fn")
+	require.NoError(t, err)
+	require.Equal(t, RoundTraceDecisionAgree, traces[0].Decision)
+	require.Equal(t, RoundTraceDecisionDisagree, traces[1].Decision)
+	require.Equal(t, []byte{1, 2, 3}, traces[1].MajorityHash)
+
+	// the traces of Fns whose IDs share a prefix are kept apart
+	require.NoError(t, saveRoundTrace(reactor.db, &RoundTrace{FnID: "fn:other", Nonce: 1}, 1))
+	require.NoError(t, saveRoundTrace(reactor.db, &RoundTrace{FnID: "fn:other", Nonce: 2}, 1))
+	traces, err = LoadRoundTraces(reactor.db, "fn")
+	require.NoError(t, err)
+	require.Len(t, traces, 2)
+	require.Equal(t, "fn", traces[0].FnID)
+	require.Equal(t, "fn", traces[1].FnID)
+	traces, err = LoadRoundTraces(reactor.db, "fn:other")
+	require.NoError(t, err)
+	require.Len(t, traces, 1)
+	require.Equal(t, int64(2), traces[0].Nonce)
+}
+
+func TestRelayOnlyWhileCatchingUp(t *testing.T) {
+	validators := newTestValidators(2)
+	reactor := validators.newReactor(t, validators.privValidators[1])
+	reactor.connectedPeers["other"] = newRecordingPeer("other")
+	reactor.health.start(time.Now())
+
+	catchingUp := true
+	reactor.SetSyncStatusProvider(SyncStatusProviderFunc(func() bool { return catchingUp }))
+
+	// votesets are relayed without being signed while the node is catching up
+	voteSetBytes, err := validators.newVoteSetWithVotes(t, 1, 1).Marshal()
+	require.NoError(t, err)
+	reactor.handleVoteSetChannelMessage(newRecordingPeer("sender"), voteSetBytes)
+	require.True(t, reactor.IsSyncing())
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+	require.Equal(t, [][]byte{voteSetBytes}, reactor.connectedPeers["other"].(*recordingPeer).sent[FnVoteSetChannel])
+	err = reactor.health.check(time.Now(), 0)
+	require.Error(t, err)
+	require.Equal(t, []HealthIssueReason{HealthIssueSyncing}, err.(*UnhealthyError).Reasons())
+
+	// once caught up the node signs votesets again
+	catchingUp = false
+	reactor.handleVoteSetChannelMessage(newRecordingPeer("sender"), voteSetBytes)
+	require.False(t, reactor.IsSyncing())
+	require.Equal(t, 2, reactor.state.CurrentVoteSets["fn"].NumberOfVotes())
+	require.NoError(t, reactor.health.check(time.Now(), 0))
+
+	now := time.Unix(1000000, 0)
+	require.False(t, isBlockTimeLagExceeded(now.Add(-time.Minute), now, 0))
+	require.False(t, isBlockTimeLagExceeded(now.Add(-time.Minute), now, 2*time.Minute))
+	require.True(t, isBlockTimeLagExceeded(now.Add(-3*time.Minute), now, 2*time.Minute))
+	require.False(t, isBlockTimeLagExceeded(time.Time{}, now, 2*time.Minute))
+}
+
+func TestMultipleReactorInstances(t *testing.T) {
+	validators := newTestValidators(1)
+	registry := NewInMemoryFnRegistry()
+	db := dbm.NewMemDB()
+
+	newInstance := func(name string, voteSetChannelID, majChannelID byte) *FnConsensusReactor {
+		cfg := DefaultReactorConfigParsable()
+		cfg.InstanceName = name
+		cfg.VoteSetChannelID = voteSetChannelID
+		cfg.MajChannelID = majChannelID
+		reactor, err := NewFnConsensusReactor("chain", validators.privValidators[0], registry, db, nil, cfg)
+		require.NoError(t, err)
+		reactor.state = NewReactorState()
+		return reactor
+	}
+	defaultInstance := newInstance("", 0, 0)
+	first := newInstance("first", 0x60, 0x61)
+	second := newInstance("second", 0x62, 0x63)
+
+	require.Equal(t, "FnConsensusReactor", defaultInstance.String())
+	require.Equal(t, "FnConsensusReactor[first]", first.String())
+	require.Equal(t, FnVoteSetChannel, defaultInstance.GetChannels()[1].ID)
+	require.Equal(t, byte(0x61), first.GetChannels()[0].ID)
+	require.Equal(t, byte(0x62), second.GetChannels()[1].ID)
+
+	// each instance only sees its own state
+	first.state.CurrentNonces["fn"] = 5
+	require.NoError(t, first.persistState(commitMethodID))
+	second.state.CurrentNonces["fn"] = 9
+	require.NoError(t, second.persistState(commitMethodID))
+
+	for expectedNonce, reactor := range map[int64]*FnConsensusReactor{0: defaultInstance, 5: first, 9: second} {
+		state, err := loadReactorState(reactor.db, Maj23SigningThreshold)
+		require.NoError(t, err)
+		require.Equal(t, expectedNonce, state.CurrentNonces["fn"], reactor.String())
+	}
+
+	cfg := DefaultReactorConfigParsable()
+	cfg.VoteSetChannelID = FnMajChannel
+	_, err := cfg.Parse()
+	require.Error(t, err)
+	cfg.VoteSetChannelID = 0x20
+	_, err = cfg.Parse()
+	require.Error(t, err)
+	cfg = DefaultReactorConfigParsable()
+	cfg.InstanceName = "first:second"
+	_, err = cfg.Parse()
+	require.Error(t, err)
+}
+
+func TestVoteLatencies(t *testing.T) {
+	validators := newTestValidators(3)
+	reactor := validators.newReactor(t, validators.privValidators[0])
+	firstIndex := validators.indexOf(validators.privValidators[0])
+	secondIndex := validators.indexOf(validators.privValidators[1])
+	thirdIndex := validators.indexOf(validators.privValidators[2])
+
+	// votes that have already been observed keep the time they were first observed at
+	roundStartedAt := time.Unix(1000000, 0)
+	reactor.observeVotes(validators.newVoteSetWithVotes(t, 1, 1), roundStartedAt.Add(500*time.Millisecond))
+	reactor.observeVotes(validators.newVoteSetWithVotes(t, 1, 2), roundStartedAt.Add(2*time.Second))
+
+	// observations are persisted along with the rest of the reactor state
+	stateBytes, err := reactor.state.Marshal()
+	require.NoError(t, err)
+	state := &ReactorState{}
+	require.NoError(t, state.Unmarshal(stateBytes))
+	require.Equal(t, reactor.state.VoteObservations, state.VoteObservations)
+
+	report := reactor.endVoteObservation("fn", validators.valSet)
+	require.Equal(t, roundStartedAt, report.RoundStartedAt)
+	require.Equal(t, 500*time.Millisecond, report.Votes[firstIndex].Latency)
+	require.Equal(t, 2*time.Second, report.Votes[secondIndex].Latency)
+	require.True(t, report.Votes[thirdIndex].Missing)
+	require.Equal(t, report.Votes[secondIndex], report.Slowest())
+	require.Equal(t, crypto.Address(validators.valSet.Validators[secondIndex].Address), report.Slowest().ValidatorAddress)
+
+	// the observations are dropped once the round ends
+	require.Nil(t, reactor.state.VoteObservations["fn"])
+	require.Equal(t, report, reactor.VoteLatencies("fn"))
+
+	// a new round starts over
+	reactor.observeVotes(validators.newVoteSetWithVotes(t, 2, 1), roundStartedAt.Add(12*time.Second))
+	require.Equal(t, roundStartedAt.Add(10*time.Second).UnixNano(), reactor.state.VoteObservations["fn"].RoundStartedAt)
+}
+
+func TestFnMessageSizeLimits(t *testing.T) {
+	validators := newTestValidators(2)
+	ownIndex := validators.indexOf(validators.privValidators[1])
+	voteSetBytes, err := validators.newVoteSetWithVotes(t, 1, 1).Marshal()
+	require.NoError(t, err)
+
+	newReactor := func(message []byte) *FnConsensusReactor {
+		reactor := validators.newReactor(t, validators.privValidators[1])
+		reactor.cfg.MessageSizeLimits = MessageSizeLimits{Min: 1, Max: 4}
+		reactor.fnRegistry = NewInMemoryFnRegistry()
+		require.NoError(t, reactor.fnRegistry.Set("fn", messageFn{message: message}))
+		return reactor
+	}
+
+	for _, message := range [][]byte{nil, []byte("hello")} {
+		// proposing
+		reactor := newReactor(message)
+		reactor.vote("fn", reactor.fnRegistry.Get("fn"), validators.valSet, ownIndex)
+		require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+		require.Empty(t, reactor.state.Messages)
+
+		// signing a voteset received from a peer
+		reactor = newReactor(message)
+		reactor.handleVoteSetChannelMessage(newRecordingPeer("sender"), voteSetBytes)
+		voteSet := reactor.state.CurrentVoteSets["fn"]
+		require.NotNil(t, voteSet)
+		require.False(t, voteSet.HaveWeAlreadySigned(ownIndex))
+	}
+
+	// messages within the limits are signed
+	reactor := newReactor([]byte("hi"))
+	reactor.vote("fn", reactor.fnRegistry.Get("fn"), validators.valSet, ownIndex)
+	require.NotNil(t, reactor.state.CurrentVoteSets["fn"])
+
+	// per-Fn limits take precedence
+	reactor = newReactor([]byte("hello"))
+	reactor.cfg.FnMessageSizeLimits = map[string]*MessageSizeLimits{"fn": {Min: 1}}
+	require.NoError(t, reactor.checkMessageSize("fn", []byte("hello")))
+	require.Equal(t, ErrFnMessageTooSmall, errors.Cause(reactor.checkMessageSize("fn", nil)))
+	require.Equal(t, ErrFnMessageTooLarge, errors.Cause(newReactor(nil).checkMessageSize("fn", []byte("hello"))))
+
+	// empty messages are accepted by default
+	cfg := DefaultReactorConfigParsable()
+	parsedCfg, err := cfg.Parse()
+	require.NoError(t, err)
+	reactor.cfg = parsedCfg
+	require.NoError(t, reactor.checkMessageSize("fn", nil))
+
+	cfg.FnMessageSizeLimits = map[string]*MessageSizeLimits{"fn": {Min: 10, Max: 5}}
+	_, err = cfg.Parse()
+	require.Error(t, err)
+}
+
+func TestAttachToNode(t *testing.T) {
+	nodeConfig := tmcfg.ResetTestRoot("fnConsensus_attach_to_node")
+	defer os.RemoveAll(nodeConfig.RootDir)
+	registry := NewInMemoryFnRegistry()
+
+	// the chain ID, private validator & DBs are derived from the node
+	reactorConfig := DefaultReactorConfigParsable()
+	reactorConfig.IsValidator = true
+	reactor, err := AttachToNode(nodeConfig, registry, NodeOptions{Reactor: reactorConfig})
+	require.NoError(t, err)
+	require.Equal(t, "tendermint_test", reactor.chainID)
+	require.Equal(t, "A3258DCBF45DCA0DF052981870F2D1441A36D145", reactor.privValidator.GetPubKey().Address().String())
+	require.NotNil(t, reactor.db)
+	require.NotNil(t, reactor.tmStateDB)
+
+	// the channels of the reactor can't be used by other reactors
+	reactors := []*node.ReactorRegistrationRequest{{Name: "FNCONSENSUS", Reactor: reactor}}
+	reactorConfig = DefaultReactorConfigParsable()
+	reactorConfig.InstanceName = "second"
+	_, err = AttachToNode(nodeConfig, registry, NodeOptions{Reactor: reactorConfig, Reactors: reactors})
+	require.Error(t, err)
+
+	reactorConfig.VoteSetChannelID = 0x60
+	reactorConfig.MajChannelID = 0x61
+	second, err := AttachToNode(nodeConfig, registry, NodeOptions{
+		ChainID: "chain", Reactor: reactorConfig, Reactors: reactors,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "chain", second.chainID)
+	// non-validators don't need any persistent state, but still read the TM state
+	require.Nil(t, second.db)
+	require.NotNil(t, second.tmStateDB)
+
+	// nor by the reactors Tendermint registers
+	second.cfg.VoteSetChannelID = mempool.MempoolChannel
+	err = checkChannelsAvailable(second, builtinReactors(nodeConfig))
+	require.EqualError(t, err, "FnConsensusReactor[second] channel 0x30 is already used by reactor MEMPOOL")
+	second.cfg.VoteSetChannelID = 0x60
+	second.cfg.MajChannelID = consensus.VoteChannel
+	err = checkChannelsAvailable(second, builtinReactors(nodeConfig))
+	require.EqualError(t, err, "FnConsensusReactor[second] channel 0x22 is already used by reactor CONSENSUS")
+	// the PEX reactor is only registered when it's enabled
+	require.Len(t, builtinReactors(nodeConfig), 5)
+	nodeConfig.P2P.PexReactor = false
+	require.Len(t, builtinReactors(nodeConfig), 4)
+}
+
+func TestQuorumParams(t *testing.T) {
+	// 3 of the 4 validators are needed to reach 2/3+ of the voting power
+	validators := newTestValidators(4)
+	firstIndex := validators.indexOf(validators.privValidators[0])
+	newVoteSet := func(numVotes int, signingThreshold SigningThreshold) *FnVoteSet {
+		payload := NewFnVotePayload(
+			&FnExecutionRequest{FnID: "fn"},
+			NewFnExecutionResponse(validators.newResponse(firstIndex), firstIndex, validators.valSet),
+		)
+		voteSet, err := NewVoteSetWithQuorumParams(
+			1, "chain", firstIndex, payload, validators.privValidators[0], validators.valSet, signingThreshold,
+		)
+		require.NoError(t, err)
+		for _, pv := range validators.privValidators[1:numVotes] {
+			index := validators.indexOf(pv)
+			require.NoError(t, voteSet.AddVote(1, validators.newResponse(index), validators.valSet, index, pv))
+		}
+		return voteSet
+	}
+
+	// the embedded parameters are covered by the signatures
+	voteSet := newVoteSet(3, Maj23SigningThreshold)
+	require.Equal(t, NewQuorumParams(Maj23SigningThreshold, validators.valSet), voteSet.QuorumParams)
+	require.NoError(t, voteSet.IsValid("chain", validators.valSet, nil))
+	require.True(t, voteSet.HasConverged(Maj23SigningThreshold, validators.valSet))
+	require.NotNil(t, voteSet.MajResponse(Maj23SigningThreshold, validators.valSet))
+
+	voteSet.QuorumParams.RequiredVotingPower = 1
+	err := voteSet.IsValid("chain", validators.valSet, nil)
+	require.Equal(t, InvalidVoteSetQuorumParamsMismatch, invalidVoteSetReason(err))
+
+	// votesets created under a different signing threshold never converge, and are rejected
+	voteSet = newVoteSet(4, AllSigningThreshold)
+	require.NoError(t, voteSet.IsValid("chain", validators.valSet, nil))
+	require.True(t, voteSet.HasConverged(AllSigningThreshold, validators.valSet))
+	require.False(t, voteSet.HasConverged(Maj23SigningThreshold, validators.valSet))
+	require.Nil(t, voteSet.MajResponse(Maj23SigningThreshold, validators.valSet))
+	err = voteSet.CheckSigningThreshold(Maj23SigningThreshold)
+	require.Equal(t, InvalidVoteSetQuorumParamsMismatch, invalidVoteSetReason(err))
+
+	reactor := validators.newReactor(t, validators.privValidators[1])
+	voteSetBytes, err := newVoteSet(1, AllSigningThreshold).Marshal()
+	require.NoError(t, err)
+	reactor.handleVoteSetChannelMessage(newRecordingPeer("sender"), voteSetBytes)
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"])
+
+	// votesets with & without embedded parameters can't be merged
+	_, err = newVoteSet(1, Maj23SigningThreshold).Merge(validators.valSet, validators.newVoteSetWithVotes(t, 1, 2))
+	require.Equal(t, ErrFnVoteMergeDiffPayload, err)
+
+	// the reactor only embeds the parameters if configured to do so
+	ownIndex := validators.indexOf(validators.privValidators[1])
+	fn := messageFn{message: []byte("hello")}
+	reactor.vote("fn", fn, validators.valSet, ownIndex)
+	require.Nil(t, reactor.state.CurrentVoteSets["fn"].QuorumParams)
+	reactor = validators.newReactor(t, validators.privValidators[1])
+	reactor.cfg.EmbedQuorumParams = true
+	reactor.vote("fn", fn, validators.valSet, ownIndex)
+	require.Equal(t, NewQuorumParams(Maj23SigningThreshold, validators.valSet), reactor.state.CurrentVoteSets["fn"].QuorumParams)
+}
+
+func TestCollectGarbage(t *testing.T) {
+	validators := newTestValidators(3)
+	db := dbm.NewMemDB()
+	for _, fnID := range []string{"fn", "fn2"} {
+		for nonce := int64(1); nonce <= 5; nonce++ {
+			voteSet := validators.newVoteSetWithVotes(t, nonce, 2)
+			voteSet.Payload.Request.FnID = fnID
+			require.NoError(t, saveMaj23VoteSet(db, voteSet))
+		}
+	}
+	now := time.Now()
+	for nonce, detectedAt := range []time.Time{now.Add(-2 * time.Hour), now} {
+		require.NoError(t, saveConflictEvidence(db, &ConflictEvidence{
+			FnID: "fn", Nonce: int64(nonce + 1), DetectedAt: detectedAt.Unix(),
+		}))
+	}
+
+	// nothing is deleted unless a retention limit is set
+	stats, err := CollectGarbage(db, GCRetention{}, now)
+	require.NoError(t, err)
+	require.Empty(t, stats.DeletedKeys)
+
+	stats, err = CollectGarbage(db, GCRetention{Maj23VoteSets: 2, ConflictEvidence: time.Hour}, now)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{GCKeyKindMaj23VoteSet: 6, GCKeyKindConflictEvidence: 1}, stats.DeletedKeys)
+	require.True(t, stats.ReclaimedBytes > 0)
+
+	for _, fnID := range []string{"fn", "fn2"} {
+		for nonce := int64(1); nonce <= 5; nonce++ {
+			voteSet, err := loadMaj23VoteSet(db, fnID, nonce)
+			require.NoError(t, err)
+			require.Equal(t, nonce > 3, voteSet != nil, "fn %s nonce %d", fnID, nonce)
+		}
+	}
+	evidence, err := loadAllConflictEvidence(db)
+	require.NoError(t, err)
+	require.Len(t, evidence, 1)
+	require.Equal(t, int64(2), evidence[0].Nonce)
+
+	// collecting again is a no-op
+	stats, err = CollectGarbage(db, GCRetention{Maj23VoteSets: 2, ConflictEvidence: time.Hour}, now)
+	require.NoError(t, err)
+	require.Empty(t, stats.DeletedKeys)
+}
+
+// recordingFn records the multi-signed messages submitted to it.
+type recordingFn struct {
+	noopFn
+	mtx        sync.Mutex
+	signatures [][][]byte
+}
+
+func (fn *recordingFn) SubmitMultiSignedMessage(ctx []byte, key []byte, signatures [][]byte) {
+	fn.mtx.Lock()
+	defer fn.mtx.Unlock()
+	fn.signatures = append(fn.signatures, signatures)
+}
+
+func TestLateVotesMergedUntilCommit(t *testing.T) {
+	validators := newTestValidators(4)
+	// Order the validators by index, so that the validator at index 0 creates the votesets, and is
+	// the one that submits the message at nonce 12 whether 3 or 4 validators agree.
+	sort.Slice(validators.privValidators, func(i, j int) bool {
+		return validators.indexOf(validators.privValidators[i]) < validators.indexOf(validators.privValidators[j])
+	})
+	const nonce = 12
+
+	// a late vote missing its oracle signature is rejected without merging any of the other votes
+	voteSet := validators.newVoteSetWithVotes(t, nonce, 2)
+	lateVoteSet := validators.newVoteSetWithVotes(t, nonce, 4)
+	lateVoteSet.Payload.Response.OracleSignatures[3] = nil
+	_, err := voteSet.Merge(validators.valSet, lateVoteSet)
+	require.Equal(t, ErrFnVoteMergeIncompleteVote, err)
+	require.Equal(t, 2, voteSet.NumberOfVotes())
+	require.Nil(t, voteSet.Payload.Response.OracleSignatures[2])
+
+	lateVoteSetBytes, err := validators.newVoteSetWithVotes(t, nonce, 4).Marshal()
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		fn := &recordingFn{}
+		reactor := validators.newReactor(t, validators.privValidators[0])
+		reactor.fnRegistry = NewInMemoryFnRegistry()
+		require.NoError(t, reactor.fnRegistry.Set("fn", fn))
+		reactor.setCurrentNonce("fn", nonce)
+		reactor.state.CurrentVoteSets["fn"] = validators.newVoteSetWithVotes(t, nonce, 3)
+		reactor.state.Messages["fn"] = Message{Payload: []byte("message"), Hash: []byte{1, 2, 3}}
+
+		// race the late vote against the commit
+		merged := make(chan struct{})
+		go func() {
+			reactor.handleVoteSetChannelMessage(newRecordingPeer("sender"), lateVoteSetBytes)
+			close(merged)
+		}()
+		reactor.commit("fn")
+		<-merged
+
+		require.Len(t, fn.signatures, 1)
+		numSignatures := 0
+		for _, signature := range fn.signatures[0] {
+			if signature != nil {
+				numSignatures++
+			}
+		}
+		require.True(t, numSignatures == 3 || numSignatures == 4, "%d signatures submitted", numSignatures)
+		for index, signature := range fn.signatures[0] {
+			if index < numSignatures {
+				require.Equal(t, validators.newResponse(index).OracleSignature, signature)
+			} else {
+				require.Nil(t, signature)
+			}
+		}
+
+		// the submitted signatures match the archived voteset
+		archivedVoteSet, err := loadMaj23VoteSet(reactor.db, "fn", nonce)
+		require.NoError(t, err)
+		require.Equal(t, numSignatures, archivedVoteSet.NumberOfVotes())
+	}
+}
+
+func TestOverrideValidators(t *testing.T) {
+	validators := newTestValidators(3)
+	tmStateDB := dbm.NewMemDB()
+	saveTMState := func(valSet *types.ValidatorSet) *types.ValidatorSet {
+		tmstate.SaveState(tmStateDB, tmstate.State{
+			Validators:      valSet,
+			NextValidators:  valSet,
+			LastValidators:  valSet,
+			ConsensusParams: *types.DefaultConsensusParams(),
+		})
+		return valSet
+	}
+	tmValidators := saveTMState(validators.valSet)
+
+	reactor := validators.newReactor(t, validators.privValidators[0])
+	reactor.staticValidators = nil
+	reactor.tmStateDB = tmStateDB
+	reactor.cfg.IsValidator = true
+	for _, validator := range tmValidators.Validators {
+		reactor.cfg.OverrideValidators = append(reactor.cfg.OverrideValidators, &OverrideValidator{
+			Address: validator.Address, VotingPower: 100,
+		})
+	}
+
+	// startup fails if an override validator doesn't exist in the TM validator set
+	unknownAddress := types.NewMockPV().GetAddress()
+	reactor.cfg.OverrideValidators = append(reactor.cfg.OverrideValidators, &OverrideValidator{
+		Address: unknownAddress, VotingPower: 100,
+	})
+	err := reactor.OnStart()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), unknownAddress.String())
+	reactor.cfg.OverrideValidators = reactor.cfg.OverrideValidators[:3]
+
+	require.NoError(t, reactor.initValidatorSet(tmstate.LoadState(tmStateDB)))
+	status := reactor.StaticValidatorSet()
+	require.Equal(t, 3, status.ValidatorSet.Size())
+	require.Equal(t, int64(300), status.ValidatorSet.TotalVotingPower())
+	require.Equal(t, tmValidators.Hash(), status.TMValidatorsHash)
+	require.Empty(t, status.MissingValidators)
+	staticValidatorsHash := status.ValidatorSet.Hash()
+
+	// a validator removed from the TM validator set is reported, but the static set is kept
+	removedValidator := tmValidators.Validators[2]
+	tmValidators = saveTMState(types.NewValidatorSet(tmValidators.Validators[:2]))
+	now := time.Now()
+	reactor.revalidateOverrideValidators(now)
+	status = reactor.StaticValidatorSet()
+	require.Equal(t, staticValidatorsHash, status.ValidatorSet.Hash())
+	require.Equal(t, []crypto.Address{removedValidator.Address}, status.MissingValidators)
+	require.Equal(t, tmValidators.Hash(), status.TMValidatorsHash)
+	require.Equal(t, now, status.ValidatedAt)
+
+	// the static set is refreshed from the TM validator set once it changes again, if enabled
+	reactor.cfg.RefreshOverrideValidators = true
+	reactor.revalidateOverrideValidators(time.Now())
+	require.Equal(t, 3, reactor.getValidatorSet().Size())
+
+	changedValidators := []*types.Validator{tmValidators.Validators[0].Copy(), tmValidators.Validators[1].Copy()}
+	changedValidators[0].VotingPower = 20
+	saveTMState(types.NewValidatorSet(changedValidators))
+	reactor.revalidateOverrideValidators(time.Now())
+	require.Equal(t, 2, reactor.getValidatorSet().Size())
+	require.Equal(t, int64(200), reactor.getValidatorSet().TotalVotingPower())
+}
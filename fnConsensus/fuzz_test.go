@@ -0,0 +1,72 @@
+//go:build go1.18
+// +build go1.18
+
+package fnConsensus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	cmn "github.com/tendermint/tendermint/libs/common"
+)
+
+// Returns encoded votesets that can be used to seed the fuzzers, ranging from valid votesets to
+// votesets that are malformed in various ways. These are generated with fresh validator keys on every
+// run, so testdata/fuzz also holds a fixed corpus for each fuzzer, including the inputs that used to
+// crash the handlers (empty_voteset, empty_payload, nil_request, broken_signature_bit_array), so that
+// those regressions are caught by a plain go test run.
+func fuzzSeeds(f *testing.F, validators *testValidators) [][]byte {
+	seedVoteSets := []*FnVoteSet{
+		validators.newVoteSetWithVotes(f, 1, 1),
+		validators.newVoteSetWithVotes(f, 1, 2),
+		validators.newVoteSetWithVotes(f, 7, 2),
+		{},
+		{Payload: &FnVotePayload{Request: &FnExecutionRequest{FnID: "fn"}}},
+	}
+
+	brokenBitArray := validators.newVoteSetWithVotes(f, 1, 2)
+	brokenBitArray.VoteBitArray = &cmn.BitArray{Bits: 2}
+	seedVoteSets = append(seedVoteSets, brokenBitArray)
+
+	seeds := make([][]byte, 0, len(seedVoteSets)+1)
+	for _, voteSet := range seedVoteSets {
+		msgBytes, err := cdc.MarshalBinaryLengthPrefixed(voteSet)
+		if err != nil {
+			f.Fatal(err)
+		}
+		seeds = append(seeds, msgBytes, msgBytes[:len(msgBytes)/2])
+	}
+	return seeds
+}
+
+// Checks the handler didn't leave the state mutex locked.
+func requireStateUnlocked(t *testing.T, reactor *FnConsensusReactor) {
+	require.True(t, reactor.stateMtx.TryLock())
+	reactor.stateMtx.Unlock()
+}
+
+func FuzzHandleVoteSetChannelMessage(f *testing.F) {
+	validators := newTestValidators(2)
+	for _, seed := range fuzzSeeds(f, validators) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, msgBytes []byte) {
+		reactor := validators.newReactor(t, validators.privValidators[1])
+		reactor.handleVoteSetChannelMessage(newRecordingPeer("sender"), msgBytes)
+		requireStateUnlocked(t, reactor)
+	})
+}
+
+func FuzzHandleMaj23VoteSetChannel(f *testing.F) {
+	validators := newTestValidators(2)
+	for _, seed := range fuzzSeeds(f, validators) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, msgBytes []byte) {
+		reactor := validators.newReactor(t, validators.privValidators[1])
+		reactor.handleMaj23VoteSetChannel(newRecordingPeer("sender"), msgBytes)
+		requireStateUnlocked(t, reactor)
+	})
+}
@@ -0,0 +1,149 @@
+package fnConsensus
+
+import (
+	"bytes"
+	"time"
+
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+// Kinds of keys deleted by the garbage collector.
+const (
+	GCKeyKindMaj23VoteSet     = "maj23_voteset"
+	GCKeyKindConflictEvidence = "conflict_evidence"
+)
+
+// GCRetention determines which keys in fnConsensus.db are deleted by the garbage collector.
+type GCRetention struct {
+	// Number of archived Maj23 votesets to keep per Fn, zero to keep all of them.
+	Maj23VoteSets int64
+	// How long to keep evidence of conflicting Maj23 votesets, zero to keep it forever.
+	ConflictEvidence time.Duration
+}
+
+// GCStats describe the keys deleted by a garbage collection pass.
+type GCStats struct {
+	// Number of keys deleted (per key kind).
+	DeletedKeys map[string]int
+	// Total size of the deleted keys & values.
+	ReclaimedBytes int64
+}
+
+func newGCStats() *GCStats {
+	return &GCStats{DeletedKeys: make(map[string]int)}
+}
+
+func (s *GCStats) record(kind string, key []byte, value []byte) {
+	s.DeletedKeys[kind]++
+	s.ReclaimedBytes += int64(len(key) + len(value))
+}
+
+// CollectGarbage deletes the keys in fnConsensus.db that are no longer needed according to the
+// given retention settings. The latest Maj23 voteset of each Fn is always kept since it's needed
+// to help peers fast-forward.
+func CollectGarbage(db dbm.DB, retention GCRetention, now time.Time) (*GCStats, error) {
+	stats := newGCStats()
+
+	if retention.Maj23VoteSets > 0 {
+		collectMaj23VoteSets(db, retention.Maj23VoteSets, stats)
+	}
+
+	if retention.ConflictEvidence > 0 {
+		if err := collectConflictEvidence(db, now.Add(-retention.ConflictEvidence), stats); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// Deletes all but the given number of most recent Maj23 votesets of each Fn.
+func collectMaj23VoteSets(db dbm.DB, numToKeep int64, stats *GCStats) {
+	type archivedVoteSet struct {
+		key   []byte
+		value []byte
+	}
+	// The votesets of each Fn are iterated in ascending nonce order (see maj23VoteSetKey).
+	voteSetsByFn := make(map[string][]archivedVoteSet)
+	it := dbm.IteratePrefix(db, []byte(maj23VoteSetKeyPrefix))
+	for ; it.Valid(); it.Next() {
+		key := it.Key()
+		fnID := string(key[len(maj23VoteSetKeyPrefix):bytes.LastIndexByte(key, ':')])
+		voteSetsByFn[fnID] = append(voteSetsByFn[fnID], archivedVoteSet{key: key, value: it.Value()})
+	}
+	it.Close()
+
+	for _, voteSets := range voteSetsByFn {
+		for i := int64(0); i < int64(len(voteSets))-numToKeep; i++ {
+			db.Delete(voteSets[i].key)
+			stats.record(GCKeyKindMaj23VoteSet, voteSets[i].key, voteSets[i].value)
+		}
+	}
+}
+
+// Deletes evidence of conflicting Maj23 votesets detected before the given time.
+func collectConflictEvidence(db dbm.DB, cutoff time.Time, stats *GCStats) error {
+	var expiredKeys, expiredValues [][]byte
+	it := dbm.IteratePrefix(db, []byte(conflictEvidenceKeyPrefix))
+	for ; it.Valid(); it.Next() {
+		evidence := &ConflictEvidence{}
+		if err := evidence.Unmarshal(it.Value()); err != nil {
+			it.Close()
+			return err
+		}
+		if evidence.DetectedAt < cutoff.Unix() {
+			expiredKeys = append(expiredKeys, it.Key())
+			expiredValues = append(expiredValues, it.Value())
+		}
+	}
+	it.Close()
+
+	for i, key := range expiredKeys {
+		db.Delete(key)
+		stats.record(GCKeyKindConflictEvidence, key, expiredValues[i])
+	}
+	return nil
+}
+
+// Runs a garbage collection pass over fnConsensus.db.
+func (f *FnConsensusReactor) collectGarbage() {
+	// The reactor state lock is held so nothing is archived while the archive is being cleaned up.
+	f.stateMtx.Lock()
+	stats, err := CollectGarbage(f.db, f.cfg.GCRetention, time.Now())
+	f.stateMtx.Unlock()
+
+	for kind, count := range stats.DeletedKeys {
+		gcDeletedKeyCount.With("kind", kind).Add(float64(count))
+	}
+	gcReclaimedBytesCount.Add(float64(stats.ReclaimedBytes))
+
+	if err != nil {
+		f.Logger.Error("FnConsensusReactor: garbage collection failed", "err", err)
+		return
+	}
+	f.Logger.Info(
+		"FnConsensusReactor: garbage collection complete",
+		"deletedKeys", stats.DeletedKeys, "reclaimedBytes", stats.ReclaimedBytes,
+	)
+}
+
+// Runs a garbage collection pass on startup, and then periodically until the reactor is stopped.
+func (f *FnConsensusReactor) gcRoutine() {
+	defer func() {
+		if r := recover(); r != nil {
+			f.Logger.Error("Recovered in FnConsensusReactor.gcRoutine", "r", r)
+		}
+	}()
+
+	ticker := time.NewTicker(f.cfg.GCInterval)
+	defer ticker.Stop()
+
+	for {
+		f.collectGarbage()
+
+		select {
+		case <-f.Quit():
+			return
+		case <-ticker.C:
+		}
+	}
+}
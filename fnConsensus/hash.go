@@ -0,0 +1,83 @@
+package fnConsensus
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// HashAlgorithm identifies the algorithm used to hash the message a Fn generates, all validators
+// voting on a message must use the same algorithm, otherwise consensus can never be reached.
+type HashAlgorithm string
+
+const (
+	SHA512HashAlgorithm    HashAlgorithm = "sha512"
+	SHA256HashAlgorithm    HashAlgorithm = "sha256"
+	Keccak256HashAlgorithm HashAlgorithm = "keccak256"
+
+	// Votesets created before the hash algorithm was recorded in the execution response don't
+	// specify one, these were always hashed with SHA-512.
+	DefaultHashAlgorithm = SHA512HashAlgorithm
+)
+
+// HashAlgorithmProvider may be implemented by a Fn to specify which algorithm should be used to
+// hash the messages it generates. Fns that don't implement this interface use the algorithm
+// specified for them in the reactor config, or DefaultHashAlgorithm if none is specified.
+type HashAlgorithmProvider interface {
+	HashAlgorithm() HashAlgorithm
+}
+
+// Normalize returns the default algorithm in place of an unspecified one.
+func (h HashAlgorithm) Normalize() HashAlgorithm {
+	if h == "" {
+		return DefaultHashAlgorithm
+	}
+	return h
+}
+
+// Returns the value votes record the algorithm with. The default algorithm is left unspecified, so
+// votes hashed with it have the same sign bytes as votes created before the algorithm was recorded.
+func (h HashAlgorithm) voteValue() HashAlgorithm {
+	if h.Normalize() == DefaultHashAlgorithm {
+		return ""
+	}
+	return h
+}
+
+func (h HashAlgorithm) IsValid() bool {
+	switch h.Normalize() {
+	case SHA512HashAlgorithm, SHA256HashAlgorithm, Keccak256HashAlgorithm:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h HashAlgorithm) newHasher() (hash.Hash, error) {
+	switch h.Normalize() {
+	case SHA512HashAlgorithm:
+		return sha512.New(), nil
+	case SHA256HashAlgorithm:
+		return sha256.New(), nil
+	case Keccak256HashAlgorithm:
+		return sha3.NewLegacyKeccak256(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", h)
+	}
+}
+
+// Hashes the given message using the specified algorithm, the message is streamed straight into
+// the hasher so large messages are never copied.
+func calculateMessageHash(algorithm HashAlgorithm, message []byte) ([]byte, error) {
+	hasher, err := algorithm.newHasher()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := hasher.Write(message); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
@@ -0,0 +1,198 @@
+package fnConsensus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of intervals a routine can miss before it's considered to be stalled.
+const routineStallIntervals = 3
+
+// HealthIssueReason is a machine-readable code identifying why the reactor is unhealthy.
+type HealthIssueReason string
+
+const (
+	// The vote routine hasn't run for several proposal intervals.
+	HealthIssueVoteRoutineStalled HealthIssueReason = "vote_routine_stalled"
+	// The commit routine hasn't run for several commit intervals.
+	HealthIssueCommitRoutineStalled HealthIssueReason = "commit_routine_stalled"
+	// The reactor state can't be persisted, so the reactor is in degraded mode.
+	HealthIssuePersistenceFailing HealthIssueReason = "persistence_failing"
+	// A Fn has failed to converge for at least FailedRoundsAlertThreshold consecutive rounds.
+	HealthIssueFnNotConverging HealthIssueReason = "fn_not_converging"
+	// The node is catching up with the network, so the reactor is only relaying messages.
+	HealthIssueSyncing HealthIssueReason = "syncing"
+)
+
+// HealthIssue describes a single problem detected by FnConsensusReactor.Healthy.
+type HealthIssue struct {
+	Reason HealthIssueReason
+	// Only set for issues that are specific to a single Fn.
+	FnID   string
+	Detail string
+}
+
+func (i HealthIssue) String() string {
+	if i.FnID != "" {
+		return fmt.Sprintf("%s (fn %s): %s", i.Reason, i.FnID, i.Detail)
+	}
+	return fmt.Sprintf("%s: %s", i.Reason, i.Detail)
+}
+
+// UnhealthyError is returned by FnConsensusReactor.Healthy when the reactor isn't making progress.
+type UnhealthyError struct {
+	Issues []HealthIssue
+}
+
+func (e *UnhealthyError) Error() string {
+	issues := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		issues[i] = issue.String()
+	}
+	return "fnConsensus reactor is unhealthy: " + strings.Join(issues, "; ")
+}
+
+// Reasons returns the reason codes of all the issues.
+func (e *UnhealthyError) Reasons() []HealthIssueReason {
+	reasons := make([]HealthIssueReason, len(e.Issues))
+	for i, issue := range e.Issues {
+		reasons[i] = issue.Reason
+	}
+	return reasons
+}
+
+// healthMonitor mirrors the bits of the reactor state needed to check the health of the reactor, so
+// that the health check doesn't need to acquire the state mutex, which may be held by a wedged routine.
+// The zero value is ready to use.
+type healthMonitor struct {
+	mtx             sync.Mutex
+	startedAt       time.Time
+	heartbeats      map[string]time.Time
+	lastPersistedAt time.Time
+	persistFailing  bool
+	failedRounds    map[string]int64
+	syncing         bool
+}
+
+func (m *healthMonitor) start(now time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.startedAt = now
+}
+
+// Records that the routine identified by the given method ID is still running.
+func (m *healthMonitor) heartbeat(methodID string, now time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.heartbeats == nil {
+		m.heartbeats = make(map[string]time.Time)
+	}
+	m.heartbeats[methodID] = now
+}
+
+func (m *healthMonitor) recordPersist(now time.Time, err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.persistFailing = err != nil
+	if err == nil {
+		m.lastPersistedAt = now
+	}
+}
+
+func (m *healthMonitor) setSyncing(syncing bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.syncing = syncing
+}
+
+func (m *healthMonitor) setFailedRounds(fnID string, count int64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.failedRounds == nil {
+		m.failedRounds = make(map[string]int64)
+	}
+	if count == 0 {
+		delete(m.failedRounds, fnID)
+		return
+	}
+	m.failedRounds[fnID] = count
+}
+
+func (m *healthMonitor) check(now time.Time, failedRoundsThreshold int64) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.startedAt.IsZero() {
+		return nil
+	}
+
+	var issues []HealthIssue
+
+	routines := []struct {
+		methodID string
+		interval int64
+		reason   HealthIssueReason
+	}{
+		{voteMethodID, proposeIntervalInSeconds, HealthIssueVoteRoutineStalled},
+		{commitMethodID, commitIntervalInSeconds, HealthIssueCommitRoutineStalled},
+	}
+	for _, routine := range routines {
+		maxAge := time.Duration(routineStallIntervals*routine.interval) * time.Second
+		lastHeartbeat, ok := m.heartbeats[routine.methodID]
+		if !ok {
+			if now.Sub(m.startedAt) > maxAge {
+				issues = append(issues, HealthIssue{
+					Reason: routine.reason,
+					Detail: fmt.Sprintf("hasn't run since the reactor started %v ago", now.Sub(m.startedAt)),
+				})
+			}
+			continue
+		}
+		if age := now.Sub(lastHeartbeat); age > maxAge {
+			issues = append(issues, HealthIssue{
+				Reason: routine.reason,
+				Detail: fmt.Sprintf("last ran %v ago", age),
+			})
+		}
+	}
+
+	if m.syncing {
+		issues = append(issues, HealthIssue{
+			Reason: HealthIssueSyncing,
+			Detail: "node is catching up, only relaying messages",
+		})
+	}
+
+	if m.persistFailing {
+		detail := "state has never been persisted"
+		if !m.lastPersistedAt.IsZero() {
+			detail = fmt.Sprintf("state last persisted %v ago", now.Sub(m.lastPersistedAt))
+		}
+		issues = append(issues, HealthIssue{Reason: HealthIssuePersistenceFailing, Detail: detail})
+	}
+
+	if failedRoundsThreshold > 0 {
+		fnIDs := make([]string, 0, len(m.failedRounds))
+		for fnID, count := range m.failedRounds {
+			if count >= failedRoundsThreshold {
+				fnIDs = append(fnIDs, fnID)
+			}
+		}
+		sort.Strings(fnIDs)
+		for _, fnID := range fnIDs {
+			issues = append(issues, HealthIssue{
+				Reason: HealthIssueFnNotConverging,
+				FnID:   fnID,
+				Detail: fmt.Sprintf("%d consecutive rounds failed to converge", m.failedRounds[fnID]),
+			})
+		}
+	}
+
+	if len(issues) > 0 {
+		return &UnhealthyError{Issues: issues}
+	}
+	return nil
+}
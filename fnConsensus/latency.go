@@ -0,0 +1,134 @@
+package fnConsensus
+
+import (
+	"time"
+
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/types"
+)
+
+// VoteObservation records when this node first observed each of the votes in the voteset of a round
+// in progress. Observations are only stored locally, they're never signed or sent to peers.
+type VoteObservation struct {
+	FnID  string
+	Nonce int64
+	// Unix timestamp (in nanoseconds) of the start of the propose slot in which the voteset was
+	// first observed, which is when the validators are supposed to vote.
+	RoundStartedAt int64
+	// Unix timestamps (in nanoseconds) at which the vote of each validator was first observed,
+	// indexed by validator index, zero if the vote hasn't been observed.
+	VoteObservedAt []int64
+}
+
+// VoteLatency is the time it took the vote of a validator to reach this node, measured from the
+// start of the round.
+type VoteLatency struct {
+	ValidatorAddress crypto.Address
+	// Set if the vote wasn't observed by this node before the round ended.
+	Missing bool
+	Latency time.Duration
+}
+
+// VoteLatencyReport lists the latency of the votes of all the validators in a round.
+type VoteLatencyReport struct {
+	FnID           string
+	Nonce          int64
+	RoundStartedAt time.Time
+	// Indexed by validator index.
+	Votes []*VoteLatency
+}
+
+// Slowest returns the latency of the last vote observed by this node, or nil if no votes were
+// observed.
+func (r *VoteLatencyReport) Slowest() *VoteLatency {
+	var slowest *VoteLatency
+	for _, vote := range r.Votes {
+		if !vote.Missing && (slowest == nil || vote.Latency > slowest.Latency) {
+			slowest = vote
+		}
+	}
+	return slowest
+}
+
+// Returns log keyvals summarizing the vote latencies in the report.
+func (r *VoteLatencyReport) keyvals() []interface{} {
+	missingVotes := 0
+	for _, vote := range r.Votes {
+		if vote.Missing {
+			missingVotes++
+		}
+	}
+	keyvals := []interface{}{"missingVotes", missingVotes}
+	if slowest := r.Slowest(); slowest != nil {
+		keyvals = append(keyvals, "slowestValidator", slowest.ValidatorAddress, "slowestVoteLatency", slowest.Latency)
+	}
+	return keyvals
+}
+
+// VoteLatencies returns the vote latencies of the last round of the given Fn that ended since the
+// reactor was started, or nil if there's no such round.
+func (f *FnConsensusReactor) VoteLatencies(fnID string) *VoteLatencyReport {
+	f.stateMtx.Lock()
+	defer f.stateMtx.Unlock()
+
+	return f.lastVoteLatencies[fnID]
+}
+
+// Records the time at which any votes in the given voteset that haven't been seen before were
+// first observed.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) observeVotes(voteSet *FnVoteSet, now time.Time) {
+	fnID := voteSet.GetFnID()
+	numValidators := voteSet.VoteBitArray.Size()
+	observation := f.state.VoteObservations[fnID]
+	if observation == nil || observation.Nonce != voteSet.Nonce || len(observation.VoteObservedAt) != numValidators {
+		proposeInterval := time.Duration(proposeIntervalInSeconds) * time.Second
+		observation = &VoteObservation{
+			FnID:           fnID,
+			Nonce:          voteSet.Nonce,
+			RoundStartedAt: now.UnixNano() - now.UnixNano()%int64(proposeInterval),
+			VoteObservedAt: make([]int64, numValidators),
+		}
+		f.state.VoteObservations[fnID] = observation
+	}
+
+	for i := 0; i < numValidators; i++ {
+		if observation.VoteObservedAt[i] == 0 && voteSet.VoteBitArray.GetIndex(i) {
+			observation.VoteObservedAt[i] = now.UnixNano()
+		}
+	}
+}
+
+// Computes the vote latencies of the round that just ended for the given Fn, and drops the
+// observations the latencies were computed from. Returns nil if no votes were observed.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) endVoteObservation(fnID string, validatorSet *types.ValidatorSet) *VoteLatencyReport {
+	observation := f.state.VoteObservations[fnID]
+	if observation == nil {
+		return nil
+	}
+	delete(f.state.VoteObservations, fnID)
+
+	report := &VoteLatencyReport{
+		FnID:           fnID,
+		Nonce:          observation.Nonce,
+		RoundStartedAt: time.Unix(0, observation.RoundStartedAt),
+		Votes:          make([]*VoteLatency, len(observation.VoteObservedAt)),
+	}
+	for i, observedAt := range observation.VoteObservedAt {
+		vote := &VoteLatency{Missing: observedAt == 0}
+		if !vote.Missing {
+			vote.Latency = time.Duration(observedAt - observation.RoundStartedAt)
+		}
+		if _, validator := validatorSet.GetByIndex(i); validator != nil {
+			vote.ValidatorAddress = validator.Address
+		}
+		report.Votes[i] = vote
+	}
+
+	if f.lastVoteLatencies == nil {
+		f.lastVoteLatencies = make(map[string]*VoteLatencyReport)
+	}
+	f.lastVoteLatencies[fnID] = report
+	return report
+}
@@ -0,0 +1,125 @@
+package fnConsensus
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/blockchain"
+	cfg "github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/consensus"
+	"github.com/tendermint/tendermint/evidence"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	dbm "github.com/tendermint/tendermint/libs/db"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/mempool"
+	"github.com/tendermint/tendermint/node"
+	"github.com/tendermint/tendermint/p2p/pex"
+	"github.com/tendermint/tendermint/privval"
+	"github.com/tendermint/tendermint/types"
+)
+
+// NodeOptions customize how AttachToNode creates the reactor, all the fields are optional.
+type NodeOptions struct {
+	// Defaults to the chain ID in the genesis file of the node.
+	ChainID string
+	// Used to sign votes, defaults to the file-based private validator of the node.
+	PrivValidator types.PrivValidator
+	// Defaults to DefaultReactorConfigParsable().
+	Reactor *ReactorConfigParsable
+	// Used to open fnConsensus.db & state.db, defaults to node.DefaultDBProvider. The reactor reads
+	// the current validator set from state.db, so when the node uses a DB backend that can't be
+	// opened twice the provider must return the same state.db instance to the node & the reactor.
+	DBProvider node.DBProvider
+	// Reactors that will be registered with the node alongside this one, the channels of the
+	// reactor must not collide with theirs, nor with those of the reactors Tendermint registers.
+	Reactors []*node.ReactorRegistrationRequest
+	Logger   log.Logger
+}
+
+// AttachToNode creates a reactor for a Tendermint node with the given config, deriving everything
+// the reactor needs from the node unless overridden in the options. The reactor is returned ready
+// to be registered with the node (see node.ReactorRegistrationRequest).
+func AttachToNode(nodeConfig *cfg.Config, fnRegistry FnRegistry, opts NodeOptions) (*FnConsensusReactor, error) {
+	if opts.Reactor == nil {
+		opts.Reactor = DefaultReactorConfigParsable()
+	}
+	if opts.DBProvider == nil {
+		opts.DBProvider = node.DefaultDBProvider
+	}
+
+	if opts.ChainID == "" {
+		genesisDoc, err := types.GenesisDocFromFile(nodeConfig.GenesisFile())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load genesis file")
+		}
+		opts.ChainID = genesisDoc.ChainID
+	}
+
+	// Non-validators just forward messages, but they still need the validator set from the TM state
+	// to verify the results observed by subscribers.
+	tmStateDB, err := opts.DBProvider(&node.DBContext{ID: "state", Config: nodeConfig})
+	if err != nil {
+		return nil, err
+	}
+
+	var db dbm.DB
+	// Non-validators don't need to read nor write any reactor state
+	if opts.Reactor.IsValidator {
+		if opts.PrivValidator == nil {
+			if !cmn.FileExists(nodeConfig.PrivValidatorFile()) {
+				return nil, fmt.Errorf("private validator file %s not found", nodeConfig.PrivValidatorFile())
+			}
+			opts.PrivValidator = privval.LoadFilePV(nodeConfig.PrivValidatorFile())
+		}
+
+		db, err = opts.DBProvider(&node.DBContext{ID: "fnConsensus", Config: nodeConfig})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reactor, err := NewFnConsensusReactor(opts.ChainID, opts.PrivValidator, fnRegistry, db, tmStateDB, opts.Reactor)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create fnConsensus reactor")
+	}
+
+	if err := checkChannelsAvailable(reactor, append(builtinReactors(nodeConfig), opts.Reactors...)); err != nil {
+		return nil, err
+	}
+
+	if opts.Logger != nil {
+		reactor.SetLogger(opts.Logger)
+	}
+	return reactor, nil
+}
+
+// Returns the reactors Tendermint registers with a node that has the given config. Only their
+// channels are of any use, they can't be started.
+func builtinReactors(nodeConfig *cfg.Config) []*node.ReactorRegistrationRequest {
+	reactors := []*node.ReactorRegistrationRequest{
+		{Name: "MEMPOOL", Reactor: &mempool.MempoolReactor{}},
+		{Name: "BLOCKCHAIN", Reactor: &blockchain.BlockchainReactor{}},
+		{Name: "CONSENSUS", Reactor: &consensus.ConsensusReactor{}},
+		{Name: "EVIDENCE", Reactor: &evidence.EvidenceReactor{}},
+	}
+	if nodeConfig.P2P.PexReactor {
+		reactors = append(reactors, &node.ReactorRegistrationRequest{Name: "PEX", Reactor: &pex.PEXReactor{}})
+	}
+	return reactors
+}
+
+// Checks that none of the channels of the given reactor are used by the other reactors.
+func checkChannelsAvailable(reactor *FnConsensusReactor, others []*node.ReactorRegistrationRequest) error {
+	channelOwners := make(map[byte]string)
+	for _, other := range others {
+		for _, channel := range other.Reactor.GetChannels() {
+			channelOwners[channel.ID] = other.Name
+		}
+	}
+	for _, channel := range reactor.GetChannels() {
+		if owner, ok := channelOwners[channel.ID]; ok {
+			return fmt.Errorf("%s channel %#x is already used by reactor %s", reactor, channel.ID, owner)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package fnConsensus
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// Number of results buffered for each subscription if the subscriber doesn't specify a buffer size.
+const DefaultResultSubscriptionBufferSize = 16
+
+// ConvergedResult describes a Fn message the validators have reached consensus on.
+type ConvergedResult struct {
+	FnID  string
+	Nonce int64
+	// Hash of the message the validators agreed on.
+	Hash []byte
+	// Message the validators agreed on, only available when the result was produced by this node,
+	// results adopted from Maj23 votesets received from peers only contain the hash.
+	Message []byte
+	// Signatures of the validators that agreed on the message, indexed by validator index.
+	Signatures [][]byte
+	// The converged voteset, which can be used to prove that consensus was reached.
+	Proof *FnVoteSet
+}
+
+func newConvergedResult(
+	voteSet *FnVoteSet, signingThreshold SigningThreshold, validatorSet *types.ValidatorSet, message []byte,
+) *ConvergedResult {
+	majResponse := voteSet.MajResponse(signingThreshold, validatorSet)
+	if majResponse == nil {
+		return nil
+	}
+	return &ConvergedResult{
+		FnID:       voteSet.GetFnID(),
+		Nonce:      voteSet.Nonce,
+		Hash:       safeCopyBytes(majResponse.Hash),
+		Message:    safeCopyBytes(message),
+		Signatures: safeCopyDoubleArray(majResponse.OracleSignatures),
+		Proof:      voteSet,
+	}
+}
+
+// ResultSubscription delivers the results converged for a single Fn, the Fn doesn't have to be
+// registered on this node, nor does the node have to be a validator. If the subscriber falls behind
+// the oldest undelivered results are dropped to make room for new ones.
+type ResultSubscription struct {
+	fnID     string
+	results  chan *ConvergedResult
+	dropped  uint64
+	once     sync.Once
+	observer *resultObserver
+}
+
+// Results returns the channel the converged results are delivered on, the channel is closed when
+// the subscription is cancelled.
+func (s *ResultSubscription) Results() <-chan *ConvergedResult {
+	return s.results
+}
+
+// Dropped returns the number of results that were dropped because the subscriber fell behind.
+func (s *ResultSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Cancel stops the delivery of results to this subscription, and closes the results channel.
+func (s *ResultSubscription) Cancel() {
+	s.once.Do(func() {
+		s.observer.unsubscribe(s)
+	})
+}
+
+// NOTE: resultObserver.mtx must be held by the caller.
+func (s *ResultSubscription) deliver(result *ConvergedResult) {
+	for {
+		select {
+		case s.results <- result:
+			return
+		default:
+		}
+
+		// Drop the oldest result to make room for the new one.
+		select {
+		case <-s.results:
+			atomic.AddUint64(&s.dropped, 1)
+			droppedResultCount.With("fnID", s.fnID).Add(1)
+		default:
+		}
+	}
+}
+
+// resultObserver fans out converged results to subscribers, and keeps track of the last result
+// for each Fn so it can be replayed to new subscribers.
+type resultObserver struct {
+	mtx           sync.Mutex
+	subscriptions map[string]map[*ResultSubscription]struct{}
+	lastResults   map[string]*ConvergedResult
+}
+
+func newResultObserver() *resultObserver {
+	return &resultObserver{
+		subscriptions: make(map[string]map[*ResultSubscription]struct{}),
+		lastResults:   make(map[string]*ConvergedResult),
+	}
+}
+
+func (o *resultObserver) subscribe(fnID string, bufferSize int, lastResult *ConvergedResult) *ResultSubscription {
+	if bufferSize <= 0 {
+		bufferSize = DefaultResultSubscriptionBufferSize
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	sub := &ResultSubscription{
+		fnID:     fnID,
+		results:  make(chan *ConvergedResult, bufferSize),
+		observer: o,
+	}
+	if o.subscriptions[fnID] == nil {
+		o.subscriptions[fnID] = make(map[*ResultSubscription]struct{})
+	}
+	o.subscriptions[fnID][sub] = struct{}{}
+
+	if last := o.lastResults[fnID]; last != nil {
+		lastResult = last
+	}
+	if lastResult != nil {
+		sub.deliver(lastResult)
+	}
+	return sub
+}
+
+func (o *resultObserver) unsubscribe(sub *ResultSubscription) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	delete(o.subscriptions[sub.fnID], sub)
+	if len(o.subscriptions[sub.fnID]) == 0 {
+		delete(o.subscriptions, sub.fnID)
+	}
+	close(sub.results)
+}
+
+func (o *resultObserver) hasSubscribers(fnID string) bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	return len(o.subscriptions[fnID]) > 0
+}
+
+// Delivers the given result to all the subscribers of the Fn, results that are older than, or the
+// same as, the last published result are ignored.
+func (o *resultObserver) publish(result *ConvergedResult) {
+	if result == nil {
+		return
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if last := o.lastResults[result.FnID]; last != nil && last.Nonce >= result.Nonce {
+		return
+	}
+	o.lastResults[result.FnID] = result
+
+	for sub := range o.subscriptions[result.FnID] {
+		sub.deliver(result)
+	}
+}
@@ -0,0 +1,142 @@
+package fnConsensus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/state"
+	"github.com/tendermint/tendermint/types"
+)
+
+// StaticValidatorSetStatus describes the static validator set built from the override validators
+// in the config, and how fresh it is relative to the TM validator set.
+type StaticValidatorSetStatus struct {
+	// The validator set the reactor currently uses for consensus.
+	ValidatorSet *types.ValidatorSet
+	// Hash of the TM validator set the override validators were last checked against.
+	TMValidatorsHash []byte
+	// When the override validators were last checked against the TM validator set.
+	ValidatedAt time.Time
+	// Override validators that don't exist in the TM validator set.
+	MissingValidators []crypto.Address
+}
+
+// StaticValidatorSet returns the status of the static validator set, or nil if the reactor uses
+// the TM validator set for consensus.
+func (f *FnConsensusReactor) StaticValidatorSet() *StaticValidatorSetStatus {
+	f.staticValidatorsMtx.RLock()
+	defer f.staticValidatorsMtx.RUnlock()
+
+	if f.staticValidators == nil {
+		return nil
+	}
+	status := f.staticValidatorsStatus
+	status.ValidatorSet = f.staticValidators.Copy()
+	status.MissingValidators = append([]crypto.Address(nil), status.MissingValidators...)
+	return &status
+}
+
+func (f *FnConsensusReactor) hasStaticValidators() bool {
+	f.staticValidatorsMtx.RLock()
+	defer f.staticValidatorsMtx.RUnlock()
+	return f.staticValidators != nil
+}
+
+// Builds a validator set from the given override validators, using the pubkeys in the given TM
+// validator set and the voting powers in the overrides. Returns the validator set built from the
+// overrides that exist in the TM validator set, and the addresses of those that don't.
+func resolveOverrideValidators(
+	overrides []*OverrideValidator, tmValidators *types.ValidatorSet,
+) (*types.ValidatorSet, []crypto.Address) {
+	validatorArray := make([]*types.Validator, 0, len(overrides))
+	var missingValidators []crypto.Address
+
+	for _, overrideValidator := range overrides {
+		// tmValidators contains the tendermint address, not the loom address.
+		validatorIndex, validator := tmValidators.GetByAddress(overrideValidator.Address)
+		if validatorIndex == -1 {
+			missingValidators = append(missingValidators, overrideValidator.Address)
+			continue
+		}
+		// We need to overwrite DPoS voting power with static one
+		// otherwise there is possibility of validator hash disagreement
+		// among nodes, if one or more nodes restarts. This happens due to
+		// recalculation of validator set on every election.
+		validator.VotingPower = overrideValidator.VotingPower
+		validatorArray = append(validatorArray, validator)
+	}
+
+	return types.NewValidatorSet(validatorArray), missingValidators
+}
+
+func missingOverrideValidatorError(address crypto.Address) error {
+	return fmt.Errorf("override validator %s doesn't exist in the TM validator set", address)
+}
+
+// Checks that all the override validators exist in the TM validator set, does nothing if the TM
+// state hasn't been populated yet (in which case initRoutine does the check once it has been).
+func (f *FnConsensusReactor) checkOverrideValidators() error {
+	if len(f.cfg.OverrideValidators) == 0 || f.tmStateDB == nil {
+		return nil
+	}
+	tmState := state.LoadState(f.tmStateDB)
+	if tmState.IsEmpty() {
+		return nil
+	}
+	_, missingValidators := resolveOverrideValidators(f.cfg.OverrideValidators, tmState.Validators)
+	if len(missingValidators) > 0 {
+		return missingOverrideValidatorError(missingValidators[0])
+	}
+	return nil
+}
+
+// Checks the override validators against the TM validator set whenever the latter changes, and
+// logs any divergence. If RefreshOverrideValidators is enabled the static validator set is rebuilt
+// from the override validators that exist in the TM validator set.
+func (f *FnConsensusReactor) revalidateOverrideValidators(now time.Time) {
+	if len(f.cfg.OverrideValidators) == 0 || f.tmStateDB == nil {
+		return
+	}
+	tmState := state.LoadState(f.tmStateDB)
+	if tmState.IsEmpty() {
+		return
+	}
+	tmValidatorsHash := tmState.Validators.Hash()
+
+	f.staticValidatorsMtx.Lock()
+	defer f.staticValidatorsMtx.Unlock()
+
+	if f.staticValidators == nil || bytes.Equal(tmValidatorsHash, f.staticValidatorsStatus.TMValidatorsHash) {
+		return
+	}
+
+	validatorSet, missingValidators := resolveOverrideValidators(f.cfg.OverrideValidators, tmState.Validators)
+	f.staticValidatorsStatus.TMValidatorsHash = tmValidatorsHash
+	f.staticValidatorsStatus.ValidatedAt = now
+	f.staticValidatorsStatus.MissingValidators = missingValidators
+	overrideValidatorsMissingGauge.Set(float64(len(missingValidators)))
+
+	if bytes.Equal(validatorSet.Hash(), f.staticValidators.Hash()) {
+		return
+	}
+
+	f.Logger.Error(
+		"FnConsensusReactor: static validator set diverged from TM validator set",
+		"missingValidators", missingValidators,
+		"validatorSetHash", hex.EncodeToString(f.staticValidators.Hash()),
+		"resolvedValidatorSetHash", hex.EncodeToString(validatorSet.Hash()),
+		"method", initValidatorSetMethodID,
+	)
+
+	if !f.cfg.RefreshOverrideValidators || validatorSet.Size() == 0 {
+		return
+	}
+	f.staticValidators = validatorSet
+	f.Logger.Info(
+		"FnConsensusReactor: refreshed static validator set from TM validator set",
+		"validatorSetHash", hex.EncodeToString(validatorSet.Hash()), "method", initValidatorSetMethodID,
+	)
+}
@@ -0,0 +1,88 @@
+package fnConsensus
+
+import (
+	"bytes"
+	"sync"
+
+	cmn "github.com/tendermint/tendermint/libs/common"
+)
+
+// peerVoteSetState tracks the votes a peer is known to have for a single Fn.
+type peerVoteSetState struct {
+	Nonce          int64
+	ValidatorsHash []byte
+	// Request of the round the votes belong to, a round that fails can be re-proposed at the same
+	// nonce, and the votes of the re-proposed round must not be mistaken for the old ones.
+	Request      FnExecutionRequest
+	VoteBitArray *cmn.BitArray
+}
+
+// Checks if the given voteset belongs to the same round as the tracked votes.
+func (s *peerVoteSetState) sameRound(voteSet *FnVoteSet) bool {
+	return s.Nonce == voteSet.Nonce && bytes.Equal(s.ValidatorsHash, voteSet.ValidatorsHash) &&
+		s.Request.CannonicalCompare(voteSet.Payload.Request)
+}
+
+// peerState tracks which votes a peer is already aware of (because the peer sent them to us, or
+// because we've sent them to the peer), similar to the PeerState in the TM consensus reactor.
+// This allows the reactor to avoid gossiping votesets to peers that already have all the votes.
+type peerState struct {
+	mtx      sync.Mutex
+	voteSets map[string]*peerVoteSetState
+}
+
+func newPeerState() *peerState {
+	return &peerState{
+		voteSets: make(map[string]*peerVoteSetState),
+	}
+}
+
+// markVoteSet records that the peer knows about all the votes in the given voteset.
+func (p *peerState) markVoteSet(voteSet *FnVoteSet) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	fnID := voteSet.GetFnID()
+	known := p.voteSets[fnID]
+	if known != nil && known.Nonce > voteSet.Nonce {
+		return
+	}
+
+	if known == nil || !known.sameRound(voteSet) {
+		p.voteSets[fnID] = &peerVoteSetState{
+			Nonce:          voteSet.Nonce,
+			ValidatorsHash: voteSet.ValidatorsHash,
+			Request:        *voteSet.Payload.Request,
+			VoteBitArray:   voteSet.VoteBitArray.Copy(),
+		}
+		return
+	}
+
+	known.VoteBitArray = known.VoteBitArray.Or(voteSet.VoteBitArray)
+}
+
+// hasVoteSet checks if the peer is already aware of all the votes in the given voteset.
+func (p *peerState) hasVoteSet(voteSet *FnVoteSet) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	known := p.voteSets[voteSet.GetFnID()]
+	if known == nil || !known.sameRound(voteSet) {
+		return false
+	}
+
+	if known.VoteBitArray.Size() != voteSet.VoteBitArray.Size() {
+		return false
+	}
+
+	return voteSet.VoteBitArray.Sub(known.VoteBitArray).IsEmpty()
+}
+
+// forgetVoteSet discards the votes the peer is known to have for the given Fn, called when the
+// current round of the Fn is dropped so the round that replaces it is gossiped to the peer.
+func (p *peerState) forgetVoteSet(fnID string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	delete(p.voteSets, fnID)
+}
@@ -2,7 +2,7 @@ package fnConsensus
 
 import (
 	"bytes"
-	"crypto/sha512"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"math/rand"
@@ -12,8 +12,10 @@ import (
 
 	"github.com/go-kit/kit/metrics"
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/pkg/errors"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	dbm "github.com/tendermint/tendermint/libs/db"
+	"github.com/tendermint/tendermint/libs/log"
 	"github.com/tendermint/tendermint/p2p"
 	"github.com/tendermint/tendermint/state"
 	"github.com/tendermint/tendermint/types"
@@ -26,6 +28,18 @@ const (
 	AllSigningThreshold   SigningThreshold = "All"
 )
 
+// Returns the minimum voting power required to reach the given signing threshold.
+func (s SigningThreshold) requiredVotingPower(totalVotingPower int64) int64 {
+	switch s {
+	case Maj23SigningThreshold:
+		return totalVotingPower*2/3 + 1
+	case AllSigningThreshold:
+		return totalVotingPower
+	default:
+		panic("unknown signing threshold")
+	}
+}
+
 // MethodIDs for tracing purpose
 const (
 	initValidatorSetMethodID  = "initValidatorSet"
@@ -33,6 +47,7 @@ const (
 	commitMethodID            = "commit"
 	maj23MsgHandlerMethodID   = "handleMaj23Msg"
 	voteSetMsgHandlerMethodID = "handleVoteSetMsg"
+	setFnEnabledMethodID      = "setFnEnabled"
 )
 
 const (
@@ -44,8 +59,10 @@ const (
 	FnVoteSetChannel = byte(0x50)
 	// FnMajChannel is used to gossip votesets that have reached 2/3+ majority
 	FnMajChannel = byte(0x51)
+	// Channel IDs below this one are left to Tendermint.
+	minChannelID = FnVoteSetChannel
 
-	// MaxMsgSize is the max number of bytes that can sent on a P2P channel
+	// MaxMsgSize is the default max number of bytes that can sent on a P2P channel
 	MaxMsgSize = 2 * 1000 * 1024 // 2MB
 
 	// Denotes interval (synced across nodes) between two proposals
@@ -57,12 +74,18 @@ const (
 
 	// Time to wait between attempts to load TM state from state.db on startup
 	progressLoopStartDelay = 2 * time.Second
+
+	// Number of attempts to persist the reactor state before the reactor enters degraded mode,
+	// and the delay before the first retry (doubled on each subsequent retry).
+	persistStateMaxAttempts = 3
+	persistStateRetryDelay  = 100 * time.Millisecond
 )
 
 type FnConsensusReactor struct {
 	p2p.BaseReactor
 
 	connectedPeers map[p2p.ID]p2p.Peer
+	peerStates     map[p2p.ID]*peerState
 	peerMapMtx     sync.RWMutex
 
 	state    *ReactorState
@@ -74,15 +97,72 @@ type FnConsensusReactor struct {
 
 	fnRegistry FnRegistry
 
-	privValidator    types.PrivValidator // used to sign votes
-	staticValidators *types.ValidatorSet // overrides the TM validator set if not nil
+	privValidator types.PrivValidator // used to sign votes
+
+	// Overrides the TM validator set if not nil, guarded by staticValidatorsMtx.
+	staticValidators       *types.ValidatorSet
+	staticValidatorsStatus StaticValidatorSetStatus
+	staticValidatorsMtx    sync.RWMutex
 
 	cfg *ReactorConfig
+
+	// Tracks the last Maj23 voteset broadcast for each fnID, guarded by stateMtx.
+	lastMaj23Broadcasts map[string]*maj23Broadcast
+	// Set when the reactor state couldn't be persisted, while the reactor is degraded it only relays
+	// votesets to peers without signing or proposing anything, guarded by stateMtx.
+	degraded bool
+
+	resultObserver *resultObserver
+
+	// Fns that have already been warned about votesets that are projected to exceed the max
+	// message size, guarded by stateMtx.
+	oversizedVoteSetFns map[string]bool
+
+	clock clock
+	// Tracks the expiry of the current voteset of each fnID with the monotonic clock, guarded by
+	// stateMtx.
+	expiryAnchors map[string]*expiryAnchor
+
+	health healthMonitor
+
+	// Node IDs of the validator peers the changed handler was last notified about, guarded by
+	// validatorPeersMtx.
+	validatorPeerIDs             []p2p.ID
+	validatorPeersChangedHandler func(peers []*ValidatorPeer)
+	validatorPeersMtx            sync.Mutex
+
+	// Set while the node is catching up with the network, guarded by syncMtx.
+	syncing            bool
+	syncStatusProvider SyncStatusProvider
+	syncMtx            sync.Mutex
+
+	// Vote latencies of the last round of each Fn that ended, guarded by stateMtx.
+	lastVoteLatencies map[string]*VoteLatencyReport
+}
+
+type maj23Broadcast struct {
+	Nonce    int64
+	MsgHash  [sha256.Size]byte
+	SentTime time.Time
 }
 
 var (
 	submittedMessageCount metrics.Counter
+	skippedProposalCount  metrics.Counter
+	conflictingMaj23Count metrics.Counter
+	persistFailureCount   metrics.Counter
+	droppedResultCount    metrics.Counter
+	invalidVoteSetCount   metrics.Counter
+	oversizedMsgCount     metrics.Counter
+	failedRoundAlertCount metrics.Counter
+	invalidMsgSizeCount   metrics.Counter
+	gcDeletedKeyCount     metrics.Counter
+	gcReclaimedBytesCount metrics.Counter
 	nonceGauge            metrics.Gauge
+	failedRoundsGauge     metrics.Gauge
+
+	connectedValidatorPeersGauge   metrics.Gauge
+	overrideValidatorsMissingGauge metrics.Gauge
 )
 
 func init() {
@@ -94,6 +174,86 @@ func init() {
 			Help:      "Number of messages successfully submitted by the validator (per fnID)",
 		}, []string{"fnID"},
 	)
+	skippedProposalCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "skipped_proposal_count",
+			Help:      "Number of proposals skipped by the validator due to insufficient reachable voting power (per fnID)",
+		}, []string{"fnID"},
+	)
+	conflictingMaj23Count = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "conflicting_maj23_count",
+			Help:      "Number of conflicting Maj23 votesets detected for the same nonce (per fnID)",
+		}, []string{"fnID"},
+	)
+	persistFailureCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "persist_failure_count",
+			Help:      "Number of failed attempts to persist the reactor state (per method)",
+		}, []string{"method"},
+	)
+	droppedResultCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "dropped_result_count",
+			Help:      "Number of converged results dropped because a subscriber fell behind (per fnID)",
+		}, []string{"fnID"},
+	)
+	invalidVoteSetCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "invalid_voteset_count",
+			Help:      "Number of votesets that failed validation (per reason)",
+		}, []string{"reason"},
+	)
+	oversizedMsgCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "oversized_message_count",
+			Help:      "Number of messages that weren't broadcast because they exceed the max message size (per channel)",
+		}, []string{"channel"},
+	)
+	failedRoundAlertCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "failed_round_alert_count",
+			Help:      "Number of times the consecutive failed rounds alert threshold was crossed (per fnID)",
+		}, []string{"fnID"},
+	)
+	invalidMsgSizeCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "invalid_message_size_count",
+			Help:      "Number of messages generated by Fns that were rejected due to their size (per fnID & reason)",
+		}, []string{"fnID", "reason"},
+	)
+	gcDeletedKeyCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "gc_deleted_key_count",
+			Help:      "Number of keys deleted from fnConsensus.db by the garbage collector (per kind)",
+		}, []string{"kind"},
+	)
+	gcReclaimedBytesCount = kitprometheus.NewCounterFrom(
+		stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "gc_reclaimed_bytes_count",
+			Help:      "Number of bytes of keys & values deleted from fnConsensus.db by the garbage collector",
+		}, []string{},
+	)
 	nonceGauge = kitprometheus.NewGaugeFrom(
 		stdprometheus.GaugeOpts{
 			Namespace: "loomchain",
@@ -102,6 +262,30 @@ func init() {
 			Help:      "Current nonce (per fnID)",
 		}, []string{"fnID"},
 	)
+	failedRoundsGauge = kitprometheus.NewGaugeFrom(
+		stdprometheus.GaugeOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "consecutive_failed_rounds",
+			Help:      "Number of consecutive voting rounds that failed to converge (per fnID)",
+		}, []string{"fnID"},
+	)
+	connectedValidatorPeersGauge = kitprometheus.NewGaugeFrom(
+		stdprometheus.GaugeOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "connected_validator_peers",
+			Help:      "Number of members of the current validator set that are directly connected to this node",
+		}, []string{},
+	)
+	overrideValidatorsMissingGauge = kitprometheus.NewGaugeFrom(
+		stdprometheus.GaugeOpts{
+			Namespace: "loomchain",
+			Subsystem: "fnConsensus",
+			Name:      "override_validators_missing",
+			Help:      "Number of override validators that don't exist in the TM validator set",
+		}, []string{},
+	)
 }
 
 func NewFnConsensusReactor(
@@ -115,15 +299,22 @@ func NewFnConsensusReactor(
 
 	reactor := &FnConsensusReactor{
 		connectedPeers: make(map[p2p.ID]p2p.Peer),
-		db:             db,
-		chainID:        chainID,
-		tmStateDB:      tmStateDB,
-		fnRegistry:     fnRegistry,
-		privValidator:  privValidator,
-		cfg:            parsedConfig,
+		peerStates:     make(map[p2p.ID]*peerState),
+
+		lastMaj23Broadcasts: make(map[string]*maj23Broadcast),
+		resultObserver:      newResultObserver(),
+		oversizedVoteSetFns: make(map[string]bool),
+		clock:               systemClock{},
+		expiryAnchors:       make(map[string]*expiryAnchor),
+		db:                  InstanceDB(db, parsedConfig.InstanceName),
+		chainID:             chainID,
+		tmStateDB:           tmStateDB,
+		fnRegistry:          fnRegistry,
+		privValidator:       privValidator,
+		cfg:                 parsedConfig,
 	}
 
-	reactor.BaseReactor = *p2p.NewBaseReactor("FnConsensusReactor", reactor)
+	reactor.BaseReactor = *p2p.NewBaseReactor(reactor.String(), reactor)
 	return reactor, nil
 }
 
@@ -150,24 +341,50 @@ func (f *FnConsensusReactor) safeGetMessageAndSignature(fn Fn) ([]byte, []byte,
 }
 
 func (f *FnConsensusReactor) String() string {
+	if f.cfg != nil && f.cfg.InstanceName != "" {
+		return fmt.Sprintf("FnConsensusReactor[%s]", f.cfg.InstanceName)
+	}
 	return "FnConsensusReactor"
 }
 
+// SetLogger implements BaseReactor, the logs of named instances include the instance name.
+func (f *FnConsensusReactor) SetLogger(l log.Logger) {
+	if f.cfg != nil && f.cfg.InstanceName != "" {
+		l = l.With("instance", f.cfg.InstanceName)
+	}
+	f.BaseReactor.SetLogger(l)
+}
+
 // OnStart implements BaseReactor by loading the previously persisted reactor state from fnConsensus.db,
-// loading the current validator set, and starting the vote & commit go-routines.
+// loading the current validator set, and starting the vote, commit & garbage collection go-routines.
 func (f *FnConsensusReactor) OnStart() error {
 	if !f.cfg.IsValidator {
 		return nil
 	}
 
-	reactorState, err := loadReactorState(f.db)
+	if err := f.checkOverrideValidators(); err != nil {
+		return err
+	}
+
+	reactorState, err := loadReactorState(f.db, f.cfg.FnVoteSigningThreshold)
 	if err != nil {
 		return err
 	}
 
 	f.state = reactorState
+	if err := f.checkInitialNonces(); err != nil {
+		return err
+	}
+	for fnID, count := range f.state.ConsecutiveFailedRounds {
+		failedRoundsGauge.With("fnID", fnID).Set(float64(count))
+		f.health.setFailedRounds(fnID, count)
+	}
+	f.health.start(time.Now())
 
 	go f.initRoutine()
+	if f.cfg.GCInterval > 0 {
+		go f.gcRoutine()
+	}
 
 	return nil
 }
@@ -177,16 +394,16 @@ func (f *FnConsensusReactor) GetChannels() []*p2p.ChannelDescriptor {
 	// Priorities are deliberately set to low, to prevent interfering with core TM
 	return []*p2p.ChannelDescriptor{
 		{
-			ID:                  FnMajChannel,
+			ID:                  f.cfg.majChannelID(),
 			Priority:            20,
 			SendQueueCapacity:   100,
-			RecvMessageCapacity: MaxMsgSize,
+			RecvMessageCapacity: f.cfg.maxMsgSize(),
 		},
 		{
-			ID:                  FnVoteSetChannel,
+			ID:                  f.cfg.voteSetChannelID(),
 			Priority:            25,
 			SendQueueCapacity:   100,
-			RecvMessageCapacity: MaxMsgSize,
+			RecvMessageCapacity: f.cfg.maxMsgSize(),
 		},
 	}
 }
@@ -195,6 +412,7 @@ func (f *FnConsensusReactor) GetChannels() []*p2p.ChannelDescriptor {
 func (f *FnConsensusReactor) AddPeer(peer p2p.Peer) {
 	f.peerMapMtx.Lock()
 	f.connectedPeers[peer.ID()] = peer
+	f.peerStates[peer.ID()] = newPeerState()
 	f.peerMapMtx.Unlock()
 }
 
@@ -204,10 +422,15 @@ func (f *FnConsensusReactor) RemovePeer(peer p2p.Peer, reason interface{}) {
 	f.peerMapMtx.Lock()
 	defer f.peerMapMtx.Unlock()
 	delete(f.connectedPeers, peer.ID())
+	delete(f.peerStates, peer.ID())
 }
 
 // Sends the given msgBytes on the given channel to all peers, with one possible exception.
 func (f *FnConsensusReactor) broadcastMsgSync(chID byte, exception *p2p.ID, msgBytes []byte) {
+	if f.isOversizedMsg(chID, msgBytes) {
+		return
+	}
+
 	f.peerMapMtx.RLock()
 	defer f.peerMapMtx.RUnlock()
 
@@ -219,6 +442,487 @@ func (f *FnConsensusReactor) broadcastMsgSync(chID byte, exception *p2p.ID, msgB
 	}
 }
 
+// Returns the nonce persisted for the given Fn, if any.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) storedNonce(fnID string) (int64, bool) {
+	nonce, ok := f.state.CurrentNonces[f.cfg.nonceKey(fnID)]
+	return nonce, ok
+}
+
+// Returns the nonce the current voting round for the given Fn should use, which is the configured
+// initial nonce if no nonce has been persisted for the Fn yet.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) currentNonce(fnID string) int64 {
+	if nonce, ok := f.storedNonce(fnID); ok {
+		return nonce
+	}
+	return f.cfg.initialNonce(fnID)
+}
+
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) setCurrentNonce(fnID string, nonce int64) {
+	f.state.CurrentNonces[f.cfg.nonceKey(fnID)] = nonce
+	nonceGauge.With("fnID", fnID).Set(float64(nonce))
+}
+
+// ConsecutiveFailedRounds returns the number of consecutive voting rounds that failed to converge
+// for the given Fn.
+func (f *FnConsensusReactor) ConsecutiveFailedRounds(fnID string) int64 {
+	f.stateMtx.Lock()
+	defer f.stateMtx.Unlock()
+
+	return f.state.ConsecutiveFailedRounds[fnID]
+}
+
+// Records a voting round that failed to converge, and raises an alert when the number of
+// consecutive failed rounds reaches the configured threshold.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) recordFailedRound(
+	fnID string, voteSet *FnVoteSet, validatorSet *types.ValidatorSet, reason string,
+) {
+	count := f.state.ConsecutiveFailedRounds[fnID] + 1
+	f.state.ConsecutiveFailedRounds[fnID] = count
+	failedRoundsGauge.With("fnID", fnID).Set(float64(count))
+	f.health.setFailedRounds(fnID, count)
+
+	if f.cfg.FailedRoundsAlertThreshold <= 0 || count != f.cfg.FailedRoundsAlertThreshold {
+		return
+	}
+
+	failedRoundAlertCount.With("fnID", fnID).Add(1)
+	keyvals := []interface{}{
+		"fnID", fnID, "nonce", voteSet.Nonce, "consecutiveFailedRounds", count, "reason", reason,
+		"method", commitMethodID,
+	}
+	keyvals = append(keyvals, voteSetParticipation(voteSet, validatorSet)...)
+	if report := f.lastVoteLatencies[fnID]; report != nil && report.Nonce == voteSet.Nonce {
+		keyvals = append(keyvals, report.keyvals()...)
+	}
+	f.Logger.Error("FnConsensusReactor: Fn has repeatedly failed to reach consensus", keyvals...)
+}
+
+// Returns log keyvals summarizing the participation of the validators in the given voteset, and
+// how much they disagreed on the message.
+func voteSetParticipation(voteSet *FnVoteSet, validatorSet *types.ValidatorSet) []interface{} {
+	votingPowerByHash := make(map[string]int64)
+	var leadingHashVotingPower int64
+	if voteSet.Payload != nil && voteSet.Payload.Response != nil {
+		for i, hash := range voteSet.Payload.Response.Hashes {
+			_, validator := validatorSet.GetByIndex(i)
+			if hash == nil || validator == nil {
+				continue
+			}
+			hashKey := hex.EncodeToString(hash)
+			votingPowerByHash[hashKey] += validator.VotingPower
+			if votingPowerByHash[hashKey] > leadingHashVotingPower {
+				leadingHashVotingPower = votingPowerByHash[hashKey]
+			}
+		}
+	}
+
+	numberOfVotes := 0
+	if isValidBitArray(voteSet.VoteBitArray) {
+		numberOfVotes = voteSet.NumberOfVotes()
+	}
+
+	return []interface{}{
+		"votes", fmt.Sprintf("%d/%d", numberOfVotes, validatorSet.Size()),
+		"votingPower", fmt.Sprintf("%d/%d", voteSet.TotalVotingPower, validatorSet.TotalVotingPower()),
+		"distinctHashes", len(votingPowerByHash),
+		"leadingHashVotingPower", leadingHashVotingPower,
+	}
+}
+
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) resetFailedRounds(fnID string) {
+	if _, ok := f.state.ConsecutiveFailedRounds[fnID]; !ok {
+		return
+	}
+	delete(f.state.ConsecutiveFailedRounds, fnID)
+	failedRoundsGauge.With("fnID", fnID).Set(0)
+	f.health.setFailedRounds(fnID, 0)
+}
+
+// Checks that none of the configured initial nonces is lower than the nonce already persisted for
+// the corresponding Fn, such a setting is either a mistake or an attempt to rewind the Fn, neither of
+// which the reactor can honour.
+func (f *FnConsensusReactor) checkInitialNonces() error {
+	for fnID, initialNonce := range f.cfg.FnInitialNonces {
+		if storedNonce, ok := f.storedNonce(fnID); ok && storedNonce > initialNonce {
+			return errors.Errorf(
+				"initial nonce %d of fn %s is lower than the persisted nonce %d", initialNonce, fnID, storedNonce,
+			)
+		}
+	}
+	return nil
+}
+
+// Peers disconnect from nodes that send them messages larger than the max message size, so such
+// messages are dropped instead of being sent.
+func (f *FnConsensusReactor) isOversizedMsg(chID byte, msgBytes []byte) bool {
+	if len(msgBytes) <= f.cfg.maxMsgSize() {
+		return false
+	}
+
+	oversizedMsgCount.With("channel", fmt.Sprintf("%#x", chID)).Add(1)
+	f.Logger.Error(
+		"FnConsensusReactor: message exceeds max message size, not broadcasting",
+		"channel", chID, "size", len(msgBytes), "maxMsgSize", f.cfg.maxMsgSize(),
+	)
+	return true
+}
+
+// Warns (once per Fn) if the voteset is projected to exceed the max message size by the time all
+// the validators have voted, which would prevent the fully signed voteset from being broadcast.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) checkProjectedVoteSetSize(voteSet *FnVoteSet, msgBytes []byte) {
+	fnID := voteSet.GetFnID()
+	numberOfVotes := voteSet.NumberOfVotes()
+	if numberOfVotes == 0 || f.oversizedVoteSetFns[fnID] {
+		return
+	}
+
+	numValidators := voteSet.VoteBitArray.Size()
+	projectedSize := len(msgBytes) / numberOfVotes * numValidators
+	if projectedSize <= f.cfg.maxMsgSize() {
+		return
+	}
+
+	f.oversizedVoteSetFns[fnID] = true
+	f.Logger.Error(
+		"FnConsensusReactor: fully signed voteset is projected to exceed max message size",
+		"fnID", fnID, "size", len(msgBytes), "votes", numberOfVotes, "validators", numValidators,
+		"projectedSize", projectedSize, "maxMsgSize", f.cfg.maxMsgSize(),
+	)
+}
+
+// Returns the time at which the message most recently generated by the Fn expires, or zero if the
+// message doesn't expire. The expiry is counted from the start of the current proposal interval,
+// so all the validators that vote during the same interval end up with the same deadline.
+func (f *FnConsensusReactor) messageExpiresAt(fn Fn, now time.Time) int64 {
+	provider, ok := fn.(ExpiryProvider)
+	if !ok {
+		return 0
+	}
+
+	expiry := provider.MessageExpiry()
+	if expiry <= 0 {
+		return 0
+	}
+	if expiry < f.cfg.MinMessageExpiry {
+		expiry = f.cfg.MinMessageExpiry
+	}
+	if expiry > f.cfg.MaxMessageExpiry {
+		expiry = f.cfg.MaxMessageExpiry
+	}
+
+	intervalStart := now.Unix() - now.Unix()%proposeIntervalInSeconds
+	return intervalStart + int64((expiry+time.Second-1)/time.Second)
+}
+
+// Persists the reactor state, retrying with a bounded backoff if the write fails. If all attempts
+// fail the reactor enters degraded mode, which it exits as soon as the state is persisted again.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) persistState(methodID string) error {
+	var err error
+	retryDelay := persistStateRetryDelay
+	for attempt := 1; attempt <= persistStateMaxAttempts; attempt++ {
+		if err = saveReactorState(f.db, f.state, true); err == nil {
+			f.health.recordPersist(time.Now(), nil)
+			if f.degraded {
+				f.Logger.Info("FnConsensusReactor: reactor state persisted, leaving degraded mode", "method", methodID)
+				f.degraded = false
+			}
+			return nil
+		}
+
+		persistFailureCount.With("method", methodID).Add(1)
+		f.Logger.Error(
+			"FnConsensusReactor: unable to save state",
+			"attempt", attempt, "err", err, "method", methodID,
+		)
+
+		if attempt < persistStateMaxAttempts {
+			time.Sleep(retryDelay)
+			retryDelay *= 2
+		}
+	}
+
+	f.health.recordPersist(time.Now(), err)
+	if !f.degraded {
+		f.Logger.Error(
+			"FnConsensusReactor: unable to save state, entering degraded mode", "err", err, "method", methodID,
+		)
+		f.degraded = true
+	}
+	return err
+}
+
+// Returns the IDs of the enabled Fns that don't have a voting round in progress, sorted by fnID.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) fnsEligibleForVoting() []string {
+	fnIDs := f.fnRegistry.GetAll()
+	sort.Strings(fnIDs)
+
+	fnsEligibleForVoting := make([]string, 0, len(fnIDs))
+	for _, fnID := range fnIDs {
+		if !f.state.IsFnEnabled(fnID) {
+			continue
+		}
+		currentVoteState := f.state.CurrentVoteSets[fnID]
+		if currentVoteState != nil {
+			f.Logger.Info("FnConsensusReactor: unable to vote, execution is in progress", "FnID", fnID)
+			continue
+		}
+		fnsEligibleForVoting = append(fnsEligibleForVoting, fnID)
+	}
+	return fnsEligibleForVoting
+}
+
+// FnStatus describes the state of a Fn on this node.
+type FnStatus struct {
+	FnID string `json:"fn_id"`
+	// False if the Fn has been disabled via SetFnEnabled.
+	Enabled bool `json:"enabled"`
+	// False if the Fn has been disabled but isn't registered on this node anymore.
+	Registered bool `json:"registered"`
+	// Nonce of the voting round the Fn is on.
+	Nonce                   int64 `json:"nonce"`
+	ConsecutiveFailedRounds int64 `json:"consecutive_failed_rounds"`
+}
+
+// FnStatuses returns the status of the Fns registered on this node, and of the Fns that have been
+// disabled, sorted by fnID. Fails with ErrReactorStateNotLoaded if the node isn't a validator, or the
+// reactor hasn't been started yet.
+func (f *FnConsensusReactor) FnStatuses() ([]*FnStatus, error) {
+	f.stateMtx.Lock()
+	defer f.stateMtx.Unlock()
+
+	if f.state == nil {
+		return nil, ErrReactorStateNotLoaded
+	}
+
+	registered := make(map[string]bool)
+	for _, fnID := range f.fnRegistry.GetAll() {
+		registered[fnID] = true
+	}
+	fnIDs := make([]string, 0, len(registered)+len(f.state.DisabledFns))
+	for fnID := range registered {
+		fnIDs = append(fnIDs, fnID)
+	}
+	for fnID := range f.state.DisabledFns {
+		if !registered[fnID] {
+			fnIDs = append(fnIDs, fnID)
+		}
+	}
+	sort.Strings(fnIDs)
+
+	statuses := make([]*FnStatus, 0, len(fnIDs))
+	for _, fnID := range fnIDs {
+		statuses = append(statuses, &FnStatus{
+			FnID:                    fnID,
+			Enabled:                 f.state.IsFnEnabled(fnID),
+			Registered:              registered[fnID],
+			Nonce:                   f.currentNonce(fnID),
+			ConsecutiveFailedRounds: f.state.ConsecutiveFailedRounds[fnID],
+		})
+	}
+	return statuses, nil
+}
+
+// SetFnEnabled enables or disables a Fn, the reactor doesn't vote on disabled Fns, nor does it sign
+// votesets it receives for them, but it does keep track of their nonces so they resume at the same
+// nonce as the other validators when re-enabled. The setting is persisted in the reactor state.
+func (f *FnConsensusReactor) SetFnEnabled(fnID string, enabled bool) error {
+	f.stateMtx.Lock()
+	defer f.stateMtx.Unlock()
+
+	if f.state == nil {
+		return ErrReactorStateNotLoaded
+	}
+
+	f.state.setFnEnabled(fnID, enabled)
+	f.Logger.Info("FnConsensusReactor: Fn enabled setting changed", "fnID", fnID, "enabled", enabled)
+	return f.persistState(setFnEnabledMethodID)
+}
+
+// UnsafeSetFnEnabled is the admin RPC version of SetFnEnabled, it returns the updated status of the Fn.
+func (f *FnConsensusReactor) UnsafeSetFnEnabled(fnID string, enabled bool) (*FnStatus, error) {
+	if err := f.SetFnEnabled(fnID, enabled); err != nil {
+		return nil, err
+	}
+	statuses, err := f.FnStatuses()
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if status.FnID == fnID {
+			return status, nil
+		}
+	}
+	// Enabling a Fn that isn't registered on this node.
+	return &FnStatus{FnID: fnID, Enabled: true}, nil
+}
+
+// IsFnEnabled returns false if the Fn has been disabled via SetFnEnabled.
+func (f *FnConsensusReactor) IsFnEnabled(fnID string) bool {
+	f.stateMtx.Lock()
+	defer f.stateMtx.Unlock()
+
+	return f.state == nil || f.state.IsFnEnabled(fnID)
+}
+
+// IsDegraded returns true if the reactor is unable to persist its state, in which case it will only
+// relay messages between peers.
+func (f *FnConsensusReactor) IsDegraded() bool {
+	f.stateMtx.Lock()
+	defer f.stateMtx.Unlock()
+	return f.degraded
+}
+
+// Healthy returns an *UnhealthyError listing the reasons the reactor isn't making progress, or nil
+// if the reactor is healthy. Non-validator nodes are always considered healthy. This doesn't acquire
+// the state mutex, so it can be used to detect a wedged reactor.
+func (f *FnConsensusReactor) Healthy() error {
+	if !f.cfg.IsValidator {
+		return nil
+	}
+	return f.health.check(time.Now(), f.cfg.FailedRoundsAlertThreshold)
+}
+
+// Returns the voting power of the validators that are reachable via the currently connected peers,
+// including our own voting power.
+func (f *FnConsensusReactor) reachableVotingPower(currentValidators *types.ValidatorSet, ownValidatorIndex int) int64 {
+	reachable := make(map[int]bool)
+	reachable[ownValidatorIndex] = true
+
+	f.peerMapMtx.RLock()
+	for peerID := range f.connectedPeers {
+		validatorAddress, ok := f.cfg.ValidatorPeers[peerID]
+		if !ok {
+			continue
+		}
+		if validatorIndex, _ := currentValidators.GetByAddress(validatorAddress); validatorIndex != -1 {
+			reachable[validatorIndex] = true
+		}
+	}
+	f.peerMapMtx.RUnlock()
+
+	var votingPower int64
+	for validatorIndex := range reachable {
+		_, validator := currentValidators.GetByIndex(validatorIndex)
+		votingPower += validator.VotingPower
+	}
+	return votingPower
+}
+
+// Checks if the validators reachable via the currently connected peers can possibly reach the
+// signing threshold, there's no point proposing if they can't because the round will time out.
+func (f *FnConsensusReactor) canReachQuorum(currentValidators *types.ValidatorSet, ownValidatorIndex int) bool {
+	if !f.cfg.RequireReachableQuorum {
+		return true
+	}
+
+	reachablePower := f.reachableVotingPower(currentValidators, ownValidatorIndex)
+	requiredPower := f.cfg.FnVoteSigningThreshold.requiredVotingPower(currentValidators.TotalVotingPower())
+	if reachablePower < requiredPower {
+		f.Logger.Info(
+			"FnConsensusReactor: skipping proposal, reachable voting power is below signing threshold",
+			"reachablePower", reachablePower, "requiredPower", requiredPower, "method", voteMethodID,
+		)
+		return false
+	}
+	return true
+}
+
+// Sends the given voteset on the voteset channel to all peers that aren't already aware of all the
+// votes it contains, with one possible exception.
+func (f *FnConsensusReactor) broadcastVoteSetSync(exception *p2p.ID, voteSet *FnVoteSet, msgBytes []byte) {
+	f.checkProjectedVoteSetSize(voteSet, msgBytes)
+	if f.isOversizedMsg(f.cfg.voteSetChannelID(), msgBytes) {
+		return
+	}
+
+	f.peerMapMtx.RLock()
+	defer f.peerMapMtx.RUnlock()
+
+	for peerID, peer := range f.connectedPeers {
+		if exception != nil && (*exception) == peerID {
+			continue
+		}
+		ps := f.peerStates[peerID]
+		if ps != nil && ps.hasVoteSet(voteSet) {
+			continue
+		}
+		if peer.Send(f.cfg.voteSetChannelID(), msgBytes) && ps != nil {
+			ps.markVoteSet(voteSet)
+		}
+	}
+}
+
+// Broadcasts the given Maj23 voteset on the Maj23 channel, unless an identical voteset has already
+// been broadcast within the configured rebroadcast interval.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) broadcastMaj23VoteSet(exception *p2p.ID, voteSet *FnVoteSet, msgBytes []byte) {
+	fnID := voteSet.GetFnID()
+	msgHash := sha256.Sum256(msgBytes)
+	now := time.Now()
+
+	if f.cfg.Maj23RebroadcastInterval > 0 {
+		last := f.lastMaj23Broadcasts[fnID]
+		if last != nil && last.Nonce == voteSet.Nonce && last.MsgHash == msgHash &&
+			now.Sub(last.SentTime) < f.cfg.Maj23RebroadcastInterval {
+			f.Logger.Debug(
+				"FnConsensusReactor: suppressing rebroadcast of Maj23 voteset",
+				"fnID", fnID, "nonce", voteSet.Nonce,
+			)
+			return
+		}
+	}
+
+	f.lastMaj23Broadcasts[fnID] = &maj23Broadcast{
+		Nonce:    voteSet.Nonce,
+		MsgHash:  msgHash,
+		SentTime: now,
+	}
+	f.broadcastMsgSync(f.cfg.majChannelID(), exception, msgBytes)
+}
+
+// Records that the given peer is aware of all the votes in the given voteset.
+func (f *FnConsensusReactor) markPeerVoteSet(peerID p2p.ID, voteSet *FnVoteSet) {
+	f.peerMapMtx.RLock()
+	ps := f.peerStates[peerID]
+	f.peerMapMtx.RUnlock()
+
+	if ps != nil {
+		ps.markVoteSet(voteSet)
+	}
+}
+
+// Discards the votes all peers are known to have for the given Fn, must be called whenever the current
+// round of the Fn is dropped without the nonce moving forward, otherwise the round re-proposed at the
+// same nonce may never be gossiped to peers that were sent the dropped one.
+func (f *FnConsensusReactor) forgetPeerVoteSets(fnID string) {
+	f.peerMapMtx.RLock()
+	defer f.peerMapMtx.RUnlock()
+
+	for _, ps := range f.peerStates {
+		ps.forgetVoteSet(fnID)
+	}
+}
+
+// Logs & counts a voteset that failed validation, err should be the error returned by FnVoteSet.IsValid.
+func (f *FnConsensusReactor) rejectVoteSet(msg string, err error, methodID string, keyvals ...interface{}) {
+	reason := invalidVoteSetReason(err)
+	invalidVoteSetCount.With("reason", string(reason)).Add(1)
+
+	keyvals = append(keyvals, "reason", reason, "err", err, "method", methodID)
+	if invalidErr, ok := err.(*InvalidVoteSetError); ok && invalidErr.ValidatorIndex >= 0 {
+		keyvals = append(keyvals, "validatorIndex", invalidErr.ValidatorIndex)
+	}
+	f.Logger.Error(msg, keyvals...)
+}
+
 func (f *FnConsensusReactor) myAddress() []byte {
 	return f.privValidator.GetPubKey().Address()
 }
@@ -228,43 +932,74 @@ func (f *FnConsensusReactor) areWeValidator(currentValidatorSet *types.Validator
 	return validatorIndex != -1, validatorIndex
 }
 
-func calculateMessageHash(message []byte) ([]byte, error) {
-	hash := sha512.New()
-	_, err := hash.Write(message)
-	if err != nil {
-		return nil, err
+// Checks that the message generated by the given Fn is within the configured size limits.
+func (f *FnConsensusReactor) checkMessageSize(fnID string, message []byte) error {
+	limits := f.cfg.messageSizeLimits(fnID)
+	if len(message) < limits.Min {
+		invalidMsgSizeCount.With("fnID", fnID, "reason", "too_small").Add(1)
+		return errors.Wrapf(ErrFnMessageTooSmall, "size: %d, min: %d", len(message), limits.Min)
 	}
-	return hash.Sum(nil), nil
+	if limits.Max > 0 && len(message) > limits.Max {
+		invalidMsgSizeCount.With("fnID", fnID, "reason", "too_large").Add(1)
+		return errors.Wrapf(ErrFnMessageTooLarge, "size: %d, max: %d", len(message), limits.Max)
+	}
+	return nil
+}
+
+// Returns the algorithm that should be used to hash messages generated by the given Fn.
+func (f *FnConsensusReactor) hashAlgorithm(fnID string, fn Fn) HashAlgorithm {
+	if provider, ok := fn.(HashAlgorithmProvider); ok {
+		return provider.HashAlgorithm().Normalize()
+	}
+	return f.cfg.FnHashAlgorithms[fnID].Normalize()
+}
+
+// Checks that the given voteset was hashed with the same algorithm this node uses for the Fn,
+// otherwise our hashes can never match those in the voteset.
+func (f *FnConsensusReactor) validateHashAlgorithm(voteSet *FnVoteSet) error {
+	fnID := voteSet.GetFnID()
+	expected := f.hashAlgorithm(fnID, f.fnRegistry.Get(fnID))
+	actual := voteSet.Payload.Response.HashAlgorithm.Normalize()
+	if expected != actual {
+		return errors.Wrapf(ErrFnVoteHashAlgorithmMismatch, "expected: %s, got: %s", expected, actual)
+	}
+	return nil
 }
 
-func calculateSleepTimeForCommit(areWeValidator bool) time.Duration {
-	currentEpochTime := time.Now().Unix()
-	baseTimeToSleep := commitIntervalInSeconds - currentEpochTime%commitIntervalInSeconds
+// Returns the time left until the start of the next slot of the given length, the wall clock is only
+// read once to find the slot boundary, timers armed with the result run off the monotonic clock so
+// they aren't affected by the wall clock being stepped while they're running.
+func timeUntilNextSlot(now time.Time, intervalInSeconds int64) time.Duration {
+	interval := time.Duration(intervalInSeconds) * time.Second
+	return interval - time.Duration(now.UnixNano()%int64(interval))
+}
+
+func calculateSleepTimeForCommit(now time.Time, areWeValidator bool) time.Duration {
+	baseTimeToSleep := timeUntilNextSlot(now, commitIntervalInSeconds)
 
 	const maxBoundForVariableComponent = 2 * time.Second
 	const baseCommitDelay = 100 * time.Millisecond
 
 	if !areWeValidator {
-		return (time.Duration(baseTimeToSleep) * time.Second) + baseCommitDelay
+		return baseTimeToSleep + baseCommitDelay
 	}
 
-	return (time.Duration(baseTimeToSleep) * time.Second) +
+	return baseTimeToSleep +
 		time.Duration(rand.Int63n(int64(maxBoundForVariableComponent))) +
 		baseCommitDelay
 }
 
-func calculateSleepTimeForPropose(areWeValidator bool) time.Duration {
-	currentEpochTime := time.Now().Unix()
-	baseTimeToSleep := proposeIntervalInSeconds - currentEpochTime%proposeIntervalInSeconds
+func calculateSleepTimeForPropose(now time.Time, areWeValidator bool) time.Duration {
+	baseTimeToSleep := timeUntilNextSlot(now, proposeIntervalInSeconds)
 
 	const baseProposalDelay = 500 * time.Millisecond
 	const maxBoundForVariableComponent = 2 * time.Second
 
 	if !areWeValidator {
-		return (time.Duration(baseTimeToSleep) * time.Second) + baseProposalDelay
+		return baseTimeToSleep + baseProposalDelay
 	}
 
-	return (time.Duration(baseTimeToSleep) * time.Second) +
+	return baseTimeToSleep +
 		time.Duration(rand.Int63n(int64(maxBoundForVariableComponent))) +
 		baseProposalDelay
 }
@@ -276,42 +1011,43 @@ func (f *FnConsensusReactor) initValidatorSet(tmState state.State) error {
 		return nil
 	}
 
-	validatorArray := make([]*types.Validator, 0, len(f.cfg.OverrideValidators))
-
-	for _, overrideValidator := range f.cfg.OverrideValidators {
-		// tmState.Validators is the tendermint address, not the loom address.
-		validatorIndex, validator := tmState.Validators.GetByAddress(overrideValidator.Address)
-		if validatorIndex == -1 {
-			return fmt.Errorf("validator specified in override config, doesnt exist in TM validator set")
-		}
-		// We need to overwrite DPoS voting power with static one
-		// otherwise there is possibility of validator hash disagreement
-		// among nodes, if one or more nodes restarts. This happens due to
-		// recalculation of validator set on every election.
-		validator.VotingPower = overrideValidator.VotingPower
+	validatorSet, missingValidators := resolveOverrideValidators(f.cfg.OverrideValidators, tmState.Validators)
+	if len(missingValidators) > 0 {
+		return missingOverrideValidatorError(missingValidators[0])
+	}
 
+	for _, validator := range validatorSet.Validators {
 		f.Logger.Info("FnConsensusReactor: adding validator to static validator set", "validator", validator.String(),
 			"method", initValidatorSetMethodID)
-
-		validatorArray = append(validatorArray, validator)
 	}
 
-	f.staticValidators = types.NewValidatorSet(validatorArray)
+	f.staticValidatorsMtx.Lock()
+	f.staticValidators = validatorSet
+	f.staticValidatorsStatus = StaticValidatorSetStatus{
+		TMValidatorsHash: tmState.Validators.Hash(),
+		ValidatedAt:      time.Now(),
+	}
+	f.staticValidatorsMtx.Unlock()
+	overrideValidatorsMissingGauge.Set(0)
 
 	f.Logger.Info("FnConsensusReactor: using static validator set for consensus", "validatorSetHash",
-		hex.EncodeToString(f.staticValidators.Hash()),
+		hex.EncodeToString(validatorSet.Hash()),
 		"method", initValidatorSetMethodID)
 
 	return nil
 }
 
 func (f *FnConsensusReactor) getValidatorSet() *types.ValidatorSet {
-	if f.staticValidators == nil {
+	f.staticValidatorsMtx.RLock()
+	staticValidators := f.staticValidators
+	f.staticValidatorsMtx.RUnlock()
+
+	if staticValidators == nil {
 		tmState := state.LoadState(f.tmStateDB)
 		return tmState.Validators
 	}
 
-	return f.staticValidators
+	return staticValidators
 }
 
 func (f *FnConsensusReactor) initRoutine() {
@@ -346,7 +1082,7 @@ func (f *FnConsensusReactor) commitRoutine() {
 
 OUTER_LOOP:
 	for {
-		commitSleepTime := calculateSleepTimeForCommit(areWeValidator)
+		commitSleepTime := calculateSleepTimeForCommit(time.Now(), areWeValidator)
 		commitTimer := time.NewTimer(commitSleepTime)
 
 		select {
@@ -354,15 +1090,20 @@ OUTER_LOOP:
 			commitTimer.Stop()
 			break OUTER_LOOP
 		case <-commitTimer.C:
+			f.health.heartbeat(commitMethodID, time.Now())
 			fnIDs := f.fnRegistry.GetAll()
 			sort.Strings(fnIDs)
 
 			fnsEligibleForCommit := make([]string, 0, len(fnIDs))
 
 			f.stateMtx.Lock()
+			if f.degraded && f.persistState(commitMethodID) != nil {
+				f.stateMtx.Unlock()
+				break
+			}
 			for _, fnID := range fnIDs {
 				currentVoteState := f.state.CurrentVoteSets[fnID]
-				if currentVoteState == nil {
+				if currentVoteState == nil || !f.state.IsFnEnabled(fnID) {
 					continue
 				}
 				fnsEligibleForCommit = append(fnsEligibleForCommit, fnID)
@@ -393,7 +1134,7 @@ OUTER_LOOP:
 		// Align to minutes, to make sure this routine runs at almost same time across all nodes
 		// Not strictly required
 		// state and other variables will be same as the one initialized in second case statement
-		proposeSleepTime := calculateSleepTimeForPropose(areWeValidator)
+		proposeSleepTime := calculateSleepTimeForPropose(time.Now(), areWeValidator)
 		proposeTimer := time.NewTimer(proposeSleepTime)
 
 		select {
@@ -401,40 +1142,51 @@ OUTER_LOOP:
 			proposeTimer.Stop()
 			break OUTER_LOOP
 		case <-proposeTimer.C:
+			f.health.heartbeat(voteMethodID, time.Now())
+			f.revalidateOverrideValidators(time.Now())
 			currentValidators := f.getValidatorSet()
 			areWeValidator, ownValidatorIndex := f.areWeValidator(currentValidators)
+			f.refreshValidatorPeers(currentValidators)
 
-			if !areWeValidator {
+			if !areWeValidator || f.isCatchingUp(time.Now()) {
 				break
 			}
 
-			fnIDs := f.fnRegistry.GetAll()
-			sort.Strings(fnIDs)
-
-			fnsEligibleForVoting := make([]string, 0, len(fnIDs))
-
 			f.stateMtx.Lock()
-			for _, fnID := range fnIDs {
-				currentVoteState := f.state.CurrentVoteSets[fnID]
-				if currentVoteState != nil {
-					f.Logger.Info("FnConsensusReactor: unable to vote, execution is in progress", "FnID", fnID)
-					continue
-				}
-				fnsEligibleForVoting = append(fnsEligibleForVoting, fnID)
+			if f.degraded {
+				f.stateMtx.Unlock()
+				f.Logger.Error("FnConsensusReactor: unable to vote, reactor is degraded", "method", voteMethodID)
+				break
 			}
+			fnsEligibleForVoting := f.fnsEligibleForVoting()
 			f.stateMtx.Unlock()
 
-			for _, fnID := range fnsEligibleForVoting {
-				fn := f.fnRegistry.Get(fnID)
-				f.vote(fnID, fn, currentValidators, ownValidatorIndex)
-			}
+			f.propose(fnsEligibleForVoting, currentValidators, ownValidatorIndex)
+		}
+	}
+}
+
+// Votes on each of the given Fns, unless the validators reachable via the currently connected peers
+// can't reach the signing threshold, in which case the proposals are skipped.
+func (f *FnConsensusReactor) propose(fnIDs []string, currentValidators *types.ValidatorSet, ownValidatorIndex int) {
+	if !f.canReachQuorum(currentValidators, ownValidatorIndex) {
+		for _, fnID := range fnIDs {
+			skippedProposalCount.With("fnID", fnID).Add(1)
 		}
+		return
+	}
+
+	for _, fnID := range fnIDs {
+		fn := f.fnRegistry.Get(fnID)
+		f.vote(fnID, fn, currentValidators, ownValidatorIndex)
 	}
 }
 
 // Creates a vote signed by the validator corresponding to the given index and broadcasts it to all peers.
 func (f *FnConsensusReactor) vote(fnID string, fn Fn, currentValidators *types.ValidatorSet, validatorIndex int) {
+	executionStartedAt := time.Now()
 	message, signature, err := f.safeGetMessageAndSignature(fn)
+	executionTime := time.Since(executionStartedAt)
 	if err != nil {
 		f.Logger.Error(
 			"FnConsensusReactor: received error while executing fn.GetMessageAndSignature",
@@ -442,8 +1194,16 @@ func (f *FnConsensusReactor) vote(fnID string, fn Fn, currentValidators *types.V
 		)
 		return
 	}
+	if err := f.checkMessageSize(fnID, message); err != nil {
+		f.Logger.Error(
+			"FnConsensusReactor: fn.GetMessageAndSignature returned a message of invalid size",
+			"fnID", fnID, "err", err, "method", voteMethodID,
+		)
+		return
+	}
 
-	hash, err := calculateMessageHash(message)
+	hashAlgorithm := f.hashAlgorithm(fnID, fn)
+	hash, err := calculateMessageHash(hashAlgorithm, message)
 	if err != nil {
 		f.Logger.Error(
 			"FnConsensusReactor: unable to calculate message hash",
@@ -460,10 +1220,12 @@ func (f *FnConsensusReactor) vote(fnID string, fn Fn, currentValidators *types.V
 		)
 		return
 	}
+	executionRequest.ExpiresAt = f.messageExpiresAt(fn, f.clock.Now())
 
 	executionResponse := NewFnExecutionResponse(&FnIndividualExecutionResponse{
 		Hash:            hash,
 		OracleSignature: signature, // TODO: reactor shouldn't know anything about oracles
+		HashAlgorithm:   hashAlgorithm.voteValue(),
 	}, validatorIndex, currentValidators)
 
 	f.stateMtx.Lock()
@@ -474,18 +1236,20 @@ func (f *FnConsensusReactor) vote(fnID string, fn Fn, currentValidators *types.V
 		Hash:    hash,
 	}
 
-	currentNonce, ok := f.state.CurrentNonces[fnID]
-	if !ok {
-		currentNonce = 1
-	}
+	currentNonce := f.currentNonce(fnID)
 
-	voteSet, err := NewVoteSet(
+	var quorumParams *QuorumParams
+	if f.cfg.EmbedQuorumParams {
+		quorumParams = NewQuorumParams(f.cfg.FnVoteSigningThreshold, currentValidators)
+	}
+	voteSet, err := newVoteSet(
 		currentNonce,
 		f.chainID,
 		validatorIndex,
 		NewFnVotePayload(executionRequest, executionResponse),
 		f.privValidator,
 		currentValidators,
+		quorumParams,
 	)
 	if err != nil {
 		f.Logger.Error(
@@ -494,6 +1258,7 @@ func (f *FnConsensusReactor) vote(fnID string, fn Fn, currentValidators *types.V
 		)
 		return
 	}
+	f.traceExecution(executionRequest, currentNonce, message, hash, hashAlgorithm, executionStartedAt, executionTime)
 
 	// Have we achieved Maj23 already?
 	aggregateExecutionResponse := voteSet.MajResponse(f.cfg.FnVoteSigningThreshold, currentValidators)
@@ -515,12 +1280,13 @@ func (f *FnConsensusReactor) vote(fnID string, fn Fn, currentValidators *types.V
 	}
 
 	f.state.CurrentVoteSets[fnID] = voteSet
+	f.expiryAnchors[fnID] = newExpiryAnchor(f.clock, executionRequest.ExpiresAt)
+	f.observeVotes(voteSet, time.Now())
 
-	if err := saveReactorState(f.db, f.state, true); err != nil {
-		f.Logger.Error(
-			"FnConsensusReactor: unable to save state",
-			"fnID", fnID, "err", err, "method", voteMethodID,
-		)
+	if err := f.persistState(voteMethodID); err != nil {
+		// The vote can't be broadcast until the voteset it was added to is persisted.
+		delete(f.state.CurrentVoteSets, fnID)
+		f.forgetPeerVoteSets(fnID)
 		return
 	}
 
@@ -536,7 +1302,19 @@ func (f *FnConsensusReactor) vote(fnID string, fn Fn, currentValidators *types.V
 	// NOTE: f.state is still locked at this point, so until the broadcast is complete we won't be able
 	// to receive any votesets from anyone else because both handleVoteSetChannelMessage and
 	// handleMaj23VoteSetChannel must acquire the f.state lock before they can do anything of substance.
-	f.broadcastMsgSync(FnVoteSetChannel, nil, marshalledBytes)
+	f.broadcastVoteSetSync(nil, voteSet, marshalledBytes)
+}
+
+// Checks if the given current voteset of a Fn has expired, the monotonic clock is used if the voteset
+// was created or adopted since the node started, so stepping the wall clock mid-round doesn't make the
+// node drop the round early, nor hold on to it after it expired.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) isVoteSetExpired(fnID string, voteSet *FnVoteSet) bool {
+	anchor := f.expiryAnchors[fnID]
+	if anchor == nil || anchor.expiresAt != voteSet.Payload.Request.ExpiresAt {
+		return voteSet.IsExpired(f.clock.Now())
+	}
+	return anchor.isExpired(f.clock)
 }
 
 // Checks if the signing threshold has been reached (2/3+ majority usually) in the current voteset,
@@ -559,26 +1337,40 @@ func (f *FnConsensusReactor) commit(fnID string) {
 	currentValidators := f.getValidatorSet()
 	areWeValidator, ownValidatorIndex := f.areWeValidator(currentValidators)
 
+	// Votes that arrive after the voteset converged keep being merged into it until this point, the
+	// voteset is only merged into while stateMtx is held, so from here on it won't change until it's
+	// been submitted & archived.
 	f.stateMtx.Lock()
 	defer f.stateMtx.Unlock()
 
 	currentVoteSet := f.state.CurrentVoteSets[fnID]
-	currentNonce := f.state.CurrentNonces[fnID]
+	currentNonce := f.currentNonce(fnID)
 
 	if err := currentVoteSet.IsValid(f.chainID, currentValidators, f.fnRegistry); err != nil {
-		f.Logger.Error(
-			"FnConsensusReactor: Invalid VoteSet found",
-			"VoteSet", currentVoteSet, "err", err, "method", commitMethodID)
+		f.rejectVoteSet("FnConsensusReactor: Invalid VoteSet found", err, commitMethodID, "VoteSet", currentVoteSet)
 
 		delete(f.state.CurrentVoteSets, fnID)
+		f.forgetPeerVoteSets(fnID)
+		f.endVoteObservation(fnID, currentValidators)
+		f.recordFailedRound(fnID, currentVoteSet, currentValidators, "invalid")
 
-		if err := saveReactorState(f.db, f.state, true); err != nil {
-			f.Logger.Error(
-				"FnConsensusReactor: unable to save state",
-				"fnID", fnID, "err", err, "method", commitMethodID,
-			)
-			return
-		}
+		// Failures are logged, and put the reactor in degraded mode until the state is persisted.
+		f.persistState(commitMethodID)
+		return
+	}
+
+	if f.isVoteSetExpired(fnID, currentVoteSet) {
+		f.Logger.Error(
+			"FnConsensusReactor: VoteSet expired before it could be committed",
+			"fnID", fnID, "nonce", currentNonce, "expiresAt", currentVoteSet.Payload.Request.ExpiresAt,
+			"method", commitMethodID,
+		)
+		delete(f.state.CurrentVoteSets, fnID)
+		f.forgetPeerVoteSets(fnID)
+		f.endVoteObservation(fnID, currentValidators)
+		f.recordFailedRound(fnID, currentVoteSet, currentValidators, "expired")
+		f.traceDecision(fnID, currentNonce, nil)
+		f.persistState(commitMethodID)
 		return
 	}
 
@@ -588,9 +1380,23 @@ func (f *FnConsensusReactor) commit(fnID string) {
 			"fnID", fnID, "VoteSet", currentVoteSet, "Payload", currentVoteSet.Payload,
 			"Response", currentVoteSet.Payload.Response, "method", commitMethodID,
 		)
+		f.endVoteObservation(fnID, currentValidators)
+		f.recordFailedRound(fnID, currentVoteSet, currentValidators, "not_converged")
+		f.traceDecision(fnID, currentNonce, nil)
+
+		// A summary older than the previous round is left over from before a fast-forward, there's
+		// no point in propagating it.
+		previousMaj23Summary := f.state.PreviousMaj23Summaries[fnID]
+		if previousMaj23Summary != nil && previousMaj23Summary.Nonce == currentNonce-1 {
+			previousConvergedVoteSet, err := loadMaj23VoteSet(f.db, fnID, previousMaj23Summary.Nonce)
+			if err != nil || previousConvergedVoteSet == nil {
+				f.Logger.Error(
+					"unable to load PreviousMajVoteSet from archive",
+					"err", err, "fnID", fnID, "nonce", previousMaj23Summary.Nonce, "method", commitMethodID,
+				)
+				return
+			}
 
-		previousConvergedVoteSet := f.state.PreviousMajVoteSets[fnID]
-		if previousConvergedVoteSet != nil {
 			marshalledBytesOfPreviousVoteSet, err := previousConvergedVoteSet.Marshal()
 			if err != nil {
 				f.Logger.Error(
@@ -610,12 +1416,12 @@ func (f *FnConsensusReactor) commit(fnID string) {
 			}
 
 			// Propagate your last Maj23, to remedy any issue
-			f.broadcastMsgSync(FnMajChannel, nil, marshalledBytesOfPreviousVoteSet)
+			f.broadcastMaj23VoteSet(nil, previousConvergedVoteSet, marshalledBytesOfPreviousVoteSet)
 
 			time.Sleep(voteSetPropogationDelay)
 
 			// Propagate your current voteSet, to get newly joined node to sign it
-			f.broadcastMsgSync(FnVoteSetChannel, nil, marshalledBytesOfCurrentVoteSet)
+			f.broadcastVoteSetSync(nil, currentVoteSet, marshalledBytesOfCurrentVoteSet)
 		}
 	} else {
 		if areWeValidator {
@@ -639,6 +1445,13 @@ func (f *FnConsensusReactor) commit(fnID string) {
 						)
 						return
 					}
+					if err := currentVoteSet.checkAgreeSignatures(majExecutionResponse); err != nil {
+						f.Logger.Error(
+							"FnConsensusReactor: inconsistent agree signatures",
+							"fnID", fnID, "method", commitMethodID, "nonce", currentNonce, "err", err,
+						)
+						return
+					}
 					f.Logger.Info("FnConsensusReactor: Submitting Multisigned message")
 					f.safeSubmitMultiSignedMessage(
 						fnID,
@@ -650,17 +1463,90 @@ func (f *FnConsensusReactor) commit(fnID string) {
 			}
 		}
 
-		f.state.CurrentNonces[fnID]++
-		nonceGauge.With("fnID", fnID).Set(float64(f.state.CurrentNonces[fnID]))
+		if err := saveMaj23VoteSet(f.db, currentVoteSet); err != nil {
+			f.Logger.Error(
+				"FnConsensusReactor: unable to archive Maj23 voteset",
+				"fnID", fnID, "err", err, "method", commitMethodID,
+			)
+			return
+		}
+
+		f.setCurrentNonce(fnID, currentNonce+1)
 		f.state.PreviousValidatorSet = currentValidators
-		f.state.PreviousMajVoteSets[fnID] = currentVoteSet
+		f.state.PreviousMaj23Summaries[fnID] = NewMaj23Summary(
+			currentVoteSet, f.cfg.FnVoteSigningThreshold, currentValidators,
+		)
 		delete(f.state.CurrentVoteSets, fnID)
+		f.endVoteObservation(fnID, currentValidators)
+		f.resetFailedRounds(fnID)
+
+		result := newConvergedResult(currentVoteSet, f.cfg.FnVoteSigningThreshold, currentValidators, nil)
+		if result != nil && bytes.Equal(f.state.Messages[fnID].Hash, result.Hash) {
+			result.Message = safeCopyBytes(f.state.Messages[fnID].Payload)
+		}
+		f.resultObserver.publish(result)
+
+		var majorityHash []byte
+		if result != nil {
+			majorityHash = result.Hash
+		}
+		f.traceDecision(fnID, currentNonce, majorityHash)
 	}
 
-	if err := saveReactorState(f.db, f.state, true); err != nil {
-		f.Logger.Error("FnConsensusReactor: unable to save state", "fnID", fnID, "err", err, "method", commitMethodID)
+	f.persistState(commitMethodID)
+}
+
+// Persists evidence of two different votesets reaching the signing threshold for the same fnID
+// and nonce. The locally stored voteset is never overwritten by the conflicting one.
+func (f *FnConsensusReactor) recordConflictingMaj23VoteSet(
+	localSummary *Maj23Summary, remoteSummary *Maj23Summary, remoteVoteSet *FnVoteSet,
+) {
+	fnID := localSummary.FnID
+	f.Logger.Error(
+		"FnConsensusReactor: conflicting Maj23 votesets detected",
+		"fnID", fnID, "nonce", localSummary.Nonce,
+		"localHash", hex.EncodeToString(localSummary.Hash),
+		"remoteHash", hex.EncodeToString(remoteSummary.Hash),
+		"method", maj23MsgHandlerMethodID,
+	)
+
+	if hasConflictEvidence(f.db, fnID, localSummary.Nonce) {
 		return
 	}
+
+	conflictingMaj23Count.With("fnID", fnID).Add(1)
+
+	localVoteSet, err := loadMaj23VoteSet(f.db, fnID, localSummary.Nonce)
+	if err != nil {
+		f.Logger.Error(
+			"FnConsensusReactor: unable to load Maj23 voteset from archive",
+			"fnID", fnID, "err", err, "method", maj23MsgHandlerMethodID,
+		)
+	}
+
+	evidence := &ConflictEvidence{
+		FnID:          fnID,
+		Nonce:         localSummary.Nonce,
+		LocalHash:     localSummary.Hash,
+		RemoteHash:    remoteSummary.Hash,
+		LocalVoteSet:  localVoteSet,
+		RemoteVoteSet: remoteVoteSet,
+		DetectedAt:    time.Now().Unix(),
+	}
+	if err := saveConflictEvidence(f.db, evidence); err != nil {
+		f.Logger.Error(
+			"FnConsensusReactor: unable to save conflict evidence",
+			"fnID", fnID, "err", err, "method", maj23MsgHandlerMethodID,
+		)
+	}
+}
+
+// ConflictEvidence returns all the evidence of conflicting Maj23 votesets observed by this node.
+func (f *FnConsensusReactor) ConflictEvidence() ([]*ConflictEvidence, error) {
+	if f.db == nil {
+		return nil, nil
+	}
+	return loadAllConflictEvidence(f.db)
 }
 
 // Compares the trustworthiness of a voteset received from a peer to the current local voteset.
@@ -691,54 +1577,91 @@ func (f *FnConsensusReactor) compareFnVoteSets(
 	currentVoteSetConverged := currentVoteSet.HasConverged(f.cfg.FnVoteSigningThreshold, currentValidators)
 	remoteVoteSetConverged := remoteVoteSet.HasConverged(f.cfg.FnVoteSigningThreshold, currentValidators)
 
-	if currentVoteSetConverged && !remoteVoteSetConverged {
-		return -1
-	} else if !currentVoteSetConverged && remoteVoteSetConverged {
-		return 1
-	} else if !currentVoteSetConverged && !remoteVoteSetConverged {
-		return -1
+	if currentVoteSetConverged != remoteVoteSetConverged {
+		return compareBools(remoteVoteSetConverged, currentVoteSetConverged)
 	}
 
-	currentNumberOfVotes := currentVoteSet.NumberOfVotes()
-	remoteNumberOfVotes := remoteVoteSet.NumberOfVotes()
-
-	if remoteNumberOfVotes < currentNumberOfVotes {
+	// Neither voteset is worth replacing ours with.
+	if !currentVoteSetConverged {
 		return -1
-	} else if remoteNumberOfVotes > currentNumberOfVotes {
-		return 1
+	}
+
+	if result := compareInts(remoteVoteSet.NumberOfVotes(), currentVoteSet.NumberOfVotes()); result != 0 {
+		return result
 	}
 
 	currentMajResponse := currentVoteSet.MajResponse(f.cfg.FnVoteSigningThreshold, currentValidators)
 	remoteMajResponse := remoteVoteSet.MajResponse(f.cfg.FnVoteSigningThreshold, currentValidators)
 
-	currentMajAgreed := currentMajResponse != nil
-	remoteMajAgreed := remoteMajResponse != nil
+	if (currentMajResponse != nil) != (remoteMajResponse != nil) {
+		return compareBools(remoteMajResponse != nil, currentMajResponse != nil)
+	}
 
-	if currentMajAgreed && !remoteMajAgreed {
-		return -1
-	} else if !currentMajAgreed && remoteMajAgreed {
+	if currentMajResponse != nil {
+		result := compareInts(remoteMajResponse.NumberOfAgreeVotes(), currentMajResponse.NumberOfAgreeVotes())
+		if result != 0 {
+			return result
+		}
+	}
+
+	// If everything else is the same both votesets are equally trustworthy, so a deterministic
+	// tie-break is used to ensure that nodes holding each other's votesets pick the same one.
+	return breakVoteSetTie(remoteVoteSet, currentVoteSet)
+}
+
+// Returns 1 if the remote voteset wins the tie-break, -1 if the current one does, or 0 if the votesets
+// are identical. The voteset with the higher nonce wins, if the nonces are the same the voteset with
+// the lexicographically smaller ID wins.
+func breakVoteSetTie(remoteVoteSet *FnVoteSet, currentVoteSet *FnVoteSet) int {
+	if remoteVoteSet.Nonce > currentVoteSet.Nonce {
 		return 1
-	} else if !currentMajAgreed && !remoteMajAgreed {
+	} else if remoteVoteSet.Nonce < currentVoteSet.Nonce {
 		return -1
 	}
 
-	currentMajResponseAgreedVotes := currentMajResponse.NumberOfAgreeVotes()
-	remoteMajResponseAgreedVotes := remoteMajResponse.NumberOfAgreeVotes()
+	remoteID, err := remoteVoteSet.ID()
+	if err != nil {
+		return -1
+	}
 
-	if remoteMajResponseAgreedVotes < currentMajResponseAgreedVotes {
+	currentID, err := currentVoteSet.ID()
+	if err != nil {
 		return -1
-	} else if remoteMajResponseAgreedVotes > currentMajResponseAgreedVotes {
+	}
+
+	// A smaller ID wins, so the result is the inverse of the comparison.
+	return -bytes.Compare(remoteID, currentID)
+}
+
+func compareInts(remote, current int) int {
+	if remote > current {
 		return 1
+	} else if remote < current {
+		return -1
 	}
+	return 0
+}
 
-	// If everything is same, we will trust current vote set
-	return -1
+// Returns 1 if the remote flag is set but the current one isn't, -1 if the current flag is set but
+// the remote one isn't, or 0 if both flags are the same.
+func compareBools(remote, current bool) int {
+	if remote && !current {
+		return 1
+	} else if !remote && current {
+		return -1
+	}
+	return 0
 }
 
 func (f *FnConsensusReactor) handleMaj23VoteSetChannel(sender p2p.Peer, msgBytes []byte) {
 	f.stateMtx.Lock()
 	defer f.stateMtx.Unlock()
 
+	if f.degraded {
+		f.forwardMaj23VoteSet(sender, msgBytes)
+		return
+	}
+
 	currentValidatorSet := f.getValidatorSet()
 	previousValidatorSet := f.state.PreviousValidatorSet
 
@@ -753,34 +1676,47 @@ func (f *FnConsensusReactor) handleMaj23VoteSetChannel(sender p2p.Peer, msgBytes
 		return
 	}
 
+	// Fns that aren't registered on this node can't be voted on, but may still be observed.
+	if f.fnRegistry.Get(remoteMajVoteSet.GetFnID()) == nil {
+		f.observeMaj23VoteSet(remoteMajVoteSet)
+		return
+	}
+
 	// We might have recently changed validator set, so maybe this voteset is valid with
 	// previousValidatorSet and not current. We dont need to validate the proposer, as it might be
 	// outdated in our case.
 	if err := remoteMajVoteSet.IsValid(f.chainID, currentValidatorSet, f.fnRegistry); err != nil {
 		if previousValidatorSet == nil {
-			f.Logger.Error(
-				"FnConsensusReactor: Invalid VoteSet specified, ignoring...",
-				"err", err, "method", maj23MsgHandlerMethodID,
-			)
+			f.rejectVoteSet("FnConsensusReactor: Invalid VoteSet specified, ignoring...", err, maj23MsgHandlerMethodID)
 			return
 		}
 		if err := remoteMajVoteSet.IsValid(f.chainID, previousValidatorSet, f.fnRegistry); err != nil {
-			f.Logger.Error(
-				"FnConsensusReactor: Invalid VoteSet specified, ignoring...",
-				"err", err, "method", maj23MsgHandlerMethodID,
-			)
+			f.rejectVoteSet("FnConsensusReactor: Invalid VoteSet specified, ignoring...", err, maj23MsgHandlerMethodID)
 			return
 		}
 		validatorSetWhichSignedRemoteVoteSet = previousValidatorSet
 	}
 
-	remoteFnID := remoteMajVoteSet.GetFnID()
-	currentNonce, ok := f.state.CurrentNonces[remoteFnID]
-	if !ok {
-		currentNonce = 1
+	if err := remoteMajVoteSet.CheckSigningThreshold(f.cfg.FnVoteSigningThreshold); err != nil {
+		f.rejectVoteSet("FnConsensusReactor: Invalid VoteSet specified, ignoring...", err, maj23MsgHandlerMethodID)
+		return
+	}
+
+	if err := f.validateHashAlgorithm(remoteMajVoteSet); err != nil {
+		f.Logger.Error(
+			"FnConsensusReactor: VoteSet hashed with unexpected algorithm, ignoring...",
+			"err", err, "method", maj23MsgHandlerMethodID,
+		)
+		return
 	}
 
-	previousMaj23VoteSet := f.state.PreviousMajVoteSets[remoteFnID]
+	remoteFnID := remoteMajVoteSet.GetFnID()
+	currentNonce := f.currentNonce(remoteFnID)
+
+	previousMaj23Summary := f.state.PreviousMaj23Summaries[remoteFnID]
+	// If we've fast-forwarded past some rounds the summary we have may be older than the remote
+	// voteset, in which case the remote voteset should replace it.
+	hasOutdatedSummary := previousMaj23Summary == nil || previousMaj23Summary.Nonce < remoteMajVoteSet.Nonce
 	needToBroadcast := true
 
 	if !remoteMajVoteSet.HasConverged(f.cfg.FnVoteSigningThreshold, validatorSetWhichSignedRemoteVoteSet) {
@@ -788,66 +1724,133 @@ func (f *FnConsensusReactor) handleMaj23VoteSetChannel(sender p2p.Peer, msgBytes
 		return
 	}
 
-	needToExcludeSender := false
+	if previousMaj23Summary != nil && previousMaj23Summary.Nonce == remoteMajVoteSet.Nonce {
+		remoteMaj23Summary := NewMaj23Summary(
+			remoteMajVoteSet, f.cfg.FnVoteSigningThreshold, validatorSetWhichSignedRemoteVoteSet,
+		)
+		if previousMaj23Summary.Hash != nil && remoteMaj23Summary.Hash != nil &&
+			!bytes.Equal(previousMaj23Summary.Hash, remoteMaj23Summary.Hash) {
+			f.recordConflictingMaj23VoteSet(previousMaj23Summary, remoteMaj23Summary, remoteMajVoteSet)
+			return
+		}
+	}
+
+	needToArchive := remoteMajVoteSet.Nonce >= currentNonce ||
+		(remoteMajVoteSet.Nonce == currentNonce-1 && hasOutdatedSummary)
+
+	if needToArchive {
+		if err := saveMaj23VoteSet(f.db, remoteMajVoteSet); err != nil {
+			f.Logger.Error(
+				"FnConsensusReactor: unable to archive Maj23 voteset",
+				"err", err, "method", maj23MsgHandlerMethodID,
+			)
+			return
+		}
+	}
 
 	if remoteMajVoteSet.Nonce < currentNonce {
 		needToBroadcast = false
 		if remoteMajVoteSet.Nonce == currentNonce-1 {
-			if previousMaj23VoteSet == nil {
-				previousMaj23VoteSet = remoteMajVoteSet
-				f.state.PreviousMajVoteSets[remoteFnID] = remoteMajVoteSet
+			if hasOutdatedSummary {
+				f.state.PreviousMaj23Summaries[remoteFnID] = NewMaj23Summary(
+					remoteMajVoteSet, f.cfg.FnVoteSigningThreshold, validatorSetWhichSignedRemoteVoteSet,
+				)
 				f.state.PreviousValidatorSet = validatorSetWhichSignedRemoteVoteSet
 			}
 		}
 	} else {
-		// Remote Maj23 is at nonce `x`. So, current nonce must be `x` + 1.
-		previousMaj23VoteSet = remoteMajVoteSet
-		f.state.PreviousMajVoteSets[remoteFnID] = remoteMajVoteSet
-		f.state.PreviousValidatorSet = validatorSetWhichSignedRemoteVoteSet
-		f.state.CurrentNonces[remoteFnID] = remoteMajVoteSet.Nonce + 1
-		nonceGauge.With("fnID", remoteFnID).Set(float64(f.state.CurrentNonces[remoteFnID]))
+		f.adoptMaj23VoteSet(remoteMajVoteSet, validatorSetWhichSignedRemoteVoteSet)
+	}
 
-		// If we have found maj23 voteset with a nonce equal or greater than our current nonce,
-		// our current vote set is clearly outdated, and should be removed.
-		delete(f.state.CurrentVoteSets, remoteFnID)
+	if err := f.persistState(maj23MsgHandlerMethodID); err != nil {
+		return
+	}
 
-		needToExcludeSender = true
-		// NOTE: f.safeSubmitMultiSignedMessage is not invoked here presumably because it was already
-		// invoked by the peers that we got the remote voteset from.
+	if !needToBroadcast {
+		return
 	}
 
-	if err := saveReactorState(f.db, f.state, true); err != nil {
+	marshalledBytes, err := remoteMajVoteSet.Marshal()
+	if err != nil {
 		f.Logger.Error(
-			"FnConsensusReactor: unable to save reactor state",
+			"FnConsensusReactor: unable to marshal bytes",
 			"err", err, "method", maj23MsgHandlerMethodID,
 		)
 		return
 	}
 
-	if !needToBroadcast {
+	// The sender obviously already has the voteset, so there's no need to send it back.
+	broadCastException := sender.ID()
+	f.broadcastMaj23VoteSet(&broadCastException, remoteMajVoteSet, marshalledBytes)
+}
+
+// Moves on to the round after the one the given (already archived) Maj23 voteset converged in.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) adoptMaj23VoteSet(maj23VoteSet *FnVoteSet, validatorSet *types.ValidatorSet) {
+	fnID := maj23VoteSet.GetFnID()
+
+	// Remote Maj23 is at nonce `x`. So, current nonce must be `x` + 1.
+	f.state.PreviousMaj23Summaries[fnID] = NewMaj23Summary(maj23VoteSet, f.cfg.FnVoteSigningThreshold, validatorSet)
+	f.state.PreviousValidatorSet = validatorSet
+	f.setCurrentNonce(fnID, maj23VoteSet.Nonce+1)
+
+	// If we have found maj23 voteset with a nonce equal or greater than our current nonce,
+	// our current vote set is clearly outdated, and should be removed.
+	delete(f.state.CurrentVoteSets, fnID)
+	f.endVoteObservation(fnID, validatorSet)
+	f.resetFailedRounds(fnID)
+	f.traceDecision(fnID, maj23VoteSet.Nonce, f.state.PreviousMaj23Summaries[fnID].Hash)
+
+	// NOTE: f.safeSubmitMultiSignedMessage is not invoked here presumably because it was already
+	// invoked by the peers that we got the remote voteset from.
+
+	f.resultObserver.publish(newConvergedResult(maj23VoteSet, f.cfg.FnVoteSigningThreshold, validatorSet, nil))
+}
+
+// Catches up with the other validators when a voteset that converged in a round later than the current
+// one is received, which means this node has fallen behind (e.g. because it was partitioned from the
+// other validators). The voteset is archived & adopted as the Maj23 voteset of its round, so this node
+// moves on to the next round instead of signing a round that's already over, and the voteset is passed
+// along so that any other peers that have fallen behind can catch up too.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) fastForward(sender p2p.Peer, maj23VoteSet *FnVoteSet, validatorSet *types.ValidatorSet) {
+	fnID := maj23VoteSet.GetFnID()
+	f.Logger.Info(
+		"FnConsensusReactor: fast-forwarding past remote Maj23 voteset",
+		"fnID", fnID, "currentNonce", f.currentNonce(fnID), "remoteNonce", maj23VoteSet.Nonce,
+		"method", voteSetMsgHandlerMethodID,
+	)
+
+	if err := saveMaj23VoteSet(f.db, maj23VoteSet); err != nil {
+		f.Logger.Error(
+			"FnConsensusReactor: unable to archive Maj23 voteset",
+			"fnID", fnID, "err", err, "method", voteSetMsgHandlerMethodID,
+		)
 		return
 	}
+	f.adoptMaj23VoteSet(maj23VoteSet, validatorSet)
 
-	marshalledBytes, err := previousMaj23VoteSet.Marshal()
+	if err := f.persistState(voteSetMsgHandlerMethodID); err != nil {
+		return
+	}
+
+	marshalledBytes, err := maj23VoteSet.Marshal()
 	if err != nil {
 		f.Logger.Error(
-			"FnConsensusReactor: unable to marshal bytes",
-			"err", err, "method", maj23MsgHandlerMethodID,
+			"FnConsensusReactor: unable to marshal Maj23 voteset",
+			"fnID", fnID, "err", err, "method", voteSetMsgHandlerMethodID,
 		)
 		return
 	}
 
-	if needToExcludeSender {
-		broadCastException := sender.ID()
-		f.broadcastMsgSync(FnMajChannel, &broadCastException, marshalledBytes)
-	} else {
-		f.broadcastMsgSync(FnMajChannel, nil, marshalledBytes)
-	}
+	broadCastException := sender.ID()
+	f.broadcastMaj23VoteSet(&broadCastException, maj23VoteSet, marshalledBytes)
 }
 
 func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgBytes []byte) {
 	currentValidators := f.getValidatorSet()
 	areWeValidator, ownValidatorIndex := f.areWeValidator(currentValidators)
+	catchingUp := f.isCatchingUp(time.Now())
 
 	remoteVoteSet := &FnVoteSet{}
 	if err := remoteVoteSet.Unmarshal(msgBytes); err != nil {
@@ -861,21 +1864,47 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 	fnID := remoteVoteSet.GetFnID()
 
 	if err := remoteVoteSet.IsValid(f.chainID, currentValidators, f.fnRegistry); err != nil {
+		f.rejectVoteSet("FnConsensusReactor: Invalid VoteSet specified, ignoring...", err, voteSetMsgHandlerMethodID)
+		return
+	}
+
+	if err := remoteVoteSet.CheckSigningThreshold(f.cfg.FnVoteSigningThreshold); err != nil {
+		f.rejectVoteSet("FnConsensusReactor: Invalid VoteSet specified, ignoring...", err, voteSetMsgHandlerMethodID)
+		return
+	}
+
+	if err := f.validateHashAlgorithm(remoteVoteSet); err != nil {
 		f.Logger.Error(
-			"FnConsensusReactor: Invalid VoteSet specified, ignoring...",
-			"err", err, "method", voteSetMsgHandlerMethodID,
+			"FnConsensusReactor: VoteSet hashed with unexpected algorithm, ignoring...",
+			"fnID", fnID, "err", err, "method", voteSetMsgHandlerMethodID,
+		)
+		return
+	}
+
+	if remoteVoteSet.IsExpired(f.clock.Now()) {
+		f.Logger.Info(
+			"FnConsensusReactor: VoteSet has expired, ignoring...",
+			"fnID", fnID, "nonce", remoteVoteSet.Nonce, "method", voteSetMsgHandlerMethodID,
 		)
 		return
 	}
 
+	// The sender obviously has all the votes in the voteset it sent us, so there's no need to send
+	// them back.
+	f.markPeerVoteSet(sender.ID(), remoteVoteSet)
+
 	f.stateMtx.Lock()
 	defer f.stateMtx.Unlock()
 
-	currentNonce, ok := f.state.CurrentNonces[fnID]
+	if f.degraded || catchingUp || !f.state.IsFnEnabled(fnID) {
+		f.forwardVoteSet(sender, msgBytes)
+		return
+	}
+
+	currentNonce, ok := f.storedNonce(fnID)
 	if !ok {
-		currentNonce = 1
-		f.state.CurrentNonces[fnID] = currentNonce
-		nonceGauge.With("fnID", fnID).Set(float64(currentNonce))
+		currentNonce = f.cfg.initialNonce(fnID)
+		f.setCurrentNonce(fnID, currentNonce)
 	}
 	currentVoteSet := f.state.CurrentVoteSets[fnID]
 
@@ -885,6 +1914,7 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 			"currentNonce", currentNonce,
 			"remoteNonce", remoteVoteSet.Nonce,
 		)
+		f.sendLatestMaj23VoteSet(sender, fnID, remoteVoteSet.Nonce)
 		return
 	}
 
@@ -905,12 +1935,17 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 
 	// Remote voteset is more trustworthy, so replace
 	case 1:
+		// A voteset from a later round is only more trustworthy than ours if it has converged.
+		if remoteVoteSet.Nonce > currentNonce {
+			f.fastForward(sender, remoteVoteSet, currentValidators)
+			return
+		}
 		f.state.CurrentVoteSets[fnID] = remoteVoteSet
-		f.state.CurrentNonces[fnID] = remoteVoteSet.Nonce
+		f.expiryAnchors[fnID] = newExpiryAnchor(f.clock, remoteVoteSet.Payload.Request.ExpiresAt)
+		f.setCurrentNonce(fnID, remoteVoteSet.Nonce)
 
 		currentVoteSet = remoteVoteSet
 		currentNonce = remoteVoteSet.Nonce
-		nonceGauge.With("fnID", fnID).Set(float64(currentNonce))
 
 		hasOurVoteSetChanged = true
 		didWeContribute = false
@@ -925,7 +1960,9 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 	if areWeValidator && !currentVoteSet.HaveWeAlreadySigned(ownValidatorIndex) {
 		fn := f.fnRegistry.Get(fnID)
 
+		executionStartedAt := time.Now()
 		message, signature, err := f.safeGetMessageAndSignature(fn)
+		executionTime := time.Since(executionStartedAt)
 		if err != nil {
 			f.Logger.Error(
 				"FnConsensusReactor: received error while executing fn.GetMessageAndSignature",
@@ -933,8 +1970,16 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 			)
 			return
 		}
+		if err := f.checkMessageSize(fnID, message); err != nil {
+			f.Logger.Error(
+				"FnConsensusReactor: fn.GetMessageAndSignature returned a message of invalid size",
+				"fnID", fnID, "err", err, "method", voteSetMsgHandlerMethodID,
+			)
+			return
+		}
 
-		hash, err := calculateMessageHash(message)
+		hashAlgorithm := f.hashAlgorithm(fnID, fn)
+		hash, err := calculateMessageHash(hashAlgorithm, message)
 		if err != nil {
 			f.Logger.Error(
 				"FnConsensusReactor: unable to calculate message hash",
@@ -946,6 +1991,7 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 		err = currentVoteSet.AddVote(currentNonce, &FnIndividualExecutionResponse{
 			Hash:            hash,
 			OracleSignature: signature,
+			HashAlgorithm:   hashAlgorithm.voteValue(),
 		}, currentValidators, ownValidatorIndex, f.privValidator)
 		if err != nil {
 			f.Logger.Error(
@@ -954,6 +2000,10 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 			)
 			return
 		}
+		f.traceExecution(
+			currentVoteSet.Payload.Request, currentNonce, message, hash, hashAlgorithm,
+			executionStartedAt, executionTime,
+		)
 
 		didWeContribute = true
 		hasOurVoteSetChanged = true
@@ -965,6 +2015,11 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 	if !hasOurVoteSetChanged {
 		return
 	}
+	f.observeVotes(currentVoteSet, time.Now())
+
+	if err := f.persistState(voteSetMsgHandlerMethodID); err != nil {
+		return
+	}
 
 	marshalledBytes, err := currentVoteSet.Marshal()
 	if err != nil {
@@ -979,9 +2034,9 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 	// If this is false, then we must not have achieved Maj23
 	broadCastException := sender.ID()
 	if !didWeContribute {
-		f.broadcastMsgSync(FnVoteSetChannel, &broadCastException, marshalledBytes)
+		f.broadcastVoteSetSync(&broadCastException, currentVoteSet, marshalledBytes)
 	} else {
-		f.broadcastMsgSync(FnVoteSetChannel, nil, marshalledBytes)
+		f.broadcastVoteSetSync(nil, currentVoteSet, marshalledBytes)
 	}
 }
 
@@ -992,13 +2047,13 @@ func (f *FnConsensusReactor) handleVoteSetChannelMessage(sender p2p.Peer, msgByt
 // CONTRACT: msgBytes are not nil.
 func (f *FnConsensusReactor) Receive(chID byte, sender p2p.Peer, msgBytes []byte) {
 	switch chID {
-	case FnVoteSetChannel:
+	case f.cfg.voteSetChannelID():
 		if !f.cfg.IsValidator {
 			f.forwardVoteSet(sender, msgBytes)
 		} else {
 			f.handleVoteSetChannelMessage(sender, msgBytes)
 		}
-	case FnMajChannel:
+	case f.cfg.majChannelID():
 		if !f.cfg.IsValidator {
 			f.forwardMaj23VoteSet(sender, msgBytes)
 		} else {
@@ -1019,8 +2074,116 @@ func (f *FnConsensusReactor) forwardMaj23VoteSet(sender p2p.Peer, msgBytes []byt
 		return
 	}
 
+	f.observeMaj23VoteSet(remoteVoteSet)
+
 	broadCastException := sender.ID()
-	f.broadcastMsgSync(FnMajChannel, &broadCastException, msgBytes)
+	f.broadcastMsgSync(f.cfg.majChannelID(), &broadCastException, msgBytes)
+}
+
+// Sends our latest Maj23 voteset for the given Fn to a peer that's still voting on an older nonce,
+// so the peer can fast-forward to the current round.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) sendLatestMaj23VoteSet(peer p2p.Peer, fnID string, peerNonce int64) {
+	summary := f.state.PreviousMaj23Summaries[fnID]
+	if summary == nil || summary.Nonce < peerNonce {
+		return
+	}
+
+	voteSet, err := loadMaj23VoteSet(f.db, fnID, summary.Nonce)
+	if err != nil || voteSet == nil {
+		f.Logger.Error(
+			"FnConsensusReactor: unable to load Maj23 voteset from archive",
+			"fnID", fnID, "nonce", summary.Nonce, "err", err, "method", voteSetMsgHandlerMethodID,
+		)
+		return
+	}
+
+	marshalledBytes, err := voteSet.Marshal()
+	if err != nil {
+		f.Logger.Error(
+			"FnConsensusReactor: unable to marshal Maj23 voteset",
+			"fnID", fnID, "err", err, "method", voteSetMsgHandlerMethodID,
+		)
+		return
+	}
+
+	if !f.isOversizedMsg(f.cfg.majChannelID(), marshalledBytes) {
+		peer.TrySend(f.cfg.majChannelID(), marshalledBytes)
+	}
+}
+
+// SubscribeResults returns a subscription that delivers the results converged for the given Fn,
+// starting with the last result converged before the subscription was made (if any).
+// A bufferSize of zero or less results in DefaultResultSubscriptionBufferSize being used.
+// The Fn doesn't need to be registered on this node, nor does the node need to be a validator.
+func (f *FnConsensusReactor) SubscribeResults(fnID string, bufferSize int) *ResultSubscription {
+	f.stateMtx.Lock()
+	defer f.stateMtx.Unlock()
+
+	return f.resultObserver.subscribe(fnID, bufferSize, f.loadLastConvergedResult(fnID))
+}
+
+// Loads the last result converged for the given Fn from the Maj23 archive, so that subscribers can
+// be brought up to date after a restart.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) loadLastConvergedResult(fnID string) *ConvergedResult {
+	if f.state == nil || f.state.PreviousValidatorSet == nil {
+		return nil
+	}
+
+	summary := f.state.PreviousMaj23Summaries[fnID]
+	if summary == nil || !bytes.Equal(summary.ValidatorsHash, f.state.PreviousValidatorSet.Hash()) {
+		return nil
+	}
+
+	voteSet, err := loadMaj23VoteSet(f.db, fnID, summary.Nonce)
+	if err != nil || voteSet == nil {
+		f.Logger.Error("FnConsensusReactor: unable to load last converged result", "fnID", fnID, "err", err)
+		return nil
+	}
+
+	return newConvergedResult(voteSet, f.cfg.FnVoteSigningThreshold, f.state.PreviousValidatorSet, nil)
+}
+
+// Publishes the result of a Maj23 voteset for a Fn that isn't registered on this node, if anyone has
+// subscribed to the results of the Fn.
+func (f *FnConsensusReactor) observeMaj23VoteSet(voteSet *FnVoteSet) {
+	if !f.resultObserver.hasSubscribers(voteSet.GetFnID()) {
+		return
+	}
+
+	// The TM state is empty until the node has synced the first block.
+	if f.tmStateDB == nil && !f.hasStaticValidators() {
+		f.Logger.Error(
+			"FnConsensusReactor: unable to observe Maj23 voteset without a validator set",
+			"fnID", voteSet.GetFnID(), "method", maj23MsgHandlerMethodID,
+		)
+		return
+	}
+
+	validatorSet := f.getValidatorSet()
+	if validatorSet == nil {
+		f.Logger.Error(
+			"FnConsensusReactor: unable to observe Maj23 voteset before the TM state is populated",
+			"fnID", voteSet.GetFnID(), "method", maj23MsgHandlerMethodID,
+		)
+		return
+	}
+	if err := voteSet.IsValid(f.chainID, validatorSet, nil); err != nil {
+		f.rejectVoteSet("FnConsensusReactor: Invalid VoteSet specified, ignoring...", err, maj23MsgHandlerMethodID)
+		return
+	}
+
+	if err := voteSet.CheckSigningThreshold(f.cfg.FnVoteSigningThreshold); err != nil {
+		f.rejectVoteSet("FnConsensusReactor: Invalid VoteSet specified, ignoring...", err, maj23MsgHandlerMethodID)
+		return
+	}
+
+	if !voteSet.HasConverged(f.cfg.FnVoteSigningThreshold, validatorSet) {
+		return
+	}
+
+	f.resultObserver.publish(newConvergedResult(voteSet, f.cfg.FnVoteSigningThreshold, validatorSet, nil))
 }
 
 func (f *FnConsensusReactor) forwardVoteSet(sender p2p.Peer, msgBytes []byte) {
@@ -1034,5 +2197,5 @@ func (f *FnConsensusReactor) forwardVoteSet(sender p2p.Peer, msgBytes []byte) {
 	}
 
 	broadCastException := sender.ID()
-	f.broadcastMsgSync(FnVoteSetChannel, &broadCastException, msgBytes)
+	f.broadcastMsgSync(f.cfg.voteSetChannelID(), &broadCastException, msgBytes)
 }
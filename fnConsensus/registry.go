@@ -2,7 +2,9 @@ package fnConsensus
 
 import (
 	"errors"
+	"sort"
 	"sync"
+	"time"
 )
 
 var ErrFnIDIsTaken = errors.New("FnID is already used by another Fn Object")
@@ -25,23 +27,57 @@ type Fn interface {
 	SubmitMultiSignedMessage(ctx []byte, key []byte, signatures [][]byte)
 }
 
+// ExpiryProvider may be implemented by a Fn that generates messages that are only valid for a limited
+// time. The expiry is bounded by the min & max message expiry specified in the reactor config.
+type ExpiryProvider interface {
+	// MessageExpiry returns how long the message most recently returned by GetMessageAndSignature
+	// remains valid, or zero if it doesn't expire.
+	MessageExpiry() time.Duration
+}
+
+// FnMetadata describes a registered Fn.
+type FnMetadata struct {
+	// Human readable description of what the Fn does.
+	Description string
+	// Version of the Fn logic, validators running different versions of a Fn will never agree on the
+	// messages it generates, so the version is included in the execution request validators sign.
+	// Should be left empty for Fns that were registered before versions were introduced.
+	Version string
+	// Identifies where the messages generated by the Fn are submitted to (e.g. a foreign chain).
+	Destination string
+}
+
+// FnDetails contains the ID & metadata of a registered Fn.
+type FnDetails struct {
+	FnID string
+	FnMetadata
+}
+
 // FnRegistry acts as a registry which stores multiple Fn objects by their IDs
 // And allows reactor to query Fns at time of propose and validation.
 type FnRegistry interface {
 	Get(fnID string) Fn
 	Set(fnID string, fnObj Fn) error
+	// SetWithMetadata registers a Fn along with metadata describing it.
+	SetWithMetadata(fnID string, fnObj Fn, metadata FnMetadata) error
+	// GetMetadata returns the metadata of a registered Fn, or nil if the Fn isn't registered.
+	GetMetadata(fnID string) *FnMetadata
 	GetAll() []string
+	// ListDetailed returns the IDs & metadata of all the registered Fns, sorted by ID.
+	ListDetailed() []FnDetails
 }
 
 // InMemoryFnRegistry is a transient registry that needs to be rebuilt upon restart.
 type InMemoryFnRegistry struct {
-	mtx   sync.RWMutex
-	fnMap map[string]Fn
+	mtx         sync.RWMutex
+	fnMap       map[string]Fn
+	metadataMap map[string]FnMetadata
 }
 
 func NewInMemoryFnRegistry() *InMemoryFnRegistry {
 	return &InMemoryFnRegistry{
-		fnMap: make(map[string]Fn),
+		fnMap:       make(map[string]Fn),
+		metadataMap: make(map[string]FnMetadata),
 	}
 }
 
@@ -67,7 +103,39 @@ func (f *InMemoryFnRegistry) Get(fnID string) Fn {
 	return f.fnMap[fnID]
 }
 
+func (f *InMemoryFnRegistry) GetMetadata(fnID string) *FnMetadata {
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+
+	if _, exists := f.fnMap[fnID]; !exists {
+		return nil
+	}
+	metadata := f.metadataMap[fnID]
+	return &metadata
+}
+
+func (f *InMemoryFnRegistry) ListDetailed() []FnDetails {
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+
+	details := make([]FnDetails, 0, len(f.fnMap))
+	for fnID := range f.fnMap {
+		details = append(details, FnDetails{
+			FnID:       fnID,
+			FnMetadata: f.metadataMap[fnID],
+		})
+	}
+	sort.Slice(details, func(i, j int) bool {
+		return details[i].FnID < details[j].FnID
+	})
+	return details
+}
+
 func (f *InMemoryFnRegistry) Set(fnID string, fnObj Fn) error {
+	return f.SetWithMetadata(fnID, fnObj, FnMetadata{})
+}
+
+func (f *InMemoryFnRegistry) SetWithMetadata(fnID string, fnObj Fn, metadata FnMetadata) error {
 	if fnObj == nil {
 		return ErrFnObjCantNil
 	}
@@ -81,5 +149,6 @@ func (f *InMemoryFnRegistry) Set(fnID string, fnObj Fn) error {
 	}
 
 	f.fnMap[fnID] = fnObj
+	f.metadataMap[fnID] = metadata
 	return nil
 }
@@ -0,0 +1,113 @@
+package fnConsensus
+
+import (
+	"encoding/binary"
+)
+
+// The bytes signed by validators are encoded explicitly here, rather than by the codec, so they
+// don't change if the structs are modified, and so alternative implementations can reproduce them.
+// The encoding is the same as the amino encoding used by earlier versions of the reactor, and is
+// pinned by the golden vectors in testdata/vote_sign_bytes.json.
+//
+// A validator signs the following bytes when voting on a voteset (see FnVoteSet.SignBytes):
+//
+//   "NONCE:" nonce "|CD:" chainID "|VA:" address "|PL:" 0x11131719 validatorsHash 0x11131719
+//   request 0x50 response
+//
+// The nonce is formatted in decimal, the address is the raw validator address, and the request and
+// response are records prefixed with their length (uvarint). Each record starts with the 4 byte
+// amino prefix of the type it was registered with, followed by the following fields:
+//
+//   request:  prefix 0xac3ed480, 1 FnID (string), 2 FnVersion (string), 3 ExpiresAt (int64)
+//   response: prefix 0xae43699d, 1 Hash (bytes), 2 OracleSignature (bytes), 3 HashAlgorithm (string)
+//
+// Each field is encoded as a uvarint key ((field number << 3) | wire type) followed by the value,
+// strings and bytes have wire type 2 and are encoded as their length (uvarint) followed by the data,
+// integers have wire type 0 and are encoded as uvarints (negative values in two's complement).
+// Fields with zero values are omitted.
+//
+// If the voteset embeds quorum parameters (see FnVoteSet.QuorumParams) the following is appended:
+//
+//   "|QP:" quorumParams
+//
+// where quorumParams is a record prefixed with its length with the following fields:
+//
+//   quorumParams: 1 SigningThreshold (string), 2 RequiredVotingPower (int64),
+//                 3 VotingPowers (int64, one field per validator in validator index order)
+//
+// Unlike the other fields, each voting power is encoded even if it's zero.
+
+const (
+	signBytesWireTypeVarint = 0
+	signBytesWireTypeBytes  = 2
+)
+
+// Amino prefixes of "tendermint/fnConsensusReactor/FnExecutionRequest" and
+// "tendermint/fnConsensusReactor/FnIndividualExecutionResponse".
+var (
+	requestSignBytesPrefix            = []byte{0xac, 0x3e, 0xd4, 0x80}
+	individualResponseSignBytesPrefix = []byte{0xae, 0x43, 0x69, 0x9d}
+)
+
+func requestSignBytes(request *FnExecutionRequest) []byte {
+	record := append([]byte(nil), requestSignBytesPrefix...)
+	record = appendSignBytesString(record, 1, request.FnID)
+	record = appendSignBytesString(record, 2, request.FnVersion)
+	record = appendSignBytesInt64(record, 3, request.ExpiresAt)
+	return lengthPrefixedSignBytes(record)
+}
+
+func individualResponseSignBytes(response *FnIndividualExecutionResponse) []byte {
+	record := append([]byte(nil), individualResponseSignBytesPrefix...)
+	record = appendSignBytesBytes(record, 1, response.Hash)
+	record = appendSignBytesBytes(record, 2, response.OracleSignature)
+	record = appendSignBytesString(record, 3, string(response.HashAlgorithm))
+	return lengthPrefixedSignBytes(record)
+}
+
+func quorumParamsSignBytes(params *QuorumParams) []byte {
+	var record []byte
+	record = appendSignBytesString(record, 1, string(params.SigningThreshold))
+	record = appendSignBytesInt64(record, 2, params.RequiredVotingPower)
+	for _, votingPower := range params.VotingPowers {
+		record = appendSignBytesKey(record, 3, signBytesWireTypeVarint)
+		record = appendSignBytesUvarint(record, uint64(votingPower))
+	}
+	return lengthPrefixedSignBytes(record)
+}
+
+func appendSignBytesUvarint(buf []byte, value uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], value)
+	return append(buf, scratch[:n]...)
+}
+
+func appendSignBytesKey(buf []byte, fieldNum uint64, wireType uint64) []byte {
+	return appendSignBytesUvarint(buf, fieldNum<<3|wireType)
+}
+
+func appendSignBytesBytes(buf []byte, fieldNum uint64, value []byte) []byte {
+	if len(value) == 0 {
+		return buf
+	}
+	buf = appendSignBytesKey(buf, fieldNum, signBytesWireTypeBytes)
+	buf = appendSignBytesUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+func appendSignBytesString(buf []byte, fieldNum uint64, value string) []byte {
+	return appendSignBytesBytes(buf, fieldNum, []byte(value))
+}
+
+func appendSignBytesInt64(buf []byte, fieldNum uint64, value int64) []byte {
+	if value == 0 {
+		return buf
+	}
+	buf = appendSignBytesKey(buf, fieldNum, signBytesWireTypeVarint)
+	return appendSignBytesUvarint(buf, uint64(value))
+}
+
+func lengthPrefixedSignBytes(record []byte) []byte {
+	buf := appendSignBytesUvarint(make([]byte, 0, len(record)+binary.MaxVarintLen64), uint64(len(record)))
+	return append(buf, record...)
+}
@@ -0,0 +1,296 @@
+//go:build soak
+// +build soak
+
+package fnConsensus
+
+import (
+	"container/heap"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/p2p"
+)
+
+// The soak test simulates a network of validators in virtual time, run it with
+// `go test -tags soak -run TestSoakConvergence ./fnConsensus -v`, the network conditions and pass
+// thresholds can be adjusted via the flags below.
+var (
+	soakValidators     = flag.Int("soak.validators", 21, "number of validators")
+	soakRounds         = flag.Int("soak.rounds", 20, "number of voting rounds")
+	soakLossRate       = flag.Float64("soak.loss", 0.05, "probability of a message being dropped")
+	soakMinLatency     = flag.Duration("soak.min-latency", 200*time.Millisecond, "min message latency")
+	soakMaxLatency     = flag.Duration("soak.max-latency", 400*time.Millisecond, "max message latency")
+	soakChurnRate      = flag.Float64("soak.churn", 0.05, "probability of a validator being offline for a round")
+	soakSeed           = flag.Int64("soak.seed", 1, "seed for the random number generator")
+	soakMinConvergence = flag.Float64("soak.min-convergence", 0.95, "min fraction of rounds that must converge")
+	soakMaxP95         = flag.Duration("soak.max-p95", 3*time.Second, "max 95th percentile time-to-quorum")
+)
+
+// Time between the start of a voting round and the commit, validators vote at a random offset of up
+// to two seconds into the round, and commit five seconds later.
+const soakSyncWindow = 5 * time.Second
+
+type soakConfig struct {
+	Validators int
+	Rounds     int
+	LossRate   float64
+	// Message latency is uniformly distributed between these bounds.
+	MinLatency time.Duration
+	MaxLatency time.Duration
+	// Probability of each validator being offline for the duration of a round.
+	ChurnRate float64
+	Seed      int64
+}
+
+type soakReport struct {
+	Rounds          int
+	ConvergedRounds int
+	// Time from the start of each converged round until the first validator saw a voteset that
+	// reached the signing threshold, sorted in ascending order.
+	TimesToQuorum []time.Duration
+	Messages      int
+	Bytes         int
+}
+
+func (r *soakReport) ConvergenceRate() float64 {
+	return float64(r.ConvergedRounds) / float64(r.Rounds)
+}
+
+func (r *soakReport) TimeToQuorumPercentile(percentile float64) time.Duration {
+	if len(r.TimesToQuorum) == 0 {
+		return 0
+	}
+	index := int(float64(len(r.TimesToQuorum)-1) * percentile / 100)
+	return r.TimesToQuorum[index]
+}
+
+func (r *soakReport) String() string {
+	return fmt.Sprintf(
+		"converged %d/%d rounds, time-to-quorum p50=%v p95=%v p99=%v, %d messages (%d bytes)",
+		r.ConvergedRounds, r.Rounds,
+		r.TimeToQuorumPercentile(50), r.TimeToQuorumPercentile(95), r.TimeToQuorumPercentile(99),
+		r.Messages, r.Bytes,
+	)
+}
+
+// A vote by a validator, or a message in flight between two validators.
+type soakEvent struct {
+	at       time.Duration
+	seq      int
+	from, to int
+	chID     byte
+	msgBytes []byte
+	isVote   bool
+}
+
+type soakEventQueue []*soakEvent
+
+func (q soakEventQueue) Len() int { return len(q) }
+func (q soakEventQueue) Less(i, j int) bool {
+	if q[i].at == q[j].at {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at < q[j].at
+}
+func (q soakEventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *soakEventQueue) Push(x interface{}) { *q = append(*q, x.(*soakEvent)) }
+func (q *soakEventQueue) Pop() interface{} {
+	old := *q
+	event := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return event
+}
+
+type soakNetwork struct {
+	cfg      soakConfig
+	rng      *rand.Rand
+	reactors []*FnConsensusReactor
+	offline  []bool
+	queue    soakEventQueue
+	now      time.Duration
+	seq      int
+	report   soakReport
+}
+
+// soakPeer is the view one validator has of another, messages sent to it are delivered via the
+// simulated network.
+type soakPeer struct {
+	p2p.Peer
+	network  *soakNetwork
+	from, to int
+}
+
+func (p *soakPeer) ID() p2p.ID { return soakNodeID(p.to) }
+
+func (p *soakPeer) Send(chID byte, msgBytes []byte) bool {
+	p.network.send(p.from, p.to, chID, msgBytes)
+	return true
+}
+
+func (p *soakPeer) TrySend(chID byte, msgBytes []byte) bool {
+	return p.Send(chID, msgBytes)
+}
+
+func soakNodeID(index int) p2p.ID {
+	return p2p.ID(fmt.Sprintf("node%d", index))
+}
+
+func newSoakNetwork(t *testing.T, cfg soakConfig) *soakNetwork {
+	validators := newTestValidators(cfg.Validators)
+	network := &soakNetwork{
+		cfg:      cfg,
+		rng:      rand.New(rand.NewSource(cfg.Seed)),
+		reactors: make([]*FnConsensusReactor, cfg.Validators),
+		offline:  make([]bool, cfg.Validators),
+	}
+	for i, pv := range validators.privValidators {
+		network.reactors[i] = validators.newReactor(t, pv)
+		network.reactors[i].cfg.IsValidator = true
+	}
+	for i, reactor := range network.reactors {
+		for j := range network.reactors {
+			if i != j {
+				reactor.AddPeer(&soakPeer{network: network, from: i, to: j})
+			}
+		}
+	}
+	return network
+}
+
+func (n *soakNetwork) schedule(event *soakEvent) {
+	n.seq++
+	event.seq = n.seq
+	heap.Push(&n.queue, event)
+}
+
+func (n *soakNetwork) send(from, to int, chID byte, msgBytes []byte) {
+	n.report.Messages++
+	n.report.Bytes += len(msgBytes)
+	if n.rng.Float64() < n.cfg.LossRate {
+		return
+	}
+	latency := n.cfg.MinLatency
+	if n.cfg.MaxLatency > n.cfg.MinLatency {
+		latency += time.Duration(n.rng.Int63n(int64(n.cfg.MaxLatency - n.cfg.MinLatency)))
+	}
+	n.schedule(&soakEvent{
+		at:       n.now + latency,
+		from:     from,
+		to:       to,
+		chID:     chID,
+		msgBytes: append([]byte(nil), msgBytes...),
+	})
+}
+
+func (n *soakNetwork) hasQuorum(reactor *FnConsensusReactor) bool {
+	reactor.stateMtx.Lock()
+	defer reactor.stateMtx.Unlock()
+	voteSet := reactor.state.CurrentVoteSets["fn"]
+	return voteSet != nil && voteSet.HasConverged(reactor.cfg.FnVoteSigningThreshold, reactor.staticValidators)
+}
+
+func (n *soakNetwork) runRound() {
+	for i := range n.offline {
+		n.offline[i] = n.rng.Float64() < n.cfg.ChurnRate
+	}
+
+	n.now = 0
+	n.queue = n.queue[:0]
+	for i := range n.reactors {
+		if !n.offline[i] {
+			n.schedule(&soakEvent{
+				at:     time.Duration(n.rng.Int63n(int64(2 * time.Second))),
+				to:     i,
+				isVote: true,
+			})
+		}
+	}
+
+	var timeToQuorum time.Duration
+	converged := false
+	for n.queue.Len() > 0 {
+		event := heap.Pop(&n.queue).(*soakEvent)
+		if event.at > soakSyncWindow {
+			break
+		}
+		n.now = event.at
+		if n.offline[event.to] {
+			continue
+		}
+
+		reactor := n.reactors[event.to]
+		if event.isVote {
+			reactor.stateMtx.Lock()
+			inProgress := reactor.state.CurrentVoteSets["fn"] != nil
+			reactor.stateMtx.Unlock()
+			if !inProgress {
+				_, index := reactor.areWeValidator(reactor.staticValidators)
+				reactor.vote("fn", noopFn{}, reactor.staticValidators, index)
+			}
+		} else {
+			reactor.Receive(event.chID, &soakPeer{network: n, from: event.to, to: event.from}, event.msgBytes)
+		}
+
+		if !converged && n.hasQuorum(reactor) {
+			converged = true
+			timeToQuorum = n.now
+		}
+	}
+
+	// Messages still in flight when the validators commit are dropped, they'd only be ignored as
+	// outdated once they arrive.
+	n.queue = n.queue[:0]
+	for i, reactor := range n.reactors {
+		if n.offline[i] {
+			continue
+		}
+		reactor.stateMtx.Lock()
+		inProgress := reactor.state.CurrentVoteSets["fn"] != nil
+		reactor.stateMtx.Unlock()
+		if inProgress {
+			reactor.commit("fn")
+		}
+	}
+
+	n.report.Rounds++
+	if converged {
+		n.report.ConvergedRounds++
+		n.report.TimesToQuorum = append(n.report.TimesToQuorum, timeToQuorum)
+	}
+}
+
+func runSoak(t *testing.T, cfg soakConfig) *soakReport {
+	network := newSoakNetwork(t, cfg)
+	for round := 0; round < cfg.Rounds; round++ {
+		network.runRound()
+	}
+	sort.Slice(network.report.TimesToQuorum, func(i, j int) bool {
+		return network.report.TimesToQuorum[i] < network.report.TimesToQuorum[j]
+	})
+	return &network.report
+}
+
+func TestSoakConvergence(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping soak test in short mode")
+	}
+
+	report := runSoak(t, soakConfig{
+		Validators: *soakValidators,
+		Rounds:     *soakRounds,
+		LossRate:   *soakLossRate,
+		MinLatency: *soakMinLatency,
+		MaxLatency: *soakMaxLatency,
+		ChurnRate:  *soakChurnRate,
+		Seed:       *soakSeed,
+	})
+	t.Log(report)
+
+	require.True(t, report.ConvergenceRate() >= *soakMinConvergence, "convergence rate too low: %s", report)
+	require.True(t, report.TimeToQuorumPercentile(95) <= *soakMaxP95, "time-to-quorum too high: %s", report)
+}
@@ -1,10 +1,34 @@
 package fnConsensus
 
-import dbm "github.com/tendermint/tendermint/libs/db"
+import (
+	"fmt"
+
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
 
 const reactorStateKey = "fnConsensusReactor:state"
 
-func loadReactorState(db dbm.DB) (*ReactorState, error) {
+// Prefix of the keys under which votesets that reached the signing threshold are archived.
+const maj23VoteSetKeyPrefix = "fnConsensusReactor:maj23:"
+
+// Prefix of the keys under which the state of named reactor instances is persisted.
+const instanceKeyPrefix = "fnConsensusReactor:instance:"
+
+// InstanceDB returns the view of fnConsensus.db used by the reactor instance with the given name,
+// the default instance (with an empty name) uses the DB as is. Returns nil if the DB is nil, which is
+// the case on non-validator nodes.
+func InstanceDB(db dbm.DB, instanceName string) dbm.DB {
+	if db == nil || instanceName == "" {
+		return db
+	}
+	return dbm.NewPrefixDB(db, []byte(instanceKeyPrefix+instanceName+":"))
+}
+
+func maj23VoteSetKey(fnID string, nonce int64) []byte {
+	return []byte(fmt.Sprintf("%s%s:%020d", maj23VoteSetKeyPrefix, fnID, nonce))
+}
+
+func loadReactorState(db dbm.DB, signingThreshold SigningThreshold) (*ReactorState, error) {
 	rectorStateBytes := db.Get([]byte(reactorStateKey))
 	if rectorStateBytes == nil {
 		return NewReactorState(), nil
@@ -14,10 +38,21 @@ func loadReactorState(db dbm.DB) (*ReactorState, error) {
 	if err := persistedRectorState.Unmarshal(rectorStateBytes); err != nil {
 		return nil, err
 	}
+
+	if err := migrateLegacyMaj23VoteSets(db, persistedRectorState, signingThreshold); err != nil {
+		return nil, err
+	}
 	return persistedRectorState, nil
 }
 
-func saveReactorState(db dbm.DB, reactorState *ReactorState, sync bool) error {
+func saveReactorState(db dbm.DB, reactorState *ReactorState, sync bool) (err error) {
+	// Most DB implementations panic when a write fails (e.g. due to a full disk).
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to write reactor state: %v", r)
+		}
+	}()
+
 	marshalledBytes, err := reactorState.Marshal()
 	if err != nil {
 		return err
@@ -31,3 +66,94 @@ func saveReactorState(db dbm.DB, reactorState *ReactorState, sync bool) error {
 
 	return nil
 }
+
+// SetFnEnabledInDB enables or disables a Fn in the reactor state persisted in the given DB, the
+// reactor must not be running while the DB is modified.
+func SetFnEnabledInDB(db dbm.DB, signingThreshold SigningThreshold, fnID string, enabled bool) error {
+	reactorState, err := loadReactorState(db, signingThreshold)
+	if err != nil {
+		return err
+	}
+	reactorState.setFnEnabled(fnID, enabled)
+	return saveReactorState(db, reactorState, true)
+}
+
+// Moves the Maj23 votesets embedded in state persisted by older versions of the reactor into the
+// archive, leaving only summaries in the reactor state.
+func migrateLegacyMaj23VoteSets(db dbm.DB, reactorState *ReactorState, signingThreshold SigningThreshold) error {
+	if len(reactorState.legacyMajVoteSets) == 0 {
+		return nil
+	}
+
+	for _, voteSet := range reactorState.legacyMajVoteSets {
+		if err := saveMaj23VoteSet(db, voteSet); err != nil {
+			return err
+		}
+		reactorState.PreviousMaj23Summaries[voteSet.GetFnID()] = NewMaj23Summary(
+			voteSet, signingThreshold, reactorState.PreviousValidatorSet,
+		)
+	}
+	reactorState.legacyMajVoteSets = nil
+
+	return saveReactorState(db, reactorState, true)
+}
+
+func saveMaj23VoteSet(db dbm.DB, voteSet *FnVoteSet) error {
+	marshalledBytes, err := voteSet.Marshal()
+	if err != nil {
+		return err
+	}
+
+	db.Set(maj23VoteSetKey(voteSet.GetFnID(), voteSet.Nonce), marshalledBytes)
+	return nil
+}
+
+// Returns the archived Maj23 voteset for the given fnID & nonce, or nil if there's no such voteset.
+func loadMaj23VoteSet(db dbm.DB, fnID string, nonce int64) (*FnVoteSet, error) {
+	voteSetBytes := db.Get(maj23VoteSetKey(fnID, nonce))
+	if voteSetBytes == nil {
+		return nil, nil
+	}
+
+	voteSet := &FnVoteSet{}
+	if err := voteSet.Unmarshal(voteSetBytes); err != nil {
+		return nil, err
+	}
+	return voteSet, nil
+}
+
+// Prefix of the keys under which evidence of conflicting Maj23 votesets is stored.
+const conflictEvidenceKeyPrefix = "fnConsensusReactor:evidence:"
+
+func conflictEvidenceKey(fnID string, nonce int64) []byte {
+	return []byte(fmt.Sprintf("%s%s:%020d", conflictEvidenceKeyPrefix, fnID, nonce))
+}
+
+func hasConflictEvidence(db dbm.DB, fnID string, nonce int64) bool {
+	return db.Has(conflictEvidenceKey(fnID, nonce))
+}
+
+func saveConflictEvidence(db dbm.DB, evidence *ConflictEvidence) error {
+	marshalledBytes, err := evidence.Marshal()
+	if err != nil {
+		return err
+	}
+
+	db.SetSync(conflictEvidenceKey(evidence.FnID, evidence.Nonce), marshalledBytes)
+	return nil
+}
+
+func loadAllConflictEvidence(db dbm.DB) ([]*ConflictEvidence, error) {
+	it := dbm.IteratePrefix(db, []byte(conflictEvidenceKeyPrefix))
+	defer it.Close()
+
+	var evidence []*ConflictEvidence
+	for ; it.Valid(); it.Next() {
+		e := &ConflictEvidence{}
+		if err := e.Unmarshal(it.Value()); err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, e)
+	}
+	return evidence, nil
+}
@@ -0,0 +1,68 @@
+package fnConsensus
+
+import (
+	"time"
+
+	"github.com/tendermint/tendermint/state"
+)
+
+// SyncStatusProvider is implemented by the embedding node to let the reactor know when the node is
+// still catching up with the rest of the network (e.g. fast syncing or replaying blocks).
+type SyncStatusProvider interface {
+	IsCatchingUp() bool
+}
+
+// SyncStatusProviderFunc adapts a function to the SyncStatusProvider interface.
+type SyncStatusProviderFunc func() bool
+
+func (fn SyncStatusProviderFunc) IsCatchingUp() bool {
+	return fn()
+}
+
+// SetSyncStatusProvider sets the provider the reactor uses to check if the node is catching up, while
+// the node is catching up the reactor only relays votesets to peers without proposing or signing
+// anything, since the messages it would sign are computed from stale state.
+func (f *FnConsensusReactor) SetSyncStatusProvider(provider SyncStatusProvider) {
+	f.syncMtx.Lock()
+	defer f.syncMtx.Unlock()
+	f.syncStatusProvider = provider
+}
+
+// IsSyncing returns true if the reactor determined the node was still catching up the last time
+// it checked.
+func (f *FnConsensusReactor) IsSyncing() bool {
+	f.syncMtx.Lock()
+	defer f.syncMtx.Unlock()
+	return f.syncing
+}
+
+func isBlockTimeLagExceeded(lastBlockTime time.Time, now time.Time, maxLag time.Duration) bool {
+	return maxLag > 0 && !lastBlockTime.IsZero() && now.Sub(lastBlockTime) > maxLag
+}
+
+// Checks if the node is catching up, either because the sync status provider says so, or because
+// the last block in the TM state is older than the configured MaxBlockTimeLag.
+func (f *FnConsensusReactor) isCatchingUp(now time.Time) bool {
+	f.syncMtx.Lock()
+	provider := f.syncStatusProvider
+	f.syncMtx.Unlock()
+
+	catchingUp := provider != nil && provider.IsCatchingUp()
+	if !catchingUp && f.cfg.MaxBlockTimeLag > 0 && f.tmStateDB != nil {
+		tmState := state.LoadState(f.tmStateDB)
+		catchingUp = isBlockTimeLagExceeded(tmState.LastBlockTime, now, f.cfg.MaxBlockTimeLag)
+	}
+
+	f.syncMtx.Lock()
+	defer f.syncMtx.Unlock()
+	if catchingUp != f.syncing {
+		if catchingUp {
+			f.Logger.Info("FnConsensusReactor: node is catching up, relaying messages only")
+		} else {
+			f.Logger.Info("FnConsensusReactor: node caught up, resuming voting")
+		}
+		f.syncing = catchingUp
+		f.health.setSyncing(catchingUp)
+	}
+	return catchingUp
+}
@@ -0,0 +1,173 @@
+package fnConsensus
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+// Decisions recorded in round traces.
+const (
+	// The round is still in progress.
+	RoundTraceDecisionPending = "pending"
+	// The validators converged on the same message this node computed.
+	RoundTraceDecisionAgree = "agree"
+	// The validators converged on a different message than the one this node computed.
+	RoundTraceDecisionDisagree = "disagree"
+	// The round ended without the validators converging.
+	RoundTraceDecisionNotConverged = "not_converged"
+)
+
+// RoundTrace records how this node executed a Fn in a single voting round, to help figure out why
+// validators disagree. Traces are only stored locally, they're never sent to peers.
+type RoundTrace struct {
+	FnID      string
+	Nonce     int64
+	FnVersion string
+	ExpiresAt int64
+	// Message computed by the Fn, truncated to RoundTraceMaxMessageSize bytes.
+	Message          []byte
+	MessageTruncated bool
+	Hash             []byte
+	HashAlgorithm    HashAlgorithm
+	// Unix timestamp (in nanoseconds) at which the Fn started executing.
+	StartedAt int64
+	// How long it took the Fn to compute the message (in nanoseconds).
+	ExecutionTime int64
+	Decision      string
+	// Hash of the message the validators converged on, if they did.
+	MajorityHash []byte
+}
+
+func (t *RoundTrace) Marshal() ([]byte, error) {
+	return cdc.MarshalBinaryLengthPrefixed(t)
+}
+
+func (t *RoundTrace) Unmarshal(bz []byte) error {
+	return cdc.UnmarshalBinaryLengthPrefixed(bz, t)
+}
+
+// Prefix of the keys under which round traces are stored.
+const roundTraceKeyPrefix = "fnConsensusReactor:trace:"
+
+// The Fn ID is prefixed with its length, otherwise the traces of a Fn whose ID contains ':' could be
+// mistaken for those of another Fn, e.g. the prefix of "fn" would match the traces of "fn:other".
+func roundTraceKeyPrefixForFn(fnID string) []byte {
+	return []byte(fmt.Sprintf("%s%d:%s:", roundTraceKeyPrefix, len(fnID), fnID))
+}
+
+func roundTraceKey(fnID string, nonce int64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", roundTraceKeyPrefixForFn(fnID), nonce))
+}
+
+// Stores the given trace, and deletes the oldest traces of the Fn so that at most maxTraces are kept.
+func saveRoundTrace(db dbm.DB, trace *RoundTrace, maxTraces int) error {
+	marshalledBytes, err := trace.Marshal()
+	if err != nil {
+		return err
+	}
+	db.Set(roundTraceKey(trace.FnID, trace.Nonce), marshalledBytes)
+
+	var keys [][]byte
+	it := dbm.IteratePrefix(db, roundTraceKeyPrefixForFn(trace.FnID))
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	it.Close()
+
+	for i := 0; i < len(keys)-maxTraces; i++ {
+		db.Delete(keys[i])
+	}
+	return nil
+}
+
+// LoadRoundTrace loads the trace of the given round from fnConsensus.db, returns nil if there is no
+// trace for the round.
+func LoadRoundTrace(db dbm.DB, fnID string, nonce int64) (*RoundTrace, error) {
+	traceBytes := db.Get(roundTraceKey(fnID, nonce))
+	if traceBytes == nil {
+		return nil, nil
+	}
+	trace := &RoundTrace{}
+	if err := trace.Unmarshal(traceBytes); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+// LoadRoundTraces loads all the traces of the given Fn from fnConsensus.db, in ascending nonce order.
+func LoadRoundTraces(db dbm.DB, fnID string) ([]*RoundTrace, error) {
+	it := dbm.IteratePrefix(db, roundTraceKeyPrefixForFn(fnID))
+	defer it.Close()
+
+	var traces []*RoundTrace
+	for ; it.Valid(); it.Next() {
+		trace := &RoundTrace{}
+		if err := trace.Unmarshal(it.Value()); err != nil {
+			return nil, err
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+// Records the execution of a Fn in the current round, does nothing if tracing is disabled.
+// NOTE: f.stateMtx must be held by the caller.
+func (f *FnConsensusReactor) traceExecution(
+	request *FnExecutionRequest, nonce int64, message []byte, hash []byte, hashAlgorithm HashAlgorithm,
+	startedAt time.Time, executionTime time.Duration,
+) {
+	if f.cfg.RoundTracesPerFn <= 0 {
+		return
+	}
+
+	trace := &RoundTrace{
+		FnID:          request.FnID,
+		Nonce:         nonce,
+		FnVersion:     request.FnVersion,
+		ExpiresAt:     request.ExpiresAt,
+		Message:       message,
+		Hash:          hash,
+		HashAlgorithm: hashAlgorithm,
+		StartedAt:     startedAt.UnixNano(),
+		ExecutionTime: int64(executionTime),
+		Decision:      RoundTraceDecisionPending,
+	}
+	if maxSize := f.cfg.RoundTraceMaxMessageSize; maxSize > 0 && len(message) > maxSize {
+		trace.Message = message[:maxSize]
+		trace.MessageTruncated = true
+	}
+
+	if err := saveRoundTrace(f.db, trace, f.cfg.RoundTracesPerFn); err != nil {
+		f.Logger.Error("FnConsensusReactor: unable to save round trace", "fnID", request.FnID, "err", err)
+	}
+}
+
+// Records the outcome of a round in its trace, majorityHash should be nil if the validators didn't
+// converge. Does nothing if tracing is disabled, or this node didn't execute the Fn in the round.
+func (f *FnConsensusReactor) traceDecision(fnID string, nonce int64, majorityHash []byte) {
+	if f.cfg.RoundTracesPerFn <= 0 {
+		return
+	}
+
+	trace, err := LoadRoundTrace(f.db, fnID, nonce)
+	if err != nil || trace == nil {
+		return
+	}
+
+	switch {
+	case majorityHash == nil:
+		trace.Decision = RoundTraceDecisionNotConverged
+	case bytes.Equal(trace.Hash, majorityHash):
+		trace.Decision = RoundTraceDecisionAgree
+	default:
+		trace.Decision = RoundTraceDecisionDisagree
+	}
+	trace.MajorityHash = majorityHash
+
+	if err := saveRoundTrace(f.db, trace, f.cfg.RoundTracesPerFn); err != nil {
+		f.Logger.Error("FnConsensusReactor: unable to save round trace", "fnID", fnID, "err", err)
+	}
+}
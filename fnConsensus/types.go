@@ -2,8 +2,11 @@ package fnConsensus
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -21,6 +24,12 @@ var (
 	ErrFnResponseSignatureAlreadyPresent = errors.New("Fn Response signature is already present")
 	ErrFnVoteMergeDiffPayload            = errors.New("merging is not allowed, as fn votes have different payload")
 	ErrPetitionVoteMergeDiffPayload      = errors.New("merging is not allowed, as petition votes have different payload")
+	ErrFnVoteMergeIncompleteVote         = errors.New("merging is not allowed, as fn vote is missing its response")
+	ErrFnVoteHashAlgorithmMismatch       = errors.New("Fn vote was hashed with a different algorithm")
+	ErrFnVersionMismatch                 = errors.New("Fn version mismatch")
+	ErrFnMessageTooSmall                 = errors.New("Fn message is smaller than the min message size")
+	ErrFnMessageTooLarge                 = errors.New("Fn message exceeds the max message size")
+	ErrReactorStateNotLoaded             = errors.New("reactor state isn't loaded")
 )
 
 type fnIDToNonce struct {
@@ -28,9 +37,15 @@ type fnIDToNonce struct {
 	FnID  string
 }
 
+type fnIDToCount struct {
+	Count int64
+	FnID  string
+}
+
 type FnIndividualExecutionResponse struct {
 	Hash            []byte
 	OracleSignature []byte
+	HashAlgorithm   HashAlgorithm
 }
 
 func (f *FnIndividualExecutionResponse) Marshal() ([]byte, error) {
@@ -41,17 +56,62 @@ type reactorStateMarshallable struct {
 	CurrentVoteSets          []*FnVoteSet
 	CurrentNonces            []*fnIDToNonce
 	PreviousTimedOutVoteSets []*FnVoteSet
-	PreviousMajVoteSets      []*FnVoteSet
-	PreviousValidatorSet     *types.ValidatorSet
+	// Deprecated: only used to load state persisted before Maj23 votesets were archived, these
+	//             are migrated to the archive by loadReactorState.
+	PreviousMajVoteSets     []*FnVoteSet
+	PreviousValidatorSet    *types.ValidatorSet
+	PreviousMaj23Summaries  []*Maj23Summary
+	DisabledFns             []string
+	ConsecutiveFailedRounds []*fnIDToCount
+	VoteObservations        []*VoteObservation
 }
 
 type ReactorState struct {
 	CurrentVoteSets          map[string]*FnVoteSet
 	CurrentNonces            map[string]int64
 	PreviousTimedOutVoteSets map[string]*FnVoteSet // TODO: unused, consider removing
-	PreviousMajVoteSets      map[string]*FnVoteSet
-	PreviousValidatorSet     *types.ValidatorSet
-	Messages                 map[string]Message
+	// Summaries of the last votesets that reached the signing threshold (per fnID), the votesets
+	// themselves are stored in the Maj23 archive.
+	PreviousMaj23Summaries map[string]*Maj23Summary
+	PreviousValidatorSet   *types.ValidatorSet
+	Messages               map[string]Message
+	// Fns that have been disabled by the operator, the reactor doesn't vote on these, but still keeps
+	// track of their nonces so they can resume where the other validators are when re-enabled.
+	DisabledFns map[string]bool
+	// Number of consecutive voting rounds that failed to converge (per fnID), reset whenever a
+	// voting round converges.
+	ConsecutiveFailedRounds map[string]int64
+	// Local record of when the votes in the votesets of the rounds in progress were first observed
+	// by this node (per fnID), dropped when the round ends.
+	VoteObservations map[string]*VoteObservation
+
+	// Maj23 votesets loaded from legacy state that haven't been archived yet.
+	legacyMajVoteSets []*FnVoteSet
+}
+
+// Maj23Summary is a light record of a voteset that reached the signing threshold.
+type Maj23Summary struct {
+	FnID           string
+	Nonce          int64
+	Hash           []byte
+	ValidatorsHash []byte
+}
+
+func NewMaj23Summary(
+	voteSet *FnVoteSet, signingThreshold SigningThreshold, validatorSet *types.ValidatorSet,
+) *Maj23Summary {
+	summary := &Maj23Summary{
+		FnID:           voteSet.GetFnID(),
+		Nonce:          voteSet.Nonce,
+		ValidatorsHash: voteSet.ValidatorsHash,
+	}
+	if validatorSet == nil || !bytes.Equal(voteSet.ValidatorsHash, validatorSet.Hash()) {
+		return summary
+	}
+	if majResponse := voteSet.MajResponse(signingThreshold, validatorSet); majResponse != nil {
+		summary.Hash = majResponse.Hash
+	}
+	return summary
 }
 
 type Message struct {
@@ -64,8 +124,11 @@ func NewReactorState() *ReactorState {
 		CurrentVoteSets:          make(map[string]*FnVoteSet),
 		CurrentNonces:            make(map[string]int64),
 		PreviousTimedOutVoteSets: make(map[string]*FnVoteSet),
-		PreviousMajVoteSets:      make(map[string]*FnVoteSet),
+		PreviousMaj23Summaries:   make(map[string]*Maj23Summary),
 		Messages:                 make(map[string]Message),
+		DisabledFns:              make(map[string]bool),
+		ConsecutiveFailedRounds:  make(map[string]int64),
+		VoteObservations:         make(map[string]*VoteObservation),
 	}
 }
 
@@ -74,8 +137,11 @@ func (p *ReactorState) Marshal() ([]byte, error) {
 		CurrentVoteSets:          make([]*FnVoteSet, len(p.CurrentVoteSets)),
 		CurrentNonces:            make([]*fnIDToNonce, len(p.CurrentNonces)),
 		PreviousTimedOutVoteSets: make([]*FnVoteSet, len(p.PreviousTimedOutVoteSets)),
-		PreviousMajVoteSets:      make([]*FnVoteSet, len(p.PreviousMajVoteSets)),
+		PreviousMaj23Summaries:   make([]*Maj23Summary, len(p.PreviousMaj23Summaries)),
 		PreviousValidatorSet:     p.PreviousValidatorSet,
+		DisabledFns:              make([]string, 0, len(p.DisabledFns)),
+		ConsecutiveFailedRounds:  make([]*fnIDToCount, 0, len(p.ConsecutiveFailedRounds)),
+		VoteObservations:         make([]*VoteObservation, 0, len(p.VoteObservations)),
 	}
 
 	i := 0
@@ -100,11 +166,31 @@ func (p *ReactorState) Marshal() ([]byte, error) {
 	}
 
 	i = 0
-	for _, maj23VoteSet := range p.PreviousMajVoteSets {
-		reactorStateMarshallable.PreviousMajVoteSets[i] = maj23VoteSet
+	for _, maj23Summary := range p.PreviousMaj23Summaries {
+		reactorStateMarshallable.PreviousMaj23Summaries[i] = maj23Summary
 		i++
 	}
 
+	for fnID, disabled := range p.DisabledFns {
+		if disabled {
+			reactorStateMarshallable.DisabledFns = append(reactorStateMarshallable.DisabledFns, fnID)
+		}
+	}
+	sort.Strings(reactorStateMarshallable.DisabledFns)
+
+	for fnID, count := range p.ConsecutiveFailedRounds {
+		if count > 0 {
+			reactorStateMarshallable.ConsecutiveFailedRounds = append(
+				reactorStateMarshallable.ConsecutiveFailedRounds,
+				&fnIDToCount{FnID: fnID, Count: count},
+			)
+		}
+	}
+
+	for _, observation := range p.VoteObservations {
+		reactorStateMarshallable.VoteObservations = append(reactorStateMarshallable.VoteObservations, observation)
+	}
+
 	return cdc.MarshalBinaryLengthPrefixed(reactorStateMarshallable)
 }
 
@@ -117,9 +203,13 @@ func (p *ReactorState) Unmarshal(bz []byte) error {
 	p.CurrentVoteSets = make(map[string]*FnVoteSet)
 	p.CurrentNonces = make(map[string]int64)
 	p.PreviousTimedOutVoteSets = make(map[string]*FnVoteSet)
-	p.PreviousMajVoteSets = make(map[string]*FnVoteSet)
+	p.PreviousMaj23Summaries = make(map[string]*Maj23Summary)
 	p.PreviousValidatorSet = reactorStateMarshallable.PreviousValidatorSet
 	p.Messages = make(map[string]Message)
+	p.DisabledFns = make(map[string]bool)
+	p.ConsecutiveFailedRounds = make(map[string]int64)
+	p.VoteObservations = make(map[string]*VoteObservation)
+	p.legacyMajVoteSets = reactorStateMarshallable.PreviousMajVoteSets
 
 	for _, voteSet := range reactorStateMarshallable.CurrentVoteSets {
 		p.CurrentVoteSets[voteSet.Payload.Request.FnID] = voteSet
@@ -133,15 +223,70 @@ func (p *ReactorState) Unmarshal(bz []byte) error {
 		p.PreviousTimedOutVoteSets[timeOutVoteSet.Payload.Request.FnID] = timeOutVoteSet
 	}
 
-	for _, maj23VoteSet := range reactorStateMarshallable.PreviousMajVoteSets {
-		p.PreviousMajVoteSets[maj23VoteSet.Payload.Request.FnID] = maj23VoteSet
+	for _, maj23Summary := range reactorStateMarshallable.PreviousMaj23Summaries {
+		p.PreviousMaj23Summaries[maj23Summary.FnID] = maj23Summary
+	}
+
+	for _, fnID := range reactorStateMarshallable.DisabledFns {
+		p.DisabledFns[fnID] = true
+	}
+
+	for _, fnIDToCount := range reactorStateMarshallable.ConsecutiveFailedRounds {
+		p.ConsecutiveFailedRounds[fnIDToCount.FnID] = fnIDToCount.Count
+	}
+
+	for _, observation := range reactorStateMarshallable.VoteObservations {
+		p.VoteObservations[observation.FnID] = observation
 	}
 
 	return nil
 }
 
+// IsFnEnabled returns false if the Fn has been disabled, all Fns are enabled by default.
+func (p *ReactorState) IsFnEnabled(fnID string) bool {
+	return !p.DisabledFns[fnID]
+}
+
+// Disabling a Fn drops the voteset of the round that's in progress, but the nonce & Maj23 summary
+// of the Fn are preserved.
+func (p *ReactorState) setFnEnabled(fnID string, enabled bool) {
+	if enabled {
+		delete(p.DisabledFns, fnID)
+		return
+	}
+	p.DisabledFns[fnID] = true
+	delete(p.CurrentVoteSets, fnID)
+	delete(p.VoteObservations, fnID)
+}
+
+// ConflictEvidence records two different votesets that reached the signing threshold for the same
+// fnID and nonce, which means the oracle has forked.
+type ConflictEvidence struct {
+	FnID          string
+	Nonce         int64
+	LocalHash     []byte
+	RemoteHash    []byte
+	LocalVoteSet  *FnVoteSet
+	RemoteVoteSet *FnVoteSet
+	// Unix timestamp (in seconds) at which the conflict was detected by this node
+	DetectedAt int64
+}
+
+func (c *ConflictEvidence) Marshal() ([]byte, error) {
+	return cdc.MarshalBinaryLengthPrefixed(c)
+}
+
+func (c *ConflictEvidence) Unmarshal(bz []byte) error {
+	return cdc.UnmarshalBinaryLengthPrefixed(bz, c)
+}
+
 type FnExecutionRequest struct {
 	FnID string
+	// Version of the Fn logic that generated the message, see FnMetadata.Version.
+	FnVersion string
+	// Unix timestamp (in seconds) after which the message can no longer be submitted, zero if the
+	// message doesn't expire, see ExpiryProvider.
+	ExpiresAt int64
 }
 
 func (f *FnExecutionRequest) Marshal() ([]byte, error) {
@@ -153,27 +298,42 @@ func (f *FnExecutionRequest) Unmarshal(bz []byte) error {
 }
 
 func (f *FnExecutionRequest) CannonicalCompare(remoteRequest *FnExecutionRequest) bool {
-	return f.FnID == remoteRequest.FnID
+	return f.FnID == remoteRequest.FnID && f.FnVersion == remoteRequest.FnVersion &&
+		f.ExpiresAt == remoteRequest.ExpiresAt
+}
+
+// IsExpired checks if the message can no longer be submitted at the given time.
+func (f *FnExecutionRequest) IsExpired(now time.Time) bool {
+	return f.ExpiresAt != 0 && now.Unix() > f.ExpiresAt
 }
 
 func (f *FnExecutionRequest) Compare(remoteRequest *FnExecutionRequest) bool {
 	return f.CannonicalCompare(remoteRequest)
 }
 
+// SignBytes returns the canonical encoding of the request, see signbytes.go.
 func (f *FnExecutionRequest) SignBytes() ([]byte, error) {
-	return f.Marshal()
+	return requestSignBytes(f), nil
 }
 
 func NewFnExecutionRequest(fnID string, registry FnRegistry) (*FnExecutionRequest, error) {
-	if registry.Get(fnID) == nil {
+	metadata := registry.GetMetadata(fnID)
+	if registry.Get(fnID) == nil || metadata == nil {
 		return nil, fmt.Errorf("invalid fnID: %s", fnID)
 	}
 
 	return &FnExecutionRequest{
-		FnID: fnID,
+		FnID:      fnID,
+		FnVersion: metadata.Version,
 	}, nil
 }
 
+// Bit arrays decoded from messages sent by peers may not have enough elements to store all the bits,
+// which would cause a panic when accessing the missing bits.
+func isValidBitArray(bitArray *cmn.BitArray) bool {
+	return bitArray != nil && bitArray.Bits >= 0 && len(bitArray.Elems) == (bitArray.Bits+63)/64
+}
+
 // FnAggregateExecutionResponse contains the result reached by consensus within the custom reactor.
 type FnAggregateExecutionResponse struct {
 	Hash              []byte
@@ -208,6 +368,9 @@ func (f *FnAggregateExecutionResponse) NumberOfAgreeVotes() int {
 }
 
 type FnExecutionResponse struct {
+	// Algorithm used by all validators to hash the message they voted on, an empty value means
+	// DefaultHashAlgorithm was used.
+	HashAlgorithm HashAlgorithm
 	// Hash of the message voted on by each validator.
 	// The message itself is obtained from GetMessageAndSignature.
 	Hashes [][]byte
@@ -223,6 +386,7 @@ func NewFnExecutionResponse(
 	individualResponse *FnIndividualExecutionResponse, validatorIndex int, valSet *types.ValidatorSet,
 ) *FnExecutionResponse {
 	execResp := &FnExecutionResponse{
+		HashAlgorithm:     individualResponse.HashAlgorithm,
 		Hashes:            make([][]byte, valSet.Size()),
 		OracleSignatures:  make([][]byte, valSet.Size()),
 		SignatureBitArray: cmn.NewBitArray(valSet.Size()),
@@ -278,14 +442,18 @@ func (f *FnExecutionResponse) IsValid(currentValidatorSet *types.ValidatorSet) e
 		return fmt.Errorf("executionResponse's hashes field cant be nil")
 	}
 
-	if f.SignatureBitArray == nil {
-		return fmt.Errorf("executionResponse's SignatureBitArray cant be nil")
+	if !isValidBitArray(f.SignatureBitArray) {
+		return fmt.Errorf("executionResponse's SignatureBitArray is malformed")
 	}
 
 	if f.OracleSignatures == nil {
 		return fmt.Errorf("executionResponse's OracleSignatures field cant be nil")
 	}
 
+	if !f.HashAlgorithm.IsValid() {
+		return fmt.Errorf("executionResponse's hash algorithm %s is not supported", f.HashAlgorithm)
+	}
+
 	if currentValidatorSet.Size() != len(f.OracleSignatures) {
 		return fmt.Errorf("executionResponse's oracle signature's length does not match current validator set's length")
 	}
@@ -316,6 +484,10 @@ func (f *FnExecutionResponse) IsValid(currentValidatorSet *types.ValidatorSet) e
 }
 
 func (f *FnExecutionResponse) CannonicalCompare(remoteResponse *FnExecutionResponse) bool {
+	if f.HashAlgorithm.Normalize() != remoteResponse.HashAlgorithm.Normalize() {
+		return false
+	}
+
 	if len(f.Hashes) != len(remoteResponse.Hashes) {
 		return false
 	}
@@ -331,13 +503,15 @@ func (f *FnExecutionResponse) CannonicalCompare(remoteResponse *FnExecutionRespo
 	return true
 }
 
+// SignBytes returns the canonical encoding of the response of the given validator, see signbytes.go.
 func (f *FnExecutionResponse) SignBytes(validatorIndex int) ([]byte, error) {
 	individualResponse := &FnIndividualExecutionResponse{
 		Hash:            f.Hashes[validatorIndex],
 		OracleSignature: f.OracleSignatures[validatorIndex],
+		HashAlgorithm:   f.HashAlgorithm,
 	}
 
-	return individualResponse.Marshal()
+	return individualResponseSignBytes(individualResponse), nil
 }
 
 func (f *FnExecutionResponse) Compare(remoteResponse *FnExecutionResponse) bool {
@@ -370,6 +544,10 @@ func (f *FnExecutionResponse) AddSignature(
 		return ErrFnResponseSignatureAlreadyPresent
 	}
 
+	if f.HashAlgorithm.Normalize() != individualResponse.HashAlgorithm.Normalize() {
+		return ErrFnVoteHashAlgorithmMismatch
+	}
+
 	f.OracleSignatures[validatorIndex] = individualResponse.OracleSignature
 	f.Hashes[validatorIndex] = individualResponse.Hash
 
@@ -547,6 +725,62 @@ type FnVoteSet struct {
 	Payload             *FnVotePayload `json:"vote_payload"`
 	ValidatorSignatures [][]byte       `json:"signature"`
 	ValidatorAddresses  [][]byte       `json:"validator_address"`
+	// Parameters the voteset converges under, nil in votesets created without them.
+	QuorumParams *QuorumParams `json:"quorum_params"`
+
+	// Encoding of the voteset cached by Marshal, cleared whenever the voteset is mutated.
+	marshalledBytes []byte
+}
+
+// QuorumParams are the parameters a voteset converges under, embedding them in the voteset makes
+// it possible to verify an archived voteset without relying on the config of the node it was
+// archived by. The parameters are covered by the signatures of the validators.
+type QuorumParams struct {
+	SigningThreshold SigningThreshold `json:"signing_threshold"`
+	// Voting power the votes in the voteset must add up to for the voteset to converge.
+	RequiredVotingPower int64 `json:"required_voting_power"`
+	// Voting power of each validator, in the same order as FnVoteSet.ValidatorAddresses.
+	VotingPowers []int64 `json:"voting_powers"`
+}
+
+func NewQuorumParams(signingThreshold SigningThreshold, valSet *types.ValidatorSet) *QuorumParams {
+	votingPowers := make([]int64, valSet.Size())
+	valSet.Iterate(func(index int, validator *types.Validator) bool {
+		votingPowers[index] = validator.VotingPower
+		return false
+	})
+	return &QuorumParams{
+		SigningThreshold:    signingThreshold,
+		RequiredVotingPower: signingThreshold.requiredVotingPower(valSet.TotalVotingPower()),
+		VotingPowers:        votingPowers,
+	}
+}
+
+func (p *QuorumParams) Equal(other *QuorumParams) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+	if p.SigningThreshold != other.SigningThreshold || p.RequiredVotingPower != other.RequiredVotingPower ||
+		len(p.VotingPowers) != len(other.VotingPowers) {
+		return false
+	}
+	for i := range p.VotingPowers {
+		if p.VotingPowers[i] != other.VotingPowers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks that the parameters are consistent with the given validator set.
+func (p *QuorumParams) validate(valSet *types.ValidatorSet) error {
+	if p.SigningThreshold != Maj23SigningThreshold && p.SigningThreshold != AllSigningThreshold {
+		return fmt.Errorf("unknown signing threshold: %s", p.SigningThreshold)
+	}
+	if !p.Equal(NewQuorumParams(p.SigningThreshold, valSet)) {
+		return errors.New("voting powers don't match the validator set")
+	}
+	return nil
 }
 
 // NewVoteSet creates a voteset with signed vote of a single validator.
@@ -557,6 +791,36 @@ func NewVoteSet(
 	initialPayload *FnVotePayload,
 	privValidator types.PrivValidator,
 	valSet *types.ValidatorSet,
+) (*FnVoteSet, error) {
+	return newVoteSet(nonce, chainID, validatorIndex, initialPayload, privValidator, valSet, nil)
+}
+
+// NewVoteSetWithQuorumParams creates a voteset with signed vote of a single validator, and embeds
+// the parameters the voteset converges under in it. Validators running versions of the reactor
+// that don't support quorum parameters can't verify the votes in such votesets.
+func NewVoteSetWithQuorumParams(
+	nonce int64,
+	chainID string,
+	validatorIndex int,
+	initialPayload *FnVotePayload,
+	privValidator types.PrivValidator,
+	valSet *types.ValidatorSet,
+	signingThreshold SigningThreshold,
+) (*FnVoteSet, error) {
+	return newVoteSet(
+		nonce, chainID, validatorIndex, initialPayload, privValidator, valSet,
+		NewQuorumParams(signingThreshold, valSet),
+	)
+}
+
+func newVoteSet(
+	nonce int64,
+	chainID string,
+	validatorIndex int,
+	initialPayload *FnVotePayload,
+	privValidator types.PrivValidator,
+	valSet *types.ValidatorSet,
+	quorumParams *QuorumParams,
 ) (*FnVoteSet, error) {
 	if err := initialPayload.IsValid(valSet); err != nil {
 		return nil, errors.Wrap(err, "initial payload is invalid")
@@ -588,6 +852,7 @@ func NewVoteSet(
 		VoteBitArray:        voteBitArray,
 		ValidatorSignatures: make([][]byte, valSet.Size()),
 		ValidatorAddresses:  validatorAddresses,
+		QuorumParams:        quorumParams,
 	}
 
 	signBytes, err := newVoteSet.SignBytes(validatorIndex)
@@ -605,14 +870,36 @@ func NewVoteSet(
 	return newVoteSet, nil
 }
 
+// Marshal encodes the voteset, the encoding is cached until the voteset is modified via AddVote,
+// Merge, or Unmarshal, so the returned bytes must not be modified by the caller.
 func (voteSet *FnVoteSet) Marshal() ([]byte, error) {
-	return cdc.MarshalBinaryLengthPrefixed(voteSet)
+	if voteSet.marshalledBytes != nil {
+		return voteSet.marshalledBytes, nil
+	}
+
+	marshalledBytes, err := cdc.MarshalBinaryLengthPrefixed(voteSet)
+	if err != nil {
+		return nil, err
+	}
+	voteSet.marshalledBytes = marshalledBytes
+	return marshalledBytes, nil
 }
 
 func (voteSet *FnVoteSet) Unmarshal(bz []byte) error {
+	voteSet.marshalledBytes = nil
 	return cdc.UnmarshalBinaryLengthPrefixed(bz, voteSet)
 }
 
+// ID returns a hash of the voteset contents that can be used to distinguish between votesets.
+func (voteSet *FnVoteSet) ID() ([]byte, error) {
+	marshalledBytes, err := voteSet.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(marshalledBytes)
+	return id[:], nil
+}
+
 func (voteSet *FnVoteSet) CannonicalCompare(remoteVoteSet *FnVoteSet) bool {
 	if voteSet.Nonce != remoteVoteSet.Nonce {
 		return false
@@ -649,7 +936,7 @@ func (voteSet *FnVoteSet) CannonicalCompare(remoteVoteSet *FnVoteSet) bool {
 		}
 	}
 
-	return true
+	return voteSet.QuorumParams.Equal(remoteVoteSet.QuorumParams)
 }
 
 func (voteset *FnVoteSet) ActiveValidators() [][]byte {
@@ -667,13 +954,14 @@ func (voteset *FnVoteSet) ActiveValidators() [][]byte {
 	return activeValidators[:j]
 }
 
+// SignBytes returns the bytes the validator with the given index signs when voting on the voteset,
+// these must never change, see signbytes.go.
 func (voteSet *FnVoteSet) SignBytes(validatorIndex int) ([]byte, error) {
 	payloadBytes, err := voteSet.Payload.SignBytes(validatorIndex)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Replace this with amino serialization.
 	var separator = []byte{17, 19, 23, 29}
 
 	prefix := []byte(fmt.Sprintf(
@@ -699,6 +987,11 @@ func (voteSet *FnVoteSet) SignBytes(validatorIndex int) ([]byte, error) {
 
 	copy(signBytes[numCopied:], payloadBytes)
 
+	if voteSet.QuorumParams != nil {
+		signBytes = append(signBytes, "|QP:"...)
+		signBytes = append(signBytes, quorumParamsSignBytes(voteSet.QuorumParams)...)
+	}
+
 	return signBytes, nil
 }
 
@@ -729,7 +1022,33 @@ func (voteSet *FnVoteSet) verifyInternal(
 	return nil
 }
 
+func (voteSet *FnVoteSet) validateFnVersion(metadata *FnMetadata) error {
+	if metadata == nil || voteSet.Payload.Request.FnVersion == metadata.Version {
+		return nil
+	}
+	return errors.Wrapf(
+		ErrFnVersionMismatch, "peer running %s %s, we run %s",
+		voteSet.GetFnID(), versionString(voteSet.Payload.Request.FnVersion), versionString(metadata.Version),
+	)
+}
+
+func versionString(version string) string {
+	if version == "" {
+		return "unversioned"
+	}
+	return version
+}
+
+// IsExpired checks if the message the voteset is for can no longer be submitted at the given time.
+func (voteSet *FnVoteSet) IsExpired(now time.Time) bool {
+	return voteSet.Payload.Request.IsExpired(now)
+}
+
+// GetFnID returns the fnID the voteset is for, or an empty string if the voteset is malformed.
 func (voteSet *FnVoteSet) GetFnID() string {
+	if voteSet.Payload == nil || voteSet.Payload.Request == nil {
+		return ""
+	}
 	return voteSet.Payload.Request.FnID
 }
 
@@ -744,18 +1063,27 @@ func (voteSet *FnVoteSet) NumberOfVotes() int {
 }
 
 // HasConverged checks if the given signing threshold has been reached, returns true if it has been,
-// and false otherwise.
+// and false otherwise. Votesets with embedded quorum parameters are evaluated against the embedded
+// parameters, and never converge if they were created with a different signing threshold.
 func (voteSet *FnVoteSet) HasConverged(
 	signingThreshold SigningThreshold, currentValidatorSet *types.ValidatorSet,
 ) bool {
-	switch signingThreshold {
-	case Maj23SigningThreshold:
-		return voteSet.TotalVotingPower >= currentValidatorSet.TotalVotingPower()*2/3+1
-	case AllSigningThreshold:
-		return voteSet.TotalVotingPower == currentValidatorSet.TotalVotingPower()
-	default:
-		panic("unknown signing threshold")
+	if params := voteSet.QuorumParams; params != nil {
+		return params.SigningThreshold == signingThreshold && voteSet.TotalVotingPower >= params.RequiredVotingPower
+	}
+	return voteSet.TotalVotingPower >= signingThreshold.requiredVotingPower(currentValidatorSet.TotalVotingPower())
+}
+
+// CheckSigningThreshold returns an *InvalidVoteSetError if the voteset embeds quorum parameters
+// with a signing threshold other than the given one.
+func (voteSet *FnVoteSet) CheckSigningThreshold(signingThreshold SigningThreshold) error {
+	if voteSet.QuorumParams == nil || voteSet.QuorumParams.SigningThreshold == signingThreshold {
+		return nil
 	}
+	return newInvalidVoteSetError(InvalidVoteSetQuorumParamsMismatch, -1, fmt.Errorf(
+		"voteSet signing threshold: %s doesn't match node's signing threshold: %s",
+		voteSet.QuorumParams.SigningThreshold, signingThreshold,
+	))
 }
 
 func (voteSet *FnVoteSet) HaveWeAlreadySigned(ownValidatorIndex int) bool {
@@ -763,71 +1091,93 @@ func (voteSet *FnVoteSet) HaveWeAlreadySigned(ownValidatorIndex int) bool {
 }
 
 // IsValid should be the first function to be invoked when a voteset is received from a peer.
+// The registry may be nil when validating votesets for Fns that are only being observed.
+// Returns an *InvalidVoteSetError describing why the voteset is invalid.
 func (voteSet *FnVoteSet) IsValid(chainID string, currentValidatorSet *types.ValidatorSet, registry FnRegistry) error {
 	var calculatedVotingPower int64
 
-	// This if conditions are individual as, we want to pass different errors for each
-	// condition in future.
-
-	if voteSet.VoteBitArray == nil {
-		return errors.New("voteSet.VoteBitArray can't be nil")
+	if !isValidBitArray(voteSet.VoteBitArray) {
+		return malformedVoteSet("voteSet.VoteBitArray is malformed")
 	}
 
 	numValidators := voteSet.VoteBitArray.Size()
 
 	if voteSet.Payload == nil {
-		return errors.New("voteSet.Payload can't be nil")
+		return malformedVoteSet("voteSet.Payload can't be nil")
 	}
 
 	if voteSet.ValidatorAddresses == nil {
-		return errors.New("voteSet.ValidatorAddresses can't be nil")
+		return malformedVoteSet("voteSet.ValidatorAddresses can't be nil")
 	}
 
 	if err := voteSet.Payload.IsValid(currentValidatorSet); err != nil {
-		return errors.Wrapf(err, "voteSet.Payload isnt valid")
+		return newInvalidVoteSetError(InvalidVoteSetPayload, -1, errors.Wrapf(err, "voteSet.Payload isnt valid"))
 	}
 
-	if registry.Get(voteSet.GetFnID()) == nil {
-		return errors.New("voteSet's FnID cannot be found in FnRegistry")
+	if registry != nil {
+		if registry.Get(voteSet.GetFnID()) == nil {
+			return newInvalidVoteSetError(
+				InvalidVoteSetUnknownFn, -1, errors.New("voteSet's FnID cannot be found in FnRegistry"),
+			)
+		}
+		if err := voteSet.validateFnVersion(registry.GetMetadata(voteSet.GetFnID())); err != nil {
+			return newInvalidVoteSetError(InvalidVoteSetFnVersionMismatch, -1, err)
+		}
 	}
 
 	if voteSet.ChainID != chainID {
-		return errors.New("voteSet.ChainID doesn't match node's ChainID")
+		return newInvalidVoteSetError(
+			InvalidVoteSetChainIDMismatch, -1, errors.New("voteSet.ChainID doesn't match node's ChainID"),
+		)
 	}
 
 	if !bytes.Equal(voteSet.ValidatorsHash, currentValidatorSet.Hash()) {
-		return fmt.Errorf("voteSet.ValidatorHash doesn't match node's validator hash, Expected: %v, Got: %v",
-			currentValidatorSet.Hash(), voteSet.ValidatorsHash)
+		return newInvalidVoteSetError(InvalidVoteSetValidatorSetMismatch, -1, fmt.Errorf(
+			"voteSet.ValidatorHash doesn't match node's validator hash, Expected: %v, Got: %v",
+			currentValidatorSet.Hash(), voteSet.ValidatorsHash,
+		))
 	}
 
 	if numValidators != len(voteSet.ValidatorAddresses) {
-		return errors.New("voteSet.ValidatorAddresses has different length than node's validator list")
+		return malformedVoteSet("voteSet.ValidatorAddresses has different length than node's validator list")
 	}
 
 	if numValidators != len(voteSet.ValidatorSignatures) {
-		return errors.New("voteSet.ValidatorSignatures has different length than node's validator list")
+		return malformedVoteSet("voteSet.ValidatorSignatures has different length than node's validator list")
 	}
 
 	if numValidators != currentValidatorSet.Size() {
-		return errors.New("voteSet.VoteBitArray size is different than current node's validator list")
+		return newInvalidVoteSetError(InvalidVoteSetValidatorSetMismatch, -1, errors.New(
+			"voteSet.VoteBitArray size is different than current node's validator list",
+		))
 	}
 
 	if numValidators != voteSet.Payload.Response.SignatureBitArray.Size() {
-		return errors.New(
+		return malformedVoteSet(
 			"voteSet.Payload.Response.SignatureBitArray size is different than current node's validator list",
 		)
 	}
 
+	if voteSet.QuorumParams != nil {
+		if err := voteSet.QuorumParams.validate(currentValidatorSet); err != nil {
+			return newInvalidVoteSetError(InvalidVoteSetQuorumParamsMismatch, -1, err)
+		}
+	}
+
 	var iteratingError error
 
 	currentValidatorSet.Iterate(func(i int, val *types.Validator) bool {
 		if !bytes.Equal(voteSet.ValidatorAddresses[i], val.Address) {
-			iteratingError = errors.New("voteSet.ValidatorAddresses  and current validator set mismatch")
+			iteratingError = newInvalidVoteSetError(InvalidVoteSetValidatorSetMismatch, i, errors.New(
+				"voteSet.ValidatorAddresses  and current validator set mismatch",
+			))
 			return true
 		}
 
 		if voteSet.VoteBitArray.GetIndex(i) != voteSet.Payload.Response.SignatureBitArray.GetIndex(i) {
-			iteratingError = errors.New("voteSet.VoteBitArray and voteSet.Payload.Response.SignatureBitArray mismatch")
+			iteratingError = newInvalidVoteSetError(InvalidVoteSetMalformed, i, errors.New(
+				"voteSet.VoteBitArray and voteSet.Payload.Response.SignatureBitArray mismatch",
+			))
 			return true
 		}
 
@@ -836,12 +1186,16 @@ func (voteSet *FnVoteSet) IsValid(chainID string, currentValidatorSet *types.Val
 		}
 
 		if voteSet.Payload.Response.OracleSignatures[i] == nil {
-			iteratingError = errors.New("voteSet.Payload.Response.OracleSignature and voteSet.VoteBitArray mismatch")
+			iteratingError = newInvalidVoteSetError(InvalidVoteSetMalformed, i, errors.New(
+				"voteSet.Payload.Response.OracleSignature and voteSet.VoteBitArray mismatch",
+			))
 			return true
 		}
 
 		if err := voteSet.VerifyValidatorSign(i, val.PubKey); err != nil {
-			iteratingError = errors.New(fmt.Sprintf("unable to verify validator sign, PubKey: %s\n", val.PubKey))
+			iteratingError = newInvalidVoteSetError(InvalidVoteSetSignature, i, errors.Wrapf(
+				err, "unable to verify validator sign, PubKey: %s", val.PubKey,
+			))
 			return true
 		}
 
@@ -855,36 +1209,51 @@ func (voteSet *FnVoteSet) IsValid(chainID string, currentValidatorSet *types.Val
 
 	// Voting power contained in VoteSet should match the calculated voting power
 	if voteSet.TotalVotingPower != calculatedVotingPower {
-		return errors.New("voteSet.TotalVotingPower is not equal to calculated voting power")
+		return newInvalidVoteSetError(InvalidVoteSetVotingPowerMismatch, -1, errors.New(
+			"voteSet.TotalVotingPower is not equal to calculated voting power",
+		))
 	}
 
 	return nil
 }
 
+// Merge adds the votes from another voteset that are missing from this one, and returns true if
+// any votes were added. All the missing votes are checked before any of them are added, so the
+// voteset is never left partially merged (e.g. with a vote that lacks its oracle signature).
 func (voteSet *FnVoteSet) Merge(valSet *types.ValidatorSet, anotherSet *FnVoteSet) (bool, error) {
-	hasChanged := false
+	voteSet.marshalledBytes = nil
 
 	if !voteSet.CannonicalCompare(anotherSet) {
-		return hasChanged, ErrFnVoteMergeDiffPayload
+		return false, ErrFnVoteMergeDiffPayload
 	}
 
 	numValidators := voteSet.VoteBitArray.Size()
+	anotherResponse := anotherSet.Payload.Response
 
-	hasPayloadChanged, err := voteSet.Payload.Merge(anotherSet.Payload)
-	if err != nil {
-		return false, err
-	}
-
-	hasChanged = hasPayloadChanged
-
+	var missingVotes []int
 	for i := 0; i < numValidators; i++ {
 		if voteSet.VoteBitArray.GetIndex(i) || !anotherSet.VoteBitArray.GetIndex(i) {
 			continue
 		}
 
+		if !anotherResponse.SignatureBitArray.GetIndex(i) || anotherResponse.OracleSignatures[i] == nil {
+			return false, ErrFnVoteMergeIncompleteVote
+		}
+
+		if _, currentValidator := valSet.GetByIndex(i); currentValidator == nil {
+			return false, ErrFnVoteInvalidValidatorAddress
+		}
+
+		missingVotes = append(missingVotes, i)
+	}
+
+	response := voteSet.Payload.Response
+	for _, i := range missingVotes {
 		_, currentValidator := valSet.GetByIndex(i)
 
-		hasChanged = true
+		response.OracleSignatures[i] = anotherResponse.OracleSignatures[i]
+		response.Hashes[i] = anotherResponse.Hashes[i]
+		response.SignatureBitArray.SetIndex(i, true)
 
 		voteSet.ValidatorSignatures[i] = anotherSet.ValidatorSignatures[i]
 		voteSet.ValidatorAddresses[i] = anotherSet.ValidatorAddresses[i]
@@ -894,12 +1263,38 @@ func (voteSet *FnVoteSet) Merge(valSet *types.ValidatorSet, anotherSet *FnVoteSe
 		voteSet.TotalVotingPower += currentValidator.VotingPower
 	}
 
-	return hasChanged, nil
+	return len(missingVotes) > 0, nil
+}
+
+// Checks that every signature in the given response to this voteset belongs to a vote in the
+// voteset, and that every agree vote in the voteset contributed its signature to the response.
+func (voteSet *FnVoteSet) checkAgreeSignatures(majResponse *FnAggregateExecutionResponse) error {
+	response := voteSet.Payload.Response
+	if len(majResponse.OracleSignatures) != len(response.OracleSignatures) {
+		return errors.New("number of agree signatures doesn't match the number of validators")
+	}
+
+	for i, signature := range majResponse.OracleSignatures {
+		isAgreeVote := voteSet.VoteBitArray.GetIndex(i) && bytes.Equal(response.Hashes[i], majResponse.Hash)
+		if majResponse.SignatureBitArray.GetIndex(i) != isAgreeVote {
+			return fmt.Errorf("agree vote of validator %d doesn't match the voteset", i)
+		}
+		if isAgreeVote && (signature == nil || !bytes.Equal(signature, response.OracleSignatures[i])) {
+			return fmt.Errorf("agree signature of validator %d doesn't match the voteset", i)
+		}
+		if !isAgreeVote && signature != nil {
+			return fmt.Errorf("validator %d didn't vote for the agreed message, but has an agree signature", i)
+		}
+	}
+	return nil
 }
 
 func (voteSet *FnVoteSet) MajResponse(
 	signingThreshold SigningThreshold, validatorSet *types.ValidatorSet,
 ) *FnAggregateExecutionResponse {
+	if voteSet.QuorumParams != nil && voteSet.QuorumParams.SigningThreshold != signingThreshold {
+		return nil
+	}
 	return voteSet.Payload.Response.ToMajResponse(signingThreshold, validatorSet)
 }
 
@@ -910,6 +1305,8 @@ func (voteSet *FnVoteSet) AddVote(
 	validatorIndex int,
 	privValidator types.PrivValidator,
 ) error {
+	voteSet.marshalledBytes = nil
+
 	if voteSet.Nonce != nonce {
 		return errors.New("FnConsensusReactor: unable to add vote as nonce is different from voteset")
 	}
@@ -962,4 +1359,7 @@ func RegisterFnConsensusTypes() {
 	cdc.RegisterConcrete(&ReactorState{}, "tendermint/fnConsensusReactor/ReactorState", nil)
 	cdc.RegisterConcrete(&reactorStateMarshallable{}, "tendermint/fnConsensusReactor/reactorStateMarshallable", nil)
 	cdc.RegisterConcrete(&fnIDToNonce{}, "tendermint/fnConsensusReactor/fnIDToNonce", nil)
+	cdc.RegisterConcrete(&Maj23Summary{}, "tendermint/fnConsensusReactor/Maj23Summary", nil)
+	cdc.RegisterConcrete(&ConflictEvidence{}, "tendermint/fnConsensusReactor/ConflictEvidence", nil)
+	cdc.RegisterConcrete(&RoundTrace{}, "tendermint/fnConsensusReactor/RoundTrace", nil)
 }
@@ -0,0 +1,72 @@
+package fnConsensus
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// InvalidVoteSetReason classifies the reason a voteset failed validation.
+type InvalidVoteSetReason string
+
+const (
+	// The voteset is structurally broken, e.g. missing fields or inconsistent array sizes.
+	InvalidVoteSetMalformed InvalidVoteSetReason = "malformed"
+	// The vote payload (request or response) failed validation.
+	InvalidVoteSetPayload InvalidVoteSetReason = "invalid_payload"
+	// The Fn the voteset is for isn't registered on this node.
+	InvalidVoteSetUnknownFn InvalidVoteSetReason = "unknown_fn"
+	// The voteset was produced by a different version of the Fn.
+	InvalidVoteSetFnVersionMismatch InvalidVoteSetReason = "fn_version_mismatch"
+	// The voteset was produced on a different chain.
+	InvalidVoteSetChainIDMismatch InvalidVoteSetReason = "chain_id_mismatch"
+	// The voteset was produced by a different validator set.
+	InvalidVoteSetValidatorSetMismatch InvalidVoteSetReason = "validator_set_mismatch"
+	// The signature of one of the votes couldn't be verified.
+	InvalidVoteSetSignature InvalidVoteSetReason = "invalid_signature"
+	// The total voting power doesn't match the voting power of the votes.
+	InvalidVoteSetVotingPowerMismatch InvalidVoteSetReason = "voting_power_mismatch"
+	// The quorum parameters embedded in the voteset don't match the validator set or the node's
+	// signing threshold.
+	InvalidVoteSetQuorumParamsMismatch InvalidVoteSetReason = "quorum_params_mismatch"
+)
+
+// InvalidVoteSetError is returned by FnVoteSet.IsValid when a voteset fails validation.
+type InvalidVoteSetError struct {
+	Reason InvalidVoteSetReason
+	// Index of the offending validator, or -1 if the failure isn't specific to a single validator.
+	ValidatorIndex int
+	Err            error
+}
+
+func newInvalidVoteSetError(reason InvalidVoteSetReason, validatorIndex int, err error) *InvalidVoteSetError {
+	return &InvalidVoteSetError{
+		Reason:         reason,
+		ValidatorIndex: validatorIndex,
+		Err:            err,
+	}
+}
+
+func (e *InvalidVoteSetError) Error() string {
+	if e.ValidatorIndex >= 0 {
+		return fmt.Sprintf("invalid voteset (%s, validator %d): %v", e.Reason, e.ValidatorIndex, e.Err)
+	}
+	return fmt.Sprintf("invalid voteset (%s): %v", e.Reason, e.Err)
+}
+
+// Cause allows errors.Cause to unwrap the underlying error.
+func (e *InvalidVoteSetError) Cause() error {
+	return e.Err
+}
+
+// invalidVoteSetReason returns the reason the given error was returned by FnVoteSet.IsValid.
+func invalidVoteSetReason(err error) InvalidVoteSetReason {
+	if invalidErr, ok := err.(*InvalidVoteSetError); ok {
+		return invalidErr.Reason
+	}
+	return InvalidVoteSetMalformed
+}
+
+func malformedVoteSet(msg string) error {
+	return newInvalidVoteSetError(InvalidVoteSetMalformed, -1, errors.New(msg))
+}
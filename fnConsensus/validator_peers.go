@@ -0,0 +1,124 @@
+package fnConsensus
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/p2p"
+	"github.com/tendermint/tendermint/types"
+)
+
+// ValidatorPeer identifies the node a member of the current validator set is running on.
+type ValidatorPeer struct {
+	NodeID           p2p.ID
+	ValidatorAddress crypto.Address
+	// host:port the node can be dialed on, empty if it hasn't been configured.
+	NetAddress string
+	// Set if the node is currently connected to this node.
+	Connected bool
+}
+
+// DialString returns the address of the node in the id@host:port format, or an empty string if the
+// net address of the node hasn't been configured.
+func (p *ValidatorPeer) DialString() string {
+	if p.NetAddress == "" {
+		return ""
+	}
+	return p2p.IDAddressString(p.NodeID, p.NetAddress)
+}
+
+// ValidatorPeers returns the nodes the other members of the current validator set are running on,
+// as mapped by the ValidatorPeers setting, sorted by node ID.
+func (f *FnConsensusReactor) ValidatorPeers() []*ValidatorPeer {
+	if !f.hasStaticValidators() && f.tmStateDB == nil {
+		return nil
+	}
+	return f.validatorPeers(f.getValidatorSet())
+}
+
+// SetValidatorPeersChangedHandler sets a function that will be invoked whenever the nodes the
+// members of the current validator set are running on change, so that the embedding node can
+// connect to them. The function is invoked again every time the validator peers are refreshed
+// while any of them that can be dialed isn't connected, and stops being invoked for a node once it
+// leaves the validator set, so the embedding node doesn't need to dial them as persistent peers.
+// The reactor doesn't dial any peers itself.
+func (f *FnConsensusReactor) SetValidatorPeersChangedHandler(handler func(peers []*ValidatorPeer)) {
+	f.validatorPeersMtx.Lock()
+	defer f.validatorPeersMtx.Unlock()
+	f.validatorPeersChangedHandler = handler
+}
+
+func (f *FnConsensusReactor) validatorPeers(currentValidators *types.ValidatorSet) []*ValidatorPeer {
+	var ownAddress crypto.Address
+	if f.privValidator != nil {
+		ownAddress = f.privValidator.GetPubKey().Address()
+	}
+
+	f.peerMapMtx.RLock()
+	defer f.peerMapMtx.RUnlock()
+
+	peers := make([]*ValidatorPeer, 0, len(f.cfg.ValidatorPeers))
+	for nodeID, validatorAddress := range f.cfg.ValidatorPeers {
+		if bytes.Equal(validatorAddress, ownAddress) {
+			continue
+		}
+		if validatorIndex, _ := currentValidators.GetByAddress(validatorAddress); validatorIndex == -1 {
+			continue
+		}
+		_, connected := f.connectedPeers[nodeID]
+		peers = append(peers, &ValidatorPeer{
+			NodeID:           nodeID,
+			ValidatorAddress: validatorAddress,
+			NetAddress:       f.cfg.ValidatorPeerNetAddresses[nodeID],
+			Connected:        connected,
+		})
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].NodeID < peers[j].NodeID
+	})
+	return peers
+}
+
+// Updates the connected validator peers metric, and notifies the handler set via
+// SetValidatorPeersChangedHandler if the validator set change affected the validator peers, or if
+// any of the validator peers that can be dialed isn't connected.
+func (f *FnConsensusReactor) refreshValidatorPeers(currentValidators *types.ValidatorSet) {
+	peers := f.validatorPeers(currentValidators)
+
+	nodeIDs := make([]p2p.ID, len(peers))
+	connected := 0
+	needDialing := false
+	for i, peer := range peers {
+		nodeIDs[i] = peer.NodeID
+		if peer.Connected {
+			connected++
+		} else if peer.DialString() != "" {
+			needDialing = true
+		}
+	}
+	connectedValidatorPeersGauge.Set(float64(connected))
+
+	f.validatorPeersMtx.Lock()
+	defer f.validatorPeersMtx.Unlock()
+
+	if f.validatorPeerIDs != nil && equalNodeIDs(f.validatorPeerIDs, nodeIDs) && !needDialing {
+		return
+	}
+	f.validatorPeerIDs = nodeIDs
+	if f.validatorPeersChangedHandler != nil {
+		f.validatorPeersChangedHandler(peers)
+	}
+}
+
+func equalNodeIDs(a, b []p2p.ID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
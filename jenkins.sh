@@ -51,6 +51,7 @@ cp loom loom-gateway
 
 make loom-cleveldb
 make basechain-cleveldb
+make loom-e2e-fn
 
 # lint after building everything
 make lint || true
@@ -8,7 +8,9 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/loomnetwork/go-loom/plugin/types"
 	"github.com/loomnetwork/loomchain/config"
+	"github.com/loomnetwork/loomchain/fnConsensus"
 	"github.com/loomnetwork/loomchain/rpc/eth"
+	"github.com/loomnetwork/loomchain/throttle"
 	"github.com/loomnetwork/loomchain/vm"
 	rpctypes "github.com/tendermint/tendermint/rpc/lib/types"
 )
@@ -125,6 +127,48 @@ func (m InstrumentingMiddleware) GetContractRecord(contractAddr string) (resp *t
 	return
 }
 
+func (m InstrumentingMiddleware) ThrottleQuota(address string) (resp *throttle.OriginQuota, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "ThrottleQuota", "error", fmt.Sprint(err != nil)}
+		m.requestCount.With(lvs...).Add(1)
+		m.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	resp, err = m.next.ThrottleQuota(address)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (m InstrumentingMiddleware) ThrottleRegisterBypass(token string) (resp *throttle.BypassGrant, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "ThrottleRegisterBypass", "error", fmt.Sprint(err != nil)}
+		m.requestCount.With(lvs...).Add(1)
+		m.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	resp, err = m.next.ThrottleRegisterBypass(token)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (m InstrumentingMiddleware) FnConsensusStatus() (resp []*fnConsensus.FnStatus, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "FnConsensusStatus", "error", fmt.Sprint(err != nil)}
+		m.requestCount.With(lvs...).Add(1)
+		m.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	resp, err = m.next.FnConsensusStatus()
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
 func (m InstrumentingMiddleware) DPOSTotalStaked() (resp *DPOSTotalStakedResponse, err error) {
 	defer func(begin time.Time) {
 		lvs := []string{"method", "DposTotalStaked", "error", fmt.Sprint(err != nil)}
@@ -9,7 +9,9 @@ import (
 	"github.com/loomnetwork/go-loom/plugin/types"
 
 	"github.com/loomnetwork/loomchain/config"
+	"github.com/loomnetwork/loomchain/fnConsensus"
 	"github.com/loomnetwork/loomchain/rpc/eth"
+	"github.com/loomnetwork/loomchain/throttle"
 	"github.com/loomnetwork/loomchain/vm"
 )
 
@@ -275,6 +277,21 @@ func (m *MockQueryService) DPOSTotalStaked() (*DPOSTotalStakedResponse, error) {
 	return nil, nil
 }
 
+func (m *MockQueryService) ThrottleQuota(address string) (*throttle.OriginQuota, error) {
+	m.MethodsCalled = append([]string{"ThrottleQuota"}, m.MethodsCalled...)
+	return nil, nil
+}
+
+func (m *MockQueryService) ThrottleRegisterBypass(token string) (*throttle.BypassGrant, error) {
+	m.MethodsCalled = append([]string{"ThrottleRegisterBypass"}, m.MethodsCalled...)
+	return nil, nil
+}
+
+func (m *MockQueryService) FnConsensusStatus() ([]*fnConsensus.FnStatus, error) {
+	m.MethodsCalled = append([]string{"FnConsensusStatus"}, m.MethodsCalled...)
+	return nil, nil
+}
+
 func (m *MockQueryService) GetCanonicalTxHash(block, txIndex uint64, evmTxHash eth.Data) (eth.Data, error) {
 	m.MethodsCalled = append([]string{"GetCanonicalTxHash"}, m.MethodsCalled...)
 	return "", nil
@@ -35,6 +35,7 @@ import (
 	"github.com/loomnetwork/loomchain/eth/subs"
 	"github.com/loomnetwork/loomchain/eth/utils"
 	levm "github.com/loomnetwork/loomchain/evm"
+	"github.com/loomnetwork/loomchain/fnConsensus"
 	"github.com/loomnetwork/loomchain/log"
 	lcp "github.com/loomnetwork/loomchain/plugin"
 	hsmpv "github.com/loomnetwork/loomchain/privval/hsm"
@@ -45,6 +46,7 @@ import (
 	"github.com/loomnetwork/loomchain/store"
 	blockindex "github.com/loomnetwork/loomchain/store/block_index"
 	evmaux "github.com/loomnetwork/loomchain/store/evm_aux"
+	"github.com/loomnetwork/loomchain/throttle"
 	lvm "github.com/loomnetwork/loomchain/vm"
 )
 
@@ -136,6 +138,10 @@ type QueryServer struct {
 	Web3Cfg           *eth.Web3Config
 	totalStakedAmount *totalStakedAmount
 	DPOSCfg           *config.DPOSConfig
+	// Answers throttle quota queries, if nil the throttle is considered to be disabled.
+	ThrottleAdmin *throttle.Admin
+	// Answers fnConsensus status queries, nil if the reactor isn't running on this node.
+	FnConsensus *fnConsensus.FnConsensusReactor
 }
 
 type totalStakedAmount struct {
@@ -609,6 +615,43 @@ func (s *QueryServer) GetContractRecord(contractAddrStr string) (*types.Contract
 	return k, nil
 }
 
+// ThrottleQuota returns how much of each of its tx budgets the given origin has left in its current
+// throttle session. If the throttle keeps its session records in memory the quota only reflects the
+// txs seen by this node.
+func (s *QueryServer) ThrottleQuota(address string) (*throttle.OriginQuota, error) {
+	if s.ThrottleAdmin == nil {
+		return nil, throttle.ErrThrottleNotEnabled
+	}
+	snapshot := s.StateProvider.ReadOnlyState()
+	defer snapshot.Release()
+
+	// The address may be given in any of the forms the throttle tracks under the same origin.
+	origin, err := throttle.ParseOrigin(address, snapshot.Block().ChainID)
+	if err != nil {
+		return nil, err
+	}
+	return s.ThrottleAdmin.Quota(snapshot, origin)
+}
+
+// ThrottleRegisterBypass registers a bypass token signed by the throttle operator key, granting the
+// origin it's bound to the call limit it carries until it expires. The grant only applies to the
+// txs this node checks.
+func (s *QueryServer) ThrottleRegisterBypass(token string) (*throttle.BypassGrant, error) {
+	if s.ThrottleAdmin == nil {
+		return nil, throttle.ErrThrottleNotEnabled
+	}
+	return s.ThrottleAdmin.RegisterBypassToken(token)
+}
+
+// FnConsensusStatus returns the status of each Fn the fnConsensus reactor of this node votes on,
+// including whether the Fn has been disabled.
+func (s *QueryServer) FnConsensusStatus() ([]*fnConsensus.FnStatus, error) {
+	if s.FnConsensus == nil {
+		return nil, fnConsensus.ErrReactorStateNotLoaded
+	}
+	return s.FnConsensus.FnStatuses()
+}
+
 type DPOSTotalStakedResponse struct {
 	TotalStaked *gtypes.BigUInt
 }
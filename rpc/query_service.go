@@ -16,8 +16,10 @@ import (
 	"github.com/loomnetwork/loomchain"
 	"github.com/loomnetwork/loomchain/config"
 	"github.com/loomnetwork/loomchain/eth/subs"
+	"github.com/loomnetwork/loomchain/fnConsensus"
 	"github.com/loomnetwork/loomchain/log"
 	"github.com/loomnetwork/loomchain/rpc/eth"
+	"github.com/loomnetwork/loomchain/throttle"
 	"github.com/loomnetwork/loomchain/vm"
 )
 
@@ -65,6 +67,9 @@ type QueryService interface {
 	GetContractRecord(contractAddr string) (*types.ContractRecordResponse, error)
 	DPOSTotalStaked() (*DPOSTotalStakedResponse, error)
 	GetCanonicalTxHash(block, txIndex uint64, evmTxHash eth.Data) (eth.Data, error)
+	ThrottleQuota(address string) (*throttle.OriginQuota, error)
+	ThrottleRegisterBypass(token string) (*throttle.BypassGrant, error)
+	FnConsensusStatus() ([]*fnConsensus.FnStatus, error)
 
 	// deprecated function
 	EvmTxReceipt(txHash []byte) ([]byte, error)
@@ -134,6 +139,9 @@ func MakeQueryServiceHandler(svc QueryService, logger log.TMLogger, bus *QueryEv
 	routes["contractrecord"] = rpcserver.NewRPCFunc(svc.GetContractRecord, "contract")
 	routes["dpos_total_staked"] = rpcserver.NewRPCFunc(svc.DPOSTotalStaked, "")
 	routes["canonical_tx_hash"] = rpcserver.NewRPCFunc(svc.GetCanonicalTxHash, "block,txIndex,evmTxHash")
+	routes["throttle_quota"] = rpcserver.NewRPCFunc(svc.ThrottleQuota, "address")
+	routes["throttle_register_bypass"] = rpcserver.NewRPCFunc(svc.ThrottleRegisterBypass, "token")
+	routes["fn_consensus_status"] = rpcserver.NewRPCFunc(svc.FnConsensusStatus, "")
 	rpcserver.RegisterRPCFuncs(wsmux, routes, codec, logger)
 	wm := rpcserver.NewWebsocketManager(routes, codec, rpcserver.EventSubscriber(bus))
 	wsmux.HandleFunc("/queryws", wm.WebsocketHandler)
@@ -212,8 +220,9 @@ func MakeEthQueryServiceHandler(logger log.TMLogger, hub *Hub, routes map[string
 	return mux
 }
 
-// MakeUnsafeQueryServiceHandler returns a http handler for unsafe RPC routes
-func MakeUnsafeQueryServiceHandler(logger log.TMLogger) http.Handler {
+// MakeUnsafeQueryServiceHandler returns a http handler for unsafe RPC routes, extraRoutes are served
+// in addition to the built-in routes.
+func MakeUnsafeQueryServiceHandler(logger log.TMLogger, extraRoutes map[string]*rpcserver.RPCFunc) http.Handler {
 	codec := amino.NewCodec()
 	mux := http.NewServeMux()
 	routes := map[string]*rpcserver.RPCFunc{}
@@ -226,6 +235,10 @@ func MakeUnsafeQueryServiceHandler(logger log.TMLogger) http.Handler {
 	routes["unsafe_stop_cpu_profiler"] = rpcserver.NewRPCFunc(rpccore.UnsafeStopCPUProfiler, "")
 	routes["unsafe_write_heap_profile"] = rpcserver.NewRPCFunc(rpccore.UnsafeWriteHeapProfile, "filename")
 
+	for name, route := range extraRoutes {
+		routes[name] = route
+	}
+
 	rpcserver.RegisterRPCFuncs(mux, routes, codec, logger)
 	return mux
 }
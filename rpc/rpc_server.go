@@ -35,10 +35,11 @@ func init() {
 		"tendermint/PrivKeySecp256k1", nil)
 }
 
-// RPCServer starts up HTTP servers that handle client requests.
+// RPCServer starts up HTTP servers that handle client requests. The given unsafe routes are served
+// alongside the built-in ones by the unsafe RPC server, if it's enabled.
 func RPCServer(
 	qsvc QueryService, chainID string, logger log.TMLogger, bus *QueryEventBus, bindAddr string,
-	enableUnsafeRPC bool, unsafeRPCBindAddress string,
+	enableUnsafeRPC bool, unsafeRPCBindAddress string, unsafeRoutes map[string]*rpcserver.RPCFunc,
 ) error {
 	queryHandler := MakeQueryServiceHandler(qsvc, logger, bus)
 	hub := newHub()
@@ -94,7 +95,7 @@ func RPCServer(
 
 	if enableUnsafeRPC {
 		unsafeLogger := logger.With("interface", "unsafe")
-		unsafeHandler := MakeUnsafeQueryServiceHandler(unsafeLogger)
+		unsafeHandler := MakeUnsafeQueryServiceHandler(unsafeLogger, unsafeRoutes)
 		unsafeListener, err := rpcserver.Listen(
 			unsafeRPCBindAddress,
 			rpcserver.Config{MaxOpenConnections: 0},
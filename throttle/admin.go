@@ -0,0 +1,226 @@
+package throttle
+
+import (
+	"sync"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/util"
+	"github.com/loomnetwork/loomchain"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrThrottleNotEnabled is returned by Admin when it hasn't been passed to a middleware.
+	ErrThrottleNotEnabled = errors.New("throttle is not enabled")
+	// ErrResetRequiresTx is returned by Admin.ResetOrigin when the throttle keeps its session records
+	// in the app state, in which case they can only be reset deterministically by a throttle admin tx
+	// (see AdminTx.ResetOrigin).
+	ErrResetRequiresTx = errors.New("throttle records are stored in the app state, reset them via a tx")
+)
+
+// Admin performs administrative operations & queries on the throttle of a karma middleware, it has
+// no effect until it's passed to GetKarmaMiddleWare with WithAdmin.
+type Admin struct {
+	throttle *Throttle
+	// Returns the latest app state, nil if origins are reset by their address as given.
+	readState func() loomchain.State
+	mtx       sync.Mutex
+}
+
+func NewAdmin() *Admin {
+	return &Admin{}
+}
+
+// SetStateProvider makes the admin resolve the key the txs of an origin are tracked under from the
+// latest app state returned by readState before resetting its records, so an origin is reset under
+// the same key its txs are counted & its quota is queried under (see ParseOrigin).
+func (a *Admin) SetStateProvider(readState func() loomchain.State) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.readState = readState
+}
+
+// WithAdmin makes the middleware accept administrative operations from the given admin.
+func WithAdmin(admin *Admin) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		admin.mtx.Lock()
+		defer admin.mtx.Unlock()
+		admin.throttle = th
+	}
+}
+
+// ResetOriginResult is the result of resetting the throttle records of an origin.
+type ResetOriginResult struct {
+	Origin string `json:"origin"`
+	// False if the throttle had no records for the origin.
+	Reset bool `json:"reset"`
+}
+
+// ResetOrigin discards the session records of the given origin, so it can send txs up to its limits
+// again straight away. Only records kept in the memory of this node can be reset this way, records
+// kept in the app state must be reset by a privileged tx so all the nodes reset them at the same
+// height.
+func (a *Admin) ResetOrigin(origin loom.Address) (*ResetOriginResult, error) {
+	a.mtx.Lock()
+	th := a.throttle
+	readState := a.readState
+	a.mtx.Unlock()
+
+	if th == nil {
+		return nil, ErrThrottleNotEnabled
+	}
+	if th.sessionMode == BlockSessions || th.sessionStore == StateSessionStore {
+		return nil, ErrResetRequiresTx
+	}
+	key := origin
+	if readState != nil {
+		state := readState()
+		defer state.Release()
+		var err error
+		if key, err = th.throttleKey(state, origin); err != nil {
+			return nil, err
+		}
+	}
+	reset := th.store.Reset(nil, key)
+	th.logger.Info(
+		"Throttle records of origin reset", "origin", origin.String(), "key", key.String(), "by", "admin",
+		"reset", reset,
+	)
+	return &ResetOriginResult{Origin: origin.String(), Reset: reset}, nil
+}
+
+// UnsafeResetOrigin resets the throttle records of the origin with the given address (see
+// ResetOrigin), it's meant to be exposed through the unsafe (local-only) RPC server.
+func (a *Admin) UnsafeResetOrigin(origin string) (*ResetOriginResult, error) {
+	a.mtx.Lock()
+	readState := a.readState
+	a.mtx.Unlock()
+
+	chainID := ""
+	if readState != nil {
+		state := readState()
+		chainID = state.Block().ChainID
+		state.Release()
+	}
+	addr, err := ParseOrigin(origin, chainID)
+	if err != nil {
+		return nil, err
+	}
+	return a.ResetOrigin(addr)
+}
+
+// Returns the key the records of the given origin are tracked under as of the given state, which is
+// the origin itself if the admin is nil or hasn't been passed to a middleware.
+func (a *Admin) originKey(state loomchain.State, origin loom.Address) (loom.Address, error) {
+	if a == nil {
+		return origin, nil
+	}
+	a.mtx.Lock()
+	th := a.throttle
+	a.mtx.Unlock()
+
+	if th == nil {
+		return origin, nil
+	}
+	return th.throttleKey(state, origin)
+}
+
+// Quota returns how much of each of its tx budgets the given origin has left as of the given state,
+// without counting anything against them.
+func (a *Admin) Quota(state loomchain.State, origin loom.Address) (*OriginQuota, error) {
+	a.mtx.Lock()
+	th := a.throttle
+	a.mtx.Unlock()
+
+	if th == nil {
+		return nil, ErrThrottleNotEnabled
+	}
+	return th.quota(state, origin)
+}
+
+// Stats returns a snapshot of the session records the throttle keeps in memory, listing the given
+// number of origins that have used the most of their call budget (at most MaxStatsOrigins). If txs
+// are counted in both phases separately the stats describe the budgets counted in CheckTx.
+func (a *Admin) Stats(top int) (*ThrottleStats, error) {
+	a.mtx.Lock()
+	th := a.throttle
+	a.mtx.Unlock()
+
+	if th == nil {
+		return nil, ErrThrottleNotEnabled
+	}
+	return th.forPhase(true).stats(top), nil
+}
+
+// Snapshot writes the session records the throttle keeps in memory to its snapshot file straight
+// away (see WithSnapshots), it should be called when the node stops so the txs counted since the
+// last periodic snapshot still count once the node is restarted. Does nothing if the throttle isn't
+// enabled or doesn't take snapshots.
+func (a *Admin) Snapshot() error {
+	a.mtx.Lock()
+	th := a.throttle
+	a.mtx.Unlock()
+
+	if th == nil {
+		return nil
+	}
+	return th.forPhase(true).finalSnapshot()
+}
+
+// UnsafeThrottleStats returns the stats of the throttle (see Stats), it's meant to be exposed
+// through the unsafe (local-only) RPC server.
+func (a *Admin) UnsafeThrottleStats(top int) (*ThrottleStats, error) {
+	return a.Stats(top)
+}
+
+// RegisterBypassToken verifies the given bypass token and grants the origin it's bound to the call
+// limit it carries until it expires, replacing any grant the origin already has (see
+// WithBypassTokens). The grant is only applied by this node.
+func (a *Admin) RegisterBypassToken(token string) (*BypassGrant, error) {
+	a.mtx.Lock()
+	th := a.throttle
+	a.mtx.Unlock()
+
+	if th == nil {
+		return nil, ErrThrottleNotEnabled
+	}
+	th = th.forPhase(true)
+	if th.bypass == nil {
+		return nil, ErrBypassNotEnabled
+	}
+	return th.registerBypassToken(token)
+}
+
+// Discards the session records the throttle keeps in memory for the given origin, including its
+// origin-contract records, returns false if it has no call or deploy session records.
+func (t *Throttle) resetOrigin(origin loom.Address) bool {
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	t.resetOriginContractSessions(origin)
+	key := origin.String()
+	session, ok := t.sessions[key]
+	if !ok {
+		return false
+	}
+	t.endCooldowns(key, session, t.clock.Now(), true)
+	t.endSessions(session)
+	t.removeSession(key, session)
+	t.metrics.TrackedOrigins.Set(float64(len(t.sessions)))
+	return true
+}
+
+// ResetOriginState discards the throttle records stored in the app state for the given origin, in
+// block session mode and by the state session store. It must only be called while processing a
+// privileged tx (see AdminTx.ResetOrigin) so that all the nodes reset the records at the same height.
+func ResetOriginState(state loomchain.State, origin loom.Address) {
+	state.Delete(stateSessionKey(origin))
+	state.Delete(dailyDeployKey(origin))
+	prefix := util.PrefixKey(deployBucketKeyPrefix, origin.Bytes())
+	for _, entry := range state.Range(prefix) {
+		state.Delete(util.PrefixKey(prefix, entry.Key))
+	}
+	for budget := txBudget(0); budget < numBudgets; budget++ {
+		state.Delete(blockSessionKey(budget, origin))
+	}
+}
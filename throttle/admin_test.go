@@ -0,0 +1,96 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestAdminResetOrigin(t *testing.T) {
+	admin := NewAdmin()
+	_, err := admin.ResetOrigin(origin)
+	require.Equal(t, ErrThrottleNotEnabled, err)
+
+	logger := &recordingLogger{}
+	now := time.Unix(1500000000, 0)
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithLogger(logger)(th)
+	WithClock(ClockFunc(func() time.Time { return now }))(th)
+	WithAdmin(admin)(th)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	callTxID := uint32(types.TxID_CALL)
+
+	nonce := uint64(0)
+	sendTxs := func(count int64) error {
+		for i := int64(0); i < count; i++ {
+			nonce++
+			if err := th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	require.NoError(t, sendTxs(maxCallCount))
+	require.NoError(t, th.throttleTx(state, callBudget, 100, addr1, maxCallCount, callTxID, 1))
+	require.Error(t, sendTxs(1))
+
+	// Resetting the origin mid-session restores its whole limit straight away, without affecting
+	// other origins.
+	now = now.Add(time.Duration(sessionDuration/2) * time.Second)
+	res, err := admin.UnsafeResetOrigin(origin.String())
+	require.NoError(t, err)
+	require.Equal(t, &ResetOriginResult{Origin: origin.String(), Reset: true}, res)
+	require.Equal(t, "Throttle records of origin reset", logger.entries[len(logger.entries)-1].msg)
+	require.NoError(t, sendTxs(maxCallCount))
+	require.Error(t, sendTxs(1))
+	th.sessionsMtx.Lock()
+	require.Equal(t, int64(1), th.sessions[addr1.String()].budgets[callBudget].accessCount)
+	th.sessionsMtx.Unlock()
+
+	res, err = admin.ResetOrigin(contract)
+	require.NoError(t, err)
+	require.False(t, res.Reset)
+
+	_, err = admin.UnsafeResetOrigin("0xnope")
+	require.Error(t, err)
+}
+
+func TestResetOriginState(t *testing.T) {
+	admin := NewAdmin()
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithSessionStore(StateSessionStore)(th)
+	WithAdmin(admin)(th)
+	memStore := store.NewMemStore()
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1, Time: time.Unix(1500000000, 0)}, nil, nil)
+	callTxID := uint32(types.TxID_CALL)
+
+	for nonce := uint64(1); nonce <= uint64(maxCallCount); nonce++ {
+		require.NoError(t, th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1))
+	}
+	require.Error(t, th.throttleTx(state, callBudget, 100, origin, maxCallCount, callTxID, 1))
+
+	// Records stored in the app state can only be reset by a tx.
+	_, err := admin.ResetOrigin(origin)
+	require.Equal(t, ErrResetRequiresTx, err)
+
+	state = loomchain.NewStoreState(nil, memStore, abci.Header{Height: 2, Time: time.Unix(1500000010, 0)}, nil, nil)
+	ResetOriginState(state, origin)
+	require.NoError(t, th.throttleTx(state, callBudget, 101, origin, maxCallCount, callTxID, 1))
+
+	// Block session records are reset too.
+	th = NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithBlockSessions(100, 0)(th)
+	for nonce := uint64(1); nonce <= uint64(maxCallCount); nonce++ {
+		require.NoError(t, th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1))
+	}
+	require.Error(t, th.throttleTx(state, callBudget, 100, origin, maxCallCount, callTxID, 1))
+	ResetOriginState(state, origin)
+	require.NoError(t, th.throttleTx(state, callBudget, 101, origin, maxCallCount, callTxID, 1))
+}
@@ -0,0 +1,144 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/features"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+)
+
+// AdminTxID is the ID of the txs processed by AdminTxHandler.
+const AdminTxID uint32 = 5
+
+var (
+	// ErrAdminTxNotEnabled is returned by AdminTxHandler until features.ThrottleAdminTxFeature is
+	// enabled.
+	ErrAdminTxNotEnabled = errors.New("throttle admin txs haven't been enabled")
+	// ErrNotKarmaOracle is returned by AdminTxHandler for admin txs that weren't sent by the Karma
+	// oracle.
+	ErrNotKarmaOracle = errors.New("throttle admin txs can only be sent by the Karma oracle")
+)
+
+// AdminTx is the payload of a throttle admin tx, it's JSON encoded in the data of a MessageTx.
+// Exactly one operation must be set.
+type AdminTx struct {
+	// Replaces the on-chain params of the throttle (see SetOnChainParams), including its maintenance
+	// mode. The params must keep the sender on the maintenance allowlist when they enable maintenance
+	// mode, so the sender can always disable it again.
+	SetParams *OnChainParams `json:",omitempty"`
+	// Removes the on-chain params, so the throttle goes back to its statically configured params.
+	ClearParams bool `json:",omitempty"`
+	// Discards the throttle records stored in the app state for the origin with the given address
+	// (see ResetOriginState), so it can send txs up to its limits again straight away.
+	ResetOrigin string `json:",omitempty"`
+}
+
+// AdminTxHandler processes throttle admin txs, which update the on-chain params of the throttle &
+// reset the records it stores in the app state, so all the nodes apply the update at the same
+// height. Admin txs are only accepted from the Karma oracle, once features.ThrottleAdminTxFeature is
+// enabled.
+type AdminTxHandler struct {
+	CreateKarmaContractCtx func(state loomchain.State) (contractpb.Context, error)
+	// Resolves the key the records of an origin are stored under, the records are reset under the
+	// address of the origin if nil or if the admin hasn't been passed to a middleware.
+	Admin *Admin
+}
+
+func (h *AdminTxHandler) ProcessTx(
+	state loomchain.State,
+	txBytes []byte,
+	isCheckTx bool,
+) (loomchain.TxHandlerResult, error) {
+	var r loomchain.TxHandlerResult
+
+	if !state.FeatureEnabled(features.ThrottleAdminTxFeature, false) {
+		return r, ErrAdminTxNotEnabled
+	}
+
+	var msg vm.MessageTx
+	if err := proto.Unmarshal(txBytes, &msg); err != nil {
+		return r, err
+	}
+
+	origin := auth.Origin(state.Context())
+	caller := loom.UnmarshalAddressPB(msg.From)
+	if caller.Compare(origin) != 0 {
+		return r, fmt.Errorf("Origin doesn't match caller: - %v != %v", origin, caller)
+	}
+	if err := h.checkOracle(state, origin); err != nil {
+		return r, err
+	}
+
+	var tx AdminTx
+	if err := json.Unmarshal(msg.Data, &tx); err != nil {
+		return r, errors.Wrap(err, "failed to unmarshal throttle admin tx")
+	}
+	if tx.numOperations() != 1 {
+		return r, errors.New("throttle admin tx must set exactly one operation")
+	}
+	switch {
+	case tx.SetParams != nil:
+		if tx.SetParams.MaintenanceMode && !allowlisted(tx.SetParams.MaintenanceAllowlist, origin) {
+			return r, fmt.Errorf("sender %s must be on the maintenance allowlist", origin)
+		}
+		if err := SetOnChainParams(state, tx.SetParams); err != nil {
+			return r, errors.Wrap(err, "invalid throttle params")
+		}
+	case tx.ClearParams:
+		state.Delete(OnChainParamsKey)
+	case tx.ResetOrigin != "":
+		addr, err := ParseOrigin(tx.ResetOrigin, state.Block().ChainID)
+		if err != nil {
+			return r, err
+		}
+		key, err := h.Admin.originKey(state, addr)
+		if err != nil {
+			return r, err
+		}
+		ResetOriginState(state, key)
+	}
+	return r, nil
+}
+
+func (tx *AdminTx) numOperations() int {
+	n := 0
+	for _, set := range []bool{tx.SetParams != nil, tx.ClearParams, tx.ResetOrigin != ""} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+func (h *AdminTxHandler) checkOracle(state loomchain.State, origin loom.Address) error {
+	ctx, err := h.CreateKarmaContractCtx(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Karma contract context")
+	}
+	oracleAddr, err := karma.GetOracleAddress(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain Karma Oracle address")
+	}
+	if oracleAddr == nil || origin.Compare(*oracleAddr) != 0 {
+		return ErrNotKarmaOracle
+	}
+	return nil
+}
+
+// Returns true if the given origin is on the given list of chain:0x... addresses.
+func allowlisted(origins []string, origin loom.Address) bool {
+	for _, o := range origins {
+		if addr, err := loom.ParseAddress(o); err == nil && addr.Compare(origin) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/features"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// Returns a factory of the context of a Karma contract with the given oracle.
+func newOracleKarmaContractCtx(
+	t *testing.T, oracle loom.Address,
+) func(state loomchain.State) (contractpb.Context, error) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1),
+		&ktypes.KarmaInitRequest{Sources: sources, Oracle: oracle.MarshalPB()},
+	)
+	return createKarmaContractCtx
+}
+
+// Processes the given admin tx sent by the given sender with the given handler.
+func processAdminTx(
+	t *testing.T, handler *AdminTxHandler, state loomchain.State, sender loom.Address, adminTx *AdminTx,
+) error {
+	data, err := json.Marshal(adminTx)
+	require.NoError(t, err)
+	msgBytes, err := proto.Marshal(&vm.MessageTx{From: sender.MarshalPB(), Data: data})
+	require.NoError(t, err)
+	ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, sender)
+	_, err = handler.ProcessTx(state.WithContext(ctx), msgBytes, false)
+	return err
+}
+
+func TestAdminTxHandler(t *testing.T) {
+	oracle := addr1
+	createKarmaContractCtx := newOracleKarmaContractCtx(t, oracle)
+	handler := &AdminTxHandler{CreateKarmaContractCtx: createKarmaContractCtx}
+	tmx := GetKarmaMiddleWare(true, 3, sessionDuration, 0, 0, nil, createKarmaContractCtx, WithOnChainParams())
+	memStore := store.NewMemStore()
+	stateAt := func(height int64, sender loom.Address) loomchain.State {
+		state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+		return state.WithContext(context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, sender))
+	}
+	sendAdminTx := func(height int64, sender loom.Address, adminTx *AdminTx) error {
+		return processAdminTx(t, handler, stateAt(height, sender), sender, adminTx)
+	}
+	nonce := uint64(0)
+	sendCallTx := func(height int64) error {
+		nonce++
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		_, err := tmx.ProcessTx(
+			stateAt(height, origin),
+			txSigned.Inner,
+			func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+				return loomchain.TxHandlerResult{}, nil
+			},
+			false,
+		)
+		return err
+	}
+	params := &OnChainParams{MaxCallCount: 100, SessionDuration: sessionDuration, MaintenanceAllowlist: []string{
+		oracle.String(),
+	}}
+
+	// Admin txs are rejected until they're enabled.
+	require.Equal(t, ErrAdminTxNotEnabled, sendAdminTx(1, oracle, &AdminTx{SetParams: params}))
+	stateAt(1, oracle).SetFeature(features.ThrottleAdminTxFeature, true)
+
+	// Only the Karma oracle can send admin txs.
+	require.Equal(t, ErrNotKarmaOracle, sendAdminTx(1, origin, &AdminTx{SetParams: params}))
+	require.Error(t, sendAdminTx(1, oracle, &AdminTx{SetParams: &OnChainParams{MaxCallCount: 10}}))
+	require.Error(t, sendAdminTx(1, oracle, &AdminTx{SetParams: params, ClearParams: true}))
+	require.Error(t, sendAdminTx(1, oracle, &AdminTx{}))
+	require.Nil(t, memStore.Get(OnChainParamsKey))
+
+	// The params set by the oracle apply from the next block.
+	require.NoError(t, sendAdminTx(1, oracle, &AdminTx{SetParams: params}))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sendCallTx(2))
+	}
+
+	// Maintenance mode can only be enabled if the oracle can disable it again.
+	maintenance := *params
+	maintenance.MaintenanceMode = true
+	maintenance.MaintenanceAllowlist = nil
+	require.Error(t, sendAdminTx(2, oracle, &AdminTx{SetParams: &maintenance}))
+	maintenance.MaintenanceAllowlist = params.MaintenanceAllowlist
+	require.NoError(t, sendAdminTx(2, oracle, &AdminTx{SetParams: &maintenance}))
+	_, ok := sendCallTx(3).(*MaintenanceModeError)
+	require.True(t, ok)
+
+	// Clearing the params restores the static ones.
+	require.NoError(t, sendAdminTx(3, oracle, &AdminTx{ClearParams: true}))
+	require.Nil(t, memStore.Get(OnChainParamsKey))
+	require.Error(t, sendCallTx(4))
+}
+
+func TestAdminTxResetOrigin(t *testing.T) {
+	oracle := addr1
+	admin := NewAdmin()
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithSessionStore(StateSessionStore)(th)
+	WithAdmin(admin)(th)
+	handler := &AdminTxHandler{CreateKarmaContractCtx: newOracleKarmaContractCtx(t, oracle), Admin: admin}
+	memStore := store.NewMemStore()
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1, Time: time.Unix(1500000000, 0)}, nil, nil)
+	state.SetFeature(features.ThrottleAdminTxFeature, true)
+	callTxID := uint32(types.TxID_CALL)
+
+	for nonce := uint64(1); nonce <= uint64(maxCallCount); nonce++ {
+		require.NoError(t, th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1))
+	}
+	require.Error(t, th.throttleTx(state, callBudget, 100, origin, maxCallCount, callTxID, 1))
+
+	// Only the oracle can reset the records of an origin.
+	err := processAdminTx(t, handler, state, origin, &AdminTx{ResetOrigin: origin.String()})
+	require.Equal(t, ErrNotKarmaOracle, err)
+	require.Error(t, processAdminTx(t, handler, state, oracle, &AdminTx{ResetOrigin: "0xnope"}))
+	require.Error(t, th.throttleTx(state, callBudget, 101, origin, maxCallCount, callTxID, 1))
+
+	state = loomchain.NewStoreState(nil, memStore, abci.Header{Height: 2, Time: time.Unix(1500000010, 0)}, nil, nil)
+	require.NoError(t, processAdminTx(t, handler, state, oracle, &AdminTx{ResetOrigin: origin.String()}))
+	for nonce := uint64(102); nonce < uint64(102+maxCallCount); nonce++ {
+		require.NoError(t, th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1))
+	}
+	require.Error(t, th.throttleTx(state, callBudget, 200, origin, maxCallCount, callTxID, 1))
+}
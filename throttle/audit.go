@@ -0,0 +1,368 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/log"
+	"github.com/pkg/errors"
+)
+
+// Kinds of throttle events written to the audit log.
+const (
+	// A tx was rejected by the throttle.
+	TxRejectedEvent = "rejected"
+	// An origin was put into a cooldown.
+	CooldownStartedEvent = "cooldown_started"
+	// A cooldown of an origin ended, noticed when the origin sent its next tx or its record was
+	// discarded.
+	CooldownEndedEvent = "cooldown_ended"
+)
+
+// Policies of the cooldowns origins are put into, used as the Policy of cooldown events.
+const (
+	// Origins that keep sending txs over their limits, see WithPenalty.
+	PenaltyCooldownPolicy = "cooldown"
+	// Origins whose txs keep failing, see WithFailureCooldown.
+	FailureCooldownPolicy = "failure_cooldown"
+)
+
+// ThrottleEvent is a throttling decision written to the audit log.
+type ThrottleEvent struct {
+	Time time.Time `json:"time"`
+	// rejected | cooldown_started | cooldown_ended
+	Kind   string `json:"kind"`
+	Origin string `json:"origin"`
+	// Policy the origin was limited under: the budget whose limit it reached, the scope of the
+	// contract limit it reached (see ContractTxLimitReachedError), cooldown, failure_cooldown,
+	// block_cap, deploy_size, duplicate or maintenance
+	Policy string `json:"policy"`
+	// Phase of tx processing the tx was rejected in: check | deliver, empty for cooldown events
+	Phase string `json:"phase,omitempty"`
+	// Height of the last block as of the event, zero for cooldown events
+	Height int64 `json:"height,omitempty"`
+	// ABCI response code the tx was rejected with
+	Code uint32 `json:"code,omitempty"`
+	// Limit the origin reached, and how much of it the origin had used
+	Limit int64 `json:"limit,omitempty"`
+	Used  int64 `json:"used,omitempty"`
+	// Contract (and method) whose limit the origin reached, if it reached a contract limit
+	Contract string `json:"contract,omitempty"`
+	Method   string `json:"method,omitempty"`
+	// Unix timestamp (in seconds) or block height from which the origin can send another tx
+	RetryAfter       int64 `json:"retry_after,omitempty"`
+	RetryAfterHeight int64 `json:"retry_after_height,omitempty"`
+	// Length of the cooldown the origin was put into
+	Cooldown time.Duration `json:"cooldown,omitempty"`
+	// Message of the error the tx was rejected with
+	Message string `json:"message,omitempty"`
+}
+
+// AuditSink receives the throttling decisions of the throttle, see WithAuditSink. Write is called
+// from a single goroutine per throttle, but a sink shared by several throttles (e.g. when txs are
+// counted in both CheckTx & DeliverTx) must be safe for concurrent use.
+type AuditSink interface {
+	Write(event ThrottleEvent)
+}
+
+// DefaultAuditQueueSize is the default number of events that can be waiting to be written to the
+// audit sink before further events are dropped.
+const DefaultAuditQueueSize = 1024
+
+// Feeds events to an audit sink from a bounded queue, so a slow sink never blocks tx processing.
+type auditLog struct {
+	sink    AuditSink
+	events  chan ThrottleEvent
+	dropped uint64
+}
+
+// WithAuditSink makes the middleware write its throttling decisions to the given sink: every tx it
+// rejects, and every cooldown an origin is put into & comes out of, allowed txs aren't written. The
+// events are queued & written in the background, once queueSize events are waiting further events
+// are dropped and counted (see Metrics.AuditEventsDropped). A non-positive queueSize defaults to
+// DefaultAuditQueueSize.
+func WithAuditSink(sink AuditSink, queueSize int) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		if queueSize <= 0 {
+			queueSize = DefaultAuditQueueSize
+		}
+		th.audit = &auditLog{sink: sink, events: make(chan ThrottleEvent, queueSize)}
+	}
+}
+
+// Queues the given event to be written to the sink, returns false if the queue is full, in which
+// case the event is dropped.
+func (a *auditLog) record(event ThrottleEvent) bool {
+	select {
+	case a.events <- event:
+		return true
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+		return false
+	}
+}
+
+// Writes the queued events to the sink, runs in its own goroutine for the lifetime of the throttle.
+func (a *auditLog) run() {
+	for event := range a.events {
+		a.sink.Write(event)
+	}
+}
+
+// Queues the given event to be written to the audit log, see auditLog.record.
+func (t *Throttle) recordAudit(event ThrottleEvent) {
+	if !t.audit.record(event) {
+		t.metrics.auditEventDropped()
+	}
+}
+
+// Returns the number of events dropped because the queue was full.
+func (a *auditLog) droppedEvents() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Returns the policy an origin was limited under when its tx was rejected with the given error, false
+// if the error wasn't returned by the throttle.
+func auditPolicyOf(err error) (string, bool) {
+	switch e := err.(type) {
+	case *TxLimitReachedError:
+		return e.Budget, true
+	case *TxCostExceedsLimitError:
+		return e.Budget, true
+	case *ContractTxLimitReachedError:
+		return e.Scope, true
+	case *BlockTxLimitReachedError:
+		return "block_cap", true
+	case *OriginCooldownError:
+		return PenaltyCooldownPolicy, true
+	case *FailureCooldownError:
+		return FailureCooldownPolicy, true
+	case *DeployTooLargeError:
+		return "deploy_size", true
+	case *DuplicateTxError:
+		return "duplicate", true
+	case *MaintenanceModeError:
+		return "maintenance", true
+	}
+	return "", false
+}
+
+// Writes the rejection of a tx from the given origin to the audit log, if the tx was rejected by the
+// throttle.
+func (t *Throttle) auditRejection(state loomchain.State, origin loom.Address, err error, isCheckTx bool) {
+	if t.audit == nil {
+		return
+	}
+	policy, ok := auditPolicyOf(err)
+	if !ok {
+		return
+	}
+	info, _ := rejectionInfoOf(err)
+	event := ThrottleEvent{
+		Time:             t.clock.Now(),
+		Kind:             TxRejectedEvent,
+		Origin:           t.originString(origin),
+		Policy:           policy,
+		Phase:            "deliver",
+		Height:           state.Block().Height,
+		Code:             info.Code,
+		Limit:            info.Limit,
+		Used:             info.Used,
+		RetryAfter:       info.RetryAfterUnix,
+		RetryAfterHeight: info.RetryAfterHeight,
+		Message:          err.Error(),
+	}
+	if isCheckTx {
+		event.Phase = "check"
+	}
+	if e, ok := err.(*ContractTxLimitReachedError); ok {
+		event.Contract = e.Contract.String()
+		event.Method = e.Method
+	}
+	t.recordAudit(event)
+}
+
+// Writes the start of a cooldown of the given origin to the audit log.
+func (t *Throttle) auditCooldownStarted(origin string, policy string, cooldown time.Duration, ends time.Time) {
+	if t.audit == nil {
+		return
+	}
+	t.recordAudit(ThrottleEvent{
+		Time:       t.clock.Now(),
+		Kind:       CooldownStartedEvent,
+		Origin:     origin,
+		Policy:     policy,
+		Cooldown:   cooldown,
+		RetryAfter: roundUpUnix(ends),
+	})
+}
+
+// Writes the end of the cooldowns of the given origin that have ended to the audit log, once each.
+func (t *Throttle) auditCooldownsEnded(origin loom.Address) {
+	if t.audit == nil || (!t.penaltyEnabled() && !t.failureCooldownEnabled()) {
+		return
+	}
+	now := t.clock.Now()
+	key := t.originString(origin)
+
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	if session, ok := t.sessions[key]; ok {
+		t.endCooldowns(key, session, now, false)
+	}
+}
+
+// Clears the cooldowns of the given record that have ended as of the given time, or all of them if
+// the record is being discarded, and writes their end to the audit log.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) endCooldowns(origin string, session *originSession, now time.Time, discarded bool) {
+	if t.audit == nil {
+		return
+	}
+	cooldowns := []struct {
+		policy string
+		ends   *time.Time
+	}{
+		{PenaltyCooldownPolicy, &session.penalty.cooldownEnds},
+		{FailureCooldownPolicy, &session.failures.cooldownEnds},
+	}
+	for _, cooldown := range cooldowns {
+		if cooldown.ends.IsZero() || (now.Before(*cooldown.ends) && !discarded) {
+			continue
+		}
+		ended := *cooldown.ends
+		if now.Before(ended) {
+			ended = now
+		}
+		t.recordAudit(ThrottleEvent{Time: ended, Kind: CooldownEndedEvent, Origin: origin, Policy: cooldown.policy})
+		*cooldown.ends = time.Time{}
+	}
+}
+
+// Defaults of the rotation of the audit log file.
+const (
+	DefaultAuditLogMaxBytes int64 = 100 * 1024 * 1024
+	DefaultAuditLogMaxFiles       = 5
+)
+
+// FileAuditSink writes throttle events to a file as JSON lines. Once writing an event would take the
+// file over maxBytes the file is rotated: it's renamed to path.1, path.1 to path.2 and so on, keeping
+// at most maxFiles rotated files. Errors are logged rather than returned, since the throttle doesn't
+// wait for events to be written.
+type FileAuditSink struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	logger   log.TMLogger
+	// Open file & its size, guarded by mtx. The file is opened by the first write.
+	file *os.File
+	size int64
+	mtx  sync.Mutex
+}
+
+// NewFileAuditSink creates a sink that appends events to the file at the given path, see
+// FileAuditSink. Non-positive maxBytes & maxFiles default to DefaultAuditLogMaxBytes &
+// DefaultAuditLogMaxFiles, a nil logger discards errors.
+func NewFileAuditSink(path string, maxBytes int64, maxFiles int, logger log.TMLogger) *FileAuditSink {
+	if maxBytes <= 0 {
+		maxBytes = DefaultAuditLogMaxBytes
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultAuditLogMaxFiles
+	}
+	if logger == nil {
+		logger = nopLogger()
+	}
+	return &FileAuditSink{path: path, maxBytes: maxBytes, maxFiles: maxFiles, logger: logger}
+}
+
+func (s *FileAuditSink) Write(event ThrottleEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("Failed to encode throttle audit event", "err", err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.write(line); err != nil {
+		s.logger.Error("Failed to write throttle audit event", "path", s.path, "err", err)
+	}
+}
+
+// NOTE: s.mtx must be held by the caller.
+func (s *FileAuditSink) write(line []byte) error {
+	if s.file != nil && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if s.file == nil {
+		file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		s.file, s.size = file, info.Size()
+		// The file may have been left over the limit by a previous run.
+		if s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			return s.write(line)
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Closes the file and shifts it & the rotated files by one, discarding the oldest. The next write
+// opens a new file.
+// NOTE: s.mtx must be held by the caller.
+func (s *FileAuditSink) rotate() error {
+	err := s.file.Close()
+	s.file, s.size = nil, 0
+	if err != nil {
+		return errors.Wrap(err, "failed to close audit log")
+	}
+	if err := os.Remove(s.rotatedPath(s.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(s.rotatedPath(i), s.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(s.path, s.rotatedPath(1))
+}
+
+func (s *FileAuditSink) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+// Close closes the file events are written to, the next event reopens it.
+func (s *FileAuditSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.size = nil, 0
+	return err
+}
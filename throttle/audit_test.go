@@ -0,0 +1,193 @@
+// +build evm
+
+package throttle
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/generic"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+type chanAuditSink chan ThrottleEvent
+
+func (s chanAuditSink) Write(event ThrottleEvent) {
+	s <- event
+}
+
+// Blocks each write until it's released.
+type blockingAuditSink struct {
+	written chan ThrottleEvent
+	release chan struct{}
+}
+
+func (s *blockingAuditSink) Write(event ThrottleEvent) {
+	s.written <- event
+	<-s.release
+}
+
+func nextAuditEvent(t *testing.T, events <-chan ThrottleEvent) ThrottleEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no audit event was written")
+		return ThrottleEvent{}
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	start := clock.now
+	events := make(chanAuditSink, 16)
+	tmx := GetKarmaMiddleWare(
+		true, 1, 10, 0, 0, StaticLimitResolver(1), createKarmaContractCtx,
+		WithPenalty(2, 30*time.Second, time.Minute), WithAuditSink(events, 0), WithClock(clock),
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 5}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func() error {
+		nonce++
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+		_, err := throttleMiddlewareHandler(tmx, state, txSigned, ctx)
+		return err
+	}
+
+	// Allowed txs aren't audited, rejected ones are.
+	require.NoError(t, sendTx())
+	require.Error(t, sendTx())
+	event := nextAuditEvent(t, events)
+	require.Equal(t, TxRejectedEvent, event.Kind)
+	require.Equal(t, origin.String(), event.Origin)
+	require.Equal(t, "call", event.Policy)
+	require.Equal(t, "deliver", event.Phase)
+	require.Equal(t, int64(5), event.Height)
+	require.Equal(t, TxLimitReachedCode, event.Code)
+	require.Equal(t, int64(1), event.Limit)
+	require.Equal(t, int64(1), event.Used)
+	require.Equal(t, start.Unix()+10, event.RetryAfter)
+	require.Contains(t, event.Message, TxLimitReachedErrorPrefix)
+
+	// The second rejection puts the origin into a cooldown.
+	require.Error(t, sendTx())
+	event = nextAuditEvent(t, events)
+	require.Equal(t, CooldownStartedEvent, event.Kind)
+	require.Equal(t, PenaltyCooldownPolicy, event.Policy)
+	require.Equal(t, 30*time.Second, event.Cooldown)
+	require.Equal(t, start.Unix()+30, event.RetryAfter)
+	require.Equal(t, TxRejectedEvent, nextAuditEvent(t, events).Kind)
+
+	// Txs sent during the cooldown are rejected under the cooldown policy, and extend it.
+	require.Error(t, sendTx())
+	event = nextAuditEvent(t, events)
+	require.Equal(t, TxRejectedEvent, event.Kind)
+	require.Equal(t, PenaltyCooldownPolicy, event.Policy)
+	require.Equal(t, OriginCooldownCode, event.Code)
+
+	// The end of the cooldown is noticed when the origin sends its next tx, which is allowed.
+	clock.Advance(2 * time.Minute)
+	require.NoError(t, sendTx())
+	event = nextAuditEvent(t, events)
+	require.Equal(t, CooldownEndedEvent, event.Kind)
+	require.Equal(t, PenaltyCooldownPolicy, event.Policy)
+	require.Equal(t, start.Add(time.Minute), event.Time)
+	select {
+	case event := <-events:
+		require.FailNow(t, "unexpected audit event", "%+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAuditDropsEventsWhenSinkIsSlow(t *testing.T) {
+	sink := &blockingAuditSink{written: make(chan ThrottleEvent), release: make(chan struct{})}
+	dropped := generic.NewCounter("audit_events_dropped")
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithAuditSink(sink, 1)(th)
+	th.metrics.AuditEventsDropped = dropped
+	th.start()
+
+	th.recordAudit(ThrottleEvent{Origin: "1"})
+	// The first event is being written, the second one waits in the queue & the others are dropped.
+	require.Equal(t, "1", nextAuditEvent(t, sink.written).Origin)
+	for i := 2; i <= 4; i++ {
+		th.recordAudit(ThrottleEvent{Origin: fmt.Sprint(i)})
+	}
+	require.Equal(t, uint64(2), th.audit.droppedEvents())
+	require.Equal(t, 2.0, dropped.Value())
+	require.Equal(t, uint64(2), th.stats(0).AuditEventsDropped)
+
+	close(sink.release)
+	require.Equal(t, "2", nextAuditEvent(t, sink.written).Origin)
+}
+
+func TestFileAuditSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttle-audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "throttle-audit.log")
+
+	eventOf := func(i int) ThrottleEvent {
+		return ThrottleEvent{
+			Time: time.Unix(1500000000, 0).UTC(), Kind: TxRejectedEvent, Origin: fmt.Sprint(i), Policy: "call",
+		}
+	}
+	line, err := json.Marshal(eventOf(0))
+	require.NoError(t, err)
+	// Every file holds two events.
+	lineSize := int64(len(line) + 1)
+	sink := NewFileAuditSink(path, 2*lineSize+1, 2, nil)
+	for i := 0; i < 7; i++ {
+		sink.Write(eventOf(i))
+	}
+	require.NoError(t, sink.Close())
+
+	readOrigins := func(path string) []string {
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+		var origins []string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var event ThrottleEvent
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+			origins = append(origins, event.Origin)
+		}
+		require.NoError(t, scanner.Err())
+		return origins
+	}
+	// The oldest rotated file is discarded.
+	require.Equal(t, []string{"2", "3"}, readOrigins(path+".2"))
+	require.Equal(t, []string{"4", "5"}, readOrigins(path+".1"))
+	require.Equal(t, []string{"6"}, readOrigins(path))
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err))
+
+	// A new sink appends to the existing file, and accounts for its size.
+	sink = NewFileAuditSink(path, 2*lineSize+1, 2, nil)
+	sink.Write(eventOf(7))
+	sink.Write(eventOf(8))
+	require.NoError(t, sink.Close())
+	require.Equal(t, []string{"6", "7"}, readOrigins(path+".1"))
+	require.Equal(t, []string{"8"}, readOrigins(path))
+}
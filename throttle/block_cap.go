@@ -0,0 +1,108 @@
+package throttle
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+)
+
+// BlockTxLimitReachedErrorPrefix is the prefix of the message of every BlockTxLimitReachedError.
+const BlockTxLimitReachedErrorPrefix = "block tx limit reached"
+
+// BlockTxLimitReachedError is returned when an origin has already sent as many txs as it's allowed to
+// in a single block.
+type BlockTxLimitReachedError struct {
+	Origin loom.Address
+	// Max number of txs the origin can send per block.
+	Limit int64
+	// Height of the block the tx was counted against, in CheckTx this is the height of the next block.
+	Height int64
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func (e *BlockTxLimitReachedError) Error() string {
+	return withHelp(fmt.Sprintf(
+		"%s: origin %s already sent %d txs allowed per block in block %d, retry in block %d",
+		BlockTxLimitReachedErrorPrefix, e.Origin, e.Limit, e.Height, e.Height+1,
+	), e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *BlockTxLimitReachedError) ABCICode() uint32 {
+	return BlockTxLimitReachedCode
+}
+
+// Number of txs each origin has sent in a single block, the counts of earlier blocks are discarded
+// so at most one block worth of origins is tracked.
+type blockTxCounts struct {
+	height int64
+	counts map[string]int64
+}
+
+// Caps the number of txs each origin can have in a single block. The counts are kept in memory since
+// they only matter for the duration of a block, DeliverTx processes the same txs in the same order
+// on every node so all the validators enforce the cap identically.
+type blockTxCap struct {
+	limit int64
+	// CheckTx counts txs against the next block, separately from the block being delivered, guarded
+	// by mtx since CheckTx may be invoked concurrently.
+	checkTx   blockTxCounts
+	deliverTx blockTxCounts
+	mtx       sync.Mutex
+}
+
+// Counts a tx from the given origin against the block cap, and returns a function that refunds the
+// tx, which must be called if the tx fails. Only txs that fail in CheckTx are refunded since they
+// won't make it into a block, in DeliverTx failed txs are still included in the block.
+func (t *Throttle) throttleBlockTx(state loomchain.State, origin loom.Address, isCheckTx bool) (func(), error) {
+	if t.blockTxCap == nil {
+		return func() {}, nil
+	}
+	height := state.Block().Height
+	if isCheckTx {
+		// The tx will be included in the next block at the earliest.
+		height++
+	}
+	if !t.blockTxCap.add(origin.String(), height, isCheckTx, 1) {
+		t.logger.Info("Tx throttled", "origin", origin.String(), "block_limit", t.blockTxCap.limit, "height", height)
+		return func() {}, &BlockTxLimitReachedError{Origin: origin, Limit: t.blockTxCap.limit, Height: height}
+	}
+	if !isCheckTx {
+		return func() {}, nil
+	}
+	return func() {
+		t.blockTxCap.add(origin.String(), height, true, -1)
+	}, nil
+}
+
+// Adds delta to the count of the given origin in the block at the given height, unless that would
+// take the count over the cap, in which case false is returned. The counts are reset when the height
+// changes, refunds to a block whose counts have already been reset are ignored.
+func (c *blockTxCap) add(origin string, height int64, isCheckTx bool, delta int64) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	counts := &c.deliverTx
+	if isCheckTx {
+		counts = &c.checkTx
+	}
+	if counts.height != height || counts.counts == nil {
+		if delta < 0 {
+			return true
+		}
+		*counts = blockTxCounts{height: height, counts: make(map[string]int64)}
+	}
+	count := counts.counts[origin] + delta
+	if count > c.limit {
+		return false
+	}
+	if count <= 0 {
+		delete(counts.counts, origin)
+	} else {
+		counts.counts[origin] = count
+	}
+	return true
+}
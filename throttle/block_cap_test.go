@@ -0,0 +1,106 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestBlockTxCap(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithBlockTxCap(2)(th)
+	memStore := store.NewMemStore()
+	stateAt := func(height int64) loomchain.State {
+		return loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+	}
+	heightOf := func(err error) int64 {
+		capErr, ok := err.(*BlockTxLimitReachedError)
+		require.True(t, ok, "expected a block tx limit error, got %v", err)
+		require.Equal(t, BlockTxLimitReachedCode, capErr.ABCICode())
+		return capErr.Height
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := th.throttleBlockTx(stateAt(5), origin, false)
+		require.NoError(t, err)
+	}
+	_, err := th.throttleBlockTx(stateAt(5), origin, false)
+	require.Equal(t, int64(5), heightOf(err))
+	// Other origins have their own cap.
+	_, err = th.throttleBlockTx(stateAt(5), addr1, false)
+	require.NoError(t, err)
+
+	// CheckTx counts txs against the next block, separately from the block being delivered.
+	for i := 0; i < 2; i++ {
+		_, err := th.throttleBlockTx(stateAt(5), origin, true)
+		require.NoError(t, err)
+	}
+	_, err = th.throttleBlockTx(stateAt(5), origin, true)
+	require.Equal(t, int64(6), heightOf(err))
+
+	// The counts roll over when the height changes.
+	for i := 0; i < 2; i++ {
+		_, err := th.throttleBlockTx(stateAt(6), origin, false)
+		require.NoError(t, err)
+	}
+	_, err = th.throttleBlockTx(stateAt(6), origin, false)
+	require.Equal(t, int64(6), heightOf(err))
+	_, err = th.throttleBlockTx(stateAt(7), origin, false)
+	require.NoError(t, err)
+
+	// Txs that fail in CheckTx are refunded...
+	refund, err := th.throttleBlockTx(stateAt(6), origin, true)
+	require.NoError(t, err)
+	refund()
+	for i := 0; i < 2; i++ {
+		refund, err = th.throttleBlockTx(stateAt(6), origin, true)
+		require.NoError(t, err)
+	}
+	_, err = th.throttleBlockTx(stateAt(6), origin, true)
+	require.Equal(t, int64(7), heightOf(err))
+	// ...unless the counts have already rolled over.
+	_, err = th.throttleBlockTx(stateAt(7), origin, true)
+	require.NoError(t, err)
+	refund()
+	_, err = th.throttleBlockTx(stateAt(7), origin, true)
+	require.NoError(t, err)
+	_, err = th.throttleBlockTx(stateAt(7), origin, true)
+	require.Equal(t, int64(8), heightOf(err))
+}
+
+func TestBlockTxCapMiddleware(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	tmx := GetKarmaMiddleWare(
+		true, 2, sessionDuration, 0, 0, StaticLimitResolver(2), createKarmaContractCtx, WithBlockTxCap(1),
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	failing := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{}, errors.New("tx failed")
+	}
+	nonce := uint64(0)
+	checkTx := func(next loomchain.TxHandlerFunc) error {
+		nonce++
+		return processTxFrom(
+			tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), next, true,
+		)
+	}
+
+	// A tx that fails in CheckTx doesn't use up the cap of the next block.
+	require.EqualError(t, checkTx(failing), "tx failed")
+	require.NoError(t, checkTx(nopTxHandler))
+	_, ok := checkTx(nopTxHandler).(*BlockTxLimitReachedError)
+	require.True(t, ok)
+}
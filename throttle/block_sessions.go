@@ -0,0 +1,75 @@
+package throttle
+
+import (
+	"encoding/binary"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/util"
+	"github.com/loomnetwork/loomchain"
+)
+
+// SessionMode determines what the duration of throttle sessions is measured in.
+type SessionMode string
+
+const (
+	// Sessions last a number of seconds measured by the clock of each node. Since the clocks of the
+	// nodes aren't in sync they may disagree on whether a tx exceeds the limit, so this mode must
+	// only be relied upon in CheckTx.
+	TimeSessions SessionMode = "time"
+	// Sessions last a number of blocks, session N of an origin spans blocks [N * blocks, (N+1) *
+	// blocks). Tx counts are stored in the app state so every node computes the same result, all
+	// the validators must use the same settings since the counts affect the app hash.
+	BlockSessions SessionMode = "block"
+)
+
+func (m SessionMode) IsValid() bool {
+	return m == TimeSessions || m == BlockSessions
+}
+
+var blockSessionKeyPrefix = []byte("throttle")
+
+func blockSessionKey(budget txBudget, origin loom.Address) []byte {
+	return util.PrefixKey(blockSessionKeyPrefix, []byte(budget.String()), origin.Bytes())
+}
+
+// Returns the duration (in blocks) of the sessions of the given budget.
+func (t *Throttle) budgetSessionBlocks(budget txBudget) int64 {
+	if budget == deployBudget && t.deploySessionBlocks > 0 {
+		return t.deploySessionBlocks
+	}
+	return t.sessionBlocks
+}
+
+// Counts a tx with the given cost against the given budget of the given origin in the session the
+// current block falls in, and returns a TxLimitReachedError if the tx would take the total cost of
+// the txs the origin has sent during that session over the given limit. Rejected txs aren't counted.
+func (t *Throttle) runBlockThrottle(
+	state loomchain.State, budget txBudget, origin loom.Address, limit int64, cost int64,
+) error {
+	blocks := t.budgetSessionBlocks(budget)
+	session := state.Block().Height / blocks
+	key := blockSessionKey(budget, origin)
+
+	// The stored count is only valid for the session it was stored in.
+	count := blockSessionCount(state.Get(key), session)
+	// Written so it can't overflow when the limit is close to math.MaxInt64
+	if cost > limit-count {
+		t.metrics.txThrottled(budget, origin.String())
+		return &TxLimitReachedError{
+			Origin:           origin,
+			Budget:           budget.String(),
+			Limit:            limit,
+			Used:             count,
+			WindowBlocks:     blocks,
+			RetryAfterHeight: (session + 1) * blocks,
+			RetryInBlocks:    (session+1)*blocks - state.Block().Height,
+		}
+	}
+
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[:8], uint64(session))
+	binary.BigEndian.PutUint64(data[8:], uint64(count+cost))
+	state.Set(key, data)
+	t.metrics.txAllowed(budget)
+	return nil
+}
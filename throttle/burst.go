@@ -0,0 +1,88 @@
+package throttle
+
+import (
+	"time"
+)
+
+// Lets origins exceed their call limit once in a while, e.g. for onboarding flows that send several
+// setup txs at once.
+type burstPolicy struct {
+	// Max total cost of the call txs an origin can send in a session while drawing on its burst
+	// credit, origins whose call limit is higher don't get a burst.
+	callCount int64
+	// Number of call sessions after drawing on its burst credit before an origin can do so again.
+	recoverySessions int64
+}
+
+// Returns the max total cost of the call txs an origin with the given call limit can send in a
+// session while drawing on its burst credit, or the limit itself if there's no burst.
+func (t *Throttle) burstCeiling(budget txBudget, limit int64) int64 {
+	if !t.burstEnabled() || budget != callBudget || t.burst.callCount < limit {
+		return limit
+	}
+	return t.burst.callCount
+}
+
+// Bursts are only supported by session records kept in memory.
+func (t *Throttle) burstEnabled() bool {
+	return t.burst != nil && t.sessionMode != BlockSessions && t.sessionStore == MemorySessionStore
+}
+
+// Returns how long it takes the burst credit of an origin to recover after it's drawn on.
+func (t *Throttle) burstRecovery() time.Duration {
+	return time.Duration(t.burst.recoverySessions) * t.sessionPeriod(callBudget)
+}
+
+// Returns true if the given origin is drawing on its burst credit in the current call session, or
+// its credit is available.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) burstAvailable(session *originSession, now time.Time) bool {
+	drawn := session.burstDrawn
+	return drawn.IsZero() || drawn.Equal(session.budgets[callBudget].start) || now.Sub(drawn) >= t.burstRecovery()
+}
+
+// Returns true if the given origin has burst credit that covers the given count, in which case the
+// credit is drawn on for the rest of the current call session.
+func (t *Throttle) drawBurst(budget txBudget, origin string, limit int64, count int64, now time.Time) bool {
+	ceiling := t.burstCeiling(budget, limit)
+	if count > ceiling || ceiling == limit {
+		return false
+	}
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	session, ok := t.sessions[origin]
+	if !ok || !t.burstAvailable(session, now) {
+		return false
+	}
+	session.burstDrawn = session.budgets[callBudget].start
+	return true
+}
+
+// Describes which call limit of the given origin has been reached in the given error, once the
+// burst credit has been exhausted or while it's recovering.
+func (t *Throttle) annotateBurst(err *TxLimitReachedError, origin string, limit int64, count int64, cost int64) {
+	ceiling := t.burstCeiling(callBudget, limit)
+	if ceiling == limit {
+		return
+	}
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	session, ok := t.sessions[origin]
+	if !ok {
+		return
+	}
+	if session.burstDrawn.Equal(session.budgets[callBudget].start) {
+		err.Burst = true
+		err.Limit = ceiling
+		err.Used = count - cost
+		if err.Used > ceiling {
+			err.Used = ceiling
+		}
+		return
+	}
+	if !session.burstDrawn.IsZero() {
+		err.BurstAvailableAt = roundUpUnix(session.burstDrawn.Add(t.burstRecovery()))
+	}
+}
@@ -0,0 +1,129 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestBurst(t *testing.T) {
+	const session = 60
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	start := clock.Now()
+	admin := NewAdmin()
+	th := NewThrottle(session, 20, 0, 0)
+	WithBurst(50, 3)(th)
+	WithClock(clock)(th)
+	WithAdmin(admin)(th)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func() error {
+		nonce++
+		return th.runThrottle(nil, callBudget, nonce, origin, 20, 1, 1)
+	}
+	callQuota := func() BudgetQuota {
+		quota, err := admin.Quota(state, origin)
+		require.NoError(t, err)
+		return quota.Budgets[callBudget]
+	}
+
+	require.Equal(t, int64(50), callQuota().BurstRemaining)
+	// The burst credit lets the origin go over its sustained limit...
+	for i := 0; i < 30; i++ {
+		require.NoError(t, sendTx())
+	}
+	quota := callQuota()
+	require.Equal(t, int64(30), quota.Used)
+	require.Equal(t, int64(0), quota.Remaining)
+	require.Equal(t, int64(50), quota.BurstLimit)
+	require.Equal(t, int64(20), quota.BurstRemaining)
+	// ...up to the burst ceiling.
+	for i := 0; i < 20; i++ {
+		require.NoError(t, sendTx())
+	}
+	err := sendTx()
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok)
+	require.True(t, limitErr.Burst)
+	require.Equal(t, int64(50), limitErr.Limit)
+	require.Equal(t, int64(50), limitErr.Used)
+	require.Contains(t, err.Error(), "used its burst of 50 call txs")
+
+	// In the following sessions only the sustained limit applies while the burst credit recovers.
+	clock.Advance(session * time.Second)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, sendTx())
+	}
+	err = sendTx()
+	limitErr, ok = err.(*TxLimitReachedError)
+	require.True(t, ok)
+	require.False(t, limitErr.Burst)
+	require.Equal(t, int64(20), limitErr.Limit)
+	require.Equal(t, start.Unix()+3*session, limitErr.BurstAvailableAt)
+	require.Contains(t, err.Error(), "burst available again after")
+	quota = callQuota()
+	require.Equal(t, int64(0), quota.BurstRemaining)
+	require.Equal(t, start.Unix()+3*session, quota.BurstAvailableAt)
+
+	// The origin's record isn't evicted while its burst credit recovers.
+	clock.Advance(2*session*time.Second - 1)
+	require.False(t, th.isIdle(th.sessions[origin.String()], clock.Now()))
+
+	// The burst credit can be drawn on again once it has recovered.
+	clock.Advance(1)
+	for i := 0; i < 50; i++ {
+		require.NoError(t, sendTx())
+	}
+	_, ok = sendTx().(*TxLimitReachedError)
+	require.True(t, ok)
+}
+
+func TestBurstExemptOrigins(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 2, sessionDuration, 0, 0, StaticLimitResolver(2), createKarmaContractCtx,
+		WithBurst(3, 1), WithExemptOrigins(addr1), WithAdmin(admin),
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonces := map[string]uint64{}
+	send := func(from loom.Address) error {
+		nonces[from.String()]++
+		txSigned := mockSignedTx(t, nonces[from.String()], types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, from)
+		_, err := throttleMiddlewareHandler(tmx, state, txSigned, ctx)
+		return err
+	}
+
+	// Exempt origins aren't limited by the burst ceiling, and have no burst credit to report.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, send(addr1))
+	}
+	quota, err := admin.Quota(state, addr1)
+	require.NoError(t, err)
+	require.True(t, quota.Exempt)
+	require.Empty(t, quota.Budgets)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, send(origin))
+	}
+	limitErr, ok := send(origin).(*TxLimitReachedError)
+	require.True(t, ok)
+	require.True(t, limitErr.Burst)
+}
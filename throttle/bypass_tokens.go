@@ -0,0 +1,208 @@
+package throttle
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// DefaultBypassMaxDuration is how long a bypass token can be valid for by default.
+const DefaultBypassMaxDuration = 24 * time.Hour
+
+// Prepended to the payload of a bypass token before it's signed, so a signature made by the operator
+// key for any other purpose can't be passed off as a bypass token.
+var bypassTokenDomain = []byte("loom-throttle-bypass:")
+
+var (
+	// ErrBypassNotEnabled is returned when a bypass token is registered with a throttle that doesn't
+	// accept bypass tokens.
+	ErrBypassNotEnabled = errors.New("throttle doesn't accept bypass tokens")
+	// ErrInvalidBypassToken is returned for bypass tokens that are malformed or weren't signed by the
+	// operator key.
+	ErrInvalidBypassToken = errors.New("invalid bypass token")
+	// ErrBypassTokenExpired is returned for bypass tokens whose expiry has passed.
+	ErrBypassTokenExpired = errors.New("bypass token expired")
+)
+
+// BypassGrant is the payload of a bypass token, it grants a single origin a call limit of its own
+// until the token expires.
+type BypassGrant struct {
+	// Address of the origin (chain:0x...) the grant is bound to
+	Origin string `json:"origin"`
+	// Unix timestamp (in seconds) at which the grant expires
+	Expiry int64 `json:"expiry"`
+	// Call limit of the origin until the grant expires, in place of the limit it'd otherwise get
+	CallLimit int64 `json:"call_limit"`
+}
+
+func (g *BypassGrant) validate() error {
+	if _, err := loom.ParseAddress(g.Origin); err != nil {
+		return errors.Wrapf(err, "origin %s is not a valid address", g.Origin)
+	}
+	if g.Expiry <= 0 {
+		return errors.Errorf("expiry %d must be positive", g.Expiry)
+	}
+	if g.CallLimit <= 0 {
+		return errors.Errorf("call limit %d must be positive", g.CallLimit)
+	}
+	return nil
+}
+
+// SignBypassToken returns a bypass token carrying the given grant signed with the given operator key.
+// The token is the base64 encoded payload & signature separated by a dot.
+func SignBypassToken(grant BypassGrant, key ed25519.PrivateKey) (string, error) {
+	if err := grant.validate(); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(grant)
+	if err != nil {
+		return "", err
+	}
+	sig := ed25519.Sign(key, append(bypassTokenDomain, payload...))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// ParseBypassToken returns the grant carried by the given bypass token, or ErrInvalidBypassToken if
+// the token is malformed or wasn't signed with the private key of the given operator key. The expiry
+// of the grant isn't checked.
+func ParseBypassToken(token string, operatorKey ed25519.PublicKey) (*BypassGrant, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidBypassToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidBypassToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, ErrInvalidBypassToken
+	}
+	if !ed25519.Verify(operatorKey, append(append([]byte{}, bypassTokenDomain...), payload...), sig) {
+		return nil, ErrInvalidBypassToken
+	}
+	var grant BypassGrant
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&grant); err != nil {
+		return nil, errors.Wrap(ErrInvalidBypassToken, err.Error())
+	}
+	if err := grant.validate(); err != nil {
+		return nil, errors.Wrap(ErrInvalidBypassToken, err.Error())
+	}
+	return &grant, nil
+}
+
+// ParseBypassOperatorKey decodes the given base64 encoded ed25519 public key.
+func ParseBypassOperatorKey(key string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("key must be %d bytes long, got %d", ed25519.PublicKeySize, len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// The bypass grants registered with the throttle, keyed by origin address.
+type bypassTokens struct {
+	operatorKey ed25519.PublicKey
+	maxDuration time.Duration
+	mtx         sync.Mutex
+	grants      map[string]BypassGrant
+}
+
+// WithBypassTokens makes the middleware accept bypass tokens signed with the private key of the given
+// operator key (see Admin.RegisterBypassToken), which grant an origin its own call limit until they
+// expire. Tokens that expire more than maxDuration after they're registered are rejected. Grants are
+// kept in memory by the node they're registered with, so they're only supported when txs are counted
+// in CheckTx.
+func WithBypassTokens(operatorKey ed25519.PublicKey, maxDuration time.Duration) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.bypass = &bypassTokens{
+			operatorKey: operatorKey,
+			maxDuration: maxDuration,
+			grants:      make(map[string]BypassGrant),
+		}
+	}
+}
+
+// Verifies the given token and registers the grant it carries, replacing any grant the origin
+// already has.
+func (t *Throttle) registerBypassToken(token string) (*BypassGrant, error) {
+	grant, err := ParseBypassToken(token, t.bypass.operatorKey)
+	if err != nil {
+		return nil, err
+	}
+	now := t.clock.Now()
+	expiry := time.Unix(grant.Expiry, 0)
+	if !now.Before(expiry) {
+		return nil, ErrBypassTokenExpired
+	}
+	if expiry.Sub(now) > t.bypass.maxDuration {
+		return nil, errors.Wrapf(
+			ErrInvalidBypassToken, "expiry is more than %v away", t.bypass.maxDuration,
+		)
+	}
+	origin := loom.MustParseAddress(grant.Origin).String()
+	grant.Origin = origin
+
+	t.bypass.mtx.Lock()
+	defer t.bypass.mtx.Unlock()
+
+	// Expired grants are dropped whenever another is registered, so they don't pile up.
+	for o, g := range t.bypass.grants {
+		if !now.Before(time.Unix(g.Expiry, 0)) {
+			delete(t.bypass.grants, o)
+		}
+	}
+	t.bypass.grants[origin] = *grant
+	t.logger.Info(
+		"Throttle bypass token registered", "origin", origin, "call_limit", grant.CallLimit,
+		"expiry", expiry.UTC().Format(time.RFC3339),
+	)
+	return grant, nil
+}
+
+// Returns the call limit granted to the given origin by a bypass token, false if it has no grant or
+// its grant has expired.
+func (t *Throttle) bypassLimit(origin loom.Address) (int64, bool) {
+	if t.bypass == nil {
+		return 0, false
+	}
+	t.bypass.mtx.Lock()
+	defer t.bypass.mtx.Unlock()
+
+	grant, ok := t.bypass.grants[origin.String()]
+	if !ok {
+		return 0, false
+	}
+	if !t.clock.Now().Before(time.Unix(grant.Expiry, 0)) {
+		delete(t.bypass.grants, origin.String())
+		return 0, false
+	}
+	return grant.CallLimit, true
+}
+
+// Resolves the call limit of origins that have a bypass grant from the grant, and the limits of other
+// origins with the wrapped resolver.
+type bypassLimitResolver struct {
+	throttle *Throttle
+	next     LimitResolver
+}
+
+func (r *bypassLimitResolver) ResolveLimit(state loomchain.State, origin loom.Address) (int64, error) {
+	if limit, ok := r.throttle.bypassLimit(origin); ok {
+		return limit, nil
+	}
+	return r.next.ResolveLimit(state, origin)
+}
@@ -0,0 +1,160 @@
+// +build evm
+
+package throttle
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseBypassToken(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPubKey, otherPrivKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	grant := BypassGrant{Origin: origin.String(), Expiry: 1500000600, CallLimit: 50}
+	token, err := SignBypassToken(grant, privKey)
+	require.NoError(t, err)
+	parsed, err := ParseBypassToken(token, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, grant, *parsed)
+
+	// Tokens signed with another key are forgeries.
+	_, err = ParseBypassToken(token, otherPubKey)
+	require.Equal(t, ErrInvalidBypassToken, err)
+	forged, err := SignBypassToken(grant, otherPrivKey)
+	require.NoError(t, err)
+	_, err = ParseBypassToken(forged, pubKey)
+	require.Equal(t, ErrInvalidBypassToken, err)
+
+	// So are tokens whose payload has been swapped for another, or whose signature has been altered.
+	parts := strings.Split(token, ".")
+	other, err := SignBypassToken(BypassGrant{Origin: addr1.String(), Expiry: 1500000600, CallLimit: 50}, privKey)
+	require.NoError(t, err)
+	_, err = ParseBypassToken(strings.Split(other, ".")[0]+"."+parts[1], pubKey)
+	require.Equal(t, ErrInvalidBypassToken, err)
+	sig := []byte(parts[1])
+	if sig[0] == 'A' {
+		sig[0] = 'B'
+	} else {
+		sig[0] = 'A'
+	}
+	_, err = ParseBypassToken(parts[0]+"."+string(sig), pubKey)
+	require.Equal(t, ErrInvalidBypassToken, err)
+
+	for _, malformed := range []string{"", "nope", parts[0], token + ".x", "!!." + parts[1]} {
+		_, err = ParseBypassToken(malformed, pubKey)
+		require.Equal(t, ErrInvalidBypassToken, err, malformed)
+	}
+
+	_, err = SignBypassToken(BypassGrant{Origin: "0xnope", Expiry: 1500000600, CallLimit: 50}, privKey)
+	require.Error(t, err)
+	_, err = SignBypassToken(BypassGrant{Origin: origin.String(), Expiry: 1500000600}, privKey)
+	require.Error(t, err)
+}
+
+func TestBypassTokens(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherPrivKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 2, 3600, 0, 0, StaticLimitResolver(2), createKarmaContractCtx,
+		WithBypassTokens(pubKey, time.Hour), WithAdmin(admin), WithClock(clock),
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func(from loom.Address) error {
+		nonce++
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+		)
+	}
+	sign := func(key ed25519.PrivateKey, grant BypassGrant) string {
+		token, err := SignBypassToken(grant, key)
+		require.NoError(t, err)
+		return token
+	}
+	requireLimited := func(err error) {
+		_, ok := err.(*TxLimitReachedError)
+		require.True(t, ok, "expected a limit error, got %v", err)
+	}
+
+	require.NoError(t, sendTx(origin))
+	require.NoError(t, sendTx(origin))
+	requireLimited(sendTx(origin))
+
+	// Tokens that have expired, expire too far in the future, or weren't signed by the operator
+	// are rejected.
+	expiry := clock.now.Add(30 * time.Minute).Unix()
+	_, err = admin.RegisterBypassToken(sign(privKey, BypassGrant{
+		Origin: origin.String(), Expiry: clock.now.Unix(), CallLimit: 5,
+	}))
+	require.Equal(t, ErrBypassTokenExpired, err)
+	_, err = admin.RegisterBypassToken(sign(privKey, BypassGrant{
+		Origin: origin.String(), Expiry: clock.now.Add(2 * time.Hour).Unix(), CallLimit: 5,
+	}))
+	require.Error(t, err)
+	_, err = admin.RegisterBypassToken(sign(otherPrivKey, BypassGrant{
+		Origin: origin.String(), Expiry: expiry, CallLimit: 5,
+	}))
+	require.Equal(t, ErrInvalidBypassToken, err)
+	requireLimited(sendTx(origin))
+
+	// A valid token raises the limit of the origin it's bound to, and no other.
+	grant, err := admin.RegisterBypassToken(sign(privKey, BypassGrant{
+		Origin: origin.String(), Expiry: expiry, CallLimit: 5,
+	}))
+	require.NoError(t, err)
+	require.Equal(t, int64(5), grant.CallLimit)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx(origin))
+	}
+	requireLimited(sendTx(origin))
+	require.NoError(t, sendTx(addr1))
+	require.NoError(t, sendTx(addr1))
+	requireLimited(sendTx(addr1))
+
+	// The quota of the origin reflects its grant.
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), quota.Budgets[callBudget].Limit)
+
+	// Once the grant expires the origin is back to its own limit.
+	clock.Advance(30 * time.Minute)
+	requireLimited(sendTx(origin))
+	quota, err = admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), quota.Budgets[callBudget].Limit)
+}
+
+func TestBypassTokensNotEnabled(t *testing.T) {
+	admin := NewAdmin()
+	_, err := admin.RegisterBypassToken("token")
+	require.Equal(t, ErrThrottleNotEnabled, err)
+
+	WithAdmin(admin)(NewThrottle(sessionDuration, maxCallCount, 0, 0))
+	_, err = admin.RegisterBypassToken("token")
+	require.Equal(t, ErrBypassNotEnabled, err)
+}
@@ -0,0 +1,86 @@
+package throttle
+
+import (
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+)
+
+// ChargeMode determines when a tx is charged against the limits of its origin.
+type ChargeMode string
+
+const (
+	// Txs are charged before they're passed down the middleware chain, and refunded if they fail
+	// (unless failed txs are counted). Txs rejected by the throttle stay charged.
+	PreCharge ChargeMode = "pre"
+	// Txs are only checked against the limits of their origin before they're passed down the
+	// middleware chain, and charged once the tx handler succeeds, so txs that are rejected or fail
+	// never modify the session records. Only supported in time session mode.
+	PostCharge ChargeMode = "post"
+)
+
+func (m ChargeMode) IsValid() bool {
+	return m == PreCharge || m == PostCharge
+}
+
+// WithChargeMode makes the middleware charge txs at the point determined by the given mode, by
+// default txs are pre-charged.
+func WithChargeMode(mode ChargeMode) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.chargeMode = mode
+	}
+}
+
+// Post-charging requires session records that can be read without being modified.
+func (t *Throttle) postCharging() bool {
+	return t.chargeMode == PostCharge && t.sessionMode != BlockSessions
+}
+
+// Returns a TxLimitReachedError if charging a tx with the given cost against the given budget of
+// the given origin would exceed the given limit, without modifying the records of the origin.
+func (t *Throttle) peekThrottle(state loomchain.State, budget txBudget, origin loom.Address, limit int64, cost int64) error {
+	now := t.store.Now(state)
+	window := t.window(budget)
+	usage := t.store.Get(state, origin, window, now)
+	count := usage.total(window, now) + cost
+	if count <= limit {
+		t.metrics.txAllowed(budget)
+		return nil
+	}
+	t.metrics.txThrottled(budget, origin.String())
+	retryAt := usage.retryAt(window, limit, cost)
+	return newTxLimitReachedError(budget, origin, limit, count, cost, retryAt, window.Duration, now).inWindow(window)
+}
+
+// Returns the given handler wrapped so the tx is settled against the given budget of the origin
+// once it's been processed, after being checked by throttleTx. A pre-charged tx is refunded if it
+// fails (see refundOnFailure), while a post-charged tx is only charged if it succeeds.
+func (t *Throttle) settleTx(
+	next loomchain.TxHandlerFunc, budget txBudget, nonce uint64, origin loom.Address, limit int64, txId uint32,
+	cost int64,
+) loomchain.TxHandlerFunc {
+	if !t.postCharging() {
+		return t.refundOnFailure(next, budget, nonce, origin, txId)
+	}
+	if isUnlimited(limit) {
+		return next
+	}
+	return func(state loomchain.State, txBytes []byte, isCheckTx bool) (res loomchain.TxHandlerResult, err error) {
+		// Nothing has been charged yet and no lock is held while the handler runs, so a panic is only
+		// logged before it's passed on to the recovery middleware.
+		defer func() {
+			if rval := recover(); rval != nil {
+				t.logger.Error("Tx handler panicked, tx not charged", "origin", origin.String(), "budget", budget)
+				panic(rval)
+			}
+		}()
+		res, err = next(state, txBytes, isCheckTx)
+		if err != nil {
+			return res, err
+		}
+		now := t.store.Now(state)
+		t.store.IncrementWithCost(
+			state, origin, t.window(budget), TxCharge{Nonce: nonce, TxID: txId, Cost: cost, Limit: limit}, now,
+		)
+		return res, nil
+	}
+}
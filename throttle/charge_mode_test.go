@@ -0,0 +1,132 @@
+// +build evm
+
+package throttle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// Counts the txs charged against a ThrottleStore.
+type countingStore struct {
+	ThrottleStore
+	charges int
+}
+
+func (s *countingStore) IncrementWithCost(
+	state loomchain.State, origin loom.Address, window Window, tx TxCharge, now time.Time,
+) Usage {
+	s.charges++
+	return s.ThrottleStore.IncrementWithCost(state, origin, window, tx, now)
+}
+
+// Runs the same scenarios with pre-charging & post-charging, against both session stores.
+func TestChargeModes(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	failingHandler := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{}, errors.New("out of gas")
+	}
+	panickingHandler := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		panic("handler failed")
+	}
+
+	type harness struct {
+		sendTx  func(next loomchain.TxHandlerFunc) error
+		advance func(d time.Duration)
+		quota   func() *OriginQuota
+		store   *countingStore
+	}
+	newHarness := func(mode ChargeMode, kind SessionStoreKind) *harness {
+		h := &harness{}
+		now := time.Unix(1500000000, 0)
+		admin := NewAdmin()
+		tmx := GetKarmaMiddleWare(
+			true, 5, sessionDuration, 0, 0, StaticLimitResolver(5), createKarmaContractCtx,
+			WithByteBudget(100000), WithChargeMode(mode), WithSessionStore(kind), WithAdmin(admin),
+			WithClock(ClockFunc(func() time.Time { return now })),
+			func(th *Throttle) {
+				h.store = &countingStore{ThrottleStore: th.store}
+				th.store = h.store
+			},
+		)
+		memStore := store.NewMemStore()
+		stateNow := func() loomchain.State {
+			return loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1, Time: now}, nil, nil)
+		}
+		// Txs are counted in CheckTx with the memory store, and in DeliverTx with the state store.
+		isCheckTx := kind == MemorySessionStore
+		nonce := uint64(0)
+		h.sendTx = func(next loomchain.TxHandlerFunc) error {
+			nonce++
+			state := stateNow()
+			return processTxFrom(
+				tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), next, isCheckTx,
+			)
+		}
+		h.advance = func(d time.Duration) { now = now.Add(d) }
+		h.quota = func() *OriginQuota {
+			quota, err := admin.Quota(stateNow(), origin)
+			require.NoError(t, err)
+			return quota
+		}
+		return h
+	}
+
+	for _, kind := range []SessionStoreKind{MemorySessionStore, StateSessionStore} {
+		pre := newHarness(PreCharge, kind)
+		post := newHarness(PostCharge, kind)
+
+		// Runs where every tx succeeds end with the same counts in both modes...
+		for _, h := range []*harness{pre, post} {
+			for i := 0; i < 3; i++ {
+				require.NoError(t, h.sendTx(nopTxHandler))
+			}
+			h.advance(100 * time.Second)
+			require.NoError(t, h.sendTx(nopTxHandler))
+			h.advance(time.Duration(sessionDuration) * time.Second)
+			for i := 0; i < 4; i++ {
+				require.NoError(t, h.sendTx(nopTxHandler))
+			}
+		}
+		require.Equal(t, pre.quota(), post.quota(), kind)
+		require.Equal(t, int64(4), post.quota().Budgets[callBudget].Used)
+
+		// ...and txs over the limit are rejected the same way, but only charged in pre mode (against
+		// both the call & bytes budgets).
+		preCharges, postCharges := pre.store.charges, post.store.charges
+		for _, h := range []*harness{pre, post} {
+			require.NoError(t, h.sendTx(nopTxHandler))
+			for i := 0; i < 2; i++ {
+				_, ok := h.sendTx(nopTxHandler).(*TxLimitReachedError)
+				require.True(t, ok)
+			}
+		}
+		// Rejected txs are charged to the bytes budget in pre mode, so only the call budgets match.
+		require.Equal(t, pre.quota().Budgets[callBudget], post.quota().Budgets[callBudget], kind)
+		require.Equal(t, preCharges+6, pre.store.charges)
+		require.Equal(t, postCharges+2, post.store.charges)
+
+		// Failed txs & txs whose handler panics are never charged in post mode.
+		post = newHarness(PostCharge, kind)
+		require.EqualError(t, post.sendTx(failingHandler), "out of gas")
+		require.Panics(t, func() { post.sendTx(panickingHandler) })
+		require.Equal(t, 0, post.store.charges)
+		require.Equal(t, int64(0), post.quota().Budgets[callBudget].Used)
+		require.NoError(t, post.sendTx(nopTxHandler))
+		require.Equal(t, int64(1), post.quota().Budgets[callBudget].Used)
+	}
+}
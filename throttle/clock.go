@@ -0,0 +1,26 @@
+package throttle
+
+import "time"
+
+// Clock tells the throttle the current time, it's used to time the sessions kept in memory.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock returns a clock that reads the system clock of the node.
+func SystemClock() Clock {
+	return systemClock{}
+}
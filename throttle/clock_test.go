@@ -0,0 +1,119 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newClockedThrottle(mode WindowMode, limit int64) (*Throttle, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	th := NewThrottle(sessionDuration, limit, 0, 0)
+	WithWindowMode(mode)(th)
+	WithClock(clock)(th)
+	return th, clock
+}
+
+func TestSessionExpiresAtBoundary(t *testing.T) {
+	window := time.Duration(sessionDuration) * time.Second
+	th, clock := newClockedThrottle(FixedWindow, 2)
+	start := clock.Now()
+	nonce := uint64(0)
+	sendTx := func() error {
+		nonce++
+		return th.runThrottle(nil, callBudget, nonce, origin, 2, 1, 1)
+	}
+
+	require.NoError(t, sendTx())
+	require.NoError(t, sendTx())
+	// The session is still in progress a nanosecond before it ends...
+	clock.Advance(window - 1)
+	err := sendTx()
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok)
+	require.Equal(t, start.Add(window).Unix(), limitErr.RetryAfter)
+	// ...and a new session starts with the first tx sent exactly when it ends, its count only
+	// includes that tx.
+	clock.Advance(1)
+	require.NoError(t, sendTx())
+	require.Equal(t, int64(1), th.sessions[origin.String()].budgets[callBudget].accessCount)
+	require.Equal(t, clock.Now(), th.sessions[origin.String()].budgets[callBudget].start)
+	require.NoError(t, sendTx())
+	_, ok = sendTx().(*TxLimitReachedError)
+	require.True(t, ok)
+}
+
+func TestSlidingWindowPrecision(t *testing.T) {
+	window := time.Duration(sessionDuration) * time.Second
+	th, clock := newClockedThrottle(SlidingWindow, 10)
+	nonce := uint64(0)
+	sendTx := func() error {
+		nonce++
+		return th.runThrottle(nil, callBudget, nonce, origin, 10, 1, 1)
+	}
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sendTx())
+	}
+	// Exactly halfway through the next session half of the previous count still applies.
+	clock.Advance(window + window/2)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sendTx())
+	}
+	session := &th.sessions[origin.String()].budgets[callBudget]
+	require.Equal(t, int64(10), session.count(SlidingWindow, window, clock.Now()))
+
+	// The weighted count is rounded up, so the next tx is only allowed once the previous count drops
+	// to 4, exactly 60% of the way through the session.
+	retryAt := session.start.Add(window * 6 / 10)
+	usage := th.store.Get(nil, origin, th.window(callBudget), clock.Now())
+	require.Equal(t, retryAt, usage.retryAt(th.window(callBudget), 10, 1))
+	require.Equal(t, int64(10), session.count(SlidingWindow, window, retryAt.Add(-1)))
+	require.Equal(t, int64(9), session.count(SlidingWindow, window, retryAt))
+	clock.now = retryAt
+	require.NoError(t, sendTx())
+}
+
+func TestLongIdleGap(t *testing.T) {
+	for _, mode := range []WindowMode{FixedWindow, SlidingWindow} {
+		window := time.Duration(sessionDuration) * time.Second
+		th, clock := newClockedThrottle(mode, 3)
+		nonce := uint64(0)
+		sendTx := func() error {
+			nonce++
+			return th.runThrottle(nil, callBudget, nonce, origin, 3, 1, 1)
+		}
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, sendTx(), mode)
+		}
+		// Nothing is carried over from a session that ended many sessions ago.
+		clock.Advance(7*window + window/3)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, sendTx(), mode)
+		}
+		session := th.sessions[origin.String()].budgets[callBudget]
+		require.Equal(t, clock.Now(), session.start, mode)
+		require.Equal(t, int64(0), session.prevAccessCount, mode)
+		_, ok := sendTx().(*TxLimitReachedError)
+		require.True(t, ok, mode)
+		// The idle origin's record is evicted when room is needed.
+		clock.Advance(2 * window)
+		require.True(t, th.isIdle(th.sessions[origin.String()], clock.Now()), mode)
+	}
+}
@@ -0,0 +1,685 @@
+package throttle
+
+import (
+	"math"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/log"
+	"github.com/pkg/errors"
+)
+
+// ThrottleConfig configures the karma throttle middleware, the exported scalar fields can be loaded
+// from the Throttle section of loom.yml, the remaining fields are runtime dependencies that can only
+// be set in code.
+type ThrottleConfig struct {
+	// Maximum number of call txs per session, zero or -1 for no limit
+	MaxCallCount int64
+	// Session length in seconds
+	SessionDuration int64
+	// Maximum number of deploy txs per deploy session, zero or -1 for no limit
+	MaxDeployCount int64
+	// Deploy session length in seconds, defaults to SessionDuration if zero
+	DeploySessionDuration int64
+	// Maximum number of deploy txs per day (UTC, derived from the block time), zero or -1 for no
+	// limit. The counts are stored in the app state, so this requires the state session store or
+	// block session mode.
+	MaxDailyDeployCount int64
+	// Throttle deploy txs by the size of their bytecode, a deploy tx falls into the bucket with the
+	// highest MinBytes it reaches. Bucket limits are counted in the app state, so they require the
+	// state session store or block session mode.
+	DeployBuckets []DeployBucket
+	// Maximum total size in bytes of the txs (of any kind) per call session, zero or -1 for no limit
+	MaxTxBytes int64
+	// Maximum number of txs (of any kind) each origin can have in a single block, zero or -1 for no
+	// limit
+	MaxBlockTxCount int64
+	// Number of recent tx hashes remembered per origin to reject exact duplicates in CheckTx, zero
+	// disables duplicate detection
+	MaxRecentTxs int
+	// Max number of origins session records are kept in memory for, defaults to
+	// DefaultMaxTrackedOrigins if zero
+	MaxTrackedOrigins int
+	// How new origins are treated once session records are kept in memory for MaxTrackedOrigins
+	// origins: evict | reduce, defaults to evict
+	PressurePolicy string
+	// Call & deploy limit shared by all the origins admitted under pressure when PressurePolicy is
+	// reduce
+	PressureCallCount int64
+	// File the session records kept in memory are periodically snapshotted to & restored from on
+	// startup, so a restart doesn't give every origin a fresh budget. Empty disables snapshots. Only
+	// supported by the memory session store in time session mode.
+	SnapshotPath string
+	// How often the session records are snapshotted in seconds, defaults to DefaultSnapshotInterval
+	// if zero
+	SnapshotInterval int64
+	// File the throttling decisions (rejected txs, cooldowns starting & ending) are appended to as
+	// JSON lines, separately from the node log. Empty disables the audit log.
+	AuditLogPath string
+	// Size in bytes at which the audit log is rotated, defaults to DefaultAuditLogMaxBytes if zero
+	AuditLogMaxBytes int64
+	// Number of rotated audit logs kept, defaults to DefaultAuditLogMaxFiles if zero
+	AuditLogMaxFiles int
+	// Number of events that can be waiting to be written to the audit log before further events are
+	// dropped, defaults to DefaultAuditQueueSize if zero
+	AuditQueueSize int
+	// How txs are grouped into sessions: fixed | sliding | leaky
+	WindowMode string
+	// Number of call txs that leak out of the bucket of each origin per second when WindowMode is
+	// leaky, may be a fraction. The call limit of each origin is the capacity of its bucket.
+	LeakRate float64
+	// What session durations are measured in: time | block
+	SessionMode string
+	// Session length in blocks when SessionMode is block
+	SessionBlocks int64
+	// Deploy session length in blocks when SessionMode is block, defaults to SessionBlocks if zero
+	DeploySessionBlocks int64
+	// Where session records are kept when SessionMode is time: memory | state
+	SessionStore string
+	// Phase of tx processing txs are counted in: check | deliver | both, defaults to check with the
+	// memory session store and to deliver otherwise
+	CountMode string
+	// Count txs that fail after passing the throttle against the limits of the origin
+	CountFailedTxs bool
+	// When txs are charged against the limits of their origin: pre | post, defaults to pre
+	ChargeMode string
+	// How much of the limits of the origin each tx consumes: unit | kind | size
+	TxCostMode string
+	// Cost of call & deploy txs when TxCostMode is kind
+	CallTxCost   int64
+	DeployTxCost int64
+	// Log at most one throttled tx per origin per session
+	LogSampling bool
+	// Appended to the messages of the errors txs are rejected with, e.g. a sentence pointing users
+	// to a page that explains the limits of the chain
+	HelpText string
+	// Origins (chain:0x... addresses) that aren't throttled at all
+	ExemptOrigins []string
+	// Puts the chain into maintenance mode, rejecting all txs except those sent by the origins on
+	// MaintenanceAllowlist
+	MaintenanceMode bool
+	// Origins (chain:0x... addresses) whose txs are accepted in maintenance mode
+	MaintenanceAllowlist []string
+	// Base64 encoded ed25519 public key of the operator whose signed bypass tokens grant origins
+	// temporary call limits, empty disables bypass tokens. Grants are node-local, so bypass tokens are
+	// only supported when txs are counted in CheckTx.
+	BypassOperatorKey string
+	// Max number of seconds a bypass token can be valid for once it's registered, defaults to a day if
+	// zero
+	BypassMaxDuration int64
+	// Max number of call txs an origin can send in a single session while drawing on its burst credit,
+	// zero disables bursts. Only supported by the memory session store in time mode.
+	BurstCallCount int64
+	// Number of call sessions it takes the burst credit of an origin to recover after it's drawn on
+	BurstRecoverySessions int64
+	// Number of txs over its limits an origin can send during a call session before being put into a
+	// cooldown, zero disables cooldowns. Only supported by the memory session store in time mode.
+	PenaltyThreshold int64
+	// Length of the first cooldown in seconds, every tx sent during a cooldown doubles its length
+	PenaltyCooldown int64
+	// Max length of a cooldown in seconds
+	PenaltyMaxCooldown int64
+	// Number of consecutive txs that fail after passing the throttle an origin can send before being
+	// put into a cooldown, zero disables these cooldowns. Only supported by the memory session store in
+	// time mode.
+	FailureThreshold int64
+	// Length of the first failure cooldown in seconds, every subsequent cooldown is twice as long
+	FailureCooldown int64
+	// Max length of a failure cooldown in seconds
+	FailureMaxCooldown int64
+	// Max number of call txs all origins together can send to each contract per call session, zero or
+	// -1 for no limit
+	ContractCallCount int64
+	// Max number of call txs each origin can send to each contract per call session, zero or -1 for
+	// no limit
+	OriginContractCallCount int64
+	// Overrides ContractCallCount & OriginContractCallCount for specific contracts
+	ContractLimits []ContractLimit
+	// Limits the call txs sent to specific contract methods, in addition to the contract limits
+	MethodLimits []MethodLimit
+	// Dimensions of the key the txs of each origin are tracked under: chain | address | mapped,
+	// defaults to DefaultKeyDimensions if empty
+	ThrottleKey []string
+	// Name of a contract whose oracle is exempted from the throttle, the oracle address is read from
+	// the contract state once per block so the exemption follows the oracle when it's rotated. Empty
+	// disables the bypass.
+	OracleContract string
+	// Contract state key the oracle address is stored under, as a types.Address
+	OracleKey string
+	// Name of a contract whose state holds a table of per-origin limits (see OriginLimitKey), the
+	// entry of each origin is read once per block. Empty disables the table.
+	LimitTableContract string
+	// How txs sent by the current validators are treated: exempt | limit, empty if validators are
+	// throttled like any other origin
+	ValidatorPolicy string
+	// Max number of call txs each validator can send per call session when ValidatorPolicy is limit
+	ValidatorCallCount int64
+	// Identify validators by the address of the candidate they're registered as in the DPOS contract
+	// as well as by their node key
+	ValidatorOperators bool
+	// Boosts the call limit of each origin by a multiplier derived from the total amount it has
+	// delegated in the DPOS contract, interpolated between the points of the curve. Empty disables the
+	// boost.
+	DelegationBoost []BoostPoint
+	// Max call limit an origin can be boosted to, zero for no cap
+	DelegationBoostMaxLimit int64
+	// Add the quota the origin has left to the tags of the result of each tx that succeeds
+	ResultTags bool
+	// Add the limit, usage & retry time of the origin as JSON to the Info & Data of the CheckTx
+	// response of each tx the throttle rejects
+	RejectionInfo bool
+	// Read the limits, session durations & exempt origins from the app state once per block, the
+	// values above are used while there are no valid on-chain params
+	OnChainParams bool
+
+	// Resolves the call limit of each origin, if nil the call limit of each origin is MaxCallCount
+	// plus its call karma.
+	CallLimits LimitResolver `json:"-" mapstructure:"-"`
+	// Overrides the cost function selected by TxCostMode.
+	TxCost TxCostFunc `json:"-" mapstructure:"-"`
+	// Defaults to a logger that discards everything.
+	Logger log.TMLogger `json:"-" mapstructure:"-"`
+	// Receives the throttling decisions instead of the file at AuditLogPath, optional.
+	AuditSink AuditSink `json:"-" mapstructure:"-"`
+	// Defaults to metrics that discard everything.
+	Metrics *Metrics `json:"-" mapstructure:"-"`
+	// Used to time sessions in memory, defaults to the system clock.
+	Clock Clock `json:"-" mapstructure:"-"`
+	// Policies of specific origins, loaded from the genesis file rather than loom.yml so every
+	// validator applies the same overrides.
+	OriginOverrides []OriginOverride `json:"-" mapstructure:"-"`
+	// Creates a context for the Address Mapper contract, required if ThrottleKey includes mapped.
+	AddressMapperCtx func(state loomchain.State) (contractpb.StaticContext, error) `json:"-" mapstructure:"-"`
+	// Creates a context for the contract named by OracleContract, required if OracleContract is set.
+	OracleContractCtx func(state loomchain.State) (contractpb.StaticContext, error) `json:"-" mapstructure:"-"`
+	// Creates a context for the contract named by LimitTableContract, required if LimitTableContract
+	// is set.
+	LimitTableContractCtx func(state loomchain.State) (contractpb.StaticContext, error) `json:"-" mapstructure:"-"`
+	// Creates a context for the DPOS contract, required if ValidatorOperators or DelegationBoost is set.
+	DPOSContractCtx func(state loomchain.State) (contractpb.StaticContext, error) `json:"-" mapstructure:"-"`
+	// Accepts administrative operations on the throttle, optional.
+	Admin *Admin `json:"-" mapstructure:"-"`
+}
+
+func DefaultThrottleConfig() *ThrottleConfig {
+	return &ThrottleConfig{
+		WindowMode:   string(FixedWindow),
+		SessionMode:  string(TimeSessions),
+		SessionStore: string(MemorySessionStore),
+		TxCostMode:   string(UnitTxCost),
+		CallTxCost:   1,
+		DeployTxCost: 1,
+	}
+}
+
+// Clone returns a deep clone of the config.
+func (c *ThrottleConfig) Clone() *ThrottleConfig {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	if c.ExemptOrigins != nil {
+		clone.ExemptOrigins = make([]string, len(c.ExemptOrigins))
+		copy(clone.ExemptOrigins, c.ExemptOrigins)
+	}
+	if c.ThrottleKey != nil {
+		clone.ThrottleKey = make([]string, len(c.ThrottleKey))
+		copy(clone.ThrottleKey, c.ThrottleKey)
+	}
+	if c.DelegationBoost != nil {
+		clone.DelegationBoost = make([]BoostPoint, len(c.DelegationBoost))
+		copy(clone.DelegationBoost, c.DelegationBoost)
+	}
+	if c.ContractLimits != nil {
+		clone.ContractLimits = make([]ContractLimit, len(c.ContractLimits))
+		copy(clone.ContractLimits, c.ContractLimits)
+	}
+	if c.MaintenanceAllowlist != nil {
+		clone.MaintenanceAllowlist = make([]string, len(c.MaintenanceAllowlist))
+		copy(clone.MaintenanceAllowlist, c.MaintenanceAllowlist)
+	}
+	if c.MethodLimits != nil {
+		clone.MethodLimits = make([]MethodLimit, len(c.MethodLimits))
+		copy(clone.MethodLimits, c.MethodLimits)
+	}
+	if c.DeployBuckets != nil {
+		clone.DeployBuckets = make([]DeployBucket, len(c.DeployBuckets))
+		copy(clone.DeployBuckets, c.DeployBuckets)
+	}
+	if c.OriginOverrides != nil {
+		clone.OriginOverrides = make([]OriginOverride, len(c.OriginOverrides))
+		copy(clone.OriginOverrides, c.OriginOverrides)
+	}
+	return &clone
+}
+
+// Validate returns an error naming the offending field if the config is invalid. Empty mode fields
+// are treated as their defaults.
+func (c *ThrottleConfig) Validate() error {
+	if c.MaxCallCount < Unlimited {
+		return errors.Errorf("MaxCallCount %d must be positive, or zero or -1 for no limit", c.MaxCallCount)
+	}
+	if c.MaxDeployCount < Unlimited {
+		return errors.Errorf("MaxDeployCount %d must be positive, or zero or -1 for no limit", c.MaxDeployCount)
+	}
+	if c.SessionDuration < 0 {
+		return errors.Errorf("SessionDuration %d must not be negative", c.SessionDuration)
+	}
+	if c.DeploySessionDuration < 0 {
+		return errors.Errorf("DeploySessionDuration %d must not be negative", c.DeploySessionDuration)
+	}
+	if c.WindowMode != "" && !WindowMode(c.WindowMode).IsValid() {
+		return errors.Errorf("WindowMode %s must be one of: fixed, sliding, leaky", c.WindowMode)
+	}
+	if WindowMode(c.WindowMode) == LeakyBucket {
+		if c.LeakRate <= 0 || math.IsInf(c.LeakRate, 0) || math.IsNaN(c.LeakRate) {
+			return errors.Errorf("LeakRate %v must be positive", c.LeakRate)
+		}
+		if SessionMode(c.SessionMode) == BlockSessions {
+			return errors.New("WindowMode leaky is only supported in time session mode")
+		}
+		if c.BurstCallCount > 0 {
+			return errors.New("WindowMode leaky doesn't support BurstCallCount")
+		}
+	}
+	switch SessionMode(c.SessionMode) {
+	case "", TimeSessions:
+		limited := !isUnlimited(c.MaxCallCount) || !isUnlimited(c.MaxDeployCount) || !isUnlimited(c.MaxTxBytes)
+		if limited && c.SessionDuration == 0 {
+			return errors.New("SessionDuration must be positive in time session mode")
+		}
+	case BlockSessions:
+		if c.SessionBlocks <= 0 {
+			return errors.Errorf("SessionBlocks %d must be positive in block session mode", c.SessionBlocks)
+		}
+		if c.DeploySessionBlocks < 0 {
+			return errors.Errorf("DeploySessionBlocks %d must not be negative", c.DeploySessionBlocks)
+		}
+	default:
+		return errors.Errorf("SessionMode %s must be one of: time, block", c.SessionMode)
+	}
+	if c.SessionStore != "" && !SessionStoreKind(c.SessionStore).IsValid() {
+		return errors.Errorf("SessionStore %s must be one of: memory, state", c.SessionStore)
+	}
+	switch c.countMode() {
+	case CheckTxCounting:
+		if SessionMode(c.SessionMode) == BlockSessions || SessionStoreKind(c.SessionStore) == StateSessionStore {
+			return errors.New("CountMode check requires the memory session store in time session mode")
+		}
+	case DeliverTxCounting:
+		if SessionMode(c.SessionMode) != BlockSessions && SessionStoreKind(c.SessionStore) != StateSessionStore {
+			return errors.New("CountMode deliver requires the state session store or block session mode")
+		}
+	case BothCounting:
+		if SessionMode(c.SessionMode) == BlockSessions || SessionStoreKind(c.SessionStore) != StateSessionStore {
+			return errors.New("CountMode both requires the state session store in time session mode")
+		}
+	default:
+		return errors.Errorf("CountMode %s must be one of: check, deliver, both", c.CountMode)
+	}
+	if !c.chargeMode().IsValid() {
+		return errors.Errorf("ChargeMode %s must be one of: pre, post", c.ChargeMode)
+	}
+	if c.chargeMode() == PostCharge {
+		if SessionMode(c.SessionMode) == BlockSessions {
+			return errors.New("ChargeMode post is only supported in time session mode")
+		}
+		if c.CountFailedTxs {
+			return errors.New("ChargeMode post never charges failed txs, so CountFailedTxs must be disabled")
+		}
+		if c.BurstCallCount > 0 {
+			return errors.New("ChargeMode post doesn't support BurstCallCount")
+		}
+	}
+	if !isUnlimited(c.MaxDailyDeployCount) &&
+		SessionMode(c.SessionMode) != BlockSessions && SessionStoreKind(c.SessionStore) != StateSessionStore {
+		return errors.New("MaxDailyDeployCount requires the state session store or block session mode")
+	}
+	if c.SnapshotInterval < 0 {
+		return errors.Errorf("SnapshotInterval %d must not be negative", c.SnapshotInterval)
+	}
+	if c.AuditLogMaxBytes < 0 {
+		return errors.Errorf("AuditLogMaxBytes %d must not be negative", c.AuditLogMaxBytes)
+	}
+	if c.AuditLogMaxFiles < 0 {
+		return errors.Errorf("AuditLogMaxFiles %d must not be negative", c.AuditLogMaxFiles)
+	}
+	if c.AuditQueueSize < 0 {
+		return errors.Errorf("AuditQueueSize %d must not be negative", c.AuditQueueSize)
+	}
+	if c.SnapshotPath != "" &&
+		(SessionMode(c.SessionMode) == BlockSessions || SessionStoreKind(c.SessionStore) == StateSessionStore) {
+		return errors.New("SnapshotPath is only supported by the memory session store in time session mode")
+	}
+	if err := ValidateDeployBuckets(c.DeployBuckets); err != nil {
+		return err
+	}
+	for i, bucket := range c.DeployBuckets {
+		if bucket.Limit > 0 &&
+			SessionMode(c.SessionMode) != BlockSessions && SessionStoreKind(c.SessionStore) != StateSessionStore {
+			return errors.Errorf("DeployBuckets[%d] Limit requires the state session store or block session mode", i)
+		}
+	}
+	if c.TxCostMode != "" {
+		if !TxCostMode(c.TxCostMode).IsValid() {
+			return errors.Errorf("TxCostMode %s must be one of: unit, kind, size", c.TxCostMode)
+		}
+		if TxCostMode(c.TxCostMode) == KindTxCost {
+			if c.CallTxCost <= 0 {
+				return errors.Errorf("CallTxCost %d must be positive", c.CallTxCost)
+			}
+			if c.DeployTxCost <= 0 {
+				return errors.Errorf("DeployTxCost %d must be positive", c.DeployTxCost)
+			}
+		}
+	}
+	if c.MaxTrackedOrigins < 0 {
+		return errors.Errorf("MaxTrackedOrigins %d must not be negative", c.MaxTrackedOrigins)
+	}
+	if c.PressurePolicy != "" {
+		if !PressurePolicy(c.PressurePolicy).IsValid() {
+			return errors.Errorf("PressurePolicy %s must be one of: evict, reduce", c.PressurePolicy)
+		}
+		if PressurePolicy(c.PressurePolicy) == PressureReduce {
+			if SessionMode(c.SessionMode) == BlockSessions || SessionStoreKind(c.SessionStore) == StateSessionStore {
+				return errors.New("PressurePolicy reduce is only supported by the memory session store in time session mode")
+			}
+			if c.PressureCallCount <= 0 {
+				return errors.Errorf("PressureCallCount %d must be positive", c.PressureCallCount)
+			}
+		}
+	}
+	if c.MaxRecentTxs < 0 {
+		return errors.Errorf("MaxRecentTxs %d must not be negative", c.MaxRecentTxs)
+	}
+	if c.BurstCallCount < 0 {
+		return errors.Errorf("BurstCallCount %d must not be negative", c.BurstCallCount)
+	}
+	if c.BurstCallCount > 0 {
+		if SessionMode(c.SessionMode) == BlockSessions || SessionStoreKind(c.SessionStore) == StateSessionStore {
+			return errors.New("BurstCallCount is only supported by the memory session store in time session mode")
+		}
+		if c.BurstRecoverySessions <= 0 {
+			return errors.Errorf("BurstRecoverySessions %d must be positive", c.BurstRecoverySessions)
+		}
+	}
+	if c.PenaltyThreshold < 0 {
+		return errors.Errorf("PenaltyThreshold %d must not be negative", c.PenaltyThreshold)
+	}
+	if c.PenaltyThreshold > 0 {
+		if SessionMode(c.SessionMode) == BlockSessions || SessionStoreKind(c.SessionStore) == StateSessionStore {
+			return errors.New("PenaltyThreshold is only supported by the memory session store in time session mode")
+		}
+		if c.PenaltyCooldown <= 0 {
+			return errors.Errorf("PenaltyCooldown %d must be positive", c.PenaltyCooldown)
+		}
+		if c.PenaltyMaxCooldown < c.PenaltyCooldown {
+			return errors.Errorf(
+				"PenaltyMaxCooldown %d must not be less than PenaltyCooldown %d", c.PenaltyMaxCooldown, c.PenaltyCooldown,
+			)
+		}
+	}
+	if c.FailureThreshold < 0 {
+		return errors.Errorf("FailureThreshold %d must not be negative", c.FailureThreshold)
+	}
+	if c.FailureThreshold > 0 {
+		if SessionMode(c.SessionMode) == BlockSessions || SessionStoreKind(c.SessionStore) == StateSessionStore {
+			return errors.New("FailureThreshold is only supported by the memory session store in time session mode")
+		}
+		if c.FailureCooldown <= 0 {
+			return errors.Errorf("FailureCooldown %d must be positive", c.FailureCooldown)
+		}
+		if c.FailureMaxCooldown < c.FailureCooldown {
+			return errors.Errorf(
+				"FailureMaxCooldown %d must not be less than FailureCooldown %d", c.FailureMaxCooldown, c.FailureCooldown,
+			)
+		}
+	}
+	for i, origin := range c.ExemptOrigins {
+		if _, err := loom.ParseAddress(origin); err != nil {
+			return errors.Wrapf(err, "ExemptOrigins[%d] %s is not a valid address", i, origin)
+		}
+	}
+	for i, origin := range c.MaintenanceAllowlist {
+		if _, err := loom.ParseAddress(origin); err != nil {
+			return errors.Wrapf(err, "MaintenanceAllowlist[%d] %s is not a valid address", i, origin)
+		}
+	}
+	if c.BypassOperatorKey != "" {
+		if _, err := ParseBypassOperatorKey(c.BypassOperatorKey); err != nil {
+			return errors.Wrap(err, "BypassOperatorKey is not a valid ed25519 public key")
+		}
+		if c.countMode() != CheckTxCounting {
+			return errors.New("BypassOperatorKey is only supported when txs are counted in CheckTx")
+		}
+	}
+	if c.BypassMaxDuration < 0 {
+		return errors.Errorf("BypassMaxDuration %d must not be negative", c.BypassMaxDuration)
+	}
+	for i, limit := range c.ContractLimits {
+		if _, err := loom.ParseAddress(limit.Contract); err != nil {
+			return errors.Wrapf(err, "ContractLimits[%d] %s is not a valid address", i, limit.Contract)
+		}
+	}
+	if err := ValidateMethodLimits(c.MethodLimits); err != nil {
+		return err
+	}
+	if len(c.ThrottleKey) > 0 {
+		if err := ValidateKeyDimensions(c.keyDimensions()); err != nil {
+			return err
+		}
+	}
+	if c.OracleContract != "" && c.OracleKey == "" {
+		return errors.New("OracleKey must be set if OracleContract is set")
+	}
+	if c.ValidatorPolicy != "" {
+		if !ValidatorPolicy(c.ValidatorPolicy).IsValid() {
+			return errors.Errorf("ValidatorPolicy %s must be one of: exempt, limit", c.ValidatorPolicy)
+		}
+		if ValidatorPolicy(c.ValidatorPolicy) == ValidatorLimit && c.ValidatorCallCount <= 0 {
+			return errors.Errorf("ValidatorCallCount %d must be positive", c.ValidatorCallCount)
+		}
+	}
+	if len(c.DelegationBoost) > 0 {
+		if err := ValidateBoostCurve(c.DelegationBoost); err != nil {
+			return errors.Wrap(err, "invalid DelegationBoost")
+		}
+	}
+	if c.DelegationBoostMaxLimit < 0 {
+		return errors.Errorf("DelegationBoostMaxLimit %d must not be negative", c.DelegationBoostMaxLimit)
+	}
+	if SessionMode(c.SessionMode) == BlockSessions {
+		for i, override := range c.OriginOverrides {
+			if override.Window != 0 {
+				return errors.Errorf("OriginOverrides[%d] %s must not set a window in block session mode", i, override.Address)
+			}
+		}
+	}
+	return ValidateOriginOverrides(c.OriginOverrides)
+}
+
+// Returns the options that apply the config to a throttle, the config must be valid.
+func (c *ThrottleConfig) options() []KarmaMiddlewareOption {
+	opts := []KarmaMiddlewareOption{withConfig(c)}
+	if WindowMode(c.WindowMode) == LeakyBucket {
+		opts = append(opts, WithLeakyBucket(c.LeakRate))
+	} else if c.WindowMode != "" {
+		opts = append(opts, WithWindowMode(WindowMode(c.WindowMode)))
+	}
+	if SessionMode(c.SessionMode) == BlockSessions {
+		opts = append(opts, WithBlockSessions(c.SessionBlocks, c.DeploySessionBlocks))
+	}
+	if c.SessionStore != "" {
+		opts = append(opts, WithSessionStore(SessionStoreKind(c.SessionStore)))
+	}
+	if !isUnlimited(c.MaxTxBytes) {
+		opts = append(opts, WithByteBudget(c.MaxTxBytes))
+	}
+	if !isUnlimited(c.MaxDailyDeployCount) {
+		opts = append(opts, WithDailyDeployLimit(c.MaxDailyDeployCount))
+	}
+	if len(c.DeployBuckets) > 0 {
+		opts = append(opts, WithDeployBuckets(c.DeployBuckets...))
+	}
+	if !isUnlimited(c.MaxBlockTxCount) {
+		opts = append(opts, WithBlockTxCap(c.MaxBlockTxCount))
+	}
+	if c.MaxTrackedOrigins > 0 {
+		opts = append(opts, WithMaxTrackedOrigins(c.MaxTrackedOrigins))
+	}
+	pressurePolicy := PressurePolicy(c.PressurePolicy)
+	if pressurePolicy == "" {
+		pressurePolicy = PressureEvict
+	}
+	opts = append(opts, WithPressurePolicy(pressurePolicy, c.PressureCallCount))
+	if c.SnapshotPath != "" {
+		interval := DefaultSnapshotInterval
+		if c.SnapshotInterval > 0 {
+			interval = time.Duration(c.SnapshotInterval) * time.Second
+		}
+		opts = append(opts, WithSnapshots(c.SnapshotPath, interval))
+	}
+	if c.AuditSink != nil {
+		opts = append(opts, WithAuditSink(c.AuditSink, c.AuditQueueSize))
+	} else if c.AuditLogPath != "" {
+		// The file is shared by the throttles of both phases when txs are counted in both.
+		sink := NewFileAuditSink(c.AuditLogPath, c.AuditLogMaxBytes, c.AuditLogMaxFiles, c.Logger)
+		opts = append(opts, WithAuditSink(sink, c.AuditQueueSize))
+	}
+	if c.MaxRecentTxs > 0 {
+		opts = append(opts, WithDuplicateTxDetection(c.MaxRecentTxs))
+	}
+	opts = append(opts, WithCountMode(c.countMode()))
+	opts = append(opts, WithCountFailedTxs(c.CountFailedTxs))
+	opts = append(opts, WithChargeMode(c.chargeMode()))
+	if c.TxCost != nil {
+		opts = append(opts, WithTxCost(c.TxCost))
+	} else if c.TxCostMode != "" {
+		// Can't fail since the config has been validated
+		txCost, _ := NewTxCostFunc(TxCostMode(c.TxCostMode), c.CallTxCost, c.DeployTxCost)
+		opts = append(opts, WithTxCost(txCost))
+	}
+	if c.LogSampling {
+		opts = append(opts, WithLogSampling())
+	}
+	if c.HelpText != "" {
+		opts = append(opts, WithHelpText(c.HelpText))
+	}
+	if len(c.ExemptOrigins) > 0 {
+		exempt := make([]loom.Address, 0, len(c.ExemptOrigins))
+		for _, origin := range c.ExemptOrigins {
+			exempt = append(exempt, loom.MustParseAddress(origin))
+		}
+		opts = append(opts, WithExemptOrigins(exempt...))
+	}
+	if c.MaintenanceMode || len(c.MaintenanceAllowlist) > 0 {
+		allowlist := make([]loom.Address, 0, len(c.MaintenanceAllowlist))
+		for _, origin := range c.MaintenanceAllowlist {
+			allowlist = append(allowlist, loom.MustParseAddress(origin))
+		}
+		opts = append(opts, WithMaintenanceMode(c.MaintenanceMode, allowlist...))
+	}
+	if c.BypassOperatorKey != "" {
+		// Can't fail since the config has been validated
+		operatorKey, _ := ParseBypassOperatorKey(c.BypassOperatorKey)
+		maxDuration := DefaultBypassMaxDuration
+		if c.BypassMaxDuration > 0 {
+			maxDuration = time.Duration(c.BypassMaxDuration) * time.Second
+		}
+		opts = append(opts, WithBypassTokens(operatorKey, maxDuration))
+	}
+	if c.BurstCallCount > 0 {
+		opts = append(opts, WithBurst(c.BurstCallCount, c.BurstRecoverySessions))
+	}
+	if c.PenaltyThreshold > 0 {
+		opts = append(opts, WithPenalty(
+			c.PenaltyThreshold,
+			time.Duration(c.PenaltyCooldown)*time.Second,
+			time.Duration(c.PenaltyMaxCooldown)*time.Second,
+		))
+	}
+	if c.FailureThreshold > 0 {
+		opts = append(opts, WithFailureCooldown(
+			c.FailureThreshold,
+			time.Duration(c.FailureCooldown)*time.Second,
+			time.Duration(c.FailureMaxCooldown)*time.Second,
+		))
+	}
+	if !isUnlimited(c.ContractCallCount) || !isUnlimited(c.OriginContractCallCount) || len(c.ContractLimits) > 0 {
+		opts = append(opts, WithContractLimits(c.ContractCallCount, c.OriginContractCallCount, c.ContractLimits...))
+	}
+	if len(c.MethodLimits) > 0 {
+		opts = append(opts, WithMethodLimits(c.MethodLimits...))
+	}
+	if len(c.ThrottleKey) > 0 {
+		opts = append(opts, WithThrottleKey(c.keyDimensions(), c.AddressMapperCtx))
+	}
+	if c.OracleContract != "" && c.OracleContractCtx != nil {
+		opts = append(opts, WithOracleBypass([]byte(c.OracleKey), c.OracleContractCtx))
+	}
+	if len(c.OriginOverrides) > 0 {
+		opts = append(opts, WithOriginOverrides(c.OriginOverrides...))
+	}
+	if c.LimitTableContract != "" && c.LimitTableContractCtx != nil {
+		opts = append(opts, WithOriginLimitTable(c.LimitTableContractCtx))
+	}
+	if c.ValidatorPolicy != "" {
+		var createDPOSContractCtx func(state loomchain.State) (contractpb.StaticContext, error)
+		if c.ValidatorOperators {
+			createDPOSContractCtx = c.DPOSContractCtx
+		}
+		opts = append(opts, WithValidatorPolicy(ValidatorPolicy(c.ValidatorPolicy), c.ValidatorCallCount, createDPOSContractCtx))
+	}
+	if len(c.DelegationBoost) > 0 && c.DPOSContractCtx != nil {
+		opts = append(opts, WithDelegationBoost(
+			NewDPOSStakeReader(c.DPOSContractCtx), c.DelegationBoostMaxLimit, c.DelegationBoost...,
+		))
+	}
+	if c.ResultTags {
+		opts = append(opts, WithResultTags())
+	}
+	if c.RejectionInfo {
+		opts = append(opts, WithRejectionInfo())
+	}
+	if c.OnChainParams {
+		opts = append(opts, WithOnChainParams())
+	}
+	if c.Logger != nil {
+		opts = append(opts, WithLogger(c.Logger))
+	}
+	if c.Metrics != nil {
+		opts = append(opts, WithMetrics(c.Metrics))
+	}
+	if c.Clock != nil {
+		opts = append(opts, WithClock(c.Clock))
+	}
+	if c.Admin != nil {
+		opts = append(opts, WithAdmin(c.Admin))
+	}
+	return opts
+}
+
+func (c *ThrottleConfig) keyDimensions() []KeyDimension {
+	dims := make([]KeyDimension, 0, len(c.ThrottleKey))
+	for _, dim := range c.ThrottleKey {
+		dims = append(dims, KeyDimension(dim))
+	}
+	return dims
+}
+
+// Returns the charge mode set by the config, txs are pre-charged if none is set.
+func (c *ThrottleConfig) chargeMode() ChargeMode {
+	if c.ChargeMode == "" {
+		return PreCharge
+	}
+	return ChargeMode(c.ChargeMode)
+}
+
+func (c *ThrottleConfig) countMode() CountMode {
+	if c.CountMode == "" {
+		return DefaultCountMode(SessionMode(c.SessionMode), SessionStoreKind(c.SessionStore))
+	}
+	return CountMode(c.CountMode)
+}
@@ -0,0 +1,276 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestThrottleConfigValidate(t *testing.T) {
+	require.NoError(t, DefaultThrottleConfig().Validate())
+
+	invalid := []struct {
+		field  string
+		modify func(cfg *ThrottleConfig)
+	}{
+		{"MaxCallCount", func(cfg *ThrottleConfig) { cfg.MaxCallCount = -2 }},
+		{"MaxDeployCount", func(cfg *ThrottleConfig) { cfg.MaxDeployCount = -5 }},
+		{"SessionDuration", func(cfg *ThrottleConfig) { cfg.SessionDuration = -1 }},
+		{"SessionDuration", func(cfg *ThrottleConfig) { cfg.MaxCallCount = 10 }},
+		{"SessionDuration", func(cfg *ThrottleConfig) { cfg.MaxTxBytes = 1024 }},
+		{"DeploySessionDuration", func(cfg *ThrottleConfig) { cfg.DeploySessionDuration = -1 }},
+		{"WindowMode", func(cfg *ThrottleConfig) { cfg.WindowMode = "tumbling" }},
+		{"LeakRate", func(cfg *ThrottleConfig) { cfg.WindowMode = "leaky" }},
+		{"WindowMode leaky", func(cfg *ThrottleConfig) {
+			cfg.WindowMode = "leaky"
+			cfg.LeakRate = 0.5
+			cfg.SessionMode = "block"
+			cfg.SessionBlocks = 10
+		}},
+		{"SessionMode", func(cfg *ThrottleConfig) { cfg.SessionMode = "epoch" }},
+		{"SessionBlocks", func(cfg *ThrottleConfig) { cfg.SessionMode = "block" }},
+		{"DeploySessionBlocks", func(cfg *ThrottleConfig) {
+			cfg.SessionMode = "block"
+			cfg.SessionBlocks = 10
+			cfg.DeploySessionBlocks = -1
+		}},
+		{"SessionStore", func(cfg *ThrottleConfig) { cfg.SessionStore = "disk" }},
+		{"CountMode", func(cfg *ThrottleConfig) { cfg.CountMode = "commit" }},
+		{"CountMode", func(cfg *ThrottleConfig) { cfg.CountMode = "deliver" }},
+		{"CountMode", func(cfg *ThrottleConfig) { cfg.CountMode = "both" }},
+		{"CountMode", func(cfg *ThrottleConfig) {
+			cfg.CountMode = "check"
+			cfg.SessionStore = "state"
+		}},
+		{"CountMode", func(cfg *ThrottleConfig) {
+			cfg.CountMode = "both"
+			cfg.SessionMode = "block"
+			cfg.SessionBlocks = 10
+			cfg.SessionStore = "state"
+		}},
+		{"MaxDailyDeployCount", func(cfg *ThrottleConfig) { cfg.MaxDailyDeployCount = 3 }},
+		{"DeployBuckets[0]", func(cfg *ThrottleConfig) { cfg.DeployBuckets = []DeployBucket{{Cost: 2}} }},
+		{"DeployBuckets[1]", func(cfg *ThrottleConfig) {
+			cfg.DeployBuckets = []DeployBucket{{MinBytes: 1024, Cost: 2}, {MinBytes: 1024, Reject: true}}
+		}},
+		{"DeployBuckets[0]", func(cfg *ThrottleConfig) { cfg.DeployBuckets = []DeployBucket{{MinBytes: 1024}} }},
+		{"DeployBuckets[0]", func(cfg *ThrottleConfig) {
+			cfg.DeployBuckets = []DeployBucket{{MinBytes: 1024, Cost: 2, Reject: true}}
+		}},
+		{"DeployBuckets[0]", func(cfg *ThrottleConfig) {
+			cfg.DeployBuckets = []DeployBucket{{MinBytes: 1024, Limit: 1}}
+		}},
+		{"TxCostMode", func(cfg *ThrottleConfig) { cfg.TxCostMode = "gas" }},
+		{"CallTxCost", func(cfg *ThrottleConfig) {
+			cfg.TxCostMode = "kind"
+			cfg.CallTxCost = 0
+		}},
+		{"DeployTxCost", func(cfg *ThrottleConfig) {
+			cfg.TxCostMode = "kind"
+			cfg.DeployTxCost = 0
+		}},
+		{"MaxTrackedOrigins", func(cfg *ThrottleConfig) { cfg.MaxTrackedOrigins = -1 }},
+		{"MaxRecentTxs", func(cfg *ThrottleConfig) { cfg.MaxRecentTxs = -1 }},
+		{"BurstCallCount", func(cfg *ThrottleConfig) { cfg.BurstCallCount = -1 }},
+		{"BurstCallCount", func(cfg *ThrottleConfig) {
+			cfg.BurstCallCount = 50
+			cfg.BurstRecoverySessions = 1
+			cfg.SessionStore = "state"
+		}},
+		{"BurstRecoverySessions", func(cfg *ThrottleConfig) { cfg.BurstCallCount = 50 }},
+		{"ChargeMode", func(cfg *ThrottleConfig) { cfg.ChargeMode = "later" }},
+		{"PressurePolicy", func(cfg *ThrottleConfig) { cfg.PressurePolicy = "drop" }},
+		{"SnapshotInterval", func(cfg *ThrottleConfig) { cfg.SnapshotInterval = -1 }},
+		{"AuditLogMaxBytes", func(cfg *ThrottleConfig) { cfg.AuditLogMaxBytes = -1 }},
+		{"AuditQueueSize", func(cfg *ThrottleConfig) { cfg.AuditQueueSize = -1 }},
+		{"SnapshotPath", func(cfg *ThrottleConfig) {
+			cfg.SnapshotPath = "throttle.snapshot"
+			cfg.SessionStore = "state"
+		}},
+		{"PressureCallCount", func(cfg *ThrottleConfig) { cfg.PressurePolicy = "reduce" }},
+		{"ChargeMode post", func(cfg *ThrottleConfig) {
+			cfg.ChargeMode = "post"
+			cfg.CountFailedTxs = true
+		}},
+		{"PenaltyThreshold", func(cfg *ThrottleConfig) { cfg.PenaltyThreshold = -1 }},
+		{"PenaltyThreshold", func(cfg *ThrottleConfig) {
+			cfg.PenaltyThreshold = 3
+			cfg.PenaltyCooldown = 10
+			cfg.PenaltyMaxCooldown = 10
+			cfg.SessionStore = "state"
+		}},
+		{"PenaltyCooldown", func(cfg *ThrottleConfig) { cfg.PenaltyThreshold = 3 }},
+		{"PenaltyMaxCooldown", func(cfg *ThrottleConfig) {
+			cfg.PenaltyThreshold = 3
+			cfg.PenaltyCooldown = 10
+		}},
+		{"FailureThreshold", func(cfg *ThrottleConfig) { cfg.FailureThreshold = -1 }},
+		{"FailureThreshold", func(cfg *ThrottleConfig) {
+			cfg.FailureThreshold = 3
+			cfg.FailureCooldown = 10
+			cfg.FailureMaxCooldown = 10
+			cfg.SessionMode = "block"
+		}},
+		{"FailureCooldown", func(cfg *ThrottleConfig) { cfg.FailureThreshold = 3 }},
+		{"FailureMaxCooldown", func(cfg *ThrottleConfig) {
+			cfg.FailureThreshold = 3
+			cfg.FailureCooldown = 10
+		}},
+		{"ContractLimits[0]", func(cfg *ThrottleConfig) {
+			cfg.ContractLimits = []ContractLimit{{Contract: "0xnope", CallCount: 1}}
+		}},
+		{"MethodLimits[0]", func(cfg *ThrottleConfig) {
+			cfg.MethodLimits = []MethodLimit{{Contract: contract.String(), Method: "0x1234", CallCount: 1}}
+		}},
+		{"ExemptOrigins[1]", func(cfg *ThrottleConfig) {
+			cfg.ExemptOrigins = []string{origin.String(), "0xnope"}
+		}},
+		{"MaintenanceAllowlist[0]", func(cfg *ThrottleConfig) { cfg.MaintenanceAllowlist = []string{"0xnope"} }},
+		{"BypassOperatorKey", func(cfg *ThrottleConfig) { cfg.BypassOperatorKey = "c2hvcnQ=" }},
+		{"BypassOperatorKey", func(cfg *ThrottleConfig) {
+			cfg.BypassOperatorKey = "11111111111111111111111111111111111111111lk="
+			cfg.SessionStore = "state"
+		}},
+		{"BypassMaxDuration", func(cfg *ThrottleConfig) { cfg.BypassMaxDuration = -1 }},
+		{"ThrottleKey[1]", func(cfg *ThrottleConfig) { cfg.ThrottleKey = []string{"chain", "nonce"} }},
+		{"OracleKey", func(cfg *ThrottleConfig) { cfg.OracleContract = "karma" }},
+		{"ValidatorPolicy", func(cfg *ThrottleConfig) { cfg.ValidatorPolicy = "bypass" }},
+		{"ValidatorCallCount", func(cfg *ThrottleConfig) { cfg.ValidatorPolicy = "limit" }},
+		{"DelegationBoost", func(cfg *ThrottleConfig) {
+			cfg.DelegationBoost = []BoostPoint{{Delegation: 100, Multiplier: 200}}
+		}},
+		{"DelegationBoostMaxLimit", func(cfg *ThrottleConfig) { cfg.DelegationBoostMaxLimit = -1 }},
+		{"OriginOverrides[0]", func(cfg *ThrottleConfig) {
+			cfg.OriginOverrides = []OriginOverride{{Address: "0xnope", Exempt: true}}
+		}},
+		{"OriginOverrides[1]", func(cfg *ThrottleConfig) {
+			cfg.OriginOverrides = []OriginOverride{
+				{Address: origin.String(), Exempt: true},
+				// Same address as origin in a different case.
+				{Address: "chain:0x5CECD1F7261E1F4C684E297BE3EDF03B825E01C4", Limit: 5},
+			}
+		}},
+		{"OriginOverrides[0]", func(cfg *ThrottleConfig) {
+			cfg.OriginOverrides = []OriginOverride{{Address: origin.String(), Exempt: true, Limit: 5}}
+		}},
+		{"OriginOverrides[0]", func(cfg *ThrottleConfig) {
+			cfg.OriginOverrides = []OriginOverride{{Address: origin.String()}}
+		}},
+		{"OriginOverrides[0]", func(cfg *ThrottleConfig) {
+			cfg.OriginOverrides = []OriginOverride{{Address: origin.String(), Limit: 5, Window: -1}}
+		}},
+		{"OriginOverrides[0]", func(cfg *ThrottleConfig) {
+			cfg.SessionMode = "block"
+			cfg.SessionBlocks = 10
+			cfg.OriginOverrides = []OriginOverride{{Address: origin.String(), Limit: 5, Window: 60}}
+		}},
+	}
+	for _, c := range invalid {
+		cfg := DefaultThrottleConfig()
+		c.modify(cfg)
+		err := cfg.Validate()
+		require.Error(t, err, c.field)
+		require.Contains(t, err.Error(), c.field)
+	}
+
+	// Empty modes are treated as the defaults.
+	require.NoError(t, (&ThrottleConfig{MaxCallCount: 10, SessionDuration: 60}).Validate())
+}
+
+func TestThrottleConfigClone(t *testing.T) {
+	cfg := DefaultThrottleConfig()
+	cfg.ExemptOrigins = []string{origin.String()}
+	cfg.ContractLimits = []ContractLimit{{Contract: contract.String(), CallCount: 5}}
+	cfg.MethodLimits = []MethodLimit{{Contract: contract.String(), Method: "Mint", CallCount: 5}}
+	cfg.DeployBuckets = []DeployBucket{{MinBytes: 1024, Cost: 2}}
+	clone := cfg.Clone()
+	require.Equal(t, cfg, clone)
+	clone.ExemptOrigins[0] = addr1.String()
+	require.Equal(t, origin.String(), cfg.ExemptOrigins[0])
+	clone.ContractLimits[0].CallCount = 6
+	require.Equal(t, int64(5), cfg.ContractLimits[0].CallCount)
+	clone.MethodLimits[0].CallCount = 6
+	require.Equal(t, int64(5), cfg.MethodLimits[0].CallCount)
+	clone.DeployBuckets[0].Cost = 3
+	require.Equal(t, int64(2), cfg.DeployBuckets[0].Cost)
+}
+
+func TestGetKarmaMiddleWareWithConfig(t *testing.T) {
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+	require.NoError(t, karma.AddKarma(contractContext, addr1, sourceStates))
+
+	cfg := DefaultThrottleConfig()
+	cfg.SessionMode = "block"
+	_, err := GetKarmaMiddleWareWithConfig(true, cfg, createKarmaContractCtx)
+	require.Error(t, err)
+	_, err = GetKarmaMiddleWareWithConfig(true, &ThrottleConfig{MaxCallCount: -2}, createKarmaContractCtx)
+	require.Error(t, err)
+	_, err = GetKarmaMiddleWareWithConfig(
+		true, &ThrottleConfig{CallLimits: StaticLimitResolver(3)}, createKarmaContractCtx,
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "sessionDuration")
+
+	// Fields left empty take their defaults, deploy sessions are as long as call sessions & deploys
+	// aren't limited.
+	admin := NewAdmin()
+	_, err = GetKarmaMiddleWareWithConfig(
+		true, &ThrottleConfig{MaxCallCount: 3, SessionDuration: 60, Admin: admin}, createKarmaContractCtx,
+	)
+	require.NoError(t, err)
+	th := admin.throttle
+	require.Equal(t, FixedWindow, th.windowMode)
+	require.Equal(t, TimeSessions, th.sessionMode)
+	require.Equal(t, MemorySessionStore, th.sessionStore)
+	require.Equal(t, DefaultCountMode(TimeSessions, MemorySessionStore), th.countMode)
+	require.Equal(t, int64(60), th.budgetSessionDuration(deployBudget))
+	require.True(t, isUnlimited(th.params.maxDeployCount))
+	require.Equal(t, DefaultMaxTrackedOrigins, th.maxTrackedOrigins)
+
+	now := time.Unix(1500000000, 0)
+	cfg = DefaultThrottleConfig()
+	cfg.MaxCallCount = 3
+	cfg.SessionDuration = 60
+	cfg.CallLimits = StaticLimitResolver(3)
+	cfg.ExemptOrigins = []string{addr1.String()}
+	cfg.Clock = ClockFunc(func() time.Time { return now })
+	tmx, err := GetKarmaMiddleWareWithConfig(true, cfg, createKarmaContractCtx)
+	require.NoError(t, err)
+
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	// With the memory session store txs are only counted in CheckTx by default.
+	sendTx := func(nonce uint64) error {
+		return processTxFrom(
+			tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+		)
+	}
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		require.NoError(t, sendTx(nonce))
+	}
+	_, ok := sendTx(4).(*TxLimitReachedError)
+	require.True(t, ok)
+
+	// The session ends when the injected clock says so.
+	now = now.Add(time.Minute)
+	require.NoError(t, sendTx(5))
+
+	// Exempt origins aren't throttled.
+	for nonce := uint64(1); nonce <= 10; nonce++ {
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		require.NoError(t, processTxFrom(tmx, state, addr1, txSigned, nopTxHandler, true))
+	}
+}
@@ -0,0 +1,424 @@
+package throttle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/util"
+	"github.com/loomnetwork/loomchain"
+)
+
+// ContractTxLimitReachedErrorPrefix is the prefix of the message of every
+// ContractTxLimitReachedError.
+const ContractTxLimitReachedErrorPrefix = "contract tx limit reached"
+
+// contractScope identifies which txs sent to a contract are counted together.
+type contractScope int
+
+const (
+	// All the txs sent to a contract.
+	contractScopeAll contractScope = iota
+	// The txs sent to a contract by a single origin.
+	contractScopeOrigin
+	// All the txs calling a method of a contract.
+	contractScopeMethod
+	// The txs calling a method of a contract sent by a single origin.
+	contractScopeOriginMethod
+	numContractScopes
+)
+
+func (s contractScope) String() string {
+	switch s {
+	case contractScopeOrigin:
+		return "origin-contract"
+	case contractScopeMethod:
+		return "method"
+	case contractScopeOriginMethod:
+		return "origin-method"
+	}
+	return "contract"
+}
+
+// Returns the given method if the scope counts the txs calling it, and otherwise an empty string.
+func (s contractScope) methodOf(method string) string {
+	if s == contractScopeMethod || s == contractScopeOriginMethod {
+		return method
+	}
+	return ""
+}
+
+var (
+	contractSessionKeyPrefix       = []byte("throttle-contract")
+	originContractSessionKeyPrefix = []byte("throttle-origin-contract")
+	methodSessionKeyPrefix         = []byte("throttle-method")
+	originMethodSessionKeyPrefix   = []byte("throttle-origin-method")
+)
+
+func contractSessionKey(scope contractScope, origin loom.Address, contract loom.Address, method string) []byte {
+	switch scope {
+	case contractScopeOrigin:
+		return util.PrefixKey(originContractSessionKeyPrefix, origin.Bytes(), contract.Bytes())
+	case contractScopeMethod:
+		return util.PrefixKey(methodSessionKeyPrefix, contract.Bytes(), []byte(method))
+	case contractScopeOriginMethod:
+		return util.PrefixKey(originMethodSessionKeyPrefix, origin.Bytes(), contract.Bytes(), []byte(method))
+	}
+	return util.PrefixKey(contractSessionKeyPrefix, contract.Bytes())
+}
+
+// ContractLimit overrides the default contract limits for a single contract.
+type ContractLimit struct {
+	// Address of the contract (chain:0x...)
+	Contract string
+	// Max number of call txs all origins together can send to the contract per session, zero or -1
+	// for no limit
+	CallCount int64
+	// Max number of call txs each origin can send to the contract per session, zero or -1 for no
+	// limit
+	OriginCallCount int64
+}
+
+// Limits on the call txs sent to each contract, counted in call sessions.
+type contractLimits struct {
+	defaults [numContractScopes]int64
+	// Limits of specific contracts, keyed by contract address.
+	overrides map[string][numContractScopes]int64
+	// Limits of specific methods, keyed by methodLimitKey.
+	methods map[string][numContractScopes]int64
+	// Addresses of the contracts some of whose methods are limited.
+	methodContracts map[string]bool
+}
+
+func newContractLimits(callCount int64, originCallCount int64, overrides []ContractLimit) *contractLimits {
+	limits := &contractLimits{
+		defaults:  [numContractScopes]int64{contractScopeAll: callCount, contractScopeOrigin: originCallCount},
+		overrides: make(map[string][numContractScopes]int64, len(overrides)),
+	}
+	for _, o := range overrides {
+		limits.overrides[loom.MustParseAddress(o.Contract).String()] = [numContractScopes]int64{
+			contractScopeAll:    o.CallCount,
+			contractScopeOrigin: o.OriginCallCount,
+		}
+	}
+	return limits
+}
+
+func (l *contractLimits) setMethodLimits(limits []MethodLimit) {
+	l.methods = make(map[string][numContractScopes]int64, len(limits))
+	l.methodContracts = make(map[string]bool, len(limits))
+	for _, m := range limits {
+		contract := loom.MustParseAddress(m.Contract)
+		l.methods[methodLimitKey(contract, m.Method)] = [numContractScopes]int64{
+			contractScopeMethod:       m.CallCount,
+			contractScopeOriginMethod: m.OriginCallCount,
+		}
+		l.methodContracts[contract.String()] = true
+	}
+}
+
+func (l *contractLimits) hasMethodLimits(contract loom.Address) bool {
+	return l.methodContracts[contract.String()]
+}
+
+// Returns the limits of the txs calling the given method of the given contract, the limits of the
+// method scopes are unlimited unless the method is limited.
+func (l *contractLimits) limitsOf(contract loom.Address, method string) [numContractScopes]int64 {
+	limits, ok := l.overrides[contract.String()]
+	if !ok {
+		limits = l.defaults
+	}
+	if method != "" {
+		if m, ok := l.methods[methodLimitKey(contract, method)]; ok {
+			limits[contractScopeMethod] = m[contractScopeMethod]
+			limits[contractScopeOriginMethod] = m[contractScopeOriginMethod]
+		}
+	}
+	return limits
+}
+
+// ContractTxLimitReachedError is returned when the txs sent to a contract, either by all origins or
+// by a single origin, have used up the contract limit for the current session.
+type ContractTxLimitReachedError struct {
+	Origin   loom.Address
+	Contract loom.Address
+	// Method of the contract called by the tx, only set if the tx was counted against the limits of
+	// the method.
+	Method string
+	// Which txs were counted against the limit: contract | origin-contract | method | origin-method
+	Scope string
+	// Max total cost of the txs that can be sent to the contract per session.
+	Limit int64
+	// Total cost of the txs counted against the limit during the current session.
+	Used int64
+	// How long each session lasts, zero if sessions are measured in blocks.
+	Window time.Duration
+	// Unix timestamp (in seconds) from which another tx can be sent, zero if sessions are measured in
+	// blocks.
+	RetryAfter int64
+	// How long the origin has to wait until RetryAfter, as of the rejected tx.
+	RetryIn time.Duration
+	// How many blocks each session lasts, zero if sessions are measured in seconds.
+	WindowBlocks int64
+	// Height of the block from which another tx can be sent, zero if sessions are measured in
+	// seconds.
+	RetryAfterHeight int64
+	// How many blocks the origin has to wait until RetryAfterHeight, as of the rejected tx.
+	RetryInBlocks int64
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func (e *ContractTxLimitReachedError) Error() string {
+	who := "all origins"
+	if s := e.Scope; s == contractScopeOrigin.String() || s == contractScopeOriginMethod.String() {
+		who = "origin " + e.Origin.String()
+	}
+	target := "contract " + e.Contract.String()
+	if e.Method != "" {
+		target = "method " + e.Method + " of " + target
+	}
+	if e.WindowBlocks > 0 {
+		return withHelp(fmt.Sprintf(
+			"%s: %s used %d of %d txs allowed to %s per %d block session, %s",
+			ContractTxLimitReachedErrorPrefix, who, e.Used, e.Limit, target, e.WindowBlocks,
+			retryInBlocks(e.RetryInBlocks, e.RetryAfterHeight),
+		), e.Help)
+	}
+	return withHelp(fmt.Sprintf(
+		"%s: %s used %d of %d txs allowed to %s per %v session, %s",
+		ContractTxLimitReachedErrorPrefix, who, e.Used, e.Limit, target, e.Window,
+		retryIn(e.RetryIn, e.RetryAfter),
+	), e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *ContractTxLimitReachedError) ABCICode() uint32 {
+	return ContractTxLimitReachedCode
+}
+
+// Metrics of the contract sessions aren't recorded, since they'd be mixed up with the call sessions
+// of origins.
+var discardMetrics = NopMetrics()
+
+// A tx counted against a contract session kept in memory, so it can be refunded if it fails.
+type contractCharge struct {
+	key   string
+	start time.Time
+	cost  int64
+}
+
+// Wraps the given handler so that a call tx with the given cost sent by the given origin to the given
+// contract is counted against the contract limits, and the limits of the given method (if any), before
+// being handled, and rejected with a ContractTxLimitReachedError if it'd exceed any of them. The tx is
+// only counted if it doesn't exceed any of the limits, and is refunded if the handler fails, unless
+// the throttle counts failed txs.
+func (t *Throttle) throttleContractTx(
+	next loomchain.TxHandlerFunc, origin loom.Address, contract loom.Address, method string, cost int64,
+) loomchain.TxHandlerFunc {
+	if t.contractLimits == nil {
+		return next
+	}
+	return func(state loomchain.State, txBytes []byte, isCheckTx bool) (res loomchain.TxHandlerResult, err error) {
+		charges, err := t.countContractTx(state, origin, contract, method, cost)
+		if err != nil {
+			t.logger.Info("Tx throttled", "origin", origin.String(), "contract", contract.String(), "err", err)
+			return res, err
+		}
+		if t.countFailedTxs || len(charges) == 0 {
+			return next(state, txBytes, isCheckTx)
+		}
+		succeeded := false
+		defer func() {
+			if !succeeded {
+				t.refundContractTx(charges)
+			}
+		}()
+		res, err = next(state, txBytes, isCheckTx)
+		succeeded = err == nil
+		return res, err
+	}
+}
+
+// Counts a tx against the contract limits, returns the charges that must be undone to refund the tx
+// (only for session records kept in memory).
+func (t *Throttle) countContractTx(
+	state loomchain.State, origin loom.Address, contract loom.Address, method string, cost int64,
+) ([]contractCharge, error) {
+	limits := t.contractLimits.limitsOf(contract, method)
+	for scope := contractScope(0); scope < numContractScopes; scope++ {
+		if !isUnlimited(limits[scope]) && cost > limits[scope] {
+			return nil, &ContractTxLimitReachedError{
+				Origin: origin, Contract: contract, Method: scope.methodOf(method), Scope: scope.String(),
+				Limit: limits[scope],
+			}
+		}
+	}
+	if t.sessionMode == BlockSessions {
+		return nil, t.countContractBlockTx(state, origin, contract, method, limits, cost)
+	}
+	return t.countContractSessionTx(state, origin, contract, method, limits, cost)
+}
+
+// Counts a tx against the contract limits in the block session the current block falls in.
+func (t *Throttle) countContractBlockTx(
+	state loomchain.State, origin loom.Address, contract loom.Address, method string,
+	limits [numContractScopes]int64, cost int64,
+) error {
+	blocks := t.budgetSessionBlocks(callBudget)
+	session := state.Block().Height / blocks
+	var keys [numContractScopes][]byte
+	var counts [numContractScopes]int64
+	for scope := contractScope(0); scope < numContractScopes; scope++ {
+		if isUnlimited(limits[scope]) {
+			continue
+		}
+		keys[scope] = contractSessionKey(scope, origin, contract, method)
+		counts[scope] = blockSessionCount(state.Get(keys[scope]), session)
+		if cost > limits[scope]-counts[scope] {
+			return &ContractTxLimitReachedError{
+				Origin:           origin,
+				Contract:         contract,
+				Method:           scope.methodOf(method),
+				Scope:            scope.String(),
+				Limit:            limits[scope],
+				Used:             counts[scope],
+				WindowBlocks:     blocks,
+				RetryAfterHeight: (session + 1) * blocks,
+				RetryInBlocks:    (session+1)*blocks - state.Block().Height,
+			}
+		}
+	}
+	for scope := contractScope(0); scope < numContractScopes; scope++ {
+		if keys[scope] == nil {
+			continue
+		}
+		data := make([]byte, 16)
+		binary.BigEndian.PutUint64(data[:8], uint64(session))
+		binary.BigEndian.PutUint64(data[8:], uint64(counts[scope]+cost))
+		state.Set(keys[scope], data)
+	}
+	return nil
+}
+
+// Counts a tx against the contract limits in time sessions, kept either in memory or in the app
+// state.
+func (t *Throttle) countContractSessionTx(
+	state loomchain.State, origin loom.Address, contract loom.Address, method string,
+	limits [numContractScopes]int64, cost int64,
+) ([]contractCharge, error) {
+	inState := t.sessionStore == StateSessionStore
+	now := t.clock.Now()
+	if inState {
+		now = time.Unix(state.Block().Time, 0)
+	} else {
+		t.sessionsMtx.Lock()
+		defer t.sessionsMtx.Unlock()
+	}
+
+	window := t.sessionPeriod(callBudget)
+	var keys [numContractScopes][]byte
+	var sessions [numContractScopes]*budgetSession
+	for scope := contractScope(0); scope < numContractScopes; scope++ {
+		if isUnlimited(limits[scope]) {
+			continue
+		}
+		keys[scope] = contractSessionKey(scope, origin, contract, method)
+		if inState {
+			s := budgetSession{}
+			if data := state.Get(keys[scope]); len(data) == encodedBudgetSessionSize {
+				s = decodeBudgetSession(data)
+			}
+			sessions[scope] = &s
+		} else {
+			sessions[scope] = t.getContractSession(string(keys[scope]), now)
+		}
+		s := sessions[scope]
+		mode := t.sessionWindowMode()
+		s.advance(mode, window, now, discardMetrics, callBudget)
+		count := s.count(mode, window, now)
+		if cost > limits[scope]-count {
+			retryAt := s.retryAt(mode, window, limits[scope], cost)
+			return nil, &ContractTxLimitReachedError{
+				Origin:     origin,
+				Contract:   contract,
+				Method:     scope.methodOf(method),
+				Scope:      scope.String(),
+				Limit:      limits[scope],
+				Used:       count,
+				Window:     window,
+				RetryAfter: roundUpUnix(retryAt),
+				RetryIn:    retryAt.Sub(now),
+			}
+		}
+	}
+
+	var charges []contractCharge
+	for scope := contractScope(0); scope < numContractScopes; scope++ {
+		s := sessions[scope]
+		if s == nil {
+			continue
+		}
+		s.accessCount = addCapped(s.accessCount, cost)
+		if inState {
+			data := make([]byte, encodedBudgetSessionSize)
+			encodeBudgetSession(data, s)
+			state.Set(keys[scope], data)
+		} else {
+			charges = append(charges, contractCharge{key: string(keys[scope]), start: s.start, cost: cost})
+		}
+	}
+	return charges, nil
+}
+
+// Returns the contract session record with the given key, creating one if there isn't one. If there
+// are too many records those of sessions that have ended are evicted first.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) getContractSession(key string, now time.Time) *budgetSession {
+	session, ok := t.contractSessions[key]
+	if ok {
+		return session
+	}
+	if len(t.contractSessions) >= t.maxTrackedOrigins {
+		idlePeriod := 2 * t.sessionPeriod(callBudget)
+		for k, s := range t.contractSessions {
+			if now.Sub(s.start) >= idlePeriod {
+				delete(t.contractSessions, k)
+			}
+		}
+		// If none of the sessions have ended start over, which lets the txs sent in the current
+		// sessions through again, rather than growing without bound.
+		if len(t.contractSessions) >= t.maxTrackedOrigins {
+			t.contractSessions = make(map[string]*budgetSession)
+		}
+	}
+	session = &budgetSession{}
+	t.contractSessions[key] = session
+	return session
+}
+
+// Undoes the given charges, unless the sessions they were made in have ended.
+func (t *Throttle) refundContractTx(charges []contractCharge) {
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	for _, c := range charges {
+		if s, ok := t.contractSessions[c.key]; ok && s.start.Equal(c.start) && s.accessCount >= c.cost {
+			s.accessCount -= c.cost
+		}
+	}
+}
+
+// Discards the origin-contract & origin-method session records kept in memory for the given origin.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) resetOriginContractSessions(origin loom.Address) {
+	contractPrefix := string(util.PrefixKey(originContractSessionKeyPrefix, origin.Bytes()))
+	methodPrefix := string(util.PrefixKey(originMethodSessionKeyPrefix, origin.Bytes()))
+	for key := range t.contractSessions {
+		if strings.HasPrefix(key, contractPrefix) || strings.HasPrefix(key, methodPrefix) {
+			delete(t.contractSessions, key)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestContractLimits(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	unlimitedContract := loom.MustParseAddress("chain:0x5cecd1f7261e1f4c684e297be3edf03b825e01c4")
+	now := time.Unix(1500000000, 0)
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 100, sessionDuration, 0, 0, StaticLimitResolver(100), createKarmaContractCtx,
+		WithContractLimits(5, 3, ContractLimit{Contract: unlimitedContract.String()}),
+		WithAdmin(admin), WithClock(ClockFunc(func() time.Time { return now })),
+	)
+
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonces := map[string]uint64{}
+	sendTx := func(from loom.Address, to loom.Address) error {
+		nonces[from.String()]++
+		txSigned := mockSignedTx(t, nonces[from.String()], types.TxID_CALL, vm.VMType_PLUGIN, to)
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, from)
+		_, err := throttleMiddlewareHandler(tmx, state, txSigned, ctx)
+		return err
+	}
+	scopeOf := func(err error) string {
+		limitErr, ok := err.(*ContractTxLimitReachedError)
+		require.True(t, ok, "expected a contract limit error, got %v", err)
+		require.Equal(t, ContractTxLimitReachedCode, limitErr.ABCICode())
+		return limitErr.Scope
+	}
+
+	// Each origin can send 3 txs to the contract...
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx(origin, contract))
+	}
+	require.Equal(t, "origin-contract", scopeOf(sendTx(origin, contract)))
+	// ...and txs rejected by the contract limits aren't counted against the origin.
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), quota.Budgets[callBudget].Used)
+
+	// All origins together can send 5 txs to the contract.
+	require.NoError(t, sendTx(addr1, contract))
+	require.NoError(t, sendTx(addr1, contract))
+	require.Equal(t, "contract", scopeOf(sendTx(addr1, contract)))
+
+	// Contracts can be exempted from the limits.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sendTx(origin, unlimitedContract))
+	}
+
+	// The contract limits are restored once the session ends.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	require.NoError(t, sendTx(origin, contract))
+}
+
+func TestContractLimitsRefund(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithContractLimits(2, 0)(th)
+	WithClock(ClockFunc(func() time.Time { return now }))(th)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+
+	failing := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{}, errors.New("tx failed")
+	}
+	// Txs that fail after passing the contract limits are refunded.
+	for i := 0; i < 5; i++ {
+		_, err := th.throttleContractTx(failing, origin, contract, "", 1)(state, nil, false)
+		require.EqualError(t, err, "tx failed")
+	}
+	for i := 0; i < 2; i++ {
+		_, err := th.throttleContractTx(nopTxHandler, origin, contract, "", 1)(state, nil, false)
+		require.NoError(t, err)
+	}
+	_, err := th.throttleContractTx(nopTxHandler, origin, contract, "", 1)(state, nil, false)
+	require.Equal(t, "contract", err.(*ContractTxLimitReachedError).Scope)
+
+	// A tx that costs more than the whole limit is always rejected.
+	_, err = th.throttleContractTx(nopTxHandler, addr1, addr1, "", 3)(state, nil, false)
+	require.Equal(t, int64(2), err.(*ContractTxLimitReachedError).Limit)
+}
+
+func TestContractLimitsInState(t *testing.T) {
+	memStore := store.NewMemStore()
+	for _, opt := range []KarmaMiddlewareOption{WithSessionStore(StateSessionStore), WithBlockSessions(10, 0)} {
+		th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+		WithContractLimits(0, 2)(th)
+		opt(th)
+		header := abci.Header{Height: 11, Time: time.Unix(1500000000, 0)}
+		state := loomchain.NewStoreState(nil, memStore, header, nil, nil)
+
+		for i := 0; i < 2; i++ {
+			_, err := th.countContractTx(state, origin, contract, "", 1)
+			require.NoError(t, err)
+		}
+		_, err := th.countContractTx(state, origin, contract, "", 1)
+		limitErr := err.(*ContractTxLimitReachedError)
+		require.Equal(t, int64(2), limitErr.Used)
+		// Other origins have their own limits.
+		_, err = th.countContractTx(state, addr1, contract, "", 1)
+		require.NoError(t, err)
+
+		// Only the limits of the current session apply.
+		header = abci.Header{Height: 20, Time: time.Unix(1500000000+sessionDuration, 0)}
+		state = loomchain.NewStoreState(nil, memStore, header, nil, nil)
+		_, err = th.countContractTx(state, origin, contract, "", 1)
+		require.NoError(t, err)
+		memStore = store.NewMemStore()
+	}
+}
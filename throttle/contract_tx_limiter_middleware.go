@@ -20,9 +20,9 @@ import (
 )
 
 var (
-	ErrTxLimitReached         = errors.New("tx limit reached, try again later")
-	ErrContractNotWhitelisted = errors.New("contract not whitelisted")
-	ErrInactiveDeployer       = errors.New("can't call contract belonging to inactive deployer")
+	ErrTxLimitReached         error = &codedError{msg: "tx limit reached, try again later", code: TxLimitReachedCode}
+	ErrContractNotWhitelisted       = errors.New("contract not whitelisted")
+	ErrInactiveDeployer             = errors.New("can't call contract belonging to inactive deployer")
 )
 
 var (
@@ -0,0 +1,45 @@
+package throttle
+
+// CountMode determines in which phase of tx processing txs are counted against the limits of their
+// origins.
+type CountMode string
+
+const (
+	// Txs are only counted in CheckTx, so the throttle protects the mempool of each node. The counts
+	// are node-local, so the limits aren't enforced in DeliverTx at all. Requires the memory session
+	// store since changes to the app state made in CheckTx are discarded.
+	CheckTxCounting CountMode = "check"
+	// Txs are only counted in DeliverTx, so all the validators enforce the same limits. CheckTx still
+	// rejects txs that would exceed the counts stored in the app state as of the last block, without
+	// charging them. Requires a deterministic session store.
+	DeliverTxCounting CountMode = "deliver"
+	// Txs are counted in both phases against separate budgets, in memory in CheckTx and in the app
+	// state in DeliverTx, so a tx is charged once in each. Requires the state session store.
+	BothCounting CountMode = "both"
+)
+
+func (m CountMode) IsValid() bool {
+	return m == CheckTxCounting || m == DeliverTxCounting || m == BothCounting
+}
+
+// DefaultCountMode returns the count mode used when none is configured: txs are counted in CheckTx
+// when the session records are kept in memory, and in DeliverTx when they're kept in the app state.
+func DefaultCountMode(sessionMode SessionMode, sessionStore SessionStoreKind) CountMode {
+	if sessionMode == BlockSessions || sessionStore == StateSessionStore {
+		return DeliverTxCounting
+	}
+	return CheckTxCounting
+}
+
+// Returns false if the limits of origins aren't enforced in the given phase.
+func (t *Throttle) countsIn(isCheckTx bool) bool {
+	return isCheckTx || t.countMode != CheckTxCounting
+}
+
+// Returns the throttle that counts txs in the given phase.
+func (t *Throttle) forPhase(isCheckTx bool) *Throttle {
+	if isCheckTx && t.checkTx != nil {
+		return t.checkTx
+	}
+	return t
+}
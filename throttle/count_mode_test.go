@@ -0,0 +1,68 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestCountModes(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	now := time.Unix(1500000000, 0)
+
+	newMiddleware := func(mode CountMode, kind SessionStoreKind) loomchain.TxMiddlewareFunc {
+		return GetKarmaMiddleWare(
+			true, 2, sessionDuration, 0, 0, StaticLimitResolver(2), createKarmaContractCtx,
+			WithCountMode(mode), WithSessionStore(kind), WithClock(ClockFunc(func() time.Time { return now })),
+		)
+	}
+	newSender := func(tmx loomchain.TxMiddlewareFunc) func(nonce uint64, isCheckTx bool) error {
+		memStore := store.NewMemStore()
+		return func(nonce uint64, isCheckTx bool) error {
+			state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1, Time: now}, nil, nil)
+			return processTxFrom(
+				tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, isCheckTx,
+			)
+		}
+	}
+	isLimitReached := func(err error) bool {
+		_, ok := err.(*TxLimitReachedError)
+		return ok
+	}
+
+	// Without a count mode a tx that's delivered after other txs have been checked is charged again.
+	sendTx := newSender(newMiddleware("", MemorySessionStore))
+	require.NoError(t, sendTx(1, true))
+	require.NoError(t, sendTx(2, true))
+	require.True(t, isLimitReached(sendTx(1, false)))
+
+	// In check mode each tx is only charged in CheckTx, and the limits aren't enforced in DeliverTx.
+	sendTx = newSender(newMiddleware(CheckTxCounting, MemorySessionStore))
+	require.NoError(t, sendTx(1, true))
+	require.NoError(t, sendTx(2, true))
+	require.NoError(t, sendTx(1, false))
+	require.NoError(t, sendTx(2, false))
+	require.True(t, isLimitReached(sendTx(3, true)))
+	require.NoError(t, sendTx(3, false))
+
+	// In both mode each tx is charged once in each phase, against separate budgets.
+	sendTx = newSender(newMiddleware(BothCounting, StateSessionStore))
+	require.NoError(t, sendTx(1, true))
+	require.NoError(t, sendTx(2, true))
+	require.NoError(t, sendTx(1, false))
+	require.NoError(t, sendTx(2, false))
+	require.True(t, isLimitReached(sendTx(3, true)))
+	require.True(t, isLimitReached(sendTx(3, false)))
+}
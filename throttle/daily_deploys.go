@@ -0,0 +1,79 @@
+package throttle
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/util"
+	"github.com/loomnetwork/loomchain"
+)
+
+// DailyDeployBudget is the budget reported in a TxLimitReachedError when an origin has used up its
+// daily deploy quota.
+const DailyDeployBudget = "daily_deploy"
+
+// Length of a day bucket in seconds, buckets are aligned to midnight UTC.
+const dayBucketDuration = 24 * 60 * 60
+
+var dailyDeployKeyPrefix = []byte("throttle-daily-deploys")
+
+func dailyDeployKey(origin loom.Address) []byte {
+	return util.PrefixKey(dailyDeployKeyPrefix, origin.Bytes())
+}
+
+// Returns the day bucket the block of the given state falls in, derived from the block time so all
+// the validators agree on it.
+func dayBucket(state loomchain.State) int64 {
+	return state.Block().Time / dayBucketDuration
+}
+
+// Counts a deploy tx from the given origin against its daily deploy quota, and returns a
+// TxLimitReachedError if the origin has already deployed as many contracts as it's allowed to in the
+// current day bucket. Rejected txs aren't counted, and neither are txs that fail since their changes
+// to the app state are discarded.
+// The count is stored in the app state along with the bucket it was stored in, so a count from an
+// earlier bucket is discarded the next time the origin deploys.
+func (t *Throttle) throttleDailyDeploys(state loomchain.State, origin loom.Address) error {
+	if isUnlimited(t.maxDailyDeployCount) {
+		return nil
+	}
+	bucket := dayBucket(state)
+	key := dailyDeployKey(origin)
+	count := blockSessionCount(state.Get(key), bucket)
+	if count >= t.maxDailyDeployCount {
+		t.metrics.txThrottled(deployBudget, origin.String())
+		retryAfter := (bucket + 1) * dayBucketDuration
+		return &TxLimitReachedError{
+			Origin:     origin,
+			Budget:     DailyDeployBudget,
+			Limit:      t.maxDailyDeployCount,
+			Used:       count,
+			Window:     dayBucketDuration * time.Second,
+			RetryAfter: retryAfter,
+			RetryIn:    time.Duration(retryAfter-state.Block().Time) * time.Second,
+		}
+	}
+
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[:8], uint64(bucket))
+	binary.BigEndian.PutUint64(data[8:], uint64(count+1))
+	state.Set(key, data)
+	return nil
+}
+
+// Returns how many contracts the given origin can still deploy in the current day bucket.
+func (t *Throttle) dailyDeployQuota(state loomchain.State, origin loom.Address) BudgetQuota {
+	bucket := dayBucket(state)
+	quota := BudgetQuota{
+		Budget:     DailyDeployBudget,
+		Limit:      t.maxDailyDeployCount,
+		Used:       blockSessionCount(state.Get(dailyDeployKey(origin)), bucket),
+		WindowEnds: (bucket + 1) * dayBucketDuration,
+	}
+	quota.Remaining = quota.Limit - quota.Used
+	if quota.Remaining < 0 {
+		quota.Remaining = 0
+	}
+	return quota
+}
@@ -0,0 +1,74 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestDailyDeployLimit(t *testing.T) {
+	admin := NewAdmin()
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithSessionStore(StateSessionStore)(th)
+	WithDailyDeployLimit(3)(th)
+	WithAdmin(admin)(th)
+	memStore := store.NewMemStore()
+	// 2017-07-15 00:00:00 UTC, the start of a day bucket.
+	midnight := int64(1500076800)
+	stateAt := func(height int64, blockTime int64) loomchain.State {
+		return loomchain.NewStoreState(nil, memStore, abci.Header{Height: height, Time: time.Unix(blockTime, 0)}, nil, nil)
+	}
+	dailyQuota := func(state loomchain.State) BudgetQuota {
+		quota, err := admin.Quota(state, origin)
+		require.NoError(t, err)
+		require.Len(t, quota.Budgets, int(numBudgets)+1)
+		return quota.Budgets[numBudgets]
+	}
+
+	state := stateAt(1, midnight-3600)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, th.throttleDailyDeploys(state, origin))
+	}
+	require.Equal(t, BudgetQuota{
+		Budget:     DailyDeployBudget,
+		Limit:      3,
+		Used:       3,
+		Remaining:  0,
+		WindowEnds: midnight,
+	}, dailyQuota(state))
+
+	// The quota holds for the rest of the day, across blocks & restarts since it's kept in the app
+	// state...
+	state = stateAt(100, midnight-1)
+	err := th.throttleDailyDeploys(state, origin)
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok, "expected a tx limit error, got %v", err)
+	require.Equal(t, DailyDeployBudget, limitErr.Budget)
+	require.Equal(t, int64(3), limitErr.Used)
+	require.Equal(t, midnight, limitErr.RetryAfter)
+	require.Equal(t, time.Second, limitErr.RetryIn)
+	require.Contains(t, limitErr.Error(), "used 3 of 3 deploy txs allowed per 24h0m0s session")
+	// ...and other origins have their own quota.
+	require.NoError(t, th.throttleDailyDeploys(state, addr1))
+
+	// The count of the previous day is discarded once the next day starts.
+	state = stateAt(101, midnight)
+	require.Equal(t, int64(3), dailyQuota(state).Remaining)
+	require.NoError(t, th.throttleDailyDeploys(state, origin))
+	require.Equal(t, BudgetQuota{
+		Budget:     DailyDeployBudget,
+		Limit:      3,
+		Used:       1,
+		Remaining:  2,
+		WindowEnds: midnight + dayBucketDuration,
+	}, dailyQuota(state))
+
+	ResetOriginState(state, origin)
+	require.Equal(t, int64(3), dailyQuota(state).Remaining)
+}
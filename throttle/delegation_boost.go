@@ -0,0 +1,155 @@
+package throttle
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+	"github.com/pkg/errors"
+)
+
+// Multiplier of origins that don't get a boost, multipliers are in percent.
+const unboostedMultiplier = 100
+
+// BoostPoint is a point of the curve that maps the total amount an origin has delegated to the
+// multiplier its call limit is boosted by.
+type BoostPoint struct {
+	// Total amount delegated (in whole tokens).
+	Delegation int64
+	// Multiplier applied to the call limit of origins that have delegated Delegation tokens, in
+	// percent, e.g. 150 makes the limit one and a half times the base limit.
+	Multiplier int64
+}
+
+// ValidateBoostCurve returns an error if the given curve doesn't start at zero with a multiplier of
+// at least 100, its points aren't in strictly ascending Delegation order, or its multipliers
+// decrease.
+func ValidateBoostCurve(curve []BoostPoint) error {
+	if len(curve) == 0 {
+		return errors.New("no boost points specified")
+	}
+	if curve[0].Delegation != 0 {
+		return errors.Errorf("first boost point must have a delegation of zero, not %d", curve[0].Delegation)
+	}
+	if curve[0].Multiplier < unboostedMultiplier {
+		return errors.Errorf("boost point 0 multiplier %d must be at least %d", curve[0].Multiplier, unboostedMultiplier)
+	}
+	for i := 1; i < len(curve); i++ {
+		if curve[i].Delegation <= curve[i-1].Delegation {
+			return errors.Errorf(
+				"boost point %d delegation %d must be greater than that of the previous point %d",
+				i, curve[i].Delegation, curve[i-1].Delegation,
+			)
+		}
+		if curve[i].Multiplier < curve[i-1].Multiplier {
+			return errors.Errorf(
+				"boost point %d multiplier %d must not be less than that of the previous point %d",
+				i, curve[i].Multiplier, curve[i-1].Multiplier,
+			)
+		}
+	}
+	return nil
+}
+
+// Boosts the call limit of origins by the amount they've delegated.
+type delegationBoost struct {
+	curve     []BoostPoint
+	maxLimit  int64
+	readStake StakeReader
+	// Multipliers of origins, cached until the block height changes.
+	cache blockLimitCache
+	// Amount in the smallest token unit of one whole token.
+	tokenAmount *big.Int
+}
+
+// WithDelegationBoost makes the middleware boost the call limit of each origin by a multiplier
+// derived from the total amount it has delegated (read by readStake, see NewDPOSStakeReader). The
+// multiplier is interpolated linearly between the points of the given curve (which must be valid,
+// see ValidateBoostCurve) and stays flat beyond its last point, boosted limits are capped at maxLimit
+// unless it's zero. The delegation of each origin is read once per block, so a change to it applies
+// from the next block, and a limit that drops below what the origin has already used just leaves it
+// with nothing remaining until the session ends. Limit table entries, validator limits & origin
+// overrides aren't boosted.
+func WithDelegationBoost(readStake StakeReader, maxLimit int64, curve ...BoostPoint) KarmaMiddlewareOption {
+	tokenAmount := new(big.Int).Exp(big.NewInt(10), big.NewInt(stakeTokenDecimals), nil)
+	return func(th *Throttle) {
+		th.delegationBoost = &delegationBoost{
+			curve:       curve,
+			maxLimit:    maxLimit,
+			readStake:   readStake,
+			tokenAmount: tokenAmount,
+		}
+	}
+}
+
+// Returns the multiplier (in percent) of an origin that has delegated the given amount (in the
+// smallest token unit).
+func (b *delegationBoost) multiplier(stake *big.Int) int64 {
+	last := b.curve[len(b.curve)-1]
+	for i := 1; i < len(b.curve); i++ {
+		upper := new(big.Int).Mul(big.NewInt(b.curve[i].Delegation), b.tokenAmount)
+		if stake.Cmp(upper) >= 0 {
+			continue
+		}
+		// Interpolated between the previous point & this one, in the smallest token unit so fractions
+		// of a token still count.
+		lower := b.curve[i-1]
+		span := new(big.Int).Mul(big.NewInt(b.curve[i].Delegation-lower.Delegation), b.tokenAmount)
+		offset := new(big.Int).Sub(stake, new(big.Int).Mul(big.NewInt(lower.Delegation), b.tokenAmount))
+		rise := new(big.Int).Mul(big.NewInt(b.curve[i].Multiplier-lower.Multiplier), offset)
+		return lower.Multiplier + rise.Div(rise, span).Int64()
+	}
+	return last.Multiplier
+}
+
+// Returns the given limit boosted by the given multiplier (in percent), and capped at the max limit.
+// The cap never reduces the limit below the given limit.
+func (b *delegationBoost) boost(limit int64, multiplier int64) int64 {
+	if isUnlimited(limit) || multiplier <= unboostedMultiplier {
+		return limit
+	}
+	boosted := int64(math.MaxInt64)
+	if limit <= math.MaxInt64/multiplier {
+		boosted = limit * multiplier / unboostedMultiplier
+	}
+	if b.maxLimit > 0 && boosted > b.maxLimit {
+		boosted = b.maxLimit
+		if boosted < limit {
+			boosted = limit
+		}
+	}
+	return boosted
+}
+
+// Returns the multiplier of the given origin, read once per block. A delegation that can't be read is
+// logged and treated as none, since rejecting all the txs of the origin would be worse.
+func (t *Throttle) boostMultiplier(state loomchain.State, origin loom.Address) int64 {
+	b := t.delegationBoost
+	multiplier, _ := b.cache.resolve(state, origin, func() (int64, error) {
+		stake, err := b.readStake(state, origin)
+		if err != nil {
+			t.logger.Error(
+				"Ignoring delegation of origin", "origin", origin.String(), "height", state.Block().Height, "err", err,
+			)
+			return unboostedMultiplier, nil
+		}
+		return b.multiplier(stake.Int), nil
+	})
+	return multiplier
+}
+
+// Resolves the call limit of origins with the wrapped resolver, and boosts it by the amount each
+// origin has delegated.
+type boostLimitResolver struct {
+	throttle *Throttle
+	next     LimitResolver
+}
+
+func (r *boostLimitResolver) ResolveLimit(state loomchain.State, origin loom.Address) (int64, error) {
+	limit, err := r.next.ResolveLimit(state, origin)
+	if err != nil {
+		return 0, err
+	}
+	return r.throttle.delegationBoost.boost(limit, r.throttle.boostMultiplier(state, origin)), nil
+}
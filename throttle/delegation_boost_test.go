@@ -0,0 +1,160 @@
+// +build evm
+
+package throttle
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+var testBoostCurve = []BoostPoint{
+	{Delegation: 0, Multiplier: 100},
+	{Delegation: 1000, Multiplier: 200},
+	{Delegation: 5000, Multiplier: 400},
+}
+
+// Returns the given amount of whole tokens in the smallest token unit.
+func stakeTokens(amount int64) *loom.BigUInt {
+	total := loom.NewBigUIntFromInt(10)
+	total.Exp(total, loom.NewBigUIntFromInt(stakeTokenDecimals), nil)
+	return total.Mul(total, loom.NewBigUIntFromInt(amount))
+}
+
+func TestValidateBoostCurve(t *testing.T) {
+	require.NoError(t, ValidateBoostCurve(testBoostCurve))
+
+	require.Error(t, ValidateBoostCurve(nil))
+	// The curve must start at zero, without reducing the limit.
+	require.Error(t, ValidateBoostCurve([]BoostPoint{{Delegation: 10, Multiplier: 100}}))
+	require.Error(t, ValidateBoostCurve([]BoostPoint{{Delegation: 0, Multiplier: 50}}))
+	// Delegations must be strictly ascending...
+	require.Error(t, ValidateBoostCurve([]BoostPoint{
+		{Delegation: 0, Multiplier: 100}, {Delegation: 1000, Multiplier: 200}, {Delegation: 1000, Multiplier: 300},
+	}))
+	// ...and multipliers non-decreasing.
+	require.Error(t, ValidateBoostCurve([]BoostPoint{
+		{Delegation: 0, Multiplier: 100}, {Delegation: 1000, Multiplier: 200}, {Delegation: 2000, Multiplier: 150},
+	}))
+}
+
+func TestDelegationBoostCurve(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithDelegationBoost(nil, 35, testBoostCurve...)(th)
+	b := th.delegationBoost
+
+	tests := []struct {
+		stake      *loom.BigUInt
+		multiplier int64
+		limit      int64
+	}{
+		{stakeTokens(0), 100, 10},
+		{stakeTokens(500), 150, 15},
+		{stakeTokens(1000), 200, 20},
+		{stakeTokens(3000), 300, 30},
+		// Boosted limits are capped...
+		{stakeTokens(5000), 400, 35},
+		// ...and the curve is flat beyond its last point.
+		{stakeTokens(1000000000000), 400, 35},
+	}
+	for _, test := range tests {
+		multiplier := b.multiplier(test.stake.Int)
+		require.Equal(t, test.multiplier, multiplier, test.stake.String())
+		require.Equal(t, test.limit, b.boost(10, multiplier), test.stake.String())
+	}
+
+	// Fractions of a token still count.
+	halfToken := new(big.Int).Div(stakeTokens(1).Int, big.NewInt(2))
+	require.Equal(t, int64(101), b.multiplier(new(big.Int).Add(stakeTokens(10).Int, halfToken)))
+	// The cap never reduces a limit, and unlimited origins stay unlimited.
+	require.Equal(t, int64(50), b.boost(50, 400))
+	require.Equal(t, Unlimited, b.boost(Unlimited, 400))
+}
+
+// Walks an origin through delegating, using its boosted quota, and undelegating within one session.
+func TestDelegationBoostLimits(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	now := time.Unix(1500000000, 0)
+	delegated := stakeTokens(0)
+	reads := 0
+	readStake := func(state loomchain.State, origin loom.Address) (*loom.BigUInt, error) {
+		reads++
+		return delegated, nil
+	}
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 10, sessionDuration, 0, 0, StaticLimitResolver(10), createKarmaContractCtx,
+		WithDelegationBoost(readStake, 30, testBoostCurve...), WithAdmin(admin),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+	memStore := store.NewMemStore()
+	height := int64(1)
+	stateNow := func() loomchain.State {
+		return loomchain.NewStoreState(nil, memStore, abci.Header{Height: height, Time: now}, nil, nil)
+	}
+	nonce := uint64(0)
+	sendTx := func() error {
+		nonce++
+		state := stateNow()
+		return processTxFrom(
+			tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+		)
+	}
+	callQuota := func() BudgetQuota {
+		quota, err := admin.Quota(stateNow(), origin)
+		require.NoError(t, err)
+		return quota.Budgets[callBudget]
+	}
+
+	// Without a delegation the origin gets the base limit.
+	require.NoError(t, sendTx())
+	require.Equal(t, int64(10), callQuota().Limit)
+
+	// A delegation boosts the limit from the next block, the delegation is only read once per block.
+	delegated = stakeTokens(2000)
+	require.Equal(t, int64(10), callQuota().Limit)
+	require.Equal(t, 1, reads)
+	height++
+	require.Equal(t, int64(25), callQuota().Limit)
+	for i := 0; i < 24; i++ {
+		require.NoError(t, sendTx())
+	}
+	require.Equal(t, BudgetQuota{Budget: "call", Limit: 25, Used: 25, Remaining: 0, WindowEnds: 1500000600}, callQuota())
+	_, ok := sendTx().(*TxLimitReachedError)
+	require.True(t, ok)
+
+	// Undelegating drops the limit below what the origin has already used, it has nothing left for the
+	// rest of the session rather than a negative remainder.
+	delegated = stakeTokens(0)
+	height++
+	quota := callQuota()
+	require.Equal(t, int64(10), quota.Limit)
+	require.Equal(t, int64(10), quota.Used)
+	require.Equal(t, int64(0), quota.Remaining)
+	err := sendTx()
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok, "expected a tx limit error, got %v", err)
+	require.Equal(t, int64(10), limitErr.Limit)
+
+	// The next session starts afresh under the base limit.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	height++
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sendTx())
+	}
+	_, ok = sendTx().(*TxLimitReachedError)
+	require.True(t, ok)
+}
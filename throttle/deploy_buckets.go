@@ -0,0 +1,193 @@
+package throttle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/go-loom/util"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+)
+
+// DeployBucketBudget is the budget reported in a TxLimitReachedError when an origin has sent as many
+// deploy txs of a given size as it's allowed to per deploy session.
+const DeployBucketBudget = "deploy_bucket"
+
+// DeployTooLargeErrorPrefix is the prefix of the message of every DeployTooLargeError.
+const DeployTooLargeErrorPrefix = "deploy too large"
+
+// DeployBucket sets how deploy txs whose bytecode is at least MinBytes long are throttled, a deploy
+// tx falls into the bucket with the highest MinBytes it reaches.
+type DeployBucket struct {
+	// Min size in bytes of the bytecode of the deploy txs in the bucket
+	MinBytes int64
+	// Cost of each deploy tx in the bucket against the deploy limit, zero to charge the cost of the tx
+	Cost int64
+	// Max number of deploy txs in the bucket each origin can send per deploy session, zero for no
+	// limit. Only supported by the state session store or in block session mode.
+	Limit int64
+	// Reject the deploy txs in the bucket outright
+	Reject bool
+}
+
+// ValidateDeployBuckets returns an error if any of the given buckets is invalid, or more than one of
+// them has the same MinBytes.
+func ValidateDeployBuckets(buckets []DeployBucket) error {
+	seen := make(map[int64]int, len(buckets))
+	for i, b := range buckets {
+		if b.MinBytes <= 0 {
+			return errors.Errorf("DeployBuckets[%d] MinBytes %d must be positive", i, b.MinBytes)
+		}
+		if j, ok := seen[b.MinBytes]; ok {
+			return errors.Errorf("DeployBuckets[%d] duplicates the MinBytes of DeployBuckets[%d]", i, j)
+		}
+		seen[b.MinBytes] = i
+		if b.Cost < 0 || b.Limit < 0 {
+			return errors.Errorf("DeployBuckets[%d] Cost %d & Limit %d must not be negative", i, b.Cost, b.Limit)
+		}
+		if b.Reject && (b.Cost > 0 || b.Limit > 0) {
+			return errors.Errorf("DeployBuckets[%d] rejects deploys so it must not set a Cost or Limit", i)
+		}
+		if !b.Reject && b.Cost == 0 && b.Limit == 0 {
+			return errors.Errorf("DeployBuckets[%d] must set Cost, Limit or Reject", i)
+		}
+	}
+	return nil
+}
+
+// WithDeployBuckets makes the middleware throttle deploy txs according to the bucket the size of
+// their bytecode falls into, so large deploys can cost more, be capped separately, or be rejected.
+// Deploy txs smaller than all the buckets are throttled as usual. The buckets must be valid (see
+// ValidateDeployBuckets).
+func WithDeployBuckets(buckets ...DeployBucket) KarmaMiddlewareOption {
+	sorted := make([]DeployBucket, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinBytes < sorted[j].MinBytes })
+	return func(th *Throttle) {
+		th.deployBuckets = sorted
+	}
+}
+
+// DeployTooLargeError is returned for deploy txs whose bytecode falls into a bucket that rejects
+// deploys, the tx will never be accepted so it shouldn't be resent.
+type DeployTooLargeError struct {
+	Origin loom.Address
+	// Size in bytes of the bytecode of the tx, or of the whole tx if it couldn't be decoded.
+	Size int64
+	// Min size in bytes of the deploy txs that are rejected.
+	MaxBytes int64
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func (e *DeployTooLargeError) Error() string {
+	return withHelp(fmt.Sprintf(
+		"%s: bytecode of %d bytes deployed by origin %s exceeds the limit of %d bytes",
+		DeployTooLargeErrorPrefix, e.Size, e.Origin, e.MaxBytes-1,
+	), e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *DeployTooLargeError) ABCICode() uint32 {
+	return DeployTooLargeCode
+}
+
+// Returns the size in bytes of the bytecode deployed by a deploy tx with the given ID & message data.
+// Falls back to the size of the whole tx if the bytecode can't be decoded, since the tx will be
+// rejected further down the middleware chain anyway.
+func deployCodeSize(txID types.TxID, msgData []byte, txBytes []byte) int64 {
+	switch txID {
+	case types.TxID_DEPLOY:
+		var deployTx vm.DeployTx
+		if err := proto.Unmarshal(msgData, &deployTx); err == nil {
+			return int64(len(deployTx.Code))
+		}
+	case types.TxID_ETHEREUM:
+		if size, err := ethDeployCodeSize(msgData); err == nil {
+			return size
+		}
+	}
+	return int64(len(txBytes))
+}
+
+// Returns the bucket a deploy tx whose bytecode has the given size falls into, nil if none.
+func (t *Throttle) deployBucketOf(size int64) *DeployBucket {
+	for i := len(t.deployBuckets) - 1; i >= 0; i-- {
+		if size >= t.deployBuckets[i].MinBytes {
+			return &t.deployBuckets[i]
+		}
+	}
+	return nil
+}
+
+// Returns a DeployTooLargeError if the deploy tx with the given bytecode size falls into a bucket
+// that rejects deploys, and otherwise the cost of the tx against the deploy limit.
+func (t *Throttle) checkDeployBucket(origin loom.Address, size int64, cost int64) (int64, error) {
+	bucket := t.deployBucketOf(size)
+	if bucket == nil {
+		return cost, nil
+	}
+	if bucket.Reject {
+		t.metrics.txThrottled(deployBudget, origin.String())
+		return cost, &DeployTooLargeError{Origin: origin, Size: size, MaxBytes: bucket.MinBytes}
+	}
+	if bucket.Cost > 0 {
+		return bucket.Cost, nil
+	}
+	return cost, nil
+}
+
+var deployBucketKeyPrefix = []byte("throttle-deploy-bucket")
+
+func deployBucketKey(origin loom.Address, minBytes int64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(minBytes))
+	return util.PrefixKey(deployBucketKeyPrefix, origin.Bytes(), b[:])
+}
+
+// Counts a deploy tx with the given bytecode size from the given origin against the limit of the
+// bucket it falls into, and returns a TxLimitReachedError if the origin has already sent as many
+// deploy txs in the bucket as it's allowed to in the current deploy session. Like the daily deploy
+// limit the counts are kept in the app state, rejected txs aren't counted, and neither are txs that
+// fail since their changes to the app state are discarded. Sessions are aligned to multiples of
+// their duration (or length in blocks) so all the validators agree on them.
+func (t *Throttle) throttleDeployBucket(state loomchain.State, origin loom.Address, size int64) error {
+	bucket := t.deployBucketOf(size)
+	if bucket == nil || bucket.Limit <= 0 {
+		return nil
+	}
+	var session int64
+	err := &TxLimitReachedError{Origin: origin, Budget: DeployBucketBudget, Limit: bucket.Limit}
+	if t.sessionMode == BlockSessions {
+		blocks := t.budgetSessionBlocks(deployBudget)
+		session = state.Block().Height / blocks
+		err.WindowBlocks = blocks
+		err.RetryAfterHeight = (session + 1) * blocks
+		err.RetryInBlocks = err.RetryAfterHeight - state.Block().Height
+	} else {
+		duration := t.budgetSessionDuration(deployBudget)
+		session = state.Block().Time / duration
+		err.Window = time.Duration(duration) * time.Second
+		err.RetryAfter = (session + 1) * duration
+		err.RetryIn = time.Duration(err.RetryAfter-state.Block().Time) * time.Second
+	}
+
+	key := deployBucketKey(origin, bucket.MinBytes)
+	count := blockSessionCount(state.Get(key), session)
+	if count >= bucket.Limit {
+		t.metrics.txThrottled(deployBudget, origin.String())
+		err.Used = count
+		return err
+	}
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[:8], uint64(session))
+	binary.BigEndian.PutUint64(data[8:], uint64(count+1))
+	state.Set(key, data)
+	return nil
+}
@@ -0,0 +1,138 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// Returns the bytes of a nonce tx with the given ID & message data.
+func deployNonceTx(t *testing.T, nonce uint64, id types.TxID, data []byte) []byte {
+	msgTx, err := proto.Marshal(&vm.MessageTx{Data: data, To: contract.MarshalPB()})
+	require.NoError(t, err)
+	tx, err := proto.Marshal(&loomchain.Transaction{Id: uint32(id), Data: msgTx})
+	require.NoError(t, err)
+	nonceTx, err := proto.Marshal(&loomAuth.NonceTx{Inner: tx, Sequence: nonce})
+	require.NoError(t, err)
+	return nonceTx
+}
+
+func TestDeployBuckets(t *testing.T) {
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sourcesDeploy},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStatesDeploy))
+
+	now := time.Unix(1500000000, 0)
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, maxCallCount, sessionDuration, 30, sessionDuration, nil, createKarmaContractCtx,
+		WithSessionStore(StateSessionStore), WithAdmin(admin),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		// Listed out of order, the buckets are sorted by size.
+		WithDeployBuckets(
+			DeployBucket{MinBytes: 4096, Cost: 10, Limit: 1},
+			DeployBucket{MinBytes: 1024, Cost: 5},
+			DeployBucket{MinBytes: 16384, Reject: true},
+		),
+	)
+	memStore := store.NewMemStore()
+	stateNow := func() loomchain.State {
+		return loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1, Time: now}, nil, nil)
+	}
+	nonce := uint64(0)
+	sendTxBytes := func(txBytes []byte, isCheckTx bool) error {
+		state := stateNow()
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+		_, err := tmx.ProcessTx(state.WithContext(ctx), txBytes, nopTxHandler, isCheckTx)
+		return err
+	}
+	// Txs are counted in DeliverTx with the state session store.
+	deploy := func(size int, isCheckTx bool) error {
+		nonce++
+		data, err := proto.Marshal(&vm.DeployTx{VmType: vm.VMType_EVM, Code: make([]byte, size)})
+		require.NoError(t, err)
+		return sendTxBytes(deployNonceTx(t, nonce, types.TxID_DEPLOY, data), isCheckTx)
+	}
+	ethDeploy := func(size int) error {
+		nonce++
+		data, err := ethTxBytes(nonce, loom.Address{}, make([]byte, size))
+		require.NoError(t, err)
+		return sendTxBytes(deployNonceTx(t, nonce, types.TxID_ETHEREUM, data), false)
+	}
+	deployUsed := func() int64 {
+		quota, err := admin.Quota(stateNow(), origin)
+		require.NoError(t, err)
+		return quota.Budgets[deployBudget].Used
+	}
+	requireTooLarge := func(err error, size int64) {
+		tooLarge, ok := err.(*DeployTooLargeError)
+		require.True(t, ok, "expected a deploy too large error, got %v", err)
+		require.Equal(t, size, tooLarge.Size)
+		require.Equal(t, int64(16384), tooLarge.MaxBytes)
+		require.Equal(t, DeployTooLargeCode, tooLarge.ABCICode())
+		require.False(t, IsRetryableCode(tooLarge.ABCICode()))
+	}
+
+	// Deploys smaller than all the buckets are charged as usual...
+	require.NoError(t, deploy(1023, false))
+	require.Equal(t, int64(1), deployUsed())
+	// ...while larger deploys are charged the cost of their bucket.
+	require.NoError(t, deploy(1024, false))
+	require.Equal(t, int64(6), deployUsed())
+	require.NoError(t, deploy(4095, false))
+	require.Equal(t, int64(11), deployUsed())
+	require.NoError(t, ethDeploy(1024))
+	require.Equal(t, int64(16), deployUsed())
+	require.NoError(t, deploy(4096, false))
+	require.Equal(t, int64(26), deployUsed())
+
+	// Only one deploy of 4 KB or more is allowed per deploy session.
+	err := deploy(16383, false)
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok, "expected a tx limit error, got %v", err)
+	require.Equal(t, DeployBucketBudget, limitErr.Budget)
+	require.Equal(t, int64(1), limitErr.Limit)
+	require.Equal(t, int64(1), limitErr.Used)
+	require.Equal(t, TxLimitReachedCode, limitErr.ABCICode())
+	require.Contains(t, limitErr.Error(), "used 1 of 1 deploy txs")
+
+	// Deploys of 16 KB or more are rejected outright, even in CheckTx where txs aren't counted.
+	requireTooLarge(deploy(16384, false), 16384)
+	requireTooLarge(deploy(20000, true), 20000)
+	requireTooLarge(ethDeploy(16384), 16384)
+	// Deploy txs whose bytecode can't be decoded are sized by the whole tx.
+	garbage := make([]byte, 16384)
+	for i := range garbage {
+		garbage[i] = 0xff
+	}
+	nonce++
+	txBytes := deployNonceTx(t, nonce, types.TxID_DEPLOY, garbage)
+	requireTooLarge(sendTxBytes(txBytes, false), int64(len(txBytes)))
+
+	// The bucket limit resets along with the deploy session.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	require.NoError(t, deploy(4096, false))
+	require.Equal(t, int64(10), deployUsed())
+	_, ok = deploy(5000, false).(*TxLimitReachedError)
+	require.True(t, ok)
+
+	// Resetting the origin clears its bucket counts too.
+	ResetOriginState(stateNow(), origin)
+	require.NoError(t, deploy(4096, false))
+}
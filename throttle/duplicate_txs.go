@@ -0,0 +1,99 @@
+package throttle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+)
+
+// DuplicateTxErrorPrefix is the prefix of the message of every DuplicateTxError.
+const DuplicateTxErrorPrefix = "duplicate transaction"
+
+// DuplicateTxError is returned when an origin resends a tx it has already sent during the current
+// call session, the tx isn't counted against any of the limits of the origin.
+type DuplicateTxError struct {
+	Origin loom.Address
+	// SHA-256 hash of the tx bytes, hex encoded.
+	Hash string
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func (e *DuplicateTxError) Error() string {
+	return withHelp(fmt.Sprintf("%s: origin %s already sent tx %s", DuplicateTxErrorPrefix, e.Origin, e.Hash), e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *DuplicateTxError) ABCICode() uint32 {
+	return DuplicateTxCode
+}
+
+// Hashes of the txs an origin has recently sent, only tracked in CheckTx.
+type recentTxs struct {
+	// When the call session the hashes were recorded in started, the hashes are forgotten once the
+	// session ends.
+	start  time.Time
+	hashes map[[sha256.Size]byte]*recentTx
+	// Hashes in the order they were recorded, so the oldest can be evicted.
+	order [][sha256.Size]byte
+}
+
+type recentTx struct {
+	// Height of the block the tx was last checked in.
+	height int64
+	// True if the tx passed the last check.
+	accepted bool
+}
+
+// Rejects the given tx with a DuplicateTxError if the origin has already sent it during the current
+// call session, otherwise records its hash. Returns a function that must be called if the tx passes
+// CheckTx. Only applies to CheckTx, duplicates that make it into a block are rejected by the nonce
+// check anyway.
+// Txs that have passed CheckTx are checked again after every block while they're in the mempool, so
+// a tx that passed its last check is only considered a duplicate if it's resent within the same
+// block.
+func (t *Throttle) checkDuplicateTx(
+	state loomchain.State, origin loom.Address, txBytes []byte, isCheckTx bool,
+) (func(), error) {
+	if t.maxRecentTxs <= 0 || !isCheckTx {
+		return func() {}, nil
+	}
+	hash := sha256.Sum256(txBytes)
+	height := state.Block().Height
+	now := t.clock.Now()
+
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	session := t.getSession(origin.String(), now)
+	recent := session.recentTxs
+	if recent == nil || now.Sub(recent.start) >= t.sessionPeriod(callBudget) {
+		recent = &recentTxs{start: now, hashes: make(map[[sha256.Size]byte]*recentTx)}
+		session.recentTxs = recent
+	}
+	tx, ok := recent.hashes[hash]
+	if ok {
+		if !tx.accepted || tx.height >= height {
+			return func() {}, &DuplicateTxError{Origin: origin, Hash: hex.EncodeToString(hash[:])}
+		}
+	} else {
+		if len(recent.order) >= t.maxRecentTxs {
+			delete(recent.hashes, recent.order[0])
+			recent.order = recent.order[1:]
+		}
+		tx = &recentTx{}
+		recent.hashes[hash] = tx
+		recent.order = append(recent.order, hash)
+	}
+	tx.height = height
+	tx.accepted = false
+	return func() {
+		t.sessionsMtx.Lock()
+		tx.accepted = true
+		t.sessionsMtx.Unlock()
+	}, nil
+}
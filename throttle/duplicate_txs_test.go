@@ -0,0 +1,114 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestDuplicateTxDetection(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithDuplicateTxDetection(3)(th)
+	WithClock(ClockFunc(func() time.Time { return now }))(th)
+	memStore := store.NewMemStore()
+	stateAt := func(height int64) loomchain.State {
+		return loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+	}
+	checkTx := func(height int64, txBytes []byte) (func(), error) {
+		return th.checkDuplicateTx(stateAt(height), origin, txBytes, true)
+	}
+	isDuplicate := func(err error) bool {
+		dupErr, ok := err.(*DuplicateTxError)
+		if ok {
+			require.Equal(t, DuplicateTxCode, dupErr.ABCICode())
+		}
+		return ok
+	}
+	txA := mockSignedTx(t, 1, types.TxID_CALL, vm.VMType_PLUGIN, contract).Inner
+	// Same payload as txA with a different nonce.
+	txB := mockSignedTx(t, 2, types.TxID_CALL, vm.VMType_PLUGIN, contract).Inner
+
+	_, err := checkTx(5, txA)
+	require.NoError(t, err)
+	_, err = checkTx(5, txA)
+	require.True(t, isDuplicate(err))
+	_, err = checkTx(5, txB)
+	require.NoError(t, err)
+	// Other origins can send the same tx bytes.
+	_, err = th.checkDuplicateTx(stateAt(5), addr1, txA, true)
+	require.NoError(t, err)
+	// Duplicates aren't detected in DeliverTx.
+	_, err = th.checkDuplicateTx(stateAt(5), origin, txA, false)
+	require.NoError(t, err)
+
+	// A tx that passed CheckTx can be checked again in a later block, while it's in the mempool...
+	txC := mockSignedTx(t, 3, types.TxID_CALL, vm.VMType_PLUGIN, contract).Inner
+	accept, err := checkTx(5, txC)
+	require.NoError(t, err)
+	accept()
+	_, err = checkTx(5, txC)
+	require.True(t, isDuplicate(err))
+	_, err = checkTx(6, txC)
+	require.NoError(t, err)
+	// ...but a tx that failed CheckTx can't be resent.
+	_, err = checkTx(7, txA)
+	require.True(t, isDuplicate(err))
+
+	// Only the most recent txs are remembered.
+	txD := mockSignedTx(t, 4, types.TxID_CALL, vm.VMType_PLUGIN, contract).Inner
+	_, err = checkTx(7, txD)
+	require.NoError(t, err)
+	_, err = checkTx(7, txA)
+	require.NoError(t, err)
+
+	// The hashes are forgotten once the call session ends.
+	_, err = checkTx(7, txD)
+	require.True(t, isDuplicate(err))
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	_, err = checkTx(7, txD)
+	require.NoError(t, err)
+}
+
+func TestDuplicateTxsNotCharged(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, maxCallCount, sessionDuration, 0, 0, StaticLimitResolver(maxCallCount), createKarmaContractCtx,
+		WithDuplicateTxDetection(100), WithCountFailedTxs(true), WithAdmin(admin),
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+	failing := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{}, errors.New("bad nonce")
+	}
+
+	// A client that keeps resending a tx that fails is only charged for the first copy.
+	txBytes := mockSignedTx(t, 1, types.TxID_CALL, vm.VMType_PLUGIN, contract).Inner
+	_, err := tmx.ProcessTx(state.WithContext(ctx), txBytes, failing, true)
+	require.EqualError(t, err, "bad nonce")
+	for i := 0; i < 20; i++ {
+		_, err = tmx.ProcessTx(state.WithContext(ctx), txBytes, failing, true)
+		_, ok := err.(*DuplicateTxError)
+		require.True(t, ok, "expected a duplicate tx error, got %v", err)
+	}
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), quota.Budgets[callBudget].Used)
+}
@@ -0,0 +1,80 @@
+package throttle
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ABCI response codes of the txs rejected by the throttle. The throttle uses the codes from
+// MinErrorCode to MaxErrorCode, other tx handlers & middleware report failed txs with code 1, so
+// clients can tell a tx rejected by the throttle apart from an invalid tx by the code alone. Codes
+// are never reused or renumbered, new errors get the next unused code in the range.
+// The codes are only reported by CheckTx, txs rejected in DeliverTx are reported with code 1 so the
+// block results don't depend on them.
+const (
+	// TxLimitReachedCode is the ABCI response code of txs rejected with a TxLimitReachedError for
+	// the call, deploy or daily deploy budget, or by the tx limiter middleware.
+	TxLimitReachedCode uint32 = 429
+	// ContractTxLimitReachedCode is the ABCI response code of txs rejected with a
+	// ContractTxLimitReachedError.
+	ContractTxLimitReachedCode uint32 = 430
+	// BlockTxLimitReachedCode is the ABCI response code of txs rejected with a BlockTxLimitReachedError.
+	BlockTxLimitReachedCode uint32 = 431
+	// DuplicateTxCode is the ABCI response code of txs rejected with a DuplicateTxError.
+	DuplicateTxCode uint32 = 432
+	// FailureCooldownCode is the ABCI response code of txs rejected with a FailureCooldownError.
+	FailureCooldownCode uint32 = 433
+	// TxBytesLimitReachedCode is the ABCI response code of txs rejected with a TxLimitReachedError
+	// for the bytes budget.
+	TxBytesLimitReachedCode uint32 = 434
+	// OriginCooldownCode is the ABCI response code of txs rejected with an OriginCooldownError.
+	OriginCooldownCode uint32 = 435
+	// TxCostExceedsLimitCode is the ABCI response code of txs rejected with a TxCostExceedsLimitError.
+	TxCostExceedsLimitCode uint32 = 436
+	// DeployTooLargeCode is the ABCI response code of txs rejected with a DeployTooLargeError.
+	DeployTooLargeCode uint32 = 437
+	// MaintenanceModeCode is the ABCI response code of txs rejected with a MaintenanceModeError.
+	MaintenanceModeCode uint32 = 438
+
+	// MinErrorCode is the lowest ABCI response code reserved for the throttle.
+	MinErrorCode uint32 = 429
+	// MaxErrorCode is the highest ABCI response code reserved for the throttle.
+	MaxErrorCode uint32 = 449
+)
+
+// IsRetryableCode returns true if a tx rejected with the given ABCI response code may be accepted
+// if it's resent later, and false if it's not a throttle code or resending the tx won't help.
+func IsRetryableCode(code uint32) bool {
+	switch code {
+	case TxLimitReachedCode, ContractTxLimitReachedCode, BlockTxLimitReachedCode, FailureCooldownCode,
+		TxBytesLimitReachedCode, OriginCooldownCode, MaintenanceModeCode:
+		return true
+	}
+	return false
+}
+
+// An error with a fixed message that's reported with a specific ABCI response code.
+type codedError struct {
+	msg  string
+	code uint32
+}
+
+func (e *codedError) Error() string {
+	return e.msg
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *codedError) ABCICode() uint32 {
+	return e.code
+}
+
+// Returns the given text on a single line without control characters, so text configured by the
+// operator can't break up or forge the lines of the log a tx is rejected with.
+func logSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
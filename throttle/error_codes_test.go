@@ -0,0 +1,50 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+
+	"github.com/loomnetwork/loomchain"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// Pins the ABCI response codes of the errors the throttle rejects txs with, since clients decide
+// whether to retry a tx based on them.
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		err       error
+		code      uint32
+		retryable bool
+	}{
+		{&TxLimitReachedError{Origin: origin, Budget: "call"}, 429, true},
+		{&TxLimitReachedError{Origin: origin, Budget: "deploy"}, 429, true},
+		{&TxLimitReachedError{Origin: origin, Budget: "daily_deploy"}, 429, true},
+		{ErrTxLimitReached, 429, true},
+		{&ContractTxLimitReachedError{Origin: origin, Contract: contract, Scope: "contract"}, 430, true},
+		{&BlockTxLimitReachedError{Origin: origin}, 431, true},
+		{&DuplicateTxError{Origin: origin}, 432, false},
+		{&FailureCooldownError{Origin: origin}, 433, true},
+		{&TxLimitReachedError{Origin: origin, Budget: "bytes"}, 434, true},
+		{&OriginCooldownError{Origin: origin}, 435, true},
+		{&TxCostExceedsLimitError{Origin: origin, Budget: "call"}, 436, false},
+		{&DeployTooLargeError{Origin: origin}, 437, false},
+		{&MaintenanceModeError{Origin: origin}, 438, true},
+		{&TxLimitReachedError{Origin: origin, Budget: "deploy_bucket"}, 429, true},
+	}
+	for _, test := range tests {
+		// The app maps errors to codes by the cause, so wrapping doesn't change the code.
+		txErr, ok := errors.Cause(errors.Wrap(test.err, "middleware")).(loomchain.TxError)
+		require.True(t, ok, "%T must implement TxError", test.err)
+		require.Equal(t, test.code, txErr.ABCICode(), test.err.Error())
+		require.True(t, txErr.ABCICode() >= MinErrorCode && txErr.ABCICode() <= MaxErrorCode)
+		require.Equal(t, test.retryable, IsRetryableCode(test.code), test.err.Error())
+	}
+	require.False(t, IsRetryableCode(1))
+
+	// Help text is reported on the same line as the rest of the message.
+	err := &DuplicateTxError{Origin: origin, Hash: "ab12", Help: "See\nhttps://example.com\r\nfor details"}
+	require.NotContains(t, err.Error(), "\n")
+	require.Contains(t, err.Error(), "See https://example.com  for details")
+}
@@ -0,0 +1,107 @@
+// +build evm
+
+package throttle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// Pins the format of the messages of the errors the throttle rejects txs with, since some clients
+// parse them. Changing the format requires bumping ErrorMessageVersion & adding a new snapshot.
+func TestErrorMessageSnapshot(t *testing.T) {
+	help := "See https://example.com/rate-limits for details"
+	errs := []error{
+		&TxLimitReachedError{
+			Origin: origin, Budget: "call", Limit: 100, Used: 100, Window: 10 * time.Minute,
+			RetryAfter: 1500000600, RetryIn: 4*time.Minute + 11200*time.Millisecond,
+		},
+		&TxLimitReachedError{
+			Origin: origin, Budget: "call", Limit: 100, Used: 100, Window: 10 * time.Minute,
+			RetryAfter: 1500000600, RetryIn: 4*time.Minute + 12*time.Second, Help: help,
+		},
+		&TxLimitReachedError{
+			Origin: origin, Budget: "call", Limit: 150, Used: 150, Window: 10 * time.Minute,
+			RetryAfter: 1500000600, RetryIn: 4*time.Minute + 12*time.Second, Burst: true,
+		},
+		&TxLimitReachedError{
+			Origin: origin, Budget: "call", Limit: 100, Used: 100, Window: 10 * time.Minute,
+			RetryAfter: 1500000600, RetryIn: 4*time.Minute + 12*time.Second, BurstAvailableAt: 1500001800,
+		},
+		&TxLimitReachedError{
+			Origin: origin, Budget: "bytes", Limit: 4096, Used: 4000, Window: 10 * time.Minute,
+			RetryAfter: 1500000600, RetryIn: 4*time.Minute + 12*time.Second,
+		},
+		&TxLimitReachedError{
+			Origin: origin, Budget: "deploy", Limit: 5, Used: 5, WindowBlocks: 100, RetryAfterHeight: 200,
+			RetryInBlocks: 42,
+		},
+		&TxCostExceedsLimitError{Origin: origin, Budget: "call", Cost: 20, Limit: 10},
+		&TxCostExceedsLimitError{Origin: origin, Budget: "bytes", Cost: 8192, Limit: 4096, Help: help},
+		&ContractTxLimitReachedError{
+			Origin: origin, Contract: contract, Scope: "contract", Limit: 1000, Used: 1000,
+			Window: 10 * time.Minute, RetryAfter: 1500000600, RetryIn: 30 * time.Second,
+		},
+		&ContractTxLimitReachedError{
+			Origin: origin, Contract: contract, Scope: "origin-contract", Limit: 10, Used: 10,
+			WindowBlocks: 100, RetryAfterHeight: 200, RetryInBlocks: 1, Help: help,
+		},
+		&OriginCooldownError{Origin: origin, Cooldown: 2 * time.Minute, RetryAfter: 1500000120, RetryIn: 2 * time.Minute},
+		&BlockTxLimitReachedError{Origin: origin, Limit: 3, Height: 10},
+		&DuplicateTxError{Origin: origin, Hash: "ab12", Help: help},
+	}
+	var msgs []string
+	for _, err := range errs {
+		// Addresses are replaced with placeholders so the snapshot doesn't depend on their encoding.
+		msg := strings.Replace(err.Error(), origin.String(), "<origin>", -1)
+		msgs = append(msgs, strings.Replace(msg, contract.String(), "<contract>", -1))
+	}
+
+	snapshot, err := ioutil.ReadFile(fmt.Sprintf("testdata/error_messages_v%d.txt", ErrorMessageVersion))
+	require.NoError(t, err)
+	require.Equal(t, string(snapshot), strings.Join(msgs, "\n")+"\n")
+}
+
+func TestThrottledTxMessage(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	tmx := GetKarmaMiddleWare(
+		true, 1, sessionDuration, 0, 0, StaticLimitResolver(1), createKarmaContractCtx,
+		WithClock(clock), WithHelpText("See https://example.com/rate-limits"),
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func() error {
+		nonce++
+		return processTxFrom(
+			tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, false,
+		)
+	}
+
+	require.NoError(t, sendTx())
+	clock.Advance(100 * time.Second)
+	err := sendTx()
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok, "expected a tx limit error, got %v", err)
+	require.Equal(t, time.Duration(sessionDuration-100)*time.Second, limitErr.RetryIn)
+	require.Equal(t, fmt.Sprintf(
+		"tx limit reached: origin %s used 1 of 1 call txs allowed per 10m0s session, retry in 8m20s (after %d). "+
+			"See https://example.com/rate-limits",
+		origin, 1500000000+sessionDuration,
+	), err.Error())
+}
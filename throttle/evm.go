@@ -15,3 +15,19 @@ func isEthDeploy(txBytes []byte) (bool, error) {
 	}
 	return tx.To() == nil, nil
 }
+
+func ethDeployCodeSize(txBytes []byte) (int64, error) {
+	var tx types.Transaction
+	if err := rlp.DecodeBytes(txBytes, &tx); err != nil {
+		return 0, errors.Wrap(err, "decoding ethereum transaction")
+	}
+	return int64(len(tx.Data())), nil
+}
+
+func ethCallData(txBytes []byte) ([]byte, error) {
+	var tx types.Transaction
+	if err := rlp.DecodeBytes(txBytes, &tx); err != nil {
+		return nil, errors.Wrap(err, "decoding ethereum transaction")
+	}
+	return tx.Data(), nil
+}
@@ -0,0 +1,161 @@
+package throttle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+)
+
+// FailureCooldownErrorPrefix is the prefix of the message of every FailureCooldownError.
+const FailureCooldownErrorPrefix = "too many failed transactions"
+
+// Determines when an origin whose txs keep failing after passing the throttle is put into a cooldown.
+type failurePolicy struct {
+	// Number of consecutive failed txs that puts the origin into a cooldown.
+	threshold int64
+	// Length of the first cooldown, doubled by every subsequent cooldown of the origin.
+	cooldown time.Duration
+	// Max length of a cooldown.
+	maxCooldown time.Duration
+}
+
+// Tracks the txs of an origin that failed after passing the throttle.
+type failureState struct {
+	// Number of consecutive txs that failed, reset by a tx that succeeds.
+	streak int64
+	// Number of cooldowns the origin has been put into, forgotten along with the session record of
+	// the origin once it's idle.
+	offenses int
+	// When the current cooldown ends, the zero time if the origin isn't in a cooldown.
+	cooldownEnds time.Time
+	// Length of the current cooldown.
+	cooldown time.Duration
+}
+
+// Returns when the latest cooldown the origin is in ends, whether it's for sending txs over its
+// limits or txs that failed.
+func (s *originSession) cooldownEnds() time.Time {
+	if s.failures.cooldownEnds.After(s.penalty.cooldownEnds) {
+		return s.failures.cooldownEnds
+	}
+	return s.penalty.cooldownEnds
+}
+
+// FailureCooldownError is returned for every tx an origin sends while it's in a cooldown for sending
+// too many consecutive txs that failed.
+type FailureCooldownError struct {
+	Origin loom.Address
+	// Number of consecutive failed txs that put the origin into the cooldown.
+	Failures int64
+	// Length of the cooldown.
+	Cooldown time.Duration
+	// Unix timestamp (in seconds) at which the cooldown ends.
+	RetryAfter int64
+	// How long the origin has to wait until RetryAfter, as of the rejected tx.
+	RetryIn time.Duration
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func (e *FailureCooldownError) Error() string {
+	return withHelp(fmt.Sprintf(
+		"%s: origin %s is in a %v cooldown after %d consecutive failed txs, %s",
+		FailureCooldownErrorPrefix, e.Origin, e.Cooldown, e.Failures, retryIn(e.RetryIn, e.RetryAfter),
+	), e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *FailureCooldownError) ABCICode() uint32 {
+	return FailureCooldownCode
+}
+
+// Failures are only tracked in session records kept in memory, since changes to the app state made
+// while processing a failed tx are discarded.
+func (t *Throttle) failureCooldownEnabled() bool {
+	return t.failures != nil && t.sessionMode != BlockSessions && t.sessionStore == MemorySessionStore
+}
+
+// Returns a FailureCooldownError if the given origin is in a cooldown for sending too many failed
+// txs. Only does a map lookup so rejecting txs from an origin in a cooldown is cheap.
+func (t *Throttle) checkFailureCooldown(origin loom.Address) error {
+	if !t.failureCooldownEnabled() {
+		return nil
+	}
+	now := t.clock.Now()
+
+	t.sessionsMtx.RLock()
+	defer t.sessionsMtx.RUnlock()
+
+	session, ok := t.sessions[origin.String()]
+	if !ok || !now.Before(session.failures.cooldownEnds) {
+		return nil
+	}
+	f := session.failures
+	t.metrics.txThrottled(callBudget, origin.String())
+	return &FailureCooldownError{
+		Origin:     origin,
+		Failures:   t.failures.threshold,
+		Cooldown:   f.cooldown,
+		RetryAfter: roundUpUnix(f.cooldownEnds),
+		RetryIn:    f.cooldownEnds.Sub(now),
+	}
+}
+
+// Returns the given handler wrapped so the outcome of the tx is recorded against the failure streak
+// of the given origin. Txs that fail or panic count towards the streak even if they're refunded (see
+// refundOnFailure).
+func (t *Throttle) trackFailures(next loomchain.TxHandlerFunc, origin loom.Address) loomchain.TxHandlerFunc {
+	if !t.failureCooldownEnabled() {
+		return next
+	}
+	return func(state loomchain.State, txBytes []byte, isCheckTx bool) (res loomchain.TxHandlerResult, err error) {
+		succeeded := false
+		defer func() {
+			t.recordOutcome(origin, succeeded)
+		}()
+		res, err = next(state, txBytes, isCheckTx)
+		succeeded = err == nil
+		return res, err
+	}
+}
+
+// Records the outcome of a tx sent by the given origin, and puts the origin into a cooldown if too
+// many of its txs have failed in a row. Every cooldown of the origin is twice as long as the
+// previous one, up to the max cooldown.
+func (t *Throttle) recordOutcome(origin loom.Address, succeeded bool) {
+	now := t.clock.Now()
+
+	t.sessionsMtx.Lock()
+	session := t.getSession(origin.String(), now)
+	f := &session.failures
+	if succeeded {
+		f.streak = 0
+		t.sessionsMtx.Unlock()
+		return
+	}
+	f.streak++
+	startCooldown := f.streak >= t.failures.threshold
+	if startCooldown {
+		f.streak = 0
+		f.cooldown = t.failures.cooldown
+		for i := 0; i < f.offenses && f.cooldown < t.failures.maxCooldown; i++ {
+			f.cooldown *= 2
+		}
+		if f.cooldown > t.failures.maxCooldown {
+			f.cooldown = t.failures.maxCooldown
+		}
+		f.offenses++
+		f.cooldownEnds = now.Add(f.cooldown)
+	}
+	cooldown, cooldownEnds := f.cooldown, f.cooldownEnds
+	t.sessionsMtx.Unlock()
+
+	if startCooldown {
+		t.logger.Info(
+			"Origin put into throttle cooldown for failed txs", "origin", origin.String(), "cooldown", cooldown,
+		)
+		t.auditCooldownStarted(t.originString(origin), FailureCooldownPolicy, cooldown, cooldownEnds)
+	}
+}
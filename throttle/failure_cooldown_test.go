@@ -0,0 +1,90 @@
+// +build evm
+
+package throttle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestFailureCooldown(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	now := time.Unix(1500000000, 0)
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 10, sessionDuration, 0, 0, StaticLimitResolver(10), createKarmaContractCtx,
+		WithFailureCooldown(3, 10*time.Second, 25*time.Second), WithAdmin(admin),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+
+	failingHandler := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{}, errors.New("out of gas")
+	}
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func(next loomchain.TxHandlerFunc) error {
+		nonce++
+		return processTxFrom(
+			tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), next, true,
+		)
+	}
+	cooldownOf := func(err error) time.Duration {
+		cooldownErr, ok := err.(*FailureCooldownError)
+		require.True(t, ok, "expected a failure cooldown error, got %v", err)
+		require.Equal(t, FailureCooldownCode, cooldownErr.ABCICode())
+		return cooldownErr.Cooldown
+	}
+	usedCalls := func() int64 {
+		quota, err := admin.Quota(state, origin)
+		require.NoError(t, err)
+		return quota.Budgets[callBudget].Used
+	}
+
+	// A tx that succeeds resets the streak.
+	require.EqualError(t, sendTx(failingHandler), "out of gas")
+	require.EqualError(t, sendTx(failingHandler), "out of gas")
+	require.NoError(t, sendTx(nopTxHandler))
+	require.EqualError(t, sendTx(failingHandler), "out of gas")
+	require.EqualError(t, sendTx(failingHandler), "out of gas")
+	require.NoError(t, sendTx(nopTxHandler))
+
+	// Failed txs are refunded, but still count towards the streak.
+	for i := 0; i < 3; i++ {
+		require.EqualError(t, sendTx(failingHandler), "out of gas")
+	}
+	require.Equal(t, int64(2), usedCalls())
+	require.Equal(t, 10*time.Second, cooldownOf(sendTx(nopTxHandler)))
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, now.Unix()+10, quota.CooldownEnds)
+
+	// Txs rejected during the cooldown aren't counted, and the origin can send txs again once it ends.
+	now = now.Add(10 * time.Second)
+	require.Equal(t, int64(2), usedCalls())
+	require.NoError(t, sendTx(nopTxHandler))
+
+	// Every subsequent cooldown is twice as long, up to the max.
+	for i := 0; i < 3; i++ {
+		require.EqualError(t, sendTx(failingHandler), "out of gas")
+	}
+	require.Equal(t, 20*time.Second, cooldownOf(sendTx(failingHandler)))
+	now = now.Add(20 * time.Second)
+	for i := 0; i < 3; i++ {
+		require.EqualError(t, sendTx(failingHandler), "out of gas")
+	}
+	require.Equal(t, 25*time.Second, cooldownOf(sendTx(nopTxHandler)))
+	require.Equal(t, int64(3), usedCalls())
+}
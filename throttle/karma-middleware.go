@@ -3,30 +3,430 @@ package throttle
 import (
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/loomnetwork/go-loom"
 	lauth "github.com/loomnetwork/go-loom/auth"
-	"github.com/loomnetwork/go-loom/common"
 	"github.com/loomnetwork/go-loom/plugin/contractpb"
 	"github.com/loomnetwork/go-loom/types"
 	"github.com/loomnetwork/loomchain"
 	"github.com/loomnetwork/loomchain/auth"
 	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
 	"github.com/loomnetwork/loomchain/eth/utils"
+	"github.com/loomnetwork/loomchain/log"
 	"github.com/loomnetwork/loomchain/vm"
 	"github.com/pkg/errors"
 )
 
-const karmaMiddlewareThrottleKey = "ThrottleTxMiddleWare"
+// KarmaMiddlewareOption customizes the middleware created by GetKarmaMiddleWare.
+type KarmaMiddlewareOption func(th *Throttle)
 
+// WithMetrics makes the middleware report to the given metrics instead of discarding them.
+func WithMetrics(metrics *Metrics) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.metrics = metrics
+	}
+}
+
+// WithWindowMode makes the middleware group txs into sessions using the given mode, by default
+// fixed windows are used. The leaky bucket must be enabled with WithLeakyBucket instead.
+func WithWindowMode(mode WindowMode) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.windowMode = mode
+	}
+}
+
+// WithLeakyBucket makes the middleware limit the call txs of each origin with a leaky bucket (see
+// LeakyBucket) that leaks the given number of txs per second, which may be a fraction, and holds as
+// many txs as the call limit of the origin. The rate must be positive.
+func WithLeakyBucket(leakRate float64) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.windowMode = LeakyBucket
+		th.leakInterval = time.Duration(math.Ceil(float64(time.Second) / leakRate))
+	}
+}
+
+// WithBlockSessions makes the middleware measure sessions in blocks rather than seconds, and store
+// tx counts in the app state so all nodes enforce the limits deterministically. If
+// deploySessionBlocks is zero deploy sessions last as long as call sessions.
+func WithBlockSessions(sessionBlocks int64, deploySessionBlocks int64) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.sessionMode = BlockSessions
+		th.sessionBlocks = sessionBlocks
+		th.deploySessionBlocks = deploySessionBlocks
+	}
+}
+
+// WithSessionStore makes the middleware keep session records in the given store, by default they're
+// kept in memory. Ignored in block session mode, which always stores tx counts in the app state.
+func WithSessionStore(kind SessionStoreKind) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.sessionStore = kind
+		if kind == StateSessionStore {
+			th.store = &stateStore{throttle: th}
+		} else {
+			th.store = &memoryStore{throttle: th}
+		}
+	}
+}
+
+// WithThrottleStore makes the middleware keep session records in the given store in time session
+// mode. The store must be deterministic if txs are counted in DeliverTx, in which case kind must be
+// StateSessionStore, since features that are only supported by the memory session store depend on
+// it.
+func WithThrottleStore(kind SessionStoreKind, store ThrottleStore) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.sessionStore = kind
+		th.store = store
+	}
+}
+
+// WithCountMode makes the middleware count txs in the phase of tx processing determined by the given
+// mode (see CountMode). By default txs are counted in both CheckTx & DeliverTx against the same
+// session records, so a tx may be charged twice.
+func WithCountMode(mode CountMode) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.countMode = mode
+	}
+}
+
+// WithCountFailedTxs makes the middleware count txs rejected further down the middleware chain, or
+// by the tx handler, against the limits of the origin. By default such txs are refunded.
+func WithCountFailedTxs(countFailedTxs bool) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.countFailedTxs = countFailedTxs
+	}
+}
+
+// WithTxCost makes the middleware charge each tx the cost returned by the given function against the
+// limits of the origin, by default every tx costs one.
+func WithTxCost(txCost TxCostFunc) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.txCost = txCost
+	}
+}
+
+// WithLogger makes the middleware log allowed txs at debug level, and throttled txs at info level,
+// to the given logger. By default nothing is logged.
+func WithLogger(logger log.TMLogger) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.logger = logger
+		th.logAllowed = true
+	}
+}
+
+// WithLogSampling makes the middleware log at most one throttled tx per origin per session, so a
+// misbehaving origin can't flood the log.
+func WithLogSampling() KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.logSampler = &logSampler{}
+	}
+}
+
+// WithMaxTrackedOrigins sets the max number of origins the middleware keeps session records for in
+// memory, by default DefaultMaxTrackedOrigins. Once the limit is reached the records of idle origins
+// are evicted, or if there are none the record of the origin that has been idle the longest.
+func WithMaxTrackedOrigins(maxOrigins int) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.maxTrackedOrigins = maxOrigins
+	}
+}
+
+// WithHelpText makes the middleware append the given text to the messages of the errors it rejects
+// txs with, e.g. a sentence pointing users to a page that explains the limits of the chain.
+func WithHelpText(help string) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.helpText = help
+	}
+}
+
+// WithResultTags makes the middleware add the quota the origin has left in the budget a tx was
+// counted against to the tags of the result of the tx (see ResultTagUsed etc.), if the tx succeeds
+// in DeliverTx.
+func WithResultTags() KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.resultTags = true
+	}
+}
+
+// WithExemptOrigins exempts the given origins from the throttle.
+func WithExemptOrigins(origins ...loom.Address) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		if th.params.exemptOrigins == nil {
+			th.params.exemptOrigins = make(map[string]struct{}, len(origins))
+		}
+		for _, origin := range origins {
+			th.params.exemptOrigins[origin.String()] = struct{}{}
+		}
+	}
+}
+
+// WithOracleBypass exempts the origin whose address is stored under the given key in the state of a
+// contract from the throttle, the value must be a marshalled types.Address. Unlike WithExemptOrigins
+// the exemption follows the oracle when it's changed by a tx. The oracle is resolved once per block,
+// if it can't be resolved no origin is exempted.
+func WithOracleBypass(
+	key []byte, createContractCtx func(state loomchain.State) (contractpb.StaticContext, error),
+) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.oracleBypass = &oracleBypass{key: key, createContractCtx: createContractCtx}
+	}
+}
+
+// WithThrottleKey makes the middleware track the txs of each origin under a key composed of the
+// given dimensions, rather than the address of the origin, e.g. a key without a chain ID counts the
+// txs an account signs on all chains together. The limits of an origin are still resolved from its
+// own address. createAddressMapperCtx is only required if the dimensions include KeyMappedAccount.
+func WithThrottleKey(
+	dims []KeyDimension, createAddressMapperCtx func(state loomchain.State) (contractpb.StaticContext, error),
+) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		key := &throttleKey{}
+		for _, dim := range dims {
+			switch dim {
+			case KeyChainID:
+				key.chainID = true
+			case KeyAddress:
+				key.address = true
+			case KeyMappedAccount:
+				key.createAddressMapperCtx = createAddressMapperCtx
+			}
+		}
+		th.key = key
+	}
+}
+
+// WithBurst lets each origin send call txs with a total cost of up to callCount in a single call
+// session, rather than its call limit, once every recoverySessions call sessions. Origins whose call
+// limit is higher than callCount don't get a burst. Bursts only apply to session records kept in
+// memory.
+func WithBurst(callCount int64, recoverySessions int64) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.burst = &burstPolicy{callCount: callCount, recoverySessions: recoverySessions}
+	}
+}
+
+// WithPenalty makes the middleware put origins that send threshold txs over their limits during a
+// call session into a cooldown, during which all their txs are rejected with an OriginCooldownError
+// before being decoded. Every tx sent during a cooldown doubles its length, up to maxCooldown.
+// Penalties only apply to session records kept in memory.
+func WithPenalty(threshold int64, cooldown time.Duration, maxCooldown time.Duration) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.penalty = &penaltyPolicy{threshold: threshold, cooldown: cooldown, maxCooldown: maxCooldown}
+	}
+}
+
+// WithFailureCooldown makes the middleware put origins that send threshold consecutive txs that fail
+// after passing the throttle into a cooldown, during which all their txs are rejected with a
+// FailureCooldownError before being decoded. Every cooldown of an origin is twice as long as the
+// previous one, up to maxCooldown. Failures are only tracked in session records kept in memory.
+func WithFailureCooldown(threshold int64, cooldown time.Duration, maxCooldown time.Duration) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.failures = &failurePolicy{threshold: threshold, cooldown: cooldown, maxCooldown: maxCooldown}
+	}
+}
+
+// WithByteBudget makes the middleware limit the total size in bytes of the txs each origin can send
+// per call session, independently of the limits on the number of txs. A tx is rejected if it'd take
+// the origin over maxBytes, so a single tx larger than maxBytes is always rejected. Zero or Unlimited
+// disables the limit.
+func WithByteBudget(maxBytes int64) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.maxTxBytes = maxBytes
+	}
+}
+
+// WithDailyDeployLimit limits the number of deploy txs each origin can send per day, on top of the
+// deploy session limit. Days are derived from the block time and the counts are stored in the app
+// state, so the limit survives restarts and all the validators enforce it identically, they must all
+// use the same limit since the counts affect the app hash. Zero or Unlimited disables the limit.
+func WithDailyDeployLimit(maxDeployCount int64) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.maxDailyDeployCount = maxDeployCount
+	}
+}
+
+// WithDuplicateTxDetection makes the middleware reject a tx with a DuplicateTxError in CheckTx if its
+// origin has already sent the exact same tx during the current call session, before it's counted
+// against any limits. The hashes of the last maxRecentTxs txs of each origin are remembered, zero
+// disables the detection.
+func WithDuplicateTxDetection(maxRecentTxs int) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.maxRecentTxs = maxRecentTxs
+	}
+}
+
+// WithBlockTxCap makes the middleware reject a tx with a BlockTxLimitReachedError if its origin has
+// already sent maxTxs txs in the current block, regardless of its other limits. In CheckTx txs are
+// counted against the next block on a best-effort basis. Zero or Unlimited disables the cap.
+func WithBlockTxCap(maxTxs int64) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.blockTxCap = nil
+		if !isUnlimited(maxTxs) {
+			th.blockTxCap = &blockTxCap{limit: maxTxs}
+		}
+	}
+}
+
+// WithContractLimits makes the middleware limit the call txs sent to each contract during a call
+// session, by all origins together (callCount) and by each origin (originCallCount), in addition to
+// the limits of each origin. A tx is rejected with a ContractTxLimitReachedError if it'd exceed either
+// contract limit. The limits of specific contracts can be overridden, zero or Unlimited disables a
+// limit. Deploy txs aren't subject to contract limits. Method limits set by WithMethodLimits are kept.
+func WithContractLimits(callCount int64, originCallCount int64, overrides ...ContractLimit) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		prev := th.contractLimits
+		th.contractLimits = newContractLimits(callCount, originCallCount, overrides)
+		if prev != nil {
+			th.contractLimits.methods, th.contractLimits.methodContracts = prev.methods, prev.methodContracts
+		}
+	}
+}
+
+// WithClock makes the middleware time sessions kept in memory, cooldowns & recent txs with the given
+// clock instead of the system clock.
+func WithClock(clock Clock) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.clock = clock
+	}
+}
+
+// WithOnChainParams makes the middleware read its limits, session durations, exempt origins &
+// maintenance mode from the app state (see OnChainParams & SetOnChainParams) once per block, so they
+// can be updated by a throttle admin tx (see AdminTxHandler) without restarting the nodes. The params
+// passed to GetKarmaMiddleWare are used while there are no valid on-chain params.
+func WithOnChainParams() KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.onChainParams = &onChainParamsCache{}
+	}
+}
+
+// GetKarmaMiddleWareWithConfig creates the middleware described by GetKarmaMiddleWare from the given
+// config, returns an error if the config is invalid.
+func GetKarmaMiddleWareWithConfig(
+	karmaEnabled bool,
+	cfg *ThrottleConfig,
+	createKarmaContractCtx func(state loomchain.State) (contractpb.Context, error),
+) (loomchain.TxMiddlewareFunc, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid throttle config")
+	}
+	tmx, err := NewKarmaMiddleWare(
+		karmaEnabled,
+		cfg.MaxCallCount,
+		cfg.SessionDuration,
+		cfg.MaxDeployCount,
+		cfg.DeploySessionDuration,
+		cfg.CallLimits,
+		createKarmaContractCtx,
+		cfg.options()...,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid throttle config")
+	}
+	return tmx, nil
+}
+
+// GetKarmaMiddleWare creates the middleware described by NewKarmaMiddleWare, and panics with a
+// description of the offending argument if the arguments are invalid, so a misconfigured node fails
+// at startup instead of running without the limits it was configured with.
 func GetKarmaMiddleWare(
 	karmaEnabled bool,
 	maxCallCount int64,
 	sessionDuration int64,
+	maxDeployCount int64,
+	deploySessionDuration int64,
+	callLimits LimitResolver,
 	createKarmaContractCtx func(state loomchain.State) (contractpb.Context, error),
+	opts ...KarmaMiddlewareOption,
 ) loomchain.TxMiddlewareFunc {
-	th := NewThrottle(sessionDuration, maxCallCount)
+	tmx, err := NewKarmaMiddleWare(
+		karmaEnabled,
+		maxCallCount,
+		sessionDuration,
+		maxDeployCount,
+		deploySessionDuration,
+		callLimits,
+		createKarmaContractCtx,
+		opts...,
+	)
+	if err != nil {
+		panic(errors.Wrap(err, "throttle: invalid karma middleware arguments"))
+	}
+	return tmx
+}
+
+// NewKarmaMiddleWare creates middleware that limits the number of call & deploy txs each origin can
+// send per session. The call limit is boosted by the call karma of the origin, and deploys are only
+// allowed if the origin has enough deploy karma. Setting maxCallCount or maxDeployCount to Unlimited
+// (or zero, see Unlimited) disables the corresponding limit, and setting deploySessionDuration to
+// zero makes deploy sessions as long as call sessions.
+// If callLimits is nil the call limit of each origin is maxCallCount plus its call karma, otherwise
+// call limits are resolved by callLimits. By default sessions are measured by the clock of each
+// node, so nodes may disagree on whether a tx exceeds the limit in DeliverTx, see WithBlockSessions
+// for deterministic limits.
+// Returns an error if a limit is negative (other than Unlimited), a session duration is negative,
+// or txs are limited in time session mode without a positive sessionDuration.
+func NewKarmaMiddleWare(
+	karmaEnabled bool,
+	maxCallCount int64,
+	sessionDuration int64,
+	maxDeployCount int64,
+	deploySessionDuration int64,
+	callLimits LimitResolver,
+	createKarmaContractCtx func(state loomchain.State) (contractpb.Context, error),
+	opts ...KarmaMiddlewareOption,
+) (loomchain.TxMiddlewareFunc, error) {
+	newThrottle := func() *Throttle {
+		th := NewThrottle(sessionDuration, maxCallCount, deploySessionDuration, maxDeployCount)
+		for _, opt := range opts {
+			opt(th)
+		}
+		if th.onChainParams != nil {
+			th.onChainParams.static = th.params
+		}
+		limits := callLimits
+		if limits == nil {
+			// The call limit of each origin is resolved from the state of the Karma contract, so that
+			// all nodes enforce the same limits.
+			th.karmaLimits = NewKarmaLimitResolver(maxCallCount, createKarmaContractCtx)
+			limits = th.karmaLimits
+		}
+		if th.delegationBoost != nil {
+			limits = &boostLimitResolver{throttle: th, next: limits}
+		}
+		if th.limitTable != nil {
+			limits = &tableLimitResolver{throttle: th, next: limits}
+		}
+		if th.validatorBypass != nil {
+			limits = &validatorLimitResolver{throttle: th, next: limits}
+		}
+		if len(th.originOverrides) > 0 {
+			limits = &overrideLimitResolver{throttle: th, next: limits}
+		}
+		if th.bypass != nil {
+			limits = &bypassLimitResolver{throttle: th, next: limits}
+		}
+		th.callLimits = limits
+		return th
+	}
+	th := newThrottle()
+	if err := th.validateArgs(callLimits != nil); err != nil {
+		return nil, err
+	}
+	if th.countMode == BothCounting {
+		// CheckTx counts txs against separate budgets kept in memory. The throttle the options were
+		// validated on is used for CheckTx, and the one that counts txs in DeliverTx is created last
+		// so the admin operates on it.
+		checkTx := th
+		WithSessionStore(MemorySessionStore)(checkTx)
+		checkTx.countMode = CheckTxCounting
+		checkTx.start()
+		th = newThrottle()
+		th.checkTx = checkTx
+	}
+	th.start()
 	return loomchain.TxMiddlewareFunc(func(
 		state loomchain.State,
 		txBytes []byte,
@@ -41,6 +441,59 @@ func GetKarmaMiddleWare(
 		if origin.IsEmpty() {
 			return res, errors.New("throttle: transaction has no origin [get-karma]")
 		}
+		origin = normalizeOrigin(state, origin)
+		th := th.forPhase(isCheckTx)
+		counting := th.countsIn(isCheckTx)
+		th.refreshParams(state, isCheckTx)
+		defer func() {
+			if err != nil {
+				th.addHelp(err)
+				th.addRejectionInfo(&res, err, isCheckTx)
+				th.auditRejection(state, origin, err, isCheckTx)
+			}
+		}()
+		// Maintenance mode applies before everything else, even to exempt origins.
+		if err := th.checkMaintenance(origin); err != nil {
+			th.logger.Info("Tx rejected in maintenance mode", "origin", origin.String())
+			return res, err
+		}
+		if th.isExempt(origin) || th.isRegisteredOracle(state, origin, isCheckTx) ||
+			th.isValidatorExempt(state, origin) {
+			return next(state, txBytes, isCheckTx)
+		}
+		// The txs of the origin are tracked under its key, while its limits & karma are resolved from
+		// the origin itself.
+		key, err := th.throttleKey(state, origin)
+		if err != nil {
+			return res, err
+		}
+		// Set if the origin is admitted while the session store is saturated, see admitKey.
+		pressured := false
+		if counting {
+			th.auditCooldownsEnded(key)
+			if err := th.checkCooldown(key); err != nil {
+				return res, err
+			}
+			if err := th.checkFailureCooldown(key); err != nil {
+				return res, err
+			}
+			key, pressured = th.admitKey(key)
+		}
+		acceptTx, err := th.checkDuplicateTx(state, key, txBytes, isCheckTx)
+		if err != nil {
+			return res, err
+		}
+		refundBlockTx, err := th.throttleBlockTx(state, key, isCheckTx)
+		if err != nil {
+			return res, err
+		}
+		defer func() {
+			if err != nil {
+				refundBlockTx()
+			} else {
+				acceptTx()
+			}
+		}()
 
 		var nonceTx lauth.NonceTx
 		if err := proto.Unmarshal(txBytes, &nonceTx); err != nil {
@@ -56,6 +509,7 @@ func GetKarmaMiddleWare(
 		if err := proto.Unmarshal(tx.Data, &msg); err != nil {
 			return res, errors.Wrapf(err, "unmarshal message tx %v", tx.Data)
 		}
+		cost := th.txCostOf(txBytes)
 
 		ctx, err := createKarmaContractCtx(state)
 		if err != nil {
@@ -84,10 +538,8 @@ func GetKarmaMiddleWare(
 			isDeployTx = true
 
 		case types.TxID_ETHEREUM:
-			isDeployTx, err = isEthDeploy(msg.Data)
-			if err != nil {
-				return res, err
-			}
+			// If the tx can't be decoded it's counted as a call, the handler will reject it anyway.
+			isDeployTx, _ = isEthDeploy(msg.Data)
 			if !isDeployTx {
 				isActive, err := karma.IsContractActive(ctx, loom.UnmarshalAddressPB(msg.To))
 				if err != nil {
@@ -99,6 +551,35 @@ func GetKarmaMiddleWare(
 			}
 
 		default:
+			// Other txs don't require karma, but still count against the call & bytes limits.
+			if !counting {
+				return next(state, txBytes, isCheckTx)
+			}
+			next, err = th.throttleTxBytes(
+				state, next, nonceTx.Sequence, key, tx.Id, txBytes, th.originTxBytesLimit(state, origin),
+			)
+			if err != nil {
+				return res, err
+			}
+			maxCallCount, err := th.callLimits.ResolveLimit(state, origin)
+			if errors.Cause(err) == ErrNoKarma {
+				// Origins without call karma can still send these txs, up to the base call limit.
+				maxCallCount, err = th.currentParams().maxCallCount, nil
+			}
+			if err != nil {
+				return res, err
+			}
+			if pressured {
+				maxCallCount = th.pressureLimit(maxCallCount)
+			}
+			if maxCallCount > 0 {
+				if err := th.throttleTx(state, callBudget, nonceTx.Sequence, key, maxCallCount, tx.Id, cost); err != nil {
+					return res, err
+				}
+				next = th.settleTx(next, callBudget, nonceTx.Sequence, key, maxCallCount, tx.Id, cost)
+				next = th.tagResult(next, callBudget, key, maxCallCount)
+			}
+			next = th.trackFailures(next, key)
 			return next(state, txBytes, isCheckTx)
 		}
 
@@ -124,26 +605,15 @@ func GetKarmaMiddleWare(
 			return r, nil
 		}
 
-		originKarma, err := th.getKarmaForTransaction(ctx, origin, isDeployTx)
-		if err != nil {
-			return res, errors.Wrap(err, "getting total karma")
-		}
-
-		if originKarma == nil || originKarma.Cmp(common.BigZero()) == 0 {
-			return res, errors.New("origin has no karma of the appropriate type")
-		}
-
-		var originKarmaTotal int64
-		// If karma is more than maxint64, treat as maxint64 as both should be enough
-		if 1 == originKarma.Cmp(loom.NewBigUIntFromInt(math.MaxInt64)) {
-			originKarmaTotal = math.MaxInt64
-		} else if !originKarma.IsInt64() {
-			return res, errors.Wrapf(err, "cannot recognise karma total %v as an number", originKarma)
-		} else {
-			originKarmaTotal = originKarma.Int64()
-		}
-
 		if isDeployTx {
+			originKarma, err := th.getKarmaForTransaction(ctx, origin, true)
+			if err != nil {
+				return res, errors.Wrap(err, "getting total karma")
+			}
+			originKarmaTotal, err := karmaTotal(originKarma)
+			if err != nil {
+				return res, err
+			}
 			config, err := karma.GetConfig(ctx)
 			if err != nil {
 				return res, errors.Wrap(err, "failed to load karma config")
@@ -151,18 +621,64 @@ func GetKarmaMiddleWare(
 			if originKarmaTotal < config.MinKarmaToDeploy {
 				return res, fmt.Errorf("not enough karma %v to depoy, required %v", originKarmaTotal, config.MinKarmaToDeploy)
 			}
-		} else {
-			if maxCallCount <= 0 {
-				return res, errors.Errorf("max call count %d non positive", maxCallCount)
+			codeSize := deployCodeSize(types.TxID(tx.Id), msg.Data, txBytes)
+			// Deploys that are too large are rejected even if the origin isn't throttled in this phase.
+			deployCost, err := th.checkDeployBucket(key, codeSize, cost)
+			if err != nil {
+				return res, err
 			}
-			callCount := th.maxCallCount + originKarmaTotal
-			if originKarmaTotal > math.MaxInt64-th.maxCallCount {
-				callCount = math.MaxInt64
+			if counting {
+				next, err = th.throttleTxBytes(
+					state, next, nonceTx.Sequence, key, tx.Id, txBytes, th.originTxBytesLimit(state, origin),
+				)
+				if err != nil {
+					return res, err
+				}
+				maxDeployCount := th.currentParams().maxDeployCount
+				if pressured {
+					maxDeployCount = th.pressureLimit(maxDeployCount)
+				}
+				if maxDeployCount > 0 {
+					if err := th.throttleTx(state, deployBudget, nonceTx.Sequence, key, maxDeployCount, tx.Id, deployCost); err != nil {
+						return res, err
+					}
+					next = th.settleTx(next, deployBudget, nonceTx.Sequence, key, maxDeployCount, tx.Id, deployCost)
+					next = th.tagResult(next, deployBudget, key, maxDeployCount)
+				}
+				if err := th.throttleDailyDeploys(state, key); err != nil {
+					return res, err
+				}
+				if err := th.throttleDeployBucket(state, key, codeSize); err != nil {
+					return res, err
+				}
 			}
-			err := th.runThrottle(state, nonceTx.Sequence, origin, callCount, tx.Id, karmaMiddlewareThrottleKey)
+		} else if counting {
+			next, err = th.throttleTxBytes(
+				state, next, nonceTx.Sequence, key, tx.Id, txBytes, th.originTxBytesLimit(state, origin),
+			)
 			if err != nil {
-				return res, errors.Wrap(err, "call karma throttle")
+				return res, err
+			}
+			callCount, err := th.callLimits.ResolveLimit(state, origin)
+			if err != nil {
+				return res, err
 			}
+			if pressured {
+				callCount = th.pressureLimit(callCount)
+			}
+			// Not wrapped so the message of the error keeps its stable prefix
+			if err := th.throttleTx(state, callBudget, nonceTx.Sequence, key, callCount, tx.Id, cost); err != nil {
+				return res, err
+			}
+			// The call is refunded to the origin if the contract limits reject it.
+			target := loom.UnmarshalAddressPB(msg.To)
+			method := th.calledMethod(types.TxID(tx.Id), msg.Data, target)
+			next = th.throttleContractTx(next, key, target, method, cost)
+			next = th.settleTx(next, callBudget, nonceTx.Sequence, key, callCount, tx.Id, cost)
+			next = th.tagResult(next, callBudget, key, callCount)
+		}
+		if counting {
+			next = th.trackFailures(next, key)
 		}
 
 		r, err := next(state, txBytes, isCheckTx)
@@ -182,5 +698,5 @@ func GetKarmaMiddleWare(
 			}
 		}
 		return r, nil
-	})
+	}), nil
 }
@@ -43,15 +43,9 @@ func TestKarmaMiddleWare(t *testing.T) {
 
 	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{}, nil, nil)
 
-	fakeCtx := goloomplugin.CreateFakeContext(addr1, addr1)
-	karmaAddr := fakeCtx.CreateContract(karma.Contract)
-	contractContext := contractpb.WrapPluginContext(fakeCtx.WithAddress(karmaAddr))
-
-	// Init the karma contract
-	karmaContract := &karma.Karma{}
-	require.NoError(t, karmaContract.Init(contractContext, &ktypes.KarmaInitRequest{
-		Sources: sourcesDeploy,
-	}))
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sourcesDeploy},
+	)
 
 	// This can also be done on init, but more concise this way
 	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStatesDeploy))
@@ -62,9 +56,10 @@ func TestKarmaMiddleWare(t *testing.T) {
 		true,
 		maxCallCount,
 		sessionDuration,
-		func(state loomchain.State) (contractpb.Context, error) {
-			return contractContext, nil
-		},
+		0,
+		0,
+		nil,
+		createKarmaContractCtx,
 	)
 
 	// call fails as contract is not deployed
@@ -108,15 +103,9 @@ func TestMinKarmaToDeploy(t *testing.T) {
 
 	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{}, nil, nil)
 
-	fakeCtx := goloomplugin.CreateFakeContext(addr1, addr1)
-	karmaAddr := fakeCtx.CreateContract(karma.Contract)
-	contractContext := contractpb.WrapPluginContext(fakeCtx.WithAddress(karmaAddr))
-
-	// Init the karma contract
-	karmaContract := &karma.Karma{}
-	require.NoError(t, karmaContract.Init(contractContext, &ktypes.KarmaInitRequest{
-		Sources: sourcesDeploy,
-	}))
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sourcesDeploy},
+	)
 
 	require.NoError(t, karma.SetConfig(contractContext, &ktypes.KarmaConfig{
 		MinKarmaToDeploy: 1,
@@ -130,9 +119,10 @@ func TestMinKarmaToDeploy(t *testing.T) {
 		true,
 		maxCallCount,
 		sessionDuration,
-		func(state loomchain.State) (contractpb.Context, error) {
-			return contractContext, nil
-		},
+		0,
+		0,
+		nil,
+		createKarmaContractCtx,
 	)
 
 	// deploy contract
@@ -149,3 +139,65 @@ func TestMinKarmaToDeploy(t *testing.T) {
 	_, err = throttleMiddlewareHandler(tmx, state, txSigned, ctx)
 	require.Error(t, err)
 }
+
+func TestNewKarmaMiddleWareValidatesArgs(t *testing.T) {
+	createKarmaContractCtx := func(state loomchain.State) (contractpb.Context, error) {
+		return nil, nil
+	}
+	type args struct {
+		maxCallCount, sessionDuration, maxDeployCount, deploySessionDuration int64
+		callLimits                                                           LimitResolver
+		opts                                                                 []KarmaMiddlewareOption
+	}
+	newMiddleware := func(a args) (loomchain.TxMiddlewareFunc, error) {
+		return NewKarmaMiddleWare(
+			true, a.maxCallCount, a.sessionDuration, a.maxDeployCount, a.deploySessionDuration, a.callLimits,
+			createKarmaContractCtx, a.opts...,
+		)
+	}
+
+	valid := []args{
+		{maxCallCount: 10, sessionDuration: 60},
+		{maxCallCount: 10, sessionDuration: 60, maxDeployCount: 2, deploySessionDuration: 3600},
+		// Nothing is limited, so sessions don't need a duration.
+		{maxCallCount: Unlimited, maxDeployCount: Unlimited},
+		{},
+		// Block sessions are measured in blocks rather than seconds.
+		{maxCallCount: 10, opts: []KarmaMiddlewareOption{WithBlockSessions(10, 0)}},
+	}
+	for i, a := range valid {
+		tmx, err := newMiddleware(a)
+		require.NoError(t, err, "case %d", i)
+		require.NotNil(t, tmx, "case %d", i)
+	}
+
+	invalid := []struct {
+		arg  string
+		args args
+	}{
+		{"maxCallCount", args{maxCallCount: -2, sessionDuration: 60}},
+		{"maxDeployCount", args{maxCallCount: 10, sessionDuration: 60, maxDeployCount: -10}},
+		{"sessionDuration", args{maxCallCount: 10, sessionDuration: -60}},
+		{"deploySessionDuration", args{maxCallCount: 10, sessionDuration: 60, deploySessionDuration: -1}},
+		{"sessionDuration", args{maxCallCount: 10}},
+		{"sessionDuration", args{maxCallCount: Unlimited, maxDeployCount: 2}},
+		// A custom resolver may limit calls regardless of maxCallCount.
+		{"sessionDuration", args{maxCallCount: Unlimited, callLimits: StaticLimitResolver(5)}},
+		{"sessionBlocks", args{maxCallCount: 10, opts: []KarmaMiddlewareOption{WithBlockSessions(0, 0)}}},
+		{"deploySessionBlocks", args{maxCallCount: 10, opts: []KarmaMiddlewareOption{WithBlockSessions(10, -1)}}},
+	}
+	for _, c := range invalid {
+		tmx, err := newMiddleware(c.args)
+		require.Error(t, err, c.arg)
+		require.Contains(t, err.Error(), c.arg)
+		require.Nil(t, tmx, c.arg)
+
+		// The legacy constructor panics instead, so misconfigured nodes fail at startup.
+		require.Panics(t, func() {
+			GetKarmaMiddleWare(
+				true, c.args.maxCallCount, c.args.sessionDuration, c.args.maxDeployCount,
+				c.args.deploySessionDuration, c.args.callLimits, createKarmaContractCtx, c.args.opts...,
+			)
+		}, c.arg)
+	}
+}
@@ -0,0 +1,137 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestLeakyBucketPrecision(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	// 0.3 txs per second, the time it takes to leak a tx isn't a whole number of nanoseconds.
+	interval := time.Duration(3333333334)
+
+	// Draining the bucket in many small steps leaks as much as draining it once, since the remainder
+	// of each step carries over to the next.
+	once := budgetSession{start: start, accessCount: unitsOfCost(10)}
+	once.drain(interval, start.Add(7*time.Second))
+	stepped := budgetSession{start: start, accessCount: unitsOfCost(10)}
+	for i := 1; i <= 1000; i++ {
+		stepped.drain(interval, start.Add(time.Duration(i)*7*time.Millisecond))
+	}
+	require.Equal(t, unitsOfCost(10)-2099999, once.accessCount)
+	require.InDelta(t, once.accessCount, stepped.accessCount, 1)
+
+	// Half a tx per second leaks exactly one tx every 2 seconds.
+	bucket := budgetSession{start: start, accessCount: unitsOfCost(3)}
+	require.Equal(t, int64(3), bucket.count(LeakyBucket, 2*time.Second, start))
+	require.Equal(t, int64(3), bucket.count(LeakyBucket, 2*time.Second, start.Add(1999*time.Millisecond)))
+	require.Equal(t, int64(2), bucket.count(LeakyBucket, 2*time.Second, start.Add(2*time.Second)))
+	require.Equal(t, int64(0), bucket.count(LeakyBucket, 2*time.Second, start.Add(time.Hour)))
+	// A tx fits once the bucket has leaked enough of the txs in it.
+	require.Equal(t, start.Add(2*time.Second), bucket.retryAt(LeakyBucket, 2*time.Second, 3, 1))
+	require.Equal(t, start.Add(4*time.Second), bucket.retryAt(LeakyBucket, 2*time.Second, 3, 2))
+	require.Equal(t, start, bucket.retryAt(LeakyBucket, 2*time.Second, 5, 2))
+	// A bucket that was never filled is empty however long ago its start is.
+	empty := budgetSession{}
+	empty.drain(interval, start)
+	require.Equal(t, int64(0), empty.accessCount)
+	require.Equal(t, start, empty.start)
+}
+
+func TestLeakyBucketOutOfOrderClock(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	bucket := budgetSession{start: start, accessCount: unitsOfCost(10)}
+
+	// Concurrent txs may read the clock in a different order than they drain the bucket, reading
+	// an earlier time never refills the bucket nor makes the next drain leak the same time twice.
+	level := bucket.accessCount
+	for _, offset := range []time.Duration{3, 1, 2, 5, 4, 4, 7, 6} {
+		bucket.drain(2*time.Second, start.Add(offset*time.Second))
+		require.True(t, bucket.accessCount <= level, "bucket refilled at %v", offset)
+		require.False(t, bucket.start.After(start.Add(7*time.Second)))
+		level = bucket.accessCount
+	}
+	require.Equal(t, unitsOfCost(10)-3500000, bucket.accessCount)
+	require.Equal(t, start.Add(7*time.Second), bucket.start)
+}
+
+func TestLeakyBucket(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	start := clock.now
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 3, sessionDuration, 0, 0, StaticLimitResolver(3), createKarmaContractCtx,
+		WithLeakyBucket(0.5), WithAdmin(admin), WithClock(clock),
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func() error {
+		nonce++
+		return processTxFrom(
+			tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+		)
+	}
+	limitErrOf := func(err error) *TxLimitReachedError {
+		limitErr, ok := err.(*TxLimitReachedError)
+		require.True(t, ok, "expected a limit error, got %v", err)
+		return limitErr
+	}
+
+	// The bucket holds as many txs as the call limit of the origin...
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx())
+	}
+	limitErr := limitErrOf(sendTx())
+	require.Equal(t, int64(3), limitErr.Used)
+	require.Equal(t, 2*time.Second, limitErr.LeakInterval)
+	require.Equal(t, start.Unix()+2, limitErr.RetryAfter)
+	require.Contains(t, limitErr.Error(), "used 3 of the 3 call txs its bucket holds, which leaks one every 2s")
+
+	// ...and leaks half a tx per second, txs that overflow it aren't added to it so an origin that
+	// retries too early isn't pushed back any further.
+	clock.Advance(time.Second)
+	require.Equal(t, start.Unix()+2, limitErrOf(sendTx()).RetryAfter)
+	clock.Advance(time.Second)
+	require.NoError(t, sendTx())
+	for i := 0; i < 5; i++ {
+		clock.Advance(time.Second)
+		limitErrOf(sendTx())
+		clock.Advance(time.Second)
+		require.NoError(t, sendTx())
+	}
+
+	// The quota reports the level of the bucket in txs.
+	clock.Advance(time.Second)
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, "leaky", quota.Algorithm)
+	callQuota := quota.Budgets[callBudget]
+	require.Equal(t, int64(3), callQuota.Used)
+	require.Equal(t, int64(0), callQuota.Remaining)
+	require.Equal(t, 0.5, callQuota.LeakRate)
+	// 2.5 txs are left in the bucket.
+	require.Equal(t, clock.now.Unix()+5, callQuota.WindowEnds)
+	// Deploy txs are still limited per session.
+	require.Zero(t, quota.Budgets[deployBudget].LeakRate)
+
+	clock.Advance(2 * time.Second)
+	quota, err = admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), quota.Budgets[callBudget].Used)
+	require.Equal(t, int64(1), quota.Budgets[callBudget].Remaining)
+}
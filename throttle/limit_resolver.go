@@ -0,0 +1,160 @@
+package throttle
+
+import (
+	"math"
+	"sync"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	"github.com/loomnetwork/go-loom/common"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/pkg/errors"
+)
+
+var ErrNoKarma = errors.New("origin has no karma of the appropriate type")
+
+// LimitResolver resolves the max number of txs an origin can send per session, a non-positive limit
+// means the origin is unlimited.
+type LimitResolver interface {
+	ResolveLimit(state loomchain.State, origin loom.Address) (int64, error)
+}
+
+// StaticLimitResolver resolves the same limit for every origin.
+type StaticLimitResolver int64
+
+func (r StaticLimitResolver) ResolveLimit(_ loomchain.State, _ loom.Address) (int64, error) {
+	return int64(r), nil
+}
+
+type resolvedLimit struct {
+	limit int64
+	err   error
+}
+
+// Caches the limits resolved for each origin until the block height changes, so the limit of an
+// origin is only read from the contract state once per block.
+type blockLimitCache struct {
+	// Limits resolved at height, keyed by origin address, guarded by mtx.
+	height int64
+	limits map[string]resolvedLimit
+	mtx    sync.Mutex
+}
+
+// Discards all the cached limits.
+func (c *blockLimitCache) clear() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.limits = nil
+}
+
+// Returns the cached limit of the given origin, or calls resolve to resolve it. Errors caused by
+// the origin not having any karma are cached too, other errors (e.g. failing to create a contract
+// context) may be transient so they're not cached.
+func (c *blockLimitCache) resolve(
+	state loomchain.State, origin loom.Address, resolve func() (int64, error),
+) (int64, error) {
+	height := state.Block().Height
+	key := origin.String()
+
+	c.mtx.Lock()
+	if c.limits == nil || c.height != height {
+		c.height = height
+		c.limits = make(map[string]resolvedLimit)
+	}
+	cached, ok := c.limits[key]
+	c.mtx.Unlock()
+	if ok {
+		return cached.limit, cached.err
+	}
+
+	limit, err := resolve()
+	if err == nil || errors.Cause(err) == ErrNoKarma {
+		c.mtx.Lock()
+		if c.height == height {
+			c.limits[key] = resolvedLimit{limit: limit, err: err}
+		}
+		c.mtx.Unlock()
+	}
+	return limit, err
+}
+
+// KarmaLimitResolver resolves the limit of an origin by adding the call karma the origin holds in
+// the Karma contract to a base limit, so all nodes enforce the same limits and users can increase
+// their limit by earning karma. Resolved limits are cached until the block height changes.
+type KarmaLimitResolver struct {
+	// Guarded by baseLimitMtx since it may be updated at runtime.
+	baseLimit              int64
+	baseLimitMtx           sync.RWMutex
+	createKarmaContractCtx func(state loomchain.State) (contractpb.Context, error)
+	cache                  blockLimitCache
+}
+
+func NewKarmaLimitResolver(
+	baseLimit int64,
+	createKarmaContractCtx func(state loomchain.State) (contractpb.Context, error),
+) *KarmaLimitResolver {
+	return &KarmaLimitResolver{
+		baseLimit:              baseLimit,
+		createKarmaContractCtx: createKarmaContractCtx,
+	}
+}
+
+// ResolveLimit returns an error if the origin has no call karma.
+func (r *KarmaLimitResolver) ResolveLimit(state loomchain.State, origin loom.Address) (int64, error) {
+	return r.cache.resolve(state, origin, func() (int64, error) {
+		return r.resolveLimit(state, origin)
+	})
+}
+
+// Changes the base limit, limits that have already been resolved are discarded.
+func (r *KarmaLimitResolver) setBaseLimit(baseLimit int64) {
+	r.baseLimitMtx.Lock()
+	r.baseLimit = baseLimit
+	r.baseLimitMtx.Unlock()
+	r.cache.clear()
+}
+
+func (r *KarmaLimitResolver) resolveLimit(state loomchain.State, origin loom.Address) (int64, error) {
+	r.baseLimitMtx.RLock()
+	baseLimit := r.baseLimit
+	r.baseLimitMtx.RUnlock()
+	if isUnlimited(baseLimit) {
+		return Unlimited, nil
+	}
+
+	ctx, err := r.createKarmaContractCtx(state)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create Karma contract context")
+	}
+
+	originKarma, err := karma.GetUserKarma(ctx, origin, ktypes.KarmaSourceTarget_CALL)
+	if err != nil {
+		return 0, errors.Wrap(err, "getting total karma")
+	}
+	originKarmaTotal, err := karmaTotal(originKarma)
+	if err != nil {
+		return 0, err
+	}
+	if originKarmaTotal > math.MaxInt64-baseLimit {
+		return math.MaxInt64, nil
+	}
+	return baseLimit + originKarmaTotal, nil
+}
+
+// Converts the given karma amount to an int64, amounts above maxint64 are capped. Returns an error
+// if the amount is zero.
+func karmaTotal(originKarma *common.BigUInt) (int64, error) {
+	if originKarma == nil || originKarma.Cmp(common.BigZero()) == 0 {
+		return 0, ErrNoKarma
+	}
+	// If karma is more than maxint64, treat as maxint64 as both should be enough
+	if 1 == originKarma.Cmp(loom.NewBigUIntFromInt(math.MaxInt64)) {
+		return math.MaxInt64, nil
+	}
+	if !originKarma.IsInt64() {
+		return 0, errors.Errorf("cannot recognise karma total %v as an number", originKarma)
+	}
+	return originKarma.Int64(), nil
+}
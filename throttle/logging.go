@@ -0,0 +1,76 @@
+package throttle
+
+import (
+	"sync"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/log"
+	tlog "github.com/tendermint/tendermint/libs/log"
+)
+
+// Limits throttle events to one per origin & budget per session duration.
+type logSampler struct {
+	// Position (unix nanoseconds or block session) at which the last event was logged, keyed by
+	// budget & origin, guarded by mtx.
+	lastLogged map[string]int64
+	mtx        sync.Mutex
+}
+
+// Returns true if an event at the given position should be logged, the period is in the same units
+// as the position.
+func (s *logSampler) allow(key string, pos int64, period int64) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if last, ok := s.lastLogged[key]; ok && pos-last < period {
+		return false
+	}
+	// Origins that are no longer throttled are forgotten once there are too many.
+	if s.lastLogged == nil || len(s.lastLogged) >= DefaultMaxTrackedOrigins {
+		s.lastLogged = make(map[string]int64)
+	}
+	s.lastLogged[key] = pos
+	return true
+}
+
+func nopLogger() log.TMLogger {
+	return tlog.NewNopLogger()
+}
+
+// Logs the outcome of counting a tx against the given budget of the given origin, allowed txs are
+// logged at debug level, throttled txs at info level.
+func (t *Throttle) logTx(state loomchain.State, budget txBudget, origin loom.Address, limit int64, err error) {
+	if err == nil {
+		// Formatting the event allocates, so it's skipped unless there's a logger to log it.
+		if t.logAllowed {
+			t.logger.Debug("Tx allowed by throttle", "origin", t.originString(origin), "budget", budget.String(), "limit", limit)
+		}
+		return
+	}
+	if t.logSampler != nil {
+		pos, period := t.clock.Now().UnixNano(), int64(t.sessionPeriod(budget))
+		if t.sessionMode == BlockSessions {
+			// Block sessions are aligned, so at most one event is logged per session.
+			pos, period = state.Block().Height/t.budgetSessionBlocks(budget), 1
+		}
+		if !t.logSampler.allow(budget.String()+":"+origin.String(), pos, period) {
+			return
+		}
+	}
+	switch e := err.(type) {
+	case *TxLimitReachedError:
+		windowEnds := e.RetryAfter
+		if e.WindowBlocks > 0 {
+			windowEnds = e.RetryAfterHeight
+		}
+		t.logger.Info(
+			"Tx throttled", "origin", origin.String(), "budget", e.Budget, "used", e.Used, "limit", e.Limit,
+			"window_ends", windowEnds,
+		)
+	case *TxCostExceedsLimitError:
+		t.logger.Info(
+			"Tx throttled", "origin", origin.String(), "budget", e.Budget, "cost", e.Cost, "limit", e.Limit,
+		)
+	}
+}
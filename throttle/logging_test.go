@@ -0,0 +1,102 @@
+// +build evm
+
+package throttle
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tlog "github.com/tendermint/tendermint/libs/log"
+)
+
+type logEntry struct {
+	level   string
+	msg     string
+	keyvals []interface{}
+}
+
+// Records the entries logged to it.
+type recordingLogger struct {
+	entries []logEntry
+	mtx     sync.Mutex
+}
+
+func (l *recordingLogger) log(level string, msg string, keyvals []interface{}) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, keyvals: keyvals})
+}
+
+func (l *recordingLogger) Debug(msg string, keyvals ...interface{}) { l.log("debug", msg, keyvals) }
+func (l *recordingLogger) Info(msg string, keyvals ...interface{})  { l.log("info", msg, keyvals) }
+func (l *recordingLogger) Error(msg string, keyvals ...interface{}) { l.log("error", msg, keyvals) }
+func (l *recordingLogger) With(keyvals ...interface{}) tlog.Logger  { return l }
+
+func (l *recordingLogger) count(level string) int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	n := 0
+	for _, e := range l.entries {
+		if e.level == level {
+			n++
+		}
+	}
+	return n
+}
+
+func TestThrottleLogging(t *testing.T) {
+	logger := &recordingLogger{}
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithLogger(logger)(th)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	callTxID := uint32(types.TxID_CALL)
+
+	for nonce := uint64(1); nonce <= uint64(maxCallCount)+3; nonce++ {
+		th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1)
+	}
+	require.Equal(t, int(maxCallCount), logger.count("debug"))
+	require.Equal(t, 3, logger.count("info"))
+
+	throttled := logger.entries[len(logger.entries)-1]
+	require.Equal(t, "Tx throttled", throttled.msg)
+	fields := map[interface{}]interface{}{}
+	for i := 0; i+1 < len(throttled.keyvals); i += 2 {
+		fields[throttled.keyvals[i]] = throttled.keyvals[i+1]
+	}
+	require.Equal(t, origin.String(), fields["origin"])
+	require.Equal(t, maxCallCount, fields["used"])
+	require.Equal(t, maxCallCount, fields["limit"])
+	require.Contains(t, fields, "window_ends")
+
+	// Nothing is logged by default.
+	th = NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	require.NoError(t, th.throttleTx(state, callBudget, 1, origin, maxCallCount, callTxID, 1))
+}
+
+func TestThrottleLogSampling(t *testing.T) {
+	logger := &recordingLogger{}
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithLogger(logger)(th)
+	WithLogSampling()(th)
+	WithBlockSessions(10, 0)(th)
+	memStore := store.NewMemStore()
+	callTxID := uint32(types.TxID_CALL)
+
+	nonce := uint64(0)
+	for height := int64(1); height < 30; height++ {
+		state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+		for i := int64(0); i < maxCallCount; i++ {
+			nonce++
+			th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1)
+			th.throttleTx(state, callBudget, nonce, addr1, maxCallCount, callTxID, 1)
+		}
+	}
+	// Both origins are throttled in each of the 3 sessions, but only one event per origin per
+	// session is logged.
+	require.Equal(t, 6, logger.count("info"))
+}
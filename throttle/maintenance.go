@@ -0,0 +1,123 @@
+package throttle
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+)
+
+// MaintenanceModeErrorPrefix is the prefix of the message of every MaintenanceModeError.
+const MaintenanceModeErrorPrefix = "maintenance mode"
+
+// MaintenanceModeError is returned for txs sent while the chain is in maintenance mode by origins
+// that aren't on the maintenance allowlist, the tx may be accepted once maintenance mode is disabled.
+type MaintenanceModeError struct {
+	Origin loom.Address
+	// Unix timestamp (in seconds) at which maintenance mode was enabled, zero if it was enabled when
+	// the node started.
+	Since int64
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func (e *MaintenanceModeError) Error() string {
+	since := ""
+	if e.Since > 0 {
+		since = fmt.Sprintf(" since %s", time.Unix(e.Since, 0).UTC().Format(time.RFC3339))
+	}
+	return withHelp(fmt.Sprintf(
+		"%s: the chain has been in maintenance%s and only accepts txs from allowlisted origins, "+
+			"origin %s isn't allowlisted, retry once maintenance is over",
+		MaintenanceModeErrorPrefix, since, e.Origin,
+	), e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *MaintenanceModeError) ABCICode() uint32 {
+	return MaintenanceModeCode
+}
+
+// WithMaintenanceMode puts the chain into maintenance mode if enabled is true, the middleware then
+// rejects every tx with a MaintenanceModeError unless its origin is on the given allowlist, before
+// any of the limits are applied. Txs from exempt origins are rejected too unless they're allowlisted.
+// Maintenance mode can be switched on & off at runtime by reloading the config (see Admin.Reload) or
+// by the on-chain params (see OnChainParams).
+func WithMaintenanceMode(enabled bool, allowlist ...loom.Address) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.params.maintenance = enabled
+		th.params.maintenanceAllowlist = nil
+		if len(allowlist) > 0 {
+			th.params.maintenanceAllowlist = make(map[string]struct{}, len(allowlist))
+			for _, origin := range allowlist {
+				th.params.maintenanceAllowlist[origin.String()] = struct{}{}
+			}
+		}
+	}
+}
+
+// MaintenanceStatus describes the maintenance mode of the throttle.
+type MaintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+	// Unix timestamp (in seconds) at which maintenance mode was last enabled or disabled, zero if it
+	// hasn't been switched since the node started.
+	Since int64 `json:"since,omitempty"`
+	// Origins whose txs are accepted in maintenance mode.
+	Allowlist []string `json:"allowlist"`
+}
+
+// Returns a MaintenanceModeError if the chain is in maintenance mode and the given origin isn't on
+// the allowlist.
+func (t *Throttle) checkMaintenance(origin loom.Address) error {
+	t.paramsMtx.RLock()
+	defer t.paramsMtx.RUnlock()
+
+	if !t.params.maintenance {
+		return nil
+	}
+	if _, ok := t.params.maintenanceAllowlist[origin.String()]; ok {
+		return nil
+	}
+	err := &MaintenanceModeError{Origin: origin}
+	if !t.maintenanceSince.IsZero() {
+		err.Since = t.maintenanceSince.Unix()
+	}
+	return err
+}
+
+// Logs & records the time at which maintenance mode was switched, if the given params switch it.
+// NOTE: t.paramsMtx must be held by the caller.
+func (t *Throttle) maintenanceSwitched(old throttleParams, updated throttleParams, height int64) {
+	if old.maintenance == updated.maintenance {
+		return
+	}
+	t.maintenanceSince = t.clock.Now()
+	msg := "Throttle maintenance mode disabled"
+	if updated.maintenance {
+		msg = "Throttle maintenance mode enabled"
+	}
+	t.logger.Info(
+		msg, "at", t.maintenanceSince.UTC().Format(time.RFC3339), "height", height,
+		"allowlist", len(updated.maintenanceAllowlist),
+	)
+}
+
+// Returns the current maintenance mode of the throttle.
+func (t *Throttle) maintenanceStatus() MaintenanceStatus {
+	t.paramsMtx.RLock()
+	defer t.paramsMtx.RUnlock()
+
+	status := MaintenanceStatus{
+		Enabled:   t.params.maintenance,
+		Allowlist: make([]string, 0, len(t.params.maintenanceAllowlist)),
+	}
+	if !t.maintenanceSince.IsZero() {
+		status.Since = t.maintenanceSince.Unix()
+	}
+	for origin := range t.params.maintenanceAllowlist {
+		status.Allowlist = append(status.Allowlist, origin)
+	}
+	sort.Strings(status.Allowlist)
+	return status
+}
@@ -0,0 +1,156 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestMaintenanceModeReload(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	exempt := loom.MustParseAddress("chain:0x1d655354f10499ef1e32e5a4e8b712606af33628")
+	other := loom.MustParseAddress("chain:0x7262d4c97c7b93937e4810d289b7320e9da82857")
+	admin := NewAdmin()
+	logger := &recordingLogger{}
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	newConfig := func(maintenance bool) *ThrottleConfig {
+		cfg := DefaultThrottleConfig()
+		cfg.MaxCallCount = 3
+		cfg.SessionDuration = 60
+		cfg.ExemptOrigins = []string{exempt.String()}
+		cfg.MaintenanceMode = maintenance
+		cfg.MaintenanceAllowlist = []string{addr1.String()}
+		return cfg
+	}
+	cfg := newConfig(false)
+	cfg.Admin = admin
+	cfg.Clock = clock
+	cfg.Logger = logger
+	tmx, err := GetKarmaMiddleWareWithConfig(true, cfg, createKarmaContractCtx)
+	require.NoError(t, err)
+
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func(from loom.Address) error {
+		nonce++
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+		)
+	}
+	usedCalls := func(from loom.Address) int64 {
+		quota, err := admin.Quota(state, from)
+		require.NoError(t, err)
+		return quota.Budgets[callBudget].Used
+	}
+	requireMaintenance := func(err error) *MaintenanceModeError {
+		maintenanceErr, ok := err.(*MaintenanceModeError)
+		require.True(t, ok, "expected a maintenance mode error, got %v", err)
+		require.Equal(t, MaintenanceModeCode, maintenanceErr.ABCICode())
+		return maintenanceErr
+	}
+	loggedAt := func(msg string) string {
+		for _, e := range logger.entries {
+			if e.msg == msg {
+				return e.keyvals[1].(string)
+			}
+		}
+		return ""
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx(origin))
+	}
+	_, ok := sendTx(origin).(*TxLimitReachedError)
+	require.True(t, ok)
+
+	// In maintenance mode the gate rejects txs before the throttle gets to them, so origins that
+	// reached their limits get the maintenance error & rejected txs aren't counted...
+	clock.Advance(10 * time.Second)
+	require.NoError(t, admin.Reload(newConfig(true)))
+	require.Equal(t, "2017-07-14T02:40:10Z", loggedAt("Throttle maintenance mode enabled"))
+	maintenanceErr := requireMaintenance(sendTx(origin))
+	require.Equal(t, clock.now.Unix(), maintenanceErr.Since)
+	require.Contains(t, maintenanceErr.Error(), "since 2017-07-14T02:40:10Z")
+	requireMaintenance(sendTx(other))
+	require.Equal(t, int64(0), usedCalls(other))
+	// ...even those of exempt origins, while the txs of allowlisted origins pass through to the
+	// throttle.
+	requireMaintenance(sendTx(exempt))
+	require.NoError(t, sendTx(addr1))
+	require.Equal(t, int64(1), usedCalls(addr1))
+
+	// The status is reported by the stats.
+	stats, err := admin.Stats(0)
+	require.NoError(t, err)
+	require.Equal(t, MaintenanceStatus{
+		Enabled: true, Since: clock.now.Unix(), Allowlist: []string{addr1.String()},
+	}, stats.Maintenance)
+
+	// Disabling maintenance mode restores the throttle as it was.
+	clock.Advance(10 * time.Second)
+	require.NoError(t, admin.Reload(newConfig(false)))
+	require.Equal(t, "2017-07-14T02:40:20Z", loggedAt("Throttle maintenance mode disabled"))
+	_, ok = sendTx(origin).(*TxLimitReachedError)
+	require.True(t, ok)
+	require.NoError(t, sendTx(exempt))
+	require.NoError(t, sendTx(other))
+	stats, err = admin.Stats(0)
+	require.NoError(t, err)
+	require.False(t, stats.Maintenance.Enabled)
+	require.Equal(t, clock.now.Unix(), stats.Maintenance.Since)
+}
+
+func TestMaintenanceModeOnChain(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	now := time.Unix(1500000000, 0)
+	tmx := GetKarmaMiddleWare(
+		true, maxCallCount, sessionDuration, 0, 0, nil, createKarmaContractCtx,
+		WithOnChainParams(), WithHelpText("See https://example.com/status"),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+	memStore := store.NewMemStore()
+	nonce := uint64(0)
+	sendTx := func(height int64, from loom.Address) error {
+		nonce++
+		state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, false,
+		)
+	}
+
+	// Maintenance mode enabled by the on-chain params applies from the next block.
+	require.NoError(t, sendTx(1, origin))
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1}, nil, nil)
+	require.NoError(t, SetOnChainParams(state, &OnChainParams{
+		MaxCallCount: maxCallCount, SessionDuration: sessionDuration, MaintenanceMode: true,
+		MaintenanceAllowlist: []string{addr1.String()},
+	}))
+	require.NoError(t, sendTx(1, origin))
+	err := sendTx(2, origin)
+	_, ok := err.(*MaintenanceModeError)
+	require.True(t, ok, "expected a maintenance mode error, got %v", err)
+	require.Contains(t, err.Error(), "See https://example.com/status")
+	require.NoError(t, sendTx(2, addr1))
+
+	// Removing the on-chain params restores the static params, which don't enable maintenance mode.
+	state = loomchain.NewStoreState(nil, memStore, abci.Header{Height: 2}, nil, nil)
+	state.Delete(OnChainParamsKey)
+	require.NoError(t, sendTx(3, origin))
+}
@@ -0,0 +1,125 @@
+package throttle
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+)
+
+// Length of the selector EVM calldata starts with, which identifies the contract method called.
+const evmSelectorSize = 4
+
+// MethodLimit limits the call txs sent to a single method of a contract, in addition to the limits
+// of the contract itself.
+type MethodLimit struct {
+	// Address of the contract (chain:0x...)
+	Contract string
+	// Method of the contract, either the 4-byte selector of an EVM contract method (0x...), or the
+	// name of a Go contract method
+	Method string
+	// Max number of call txs all origins together can send to the method per session, zero or -1 for
+	// no limit
+	CallCount int64
+	// Max number of call txs each origin can send to the method per session, zero or -1 for no limit
+	OriginCallCount int64
+}
+
+// ValidateMethodLimits returns an error if any of the given limits is invalid, or more than one of
+// them limits the same method.
+func ValidateMethodLimits(limits []MethodLimit) error {
+	seen := make(map[string]int, len(limits))
+	for i, l := range limits {
+		contract, err := loom.ParseAddress(l.Contract)
+		if err != nil {
+			return errors.Wrapf(err, "MethodLimits[%d] %s is not a valid address", i, l.Contract)
+		}
+		if l.Method == "" {
+			return errors.Errorf("MethodLimits[%d] must set Method", i)
+		}
+		if strings.HasPrefix(l.Method, "0x") {
+			if b, err := hex.DecodeString(l.Method[2:]); err != nil || len(b) != evmSelectorSize {
+				return errors.Errorf("MethodLimits[%d] %s is not a valid 4-byte selector", i, l.Method)
+			}
+		}
+		key := methodLimitKey(contract, l.Method)
+		if j, ok := seen[key]; ok {
+			return errors.Errorf("MethodLimits[%d] duplicates the method of MethodLimits[%d]", i, j)
+		}
+		seen[key] = i
+	}
+	return nil
+}
+
+// WithMethodLimits makes the middleware limit the call txs sent to specific methods of contracts
+// during a call session, by all origins together and by each origin, in addition to the contract
+// limits (see WithContractLimits). Txs calling methods that aren't listed are only subject to the
+// contract limits, as are txs whose method can't be decoded. The limits must be valid (see
+// ValidateMethodLimits).
+func WithMethodLimits(limits ...MethodLimit) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		if th.contractLimits == nil {
+			th.contractLimits = newContractLimits(Unlimited, Unlimited, nil)
+		}
+		th.contractLimits.setMethodLimits(limits)
+	}
+}
+
+func methodLimitKey(contract loom.Address, method string) string {
+	if strings.HasPrefix(method, "0x") {
+		method = strings.ToLower(method)
+	}
+	return contract.String() + "/" + method
+}
+
+// Returns the method of the given contract called by the call tx with the given type & message data,
+// or an empty string if none of the methods of the contract are limited or the method can't be
+// decoded.
+func (t *Throttle) calledMethod(txID types.TxID, msgData []byte, contract loom.Address) string {
+	if t.contractLimits == nil || !t.contractLimits.hasMethodLimits(contract) {
+		return ""
+	}
+	var input []byte
+	switch txID {
+	case types.TxID_CALL:
+		var tx vm.CallTx
+		if err := proto.Unmarshal(msgData, &tx); err != nil {
+			return ""
+		}
+		if tx.VmType == vm.VMType_PLUGIN {
+			return pluginMethod(tx.Input)
+		}
+		input = tx.Input
+	case types.TxID_ETHEREUM:
+		data, err := ethCallData(msgData)
+		if err != nil {
+			return ""
+		}
+		input = data
+	default:
+		return ""
+	}
+	if len(input) < evmSelectorSize {
+		return ""
+	}
+	return "0x" + hex.EncodeToString(input[:evmSelectorSize])
+}
+
+// Returns the name of the Go contract method called with the given input, empty if it can't be
+// decoded.
+func pluginMethod(input []byte) string {
+	var req goloomplugin.Request
+	if err := proto.Unmarshal(input, &req); err != nil {
+		return ""
+	}
+	var call goloomplugin.ContractMethodCall
+	if err := proto.Unmarshal(req.Body, &call); err != nil {
+		return ""
+	}
+	return call.Method
+}
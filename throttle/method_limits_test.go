@@ -0,0 +1,147 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestValidateMethodLimits(t *testing.T) {
+	require.NoError(t, ValidateMethodLimits([]MethodLimit{
+		{Contract: contract.String(), Method: "Mint", OriginCallCount: 1},
+		{Contract: contract.String(), Method: "0xa0712d68", CallCount: 1},
+	}))
+
+	require.Error(t, ValidateMethodLimits([]MethodLimit{{Contract: "0xnope", Method: "Mint"}}))
+	require.Error(t, ValidateMethodLimits([]MethodLimit{{Contract: contract.String()}}))
+	require.Error(t, ValidateMethodLimits([]MethodLimit{{Contract: contract.String(), Method: "0xa0712d"}}))
+	require.Error(t, ValidateMethodLimits([]MethodLimit{{Contract: contract.String(), Method: "0xmint1234"}}))
+	// Selectors are compared regardless of case.
+	require.Error(t, ValidateMethodLimits([]MethodLimit{
+		{Contract: contract.String(), Method: "0xa0712d68"},
+		{Contract: contract.String(), Method: "0xA0712D68"},
+	}))
+}
+
+func TestMethodLimits(t *testing.T) {
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	// EVM calls are only accepted by active contracts.
+	require.NoError(t, karma.AddOwnedContract(contractContext, addr1, contract))
+
+	now := time.Unix(1500000000, 0)
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 100, sessionDuration, 0, 0, StaticLimitResolver(100), createKarmaContractCtx,
+		WithMethodLimits(
+			MethodLimit{Contract: contract.String(), Method: "Mint", OriginCallCount: 2},
+			MethodLimit{Contract: contract.String(), Method: "0xA0712D68", CallCount: 3},
+		),
+		WithContractLimits(Unlimited, 10), WithAdmin(admin),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonces := map[string]uint64{}
+	sendTx := func(from loom.Address, id types.TxID, data []byte) error {
+		nonces[from.String()]++
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, from)
+		_, err := tmx.ProcessTx(state.WithContext(ctx), deployNonceTx(t, nonces[from.String()], id, data), nopTxHandler, true)
+		return err
+	}
+	callTx := func(from loom.Address, vmType vm.VMType, input []byte) error {
+		data, err := proto.Marshal(&vm.CallTx{VmType: vmType, Input: input})
+		require.NoError(t, err)
+		return sendTx(from, types.TxID_CALL, data)
+	}
+	pluginCall := func(from loom.Address, method string) error {
+		body, err := proto.Marshal(&goloomplugin.ContractMethodCall{Method: method})
+		require.NoError(t, err)
+		input, err := proto.Marshal(&goloomplugin.Request{Body: body})
+		require.NoError(t, err)
+		return callTx(from, vm.VMType_PLUGIN, input)
+	}
+	ethCall := func(from loom.Address, input []byte) error {
+		data, err := ethTxBytes(nonces[from.String()]+1, contract, input)
+		require.NoError(t, err)
+		return sendTx(from, types.TxID_ETHEREUM, data)
+	}
+	limitErrOf := func(err error) *ContractTxLimitReachedError {
+		limitErr, ok := err.(*ContractTxLimitReachedError)
+		require.True(t, ok, "expected a contract limit error, got %v", err)
+		return limitErr
+	}
+	mint := []byte{0xa0, 0x71, 0x2d, 0x68, 0, 0, 0, 1}
+	transfer := []byte{0xa9, 0x05, 0x9c, 0xbb, 0, 0, 0, 1}
+
+	// Each origin can call the Go contract's Mint method twice...
+	require.NoError(t, pluginCall(origin, "Mint"))
+	require.NoError(t, pluginCall(origin, "Mint"))
+	limitErr := limitErrOf(pluginCall(origin, "Mint"))
+	require.Equal(t, "origin-method", limitErr.Scope)
+	require.Equal(t, "Mint", limitErr.Method)
+	require.Contains(t, limitErr.Error(), "txs allowed to method Mint of contract "+contract.String())
+	require.NoError(t, pluginCall(addr1, "Mint"))
+	// ...while its other methods & undecodable calls pass through to the contract limits.
+	require.NoError(t, pluginCall(origin, "Transfer"))
+	require.NoError(t, callTx(origin, vm.VMType_PLUGIN, []byte("not a request")))
+
+	// All origins together can call the EVM method with the mint selector three times, whether they
+	// send loom or eth txs...
+	require.NoError(t, callTx(addr1, vm.VMType_EVM, mint))
+	require.NoError(t, ethCall(addr1, mint))
+	require.NoError(t, callTx(origin, vm.VMType_EVM, mint))
+	limitErr = limitErrOf(ethCall(origin, mint))
+	require.Equal(t, "method", limitErr.Scope)
+	require.Equal(t, "0xa0712d68", limitErr.Method)
+	// ...while other selectors & calldata too short to have one pass through.
+	require.NoError(t, ethCall(addr1, transfer))
+	require.NoError(t, callTx(addr1, vm.VMType_EVM, mint[:3]))
+
+	// The contract limits still apply to the calls of limited methods.
+	for i := 0; i < 5; i++ {
+		require.NoError(t, pluginCall(addr1, "Transfer"))
+	}
+	limitErr = limitErrOf(pluginCall(addr1, "Mint"))
+	require.Equal(t, "origin-contract", limitErr.Scope)
+	require.Empty(t, limitErr.Method)
+
+	// The method limits are restored once the session ends.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	require.NoError(t, pluginCall(origin, "Mint"))
+	require.NoError(t, ethCall(origin, mint))
+}
+
+func TestMethodLimitsInState(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithMethodLimits(MethodLimit{Contract: contract.String(), Method: "Mint", OriginCallCount: 1})(th)
+	WithBlockSessions(10, 0)(th)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 11}, nil, nil)
+
+	_, err := th.countContractTx(state, origin, contract, "Mint", 1)
+	require.NoError(t, err)
+	_, err = th.countContractTx(state, origin, contract, "Mint", 1)
+	limitErr := err.(*ContractTxLimitReachedError)
+	require.Equal(t, "origin-method", limitErr.Scope)
+	require.Equal(t, int64(9), limitErr.RetryInBlocks)
+	// Calls to other methods aren't limited, not even by the contract.
+	for i := 0; i < 5; i++ {
+		_, err = th.countContractTx(state, origin, contract, "Transfer", 1)
+		require.NoError(t, err)
+	}
+}
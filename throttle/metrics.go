@@ -0,0 +1,204 @@
+package throttle
+
+import (
+	"sync"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMaxLabelledOffenders is the default max number of origins the per-origin throttled tx
+// counter has a separate label for.
+const DefaultMaxLabelledOffenders = 100
+
+// Label of the per-origin throttled tx counter used for the origins that don't have their own.
+const otherOffendersLabel = "other"
+
+// Metrics collected by the throttle, the counters & the histogram have a "budget" label.
+type Metrics struct {
+	TxsAllowed   metrics.Counter
+	TxsThrottled metrics.Counter
+	// Fraction of the limit used by each session, observed when the session ends.
+	SessionUtilization metrics.Histogram
+	// Number of origins the throttle has session records for.
+	TrackedOrigins metrics.Gauge
+	// Number of txs throttled per origin (label "origin"), nil if per-origin metrics are disabled.
+	// Only the first MaxLabelledOffenders origins to be throttled get their own label to bound the
+	// cardinality of the metric, txs throttled for any other origin are counted under "other".
+	OriginTxsThrottled   metrics.Counter
+	MaxLabelledOffenders int
+	// Number of times the params of the throttle have changed at runtime.
+	ParamsUpdates metrics.Counter
+	// Number of origins whose session records have been evicted, labelled by "reason": idle if all
+	// their sessions had ended, pressure if room had to be made for another origin.
+	OriginsEvicted metrics.Counter
+	// 1 while the memory session store holds as many origins as it can, 0 otherwise.
+	SessionStoreSaturated metrics.Gauge
+	// Number of throttle events dropped because the audit sink couldn't keep up.
+	AuditEventsDropped metrics.Counter
+
+	// TxsAllowed labelled with each budget, labelled once since labelling a counter allocates.
+	allowed     [numBudgets]metrics.Counter
+	allowedOnce sync.Once
+	// Origins that have their own label in OriginTxsThrottled, guarded by offendersMtx.
+	offenders    map[string]struct{}
+	offendersMtx sync.Mutex
+}
+
+// NopMetrics returns metrics that discard everything.
+func NopMetrics() *Metrics {
+	return &Metrics{
+		TxsAllowed:            discard.NewCounter(),
+		TxsThrottled:          discard.NewCounter(),
+		SessionUtilization:    discard.NewHistogram(),
+		TrackedOrigins:        discard.NewGauge(),
+		ParamsUpdates:         discard.NewCounter(),
+		OriginsEvicted:        discard.NewCounter(),
+		SessionStoreSaturated: discard.NewGauge(),
+		AuditEventsDropped:    discard.NewCounter(),
+	}
+}
+
+// NewPrometheusMetrics creates & registers the throttle metrics with Prometheus, it should only be
+// called once. Per-origin metrics are only collected if perOrigin is true.
+func NewPrometheusMetrics(perOrigin bool) *Metrics {
+	m := &Metrics{
+		TxsAllowed: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "txs_allowed_total",
+			Help:      "Number of txs allowed by the throttle.",
+		}, []string{"budget"}),
+		TxsThrottled: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "txs_throttled_total",
+			Help:      "Number of txs rejected by the throttle.",
+		}, []string{"budget"}),
+		SessionUtilization: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "session_utilization",
+			Help:      "Fraction of the tx limit used by each session, observed when the session ends.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 0.75, 0.9, 1},
+		}, []string{"budget"}),
+		TrackedOrigins: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "tracked_origins",
+			Help:      "Number of origins the throttle has session records for.",
+		}, nil),
+		ParamsUpdates: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "params_updates_total",
+			Help:      "Number of times the throttle params have changed at runtime.",
+		}, nil),
+		OriginsEvicted: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "origins_evicted_total",
+			Help:      "Number of origins whose session records have been evicted.",
+		}, []string{"reason"}),
+		SessionStoreSaturated: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "session_store_saturated",
+			Help:      "1 while the throttle keeps session records for as many origins as it can.",
+		}, nil),
+		AuditEventsDropped: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "audit_events_dropped_total",
+			Help:      "Number of throttle events dropped because the audit sink couldn't keep up.",
+		}, nil),
+	}
+	if perOrigin {
+		m.OriginTxsThrottled = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "loomchain",
+			Subsystem: "throttle",
+			Name:      "origin_txs_throttled_total",
+			Help:      "Number of txs rejected by the throttle per origin.",
+		}, []string{"origin"})
+		m.MaxLabelledOffenders = DefaultMaxLabelledOffenders
+	}
+	return m
+}
+
+func (m *Metrics) txAllowed(budget txBudget) {
+	m.allowedOnce.Do(func() {
+		for b := txBudget(0); b < numBudgets; b++ {
+			m.allowed[b] = m.TxsAllowed.With("budget", b.String())
+		}
+	})
+	m.allowed[budget].Add(1)
+}
+
+func (m *Metrics) txThrottled(budget txBudget, origin string) {
+	m.TxsThrottled.With("budget", budget.String()).Add(1)
+	if m.OriginTxsThrottled != nil {
+		m.OriginTxsThrottled.With("origin", m.offenderLabel(origin)).Add(1)
+	}
+}
+
+func (m *Metrics) paramsUpdated() {
+	if m.ParamsUpdates != nil {
+		m.ParamsUpdates.Add(1)
+	}
+}
+
+func (m *Metrics) auditEventDropped() {
+	if m.AuditEventsDropped != nil {
+		m.AuditEventsDropped.Add(1)
+	}
+}
+
+func (m *Metrics) originEvicted(reason string) {
+	if m.OriginsEvicted != nil {
+		m.OriginsEvicted.With("reason", reason).Add(1)
+	}
+}
+
+func (m *Metrics) storeSaturated(saturated bool) {
+	if m.SessionStoreSaturated == nil {
+		return
+	}
+	if saturated {
+		m.SessionStoreSaturated.Set(1)
+	} else {
+		m.SessionStoreSaturated.Set(0)
+	}
+}
+
+// Returns the label the given origin should be counted under in OriginTxsThrottled.
+func (m *Metrics) offenderLabel(origin string) string {
+	m.offendersMtx.Lock()
+	defer m.offendersMtx.Unlock()
+
+	if _, ok := m.offenders[origin]; ok {
+		return origin
+	}
+	if len(m.offenders) >= m.MaxLabelledOffenders {
+		return otherOffendersLabel
+	}
+	if m.offenders == nil {
+		m.offenders = make(map[string]struct{})
+	}
+	m.offenders[origin] = struct{}{}
+	return origin
+}
+
+// Records the utilization of a session that has ended, sessions in which no txs were sent are
+// ignored.
+func (m *Metrics) sessionEnded(budget txBudget, session *budgetSession) {
+	if session.accessCount == 0 || session.limit <= 0 {
+		return
+	}
+	utilization := float64(session.accessCount) / float64(session.limit)
+	if utilization > 1 {
+		utilization = 1
+	}
+	m.SessionUtilization.With("budget", budget.String()).Observe(utilization)
+}
@@ -0,0 +1,49 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/auth"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates a Karma contract in the given fake context and initializes it with the given request,
+// returns the context of the contract, along with a function that returns that context for any
+// state, which can be passed to the Karma middleware.
+func newKarmaContractCtx(
+	t testing.TB, fakeCtx *goloomplugin.FakeContext, init *ktypes.KarmaInitRequest,
+) (contractpb.Context, func(state loomchain.State) (contractpb.Context, error)) {
+	karmaAddr := fakeCtx.CreateContract(karma.Contract)
+	contractContext := contractpb.WrapPluginContext(fakeCtx.WithAddress(karmaAddr))
+	karmaContract := &karma.Karma{}
+	require.NoError(t, karmaContract.Init(contractContext, init))
+	return contractContext, func(state loomchain.State) (contractpb.Context, error) {
+		return contractContext, nil
+	}
+}
+
+// Tx handler that accepts any tx.
+func nopTxHandler(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+	return loomchain.TxHandlerResult{}, nil
+}
+
+// Runs the given tx through the given middleware as if it was sent by the given origin, the tx is
+// passed on to the given handler if the middleware lets it through.
+func processTxFrom(
+	ttm loomchain.TxMiddlewareFunc, state loomchain.State, from loom.Address, tx auth.SignedTx,
+	next loomchain.TxHandlerFunc, isCheckTx bool,
+) error {
+	ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, from)
+	_, err := ttm.ProcessTx(state.WithContext(ctx), tx.Inner, next, isCheckTx)
+	return err
+}
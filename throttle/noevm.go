@@ -9,3 +9,11 @@ import (
 func isEthDeploy(_ []byte) (bool, error) {
 	return false, errors.New("ethereum transactions not supported in non evm build")
 }
+
+func ethDeployCodeSize(_ []byte) (int64, error) {
+	return 0, errors.New("ethereum transactions not supported in non evm build")
+}
+
+func ethCallData(_ []byte) ([]byte, error) {
+	return nil, errors.New("ethereum transactions not supported in non evm build")
+}
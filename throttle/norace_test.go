@@ -0,0 +1,5 @@
+// +build evm,!race
+
+package throttle
+
+const raceEnabled = false
@@ -0,0 +1,221 @@
+package throttle
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+	"github.com/pkg/errors"
+)
+
+// OnChainParamsKey is the app state key the throttle reads its on-chain params from when on-chain
+// params are enabled, the value is a JSON encoded OnChainParams.
+var OnChainParamsKey = []byte("throttle-params")
+
+// Bounds on-chain params must be within to be applied, so a bad throttle admin tx can't effectively
+// halt the chain by throttling everyone, or disable the throttle by accident.
+const (
+	MaxOnChainTxLimit         int64 = 1000000
+	MaxOnChainSessionDuration int64 = 7 * 24 * 60 * 60
+	MaxOnChainExemptOrigins         = 1000
+)
+
+// OnChainParams are the throttle params that can be updated at runtime by storing them in the app
+// state, they override the statically configured values.
+type OnChainParams struct {
+	// Max number of call txs per session, zero or -1 for no limit
+	MaxCallCount int64
+	// Session length in seconds
+	SessionDuration int64
+	// Max number of deploy txs per deploy session, zero or -1 for no limit
+	MaxDeployCount int64
+	// Deploy session length in seconds, defaults to SessionDuration if zero
+	DeploySessionDuration int64
+	// Origins (chain:0x... addresses) that aren't throttled at all
+	ExemptOrigins []string
+	// Puts the chain into maintenance mode, rejecting all txs except those sent by the origins on
+	// MaintenanceAllowlist
+	MaintenanceMode bool
+	// Origins (chain:0x... addresses) whose txs are accepted in maintenance mode
+	MaintenanceAllowlist []string
+}
+
+// Validate returns an error naming the offending field if the params are outside the bounds the
+// throttle accepts.
+func (p *OnChainParams) Validate() error {
+	if p.MaxCallCount > MaxOnChainTxLimit {
+		return errors.Errorf("MaxCallCount %d must not exceed %d", p.MaxCallCount, MaxOnChainTxLimit)
+	}
+	if p.MaxDeployCount > MaxOnChainTxLimit {
+		return errors.Errorf("MaxDeployCount %d must not exceed %d", p.MaxDeployCount, MaxOnChainTxLimit)
+	}
+	if p.SessionDuration <= 0 || p.SessionDuration > MaxOnChainSessionDuration {
+		return errors.Errorf(
+			"SessionDuration %d must be between 1 and %d", p.SessionDuration, MaxOnChainSessionDuration,
+		)
+	}
+	if p.DeploySessionDuration < 0 || p.DeploySessionDuration > MaxOnChainSessionDuration {
+		return errors.Errorf(
+			"DeploySessionDuration %d must be between 0 and %d", p.DeploySessionDuration, MaxOnChainSessionDuration,
+		)
+	}
+	if len(p.ExemptOrigins) > MaxOnChainExemptOrigins {
+		return errors.Errorf("ExemptOrigins must not have more than %d entries", MaxOnChainExemptOrigins)
+	}
+	for i, origin := range p.ExemptOrigins {
+		if _, err := loom.ParseAddress(origin); err != nil {
+			return errors.Wrapf(err, "ExemptOrigins[%d] %s is not a valid address", i, origin)
+		}
+	}
+	if len(p.MaintenanceAllowlist) > MaxOnChainExemptOrigins {
+		return errors.Errorf("MaintenanceAllowlist must not have more than %d entries", MaxOnChainExemptOrigins)
+	}
+	for i, origin := range p.MaintenanceAllowlist {
+		if _, err := loom.ParseAddress(origin); err != nil {
+			return errors.Wrapf(err, "MaintenanceAllowlist[%d] %s is not a valid address", i, origin)
+		}
+	}
+	return nil
+}
+
+// SetOnChainParams stores the given params in the app state, the throttle applies them from the next
+// block onwards. Returns an error if the params are invalid. The params are updated on a live chain
+// by throttle admin txs (see AdminTxHandler).
+func SetOnChainParams(state loomchain.State, params *OnChainParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	state.Set(OnChainParamsKey, data)
+	return nil
+}
+
+// Loads the on-chain params from the app state, returns nil if there are none.
+func loadOnChainParams(state loomchain.State) (*OnChainParams, error) {
+	data := state.Get(OnChainParamsKey)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var params OnChainParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal on-chain throttle params")
+	}
+	if err := params.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid on-chain throttle params")
+	}
+	return &params, nil
+}
+
+// The throttle params that can be updated at runtime.
+type throttleParams struct {
+	maxCallCount          int64
+	sessionDuration       int64
+	maxDeployCount        int64
+	deploySessionDuration int64
+	// Origins that aren't throttled, keyed by address.
+	exemptOrigins map[string]struct{}
+	// True if all txs are rejected except those sent by the origins on maintenanceAllowlist.
+	maintenance bool
+	// Origins whose txs are accepted in maintenance mode, keyed by address.
+	maintenanceAllowlist map[string]struct{}
+}
+
+func newThrottleParams(p *OnChainParams) throttleParams {
+	params := throttleParams{
+		maxCallCount:          p.MaxCallCount,
+		sessionDuration:       p.SessionDuration,
+		maxDeployCount:        p.MaxDeployCount,
+		deploySessionDuration: p.DeploySessionDuration,
+		maintenance:           p.MaintenanceMode,
+	}
+	if params.deploySessionDuration == 0 {
+		params.deploySessionDuration = params.sessionDuration
+	}
+	if len(p.ExemptOrigins) > 0 {
+		params.exemptOrigins = make(map[string]struct{}, len(p.ExemptOrigins))
+		for _, origin := range p.ExemptOrigins {
+			params.exemptOrigins[loom.MustParseAddress(origin).String()] = struct{}{}
+		}
+	}
+	if len(p.MaintenanceAllowlist) > 0 {
+		params.maintenanceAllowlist = make(map[string]struct{}, len(p.MaintenanceAllowlist))
+		for _, origin := range p.MaintenanceAllowlist {
+			params.maintenanceAllowlist[loom.MustParseAddress(origin).String()] = struct{}{}
+		}
+	}
+	return params
+}
+
+// Tracks the on-chain params of the throttle.
+type onChainParamsCache struct {
+	// Params the throttle was created with, applied when there are no valid on-chain params.
+	static throttleParams
+	// Height of the block the params were last loaded at in DeliverTx, zero if they haven't been.
+	height int64
+	// True if the params have been loaded at least once.
+	loaded bool
+}
+
+// Reloads the on-chain params of the throttle if they haven't been loaded at the current height yet.
+// In DeliverTx the params are loaded once per block, by the first tx that reaches the throttle, so all
+// nodes apply the same params to the same txs. CheckTx keeps using the params loaded by DeliverTx,
+// and only loads them itself if the node hasn't processed a block since it started.
+func (t *Throttle) refreshParams(state loomchain.State, isCheckTx bool) {
+	if t.onChainParams == nil {
+		return
+	}
+	height := state.Block().Height
+
+	t.paramsMtx.Lock()
+	defer t.paramsMtx.Unlock()
+
+	cache := t.onChainParams
+	if cache.loaded && (isCheckTx || cache.height == height) {
+		return
+	}
+	cache.loaded = true
+	if !isCheckTx {
+		cache.height = height
+	}
+
+	params := cache.static
+	onChainParams, err := loadOnChainParams(state)
+	if err != nil {
+		t.logger.Error("Ignoring on-chain throttle params", "height", height, "err", err)
+	} else if onChainParams != nil {
+		params = newThrottleParams(onChainParams)
+	}
+	if reflect.DeepEqual(params, t.params) {
+		return
+	}
+	t.maintenanceSwitched(t.params, params, height)
+	t.params = params
+	if t.karmaLimits != nil {
+		t.karmaLimits.setBaseLimit(params.maxCallCount)
+	}
+	t.metrics.paramsUpdated()
+	t.logger.Info(
+		"Throttle params changed", "height", height, "on_chain", onChainParams != nil,
+		"max_call_count", params.maxCallCount, "session_duration", params.sessionDuration,
+		"max_deploy_count", params.maxDeployCount, "deploy_session_duration", params.deploySessionDuration,
+		"exempt_origins", len(params.exemptOrigins), "maintenance", params.maintenance,
+	)
+}
+
+// Returns the params currently applied by the throttle.
+func (t *Throttle) currentParams() throttleParams {
+	t.paramsMtx.RLock()
+	defer t.paramsMtx.RUnlock()
+	return t.params
+}
+
+// Returns the max total size in bytes of the txs each origin can send per call session.
+func (t *Throttle) txBytesLimit() int64 {
+	t.paramsMtx.RLock()
+	defer t.paramsMtx.RUnlock()
+	return t.maxTxBytes
+}
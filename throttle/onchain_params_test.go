@@ -0,0 +1,114 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/generic"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestOnChainParamsValidate(t *testing.T) {
+	require.NoError(t, (&OnChainParams{MaxCallCount: 10, SessionDuration: 60}).Validate())
+
+	invalid := []struct {
+		field  string
+		params OnChainParams
+	}{
+		{"MaxCallCount", OnChainParams{MaxCallCount: MaxOnChainTxLimit + 1, SessionDuration: 60}},
+		{"MaxDeployCount", OnChainParams{MaxDeployCount: MaxOnChainTxLimit + 1, SessionDuration: 60}},
+		{"SessionDuration", OnChainParams{MaxCallCount: 10}},
+		{"SessionDuration", OnChainParams{SessionDuration: MaxOnChainSessionDuration + 1}},
+		{"DeploySessionDuration", OnChainParams{SessionDuration: 60, DeploySessionDuration: -1}},
+		{"ExemptOrigins[0]", OnChainParams{SessionDuration: 60, ExemptOrigins: []string{"0xnope"}}},
+		{"MaintenanceAllowlist[0]", OnChainParams{SessionDuration: 60, MaintenanceAllowlist: []string{"0xnope"}}},
+	}
+	for _, c := range invalid {
+		err := c.params.Validate()
+		require.Error(t, err, c.field)
+		require.Contains(t, err.Error(), c.field)
+	}
+}
+
+func TestOnChainParams(t *testing.T) {
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	logger := &recordingLogger{}
+	metrics := NopMetrics()
+	updates := generic.NewCounter("params_updates")
+	metrics.ParamsUpdates = updates
+	now := time.Unix(1500000000, 0)
+	tmx := GetKarmaMiddleWare(
+		true, 3, sessionDuration, 0, 0, nil, createKarmaContractCtx,
+		WithOnChainParams(), WithLogger(logger), WithMetrics(metrics),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+
+	memStore := store.NewMemStore()
+	callKarma := userState.CallKarmaTotal.Value.Int64()
+	nonce := uint64(0)
+	sendTx := func(height int64, isCheckTx bool) error {
+		nonce++
+		state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+		return processTxFrom(
+			tmx, state, origin, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, isCheckTx,
+		)
+	}
+	setParams := func(height int64, params *OnChainParams) {
+		state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+		require.NoError(t, SetOnChainParams(state, params))
+	}
+
+	// The static limits apply while there are no on-chain params.
+	for i := int64(0); i < 3+callKarma; i++ {
+		require.NoError(t, sendTx(1, false))
+	}
+	require.Error(t, sendTx(1, false))
+	require.Equal(t, 0.0, updates.Value())
+
+	// Params changed during a block apply from the next block.
+	setParams(1, &OnChainParams{MaxCallCount: 5, SessionDuration: sessionDuration, ExemptOrigins: []string{
+		origin.String(),
+	}})
+	require.Error(t, sendTx(1, false))
+	require.NoError(t, sendTx(2, false))
+	require.Equal(t, 1.0, updates.Value())
+	require.Equal(t, "Throttle params changed", logger.entries[len(logger.entries)-1].msg)
+
+	// The base limit of the Karma limit resolver tracks the on-chain limit.
+	setParams(2, &OnChainParams{MaxCallCount: 100, SessionDuration: sessionDuration})
+	require.NoError(t, sendTx(3, false))
+	require.Equal(t, 2.0, updates.Value())
+
+	// Invalid params are ignored in favor of the static ones.
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 3}, nil, nil)
+	state.Set(OnChainParamsKey, []byte(`{"MaxCallCount":5,"SessionDuration":0}`))
+	require.Error(t, sendTx(4, false))
+	require.Equal(t, 1, logger.count("error"))
+	require.Equal(t, 3.0, updates.Value())
+
+	// CheckTx keeps using the params loaded by DeliverTx.
+	setParams(4, &OnChainParams{MaxCallCount: 100, SessionDuration: sessionDuration})
+	require.Error(t, sendTx(5, true))
+	require.NoError(t, sendTx(5, false))
+	require.NoError(t, sendTx(5, true))
+
+	// The static params are restored when the on-chain params are removed.
+	state = loomchain.NewStoreState(nil, memStore, abci.Header{Height: 5}, nil, nil)
+	state.Delete(OnChainParamsKey)
+	require.Error(t, sendTx(6, false))
+	require.Equal(t, 5.0, updates.Value())
+}
@@ -0,0 +1,76 @@
+package throttle
+
+import (
+	"sync"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+)
+
+// Exempts the oracle currently registered in the state of a contract from the throttle, so the
+// exemption follows the oracle when its key is rotated by a tx.
+type oracleBypass struct {
+	// Key the oracle address is stored under in the contract state, as a types.Address.
+	key               []byte
+	createContractCtx func(state loomchain.State) (contractpb.StaticContext, error)
+	// The oracle may be rotated by a tx in the block being delivered, so CheckTx resolves it
+	// separately from DeliverTx.
+	checkTx   resolvedOracle
+	deliverTx resolvedOracle
+	mtx       sync.Mutex
+}
+
+// Oracle address resolved at a particular height.
+type resolvedOracle struct {
+	height int64
+	// Nil if no oracle is registered, or if it couldn't be resolved.
+	oracle *loom.Address
+}
+
+// Returns true if the given origin is the oracle registered in the contract state. The oracle is
+// resolved once per block, and no origin is considered to be the oracle if it can't be resolved, in
+// which case the error is logged once per block.
+func (t *Throttle) isRegisteredOracle(state loomchain.State, origin loom.Address, isCheckTx bool) bool {
+	if t.oracleBypass == nil {
+		return false
+	}
+	b := t.oracleBypass
+	height := state.Block().Height
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	resolved := &b.deliverTx
+	if isCheckTx {
+		resolved = &b.checkTx
+	}
+	if resolved.height != height {
+		oracle, err := b.resolveOracle(state)
+		if err != nil {
+			t.logger.Error("Failed to resolve oracle, not exempting it from the throttle", "height", height, "err", err)
+		}
+		*resolved = resolvedOracle{height: height, oracle: oracle}
+	}
+	return resolved.oracle != nil && resolved.oracle.Compare(origin) == 0
+}
+
+func (b *oracleBypass) resolveOracle(state loomchain.State) (*loom.Address, error) {
+	ctx, err := b.createContractCtx(state)
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.Has(b.key) {
+		return nil, nil
+	}
+	var oraclePB types.Address
+	if err := ctx.Get(b.key, &oraclePB); err != nil {
+		return nil, err
+	}
+	oracle := loom.UnmarshalAddressPB(&oraclePB)
+	if oracle.IsEmpty() {
+		return nil, nil
+	}
+	return &oracle, nil
+}
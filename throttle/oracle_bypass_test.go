@@ -0,0 +1,89 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestOracleBypass(t *testing.T) {
+	fakeCtx := goloomplugin.CreateFakeContext(addr1, addr1)
+	_, createKarmaContractCtx := newKarmaContractCtx(t, fakeCtx, &ktypes.KarmaInitRequest{Sources: sources})
+	// The oracle is looked up in a separate contract so the karma oracle bypass doesn't apply.
+	oracleKey := []byte("oracle")
+	oracleCtx := contractpb.WrapPluginContext(fakeCtx.WithAddress(fakeCtx.CreateContract(karma.Contract)))
+	setOracle := func(oracle *types.Address) {
+		require.NoError(t, oracleCtx.Set(oracleKey, oracle))
+	}
+	resolveErr := error(nil)
+	createOracleCtx := func(state loomchain.State) (contractpb.StaticContext, error) {
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+		return oracleCtx, nil
+	}
+
+	logger := &recordingLogger{}
+	now := time.Unix(1500000000, 0)
+	tmx := GetKarmaMiddleWare(
+		true, 1, sessionDuration, 0, 0, StaticLimitResolver(1), createKarmaContractCtx,
+		WithOracleBypass(oracleKey, createOracleCtx), WithLogger(logger),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+	memStore := store.NewMemStore()
+	nonces := map[string]uint64{}
+	sendTx := func(height int64, from loom.Address, isCheckTx bool) error {
+		nonces[from.String()]++
+		state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonces[from.String()], types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, isCheckTx,
+		)
+	}
+
+	// No origin is exempt while no oracle is registered.
+	require.NoError(t, sendTx(1, origin, false))
+	require.Error(t, sendTx(1, origin, false))
+
+	setOracle(origin.MarshalPB())
+	require.Error(t, sendTx(1, origin, false))
+	require.NoError(t, sendTx(2, origin, false))
+	require.NoError(t, sendTx(2, origin, false))
+
+	// When the oracle is rotated the exemption moves to the new oracle from the next block.
+	require.NoError(t, sendTx(2, addr1, false))
+	setOracle(addr1.MarshalPB())
+	require.NoError(t, sendTx(2, origin, false))
+	require.Error(t, sendTx(2, addr1, false))
+	require.Error(t, sendTx(3, origin, false))
+	require.NoError(t, sendTx(3, addr1, false))
+	require.NoError(t, sendTx(3, addr1, false))
+	// CheckTx resolves the oracle separately.
+	require.NoError(t, sendTx(3, addr1, true))
+	require.Error(t, sendTx(3, origin, true))
+
+	// The bypass fails closed if the oracle can't be resolved, and the error is only logged once per
+	// block.
+	resolveErr = errors.New("contract not found")
+	require.Error(t, sendTx(4, addr1, false))
+	require.Error(t, sendTx(4, addr1, false))
+	require.Equal(t, 1, logger.count("error"))
+	require.Error(t, sendTx(5, addr1, false))
+	require.Equal(t, 2, logger.count("error"))
+
+	resolveErr = nil
+	require.NoError(t, sendTx(6, addr1, false))
+}
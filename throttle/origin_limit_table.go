@@ -0,0 +1,158 @@
+package throttle
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/go-loom/util"
+	"github.com/loomnetwork/loomchain"
+	"github.com/pkg/errors"
+)
+
+var originLimitKeyPrefix = []byte("throttle-origin-limit")
+
+// OriginLimitKey returns the key the limit table entry of the given origin is stored under in the
+// state of the table contract, the value is a JSON encoded OriginLimit.
+func OriginLimitKey(origin loom.Address) []byte {
+	return util.PrefixKey(originLimitKeyPrefix, origin.Bytes())
+}
+
+// OriginLimit is an entry of the limit table managed by an admin contract, it sets the limits of a
+// single origin. Origins without an entry are subject to the limits that apply to all origins.
+type OriginLimit struct {
+	// Max number of call txs the origin can send per Window, zero to apply the call limit of all
+	// origins, -1 for no limit
+	CallCount int64
+	// Max total size in bytes of the txs the origin can send per Window, zero to apply the byte limit
+	// of all origins, -1 for no limit
+	TxBytes int64
+	// Length in seconds of the period the limits apply to, zero if they apply to a whole session. All
+	// origins share the same call sessions, so the limits are scaled to the length of the call
+	// session, e.g. 500 per hour becomes 1000 per 2 hour session. Ignored in block session mode.
+	Window int64
+}
+
+// Validate returns an error if the entry sets no limits, or has a negative window.
+func (l *OriginLimit) Validate() error {
+	if l.CallCount == 0 && l.TxBytes == 0 {
+		return errors.New("entry must set CallCount or TxBytes")
+	}
+	if l.Window < 0 {
+		return errors.Errorf("Window %d must not be negative", l.Window)
+	}
+	return nil
+}
+
+// Looks up the limits of origins in the state of a contract, entries are cached until the block
+// height changes so the entry of an origin is only read once per block.
+type originLimitTable struct {
+	createContractCtx func(state loomchain.State) (contractpb.StaticContext, error)
+	// Entries read at height keyed by origin address, nil if the origin has no valid entry, guarded
+	// by mtx.
+	height  int64
+	entries map[string]*OriginLimit
+	mtx     sync.Mutex
+}
+
+// WithOriginLimitTable makes the middleware look up the limits of each origin in the state of the
+// contract created by createContractCtx (see OriginLimitKey), so an admin contract can set the limits
+// of specific accounts. An entry takes precedence over the call limit resolved for the origin and
+// the byte limit of all origins, while exempt origins & origin overrides take precedence over the
+// table. Changes to the table apply from the next block.
+func WithOriginLimitTable(createContractCtx func(state loomchain.State) (contractpb.StaticContext, error)) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.limitTable = &originLimitTable{createContractCtx: createContractCtx}
+	}
+}
+
+// Returns the limit table entry of the given origin, nil if it has none. An entry that can't be read
+// is logged and treated as missing, since rejecting all the txs of the origin would be worse.
+func (t *Throttle) originLimit(state loomchain.State, origin loom.Address) *OriginLimit {
+	if t.limitTable == nil {
+		return nil
+	}
+	table := t.limitTable
+	height := state.Block().Height
+	key := origin.String()
+
+	table.mtx.Lock()
+	if table.entries == nil || table.height != height {
+		table.height = height
+		table.entries = make(map[string]*OriginLimit)
+	}
+	entry, ok := table.entries[key]
+	table.mtx.Unlock()
+	if ok {
+		return entry
+	}
+
+	entry, err := table.readEntry(state, origin)
+	if err != nil {
+		t.logger.Error("Ignoring throttle limit table entry", "origin", key, "height", height, "err", err)
+	}
+	table.mtx.Lock()
+	if table.height == height {
+		table.entries[key] = entry
+	}
+	table.mtx.Unlock()
+	return entry
+}
+
+func (table *originLimitTable) readEntry(state loomchain.State, origin loom.Address) (*OriginLimit, error) {
+	ctx, err := table.createContractCtx(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create limit table contract context")
+	}
+	data := state.WithPrefix(loom.DataPrefix(ctx.ContractAddress())).Get(OriginLimitKey(origin))
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var entry OriginLimit
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal limit table entry")
+	}
+	if err := entry.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid limit table entry")
+	}
+	return &entry, nil
+}
+
+// Returns the call limit set by the limit table entry of the given origin, false if there isn't one.
+func (t *Throttle) tableCallLimit(state loomchain.State, origin loom.Address) (int64, bool) {
+	entry := t.originLimit(state, origin)
+	if entry == nil || entry.CallCount == 0 {
+		return 0, false
+	}
+	if isUnlimited(entry.CallCount) {
+		return Unlimited, true
+	}
+	return t.scaleLimit(entry.CallCount, entry.Window), true
+}
+
+// Returns the max total size in bytes of the txs the given origin can send per call session.
+func (t *Throttle) originTxBytesLimit(state loomchain.State, origin loom.Address) int64 {
+	entry := t.originLimit(state, origin)
+	if entry == nil || entry.TxBytes == 0 {
+		return t.txBytesLimit()
+	}
+	if isUnlimited(entry.TxBytes) {
+		return Unlimited
+	}
+	return t.scaleLimit(entry.TxBytes, entry.Window)
+}
+
+// Resolves the call limit of origins that have a limit table entry from the entry, and the limits of
+// other origins with the wrapped resolver.
+type tableLimitResolver struct {
+	throttle *Throttle
+	next     LimitResolver
+}
+
+func (r *tableLimitResolver) ResolveLimit(state loomchain.State, origin loom.Address) (int64, error) {
+	if limit, ok := r.throttle.tableCallLimit(state, origin); ok {
+		return limit, nil
+	}
+	return r.next.ResolveLimit(state, origin)
+}
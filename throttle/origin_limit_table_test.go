@@ -0,0 +1,110 @@
+// +build evm
+
+package throttle
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestOriginLimitTable(t *testing.T) {
+	fakeCtx := goloomplugin.CreateFakeContext(addr1, addr1)
+	_, createKarmaContractCtx := newKarmaContractCtx(t, fakeCtx, &ktypes.KarmaInitRequest{Sources: sources})
+	tableCtx := contractpb.WrapPluginContext(fakeCtx.WithAddress(fakeCtx.CreateContract(karma.Contract)))
+	createTableCtx := func(state loomchain.State) (contractpb.StaticContext, error) {
+		return tableCtx, nil
+	}
+
+	admin := NewAdmin()
+	logger := &recordingLogger{}
+	now := time.Unix(1500000000, 0)
+	tmx := GetKarmaMiddleWare(
+		true, 2, sessionDuration, 0, 0, StaticLimitResolver(2), createKarmaContractCtx,
+		WithOriginLimitTable(createTableCtx), WithExemptOrigins(addr1), WithAdmin(admin), WithLogger(logger),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+	memStore := store.NewMemStore()
+	stateAt := func(height int64) loomchain.State {
+		return loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+	}
+	setEntry := func(height int64, from loom.Address, data []byte) {
+		tableState := stateAt(height).WithPrefix(loom.DataPrefix(tableCtx.ContractAddress()))
+		tableState.Set(OriginLimitKey(from), data)
+	}
+	setLimit := func(height int64, from loom.Address, limit OriginLimit) {
+		data, err := json.Marshal(limit)
+		require.NoError(t, err)
+		setEntry(height, from, data)
+	}
+	nonces := map[string]uint64{}
+	sendTx := func(height int64, from loom.Address) error {
+		nonces[from.String()]++
+		state := stateAt(height)
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonces[from.String()], types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+		)
+	}
+	limitOf := func(height int64, from loom.Address, budget txBudget) int64 {
+		quota, err := admin.Quota(stateAt(height), from)
+		require.NoError(t, err)
+		return quota.Budgets[budget].Limit
+	}
+
+	// Origins without an entry get the default limits.
+	require.Equal(t, int64(2), limitOf(1, origin, callBudget))
+	require.Equal(t, Unlimited, limitOf(1, origin, bytesBudget))
+	require.NoError(t, sendTx(1, origin))
+	require.NoError(t, sendTx(1, origin))
+	_, ok := sendTx(1, origin).(*TxLimitReachedError)
+	require.True(t, ok)
+
+	// Entries are cached until the next block.
+	setLimit(1, origin, OriginLimit{CallCount: 5})
+	require.Equal(t, int64(2), limitOf(1, origin, callBudget))
+	require.Equal(t, int64(5), limitOf(2, origin, callBudget))
+	require.NoError(t, sendTx(2, origin))
+
+	// The limits of an entry with its own window are scaled to the session, and entries can limit
+	// the size of txs even if the size of txs isn't limited for other origins.
+	setLimit(2, origin, OriginLimit{CallCount: 1, TxBytes: 1, Window: sessionDuration / 10})
+	require.Equal(t, int64(10), limitOf(3, origin, callBudget))
+	require.Equal(t, int64(10), limitOf(3, origin, bytesBudget))
+	err := sendTx(3, origin)
+	costErr, ok := err.(*TxCostExceedsLimitError)
+	require.True(t, ok, "expected a tx cost error, got %v", err)
+	require.Equal(t, "bytes", costErr.Budget)
+
+	// An entry can lift the limits of an origin entirely.
+	setLimit(3, origin, OriginLimit{CallCount: Unlimited, TxBytes: Unlimited})
+	require.Equal(t, Unlimited, limitOf(4, origin, callBudget))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sendTx(4, origin))
+	}
+
+	// Exempt origins aren't throttled no matter what the table says.
+	setLimit(4, addr1, OriginLimit{CallCount: 1})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx(5, addr1))
+	}
+
+	// Malformed entries are logged & ignored.
+	setEntry(5, origin, []byte("not json"))
+	require.Equal(t, int64(2), limitOf(6, origin, callBudget))
+	require.Equal(t, 1, logger.count("error"))
+	setLimit(6, origin, OriginLimit{Window: 60})
+	require.Equal(t, int64(2), limitOf(7, origin, callBudget))
+	require.Equal(t, 2, logger.count("error"))
+}
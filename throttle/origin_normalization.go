@@ -0,0 +1,85 @@
+package throttle
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+	"github.com/pkg/errors"
+)
+
+// ParseOrigin parses an origin address given by a client or an operator, e.g. to query its quota.
+// The hex digits of the local address may be in any case, and an address without a chain ID (just
+// the 0x prefixed local address) is assumed to be on the chain with the given ID, so every form of
+// the same address parses to the same origin.
+func ParseOrigin(s string, defaultChainID string) (loom.Address, error) {
+	s = strings.TrimSpace(s)
+	chainID := defaultChainID
+	local := s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		chainID, local = s[:i], s[i+1:]
+	}
+	if chainID == "" {
+		return loom.Address{}, errors.Errorf("origin %s has no chain ID", s)
+	}
+	localAddr, err := loom.LocalAddressFromHexString(strings.ToLower(local))
+	if err != nil {
+		return loom.Address{}, errors.Wrapf(err, "invalid origin %s", s)
+	}
+	return loom.Address{ChainID: chainID, Local: localAddr}, nil
+}
+
+// Returns the canonical form of the given origin, an origin without a chain ID is on the chain of the
+// given state. Origins are normalized before they're checked against the exempt origins or keyed, so
+// the same account can't get a separate budget by omitting its chain ID.
+func normalizeOrigin(state loomchain.ReadOnlyState, origin loom.Address) loom.Address {
+	if origin.ChainID == "" && state != nil {
+		origin.ChainID = state.Block().ChainID
+	}
+	return origin
+}
+
+// Caches the string form of origins, which the throttle keys its records by, since formatting a
+// loom.Address allocates and the string of an origin is needed several times per tx.
+type originStrings struct {
+	// Keyed by chain ID, then by local address, guarded by mtx.
+	byChain map[string]map[string]string
+	size    int
+	mtx     sync.RWMutex
+}
+
+// Returns origin.String(), formatting it only the first time the origin is seen.
+func (c *originStrings) get(origin loom.Address) string {
+	c.mtx.RLock()
+	// Indexing a map with a converted byte slice doesn't allocate.
+	s, ok := c.byChain[origin.ChainID][string(origin.Local)]
+	c.mtx.RUnlock()
+	if ok {
+		return s
+	}
+	s = origin.String()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	// Origins that are no longer active are forgotten once there are too many.
+	if c.byChain == nil || c.size >= DefaultMaxTrackedOrigins {
+		c.byChain = make(map[string]map[string]string)
+		c.size = 0
+	}
+	locals, ok := c.byChain[origin.ChainID]
+	if !ok {
+		locals = make(map[string]string)
+		c.byChain[origin.ChainID] = locals
+	}
+	if _, ok := locals[string(origin.Local)]; !ok {
+		locals[string(origin.Local)] = s
+		c.size++
+	}
+	return s
+}
+
+// Returns the string the given origin is keyed by, see originStrings.
+func (t *Throttle) originString(origin loom.Address) string {
+	return t.originStrings.get(origin)
+}
@@ -0,0 +1,136 @@
+// +build evm
+
+package throttle
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/loomnetwork/go-loom"
+	amtypes "github.com/loomnetwork/go-loom/builtin/types/address_mapper"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	"github.com/loomnetwork/go-loom/common/evmcompat"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/address_mapper"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestParseOrigin(t *testing.T) {
+	hex := origin.Local.String()
+	upper := "0x" + strings.ToUpper(hex[2:])
+
+	for _, s := range []string{
+		origin.String(),
+		origin.ChainID + ":" + upper,
+		hex,
+		upper,
+		" " + hex + " ",
+	} {
+		addr, err := ParseOrigin(s, origin.ChainID)
+		require.NoError(t, err, s)
+		require.Equal(t, origin.String(), addr.String(), s)
+	}
+
+	// An explicit chain ID takes precedence over the default one.
+	addr, err := ParseOrigin("eth:"+upper, origin.ChainID)
+	require.NoError(t, err)
+	require.Equal(t, "eth", addr.ChainID)
+	require.Equal(t, 0, addr.Local.Compare(origin.Local))
+
+	_, err = ParseOrigin(hex, "")
+	require.Error(t, err)
+	_, err = ParseOrigin(":"+hex, origin.ChainID)
+	require.Error(t, err)
+	_, err = ParseOrigin(origin.ChainID+":0xnothex", origin.ChainID)
+	require.Error(t, err)
+}
+
+// Every form of the same origin is counted against one budget, which the quota query & the admin
+// reset address by any of those forms.
+func TestNormalizedOriginsShareBudget(t *testing.T) {
+	fakeCtx := goloomplugin.CreateFakeContext(origin, origin)
+	amCtx := contractpb.WrapPluginContext(fakeCtx.WithAddress(fakeCtx.CreateContract(address_mapper.Contract)))
+	createAddressMapperCtx := func(state loomchain.State) (contractpb.StaticContext, error) {
+		return amCtx, nil
+	}
+	_, createKarmaContractCtx := newKarmaContractCtx(t, fakeCtx, &ktypes.KarmaInitRequest{Sources: sources})
+
+	// The origin is mapped to an eth account.
+	ethKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	ethLocal, err := loom.LocalAddressFromHexString(crypto.PubkeyToAddress(ethKey.PublicKey).Hex())
+	require.NoError(t, err)
+	ethOrigin := loom.Address{ChainID: "eth", Local: ethLocal}
+	sig, err := address_mapper.SignIdentityMapping(origin, ethOrigin, ethKey, evmcompat.SignatureType_EIP712)
+	require.NoError(t, err)
+	am := &address_mapper.AddressMapper{}
+	require.NoError(t, am.AddIdentityMapping(amCtx, &amtypes.AddressMapperAddIdentityMappingRequest{
+		From:      origin.MarshalPB(),
+		To:        ethOrigin.MarshalPB(),
+		Signature: sig,
+	}))
+
+	now := time.Unix(1500000000, 0)
+	memStore := store.NewMemStore()
+	stateNow := func() loomchain.State {
+		return loomchain.NewStoreState(nil, memStore, abci.Header{ChainID: origin.ChainID, Height: 1}, nil, nil)
+	}
+	admin := NewAdmin()
+	admin.SetStateProvider(stateNow)
+	tmx := GetKarmaMiddleWare(
+		true, 4, sessionDuration, 0, 0, StaticLimitResolver(4), createKarmaContractCtx,
+		WithThrottleKey([]KeyDimension{KeyMappedAccount, KeyChainID, KeyAddress}, createAddressMapperCtx),
+		WithAdmin(admin), WithClock(ClockFunc(func() time.Time { return now })),
+	)
+	nonce := uint64(0)
+	sendTx := func(from loom.Address) error {
+		nonce++
+		state := stateNow()
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+		)
+	}
+	used := func(addr loom.Address) int64 {
+		quota, err := admin.Quota(stateNow(), addr)
+		require.NoError(t, err)
+		return quota.Budgets[callBudget].Used
+	}
+
+	unprefixed := loom.Address{Local: origin.Local}
+	upperCase, err := ParseOrigin("0x"+strings.ToUpper(origin.Local.String()[2:]), origin.ChainID)
+	require.NoError(t, err)
+
+	require.NoError(t, sendTx(origin))
+	require.NoError(t, sendTx(unprefixed))
+	require.NoError(t, sendTx(upperCase))
+	require.NoError(t, sendTx(ethOrigin))
+	_, ok := sendTx(unprefixed).(*TxLimitReachedError)
+	require.True(t, ok)
+	for _, addr := range []loom.Address{origin, unprefixed, upperCase, ethOrigin} {
+		require.Equal(t, int64(4), used(addr), addr.String())
+	}
+
+	// Resetting the eth account given without its chain ID resets nothing, since it's a different
+	// address on this chain...
+	result, err := admin.UnsafeResetOrigin(ethLocal.String())
+	require.NoError(t, err)
+	require.False(t, result.Reset)
+	require.Equal(t, int64(4), used(origin))
+	// ...but resetting the mapped eth account resets the budget it shares with the origin.
+	result, err = admin.UnsafeResetOrigin("eth:0x" + strings.ToUpper(ethLocal.String()[2:]))
+	require.NoError(t, err)
+	require.True(t, result.Reset)
+	for _, addr := range []loom.Address{origin, unprefixed, ethOrigin} {
+		require.Equal(t, int64(0), used(addr), addr.String())
+	}
+	require.NoError(t, sendTx(unprefixed))
+	require.Equal(t, int64(1), used(origin))
+}
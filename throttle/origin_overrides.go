@@ -0,0 +1,110 @@
+package throttle
+
+import (
+	"math"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/config/genesis"
+	"github.com/pkg/errors"
+)
+
+// OriginOverride sets the throttle policy of a single origin, overrides are usually loaded from the
+// genesis file so every validator starts with the same policy for privileged accounts.
+type OriginOverride = genesis.ThrottleOverride
+
+// ValidateOriginOverrides returns an error naming the offending entry if any of the given overrides
+// is malformed, or if there's more than one override for the same origin.
+func ValidateOriginOverrides(overrides []OriginOverride) error {
+	seen := make(map[string]int, len(overrides))
+	for i, override := range overrides {
+		addr, err := loom.ParseAddress(override.Address)
+		if err != nil {
+			return errors.Wrapf(err, "OriginOverrides[%d] %s is not a valid address", i, override.Address)
+		}
+		if j, ok := seen[addr.String()]; ok {
+			return errors.Errorf("OriginOverrides[%d] %s duplicates OriginOverrides[%d]", i, override.Address, j)
+		}
+		seen[addr.String()] = i
+		if override.Exempt {
+			if override.Limit != 0 || override.Window != 0 {
+				return errors.Errorf("OriginOverrides[%d] %s is exempt so it must not set a limit or window", i, override.Address)
+			}
+			continue
+		}
+		if override.Limit <= 0 {
+			return errors.Errorf("OriginOverrides[%d] %s limit %d must be positive", i, override.Address, override.Limit)
+		}
+		if override.Window < 0 {
+			return errors.Errorf("OriginOverrides[%d] %s window %d must not be negative", i, override.Address, override.Window)
+		}
+	}
+	return nil
+}
+
+// WithOriginOverrides makes the middleware apply the given overrides to their origins, which must be
+// valid (see ValidateOriginOverrides). The overrides are immutable, the call limit of an overridden
+// origin takes precedence over the limits that apply to all origins, whether they're static or
+// on-chain, and the exempt origins in the on-chain params are exempted in addition to the overridden
+// ones.
+func WithOriginOverrides(overrides ...OriginOverride) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.originOverrides = make(map[string]OriginOverride, len(overrides))
+		for _, override := range overrides {
+			th.originOverrides[loom.MustParseAddress(override.Address).String()] = override
+		}
+	}
+}
+
+// Returns true if the given origin is exempted by its override.
+func (t *Throttle) isOverrideExempt(origin loom.Address) bool {
+	if len(t.originOverrides) == 0 {
+		return false
+	}
+	override, ok := t.originOverrides[t.originString(origin)]
+	return ok && override.Exempt
+}
+
+// Returns the call limit set by the override of the given origin, false if there isn't one.
+func (t *Throttle) overrideLimit(origin loom.Address) (int64, bool) {
+	if len(t.originOverrides) == 0 {
+		return 0, false
+	}
+	override, ok := t.originOverrides[t.originString(origin)]
+	if !ok || override.Exempt {
+		return 0, false
+	}
+	return t.scaleLimit(override.Limit, override.Window), true
+}
+
+// Scales the given limit per window seconds to the length of the call session, since all origins
+// share the same call sessions, e.g. a limit of 10 per 60 seconds becomes a limit of 100 per 600
+// second session. A zero window is the length of the call session.
+func (t *Throttle) scaleLimit(limit int64, window int64) int64 {
+	session := t.budgetSessionDuration(callBudget)
+	if window == 0 || window == session || session <= 0 || t.sessionMode == BlockSessions {
+		return limit
+	}
+	if limit > math.MaxInt64/session {
+		return math.MaxInt64
+	}
+	scaled := limit * session / window
+	if scaled < 1 {
+		scaled = 1
+	}
+	return scaled
+}
+
+// Resolves the call limit of origins that have an override from the override, and the limits of
+// other origins with the wrapped resolver.
+type overrideLimitResolver struct {
+	throttle *Throttle
+	next     LimitResolver
+}
+
+func (r *overrideLimitResolver) ResolveLimit(state loomchain.State, origin loom.Address) (int64, error) {
+	if limit, ok := r.throttle.overrideLimit(origin); ok {
+		return limit, nil
+	}
+	return r.next.ResolveLimit(state, origin)
+}
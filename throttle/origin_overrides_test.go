@@ -0,0 +1,91 @@
+// +build evm
+
+package throttle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/config/genesis"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestOriginOverridesFromGenesis(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/genesis.json")
+	require.NoError(t, err)
+	var gen genesis.Genesis
+	require.NoError(t, json.Unmarshal(data, &gen))
+	require.NotNil(t, gen.Throttle)
+
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	now := time.Unix(1500000000, 0)
+	cfg := DefaultThrottleConfig()
+	cfg.MaxCallCount = 3
+	cfg.SessionDuration = sessionDuration
+	cfg.OnChainParams = true
+	cfg.CallLimits = StaticLimitResolver(3)
+	cfg.Clock = ClockFunc(func() time.Time { return now })
+	cfg.OriginOverrides = gen.Throttle.Overrides
+	tmx, err := GetKarmaMiddleWareWithConfig(true, cfg, createKarmaContractCtx)
+	require.NoError(t, err)
+
+	memStore := store.NewMemStore()
+	other := loom.MustParseAddress("chain:0x5cecd1f7261e1f4c684e297be3edf03b825e01c5")
+	nonces := map[string]uint64{}
+	processTx := func(height int64, from loom.Address, isCheckTx bool) error {
+		nonces[from.String()]++
+		state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: height}, nil, nil)
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonces[from.String()], types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, isCheckTx,
+		)
+	}
+	// With the memory session store txs are only counted in CheckTx by default.
+	sendTx := func(height int64, from loom.Address) error {
+		return processTx(height, from, true)
+	}
+
+	// A limit of 1 tx per 60 seconds is scaled to 10 txs per 600 second session.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sendTx(1, origin))
+	}
+	require.Error(t, sendTx(1, origin))
+	// Exempt origins aren't throttled at all.
+	for i := 0; i < 20; i++ {
+		require.NoError(t, sendTx(1, addr1))
+	}
+	// Other origins get the static limit.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx(1, other))
+	}
+	require.Error(t, sendTx(1, other))
+
+	// On-chain params change the limits of other origins, the overrides still apply.
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1}, nil, nil)
+	require.NoError(t, SetOnChainParams(state, &OnChainParams{
+		MaxCallCount: 100, SessionDuration: sessionDuration, ExemptOrigins: []string{other.String()},
+	}))
+	// The on-chain params are reloaded in DeliverTx once per block.
+	require.NoError(t, processTx(2, addr1, false))
+	require.Error(t, sendTx(2, origin))
+	require.NoError(t, sendTx(2, addr1))
+	require.NoError(t, sendTx(2, other))
+
+	// Nodes refuse to start with malformed overrides.
+	cfg.OriginOverrides = append(cfg.OriginOverrides, OriginOverride{Address: origin.String(), Exempt: true})
+	_, err = GetKarmaMiddleWareWithConfig(true, cfg, createKarmaContractCtx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "OriginOverrides[2]")
+}
@@ -0,0 +1,118 @@
+package throttle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+)
+
+// Determines when an origin that keeps sending txs after being throttled is put into a cooldown.
+type penaltyPolicy struct {
+	// Number of rejected txs within a call session that puts the origin into a cooldown.
+	threshold int64
+	// Length of the first cooldown, doubled by every tx the origin sends during the cooldown.
+	cooldown time.Duration
+	// Max length of a cooldown.
+	maxCooldown time.Duration
+}
+
+// Tracks the txs of an origin rejected by the throttle.
+type penaltyState struct {
+	// Number of txs rejected since rejectionsStart.
+	rejections      int64
+	rejectionsStart time.Time
+	// When the current cooldown ends, the zero time if the origin isn't in a cooldown.
+	cooldownEnds time.Time
+	// Length of the current cooldown.
+	cooldown time.Duration
+}
+
+// OriginCooldownError is returned for every tx an origin sends while it's in a cooldown, the
+// message starts with TxLimitReachedErrorPrefix.
+type OriginCooldownError struct {
+	Origin loom.Address
+	// Length of the cooldown, extended by every tx sent during the cooldown.
+	Cooldown time.Duration
+	// Unix timestamp (in seconds) at which the cooldown ends.
+	RetryAfter int64
+	// How long the origin has to wait until RetryAfter, as of the rejected tx.
+	RetryIn time.Duration
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func (e *OriginCooldownError) Error() string {
+	return withHelp(fmt.Sprintf(
+		"%s: origin %s is in a %v cooldown for sending too many txs over its limit, %s",
+		TxLimitReachedErrorPrefix, e.Origin, e.Cooldown, retryIn(e.RetryIn, e.RetryAfter),
+	), e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *OriginCooldownError) ABCICode() uint32 {
+	return OriginCooldownCode
+}
+
+// Returns an OriginCooldownError if the given origin is in a cooldown, in which case the cooldown is
+// extended. Only does a map lookup so rejecting txs from an origin in a cooldown is cheap.
+func (t *Throttle) checkCooldown(origin loom.Address) error {
+	if !t.penaltyEnabled() {
+		return nil
+	}
+	now := t.clock.Now()
+
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	session, ok := t.sessions[origin.String()]
+	if !ok || !now.Before(session.penalty.cooldownEnds) {
+		return nil
+	}
+	p := &session.penalty
+	p.cooldown *= 2
+	if p.cooldown > t.penalty.maxCooldown {
+		p.cooldown = t.penalty.maxCooldown
+	}
+	p.cooldownEnds = now.Add(p.cooldown)
+	t.metrics.txThrottled(callBudget, origin.String())
+	return &OriginCooldownError{
+		Origin:     origin,
+		Cooldown:   p.cooldown,
+		RetryAfter: roundUpUnix(p.cooldownEnds),
+		RetryIn:    p.cooldown,
+	}
+}
+
+// Penalties are only applied to session records kept in memory, since changes to the app state made
+// while processing a rejected tx are discarded.
+func (t *Throttle) penaltyEnabled() bool {
+	return t.penalty != nil && t.sessionMode != BlockSessions && t.sessionStore == MemorySessionStore
+}
+
+// Records a tx from the given origin rejected by the throttle, and puts the origin into a cooldown
+// if it has sent too many rejected txs during the current call session.
+func (t *Throttle) recordRejection(origin loom.Address) {
+	now := t.clock.Now()
+
+	t.sessionsMtx.Lock()
+	session := t.getSession(origin.String(), now)
+	p := &session.penalty
+	if now.Sub(p.rejectionsStart) >= t.sessionPeriod(callBudget) {
+		p.rejections = 0
+		p.rejectionsStart = now
+	}
+	p.rejections++
+	startCooldown := p.rejections >= t.penalty.threshold
+	if startCooldown {
+		p.rejections = 0
+		p.cooldown = t.penalty.cooldown
+		p.cooldownEnds = now.Add(p.cooldown)
+	}
+	t.sessionsMtx.Unlock()
+
+	if startCooldown {
+		t.logger.Info("Origin put into throttle cooldown", "origin", origin.String(), "cooldown", t.penalty.cooldown)
+		t.auditCooldownStarted(t.originString(origin), PenaltyCooldownPolicy, t.penalty.cooldown, now.Add(t.penalty.cooldown))
+	}
+}
@@ -0,0 +1,95 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestThrottlePenalty(t *testing.T) {
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	const session = 60
+	now := time.Unix(1500000000, 0)
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 3, session, 0, 0, StaticLimitResolver(3), createKarmaContractCtx,
+		WithPenalty(3, 10*time.Second, 40*time.Second), WithAdmin(admin),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func() error {
+		nonce++
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+		_, err := throttleMiddlewareHandler(tmx, state, txSigned, ctx)
+		return err
+	}
+	cooldownOf := func(err error) time.Duration {
+		cooldownErr, ok := err.(*OriginCooldownError)
+		require.True(t, ok, "expected a cooldown error, got %v", err)
+		return cooldownErr.Cooldown
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx())
+	}
+	// The origin is put into a cooldown once 3 txs over its limit have been rejected.
+	for i := 0; i < 3; i++ {
+		_, ok := sendTx().(*TxLimitReachedError)
+		require.True(t, ok)
+	}
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, now.Unix()+10, quota.CooldownEnds)
+
+	// Every tx sent during the cooldown doubles its length, up to the max.
+	now = now.Add(5 * time.Second)
+	require.Equal(t, 20*time.Second, cooldownOf(sendTx()))
+	now = now.Add(19 * time.Second)
+	require.Equal(t, 40*time.Second, cooldownOf(sendTx()))
+	now = now.Add(39 * time.Second)
+	require.Equal(t, 40*time.Second, cooldownOf(sendTx()))
+
+	// Once the bot stops the cooldown expires, and the origin can send txs again once its session has
+	// ended.
+	now = now.Add(41 * time.Second)
+	quota, err = admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), quota.CooldownEnds)
+	require.NoError(t, sendTx())
+
+	// Rejected txs only put the origin into a cooldown if they're sent within a single call session.
+	require.NoError(t, sendTx())
+	require.NoError(t, sendTx())
+	_, ok := sendTx().(*TxLimitReachedError)
+	require.True(t, ok)
+	now = now.Add(session * time.Second)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx())
+	}
+	_, ok = sendTx().(*TxLimitReachedError)
+	require.True(t, ok)
+	_, ok = sendTx().(*TxLimitReachedError)
+	require.True(t, ok)
+	now = now.Add(session * time.Second)
+	require.NoError(t, sendTx())
+}
@@ -0,0 +1,114 @@
+package throttle
+
+import (
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+)
+
+// PressurePolicy determines how new origins are treated once the throttle keeps session records in
+// memory for as many origins as it can (see WithMaxTrackedOrigins).
+type PressurePolicy string
+
+const (
+	// The record of the least recently active origin is evicted to make room for the new origin.
+	PressureEvict PressurePolicy = "evict"
+	// The new origin is admitted without a record of its own, all such origins share a single record
+	// with a reduced call limit until room is made by origins going idle. Origins that already have
+	// a record keep it.
+	PressureReduce PressurePolicy = "reduce"
+)
+
+func (p PressurePolicy) IsValid() bool {
+	return p == PressureEvict || p == PressureReduce
+}
+
+// The origins admitted under pressure are all tracked under this key.
+var (
+	pressureKey        = loom.Address{ChainID: "throttle-pressure", Local: make(loom.LocalAddress, 20)}
+	pressureSessionKey = pressureKey.String()
+)
+
+// Determines how new origins are treated once the memory session store is saturated.
+type pressurePolicy struct {
+	policy PressurePolicy
+	// Call & deploy limit shared by all the origins admitted under pressure.
+	callCount int64
+	// When the saturation of the store was last logged, guarded by Throttle.sessionsMtx.
+	lastAlert time.Time
+}
+
+// WithPressurePolicy makes the middleware treat new origins according to the given policy once it
+// keeps session records in memory for as many origins as it can, and log a warning (at most once a
+// call session) while that's the case. callCount is the call & deploy limit shared by all the origins
+// admitted under pressure when the policy is PressureReduce. The policy doesn't apply to records kept
+// in the app state, which are only discarded once the origin is idle.
+func WithPressurePolicy(policy PressurePolicy, callCount int64) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.pressure = &pressurePolicy{policy: policy, callCount: callCount}
+	}
+}
+
+// Returns the key the txs of the origin tracked under the given key should be counted under, and true
+// if the origin is admitted under pressure, in which case its limits are given by pressureLimit.
+func (t *Throttle) admitKey(key loom.Address) (loom.Address, bool) {
+	if t.pressure == nil || t.pressure.policy != PressureReduce ||
+		t.sessionMode == BlockSessions || t.sessionStore != MemorySessionStore {
+		return key, false
+	}
+	t.sessionsMtx.RLock()
+	_, tracked := t.sessions[key.String()]
+	saturated := t.trackedOrigins() >= t.maxTrackedOrigins
+	t.sessionsMtx.RUnlock()
+	if tracked || !saturated {
+		return key, false
+	}
+
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	// Sweeping the records of idle origins may make room for the origin.
+	now := t.clock.Now()
+	if now.Sub(t.lastSweep) >= t.sweepInterval() {
+		t.sweepSessions(now)
+	}
+	if t.trackedOrigins() < t.maxTrackedOrigins {
+		return key, false
+	}
+	t.storeSaturated(now)
+	return pressureKey, true
+}
+
+// Returns the number of origins the throttle keeps session records for in memory, excluding the
+// record shared by the origins admitted under pressure.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) trackedOrigins() int {
+	if _, ok := t.sessions[pressureSessionKey]; ok {
+		return len(t.sessions) - 1
+	}
+	return len(t.sessions)
+}
+
+// Returns the limit that applies to an origin admitted under pressure instead of the given limit.
+func (t *Throttle) pressureLimit(limit int64) int64 {
+	if isUnlimited(limit) || t.pressure.callCount < limit {
+		return t.pressure.callCount
+	}
+	return limit
+}
+
+// Raises an alert that the memory session store is saturated, the warning is logged at most once a
+// call session.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) storeSaturated(now time.Time) {
+	t.metrics.storeSaturated(true)
+	if t.pressure == nil || now.Sub(t.pressure.lastAlert) < t.sweepInterval() {
+		return
+	}
+	t.pressure.lastAlert = now
+	t.logger.Error(
+		"Throttle session store saturated",
+		"tracked_origins", len(t.sessions), "max_tracked_origins", t.maxTrackedOrigins,
+		"policy", t.pressure.policy,
+	)
+}
@@ -0,0 +1,113 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/generic"
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// Simulates a sybil attack where fresh origins arrive faster than their sessions end.
+func TestPressureEvictionLoad(t *testing.T) {
+	const maxOrigins = 1000
+	const numOrigins = 200000
+	evicted := recordingCounter{newRecordingMetric()}
+	saturated := generic.NewGauge("session_store_saturated")
+	logger := &recordingLogger{}
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithMaxTrackedOrigins(maxOrigins)(th)
+	WithPressurePolicy(PressureEvict, 0)(th)
+	WithLogger(logger)(th)
+	th.metrics = NopMetrics()
+	th.metrics.OriginsEvicted = evicted
+	th.metrics.SessionStoreSaturated = saturated
+	now := time.Unix(1500000000, 0)
+
+	// An origin that keeps sending txs is never the least recently active one, so its record survives.
+	for i := 1; i <= numOrigins; i++ {
+		th.countTx(callBudget, fmt.Sprintf("chain:0x%040x", i), 1, 1, 1, maxCallCount, now)
+		th.countTx(callBudget, origin.String(), uint64(i), 1, 1, Unlimited, now)
+		require.True(t, len(th.sessions) <= maxOrigins)
+		require.Equal(t, len(th.sessions), th.activity.Len())
+	}
+	require.Equal(t, int64(numOrigins), th.sessions[origin.String()].budgets[callBudget].accessCount)
+	require.Equal(t, float64(numOrigins+1-maxOrigins), evicted.sum("reason", "pressure"))
+	require.Equal(t, 1.0, saturated.Value())
+	// The alert is only logged once a session.
+	require.Equal(t, 1, logger.count("error"))
+
+	// Once the attack stops the records are swept, which clears the alert.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	th.countTx(callBudget, addr1.String(), 1, 1, 1, maxCallCount, now)
+	require.Len(t, th.sessions, 1)
+	require.Equal(t, 1, th.activity.Len())
+	require.Equal(t, 0.0, saturated.Value())
+}
+
+func TestPressureReduce(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	const maxOrigins = 3
+	var th *Throttle
+	logger := &recordingLogger{}
+	now := time.Unix(1500000000, 0)
+	tmx := GetKarmaMiddleWare(
+		true, 5, sessionDuration, 0, 0, StaticLimitResolver(5), createKarmaContractCtx,
+		WithMaxTrackedOrigins(maxOrigins), WithPressurePolicy(PressureReduce, 2), WithLogger(logger),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		func(t *Throttle) { th = t },
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func(from loom.Address) error {
+		nonce++
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, from)
+		_, err := throttleMiddlewareHandler(tmx, state, txSigned, ctx)
+		return err
+	}
+	originN := func(i int) loom.Address {
+		return loom.MustParseAddress(fmt.Sprintf("chain:0x%040x", i))
+	}
+
+	for i := 1; i <= maxOrigins; i++ {
+		require.NoError(t, sendTx(originN(i)))
+	}
+	require.Equal(t, 0, logger.count("error"))
+
+	// Once the store is full new origins share a single record with a reduced limit...
+	require.NoError(t, sendTx(originN(10)))
+	require.Len(t, th.sessions, maxOrigins+1)
+	require.NotNil(t, th.sessions[pressureKey.String()])
+	require.NoError(t, sendTx(originN(11)))
+	_, ok := sendTx(originN(12)).(*TxLimitReachedError)
+	require.True(t, ok)
+	require.Equal(t, 1, logger.count("error"))
+
+	// ...while the origins that already have a record keep their own limit.
+	for i := 0; i < 4; i++ {
+		require.NoError(t, sendTx(originN(1)))
+	}
+	require.Len(t, th.sessions, maxOrigins+1)
+
+	// Origins get their own records again once room is made.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	require.NoError(t, sendTx(originN(12)))
+	require.NotNil(t, th.sessions[originN(12).String()])
+}
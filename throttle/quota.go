@@ -0,0 +1,189 @@
+package throttle
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+)
+
+// BudgetQuota describes how much of one of the tx budgets of an origin is left in the current
+// session.
+type BudgetQuota struct {
+	// call | deploy limit the number of txs, bytes limits their total size, daily_deploy limits the
+	// number of deploy txs per day
+	Budget string `json:"budget"`
+	// Max total cost (or size) of the txs the origin can send per session, Unlimited if there's no
+	// limit.
+	Limit int64 `json:"limit"`
+	// Total cost (or size) of the txs counted against the budget during the current session, in leaky
+	// bucket mode the cost of the txs still in the bucket, rounded up.
+	Used int64 `json:"used"`
+	// How much of the limit (the sustained budget) is left, Unlimited if there's no limit.
+	Remaining int64 `json:"remaining"`
+	// Unix timestamp (in seconds) at which the current session ends, zero if the origin has no
+	// session in progress or sessions are measured in blocks. In leaky bucket mode the time at which
+	// the bucket will be empty.
+	WindowEnds int64 `json:"window_ends"`
+	// Height of the block at which the current session ends, zero if sessions are measured in
+	// seconds.
+	WindowEndsHeight int64 `json:"window_ends_height"`
+	// Number of txs that leak out of the bucket per second, zero unless the budget is a leaky bucket.
+	LeakRate float64 `json:"leak_rate,omitempty"`
+	// Max total cost of the txs the origin can send in a session while drawing on its burst credit,
+	// zero if the budget has no burst.
+	BurstLimit int64 `json:"burst_limit,omitempty"`
+	// How much of the burst ceiling is left, zero while the burst credit is recovering.
+	BurstRemaining int64 `json:"burst_remaining,omitempty"`
+	// Unix timestamp (in seconds) from which the burst credit can be drawn on again, zero if it's
+	// available.
+	BurstAvailableAt int64 `json:"burst_available_at,omitempty"`
+}
+
+// OriginQuota describes how much of each of its tx budgets an origin has left.
+type OriginQuota struct {
+	Origin string `json:"origin"`
+	// How txs are grouped into sessions: fixed | sliding | leaky | block
+	Algorithm string `json:"algorithm"`
+	// Where session records are kept: memory | state
+	Store string `json:"store"`
+	// True if the quota only reflects the txs seen by the node that answered the query, since the
+	// session records are kept in the memory of each node.
+	LocalView bool `json:"local_view"`
+	// True if the origin isn't throttled at all, in which case Budgets is empty.
+	Exempt bool `json:"exempt"`
+	// Unix timestamp (in seconds) at which the cooldown the origin is in ends, zero if it isn't in a
+	// cooldown.
+	CooldownEnds int64         `json:"cooldown_ends"`
+	Budgets      []BudgetQuota `json:"budgets"`
+}
+
+// Returns the quota of the given origin as of the given state, without counting anything against
+// its budgets.
+func (t *Throttle) quota(state loomchain.State, origin loom.Address) (*OriginQuota, error) {
+	origin = normalizeOrigin(state, origin)
+	quota := &OriginQuota{
+		Origin:    origin.String(),
+		Algorithm: string(t.windowMode),
+		Store:     string(t.sessionStore),
+		LocalView: t.sessionMode != BlockSessions && t.sessionStore == MemorySessionStore,
+	}
+	if t.sessionMode == BlockSessions {
+		quota.Algorithm = string(BlockSessions)
+		quota.Store = string(StateSessionStore)
+	}
+	if t.isExempt(origin) || t.isValidatorExempt(state, origin) {
+		quota.Exempt = true
+		return quota, nil
+	}
+
+	callLimits := t.callLimits
+	if callLimits == nil {
+		callLimits = StaticLimitResolver(t.currentParams().maxCallCount)
+	}
+	callLimit, err := callLimits.ResolveLimit(state, origin)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.throttleKey(state, origin)
+	if err != nil {
+		return nil, err
+	}
+	if t.penaltyEnabled() || t.failureCooldownEnabled() {
+		now := t.clock.Now()
+		t.sessionsMtx.Lock()
+		if session, ok := t.sessions[key.String()]; ok && now.Before(session.cooldownEnds()) {
+			quota.CooldownEnds = roundUpUnix(session.cooldownEnds())
+		}
+		t.sessionsMtx.Unlock()
+	}
+	limits := [numBudgets]int64{
+		callBudget:   callLimit,
+		deployBudget: t.currentParams().maxDeployCount,
+		bytesBudget:  t.originTxBytesLimit(state, origin),
+	}
+	for budget := txBudget(0); budget < numBudgets; budget++ {
+		quota.Budgets = append(quota.Budgets, t.budgetQuota(state, budget, key, limits[budget]))
+	}
+	if !isUnlimited(t.maxDailyDeployCount) {
+		quota.Budgets = append(quota.Budgets, t.dailyDeployQuota(state, key))
+	}
+	return quota, nil
+}
+
+func (t *Throttle) budgetQuota(state loomchain.State, budget txBudget, origin loom.Address, limit int64) BudgetQuota {
+	quota := BudgetQuota{Budget: budget.String(), Limit: limit}
+	if isUnlimited(limit) {
+		quota.Limit = Unlimited
+		quota.Remaining = Unlimited
+		return quota
+	}
+
+	if t.sessionMode == BlockSessions {
+		blocks := t.budgetSessionBlocks(budget)
+		session := state.Block().Height / blocks
+		quota.Used = blockSessionCount(state.Get(blockSessionKey(budget, origin)), session)
+		quota.WindowEndsHeight = (session + 1) * blocks
+	} else {
+		now := t.store.Now(state)
+		window := t.window(budget)
+		usage := t.store.Get(state, origin, window, now)
+		quota.Used = usage.total(window, now)
+		if window.Mode == LeakyBucket {
+			quota.LeakRate = float64(time.Second) / float64(window.Duration)
+			if usage.Count > 0 {
+				quota.WindowEnds = roundUpUnix(usage.retryAt(window, 0, 0))
+			}
+		} else if usage.Count > 0 || usage.PrevCount > 0 {
+			quota.WindowEnds = roundUpUnix(usage.Start.Add(window.Duration))
+		}
+		if ceiling := t.burstCeiling(budget, limit); ceiling > limit {
+			quota.BurstLimit = ceiling
+			// Bursts are only supported by the memory session store.
+			record := &originSession{}
+			t.sessionsMtx.RLock()
+			if r, ok := t.sessions[origin.String()]; ok {
+				record.burstDrawn = r.burstDrawn
+			}
+			t.sessionsMtx.RUnlock()
+			record.budgets[budget].start = usage.Start
+			if t.burstAvailable(record, now) {
+				quota.BurstRemaining = ceiling - quota.Used
+				if quota.BurstRemaining < 0 {
+					quota.BurstRemaining = 0
+				}
+			} else {
+				quota.BurstAvailableAt = roundUpUnix(record.burstDrawn.Add(t.burstRecovery()))
+			}
+		}
+	}
+
+	// The burst credit lets the origin go over its limit.
+	if ceiling := t.burstCeiling(budget, limit); quota.Used > ceiling {
+		quota.Used = ceiling
+	}
+	quota.Remaining = limit - quota.Used
+	if quota.Remaining < 0 {
+		quota.Remaining = 0
+	}
+	return quota
+}
+
+// Returns the count stored in the given block session record if it was stored during the given
+// session, otherwise zero.
+func blockSessionCount(data []byte, session int64) int64 {
+	if len(data) == 16 && int64(binary.BigEndian.Uint64(data[:8])) == session {
+		return int64(binary.BigEndian.Uint64(data[8:]))
+	}
+	return 0
+}
+
+// Returns the given time as a unix timestamp in seconds, rounded up.
+func roundUpUnix(t time.Time) int64 {
+	ts := t.Unix()
+	if t.After(time.Unix(ts, 0)) {
+		ts++
+	}
+	return ts
+}
@@ -0,0 +1,129 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestAdminQuota(t *testing.T) {
+	admin := NewAdmin()
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	_, err := admin.Quota(state, origin)
+	require.Equal(t, ErrThrottleNotEnabled, err)
+
+	now := time.Unix(1500000000, 0)
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithClock(ClockFunc(func() time.Time { return now }))(th)
+	WithExemptOrigins(contract)(th)
+	WithAdmin(admin)(th)
+	callTxID := uint32(types.TxID_CALL)
+
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, &OriginQuota{
+		Origin:    origin.String(),
+		Algorithm: "fixed",
+		Store:     "memory",
+		LocalView: true,
+		Budgets: []BudgetQuota{
+			{Budget: "call", Limit: maxCallCount, Remaining: maxCallCount},
+			{Budget: "deploy", Limit: Unlimited, Remaining: Unlimited},
+			{Budget: "bytes", Limit: Unlimited, Remaining: Unlimited},
+		},
+	}, quota)
+
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		require.NoError(t, th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1))
+	}
+	now = now.Add(time.Minute)
+	// Querying the quota doesn't count against it.
+	for i := 0; i < 2; i++ {
+		quota, err = admin.Quota(state, origin)
+		require.NoError(t, err)
+		require.Equal(t, BudgetQuota{
+			Budget:     "call",
+			Limit:      maxCallCount,
+			Used:       3,
+			Remaining:  maxCallCount - 3,
+			WindowEnds: now.Add(-time.Minute).Unix() + sessionDuration,
+		}, quota.Budgets[callBudget])
+	}
+
+	// The quota is restored once the session ends.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	quota, err = admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), quota.Budgets[callBudget].Used)
+	require.Equal(t, int64(0), quota.Budgets[callBudget].WindowEnds)
+
+	quota, err = admin.Quota(state, contract)
+	require.NoError(t, err)
+	require.True(t, quota.Exempt)
+	require.Empty(t, quota.Budgets)
+}
+
+func TestAdminQuotaBlockSessions(t *testing.T) {
+	admin := NewAdmin()
+	th := NewThrottle(sessionDuration, maxCallCount, 0, maxDeployCount)
+	WithBlockSessions(10, 0)(th)
+	WithAdmin(admin)(th)
+	memStore := store.NewMemStore()
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 12}, nil, nil)
+	deployTxID := uint32(types.TxID_DEPLOY)
+
+	for nonce := uint64(1); nonce <= uint64(maxDeployCount)+1; nonce++ {
+		th.throttleTx(state, deployBudget, nonce, origin, maxDeployCount, deployTxID, 1)
+	}
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, "block", quota.Algorithm)
+	require.Equal(t, "state", quota.Store)
+	require.False(t, quota.LocalView)
+	require.Equal(t, BudgetQuota{
+		Budget:           "deploy",
+		Limit:            maxDeployCount,
+		Used:             maxDeployCount,
+		WindowEndsHeight: 20,
+	}, quota.Budgets[deployBudget])
+
+	state = loomchain.NewStoreState(nil, memStore, abci.Header{Height: 20}, nil, nil)
+	quota, err = admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, maxDeployCount, quota.Budgets[deployBudget].Remaining)
+	require.Equal(t, int64(30), quota.Budgets[deployBudget].WindowEndsHeight)
+}
+
+func TestAdminQuotaStateSessionStore(t *testing.T) {
+	admin := NewAdmin()
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithSessionStore(StateSessionStore)(th)
+	WithWindowMode(SlidingWindow)(th)
+	WithAdmin(admin)(th)
+	start := int64(1500000000)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1, Time: time.Unix(start, 0)}, nil, nil)
+	callTxID := uint32(types.TxID_CALL)
+
+	for nonce := uint64(1); nonce <= 4; nonce++ {
+		require.NoError(t, th.throttleTx(state, callBudget, nonce, origin, maxCallCount, callTxID, 1))
+	}
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, "sliding", quota.Algorithm)
+	require.Equal(t, "state", quota.Store)
+	require.False(t, quota.LocalView)
+	require.Equal(t, BudgetQuota{
+		Budget:     "call",
+		Limit:      maxCallCount,
+		Used:       4,
+		Remaining:  maxCallCount - 4,
+		WindowEnds: start + sessionDuration,
+	}, quota.Budgets[callBudget])
+}
@@ -0,0 +1,85 @@
+package throttle
+
+import (
+	"encoding/json"
+
+	"github.com/loomnetwork/loomchain"
+)
+
+// RejectionInfo is the machine-readable state of the throttle added to the result of a tx rejected
+// by the throttle in CheckTx, see WithRejectionInfo. Fields that don't apply to the error the tx was
+// rejected with are omitted to keep the payload small.
+type RejectionInfo struct {
+	// ABCI response code the tx was rejected with
+	Code uint32 `json:"code"`
+	// Limit the origin reached, and how much of it the origin has used
+	Limit int64 `json:"limit,omitempty"`
+	Used  int64 `json:"used,omitempty"`
+	// Unix timestamp (in seconds) from which the origin can send another tx
+	RetryAfterUnix int64 `json:"retry_after_unix,omitempty"`
+	// Height of the block from which the origin can send another tx, if sessions are measured in
+	// blocks
+	RetryAfterHeight int64 `json:"retry_after_height,omitempty"`
+}
+
+// WithRejectionInfo makes the middleware add a RejectionInfo encoded as JSON to the Info & Data of
+// the result of each tx it rejects in CheckTx, so clients can tell when to resend the tx without
+// parsing the error message. Data is set as well as Info since broadcast_tx responses only carry the
+// Data of the CheckTx response.
+func WithRejectionInfo() KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.rejectionInfo = true
+	}
+}
+
+// Returns the throttle state described by the given error, false if the error wasn't returned by
+// the throttle.
+func rejectionInfoOf(err error) (*RejectionInfo, bool) {
+	switch e := err.(type) {
+	case *TxLimitReachedError:
+		return &RejectionInfo{
+			Code: e.ABCICode(), Limit: e.Limit, Used: e.Used, RetryAfterUnix: e.RetryAfter,
+			RetryAfterHeight: e.RetryAfterHeight,
+		}, true
+	case *ContractTxLimitReachedError:
+		return &RejectionInfo{
+			Code: e.ABCICode(), Limit: e.Limit, Used: e.Used, RetryAfterUnix: e.RetryAfter,
+			RetryAfterHeight: e.RetryAfterHeight,
+		}, true
+	case *BlockTxLimitReachedError:
+		return &RejectionInfo{
+			Code: e.ABCICode(), Limit: e.Limit, Used: e.Limit, RetryAfterHeight: e.Height + 1,
+		}, true
+	case *TxCostExceedsLimitError:
+		return &RejectionInfo{Code: e.ABCICode(), Limit: e.Limit}, true
+	case *OriginCooldownError:
+		return &RejectionInfo{Code: e.ABCICode(), RetryAfterUnix: e.RetryAfter}, true
+	case *FailureCooldownError:
+		return &RejectionInfo{Code: e.ABCICode(), RetryAfterUnix: e.RetryAfter}, true
+	case *DeployTooLargeError:
+		return &RejectionInfo{Code: e.ABCICode(), Limit: e.MaxBytes}, true
+	case *DuplicateTxError:
+		return &RejectionInfo{Code: e.ABCICode()}, true
+	case *MaintenanceModeError:
+		return &RejectionInfo{Code: e.ABCICode()}, true
+	}
+	return nil, false
+}
+
+// Adds the throttle state described by the given error to the given result, if rejection info is
+// enabled and the error was returned by the throttle in CheckTx.
+func (t *Throttle) addRejectionInfo(res *loomchain.TxHandlerResult, err error, isCheckTx bool) {
+	if !t.rejectionInfo || !isCheckTx {
+		return
+	}
+	info, ok := rejectionInfoOf(err)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	res.Info = string(data)
+	res.Data = data
+}
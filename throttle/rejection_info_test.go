@@ -0,0 +1,86 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestRejectionInfo(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	now := time.Unix(1500000000, 0)
+	newMiddleware := func(opts ...KarmaMiddlewareOption) loomchain.TxMiddlewareFunc {
+		opts = append(opts, WithClock(ClockFunc(func() time.Time { return now })))
+		return GetKarmaMiddleWare(
+			true, 2, sessionDuration, 0, 0, StaticLimitResolver(2), createKarmaContractCtx, opts...,
+		)
+	}
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	sendTx := func(
+		tmx loomchain.TxMiddlewareFunc, nonce uint64, isCheckTx bool,
+	) (loomchain.TxHandlerResult, error) {
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+		return tmx.ProcessTx(
+			state.WithContext(ctx),
+			txSigned.Inner,
+			func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+				return loomchain.TxHandlerResult{}, nil
+			},
+			isCheckTx,
+		)
+	}
+
+	// Nothing is added to the result unless rejection info is enabled.
+	tmx := newMiddleware()
+	for i := uint64(1); i <= 2; i++ {
+		_, err := sendTx(tmx, i, true)
+		require.NoError(t, err)
+	}
+	r, err := sendTx(tmx, 3, true)
+	require.Error(t, err)
+	require.Empty(t, r.Info)
+	require.Empty(t, r.Data)
+
+	tmx = newMiddleware(WithRejectionInfo())
+	for i := uint64(1); i <= 2; i++ {
+		r, err = sendTx(tmx, i, true)
+		require.NoError(t, err)
+		require.Empty(t, r.Info)
+	}
+	r, err = sendTx(tmx, 3, true)
+	require.Error(t, err)
+	var info RejectionInfo
+	require.NoError(t, json.Unmarshal([]byte(r.Info), &info))
+	require.Equal(t, RejectionInfo{
+		Code: TxLimitReachedCode, Limit: 2, Used: 2, RetryAfterUnix: now.Unix() + sessionDuration,
+	}, info)
+	require.Equal(t, r.Info, string(r.Data))
+	require.Equal(t, `{"code":429,"limit":2,"used":2,"retry_after_unix":1500000600}`, r.Info)
+
+	// Txs rejected in DeliverTx aren't given any, since the client only gets the CheckTx response.
+	tmx = newMiddleware(WithRejectionInfo(), WithCountMode(DeliverTxCounting), WithSessionStore(StateSessionStore))
+	for i := uint64(1); i <= 2; i++ {
+		_, err = sendTx(tmx, i, false)
+		require.NoError(t, err)
+	}
+	r, err = sendTx(tmx, 3, false)
+	require.Error(t, err)
+	require.Empty(t, r.Info)
+}
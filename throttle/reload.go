@@ -0,0 +1,186 @@
+package throttle
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Makes the throttle remember the config it was created from, so it can be reloaded.
+func withConfig(cfg *ThrottleConfig) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.config = cfg.Clone()
+	}
+}
+
+// Reload applies the limits, session durations, tx costs, exempt origins & maintenance mode of the
+// given config to the throttle while it keeps running. The session records of the origins are
+// preserved, so txs that have already been counted against the current sessions keep counting towards
+// the new limits. The remaining fields of the config only take effect when the node is restarted,
+// except for the session mode, session store, count mode & window mode, which determine how the
+// session records are kept and must match the running config.
+// If the config is invalid an error is returned and the throttle keeps running with its current
+// config. When txs are counted in DeliverTx the limits affect which txs are included in blocks, so
+// every validator must reload the same config, prefer on-chain params (see WithOnChainParams) in
+// that case.
+func (a *Admin) Reload(cfg *ThrottleConfig) error {
+	// Held throughout so concurrent reloads are applied one at a time.
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	th := a.throttle
+	if th == nil {
+		return ErrThrottleNotEnabled
+	}
+	if err := th.checkReload(cfg); err != nil {
+		return errors.Wrap(err, "invalid throttle config")
+	}
+	th.reload(cfg)
+	if th.checkTx != nil {
+		th.checkTx.reload(cfg)
+	}
+	return nil
+}
+
+// Returns an error if the given config can't be applied to the throttle while it's running.
+func (t *Throttle) checkReload(cfg *ThrottleConfig) error {
+	t.paramsMtx.RLock()
+	current := t.config
+	t.paramsMtx.RUnlock()
+
+	if current == nil {
+		return errors.New("the throttle wasn't created from a config")
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if sessionModeOf(cfg) != sessionModeOf(current) {
+		return errors.Errorf("SessionMode can't be changed from %s to %s without a restart",
+			sessionModeOf(current), sessionModeOf(cfg))
+	}
+	if sessionStoreOf(cfg) != sessionStoreOf(current) {
+		return errors.Errorf("SessionStore can't be changed from %s to %s without a restart",
+			sessionStoreOf(current), sessionStoreOf(cfg))
+	}
+	if cfg.countMode() != current.countMode() {
+		return errors.Errorf("CountMode can't be changed from %s to %s without a restart",
+			current.countMode(), cfg.countMode())
+	}
+	if cfg.chargeMode() != current.chargeMode() {
+		return errors.Errorf("ChargeMode can't be changed from %s to %s without a restart",
+			current.chargeMode(), cfg.chargeMode())
+	}
+	if windowModeOf(cfg) != windowModeOf(current) {
+		return errors.Errorf("WindowMode can't be changed from %s to %s without a restart",
+			windowModeOf(current), windowModeOf(cfg))
+	}
+	if windowModeOf(cfg) == LeakyBucket && cfg.LeakRate != current.LeakRate {
+		return errors.Errorf("LeakRate can't be changed from %v to %v without a restart", current.LeakRate, cfg.LeakRate)
+	}
+	return nil
+}
+
+// Applies the reloadable fields of the given config to the throttle, the config must have been
+// checked by checkReload.
+func (t *Throttle) reload(cfg *ThrottleConfig) {
+	params := newThrottleParams(&OnChainParams{
+		MaxCallCount:          cfg.MaxCallCount,
+		SessionDuration:       cfg.SessionDuration,
+		MaxDeployCount:        cfg.MaxDeployCount,
+		DeploySessionDuration: cfg.DeploySessionDuration,
+		ExemptOrigins:         cfg.ExemptOrigins,
+		MaintenanceMode:       cfg.MaintenanceMode,
+		MaintenanceAllowlist:  cfg.MaintenanceAllowlist,
+	})
+	txCost := cfg.TxCost
+	if txCost == nil && cfg.TxCostMode != "" {
+		// Can't fail since the config has been validated
+		txCost, _ = NewTxCostFunc(TxCostMode(cfg.TxCostMode), cfg.CallTxCost, cfg.DeployTxCost)
+	}
+
+	t.paramsMtx.Lock()
+	defer t.paramsMtx.Unlock()
+
+	old := t.config
+	if t.onChainParams != nil {
+		// The on-chain params take precedence over the config, the new params are applied the next
+		// time the on-chain params are reloaded if there are no valid on-chain params.
+		t.onChainParams.static = params
+		t.onChainParams.loaded = false
+	} else {
+		t.maintenanceSwitched(t.params, params, 0)
+		t.params = params
+		if t.karmaLimits != nil {
+			t.karmaLimits.setBaseLimit(params.maxCallCount)
+		}
+	}
+	t.txCost = txCost
+	t.maxTxBytes = cfg.MaxTxBytes
+
+	updated := old.Clone()
+	updated.MaxCallCount = cfg.MaxCallCount
+	updated.SessionDuration = cfg.SessionDuration
+	updated.MaxDeployCount = cfg.MaxDeployCount
+	updated.DeploySessionDuration = cfg.DeploySessionDuration
+	updated.MaxTxBytes = cfg.MaxTxBytes
+	updated.TxCostMode = cfg.TxCostMode
+	updated.CallTxCost = cfg.CallTxCost
+	updated.DeployTxCost = cfg.DeployTxCost
+	updated.TxCost = cfg.TxCost
+	updated.ExemptOrigins = cfg.Clone().ExemptOrigins
+	updated.MaintenanceMode = cfg.MaintenanceMode
+	updated.MaintenanceAllowlist = cfg.Clone().MaintenanceAllowlist
+	t.config = updated
+	t.metrics.paramsUpdated()
+	t.logger.Info("Throttle config reloaded", configChanges(old, updated)...)
+}
+
+// Returns the log key/value pairs describing the reloadable fields that differ between the given
+// configs, each value reads "old -> new".
+func configChanges(old *ThrottleConfig, updated *ThrottleConfig) []interface{} {
+	fields := []struct {
+		key      string
+		old, new interface{}
+	}{
+		{"max_call_count", old.MaxCallCount, updated.MaxCallCount},
+		{"session_duration", old.SessionDuration, updated.SessionDuration},
+		{"max_deploy_count", old.MaxDeployCount, updated.MaxDeployCount},
+		{"deploy_session_duration", old.DeploySessionDuration, updated.DeploySessionDuration},
+		{"max_tx_bytes", old.MaxTxBytes, updated.MaxTxBytes},
+		{"tx_cost_mode", old.TxCostMode, updated.TxCostMode},
+		{"call_tx_cost", old.CallTxCost, updated.CallTxCost},
+		{"deploy_tx_cost", old.DeployTxCost, updated.DeployTxCost},
+		{"exempt_origins", old.ExemptOrigins, updated.ExemptOrigins},
+		{"maintenance_mode", old.MaintenanceMode, updated.MaintenanceMode},
+		{"maintenance_allowlist", old.MaintenanceAllowlist, updated.MaintenanceAllowlist},
+	}
+	var keyvals []interface{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.old, field.new) {
+			keyvals = append(keyvals, field.key, fmt.Sprintf("%v -> %v", field.old, field.new))
+		}
+	}
+	return keyvals
+}
+
+func sessionModeOf(cfg *ThrottleConfig) SessionMode {
+	if cfg.SessionMode == "" {
+		return TimeSessions
+	}
+	return SessionMode(cfg.SessionMode)
+}
+
+func sessionStoreOf(cfg *ThrottleConfig) SessionStoreKind {
+	if cfg.SessionStore == "" {
+		return MemorySessionStore
+	}
+	return SessionStoreKind(cfg.SessionStore)
+}
+
+func windowModeOf(cfg *ThrottleConfig) WindowMode {
+	if cfg.WindowMode == "" {
+		return FixedWindow
+	}
+	return WindowMode(cfg.WindowMode)
+}
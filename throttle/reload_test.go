@@ -0,0 +1,106 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestReloadConfig(t *testing.T) {
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	// The origin has 7 call karma, so its call limit is MaxCallCount + 7.
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	admin := NewAdmin()
+	require.Equal(t, ErrThrottleNotEnabled, admin.Reload(DefaultThrottleConfig()))
+
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	newConfig := func(maxCallCount int64) *ThrottleConfig {
+		cfg := DefaultThrottleConfig()
+		cfg.MaxCallCount = maxCallCount
+		cfg.SessionDuration = 60
+		return cfg
+	}
+	cfg := newConfig(3)
+	cfg.Admin = admin
+	cfg.Clock = clock
+	tmx, err := GetKarmaMiddleWareWithConfig(true, cfg, createKarmaContractCtx)
+	require.NoError(t, err)
+
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendTx := func(from loom.Address) error {
+		nonce++
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+		)
+	}
+	usedCalls := func() int64 {
+		quota, err := admin.Quota(state, origin)
+		require.NoError(t, err)
+		return quota.Budgets[callBudget].Used
+	}
+	isLimitReached := func(err error) bool {
+		_, ok := err.(*TxLimitReachedError)
+		return ok
+	}
+
+	for i := 0; i < 8; i++ {
+		require.NoError(t, sendTx(origin))
+	}
+	require.Equal(t, int64(8), usedCalls())
+
+	// Raising the limit mid-session keeps the txs that have already been counted.
+	clock.now = clock.now.Add(30 * time.Second)
+	require.NoError(t, admin.Reload(newConfig(5)))
+	require.Equal(t, int64(8), usedCalls())
+	for i := 0; i < 4; i++ {
+		require.NoError(t, sendTx(origin))
+	}
+	require.True(t, isLimitReached(sendTx(origin)))
+
+	// Invalid configs & configs that change how the session records are kept are rejected without
+	// affecting the running config.
+	invalid := newConfig(100)
+	invalid.SessionDuration = -1
+	require.Error(t, admin.Reload(invalid))
+	stateStore := newConfig(100)
+	stateStore.SessionStore = string(StateSessionStore)
+	require.Error(t, admin.Reload(stateStore))
+	sliding := newConfig(100)
+	sliding.WindowMode = string(SlidingWindow)
+	require.Error(t, admin.Reload(sliding))
+	require.True(t, isLimitReached(sendTx(origin)))
+
+	// Lowering the limit below what the origin has already used throttles it until the session ends.
+	lower := newConfig(1)
+	lower.ExemptOrigins = []string{origin.String()}
+	require.NoError(t, admin.Reload(lower))
+	require.NoError(t, sendTx(origin))
+	lower.ExemptOrigins = nil
+	require.NoError(t, admin.Reload(lower))
+	require.True(t, isLimitReached(sendTx(origin)))
+
+	// Sessions last as long as the reloaded duration.
+	longer := newConfig(1)
+	longer.SessionDuration = 120
+	require.NoError(t, admin.Reload(longer))
+	clock.now = clock.now.Add(60 * time.Second)
+	require.True(t, isLimitReached(sendTx(origin)))
+	clock.now = clock.now.Add(60 * time.Second)
+	require.NoError(t, sendTx(origin))
+}
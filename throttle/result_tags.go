@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"strconv"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+	"github.com/tendermint/tendermint/libs/common"
+)
+
+// Keys of the tags the throttle adds to the results of the txs it allows, see WithResultTags.
+const (
+	// Budget the tx was counted against: call | deploy
+	ResultTagBudget = "throttle.budget"
+	// Total cost of the txs counted against the budget during the current session, including the tx.
+	ResultTagUsed      = "throttle.used"
+	ResultTagLimit     = "throttle.limit"
+	ResultTagRemaining = "throttle.remaining"
+	// Unix timestamp (in seconds) at which the current session ends, only set if sessions are
+	// measured in seconds.
+	ResultTagWindowEnd = "throttle.window_end"
+	// Height of the block at which the current session ends, only set if sessions are measured in
+	// blocks.
+	ResultTagWindowEndHeight = "throttle.window_end_height"
+)
+
+// Wraps the given handler so that the quota the origin has left in the given budget is added to the
+// tags of the result of the tx if it succeeds in DeliverTx. Does nothing unless result tags are
+// enabled, or if the limit is unlimited.
+// Tags aren't part of the app hash, so the tags of txs counted in memory may differ between nodes.
+func (t *Throttle) tagResult(
+	next loomchain.TxHandlerFunc, budget txBudget, origin loom.Address, limit int64,
+) loomchain.TxHandlerFunc {
+	if !t.resultTags || isUnlimited(limit) {
+		return next
+	}
+	return func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		r, err := next(state, txBytes, isCheckTx)
+		if err != nil || isCheckTx {
+			return r, err
+		}
+		quota := t.budgetQuota(state, budget, origin, limit)
+		r.Tags = append(r.Tags,
+			common.KVPair{Key: []byte(ResultTagBudget), Value: []byte(quota.Budget)},
+			common.KVPair{Key: []byte(ResultTagUsed), Value: []byte(strconv.FormatInt(quota.Used, 10))},
+			common.KVPair{Key: []byte(ResultTagLimit), Value: []byte(strconv.FormatInt(quota.Limit, 10))},
+			common.KVPair{Key: []byte(ResultTagRemaining), Value: []byte(strconv.FormatInt(quota.Remaining, 10))},
+		)
+		if quota.WindowEndsHeight > 0 {
+			r.Tags = append(r.Tags, common.KVPair{
+				Key:   []byte(ResultTagWindowEndHeight),
+				Value: []byte(strconv.FormatInt(quota.WindowEndsHeight, 10)),
+			})
+		} else {
+			r.Tags = append(r.Tags, common.KVPair{
+				Key:   []byte(ResultTagWindowEnd),
+				Value: []byte(strconv.FormatInt(quota.WindowEnds, 10)),
+			})
+		}
+		return r, nil
+	}
+}
@@ -0,0 +1,87 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/common"
+)
+
+func TestResultTags(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	now := time.Unix(1500000000, 0)
+	newMiddleware := func(opts ...KarmaMiddlewareOption) loomchain.TxMiddlewareFunc {
+		opts = append(opts, WithClock(ClockFunc(func() time.Time { return now })))
+		return GetKarmaMiddleWare(
+			true, 2, sessionDuration, 0, 0, StaticLimitResolver(2), createKarmaContractCtx, opts...,
+		)
+	}
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	succeeding := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{Tags: []common.KVPair{{Key: []byte("k"), Value: []byte("v")}}}, nil
+	}
+	failing := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{}, errors.New("tx failed")
+	}
+	deliverTx := func(tmx loomchain.TxMiddlewareFunc, nonce uint64, next loomchain.TxHandlerFunc) (loomchain.TxHandlerResult, error) {
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+		return tmx.ProcessTx(state.WithContext(ctx), txSigned.Inner, next, false)
+	}
+	tags := func(r loomchain.TxHandlerResult) map[string]string {
+		m := make(map[string]string)
+		for _, tag := range r.Tags {
+			m[string(tag.Key)] = string(tag.Value)
+		}
+		return m
+	}
+
+	// No tags are added unless they're enabled.
+	r, err := deliverTx(newMiddleware(), 1, succeeding)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"k": "v"}, tags(r))
+
+	tmx := newMiddleware(WithResultTags())
+	r, err = deliverTx(tmx, 1, succeeding)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"k":                "v",
+		ResultTagBudget:    "call",
+		ResultTagUsed:      "1",
+		ResultTagLimit:     "2",
+		ResultTagRemaining: "1",
+		ResultTagWindowEnd: "1500000600",
+	}, tags(r))
+
+	// Failed txs don't get tags.
+	r, err = deliverTx(tmx, 2, failing)
+	require.EqualError(t, err, "tx failed")
+	require.Empty(t, r.Tags)
+
+	r, err = deliverTx(tmx, 3, succeeding)
+	require.NoError(t, err)
+	require.Equal(t, "2", tags(r)[ResultTagUsed])
+	require.Equal(t, "0", tags(r)[ResultTagRemaining])
+
+	// Neither do throttled txs.
+	r, err = deliverTx(tmx, 4, succeeding)
+	_, ok := err.(*TxLimitReachedError)
+	require.True(t, ok, "expected a tx limit error, got %v", err)
+	require.Empty(t, r.Tags)
+}
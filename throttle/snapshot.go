@@ -0,0 +1,305 @@
+package throttle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Version of the snapshot format written by this version of the throttle, snapshots written by a
+// later version are discarded.
+const snapshotVersion = 1
+
+// DefaultSnapshotInterval is how often the session records are snapshotted by default.
+const DefaultSnapshotInterval = time.Minute
+
+// Periodically snapshots the session records kept in memory to a file, so a restarted node doesn't
+// give every origin a fresh budget.
+type snapshotter struct {
+	path     string
+	interval time.Duration
+	// When the last snapshot was taken, guarded by Throttle.sessionsMtx.
+	last time.Time
+	// Serializes the writes of snapshots.
+	writeMtx sync.Mutex
+	// Snapshots that are being written.
+	writes sync.WaitGroup
+}
+
+// WithSnapshots makes the middleware snapshot the session records it keeps in memory to the file at
+// the given path every interval & when the node stops (see Admin.Snapshot), and restore them from
+// the file when it's created. Records of
+// origins whose sessions & cooldowns have ended by the time the snapshot is restored are discarded,
+// and a snapshot that can't be read is logged and discarded so the node still starts. The hashes of
+// recent txs kept to detect duplicates aren't snapshotted. Only applies to the memory session store
+// in time session mode.
+func WithSnapshots(path string, interval time.Duration) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.snapshots = &snapshotter{path: path, interval: interval}
+	}
+}
+
+func (t *Throttle) snapshotsEnabled() bool {
+	return t.snapshots != nil && t.sessionMode != BlockSessions && t.sessionStore == MemorySessionStore
+}
+
+type snapshotFile struct {
+	Version   int              `json:"version"`
+	TakenAt   time.Time        `json:"taken_at"`
+	Origins   []originSnapshot `json:"origins"`
+	Contracts []budgetSnapshot `json:"contracts,omitempty"`
+}
+
+type originSnapshot struct {
+	Origin     string           `json:"origin"`
+	LastAccess time.Time        `json:"last_access"`
+	Budgets    []budgetSnapshot `json:"budgets"`
+	Penalty    *penaltySnapshot `json:"penalty,omitempty"`
+	Failures   *failureSnapshot `json:"failures,omitempty"`
+	BurstDrawn time.Time        `json:"burst_drawn"`
+}
+
+type budgetSnapshot struct {
+	// Key of the contract session record, empty for the budgets of origins.
+	Key       string    `json:"key,omitempty"`
+	Start     time.Time `json:"start"`
+	Count     int64     `json:"count"`
+	PrevCount int64     `json:"prev_count,omitempty"`
+	Limit     int64     `json:"limit"`
+	LastNonce uint64    `json:"last_nonce,omitempty"`
+	LastTxID  uint32    `json:"last_tx_id,omitempty"`
+	LastCost  int64     `json:"last_cost,omitempty"`
+}
+
+type penaltySnapshot struct {
+	Rejections      int64         `json:"rejections"`
+	RejectionsStart time.Time     `json:"rejections_start"`
+	CooldownEnds    time.Time     `json:"cooldown_ends"`
+	Cooldown        time.Duration `json:"cooldown"`
+}
+
+type failureSnapshot struct {
+	Streak       int64         `json:"streak"`
+	Offenses     int           `json:"offenses"`
+	CooldownEnds time.Time     `json:"cooldown_ends"`
+	Cooldown     time.Duration `json:"cooldown"`
+}
+
+func snapshotBudget(key string, b *budgetSession) budgetSnapshot {
+	return budgetSnapshot{
+		Key:       key,
+		Start:     b.start,
+		Count:     b.accessCount,
+		PrevCount: b.prevAccessCount,
+		Limit:     b.limit,
+		LastNonce: b.lastNonce,
+		LastTxID:  b.lastTxID,
+		LastCost:  b.lastCost,
+	}
+}
+
+func (s *budgetSnapshot) restore() budgetSession {
+	return budgetSession{
+		start:           s.Start,
+		accessCount:     s.Count,
+		prevAccessCount: s.PrevCount,
+		limit:           s.Limit,
+		lastNonce:       s.LastNonce,
+		lastTxID:        s.LastTxID,
+		lastCost:        s.LastCost,
+	}
+}
+
+// Snapshots the session records to the snapshot file if the last snapshot was taken at least an
+// interval ago. The records are copied while the lock is held, and written to the file in the
+// background.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) maybeSnapshot(now time.Time) {
+	if !t.snapshotsEnabled() || now.Sub(t.snapshots.last) < t.snapshots.interval {
+		return
+	}
+	t.snapshots.last = now
+	snapshot := t.snapshot(now)
+	t.snapshots.writes.Add(1)
+	go func() {
+		defer t.snapshots.writes.Done()
+		if err := t.snapshots.write(snapshot); err != nil {
+			t.logger.Error("Failed to write throttle snapshot", "path", t.snapshots.path, "err", err)
+		}
+	}()
+}
+
+// Writes a snapshot of the session records straight away, once the snapshots that are being written
+// in the background are done so none of them overwrites it. No further snapshot is taken until an
+// interval later.
+func (t *Throttle) finalSnapshot() error {
+	if !t.snapshotsEnabled() {
+		return nil
+	}
+	t.sessionsMtx.Lock()
+	now := t.clock.Now()
+	t.snapshots.last = now
+	snapshot := t.snapshot(now)
+	t.sessionsMtx.Unlock()
+
+	t.snapshots.writes.Wait()
+	return t.snapshots.write(snapshot)
+}
+
+// Returns a copy of the session records.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) snapshot(now time.Time) *snapshotFile {
+	snapshot := &snapshotFile{
+		Version: snapshotVersion,
+		TakenAt: now,
+		Origins: make([]originSnapshot, 0, len(t.sessions)),
+	}
+	for origin, session := range t.sessions {
+		s := originSnapshot{
+			Origin:     origin,
+			LastAccess: session.lastAccess,
+			Budgets:    make([]budgetSnapshot, numBudgets),
+			BurstDrawn: session.burstDrawn,
+		}
+		for budget := txBudget(0); budget < numBudgets; budget++ {
+			s.Budgets[budget] = snapshotBudget("", &session.budgets[budget])
+		}
+		if p := session.penalty; p != (penaltyState{}) {
+			s.Penalty = &penaltySnapshot{
+				Rejections:      p.rejections,
+				RejectionsStart: p.rejectionsStart,
+				CooldownEnds:    p.cooldownEnds,
+				Cooldown:        p.cooldown,
+			}
+		}
+		if f := session.failures; f != (failureState{}) {
+			s.Failures = &failureSnapshot{
+				Streak:       f.streak,
+				Offenses:     f.offenses,
+				CooldownEnds: f.cooldownEnds,
+				Cooldown:     f.cooldown,
+			}
+		}
+		snapshot.Origins = append(snapshot.Origins, s)
+	}
+	for key, session := range t.contractSessions {
+		snapshot.Contracts = append(snapshot.Contracts, snapshotBudget(key, session))
+	}
+	return snapshot
+}
+
+// Writes the given snapshot to a temporary file that's then renamed to the snapshot file, so a node
+// that crashes while writing the snapshot is left with the previous one.
+func (s *snapshotter) write(snapshot *snapshotFile) error {
+	s.writeMtx.Lock()
+	defer s.writeMtx.Unlock()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal snapshot")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// Restores the session records from the snapshot file, if there is one. Records of idle origins are
+// discarded, and if there are more records than the throttle can keep in memory only the records of
+// the most recently active origins are restored.
+func (t *Throttle) restoreSnapshot() {
+	if !t.snapshotsEnabled() {
+		return
+	}
+	data, err := ioutil.ReadFile(t.snapshots.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to read throttle snapshot, starting afresh", "path", t.snapshots.path, "err", err)
+		return
+	}
+	var snapshot snapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.logger.Error("Discarding corrupt throttle snapshot", "path", t.snapshots.path, "err", err)
+		return
+	}
+	if snapshot.Version != snapshotVersion {
+		t.logger.Error(
+			"Discarding throttle snapshot of unsupported version", "path", t.snapshots.path,
+			"version", snapshot.Version, "supported", snapshotVersion,
+		)
+		return
+	}
+
+	now := t.clock.Now()
+	// Most recently active origins first.
+	sort.Slice(snapshot.Origins, func(i, j int) bool {
+		return snapshot.Origins[i].LastAccess.After(snapshot.Origins[j].LastAccess)
+	})
+
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	restored := 0
+	for i := range snapshot.Origins {
+		s := &snapshot.Origins[i]
+		if t.trackedOrigins() >= t.maxTrackedOrigins {
+			break
+		}
+		if _, ok := t.sessions[s.Origin]; ok || s.Origin == "" {
+			continue
+		}
+		session := &originSession{lastAccess: s.LastAccess, burstDrawn: s.BurstDrawn}
+		for budget := 0; budget < len(s.Budgets) && budget < int(numBudgets); budget++ {
+			session.budgets[budget] = s.Budgets[budget].restore()
+		}
+		if p := s.Penalty; p != nil {
+			session.penalty = penaltyState{
+				rejections:      p.Rejections,
+				rejectionsStart: p.RejectionsStart,
+				cooldownEnds:    p.CooldownEnds,
+				cooldown:        p.Cooldown,
+			}
+		}
+		if f := s.Failures; f != nil {
+			session.failures = failureState{
+				streak:       f.Streak,
+				offenses:     f.Offenses,
+				cooldownEnds: f.CooldownEnds,
+				cooldown:     f.Cooldown,
+			}
+		}
+		if t.isIdle(session, now) {
+			continue
+		}
+		session.activity = t.activity.PushBack(s.Origin)
+		t.sessions[s.Origin] = session
+		restored++
+	}
+	idlePeriod := 2 * t.sessionPeriod(callBudget)
+	for i := range snapshot.Contracts {
+		s := &snapshot.Contracts[i]
+		if s.Key == "" || now.Sub(s.Start) >= idlePeriod {
+			continue
+		}
+		session := s.restore()
+		t.contractSessions[s.Key] = &session
+	}
+	t.snapshots.last = now
+	t.metrics.TrackedOrigins.Set(float64(len(t.sessions)))
+	t.logger.Info(
+		"Restored throttle snapshot", "path", t.snapshots.path, "taken_at", snapshot.TakenAt,
+		"origins", restored, "discarded", len(snapshot.Origins)-restored,
+	)
+}
@@ -0,0 +1,185 @@
+// +build evm
+
+package throttle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttle-snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data", "throttle.snapshot")
+
+	now := time.Unix(1500000000, 0)
+	logger := &recordingLogger{}
+	newThrottle := func() *Throttle {
+		th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+		for _, opt := range []KarmaMiddlewareOption{
+			WithSnapshots(path, time.Minute), WithBurst(50, 3), WithPenalty(3, 10*time.Second, 40*time.Second),
+			WithFailureCooldown(3, time.Hour, 4*time.Hour), WithClock(ClockFunc(func() time.Time { return now })),
+			WithLogger(logger),
+		} {
+			opt(th)
+		}
+		return th
+	}
+
+	// Without a snapshot the throttle starts afresh.
+	th := newThrottle()
+	th.restoreSnapshot()
+	require.Empty(t, th.sessions)
+	require.Equal(t, 0, logger.count("error"))
+
+	// The first tx triggers a snapshot, since none has been taken yet.
+	require.Equal(t, int64(1), th.countTx(callBudget, addr1.String(), 1, 1, 1, maxCallCount, now))
+	th.snapshots.writes.Wait()
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	// Populate the records with usage, a cooldown for txs over the limit, a cooldown for failed txs,
+	// & burst state.
+	for i := uint64(2); i <= 4; i++ {
+		th.countTx(callBudget, addr1.String(), i, 1, 1, maxCallCount, now)
+	}
+	th.countTx(deployBudget, addr1.String(), 5, 2, 1, maxCallCount, now)
+	th.countTx(callBudget, origin.String(), 1, 1, 1, maxCallCount, now)
+	th.countTx(callBudget, contract.String(), 1, 1, 1, maxCallCount, now)
+	th.sessionsMtx.Lock()
+	th.sessions[addr1.String()].penalty = penaltyState{
+		rejections: 4, rejectionsStart: now, cooldownEnds: now.Add(20 * time.Second), cooldown: 20 * time.Second,
+	}
+	th.sessions[addr1.String()].burstDrawn = now
+	th.sessions[origin.String()].failures = failureState{
+		streak: 1, offenses: 2, cooldownEnds: now.Add(2 * time.Hour), cooldown: 2 * time.Hour,
+	}
+	th.contractSessions["contract"] = &budgetSession{start: now, accessCount: 7, limit: 100}
+	// The record of an origin that has been idle for a whole session is discarded on restore.
+	th.sessions[contract.String()].budgets[callBudget].start = now.Add(-2 * time.Duration(sessionDuration) * time.Second)
+	th.sessionsMtx.Unlock()
+
+	// The next snapshot is due a minute later.
+	now = now.Add(30 * time.Second)
+	th.countTx(callBudget, origin.String(), 2, 1, 1, maxCallCount, now)
+	require.Equal(t, now.Add(-30*time.Second), th.snapshots.last)
+	now = now.Add(30 * time.Second)
+	th.countTx(callBudget, origin.String(), 3, 1, 1, maxCallCount, now)
+	require.Equal(t, now, th.snapshots.last)
+	th.snapshots.writes.Wait()
+
+	// A restarted throttle picks up where the previous one left off.
+	restored := newThrottle()
+	restored.restoreSnapshot()
+	require.Equal(t, 0, logger.count("error"))
+	require.Len(t, restored.sessions, 2)
+	require.NotContains(t, restored.sessions, contract.String())
+	for _, key := range []string{addr1.String(), origin.String()} {
+		want, got := th.sessions[key], restored.sessions[key]
+		require.True(t, want.lastAccess.Equal(got.lastAccess), key)
+		require.Equal(t, want.budgets[callBudget].accessCount, got.budgets[callBudget].accessCount, key)
+		require.True(t, want.penalty.cooldownEnds.Equal(got.penalty.cooldownEnds), key)
+		require.True(t, want.failures.cooldownEnds.Equal(got.failures.cooldownEnds), key)
+		require.True(t, want.burstDrawn.Equal(got.burstDrawn), key)
+		require.Equal(t, want.penalty.rejections, got.penalty.rejections, key)
+		require.Equal(t, want.failures.offenses, got.failures.offenses, key)
+	}
+	require.Equal(t, int64(4), restored.sessions[addr1.String()].budgets[callBudget].accessCount)
+	require.Equal(t, int64(1), restored.sessions[addr1.String()].budgets[deployBudget].accessCount)
+	require.Equal(t, int64(7), restored.contractSessions["contract"].accessCount)
+	require.Equal(t, 2, restored.activity.Len())
+	// Most recently active origin first.
+	require.Equal(t, origin.String(), restored.activity.Front().Value)
+
+	// The restored cooldowns & usage are enforced.
+	require.Error(t, restored.checkFailureCooldown(origin))
+	require.Equal(t, int64(5), restored.countTx(callBudget, addr1.String(), 6, 1, 1, maxCallCount, now))
+}
+
+// The records are snapshotted when the node stops, even if the next periodic snapshot isn't due yet.
+func TestSnapshotOnStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttle-snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "throttle.snapshot")
+
+	now := time.Unix(1500000000, 0)
+	newThrottle := func() *Throttle {
+		th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+		WithSnapshots(path, time.Minute)(th)
+		WithClock(ClockFunc(func() time.Time { return now }))(th)
+		return th
+	}
+	restoredCount := func() int64 {
+		restored := newThrottle()
+		restored.restoreSnapshot()
+		return restored.sessions[addr1.String()].budgets[callBudget].accessCount
+	}
+
+	// There's nothing to snapshot until the admin is passed to a throttle.
+	admin := NewAdmin()
+	require.NoError(t, admin.Snapshot())
+	th := newThrottle()
+	WithAdmin(admin)(th)
+
+	// Only the first tx triggers a periodic snapshot...
+	for i := uint64(1); i <= 3; i++ {
+		th.countTx(callBudget, addr1.String(), i, 1, 1, maxCallCount, now)
+	}
+	th.snapshots.writes.Wait()
+	require.Equal(t, int64(1), restoredCount())
+
+	// ...the others are snapshotted when the node stops.
+	require.NoError(t, admin.Snapshot())
+	require.Equal(t, int64(3), restoredCount())
+	require.Equal(t, now, th.snapshots.last)
+}
+
+func TestSnapshotDiscardedOnRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttle-snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "throttle.snapshot")
+
+	now := time.Unix(1500000000, 0)
+	restore := func() (*Throttle, *recordingLogger) {
+		logger := &recordingLogger{}
+		th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+		WithSnapshots(path, time.Minute)(th)
+		WithClock(ClockFunc(func() time.Time { return now }))(th)
+		WithLogger(logger)(th)
+		th.restoreSnapshot()
+		return th, logger
+	}
+
+	// A corrupt snapshot is discarded with an error rather than stopping the node from starting...
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"version":1,"origins":[{"orig`), 0644))
+	th, logger := restore()
+	require.Empty(t, th.sessions)
+	require.Equal(t, 1, logger.count("error"))
+
+	// ...and so is a snapshot written by a later version.
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"version":2,"origins":[{"origin":"x"}]}`), 0644))
+	th, logger = restore()
+	require.Empty(t, th.sessions)
+	require.Equal(t, 1, logger.count("error"))
+
+	// Fields added by later releases of the same version are ignored.
+	data := `{"version":1,"extra":true,"origins":[{"origin":"` + origin.String() + `","last_access":"` +
+		now.Format(time.RFC3339Nano) + `","budgets":[{"start":"` + now.Format(time.RFC3339Nano) + `","count":3}]}]}`
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+	th, logger = restore()
+	require.Equal(t, 0, logger.count("error"))
+	require.Equal(t, int64(3), th.sessions[origin.String()].budgets[callBudget].accessCount)
+
+	// Records whose sessions ended while the node was down are discarded.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	th, _ = restore()
+	require.Empty(t, th.sessions)
+}
@@ -0,0 +1,110 @@
+package throttle
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/util"
+)
+
+// SessionStoreKind determines where the throttle keeps the session records of each origin.
+type SessionStoreKind string
+
+const (
+	// Session records are kept in the memory of each node, so they're lost when the node restarts,
+	// and each node only counts the txs it has seen itself. Sessions are timed by the clock of the
+	// node, so the limits are only reliable in CheckTx.
+	MemorySessionStore SessionStoreKind = "memory"
+	// Session records are stored in the app state, and sessions are timed by the block time rather
+	// than the clock of the node, so all the validators enforce the same limits, and the limits
+	// survive restarts. All the validators must use the same settings since the records affect the
+	// app hash.
+	StateSessionStore SessionStoreKind = "state"
+)
+
+func (k SessionStoreKind) IsValid() bool {
+	return k == MemorySessionStore || k == StateSessionStore
+}
+
+var stateSessionKeyPrefix = []byte("throttle-session")
+
+func stateSessionKey(origin loom.Address) []byte {
+	return util.PrefixKey(stateSessionKeyPrefix, origin.Bytes())
+}
+
+// Size of an encoded budgetSession: start, accessCount, prevAccessCount, limit, lastNonce, lastTxID,
+// lastCost
+const encodedBudgetSessionSize = 6*8 + 4
+
+// Size of an encoded originSession: lastAccess & the sessions of each budget
+const encodedOriginSessionSize = 8 + int(numBudgets)*encodedBudgetSessionSize
+
+// Times are stored as unix nanoseconds, the zero time (of a session that hasn't started yet) is
+// stored as zero.
+func encodeTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func decodeTime(v uint64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(v))
+}
+
+func encodeOriginSession(session *originSession) []byte {
+	data := make([]byte, encodedOriginSessionSize)
+	binary.BigEndian.PutUint64(data, encodeTime(session.lastAccess))
+	buf := data[8:]
+	for i := range session.budgets {
+		encodeBudgetSession(buf, &session.budgets[i])
+		buf = buf[encodedBudgetSessionSize:]
+	}
+	return data
+}
+
+// Encodes the given session into the first encodedBudgetSessionSize bytes of buf.
+func encodeBudgetSession(buf []byte, s *budgetSession) {
+	binary.BigEndian.PutUint64(buf[0:], encodeTime(s.start))
+	binary.BigEndian.PutUint64(buf[8:], uint64(s.accessCount))
+	binary.BigEndian.PutUint64(buf[16:], uint64(s.prevAccessCount))
+	binary.BigEndian.PutUint64(buf[24:], uint64(s.limit))
+	binary.BigEndian.PutUint64(buf[32:], s.lastNonce)
+	binary.BigEndian.PutUint32(buf[40:], s.lastTxID)
+	binary.BigEndian.PutUint64(buf[44:], uint64(s.lastCost))
+}
+
+// Decodes the session encoded in the first encodedBudgetSessionSize bytes of buf.
+func decodeBudgetSession(buf []byte) budgetSession {
+	return budgetSession{
+		start:           decodeTime(binary.BigEndian.Uint64(buf[0:])),
+		accessCount:     int64(binary.BigEndian.Uint64(buf[8:])),
+		prevAccessCount: int64(binary.BigEndian.Uint64(buf[16:])),
+		limit:           int64(binary.BigEndian.Uint64(buf[24:])),
+		lastNonce:       binary.BigEndian.Uint64(buf[32:]),
+		lastTxID:        binary.BigEndian.Uint32(buf[40:]),
+		lastCost:        int64(binary.BigEndian.Uint64(buf[44:])),
+	}
+}
+
+// Size of an originSession encoded before the bytes budget was added.
+const legacyOriginSessionSize = 8 + int(bytesBudget)*encodedBudgetSessionSize
+
+// Returns nil if the given data isn't an encoded originSession. Records stored before the bytes
+// budget was added are decoded with an empty bytes session.
+func decodeOriginSession(data []byte) *originSession {
+	if len(data) != encodedOriginSessionSize && len(data) != legacyOriginSessionSize {
+		return nil
+	}
+	session := &originSession{lastAccess: decodeTime(binary.BigEndian.Uint64(data))}
+	buf := data[8:]
+	for i := 0; len(buf) > 0; i++ {
+		session.budgets[i] = decodeBudgetSession(buf)
+		buf = buf[encodedBudgetSessionSize:]
+	}
+	return session
+}
@@ -0,0 +1,182 @@
+package throttle
+
+import (
+	"sort"
+	"time"
+)
+
+// MaxStatsOrigins is the max number of origins listed in each section of the stats, so the
+// response stays small even when the throttle is tracking lots of origins.
+const MaxStatsOrigins = 100
+
+// DefaultStatsOrigins is the number of top origins listed in the stats when none is requested.
+const DefaultStatsOrigins = 20
+
+// OriginStats describes the usage of a single origin tracked by the throttle.
+type OriginStats struct {
+	Origin string `json:"origin"`
+	// Total cost (or size) of the txs counted against each budget during the current session, keyed
+	// by budget name.
+	Used map[string]int64 `json:"used"`
+	// Limit of each budget as of the last tx the origin sent, keyed by budget name.
+	Limits map[string]int64 `json:"limits"`
+	// Unix timestamp (in seconds) at which the origin can send txs again, zero if it has reached
+	// none of its limits.
+	ThrottledUntil int64 `json:"throttled_until,omitempty"`
+	// Unix timestamp (in seconds) at which the cooldown the origin is in ends, zero if it isn't in a
+	// cooldown.
+	CooldownEnds int64 `json:"cooldown_ends,omitempty"`
+}
+
+// ThrottleStats is a snapshot of the session records a node keeps in memory, meant for investigating
+// spam incidents.
+type ThrottleStats struct {
+	// How txs are grouped into sessions: fixed | sliding | leaky | block
+	Algorithm string `json:"algorithm"`
+	// Where session records are kept: memory | state
+	Store string `json:"store"`
+	// Session records kept in the app state aren't listed, in which case the stats are empty.
+	InMemory              bool  `json:"in_memory"`
+	MaxCallCount          int64 `json:"max_call_count"`
+	SessionDuration       int64 `json:"session_duration"`
+	MaxDeployCount        int64 `json:"max_deploy_count"`
+	DeploySessionDuration int64 `json:"deploy_session_duration"`
+	MaxTxBytes            int64 `json:"max_tx_bytes"`
+	MaxTrackedOrigins     int   `json:"max_tracked_origins"`
+	ExemptOrigins         int   `json:"exempt_origins"`
+	// Whether the chain is in maintenance mode, and which origins are accepted if it is.
+	Maintenance MaintenanceStatus `json:"maintenance"`
+	// Number of throttle events dropped because the audit sink couldn't keep up.
+	AuditEventsDropped uint64 `json:"audit_events_dropped,omitempty"`
+	// Number of origins with session records in memory.
+	TrackedOrigins int `json:"tracked_origins"`
+	// Origins that have used the most of their call budget during the current session, in
+	// descending order.
+	TopOrigins []OriginStats `json:"top_origins"`
+	// Number of origins that have reached one of their limits or are in a cooldown, only the
+	// MaxStatsOrigins of them that reset last are listed in Throttled, latest first.
+	ThrottledOrigins int           `json:"throttled_origins"`
+	Throttled        []OriginStats `json:"throttled"`
+}
+
+// Returns a snapshot of the session records kept in memory, listing the given number of top origins.
+// Only takes read locks, the stored records aren't advanced.
+func (t *Throttle) stats(top int) *ThrottleStats {
+	if top <= 0 {
+		top = DefaultStatsOrigins
+	}
+	if top > MaxStatsOrigins {
+		top = MaxStatsOrigins
+	}
+	params := t.currentParams()
+	stats := &ThrottleStats{
+		Algorithm:             string(t.windowMode),
+		Store:                 string(t.sessionStore),
+		InMemory:              t.sessionMode != BlockSessions && t.sessionStore == MemorySessionStore,
+		MaxCallCount:          params.maxCallCount,
+		SessionDuration:       params.sessionDuration,
+		MaxDeployCount:        params.maxDeployCount,
+		DeploySessionDuration: params.deploySessionDuration,
+		MaxTxBytes:            t.txBytesLimit(),
+		MaxTrackedOrigins:     t.maxTrackedOrigins,
+		ExemptOrigins:         len(params.exemptOrigins),
+		TopOrigins:            []OriginStats{},
+		Throttled:             []OriginStats{},
+		Maintenance:           t.maintenanceStatus(),
+	}
+	for _, override := range t.originOverrides {
+		if override.Exempt {
+			stats.ExemptOrigins++
+		}
+	}
+	if t.audit != nil {
+		stats.AuditEventsDropped = t.audit.droppedEvents()
+	}
+	if t.sessionMode == BlockSessions {
+		stats.Algorithm = string(BlockSessions)
+		stats.Store = string(StateSessionStore)
+	}
+	if !stats.InMemory {
+		return stats
+	}
+
+	var windows [numBudgets]Window
+	for budget := txBudget(0); budget < numBudgets; budget++ {
+		windows[budget] = t.window(budget)
+	}
+	now := t.clock.Now()
+
+	t.sessionsMtx.RLock()
+	origins := make([]OriginStats, 0, len(t.sessions))
+	for origin, session := range t.sessions {
+		origins = append(origins, t.originStats(origin, session, windows, now))
+	}
+	t.sessionsMtx.RUnlock()
+
+	stats.TrackedOrigins = len(origins)
+	callUsed := callBudget.String()
+	sort.Slice(origins, func(i, j int) bool {
+		if origins[i].Used[callUsed] != origins[j].Used[callUsed] {
+			return origins[i].Used[callUsed] > origins[j].Used[callUsed]
+		}
+		return origins[i].Origin < origins[j].Origin
+	})
+	if len(origins) > top {
+		stats.TopOrigins = append(stats.TopOrigins, origins[:top]...)
+	} else {
+		stats.TopOrigins = append(stats.TopOrigins, origins...)
+	}
+
+	for _, origin := range origins {
+		if origin.ThrottledUntil > 0 || origin.CooldownEnds > 0 {
+			stats.Throttled = append(stats.Throttled, origin)
+		}
+	}
+	stats.ThrottledOrigins = len(stats.Throttled)
+	sort.Slice(stats.Throttled, func(i, j int) bool {
+		return stats.Throttled[i].resetsAt() > stats.Throttled[j].resetsAt()
+	})
+	if len(stats.Throttled) > MaxStatsOrigins {
+		stats.Throttled = stats.Throttled[:MaxStatsOrigins]
+	}
+	return stats
+}
+
+// Returns the stats of the given origin as of the given time, the sessions are advanced on a copy so
+// the stored record isn't modified.
+// NOTE: t.sessionsMtx must be held (at least for reading) by the caller.
+func (t *Throttle) originStats(
+	origin string, record *originSession, windows [numBudgets]Window, now time.Time,
+) OriginStats {
+	stats := OriginStats{
+		Origin: origin,
+		Used:   make(map[string]int64, numBudgets),
+		Limits: make(map[string]int64, numBudgets),
+	}
+	for budget := txBudget(0); budget < numBudgets; budget++ {
+		session := record.budgets[budget]
+		window := windows[budget]
+		session.advance(window.Mode, window.Duration, now, NopMetrics(), budget)
+		used := session.count(window.Mode, window.Duration, now)
+		stats.Used[budget.String()] = used
+		stats.Limits[budget.String()] = session.limit
+		if session.limit <= 0 || isUnlimited(session.limit) || used < t.burstCeiling(budget, session.limit) {
+			continue
+		}
+		if until := roundUpUnix(session.retryAt(window.Mode, window.Duration, session.limit, 1)); until > stats.ThrottledUntil {
+			stats.ThrottledUntil = until
+		}
+	}
+	if now.Before(record.cooldownEnds()) {
+		stats.CooldownEnds = roundUpUnix(record.cooldownEnds())
+	}
+	return stats
+}
+
+// Returns when the origin can send txs again.
+func (s *OriginStats) resetsAt() int64 {
+	if s.CooldownEnds > s.ThrottledUntil {
+		return s.CooldownEnds
+	}
+	return s.ThrottledUntil
+}
@@ -0,0 +1,79 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestAdminStats(t *testing.T) {
+	admin := NewAdmin()
+	_, err := admin.Stats(10)
+	require.Equal(t, ErrThrottleNotEnabled, err)
+
+	now := time.Unix(1500000000, 0)
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithClock(ClockFunc(func() time.Time { return now }))(th)
+	WithAdmin(admin)(th)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	callTxID := uint32(types.TxID_CALL)
+
+	nonce := uint64(0)
+	sendTxs := func(from loom.Address, count int64) {
+		for i := int64(0); i < count; i++ {
+			nonce++
+			require.NoError(t, th.throttleTx(state, callBudget, nonce, from, maxCallCount, callTxID, 1))
+		}
+	}
+	sendTxs(origin, maxCallCount)
+	sendTxs(addr1, 2)
+	sendTxs(contract, 1)
+	th.sessionsMtx.Lock()
+	th.sessions[contract.String()].penalty.cooldownEnds = now.Add(time.Hour)
+	th.sessionsMtx.Unlock()
+	now = now.Add(time.Second)
+
+	stats, err := admin.UnsafeThrottleStats(2)
+	require.NoError(t, err)
+	require.Equal(t, string(FixedWindow), stats.Algorithm)
+	require.Equal(t, string(MemorySessionStore), stats.Store)
+	require.True(t, stats.InMemory)
+	require.Equal(t, int64(maxCallCount), stats.MaxCallCount)
+	require.Equal(t, int64(sessionDuration), stats.SessionDuration)
+	require.Equal(t, 3, stats.TrackedOrigins)
+
+	// Only the requested number of origins are listed, the heaviest users first.
+	require.Len(t, stats.TopOrigins, 2)
+	require.Equal(t, origin.String(), stats.TopOrigins[0].Origin)
+	require.Equal(t, int64(maxCallCount), stats.TopOrigins[0].Used["call"])
+	require.Equal(t, int64(maxCallCount), stats.TopOrigins[0].Limits["call"])
+	require.Equal(t, addr1.String(), stats.TopOrigins[1].Origin)
+	require.Equal(t, int64(2), stats.TopOrigins[1].Used["call"])
+
+	// Origins that have reached their limit or are in a cooldown are listed with their reset times,
+	// the latest first.
+	require.Equal(t, 2, stats.ThrottledOrigins)
+	require.Len(t, stats.Throttled, 2)
+	require.Equal(t, contract.String(), stats.Throttled[0].Origin)
+	require.Equal(t, now.Add(time.Hour-time.Second).Unix(), stats.Throttled[0].CooldownEnds)
+	require.Equal(t, origin.String(), stats.Throttled[1].Origin)
+	require.Equal(t, now.Add(time.Duration(sessionDuration-1)*time.Second).Unix(), stats.Throttled[1].ThrottledUntil)
+
+	// Taking the stats doesn't modify the session records.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	stats, err = admin.Stats(MaxStatsOrigins + 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), stats.TopOrigins[0].Used["call"])
+	require.Equal(t, 1, stats.ThrottledOrigins)
+	th.sessionsMtx.RLock()
+	require.Equal(t, int64(maxCallCount), th.sessions[origin.String()].budgets[callBudget].accessCount)
+	th.sessionsMtx.RUnlock()
+}
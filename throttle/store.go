@@ -0,0 +1,248 @@
+package throttle
+
+import (
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/loomchain"
+)
+
+// Window describes the sessions of one of the tx budgets of an origin.
+type Window struct {
+	// Budget the txs are counted against: call | deploy | bytes
+	Budget string
+	// How txs are grouped into sessions.
+	Mode WindowMode
+	// How long each session lasts, in leaky bucket mode how long it takes the bucket to leak one
+	// unit of cost.
+	Duration time.Duration
+}
+
+// Returns the window of the sessions of the given budget.
+func (t *Throttle) window(budget txBudget) Window {
+	if t.windowMode == LeakyBucket && budget == callBudget {
+		return Window{Budget: budget.String(), Mode: LeakyBucket, Duration: t.leakInterval}
+	}
+	return Window{Budget: budget.String(), Mode: t.sessionWindowMode(), Duration: t.sessionPeriod(budget)}
+}
+
+// Returns the mode of the sessions that group txs into windows, the leaky bucket only applies to
+// the call budget of each origin, so in leaky bucket mode the other sessions use fixed windows.
+func (t *Throttle) sessionWindowMode() WindowMode {
+	if t.windowMode == LeakyBucket {
+		return FixedWindow
+	}
+	return t.windowMode
+}
+
+// Returns the budget with the given name.
+func budgetOf(name string) txBudget {
+	for budget := txBudget(0); budget < numBudgets; budget++ {
+		if budget.String() == name {
+			return budget
+		}
+	}
+	return callBudget
+}
+
+// TxCharge describes a tx counted against one of the tx budgets of an origin.
+type TxCharge struct {
+	// Nonce & ID of the tx, a tx with the same nonce & ID as the last one counted against the budget
+	// is only counted once.
+	Nonce uint64
+	TxID  uint32
+	// How much of the budget the tx consumes.
+	Cost int64
+	// Limit of the origin, only used to report the utilization of the session once it ends.
+	Limit int64
+}
+
+// Usage describes the current session of one of the tx budgets of an origin.
+type Usage struct {
+	// When the current session started, the zero time if the origin has no session.
+	Start time.Time
+	// Total cost of the txs counted during the current session, in leaky bucket mode the level of
+	// the bucket in micro-units as of Start.
+	Count int64
+	// Total cost of the txs counted during the previous session, only tracked in sliding window mode.
+	PrevCount int64
+}
+
+func usageOf(session *budgetSession) Usage {
+	return Usage{Start: session.start, Count: session.accessCount, PrevCount: session.prevAccessCount}
+}
+
+func (u Usage) session() budgetSession {
+	return budgetSession{start: u.Start, accessCount: u.Count, prevAccessCount: u.PrevCount}
+}
+
+// Returns the total cost of the txs counted in the last session duration as of the given time (see
+// budgetSession.count).
+func (u Usage) total(window Window, now time.Time) int64 {
+	s := u.session()
+	return s.count(window.Mode, window.Duration, now)
+}
+
+// Returns the earliest time at which another tx with the given cost can be counted without exceeding
+// the given limit (see budgetSession.retryAt).
+func (u Usage) retryAt(window Window, limit int64, cost int64) time.Time {
+	s := u.session()
+	return s.retryAt(window.Mode, window.Duration, limit, cost)
+}
+
+// ThrottleStore keeps the session records of the origins a throttle tracks in time session mode.
+// Every operation is atomic, so a tx is checked & charged in a single call.
+type ThrottleStore interface {
+	// Now returns the time sessions are measured against as of the given state.
+	Now(state loomchain.State) time.Time
+	// Get returns the usage of the given window by the given origin as of the given time, without
+	// modifying the records of the origin.
+	Get(state loomchain.State, origin loom.Address, window Window, now time.Time) Usage
+	// IncrementWithCost counts the given tx against the given window of the given origin, starting a
+	// new session first if the current one has ended as of the given time, and returns the usage of
+	// the window including the tx. The tx isn't counted again if it's the last one counted against
+	// the window.
+	IncrementWithCost(state loomchain.State, origin loom.Address, window Window, tx TxCharge, now time.Time) Usage
+	// Refund undoes the counting of the given tx against the given window of the given origin, if
+	// it's the last one counted against the window.
+	Refund(state loomchain.State, origin loom.Address, window Window, nonce uint64, txID uint32)
+	// Reset discards all the records of the given origin, and returns false if it had none.
+	Reset(state loomchain.State, origin loom.Address) bool
+	// Expire discards the records of the given origin if all its sessions have ended as of the given
+	// time, and returns true if they were discarded.
+	Expire(state loomchain.State, origin loom.Address, now time.Time) bool
+}
+
+// Keeps session records in the memory of the node, timed by the clock of the throttle. The state
+// passed to each operation is ignored.
+type memoryStore struct {
+	throttle *Throttle
+}
+
+func (s *memoryStore) Now(state loomchain.State) time.Time {
+	return s.throttle.clock.Now()
+}
+
+func (s *memoryStore) Get(state loomchain.State, origin loom.Address, window Window, now time.Time) Usage {
+	t := s.throttle
+	t.sessionsMtx.RLock()
+	defer t.sessionsMtx.RUnlock()
+
+	record, ok := t.sessions[t.originString(origin)]
+	if !ok {
+		return Usage{}
+	}
+	// The copy of the session is advanced so the stored record isn't modified.
+	session := record.budgets[budgetOf(window.Budget)]
+	session.advance(window.Mode, window.Duration, now, NopMetrics(), budgetOf(window.Budget))
+	return usageOf(&session)
+}
+
+func (s *memoryStore) IncrementWithCost(
+	state loomchain.State, origin loom.Address, window Window, tx TxCharge, now time.Time,
+) Usage {
+	t := s.throttle
+	session := t.countSession(budgetOf(window.Budget), t.originString(origin), tx.Nonce, tx.TxID, tx.Cost, tx.Limit, now)
+	return usageOf(&session)
+}
+
+func (s *memoryStore) Refund(state loomchain.State, origin loom.Address, window Window, nonce uint64, txID uint32) {
+	t := s.throttle
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	if record, ok := t.sessions[t.originString(origin)]; ok {
+		record.budgets[budgetOf(window.Budget)].refund(nonce, txID)
+	}
+}
+
+func (s *memoryStore) Reset(state loomchain.State, origin loom.Address) bool {
+	return s.throttle.resetOrigin(origin)
+}
+
+func (s *memoryStore) Expire(state loomchain.State, origin loom.Address, now time.Time) bool {
+	t := s.throttle
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	record, ok := t.sessions[origin.String()]
+	if !ok || !t.isIdle(record, now) {
+		return false
+	}
+	t.evictSession(origin.String(), record, idleEviction)
+	t.metrics.TrackedOrigins.Set(float64(len(t.sessions)))
+	return true
+}
+
+// Keeps session records in the app state, timed by the block time (see StateSessionStore).
+type stateStore struct {
+	throttle *Throttle
+}
+
+func (s *stateStore) Now(state loomchain.State) time.Time {
+	return time.Unix(state.Block().Time, 0)
+}
+
+func (s *stateStore) Get(state loomchain.State, origin loom.Address, window Window, now time.Time) Usage {
+	record := decodeOriginSession(state.Get(stateSessionKey(origin)))
+	if record == nil {
+		return Usage{}
+	}
+	session := record.budgets[budgetOf(window.Budget)]
+	session.advance(window.Mode, window.Duration, now, NopMetrics(), budgetOf(window.Budget))
+	return usageOf(&session)
+}
+
+func (s *stateStore) IncrementWithCost(
+	state loomchain.State, origin loom.Address, window Window, tx TxCharge, now time.Time,
+) Usage {
+	t := s.throttle
+	key := stateSessionKey(origin)
+	record := decodeOriginSession(state.Get(key))
+	// Records are cleaned up lazily, once all the sessions of an origin have ended its record is
+	// discarded the next time the origin sends a tx.
+	if record != nil && t.isIdle(record, now) {
+		t.endSessions(record)
+		record = nil
+	}
+	if record == nil {
+		record = &originSession{}
+	}
+	record.lastAccess = now
+
+	budget := budgetOf(window.Budget)
+	session := &record.budgets[budget]
+	t.countSessionTx(session, budget, tx.Nonce, tx.TxID, tx.Cost, tx.Limit, now)
+	state.Set(key, encodeOriginSession(record))
+	return usageOf(session)
+}
+
+func (s *stateStore) Refund(state loomchain.State, origin loom.Address, window Window, nonce uint64, txID uint32) {
+	key := stateSessionKey(origin)
+	record := decodeOriginSession(state.Get(key))
+	if record == nil {
+		return
+	}
+	record.budgets[budgetOf(window.Budget)].refund(nonce, txID)
+	state.Set(key, encodeOriginSession(record))
+}
+
+func (s *stateStore) Reset(state loomchain.State, origin loom.Address) bool {
+	key := stateSessionKey(origin)
+	if !state.Has(key) {
+		return false
+	}
+	state.Delete(key)
+	return true
+}
+
+func (s *stateStore) Expire(state loomchain.State, origin loom.Address, now time.Time) bool {
+	key := stateSessionKey(origin)
+	record := decodeOriginSession(state.Get(key))
+	if record == nil || !s.throttle.isIdle(record, now) {
+		return false
+	}
+	s.throttle.endSessions(record)
+	state.Delete(key)
+	return true
+}
@@ -0,0 +1,95 @@
+// +build evm
+
+package throttle
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestMemoryThrottleStore(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithClock(clock)(th)
+	testThrottleStore(t, th, clock, func(now time.Time) loomchain.State { return nil })
+
+	// Concurrent txs are all counted.
+	window := th.window(callBudget)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(nonce uint64) {
+			defer wg.Done()
+			th.store.IncrementWithCost(nil, addr1, window, TxCharge{Nonce: nonce, TxID: 1, Cost: 1, Limit: 100}, clock.Now())
+		}(uint64(i + 1))
+	}
+	wg.Wait()
+	require.Equal(t, int64(50), th.store.Get(nil, addr1, window, clock.Now()).Count)
+}
+
+func TestStateThrottleStore(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithSessionStore(StateSessionStore)(th)
+	memStore := store.NewMemStore()
+	testThrottleStore(t, th, clock, func(now time.Time) loomchain.State {
+		return loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1, Time: now}, nil, nil)
+	})
+}
+
+// Checks the behavior every ThrottleStore must conform to, stateAt returns the state as of the
+// given time.
+func testThrottleStore(t *testing.T, th *Throttle, clock *fakeClock, stateAt func(now time.Time) loomchain.State) {
+	s := th.store
+	window := th.window(callBudget)
+	now := clock.Now()
+	state := stateAt(now)
+	require.Equal(t, now, s.Now(state))
+	charge := func(nonce uint64, cost int64) Usage {
+		return s.IncrementWithCost(state, origin, window, TxCharge{Nonce: nonce, TxID: 1, Cost: cost, Limit: maxCallCount}, now)
+	}
+
+	require.Equal(t, Usage{}, s.Get(state, origin, window, now))
+	require.Equal(t, Usage{Start: now, Count: 2}, charge(1, 2))
+	// The last tx isn't counted twice...
+	require.Equal(t, Usage{Start: now, Count: 2}, charge(1, 2))
+	// ...and reading the usage doesn't count anything.
+	require.Equal(t, Usage{Start: now, Count: 3}, charge(2, 1))
+	require.Equal(t, Usage{Start: now, Count: 3}, s.Get(state, origin, window, now))
+	// Other budgets & origins are counted separately.
+	require.Equal(t, int64(0), s.Get(state, origin, th.window(deployBudget), now).Count)
+	require.Equal(t, Usage{}, s.Get(state, addr1, window, now))
+
+	// Only the last tx can be refunded.
+	s.Refund(state, origin, window, 1, 1)
+	require.Equal(t, int64(3), s.Get(state, origin, window, now).Count)
+	s.Refund(state, origin, window, 2, 1)
+	require.Equal(t, int64(2), s.Get(state, origin, window, now).Count)
+
+	// A new session starts once the current one ends.
+	require.False(t, s.Expire(state, origin, now))
+	later := now.Add(window.Duration)
+	clock.now = later
+	state = stateAt(later)
+	require.Equal(t, Usage{Start: later}, s.Get(state, origin, window, later))
+	require.Equal(t, Usage{Start: later, Count: 1}, s.IncrementWithCost(
+		state, origin, window, TxCharge{Nonce: 3, TxID: 1, Cost: 1, Limit: maxCallCount}, later,
+	))
+
+	// The records of an origin are only expired once all its sessions have ended.
+	require.False(t, s.Expire(state, origin, later))
+	end := later.Add(window.Duration)
+	require.True(t, s.Expire(stateAt(end), origin, end))
+	require.Equal(t, Usage{}, s.Get(stateAt(end), origin, window, end))
+
+	s.IncrementWithCost(state, origin, window, TxCharge{Nonce: 4, TxID: 1, Cost: 1, Limit: maxCallCount}, later)
+	require.True(t, s.Reset(state, origin))
+	require.False(t, s.Reset(state, origin))
+	require.Equal(t, Usage{}, s.Get(state, origin, window, later))
+}
@@ -1,108 +1,839 @@
 package throttle
 
 import (
-	"context"
+	"container/list"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
-	"github.com/pkg/errors"
-
-	"github.com/ulule/limiter"
-	"github.com/ulule/limiter/drivers/store/memory"
-
 	"github.com/loomnetwork/go-loom"
 	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
 	"github.com/loomnetwork/go-loom/common"
 	"github.com/loomnetwork/go-loom/plugin/contractpb"
 	"github.com/loomnetwork/loomchain"
-	"github.com/loomnetwork/loomchain/auth"
 	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/log"
+	"github.com/pkg/errors"
 )
 
-type Throttle struct {
-	maxCallCount         int64
-	sessionDuration      int64
-	callLimiterPool      map[string]*limiter.Limiter
-	deployLimiterPool    map[string]*limiter.Limiter
-	karmaContractAddress loom.Address
+// DefaultMaxTrackedOrigins is the default max number of origins the throttle keeps session records
+// for, once the limit is reached the records of idle origins are evicted to make room for new ones.
+const DefaultMaxTrackedOrigins = 100000
+
+// Unlimited is the limit of a budget that doesn't limit the txs an origin can send. A zero limit is
+// treated as Unlimited too, since that's how configs written before Unlimited existed disable a
+// limit, but the constructors reject any other negative limit as a likely typo.
+const Unlimited int64 = -1
+
+func isUnlimited(limit int64) bool {
+	return limit <= 0
+}
+
+// txBudget identifies a budget txs are counted against, each budget has its own limit & session
+// duration. The call & deploy budgets count txs (weighted by their cost), the bytes budget counts
+// the size of all the txs of an origin and shares the session duration of the call budget.
+type txBudget int
+
+const (
+	callBudget txBudget = iota
+	deployBudget
+	bytesBudget
+	numBudgets
+)
+
+func (b txBudget) String() string {
+	switch b {
+	case deployBudget:
+		return "deploy"
+	case bytesBudget:
+		return "bytes"
+	}
+	return "call"
+}
+
+// Describes what the limit of the given budget is a limit on, for error messages.
+func budgetUnits(budget string) string {
+	if budget == bytesBudget.String() {
+		return "bytes of txs"
+	}
+	if budget == DailyDeployBudget || budget == DeployBucketBudget {
+		return "deploy txs"
+	}
+	return budget + " txs"
+}
+
+// TxLimitReachedErrorPrefix is the prefix of the message of every TxLimitReachedError, so clients
+// that only have access to the message can still detect the error.
+const TxLimitReachedErrorPrefix = "tx limit reached"
+
+// ErrorMessageVersion is incremented whenever the format of the messages of the errors the throttle
+// rejects txs with changes. The messages are meant for humans, clients should rely on the ABCI codes
+// & the message prefixes rather than parsing the rest of the messages.
+const ErrorMessageVersion = 2
+
+// Describes when a throttled origin can retry, the wait is rounded up to the second so it's never
+// too short.
+func retryIn(wait time.Duration, retryAfter int64) string {
+	if wait < 0 {
+		wait = 0
+	}
+	wait = (wait + time.Second - 1) / time.Second * time.Second
+	return fmt.Sprintf("retry in %v (after %d)", wait, retryAfter)
+}
+
+// Describes when an origin throttled in block session mode can retry.
+func retryInBlocks(blocks int64, retryAfterHeight int64) string {
+	return fmt.Sprintf("retry in %d blocks (at block %d)", blocks, retryAfterHeight)
+}
+
+// Appends the help text configured by the operator to the message of an error, see WithHelpText.
+func withHelp(msg string, help string) string {
+	if help == "" {
+		return msg
+	}
+	return msg + ". " + logSafe(help)
+}
+
+// Sets the help text of the given error if it's one of the errors the throttle rejects txs with.
+func (t *Throttle) addHelp(err error) {
+	if t.helpText == "" {
+		return
+	}
+	switch e := err.(type) {
+	case *TxLimitReachedError:
+		e.Help = t.helpText
+	case *TxCostExceedsLimitError:
+		e.Help = t.helpText
+	case *ContractTxLimitReachedError:
+		e.Help = t.helpText
+	case *OriginCooldownError:
+		e.Help = t.helpText
+	case *BlockTxLimitReachedError:
+		e.Help = t.helpText
+	case *DuplicateTxError:
+		e.Help = t.helpText
+	case *FailureCooldownError:
+		e.Help = t.helpText
+	case *DeployTooLargeError:
+		e.Help = t.helpText
+	case *MaintenanceModeError:
+		e.Help = t.helpText
+	}
+}
+
+// TxLimitReachedError is returned when an origin has used up one of its tx budgets for the current
+// session.
+type TxLimitReachedError struct {
+	Origin loom.Address
+	// Budget that ran out: call | deploy limit the number of txs, bytes limits their total size,
+	// daily_deploy limits the number of deploy txs per day, deploy_bucket limits the number of deploy
+	// txs of a given size per deploy session
+	Budget string
+	// Max total cost (or size) of the txs the origin can send per session.
+	Limit int64
+	// Total cost of the txs accepted from the origin during the current session.
+	Used int64
+	// How long each session lasts, zero if sessions are measured in blocks or the budget is a leaky
+	// bucket.
+	Window time.Duration
+	// How long it takes the bucket of the origin to leak a tx, zero unless the budget is a leaky
+	// bucket, in which case Limit is the capacity of the bucket.
+	LeakInterval time.Duration
+	// Unix timestamp (in seconds) from which the origin can send another tx, zero if sessions are
+	// measured in blocks.
+	RetryAfter int64
+	// How long the origin has to wait until RetryAfter, as of the rejected tx.
+	RetryIn time.Duration
+	// How many blocks each session lasts, zero if sessions are measured in seconds.
+	WindowBlocks int64
+	// Height of the block from which the origin can send another tx, zero if sessions are measured
+	// in seconds.
+	RetryAfterHeight int64
+	// How many blocks the origin has to wait until RetryAfterHeight, as of the rejected tx.
+	RetryInBlocks int64
+	// True if the origin has also used up its burst credit, in which case Limit is the burst ceiling.
+	Burst bool
+	// Unix timestamp (in seconds) from which the origin can draw on its burst credit again, zero if
+	// it has no burst credit or it hasn't drawn on it.
+	BurstAvailableAt int64
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func newTxLimitReachedError(
+	budget txBudget, origin loom.Address, limit int64, count int64, cost int64, retryAt time.Time,
+	window time.Duration, now time.Time,
+) *TxLimitReachedError {
+	// count includes the cost of the rejected tx, and of any txs rejected earlier in the session
+	used := count - cost
+	if used > limit {
+		used = limit
+	}
+	return &TxLimitReachedError{
+		Origin: origin,
+		Budget: budget.String(),
+		Limit:  limit,
+		Used:   used,
+		Window: window,
+		// Rounded up so that retrying at RetryAfter is never too early
+		RetryAfter: roundUpUnix(retryAt),
+		RetryIn:    retryAt.Sub(now),
+	}
+}
+
+// Makes the error describe the given window if it's a leaky bucket rather than a session.
+func (e *TxLimitReachedError) inWindow(window Window) *TxLimitReachedError {
+	if window.Mode == LeakyBucket {
+		e.Window = 0
+		e.LeakInterval = window.Duration
+	}
+	return e
+}
+
+func (e *TxLimitReachedError) Error() string {
+	if e.LeakInterval > 0 {
+		return withHelp(fmt.Sprintf(
+			"%s: origin %s used %d of the %d %s its bucket holds, which leaks one every %v, %s",
+			TxLimitReachedErrorPrefix, e.Origin, e.Used, e.Limit, budgetUnits(e.Budget), e.LeakInterval,
+			retryIn(e.RetryIn, e.RetryAfter),
+		), e.Help)
+	}
+	if e.WindowBlocks > 0 {
+		return withHelp(fmt.Sprintf(
+			"%s: origin %s used %d of %d %s allowed per %d block session, %s",
+			TxLimitReachedErrorPrefix, e.Origin, e.Used, e.Limit, budgetUnits(e.Budget), e.WindowBlocks,
+			retryInBlocks(e.RetryInBlocks, e.RetryAfterHeight),
+		), e.Help)
+	}
+	if e.Burst {
+		return withHelp(fmt.Sprintf(
+			"%s: origin %s used its burst of %d %s allowed per %v session, %s",
+			TxLimitReachedErrorPrefix, e.Origin, e.Limit, budgetUnits(e.Budget), e.Window,
+			retryIn(e.RetryIn, e.RetryAfter),
+		), e.Help)
+	}
+	msg := fmt.Sprintf(
+		"%s: origin %s used %d of %d %s allowed per %v session, %s",
+		TxLimitReachedErrorPrefix, e.Origin, e.Used, e.Limit, budgetUnits(e.Budget), e.Window,
+		retryIn(e.RetryIn, e.RetryAfter),
+	)
+	if e.BurstAvailableAt > 0 {
+		msg += fmt.Sprintf(", burst available again after %d", e.BurstAvailableAt)
+	}
+	return withHelp(msg, e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *TxLimitReachedError) ABCICode() uint32 {
+	if e.Budget == bytesBudget.String() {
+		return TxBytesLimitReachedCode
+	}
+	return TxLimitReachedCode
+}
+
+// budgetSession tracks the txs sent by an origin during the current session of a single budget.
+type budgetSession struct {
+	// When the current session started.
+	start time.Time
+	// Total cost of the txs sent by the origin during the current session. In leaky bucket mode the
+	// level of the bucket in micro-units, and start is when the bucket was last drained.
+	accessCount int64
+	// Total cost of the txs sent by the origin during the previous session, only tracked in sliding
+	// window mode.
+	prevAccessCount int64
+	// Limit of the origin during the current session, as of the last tx.
+	limit int64
+	// Nonce & ID of the last tx sent by the origin, used to avoid counting the same tx twice.
+	lastNonce uint64
+	lastTxID  uint32
+	// Cost of the last tx sent by the origin (in the units of accessCount), refunded if the tx fails.
+	lastCost int64
+}
+
+// originSession tracks the txs sent by a single origin against each budget.
+type originSession struct {
+	// When the origin last sent a tx.
+	lastAccess time.Time
+	// Position of the origin in Throttle.activity, nil if the record isn't kept in memory.
+	activity *list.Element
+	budgets  [numBudgets]budgetSession
+	// Only tracked in memory, see penaltyEnabled.
+	penalty penaltyState
+	// Only tracked in memory, see failureCooldownEnabled.
+	failures failureState
+	// Hashes of the txs recently sent by the origin, nil if duplicate txs aren't detected.
+	recentTxs *recentTxs
+	// Start of the call session in which the origin last drew on its burst credit, the zero time if
+	// it never has.
+	burstDrawn time.Time
+}
 
-	lastAddress        string
-	lastLimiterContext limiter.Context
-	lastNonce          uint64
-	lastId             uint32
+type Throttle struct {
+	// Limits, session durations & exempt origins, guarded by paramsMtx since they may be updated at
+	// runtime from the app state.
+	params    throttleParams
+	paramsMtx sync.RWMutex
+	// Tracks the on-chain params, nil if on-chain params are disabled.
+	onChainParams *onChainParamsCache
+	// When maintenance mode was last switched, the zero time if it hasn't been since the throttle was
+	// created. Guarded by paramsMtx.
+	maintenanceSince time.Time
+	// Resolves the call limit of each origin, nil if the call limit is params.maxCallCount.
+	callLimits LimitResolver
+	// Composition of the keys origins are tracked under, nil if origins are tracked under their own
+	// address.
+	key *throttleKey
+	// Exempts the oracle registered in the state of a contract, nil if disabled.
+	oracleBypass *oracleBypass
+	// Policies of specific origins keyed by address, immutable once the middleware is created.
+	originOverrides map[string]OriginOverride
+	// Limits of specific origins managed by a contract, nil if disabled.
+	limitTable *originLimitTable
+	// Boosts the call limit of origins by the amount they've delegated, nil if disabled.
+	delegationBoost *delegationBoost
+	// Exempts validators or gives them their own call limit, nil if disabled.
+	validatorBypass *validatorBypass
+	// Resolver whose base limit tracks params.maxCallCount, nil if call limits are resolved otherwise.
+	karmaLimits       *KarmaLimitResolver
+	maxTrackedOrigins int
+	// When the records of idle origins were last swept, guarded by sessionsMtx.
+	lastSweep  time.Time
+	windowMode WindowMode
+	// How long it takes the bucket of each origin to leak a call tx in leaky bucket mode.
+	leakInterval        time.Duration
+	sessionMode         SessionMode
+	sessionBlocks       int64
+	deploySessionBlocks int64
+	sessionStore        SessionStoreKind
+	// Keeps the session records in time session mode, selected by sessionStore unless a custom store
+	// is set.
+	store ThrottleStore
+	// Phase of tx processing txs are counted in, empty if txs are counted in both phases against the
+	// same session records.
+	countMode CountMode
+	// Counts txs in CheckTx against separate budgets kept in memory, nil unless txs are counted in
+	// both phases separately.
+	checkTx        *Throttle
+	countFailedTxs bool
+	// When txs are charged against the limits of their origin, see postCharging.
+	chargeMode ChargeMode
+	// Guarded by paramsMtx since it may be reloaded at runtime.
+	txCost TxCostFunc
+	logger log.TMLogger
+	// Log allowed txs, false if the logger discards everything.
+	logAllowed bool
+	// Limits the throttled txs that are logged, nil if all of them are logged.
+	logSampler *logSampler
+	// Appended to the messages of the errors txs are rejected with, empty if there's none.
+	helpText string
+	// Add the quota the origin has left to the tags of the results of the txs it sends.
+	resultTags bool
+	// Add the state of the throttle to the results of the txs it rejects in CheckTx.
+	rejectionInfo bool
+	// Lets origins exceed their call limit once in a while, nil if disabled.
+	burst *burstPolicy
+	// Puts origins that keep sending txs over their limits into a cooldown, nil if disabled.
+	penalty *penaltyPolicy
+	// Puts origins whose txs keep failing into a cooldown, nil if disabled.
+	failures *failurePolicy
+	// Max total size in bytes of the txs each origin can send per call session, non-positive if the
+	// size of txs isn't limited. Guarded by paramsMtx since it may be reloaded at runtime.
+	maxTxBytes int64
+	// Config the throttle was created from, updated when it's reloaded, nil if the throttle wasn't
+	// created from a config. Guarded by paramsMtx.
+	config *ThrottleConfig
+	// Max number of deploy txs each origin can send per day, counted in the app state, non-positive if
+	// there's no daily limit.
+	maxDailyDeployCount int64
+	// Throttle deploy txs by the size of their bytecode, sorted by MinBytes, empty if deploy txs are
+	// throttled regardless of their size.
+	deployBuckets []DeployBucket
+	// Max number of recent tx hashes kept per origin to detect duplicate txs, zero if duplicate txs
+	// aren't detected.
+	maxRecentTxs int
+	// Caps the number of txs each origin can have in a single block, nil if disabled.
+	blockTxCap *blockTxCap
+	// Limits on the call txs sent to each contract, nil if disabled.
+	contractLimits *contractLimits
+	// Call limits granted to origins by bypass tokens, nil if bypass tokens aren't accepted.
+	bypass *bypassTokens
+	// Writes throttling decisions to an audit sink, nil if there's no audit sink.
+	audit *auditLog
+	// Times the sessions kept in memory.
+	clock Clock
+	// Session records keyed by origin address, guarded by sessionsMtx since CheckTx may be invoked
+	// concurrently.
+	sessions map[string]*originSession
+	// Addresses of the origins in sessions ordered by when they last sent a tx, most recent first,
+	// guarded by sessionsMtx.
+	activity *list.List
+	// Determines how new origins are treated once sessions holds maxTrackedOrigins records, nil if
+	// the least recently active origin is evicted without raising an alert.
+	pressure *pressurePolicy
+	// Snapshots the session records kept in memory to a file, nil if disabled.
+	snapshots *snapshotter
+	// Contract session records kept in memory keyed by contractSessionKey, guarded by sessionsMtx.
+	contractSessions map[string]*budgetSession
+	// Records of evicted origins kept to be reused by new origins, guarded by sessionsMtx.
+	spareSessions []*originSession
+	sessionsMtx   sync.RWMutex
+	originStrings originStrings
+	metrics       *Metrics
 }
 
+// NewThrottle creates a throttle that limits the number of call & deploy txs each origin can send
+// per session, the session durations are in seconds. If deploySessionDuration is zero deploy
+// sessions last as long as call sessions.
 func NewThrottle(
 	sessionDuration int64,
 	maxCallCount int64,
+	deploySessionDuration int64,
+	maxDeployCount int64,
 ) *Throttle {
-	return &Throttle{
-		maxCallCount:         maxCallCount,
-		sessionDuration:      sessionDuration,
-		callLimiterPool:      make(map[string]*limiter.Limiter),
-		deployLimiterPool:    make(map[string]*limiter.Limiter),
-		karmaContractAddress: loom.Address{},
+	if deploySessionDuration == 0 {
+		deploySessionDuration = sessionDuration
+	}
+	t := &Throttle{
+		params: throttleParams{
+			maxCallCount:          maxCallCount,
+			sessionDuration:       sessionDuration,
+			maxDeployCount:        maxDeployCount,
+			deploySessionDuration: deploySessionDuration,
+		},
+		maxTrackedOrigins: DefaultMaxTrackedOrigins,
+		windowMode:        FixedWindow,
+		sessionMode:       TimeSessions,
+		sessionStore:      MemorySessionStore,
+		sessions:          make(map[string]*originSession),
+		activity:          list.New(),
+		contractSessions:  make(map[string]*budgetSession),
+		metrics:           NopMetrics(),
+		logger:            nopLogger(),
+		clock:             SystemClock(),
 	}
+	t.store = &memoryStore{throttle: t}
+	return t
 }
 
-func (t *Throttle) getNewLimiter(ctx context.Context, limit int64) *limiter.Limiter {
-	rate := limiter.Rate{
-		Period: time.Duration(t.sessionDuration) * time.Second,
-		Limit:  limit,
+// Checks the limits & session durations the throttle was created with, once its options have been
+// applied. limitedCalls should be true if call limits are resolved by a custom resolver, which may
+// limit calls even if maxCallCount is unlimited.
+func (t *Throttle) validateArgs(limitedCalls bool) error {
+	if t.params.maxCallCount < Unlimited {
+		return errors.Errorf("maxCallCount %d must be positive, or zero or Unlimited for no limit", t.params.maxCallCount)
+	}
+	if t.params.maxDeployCount < Unlimited {
+		return errors.Errorf(
+			"maxDeployCount %d must be positive, or zero or Unlimited for no limit", t.params.maxDeployCount,
+		)
+	}
+	if t.params.sessionDuration < 0 {
+		return errors.Errorf("sessionDuration %d must not be negative", t.params.sessionDuration)
+	}
+	if t.params.deploySessionDuration < 0 {
+		return errors.Errorf("deploySessionDuration %d must not be negative", t.params.deploySessionDuration)
+	}
+	limited := limitedCalls || !isUnlimited(t.params.maxCallCount) || !isUnlimited(t.params.maxDeployCount)
+	switch t.sessionMode {
+	case TimeSessions:
+		// Zero length sessions would end as soon as they start, so nothing would ever be limited.
+		if limited && t.params.sessionDuration == 0 {
+			return errors.New("sessionDuration must be positive in time session mode")
+		}
+	case BlockSessions:
+		if t.sessionBlocks <= 0 {
+			return errors.Errorf("sessionBlocks %d must be positive in block session mode", t.sessionBlocks)
+		}
+		if t.deploySessionBlocks < 0 {
+			return errors.Errorf("deploySessionBlocks %d must not be negative", t.deploySessionBlocks)
+		}
 	}
-	limiterStore := memory.NewStore()
-	return limiter.New(limiterStore, rate)
+	return nil
 }
 
-func (t *Throttle) getLimiterFromPool(ctx context.Context, limit int64) *limiter.Limiter {
-	address := auth.Origin(ctx).String()
-	_, ok := t.callLimiterPool[address]
-	if !ok {
-		t.callLimiterPool[address] = t.getNewLimiter(ctx, limit)
+// Restores the session records from the snapshot & starts writing the audit log, once the options of
+// the throttle have been applied & validated.
+func (t *Throttle) start() {
+	t.restoreSnapshot()
+	if t.audit != nil {
+		go t.audit.run()
+	}
+}
+
+// Returns the duration (in seconds) of the sessions of the given budget.
+func (t *Throttle) budgetSessionDuration(budget txBudget) int64 {
+	params := t.currentParams()
+	if budget == deployBudget {
+		return params.deploySessionDuration
+	}
+	return params.sessionDuration
+}
+
+func (t *Throttle) sessionPeriod(budget txBudget) time.Duration {
+	return time.Duration(t.budgetSessionDuration(budget)) * time.Second
+}
+
+// Returns true if the sessions of all the budgets of the given origin have ended, and the origin isn't
+// in a cooldown, tracking recent txs or recovering its burst credit. In sliding window mode a session
+// that has ended still counts towards the limit until the next session ends too, in leaky bucket mode
+// the bucket must be empty.
+func (t *Throttle) isIdle(session *originSession, now time.Time) bool {
+	if now.Before(session.penalty.cooldownEnds) || now.Before(session.failures.cooldownEnds) {
+		return false
+	}
+	if session.recentTxs != nil && now.Sub(session.recentTxs.start) < t.sessionPeriod(callBudget) {
+		return false
+	}
+	if t.burst != nil && !session.burstDrawn.IsZero() && now.Sub(session.burstDrawn) < t.burstRecovery() {
+		return false
 	}
-	if t.callLimiterPool[address].Rate.Limit != limit {
-		delete(t.callLimiterPool, address)
-		t.callLimiterPool[address] = t.getNewLimiter(ctx, limit)
+	for budget := txBudget(0); budget < numBudgets; budget++ {
+		window := t.window(budget)
+		if window.Mode == LeakyBucket {
+			if session.budgets[budget].count(window.Mode, window.Duration, now) > 0 {
+				return false
+			}
+			continue
+		}
+		idlePeriod := window.Duration
+		if window.Mode == SlidingWindow {
+			idlePeriod *= 2
+		}
+		if now.Sub(session.budgets[budget].start) < idlePeriod {
+			return false
+		}
 	}
+	return true
+}
 
-	return t.callLimiterPool[address]
+// Returns the session record of the given origin, creating one if the origin doesn't have one.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) getSession(origin string, now time.Time) *originSession {
+	if now.Sub(t.lastSweep) >= t.sweepInterval() {
+		t.sweepSessions(now)
+	}
+	t.maybeSnapshot(now)
+	session, ok := t.sessions[origin]
+	if !ok {
+		// The record shared by the origins admitted under pressure doesn't count towards the limit.
+		if t.trackedOrigins() >= t.maxTrackedOrigins && origin != pressureSessionKey {
+			t.evictSessions(now)
+		}
+		session = t.newSession(origin, now)
+		t.sessions[origin] = session
+	}
+	return session
 }
 
-func (t *Throttle) getLimiterContext(
-	ctx context.Context, nonce uint64, limit int64, txId uint32, key string,
-) (limiter.Context, error) {
-	address := auth.Origin(ctx).String()
-	if address == t.lastAddress && nonce == t.lastNonce && t.lastId == txId {
-		return t.lastLimiterContext, nil
+// Max number of records of evicted origins kept to be reused.
+const maxSpareSessions = 64
+
+// Returns a blank record for the given origin, reusing the record of an evicted origin if there's
+// one, so origins churning through the store don't allocate a record each.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) newSession(origin string, now time.Time) *originSession {
+	var session *originSession
+	if n := len(t.spareSessions); n > 0 {
+		session = t.spareSessions[n-1]
+		t.spareSessions[n-1] = nil
+		t.spareSessions = t.spareSessions[:n-1]
+		*session = originSession{}
 	} else {
-		t.lastAddress = address
-		t.lastNonce = nonce
-		t.lastId = txId
-		limiterCtx, err := t.getLimiterFromPool(ctx, limit).Get(ctx, key)
-		t.lastLimiterContext = limiterCtx
-		return limiterCtx, err
+		session = &originSession{}
+	}
+	session.lastAccess = now
+	session.activity = t.activity.PushFront(origin)
+	return session
+}
+
+// Records that the origin of the given session record has sent a tx.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) touchSession(session *originSession, now time.Time) {
+	session.lastAccess = now
+	if session.activity != nil {
+		t.activity.MoveToFront(session.activity)
+	}
+}
+
+// Minimum interval between sweeps of the session records, so origins with very short sessions don't
+// trigger a sweep on every tx.
+const minSweepInterval = time.Minute
+
+// Returns how often the records of idle origins are swept, once per call session.
+func (t *Throttle) sweepInterval() time.Duration {
+	if interval := t.sessionPeriod(callBudget); interval > minSweepInterval {
+		return interval
+	}
+	return minSweepInterval
+}
+
+// Evicts the records of all origins whose sessions have ended, and the contract session records that
+// have been idle for a whole session, so the records of origins that only send a tx every now and
+// then don't accumulate.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) sweepSessions(now time.Time) {
+	for origin, session := range t.sessions {
+		if t.isIdle(session, now) {
+			t.evictSession(origin, session, idleEviction)
+		}
+	}
+	idlePeriod := 2 * t.sessionPeriod(callBudget)
+	for key, session := range t.contractSessions {
+		if now.Sub(session.start) >= idlePeriod {
+			delete(t.contractSessions, key)
+		}
+	}
+	t.lastSweep = now
+	t.metrics.TrackedOrigins.Set(float64(len(t.sessions)))
+	if t.trackedOrigins() < t.maxTrackedOrigins {
+		t.metrics.storeSaturated(false)
+	}
+}
+
+// Evicts the record of the origin that has been idle the longest to make room for a new origin, in
+// constant time so origins can't be created faster than they're evicted. An origin whose record is
+// evicted before its sessions end starts new sessions with its next tx.
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) evictSessions(now time.Time) {
+	t.storeSaturated(now)
+	for elem := t.activity.Back(); elem != nil && t.trackedOrigins() >= t.maxTrackedOrigins; {
+		origin := elem.Value.(string)
+		elem = elem.Prev()
+		if origin == pressureSessionKey {
+			continue
+		}
+		session := t.sessions[origin]
+		if t.isIdle(session, now) {
+			t.evictSession(origin, session, idleEviction)
+		} else {
+			t.evictSession(origin, session, pressureEviction)
+		}
+	}
+}
+
+// Reasons session records are evicted for, used as the "reason" label of Metrics.OriginsEvicted.
+const (
+	// All the sessions of the origin have ended.
+	idleEviction = "idle"
+	// Room had to be made for a new origin.
+	pressureEviction = "pressure"
+)
+
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) evictSession(origin string, session *originSession, reason string) {
+	t.endCooldowns(origin, session, t.clock.Now(), true)
+	t.endSessions(session)
+	t.removeSession(origin, session)
+	t.metrics.originEvicted(reason)
+	if len(t.spareSessions) < maxSpareSessions {
+		t.spareSessions = append(t.spareSessions, session)
+	}
+}
+
+// NOTE: t.sessionsMtx must be held by the caller.
+func (t *Throttle) removeSession(origin string, session *originSession) {
+	if session.activity != nil {
+		t.activity.Remove(session.activity)
+	}
+	delete(t.sessions, origin)
+}
+
+// Records the utilization of the sessions of all the budgets of an origin whose record is evicted.
+func (t *Throttle) endSessions(session *originSession) {
+	for budget := txBudget(0); budget < numBudgets; budget++ {
+		// A leaky bucket has no sessions to measure the utilization of.
+		if t.window(budget).Mode != LeakyBucket {
+			t.metrics.sessionEnded(budget, &session.budgets[budget])
+		}
+	}
+}
+
+// Counts a tx with the given cost against the given budget of the given origin, and returns the
+// total cost of the txs the origin has sent during the current session of the budget (or in
+// sliding window mode, during the last session duration). The session expiry check and the
+// update are done atomically. A tx with the same nonce & ID as the last one counted against the
+// budget is only counted once. The limit is only used to compute the utilization of the session.
+func (t *Throttle) countTx(
+	budget txBudget, origin string, nonce uint64, txId uint32, cost int64, limit int64, now time.Time,
+) int64 {
+	session := t.countSession(budget, origin, nonce, txId, cost, limit, now)
+	window := t.window(budget)
+	return session.count(window.Mode, window.Duration, now)
+}
+
+// Counts a tx against the session record kept in memory for the given origin (see countTx), and
+// returns a copy of the session of the given budget including the tx.
+func (t *Throttle) countSession(
+	budget txBudget, origin string, nonce uint64, txId uint32, cost int64, limit int64, now time.Time,
+) budgetSession {
+	t.sessionsMtx.Lock()
+	defer t.sessionsMtx.Unlock()
+
+	originSession := t.getSession(origin, now)
+	t.touchSession(originSession, now)
+	t.metrics.TrackedOrigins.Set(float64(len(t.sessions)))
+
+	session := &originSession.budgets[budget]
+	t.countSessionTx(session, budget, nonce, txId, cost, limit, now)
+	return *session
+}
+
+// Counts a tx against the given session record, starting a new session first if the current one
+// has ended, and returns the total cost of the txs counted against the session (see countTx).
+func (t *Throttle) countSessionTx(
+	session *budgetSession, budget txBudget, nonce uint64, txId uint32, cost int64, limit int64, now time.Time,
+) int64 {
+	window := t.window(budget)
+	session.advance(window.Mode, window.Duration, now, t.metrics, budget)
+	session.limit = limit
+	if window.Mode == LeakyBucket {
+		cost = unitsOfCost(cost)
+	}
+	isRepeatedTx := session.accessCount > 0 && session.lastNonce == nonce && session.lastTxID == txId
+	if !isRepeatedTx {
+		session.accessCount = addCapped(session.accessCount, cost)
+		session.lastNonce = nonce
+		session.lastTxID = txId
+		session.lastCost = cost
+	}
+	return session.count(window.Mode, window.Duration, now)
+}
+
+// Returns a + b, capped at math.MaxInt64 instead of overflowing.
+func addCapped(a int64, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+func (t *Throttle) isExempt(origin loom.Address) bool {
+	t.paramsMtx.RLock()
+	defer t.paramsMtx.RUnlock()
+	if len(t.params.exemptOrigins) > 0 {
+		if _, ok := t.params.exemptOrigins[t.originString(origin)]; ok {
+			return true
+		}
+	}
+	return t.isOverrideExempt(origin)
+}
+
+// Refunds the cost of the given tx to the session if it's the last one counted against it.
+func (s *budgetSession) refund(nonce uint64, txId uint32) {
+	if s.accessCount == 0 || s.lastNonce != nonce || s.lastTxID != txId {
+		return
+	}
+	s.accessCount -= s.lastCost
+	// A leaky bucket may have leaked some of the cost of the tx already.
+	if s.accessCount < 0 {
+		s.accessCount = 0
 	}
+	// Forget the tx so it's counted again if it's resent.
+	s.lastNonce = 0
+	s.lastTxID = 0
+	s.lastCost = 0
 }
 
+// Wraps the given handler so that the tx is refunded to the given budget of the origin if the
+// handler fails or panics, unless the throttle counts failed txs. Only session records kept in
+// memory need to be refunded, changes to the app state made while processing a failed tx are
+// discarded anyway.
+func (t *Throttle) refundOnFailure(
+	next loomchain.TxHandlerFunc, budget txBudget, nonce uint64, origin loom.Address, txId uint32,
+) loomchain.TxHandlerFunc {
+	if t.countFailedTxs || t.sessionMode == BlockSessions || t.sessionStore == StateSessionStore {
+		return next
+	}
+	return func(state loomchain.State, txBytes []byte, isCheckTx bool) (res loomchain.TxHandlerResult, err error) {
+		succeeded := false
+		defer func() {
+			if !succeeded {
+				t.store.Refund(state, origin, t.window(budget), nonce, txId)
+			}
+		}()
+		res, err = next(state, txBytes, isCheckTx)
+		succeeded = err == nil
+		return res, err
+	}
+}
+
+// Counts the size of the given tx against the bytes budget of the given origin, and returns the
+// given handler wrapped so the tx is settled once it's been processed (see settleTx). Does nothing if
+// the size of the txs of the origin isn't limited.
+func (t *Throttle) throttleTxBytes(
+	state loomchain.State, next loomchain.TxHandlerFunc, nonce uint64, origin loom.Address, txId uint32,
+	txBytes []byte, maxTxBytes int64,
+) (loomchain.TxHandlerFunc, error) {
+	if isUnlimited(maxTxBytes) {
+		return next, nil
+	}
+	cost := int64(len(txBytes))
+	if err := t.throttleTx(state, bytesBudget, nonce, origin, maxTxBytes, txId, cost); err != nil {
+		return next, err
+	}
+	return t.settleTx(next, bytesBudget, nonce, origin, maxTxBytes, txId, cost), nil
+}
+
+// Counts a tx with the given cost against the given budget of the given origin, using the session
+// mode & store of the throttle. Txs that cost more than the whole limit are rejected with a
+// TxCostExceedsLimitError without being counted. Txs aren't counted at all if the limit is
+// unlimited. When txs are post-charged the tx is only checked against the limit, and charged by
+// settleTx once it succeeds.
+func (t *Throttle) throttleTx(
+	state loomchain.State, budget txBudget, nonce uint64, origin loom.Address, limit int64, txId uint32,
+	cost int64,
+) error {
+	if isUnlimited(limit) {
+		t.metrics.txAllowed(budget)
+		return nil
+	}
+	var err error
+	switch {
+	case cost > t.burstCeiling(budget, limit):
+		t.metrics.txThrottled(budget, origin.String())
+		err = &TxCostExceedsLimitError{Origin: origin, Budget: budget.String(), Cost: cost, Limit: limit}
+	case t.sessionMode == BlockSessions:
+		err = t.runBlockThrottle(state, budget, origin, limit, cost)
+	case t.postCharging():
+		err = t.peekThrottle(state, budget, origin, limit, cost)
+	default:
+		err = t.runThrottle(state, budget, nonce, origin, limit, txId, cost)
+	}
+	if err != nil && t.penaltyEnabled() {
+		t.recordRejection(origin)
+	}
+	t.logTx(state, budget, origin, limit, err)
+	return err
+}
+
+// Counts a tx with the given cost against the given budget of the given origin in the session
+// store, and returns a TxLimitReachedError if the total cost of the txs the origin has sent during
+// the current session of the budget exceeds the given limit.
 func (t *Throttle) runThrottle(
-	state loomchain.State, nonce uint64, origin loom.Address, limit int64, txId uint32, key string,
+	state loomchain.State, budget txBudget, nonce uint64, origin loom.Address, limit int64, txId uint32,
+	cost int64,
 ) error {
-	limitCtx, err := t.getLimiterContext(state.Context(), nonce, limit, txId, key)
-	if err != nil {
-		return errors.Wrap(err, "deploy limiter context")
-	}
-
-	if limitCtx.Reached {
-		message := fmt.Sprintf(
-			"Out of transactions of id %v, for current session: %d out of %d; Try after %v seconds!",
-			txId,
-			limitCtx.Limit-limitCtx.Remaining,
-			limitCtx.Limit,
-			t.sessionDuration,
-		)
-		return errors.New(message)
+	now := t.store.Now(state)
+	window := t.window(budget)
+	usage := t.store.IncrementWithCost(state, origin, window, TxCharge{Nonce: nonce, TxID: txId, Cost: cost, Limit: limit}, now)
+	count := usage.total(window, now)
+	if count <= limit || t.drawBurst(budget, t.originString(origin), limit, count, now) {
+		t.metrics.txAllowed(budget)
+		return nil
 	}
-	return nil
+	t.metrics.txThrottled(budget, t.originString(origin))
+	if window.Mode == LeakyBucket {
+		// Txs that overflow the bucket aren't added to it.
+		t.store.Refund(state, origin, window, nonce, txId)
+		usage.Count -= unitsOfCost(cost)
+	}
+	retryAt := usage.retryAt(window, limit, cost)
+	err := newTxLimitReachedError(budget, origin, limit, count, cost, retryAt, window.Duration, now).inWindow(window)
+	if budget == callBudget {
+		t.annotateBurst(err, t.originString(origin), limit, count, cost)
+	}
+	return err
 }
 
 func (t *Throttle) getKarmaForTransaction(
@@ -0,0 +1,124 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/auth"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// Number of distinct txs each benchmark cycles through, consecutive txs have different nonces so
+// every one of them is counted.
+const benchmarkTxs = 256
+
+// Runs call txs through the middleware with the given call limit, every origin is allowed all its txs
+// if the limit is unlimited, and rejected all but its first tx if the limit is 1.
+func benchmarkThrottle(b *testing.B, callLimit int64, parallel bool) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		b, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	tmx := GetKarmaMiddleWare(
+		true, callLimit, sessionDuration, 0, 0, StaticLimitResolver(callLimit), createKarmaContractCtx,
+	)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	txs := make([]auth.SignedTx, benchmarkTxs)
+	for i := range txs {
+		txs[i] = mockSignedTx(b, uint64(i+1), types.TxID_CALL, vm.VMType_PLUGIN, contract)
+	}
+	next := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{}, nil
+	}
+	// Each goroutine sends txs from its own origin.
+	var origins uint32
+	run := func(more func() bool) {
+		local := make([]byte, 20)
+		local[0] = byte(atomic.AddUint32(&origins, 1))
+		origin := loom.Address{ChainID: "chain", Local: local}
+		originState := state.WithContext(context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin))
+		for i := 0; more(); i++ {
+			_, _ = tmx.ProcessTx(originState, txs[i%benchmarkTxs].Inner, next, true)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	if parallel {
+		b.RunParallel(func(pb *testing.PB) {
+			run(pb.Next)
+		})
+		return
+	}
+	i := 0
+	run(func() bool {
+		i++
+		return i <= b.N
+	})
+}
+
+func BenchmarkThrottleAllow(b *testing.B) {
+	benchmarkThrottle(b, math.MaxInt64, false)
+}
+
+func BenchmarkThrottleReject(b *testing.B) {
+	benchmarkThrottle(b, 1, false)
+}
+
+func BenchmarkThrottleAllowParallel(b *testing.B) {
+	benchmarkThrottle(b, math.MaxInt64, true)
+}
+
+func BenchmarkThrottleRejectParallel(b *testing.B) {
+	benchmarkThrottle(b, 1, true)
+}
+
+// Counting an allowed tx used to format the origin twice, and box the fields of the debug event &
+// the label of the allowed tx counter, even if nothing was logged or collected. BenchmarkThrottleAllow
+// reports the allocations of the whole middleware, most of which are spent decoding the tx.
+func TestThrottleAllowAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector makes allocation counts unreliable")
+	}
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{}, nil, nil)
+	nonce := uint64(0)
+	var err error
+	allocs := testing.AllocsPerRun(100, func() {
+		nonce++
+		if e := th.throttleTx(state, callBudget, nonce, origin, 1000, uint32(types.TxID_CALL), 1); e != nil {
+			err = e
+		}
+	})
+	require.NoError(t, err)
+	require.Zero(t, allocs)
+}
+
+func TestThrottleReusesEvictedRecords(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	th.maxTrackedOrigins = 1
+	now := time.Now()
+
+	th.countTx(callBudget, origin.String(), 1, 1, 3, maxCallCount, now)
+	record := th.sessions[origin.String()]
+	// Making room for another origin evicts the record of the first one, which is reused blank.
+	th.countTx(callBudget, addr1.String(), 1, 1, 1, maxCallCount, now)
+	require.Len(t, th.sessions, 1)
+	require.True(t, record == th.sessions[addr1.String()])
+	require.Equal(t, int64(1), record.budgets[callBudget].accessCount)
+	require.Equal(t, int64(1), record.budgets[callBudget].lastCost)
+	require.Equal(t, 1, th.activity.Len())
+}
@@ -0,0 +1,112 @@
+package throttle
+
+import (
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/address_mapper"
+	"github.com/pkg/errors"
+)
+
+// KeyDimension is one of the components of the key the throttle tracks the txs of an origin under.
+type KeyDimension string
+
+const (
+	// The chain ID of the origin.
+	KeyChainID KeyDimension = "chain"
+	// The local address of the origin.
+	KeyAddress KeyDimension = "address"
+	// Replaces an origin from a foreign chain with the local account it's mapped to in the Address
+	// Mapper, so the txs a user signs with any of its keys are counted together. Origins without a
+	// mapping are tracked as is.
+	KeyMappedAccount KeyDimension = "mapped"
+)
+
+// DefaultKeyDimensions track each origin under its own address, the same account is tracked under a
+// separate key for each chain it signs txs on.
+var DefaultKeyDimensions = []KeyDimension{KeyChainID, KeyAddress}
+
+func (d KeyDimension) IsValid() bool {
+	switch d {
+	case KeyChainID, KeyAddress, KeyMappedAccount:
+		return true
+	}
+	return false
+}
+
+// ValidateKeyDimensions returns an error if the given dimensions contain an unknown or duplicate
+// dimension, or don't include at least one of chain & address.
+func ValidateKeyDimensions(dims []KeyDimension) error {
+	seen := make(map[KeyDimension]bool, len(dims))
+	for i, dim := range dims {
+		if !dim.IsValid() {
+			return errors.Errorf("ThrottleKey[%d] %s must be one of: chain, address, mapped", i, dim)
+		}
+		if seen[dim] {
+			return errors.Errorf("ThrottleKey[%d] %s is a duplicate", i, dim)
+		}
+		seen[dim] = true
+	}
+	if !seen[KeyChainID] && !seen[KeyAddress] {
+		return errors.New("ThrottleKey must include chain or address")
+	}
+	return nil
+}
+
+// Composition of the key the throttle tracks the txs of an origin under.
+type throttleKey struct {
+	chainID bool
+	address bool
+	// Nil unless origins are mapped to local accounts.
+	createAddressMapperCtx func(state loomchain.State) (contractpb.StaticContext, error)
+}
+
+// Returns the key the txs of the given origin are tracked under. The key is an address so it can
+// stand in for the origin in session records & errors: the chain ID or local address of the key is
+// empty if that dimension isn't included. Keys are derived from the app state only, so all nodes
+// derive the same key for an origin.
+func (t *Throttle) throttleKey(state loomchain.State, origin loom.Address) (loom.Address, error) {
+	origin = normalizeOrigin(state, origin)
+	if t.key == nil {
+		return origin, nil
+	}
+	key := origin
+	if t.key.createAddressMapperCtx != nil && origin.ChainID != state.Block().ChainID {
+		mapped, err := t.mappedAccount(state, origin)
+		if err != nil {
+			return loom.Address{}, err
+		}
+		key = mapped
+	}
+	if !t.key.chainID {
+		key.ChainID = ""
+	}
+	if !t.key.address {
+		key.Local = nil
+	}
+	return key, nil
+}
+
+// Returns the local account the given origin is mapped to, or the origin itself if it's not mapped.
+func (t *Throttle) mappedAccount(state loomchain.State, origin loom.Address) (loom.Address, error) {
+	ctx, err := t.key.createAddressMapperCtx(state)
+	if err != nil {
+		return loom.Address{}, errors.Wrap(err, "failed to create Address Mapper context")
+	}
+	am := &address_mapper.AddressMapper{}
+	resp, err := am.GetMapping(ctx, &address_mapper.GetMappingRequest{From: origin.MarshalPB()})
+	if err != nil {
+		if errors.Cause(err) == contractpb.ErrNotFound {
+			return origin, nil
+		}
+		return loom.Address{}, errors.Wrapf(err, "failed to map origin %s", origin.String())
+	}
+	if resp == nil || resp.To == nil {
+		return origin, nil
+	}
+	mapped := loom.UnmarshalAddressPB(resp.To)
+	if mapped.ChainID != state.Block().ChainID {
+		return origin, nil
+	}
+	return mapped, nil
+}
@@ -0,0 +1,108 @@
+// +build evm
+
+package throttle
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/loomnetwork/go-loom"
+	amtypes "github.com/loomnetwork/go-loom/builtin/types/address_mapper"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	"github.com/loomnetwork/go-loom/common/evmcompat"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/address_mapper"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestValidateKeyDimensions(t *testing.T) {
+	require.NoError(t, ValidateKeyDimensions(DefaultKeyDimensions))
+	require.NoError(t, ValidateKeyDimensions([]KeyDimension{KeyMappedAccount, KeyAddress}))
+	require.Error(t, ValidateKeyDimensions([]KeyDimension{KeyChainID, "nonce"}))
+	require.Error(t, ValidateKeyDimensions([]KeyDimension{KeyAddress, KeyAddress}))
+	require.Error(t, ValidateKeyDimensions([]KeyDimension{KeyMappedAccount}))
+}
+
+func TestThrottleKey(t *testing.T) {
+	fakeCtx := goloomplugin.CreateFakeContext(origin, origin)
+	amCtx := contractpb.WrapPluginContext(fakeCtx.WithAddress(fakeCtx.CreateContract(address_mapper.Contract)))
+	createAddressMapperCtx := func(state loomchain.State) (contractpb.StaticContext, error) {
+		return amCtx, nil
+	}
+	_, createKarmaContractCtx := newKarmaContractCtx(t, fakeCtx, &ktypes.KarmaInitRequest{Sources: sources})
+
+	// The local account origin is mapped to an eth account.
+	ethKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	ethHex := crypto.PubkeyToAddress(ethKey.PublicKey).Hex()
+	ethLocal, err := loom.LocalAddressFromHexString(ethHex)
+	require.NoError(t, err)
+	ethOrigin := loom.Address{ChainID: "eth", Local: ethLocal}
+	sig, err := address_mapper.SignIdentityMapping(origin, ethOrigin, ethKey, evmcompat.SignatureType_EIP712)
+	require.NoError(t, err)
+	am := &address_mapper.AddressMapper{}
+	require.NoError(t, am.AddIdentityMapping(amCtx, &amtypes.AddressMapperAddIdentityMappingRequest{
+		From:      origin.MarshalPB(),
+		To:        ethOrigin.MarshalPB(),
+		Signature: sig,
+	}))
+	unmappedEthOrigin := loom.Address{ChainID: "eth", Local: addr1.Local}
+
+	memStore := store.NewMemStore()
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{ChainID: "chain", Height: 1}, nil, nil)
+	keyOf := func(dims []KeyDimension, addr loom.Address) string {
+		th := NewThrottle(sessionDuration, 2, 0, 0)
+		WithThrottleKey(dims, createAddressMapperCtx)(th)
+		key, err := th.throttleKey(state, addr)
+		require.NoError(t, err)
+		return key.String()
+	}
+
+	// By default each signing key is tracked separately.
+	require.NotEqual(t, keyOf(DefaultKeyDimensions, origin), keyOf(DefaultKeyDimensions, ethOrigin))
+	require.Equal(t, origin.String(), keyOf(DefaultKeyDimensions, origin))
+
+	// Mapped origins are tracked under the local account they're mapped to.
+	perAccount := []KeyDimension{KeyMappedAccount, KeyChainID, KeyAddress}
+	require.Equal(t, origin.String(), keyOf(perAccount, origin))
+	require.Equal(t, origin.String(), keyOf(perAccount, ethOrigin))
+	require.Equal(t, unmappedEthOrigin.String(), keyOf(perAccount, unmappedEthOrigin))
+
+	// Without the chain ID the same local address is tracked together on every chain.
+	perAddress := []KeyDimension{KeyAddress}
+	require.Equal(t, keyOf(perAddress, unmappedEthOrigin), keyOf(perAddress, addr1))
+	require.NotEqual(t, keyOf(perAddress, ethOrigin), keyOf(perAddress, origin))
+
+	// Keys don't depend on how the address of the origin was encoded.
+	upperCase := loom.MustParseAddress("eth:0x" + strings.ToUpper(ethHex[2:]))
+	require.Equal(t, keyOf(perAccount, ethOrigin), keyOf(perAccount, upperCase))
+	require.Equal(t, keyOf(DefaultKeyDimensions, ethOrigin), keyOf(DefaultKeyDimensions, upperCase))
+
+	// The limit applies to the local account & the eth account together.
+	now := time.Unix(1500000000, 0)
+	tmx := GetKarmaMiddleWare(
+		true, 2, sessionDuration, 0, 0, StaticLimitResolver(2), createKarmaContractCtx,
+		WithThrottleKey(perAccount, createAddressMapperCtx),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+	nonce := uint64(0)
+	sendTx := func(from loom.Address) error {
+		nonce++
+		return processTxFrom(
+			tmx, state, from, mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, false,
+		)
+	}
+	require.NoError(t, sendTx(origin))
+	require.NoError(t, sendTx(ethOrigin))
+	require.Error(t, sendTx(origin))
+	require.Error(t, sendTx(ethOrigin))
+	require.NoError(t, sendTx(unmappedEthOrigin))
+}
@@ -5,13 +5,19 @@ package throttle
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/big"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	etypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/generic"
 	"github.com/gogo/protobuf/proto"
 	"github.com/loomnetwork/go-loom"
 	"github.com/loomnetwork/go-loom/auth"
@@ -26,6 +32,7 @@ import (
 	"github.com/loomnetwork/loomchain/log"
 	"github.com/loomnetwork/loomchain/store"
 	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	abci "github.com/tendermint/tendermint/abci/types"
 	"golang.org/x/crypto/ed25519"
@@ -68,15 +75,9 @@ func TestDeployThrottleTxMiddleware(t *testing.T) {
 
 	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{}, nil, nil)
 
-	fakeCtx := goloomplugin.CreateFakeContext(addr1, addr1)
-	karmaAddr := fakeCtx.CreateContract(karma.Contract)
-	contractContext := contractpb.WrapPluginContext(fakeCtx.WithAddress(karmaAddr))
-
-	// Init the karma contract
-	karmaContract := &karma.Karma{}
-	require.NoError(t, karmaContract.Init(contractContext, &ktypes.KarmaInitRequest{
-		Sources: sources,
-	}))
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
 
 	// This can also be done on init, but more concise this way
 	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
@@ -87,9 +88,10 @@ func TestDeployThrottleTxMiddleware(t *testing.T) {
 		true,
 		maxCallCount,
 		sessionDuration,
-		func(state loomchain.State) (contractpb.Context, error) {
-			return contractContext, nil
-		},
+		0,
+		0,
+		nil,
+		createKarmaContractCtx,
 	)
 
 	deployKarma := userState.DeployKarmaTotal
@@ -119,15 +121,9 @@ func TestCallThrottleTxMiddleware(t *testing.T) {
 
 	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{}, nil, nil)
 
-	fakeCtx := goloomplugin.CreateFakeContext(addr1, addr1)
-	karmaAddr := fakeCtx.CreateContract(karma.Contract)
-	contractContext := contractpb.WrapPluginContext(fakeCtx.WithAddress(karmaAddr))
-
-	// Init the karma contract
-	karmaContract := &karma.Karma{}
-	require.NoError(t, karmaContract.Init(contractContext, &ktypes.KarmaInitRequest{
-		Sources: sources,
-	}))
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
 
 	// This can also be done on init, but more concise this way
 	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
@@ -138,9 +134,10 @@ func TestCallThrottleTxMiddleware(t *testing.T) {
 		true,
 		maxCallCount,
 		sessionDuration,
-		func(state loomchain.State) (contractpb.Context, error) {
-			return contractContext, nil
-		},
+		0,
+		0,
+		nil,
+		createKarmaContractCtx,
 	)
 
 	callKarma := userState.CallKarmaTotal
@@ -157,7 +154,712 @@ func TestCallThrottleTxMiddleware(t *testing.T) {
 	}
 }
 
-func mockSignedTx(t *testing.T, sequence uint64, id types.TxID, vmType vm.VMType, to loom.Address) auth.SignedTx {
+func TestKarmaLimitChangesMidSession(t *testing.T) {
+	log.Setup("debug", "file://-")
+	log.Root.With("module", "throttle-middleware")
+
+	memStore := store.NewMemStore()
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1}, nil, nil)
+
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	callKarma := userState.CallKarmaTotal.Value.Int64()
+
+	resolver := NewKarmaLimitResolver(maxCallCount, createKarmaContractCtx)
+	limit, err := resolver.ResolveLimit(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, maxCallCount+callKarma, limit)
+
+	_, err = resolver.ResolveLimit(state, addr1)
+	require.Equal(t, ErrNoKarma, err)
+
+	tmx := GetKarmaMiddleWare(true, maxCallCount, sessionDuration, 0, 0, nil, createKarmaContractCtx)
+	ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+	nonce := uint64(0)
+	sendCall := func(state loomchain.State) error {
+		nonce++
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		_, err := throttleMiddlewareHandler(tmx, state, txSigned, ctx)
+		return err
+	}
+
+	for i := int64(0); i < maxCallCount+callKarma; i++ {
+		require.NoError(t, sendCall(state))
+	}
+	require.Error(t, sendCall(state))
+
+	// The origin earns more karma mid-session, the new limit should only take effect in the next block.
+	extraKarma := int64(5)
+	require.NoError(t, karma.AddKarma(contractContext, origin, []*ktypes.KarmaSource{
+		{Name: "sms", Count: &types.BigUInt{Value: *loom.NewBigUIntFromInt(extraKarma)}},
+	}))
+
+	limit, err = resolver.ResolveLimit(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, maxCallCount+callKarma, limit)
+	require.Error(t, sendCall(state))
+
+	nextState := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 2}, nil, nil)
+	limit, err = resolver.ResolveLimit(nextState, origin)
+	require.NoError(t, err)
+	require.Equal(t, maxCallCount+callKarma+extraKarma, limit)
+
+	// The txs sent earlier in the session (including the two rejected ones) still count against the
+	// new limit.
+	for i := int64(0); i < extraKarma-2; i++ {
+		require.NoError(t, sendCall(nextState))
+	}
+	require.Error(t, sendCall(nextState))
+}
+
+// Txs other than calls & deploys count against the call limit of their origin, origins without call
+// karma can still send them up to the base call limit.
+func TestOtherTxsCallLimit(t *testing.T) {
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	tmx := GetKarmaMiddleWare(true, maxCallCount, sessionDuration, 0, 0, nil, createKarmaContractCtx)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	nonce := uint64(0)
+	sendMigrationTx := func(from loom.Address) error {
+		nonce++
+		txSigned := mockSignedTx(t, nonce, types.TxID_MIGRATION, vm.VMType_PLUGIN, contract)
+		return processTxFrom(tmx, state, from, txSigned, nopTxHandler, true)
+	}
+	limitOf := func(err error) int64 {
+		limitErr, ok := err.(*TxLimitReachedError)
+		require.True(t, ok, "expected a limit error, got %v", err)
+		return limitErr.Limit
+	}
+
+	callKarma := userState.CallKarmaTotal.Value.Int64()
+	for i := int64(0); i < maxCallCount+callKarma; i++ {
+		require.NoError(t, sendMigrationTx(origin))
+	}
+	require.Equal(t, maxCallCount+callKarma, limitOf(sendMigrationTx(origin)))
+
+	for i := int64(0); i < maxCallCount; i++ {
+		require.NoError(t, sendMigrationTx(addr1))
+	}
+	require.Equal(t, maxCallCount, limitOf(sendMigrationTx(addr1)))
+}
+
+func TestBlockSessionsDeterministic(t *testing.T) {
+	log.Setup("debug", "file://-")
+	log.Root.With("module", "throttle-middleware")
+
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	// Two nodes with their own app state process the same txs in the same blocks
+	const sessionBlocks = 5
+	type node struct {
+		tmx   loomchain.TxMiddlewareFunc
+		store store.KVStore
+	}
+	nodes := make([]node, 2)
+	for i := range nodes {
+		nodes[i] = node{
+			tmx: GetKarmaMiddleWare(
+				true, maxCallCount, sessionDuration, 0, 0, nil, createKarmaContractCtx,
+				WithBlockSessions(sessionBlocks, 0),
+			),
+			store: store.NewMemStore(),
+		}
+	}
+
+	limit := maxCallCount + userState.CallKarmaTotal.Value.Int64()
+	acceptedPerSession := make(map[int64]int64)
+	nonce := uint64(0)
+	for height := int64(1); height < 4*sessionBlocks; height++ {
+		// more txs per session than the limit allows
+		for i := 0; i < 4; i++ {
+			nonce++
+			txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+			var results []string
+			for _, n := range nodes {
+				state := loomchain.NewStoreState(nil, n.store, abci.Header{Height: height}, nil, nil)
+				ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+				_, err := throttleMiddlewareHandler(n.tmx, state, txSigned, ctx)
+				if err != nil {
+					limitErr, ok := err.(*TxLimitReachedError)
+					require.True(t, ok)
+					require.Equal(t, (height/sessionBlocks+1)*sessionBlocks, limitErr.RetryAfterHeight)
+				}
+				results = append(results, fmt.Sprint(err))
+			}
+			require.Equal(t, results[0], results[1])
+			if results[0] == fmt.Sprint(nil) {
+				acceptedPerSession[height/sessionBlocks]++
+			}
+		}
+	}
+
+	key := blockSessionKey(callBudget, origin)
+	require.NotNil(t, nodes[0].store.Get(key))
+	require.Equal(t, nodes[0].store.Get(key), nodes[1].store.Get(key))
+
+	// the first session only spans 4 blocks since there's no block at height zero
+	require.Equal(t, int64(16), acceptedPerSession[0])
+	for session := int64(1); session < 4; session++ {
+		require.Equal(t, limit, acceptedPerSession[session])
+	}
+}
+
+func TestStateSessionStore(t *testing.T) {
+	log.Setup("debug", "file://-")
+	log.Root.With("module", "throttle-middleware")
+
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	newMiddleware := func() loomchain.TxMiddlewareFunc {
+		return GetKarmaMiddleWare(
+			true, maxCallCount, sessionDuration, 0, 0, nil, createKarmaContractCtx,
+			WithSessionStore(StateSessionStore),
+		)
+	}
+
+	// Two nodes with their own app state process the same txs in the same blocks
+	type node struct {
+		tmx   loomchain.TxMiddlewareFunc
+		store store.KVStore
+	}
+	nodes := []*node{
+		{tmx: newMiddleware(), store: store.NewMemStore()},
+		{tmx: newMiddleware(), store: store.NewMemStore()},
+	}
+	blockTime := time.Unix(1500000000, 0)
+	nonce := uint64(0)
+	sendTx := func() []error {
+		nonce++
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		var errs []error
+		for _, n := range nodes {
+			state := loomchain.NewStoreState(nil, n.store, abci.Header{Height: int64(nonce), Time: blockTime}, nil, nil)
+			ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+			_, err := throttleMiddlewareHandler(n.tmx, state, txSigned, ctx)
+			errs = append(errs, err)
+		}
+		require.Equal(t, fmt.Sprint(errs[0]), fmt.Sprint(errs[1]))
+		return errs
+	}
+
+	limit := maxCallCount + userState.CallKarmaTotal.Value.Int64()
+	for i := int64(1); i < limit; i++ {
+		require.NoError(t, sendTx()[0])
+	}
+
+	// The session record survives a restart of the second node.
+	nodes[1].tmx = newMiddleware()
+	require.NoError(t, sendTx()[0])
+
+	err := sendTx()[1]
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok)
+	require.Equal(t, blockTime.Unix()+sessionDuration, limitErr.RetryAfter)
+
+	key := stateSessionKey(origin)
+	require.NotNil(t, nodes[0].store.Get(key))
+	require.Equal(t, nodes[0].store.Get(key), nodes[1].store.Get(key))
+
+	// Once the session has ended the expired record is replaced by a fresh one.
+	blockTime = blockTime.Add(time.Duration(sessionDuration) * time.Second)
+	require.NoError(t, sendTx()[0])
+	session := decodeOriginSession(nodes[0].store.Get(key))
+	require.NotNil(t, session)
+	require.Equal(t, int64(1), session.budgets[callBudget].accessCount)
+	require.Equal(t, blockTime, session.budgets[callBudget].start)
+	require.True(t, session.budgets[deployBudget].start.IsZero())
+}
+
+func TestRefundFailedTxs(t *testing.T) {
+	log.Setup("debug", "file://-")
+	log.Root.With("module", "throttle-middleware")
+
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+	limit := maxCallCount + userState.CallKarmaTotal.Value.Int64()
+
+	failingHandler := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		return loomchain.TxHandlerResult{}, errors.New("invalid nonce")
+	}
+	panickingHandler := func(state loomchain.State, txBytes []byte, isCheckTx bool) (loomchain.TxHandlerResult, error) {
+		panic("handler failed")
+	}
+	processTx := func(
+		tmx loomchain.TxMiddlewareFunc, nonce uint64, next loomchain.TxHandlerFunc,
+	) error {
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		_, err := tmx.ProcessTx(state.WithContext(ctx), txSigned.Inner, next, true)
+		return err
+	}
+
+	// Failed txs are refunded, so they never lock the origin out.
+	tmx := GetKarmaMiddleWare(true, maxCallCount, sessionDuration, 0, 0, nil, createKarmaContractCtx)
+	nonce := uint64(0)
+	for i := int64(0); i < 2*limit; i++ {
+		nonce++
+		require.EqualError(t, processTx(tmx, nonce, failingHandler), "invalid nonce")
+	}
+	// Including txs whose handler panics.
+	for i := int64(0); i < 2*limit; i++ {
+		nonce++
+		require.Panics(t, func() { processTx(tmx, nonce, panickingHandler) })
+	}
+	// A refunded tx is counted again when it's resent.
+	require.EqualError(t, processTx(tmx, nonce, failingHandler), "invalid nonce")
+	for i := int64(0); i < limit; i++ {
+		require.NoError(t, processTx(tmx, nonce, nopTxHandler))
+		nonce++
+	}
+	_, ok := processTx(tmx, nonce, nopTxHandler).(*TxLimitReachedError)
+	require.True(t, ok)
+
+	// Failed txs use up the limit when they're counted.
+	tmx = GetKarmaMiddleWare(
+		true, maxCallCount, sessionDuration, 0, 0, nil, createKarmaContractCtx,
+		WithCountFailedTxs(true),
+	)
+	for i := int64(0); i < limit; i++ {
+		nonce++
+		if i%2 == 0 {
+			require.EqualError(t, processTx(tmx, nonce, failingHandler), "invalid nonce")
+		} else {
+			require.Panics(t, func() { processTx(tmx, nonce, panickingHandler) })
+		}
+	}
+	nonce++
+	_, ok = processTx(tmx, nonce, nopTxHandler).(*TxLimitReachedError)
+	require.True(t, ok)
+}
+
+func TestThrottleUnlimited(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	callTxID := uint32(types.TxID_CALL)
+
+	for _, limit := range []int64{0, Unlimited} {
+		for nonce := uint64(1); nonce <= 100; nonce++ {
+			require.NoError(t, th.throttleTx(state, callBudget, nonce, origin, limit, callTxID, 1000))
+		}
+	}
+	// Txs aren't counted at all.
+	require.Empty(t, th.sessions)
+
+	resolver := NewKarmaLimitResolver(0, func(state loomchain.State) (contractpb.Context, error) {
+		return nil, errors.New("karma contract shouldn't be needed")
+	})
+	limit, err := resolver.ResolveLimit(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, Unlimited, limit)
+}
+
+func TestThrottleCounterOverflow(t *testing.T) {
+	require.Equal(t, int64(math.MaxInt64), addCapped(math.MaxInt64-1, 1))
+	require.Equal(t, int64(math.MaxInt64), addCapped(math.MaxInt64-1, 2))
+	require.Equal(t, int64(math.MaxInt64), addCapped(math.MaxInt64, math.MaxInt64))
+
+	// Counts aren't limited to 16 bits.
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	callTxID := uint32(types.TxID_CALL)
+	const relayerLimit = 100000
+	for nonce := uint64(1); nonce <= relayerLimit; nonce++ {
+		require.NoError(t, th.runThrottle(nil, callBudget, nonce, origin, relayerLimit, callTxID, 1))
+	}
+	err := th.runThrottle(nil, callBudget, relayerLimit+1, origin, relayerLimit, callTxID, 1)
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok)
+	require.Equal(t, int64(relayerLimit), limitErr.Used)
+	require.Contains(t, err.Error(), "used 100000 of 100000 call txs")
+
+	// Counts saturate instead of wrapping around when the limit is close to math.MaxInt64.
+	th = NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	require.NoError(t, th.runThrottle(nil, callBudget, 1, origin, math.MaxInt64-1, callTxID, math.MaxInt64-2))
+	require.NoError(t, th.runThrottle(nil, callBudget, 2, origin, math.MaxInt64-1, callTxID, 1))
+	_, ok = th.runThrottle(nil, callBudget, 3, origin, math.MaxInt64-1, callTxID, 2).(*TxLimitReachedError)
+	require.True(t, ok)
+	require.Equal(t, int64(math.MaxInt64), th.sessions[origin.String()].budgets[callBudget].accessCount)
+
+	// Same in block session mode.
+	th = NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithBlockSessions(10, 0)(th)
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	require.NoError(t, th.throttleTx(state, callBudget, 1, origin, math.MaxInt64, callTxID, math.MaxInt64-1))
+	require.NoError(t, th.throttleTx(state, callBudget, 2, origin, math.MaxInt64, callTxID, 1))
+	_, ok = th.throttleTx(state, callBudget, 3, origin, math.MaxInt64, callTxID, 1).(*TxLimitReachedError)
+	require.True(t, ok)
+}
+
+func TestThrottleOriginIsolation(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	callTxID := uint32(types.TxID_CALL)
+
+	for i := int64(1); i <= maxCallCount+1; i++ {
+		for _, o := range []loom.Address{origin, addr1} {
+			err := th.runThrottle(nil, callBudget, uint64(i), o, maxCallCount, callTxID, 1)
+			if i <= maxCallCount {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		}
+		// the tx of the first origin isn't counted twice even though the other origin sent a tx
+		// after it
+		th.runThrottle(nil, callBudget, uint64(i), origin, maxCallCount, callTxID, 1)
+
+		require.Equal(t, i, th.sessions[origin.String()].budgets[callBudget].accessCount)
+		require.Equal(t, i, th.sessions[addr1.String()].budgets[callBudget].accessCount)
+	}
+}
+
+func TestThrottleSeparateBudgets(t *testing.T) {
+	// 2 deploys per hour, 3 calls per 10 minutes
+	th := NewThrottle(600, 3, 3600, 2)
+	now := time.Now()
+
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		require.Equal(t, int64(nonce), th.countTx(callBudget, origin.String(), nonce, 1, 1, 3, now))
+	}
+	// calls don't use up the deploy budget
+	require.Equal(t, int64(1), th.countTx(deployBudget, origin.String(), 4, 2, 1, 2, now))
+	require.Equal(t, int64(2), th.countTx(deployBudget, origin.String(), 5, 2, 1, 2, now))
+
+	// the call session ends before the deploy session
+	later := now.Add(10 * time.Minute)
+	require.Equal(t, int64(1), th.countTx(callBudget, origin.String(), 6, 1, 1, 3, later))
+	require.Equal(t, int64(3), th.countTx(deployBudget, origin.String(), 7, 2, 1, 2, later))
+
+	err := th.runThrottle(nil, deployBudget, 8, origin, 2, 2, 1)
+	require.Error(t, err)
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok)
+	require.Equal(t, "deploy", limitErr.Budget)
+	require.Equal(t, int64(2), limitErr.Used)
+	require.Equal(t, int64(2), limitErr.Limit)
+	require.Equal(t, time.Hour, limitErr.Window)
+}
+
+func TestTxLimitReachedError(t *testing.T) {
+	window := time.Duration(sessionDuration) * time.Second
+	sessionEnd := time.Unix(1000+sessionDuration, 0)
+	now := time.Unix(1100, 0)
+
+	err := newTxLimitReachedError(callBudget, origin, maxCallCount, maxCallCount+1, 1, sessionEnd, window, now)
+	require.Equal(t, origin, err.Origin)
+	require.Equal(t, maxCallCount, err.Used)
+	require.Equal(t, maxCallCount, err.Limit)
+	require.Equal(t, window, err.Window)
+	require.Equal(t, int64(1000+sessionDuration), err.RetryAfter)
+	require.Equal(t, window-100*time.Second, err.RetryIn)
+	require.Equal(t, TxLimitReachedCode, err.ABCICode())
+	require.True(t, strings.HasPrefix(err.Error(), TxLimitReachedErrorPrefix+": "))
+	require.Contains(t, err.Error(), fmt.Sprintf("used %d of %d call txs", maxCallCount, maxCallCount))
+
+	// txs rejected earlier in the session don't count as used
+	err = newTxLimitReachedError(callBudget, origin, maxCallCount, maxCallCount+5, 1, sessionEnd, window, now)
+	require.Equal(t, maxCallCount, err.Used)
+
+	// a session that ends part way through a second can only be retried from the next second
+	// but RetryIn isn't rounded
+	err = newTxLimitReachedError(callBudget, origin, maxCallCount, maxCallCount+1, 1, sessionEnd.Add(1), window, now)
+	require.Equal(t, int64(1000+sessionDuration+1), err.RetryAfter)
+	require.Equal(t, window-100*time.Second+1, err.RetryIn)
+	sessionEnd = sessionEnd.Add(time.Second - 1)
+	err = newTxLimitReachedError(callBudget, origin, maxCallCount, maxCallCount+1, 1, sessionEnd, window, now)
+	require.Equal(t, int64(1000+sessionDuration+1), err.RetryAfter)
+}
+
+func TestThrottleRetryAfterSessionEnd(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	now := time.Now()
+	for nonce := uint64(1); nonce <= uint64(maxCallCount); nonce++ {
+		require.NoError(t, th.runThrottle(nil, callBudget, nonce, origin, maxCallCount, 1, 1))
+	}
+	err := th.runThrottle(nil, callBudget, uint64(maxCallCount+1), origin, maxCallCount, 1, 1)
+	require.Error(t, err)
+	limitErr := err.(*TxLimitReachedError)
+
+	// The tx is rejected right up to the end of the session...
+	sessionEnd := time.Unix(limitErr.RetryAfter, 0)
+	require.False(t, sessionEnd.Before(now.Add(time.Duration(sessionDuration)*time.Second)))
+	sessionStart := th.sessions[origin.String()].budgets[callBudget].start
+	lastMoment := sessionStart.Add(limitErr.Window).Add(-time.Nanosecond)
+	count := th.countTx(callBudget, origin.String(), uint64(maxCallCount+2), 1, 1, maxCallCount, lastMoment)
+	require.True(t, count > maxCallCount)
+	// ...and accepted from RetryAfter onwards.
+	count = th.countTx(callBudget, origin.String(), uint64(maxCallCount+3), 1, 1, maxCallCount, sessionEnd)
+	require.Equal(t, int64(1), count)
+}
+
+func TestThrottleBoundaryBurst(t *testing.T) {
+	limit := int64(10)
+	window := time.Duration(sessionDuration) * time.Second
+	start := time.Unix(1000000, 0)
+	end := start.Add(window)
+
+	burst := func(mode WindowMode) int64 {
+		th := NewThrottle(sessionDuration, limit, 0, 0)
+		th.windowMode = mode
+		nonce := uint64(0)
+		send := func(now time.Time) bool {
+			nonce++
+			return th.countTx(callBudget, origin.String(), nonce, 1, 1, limit, now) <= limit
+		}
+		require.True(t, send(start))
+
+		// send as many txs as possible in the last second of the session, and in the first second
+		// of the next one
+		accepted := int64(0)
+		for _, now := range []time.Time{end.Add(-time.Second), end.Add(time.Second)} {
+			for i := int64(0); i < limit; i++ {
+				if send(now) {
+					accepted++
+				}
+			}
+		}
+		return accepted
+	}
+
+	// fixed windows let through almost twice the limit within 2 seconds...
+	require.Equal(t, 2*limit-1, burst(FixedWindow))
+	// ...while sliding windows limit the burst to the configured rate
+	require.True(t, burst(SlidingWindow) <= limit)
+}
+
+func TestSlidingWindowRetryAt(t *testing.T) {
+	limit := int64(10)
+	window := time.Duration(sessionDuration) * time.Second
+	start := time.Unix(1000000, 0)
+	end := start.Add(window)
+
+	th := NewThrottle(sessionDuration, limit, 0, 0)
+	th.windowMode = SlidingWindow
+	for nonce := uint64(1); nonce <= uint64(limit); nonce++ {
+		th.countTx(callBudget, origin.String(), nonce, 1, 1, limit, start)
+	}
+	for nonce := uint64(limit + 1); nonce <= uint64(2*limit); nonce++ {
+		require.True(t, th.countTx(callBudget, origin.String(), nonce, 1, 1, limit, end.Add(time.Second)) > limit)
+	}
+
+	// Returns the count the given session would have if a tx was sent at the given time.
+	countAt := func(session budgetSession, now time.Time) int64 {
+		session.advance(SlidingWindow, window, now, NopMetrics(), callBudget)
+		return session.count(SlidingWindow, window, now) + 1
+	}
+	session := th.sessions[origin.String()].budgets[callBudget]
+	retryAt := session.retryAt(SlidingWindow, window, limit, 1)
+	// the current session is full, so the origin has to wait until enough of it slides out of the
+	// window
+	require.Equal(t, end.Add(window).Add(window/10), retryAt)
+	require.True(t, countAt(session, retryAt.Add(-time.Nanosecond)) > limit)
+	require.True(t, countAt(session, retryAt) <= limit)
+
+	// a session that isn't full only has to wait for part of the previous one to slide out
+	session = budgetSession{start: end, accessCount: 5, prevAccessCount: 10}
+	retryAt = session.retryAt(SlidingWindow, window, limit, 1)
+	require.Equal(t, end.Add(window*6/10), retryAt)
+	require.True(t, countAt(session, retryAt.Add(-time.Nanosecond)) > limit)
+	require.True(t, countAt(session, retryAt) <= limit)
+}
+
+func TestSlidingWindowMemory(t *testing.T) {
+	window := time.Duration(sessionDuration) * time.Second
+	start := time.Unix(1000000, 0)
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	th.windowMode = SlidingWindow
+
+	// 100 txs per session over 100 sessions
+	for i := 0; i < 10000; i++ {
+		now := start.Add(time.Duration(i) * window / 100)
+		th.countTx(callBudget, origin.String(), uint64(i), 1, 1, maxCallCount, now)
+	}
+	// only the counts of the current & previous session are kept, no matter how many txs were sent
+	require.Len(t, th.sessions, 1)
+	session := th.sessions[origin.String()].budgets[callBudget]
+	require.Equal(t, int64(100), session.prevAccessCount)
+	require.Equal(t, int64(100), session.accessCount)
+}
+
+// Records the value of each combination of label values of a metric.
+type recordingMetric struct {
+	values map[string][]float64
+	mtx    *sync.Mutex
+	lvs    string
+}
+
+func newRecordingMetric() *recordingMetric {
+	return &recordingMetric{values: make(map[string][]float64), mtx: &sync.Mutex{}}
+}
+
+func (m *recordingMetric) with(labelValues ...string) *recordingMetric {
+	return &recordingMetric{values: m.values, mtx: m.mtx, lvs: strings.Join(labelValues, "=")}
+}
+
+func (m *recordingMetric) record(value float64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.values[m.lvs] = append(m.values[m.lvs], value)
+}
+
+func (m *recordingMetric) sum(labelValues ...string) float64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	total := 0.0
+	for _, v := range m.values[strings.Join(labelValues, "=")] {
+		total += v
+	}
+	return total
+}
+
+type recordingCounter struct{ *recordingMetric }
+
+func (c recordingCounter) With(labelValues ...string) metrics.Counter {
+	return recordingCounter{c.with(labelValues...)}
+}
+func (c recordingCounter) Add(delta float64) { c.record(delta) }
+
+type recordingHistogram struct{ *recordingMetric }
+
+func (h recordingHistogram) With(labelValues ...string) metrics.Histogram {
+	return recordingHistogram{h.with(labelValues...)}
+}
+func (h recordingHistogram) Observe(value float64) { h.record(value) }
+
+func TestThrottleMetrics(t *testing.T) {
+	allowed := recordingCounter{newRecordingMetric()}
+	throttled := recordingCounter{newRecordingMetric()}
+	originThrottled := recordingCounter{newRecordingMetric()}
+	utilization := recordingHistogram{newRecordingMetric()}
+	trackedOrigins := generic.NewGauge("tracked_origins")
+
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	th.metrics = &Metrics{
+		TxsAllowed:           allowed,
+		TxsThrottled:         throttled,
+		SessionUtilization:   utilization,
+		TrackedOrigins:       trackedOrigins,
+		OriginTxsThrottled:   originThrottled,
+		MaxLabelledOffenders: 1,
+	}
+
+	for nonce := uint64(1); nonce <= 4; nonce++ {
+		th.runThrottle(nil, callBudget, nonce, origin, 3, 1, 1)
+		th.runThrottle(nil, callBudget, nonce, addr1, 3, 1, 1)
+	}
+	th.runThrottle(nil, deployBudget, 1, origin, 3, 2, 1)
+
+	require.Equal(t, 7.0, allowed.sum("budget", "call")+allowed.sum("budget", "deploy"))
+	require.Equal(t, 2.0, throttled.sum("budget", "call"))
+	// only the first origin to be throttled gets its own label
+	require.Equal(t, 1.0, originThrottled.sum("origin", origin.String()))
+	require.Equal(t, 1.0, originThrottled.sum("origin", otherOffendersLabel))
+	require.Equal(t, 2.0, trackedOrigins.Value())
+
+	// the utilization of a session is observed once it ends, and is capped at 1
+	later := time.Now().Add(time.Duration(sessionDuration+1) * time.Second)
+	th.countTx(callBudget, origin.String(), 5, 1, 1, 6, later)
+	require.Equal(t, []float64{1}, utilization.values["budget=call"])
+	th.countTx(deployBudget, origin.String(), 2, 2, 1, 3, later)
+	require.Equal(t, []float64{1.0 / 3}, utilization.values["budget=deploy"])
+}
+
+func TestThrottleSessionEviction(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	th.maxTrackedOrigins = 2
+	now := time.Now()
+
+	origin3 := loom.MustParseAddress("chain:0xe288d6eec7150D6a22FDE33F0AA2d81E06591C4d")
+	th.countTx(callBudget, origin.String(), 1, 1, 1, maxCallCount, now)
+	th.countTx(callBudget, addr1.String(), 1, 1, 1, maxCallCount, now.Add(time.Second))
+
+	// the origin that has been idle the longest is evicted to make room for a new one
+	th.countTx(callBudget, origin3.String(), 1, 1, 1, maxCallCount, now.Add(2*time.Second))
+	require.Len(t, th.sessions, 2)
+	require.Nil(t, th.sessions[origin.String()])
+
+	// origins whose session has ended are evicted first
+	later := now.Add(time.Duration(sessionDuration+1) * time.Second)
+	th.countTx(callBudget, origin.String(), 1, 1, 1, maxCallCount, later)
+	require.Len(t, th.sessions, 2)
+	require.Nil(t, th.sessions[addr1.String()])
+	require.NotNil(t, th.sessions[origin3.String()])
+}
+
+func TestThrottleOriginChurn(t *testing.T) {
+	const maxOrigins = 100
+	evicted := recordingCounter{newRecordingMetric()}
+	trackedOrigins := generic.NewGauge("tracked_origins")
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithMaxTrackedOrigins(maxOrigins)(th)
+	th.metrics = NopMetrics()
+	th.metrics.OriginsEvicted = evicted
+	th.metrics.TrackedOrigins = trackedOrigins
+	now := time.Unix(1500000000, 0)
+
+	// Origins that only ever send a single tx don't accumulate, even while their sessions are still
+	// in progress.
+	const numOrigins = 20000
+	for i := 1; i <= numOrigins; i++ {
+		o := fmt.Sprintf("chain:0x%040x", i)
+		require.Equal(t, int64(1), th.countTx(callBudget, o, 1, 1, 1, maxCallCount, now))
+		require.True(t, len(th.sessions) <= maxOrigins)
+		now = now.Add(time.Millisecond)
+	}
+	require.Equal(t, float64(numOrigins-maxOrigins), evicted.sum("reason", "pressure"))
+
+	// The records of origins whose sessions have ended are swept once a session, without waiting for
+	// the limit to be reached.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	th.countTx(callBudget, origin.String(), 1, 1, 1, maxCallCount, now)
+	require.Len(t, th.sessions, 1)
+	require.Equal(t, float64(maxOrigins), evicted.sum("reason", "idle"))
+	require.Equal(t, 1.0, trackedOrigins.Value())
+}
+
+func TestThrottleConcurrentTxs(t *testing.T) {
+	const numOrigins = 5
+	const txsPerOrigin = 2000
+	th := NewThrottle(sessionDuration, txsPerOrigin, 0, 0)
+	callTxID := uint32(types.TxID_CALL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numOrigins; i++ {
+		o := loom.MustParseAddress(fmt.Sprintf("chain:0x%040x", i+1))
+		// each origin sends its txs from several goroutines at once
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(firstNonce int) {
+				defer wg.Done()
+				for nonce := firstNonce; nonce < txsPerOrigin; nonce += 4 {
+					require.NoError(t, th.runThrottle(nil, callBudget, uint64(nonce+1), o, txsPerOrigin, callTxID, 1))
+				}
+			}(j)
+		}
+	}
+	wg.Wait()
+
+	require.Len(t, th.sessions, numOrigins)
+	for _, session := range th.sessions {
+		require.Equal(t, int64(txsPerOrigin), session.budgets[callBudget].accessCount)
+	}
+}
+
+func mockSignedTx(t testing.TB, sequence uint64, id types.TxID, vmType vm.VMType, to loom.Address) auth.SignedTx {
 	origBytes := []byte("origin")
 	// TODO: wtf is this generating a new key every time, what's the point of the sequence number then?
 	_, privKey, err := ed25519.GenerateKey(nil)
@@ -278,3 +980,78 @@ func ethTxBytes(sequence uint64, to loom.Address, data []byte) ([]byte, error) {
 	}
 	return rlp.EncodeToBytes(&tx)
 }
+
+func TestThrottleByteBudget(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	txSize := int64(len(mockSignedTx(t, 1, types.TxID_CALL, vm.VMType_PLUGIN, contract).Inner))
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	newSender := func(tmx loomchain.TxMiddlewareFunc, from loom.Address) func() error {
+		nonce := uint64(0)
+		return func() error {
+			nonce++
+			txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+			ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, from)
+			_, err := throttleMiddlewareHandler(tmx, state, txSigned, ctx)
+			return err
+		}
+	}
+
+	// The byte budget applies even if the number of txs isn't limited.
+	admin := NewAdmin()
+	tmx := GetKarmaMiddleWare(
+		true, 0, sessionDuration, 0, 0, StaticLimitResolver(0), createKarmaContractCtx,
+		WithByteBudget(2*txSize+txSize/2), WithAdmin(admin),
+	)
+	sendTx := newSender(tmx, origin)
+	require.NoError(t, sendTx())
+	require.NoError(t, sendTx())
+	quota, err := admin.Quota(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, BudgetQuota{Budget: "call", Limit: Unlimited, Remaining: Unlimited}, quota.Budgets[callBudget])
+	require.Equal(t, "bytes", quota.Budgets[bytesBudget].Budget)
+	require.Equal(t, 2*txSize, quota.Budgets[bytesBudget].Used)
+	require.Equal(t, txSize/2, quota.Budgets[bytesBudget].Remaining)
+	err = sendTx()
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok, "expected a tx limit error, got %v", err)
+	require.Equal(t, "bytes", limitErr.Budget)
+	require.Contains(t, err.Error(), fmt.Sprintf("used %d of %d bytes of txs", 2*txSize, 2*txSize+txSize/2))
+
+	// A tx larger than the whole byte budget is rejected even if the origin hasn't sent any txs yet.
+	tmx = GetKarmaMiddleWare(
+		true, maxCallCount, sessionDuration, 0, 0, StaticLimitResolver(maxCallCount), createKarmaContractCtx,
+		WithByteBudget(txSize-1),
+	)
+	err = newSender(tmx, addr1)()
+	costErr, ok := err.(*TxCostExceedsLimitError)
+	require.True(t, ok, "expected a tx cost error, got %v", err)
+	require.Equal(t, "bytes", costErr.Budget)
+	require.Equal(t, txSize, costErr.Cost)
+
+	// The count limit applies independently of the byte budget, and the byte budget can be disabled.
+	tmx = GetKarmaMiddleWare(
+		true, 2, sessionDuration, 0, 0, StaticLimitResolver(2), createKarmaContractCtx, WithByteBudget(0),
+	)
+	sendTx = newSender(tmx, origin)
+	require.NoError(t, sendTx())
+	require.NoError(t, sendTx())
+	limitErr, ok = sendTx().(*TxLimitReachedError)
+	require.True(t, ok)
+	require.Equal(t, "call", limitErr.Budget)
+}
+
+func TestDecodeLegacyOriginSession(t *testing.T) {
+	session := &originSession{lastAccess: time.Unix(1000, 0)}
+	session.budgets[callBudget] = budgetSession{start: time.Unix(900, 0), accessCount: 3, limit: 10}
+	session.budgets[bytesBudget] = budgetSession{start: time.Unix(900, 0), accessCount: 500, limit: 1000}
+
+	// Records stored before the byte budget was added only have the call & deploy sessions.
+	decoded := decodeOriginSession(encodeOriginSession(session)[:legacyOriginSessionSize])
+	require.NotNil(t, decoded)
+	require.Equal(t, session.budgets[callBudget], decoded.budgets[callBudget])
+	require.Equal(t, budgetSession{}, decoded.budgets[bytesBudget])
+	require.Equal(t, session, decodeOriginSession(encodeOriginSession(session)))
+}
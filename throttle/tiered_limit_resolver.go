@@ -0,0 +1,205 @@
+package throttle
+
+import (
+	"fmt"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/coin"
+	"github.com/loomnetwork/loomchain/builtin/plugins/dposv3"
+	"github.com/pkg/errors"
+)
+
+// Sources the stake of an origin can be read from.
+const (
+	// The LOOM balance of the origin in the Coin contract.
+	StakeSourceCoin = "coin"
+	// The total amount the origin has delegated in the DPOSv3 contract.
+	StakeSourceDPOS = "dpos"
+)
+
+// Number of decimals of the LOOM token, tier thresholds are specified in whole tokens.
+const stakeTokenDecimals = 18
+
+// LimitTier specifies the limit of origins whose stake is at least MinStake.
+type LimitTier struct {
+	// Minimum stake (in whole tokens) an origin needs to have to be in this tier.
+	MinStake int64
+	// Max number of txs an origin in this tier can send per session.
+	Limit int64
+}
+
+type StakeTierConfig struct {
+	// Enables stake-tiered call limits, when enabled the call limit of each origin is determined by
+	// its stake rather than its call karma.
+	Enabled bool
+	// Where the stake of each origin is read from: coin | dpos
+	StakeSource string
+	// Tiers in ascending MinStake order, the first tier must have a MinStake of zero.
+	Tiers []*LimitTier
+}
+
+func DefaultStakeTierConfig() *StakeTierConfig {
+	return &StakeTierConfig{
+		Enabled:     false,
+		StakeSource: StakeSourceDPOS,
+		Tiers: []*LimitTier{
+			{MinStake: 0, Limit: 10},
+			{MinStake: 1000, Limit: 50},
+			{MinStake: 10000, Limit: 200},
+			{MinStake: 100000, Limit: 1000},
+		},
+	}
+}
+
+// Clone returns a deep clone of the config.
+func (c *StakeTierConfig) Clone() *StakeTierConfig {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	if c.Tiers != nil {
+		clone.Tiers = make([]*LimitTier, len(c.Tiers))
+		for i, tier := range c.Tiers {
+			tierClone := *tier
+			clone.Tiers[i] = &tierClone
+		}
+	}
+	return &clone
+}
+
+// Validate returns an error if the config contains an unknown stake source, or the tiers aren't
+// in strictly ascending MinStake order.
+func (c *StakeTierConfig) Validate() error {
+	if c.StakeSource != StakeSourceCoin && c.StakeSource != StakeSourceDPOS {
+		return fmt.Errorf("unknown stake source %s", c.StakeSource)
+	}
+	return ValidateLimitTiers(c.Tiers)
+}
+
+// ValidateLimitTiers returns an error if the given tiers aren't in strictly ascending MinStake
+// order, don't start at zero, or don't have non-decreasing positive limits.
+func ValidateLimitTiers(tiers []*LimitTier) error {
+	if len(tiers) == 0 {
+		return errors.New("no limit tiers specified")
+	}
+	if tiers[0].MinStake != 0 {
+		return fmt.Errorf("first limit tier must have a min stake of zero, not %d", tiers[0].MinStake)
+	}
+	for i, tier := range tiers {
+		if tier.Limit <= 0 {
+			return fmt.Errorf("limit tier %d has non positive limit %d", i, tier.Limit)
+		}
+		if i == 0 {
+			continue
+		}
+		if tier.MinStake <= tiers[i-1].MinStake {
+			return fmt.Errorf(
+				"limit tier %d min stake %d must be greater than that of the previous tier %d",
+				i, tier.MinStake, tiers[i-1].MinStake,
+			)
+		}
+		if tier.Limit < tiers[i-1].Limit {
+			return fmt.Errorf(
+				"limit tier %d limit %d must not be less than that of the previous tier %d",
+				i, tier.Limit, tiers[i-1].Limit,
+			)
+		}
+	}
+	return nil
+}
+
+// StakeReader reads the stake of an origin from the contract state.
+type StakeReader func(state loomchain.State, origin loom.Address) (*loom.BigUInt, error)
+
+// NewCoinStakeReader returns a StakeReader that reads the LOOM balance of an origin.
+func NewCoinStakeReader(
+	createCoinContractCtx func(state loomchain.State) (contractpb.StaticContext, error),
+) StakeReader {
+	return func(state loomchain.State, origin loom.Address) (*loom.BigUInt, error) {
+		ctx, err := createCoinContractCtx(state)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create Coin contract context")
+		}
+		resp, err := (&coin.Coin{}).BalanceOf(ctx, &coin.BalanceOfRequest{Owner: origin.MarshalPB()})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load balance of %v", origin)
+		}
+		if resp.Balance == nil {
+			return loom.NewBigUIntFromInt(0), nil
+		}
+		return &resp.Balance.Value, nil
+	}
+}
+
+// NewDPOSStakeReader returns a StakeReader that reads the total amount an origin has delegated.
+func NewDPOSStakeReader(
+	createDPOSContractCtx func(state loomchain.State) (contractpb.StaticContext, error),
+) StakeReader {
+	return func(state loomchain.State, origin loom.Address) (*loom.BigUInt, error) {
+		ctx, err := createDPOSContractCtx(state)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create DPOS contract context")
+		}
+		resp, err := (&dposv3.DPOS{}).CheckAllDelegations(
+			ctx, &dposv3.CheckAllDelegationsRequest{DelegatorAddress: origin.MarshalPB()},
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load delegations of %v", origin)
+		}
+		if resp.Amount == nil {
+			return loom.NewBigUIntFromInt(0), nil
+		}
+		return &resp.Amount.Value, nil
+	}
+}
+
+// TieredLimitResolver resolves the limit of an origin by mapping its stake through a tier table,
+// so origins with more stake get proportionally larger limits. Resolved limits are cached until
+// the block height changes.
+type TieredLimitResolver struct {
+	tiers       []*LimitTier
+	readStake   StakeReader
+	cache       blockLimitCache
+	tokenAmount *loom.BigUInt
+}
+
+// NewTieredLimitResolver returns an error if the given tiers are invalid (see ValidateLimitTiers).
+func NewTieredLimitResolver(tiers []*LimitTier, readStake StakeReader) (*TieredLimitResolver, error) {
+	if err := ValidateLimitTiers(tiers); err != nil {
+		return nil, err
+	}
+	tokenAmount := loom.NewBigUIntFromInt(10)
+	tokenAmount.Exp(tokenAmount, loom.NewBigUIntFromInt(stakeTokenDecimals), nil)
+	return &TieredLimitResolver{
+		tiers:       tiers,
+		readStake:   readStake,
+		tokenAmount: tokenAmount,
+	}, nil
+}
+
+func (r *TieredLimitResolver) ResolveLimit(state loomchain.State, origin loom.Address) (int64, error) {
+	return r.cache.resolve(state, origin, func() (int64, error) {
+		stake, err := r.readStake(state, origin)
+		if err != nil {
+			return 0, err
+		}
+		return r.tierLimit(stake), nil
+	})
+}
+
+// Returns the limit of the highest tier whose threshold the given stake (in the smallest token
+// unit) meets.
+func (r *TieredLimitResolver) tierLimit(stake *loom.BigUInt) int64 {
+	limit := r.tiers[0].Limit
+	for _, tier := range r.tiers[1:] {
+		minStake := loom.NewBigUIntFromInt(tier.MinStake)
+		minStake.Mul(minStake, r.tokenAmount)
+		if stake.Cmp(minStake) < 0 {
+			break
+		}
+		limit = tier.Limit
+	}
+	return limit
+}
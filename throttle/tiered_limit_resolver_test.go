@@ -0,0 +1,124 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/coin"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestValidateLimitTiers(t *testing.T) {
+	require.NoError(t, ValidateLimitTiers(DefaultStakeTierConfig().Tiers))
+	require.NoError(t, DefaultStakeTierConfig().Validate())
+
+	require.Error(t, ValidateLimitTiers(nil))
+	// first tier must start at zero
+	require.Error(t, ValidateLimitTiers([]*LimitTier{{MinStake: 1, Limit: 10}}))
+	// thresholds must be strictly ascending
+	require.Error(t, ValidateLimitTiers([]*LimitTier{
+		{MinStake: 0, Limit: 10}, {MinStake: 1000, Limit: 50}, {MinStake: 1000, Limit: 200},
+	}))
+	require.Error(t, ValidateLimitTiers([]*LimitTier{
+		{MinStake: 0, Limit: 10}, {MinStake: 1000, Limit: 50}, {MinStake: 500, Limit: 200},
+	}))
+	// limits must be positive & non-decreasing
+	require.Error(t, ValidateLimitTiers([]*LimitTier{{MinStake: 0, Limit: 0}}))
+	require.Error(t, ValidateLimitTiers([]*LimitTier{{MinStake: 0, Limit: 50}, {MinStake: 1000, Limit: 10}}))
+
+	cfg := DefaultStakeTierConfig()
+	cfg.StakeSource = "karma"
+	require.Error(t, cfg.Validate())
+}
+
+func TestTieredLimitResolverCoinStake(t *testing.T) {
+	fakeCtx := goloomplugin.CreateFakeContext(addr1, addr1)
+	coinAddr := fakeCtx.CreateContract(coin.Contract)
+	coinCtx := contractpb.WrapPluginContext(fakeCtx.WithAddress(coinAddr))
+	require.NoError(t, (&coin.Coin{}).Init(coinCtx, &coin.InitRequest{
+		Accounts: []*coin.InitialAccount{
+			{Owner: origin.MarshalPB(), Balance: 1500},
+			{Owner: addr1.MarshalPB(), Balance: 999},
+		},
+	}))
+
+	resolver, err := NewTieredLimitResolver(
+		DefaultStakeTierConfig().Tiers,
+		NewCoinStakeReader(func(state loomchain.State) (contractpb.StaticContext, error) {
+			return coinCtx, nil
+		}),
+	)
+	require.NoError(t, err)
+
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	limit, err := resolver.ResolveLimit(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), limit)
+
+	limit, err = resolver.ResolveLimit(state, addr1)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), limit)
+}
+
+func TestTieredLimitCrossingTierBetweenSessions(t *testing.T) {
+	tokens := func(amount int64) *loom.BigUInt {
+		total := loom.NewBigUIntFromInt(10)
+		total.Exp(total, loom.NewBigUIntFromInt(stakeTokenDecimals), nil)
+		return total.Mul(total, loom.NewBigUIntFromInt(amount))
+	}
+	stake := tokens(999)
+	resolver, err := NewTieredLimitResolver(
+		DefaultStakeTierConfig().Tiers,
+		func(state loomchain.State, origin loom.Address) (*loom.BigUInt, error) {
+			return stake, nil
+		},
+	)
+	require.NoError(t, err)
+
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	memStore := store.NewMemStore()
+	now := time.Now()
+
+	// Exhaust the limit of the lowest tier.
+	state := loomchain.NewStoreState(nil, memStore, abci.Header{Height: 1}, nil, nil)
+	limit, err := resolver.ResolveLimit(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), limit)
+	for i := int64(1); i <= limit; i++ {
+		require.Equal(t, i, th.countTx(callBudget, origin.String(), uint64(i), 1, 1, limit, now))
+	}
+	require.True(t, th.countTx(callBudget, origin.String(), uint64(limit+1), 1, 1, limit, now) > limit)
+
+	// The stake crosses the 1k tier boundary, the new limit applies from the next block onwards.
+	stake = tokens(1000)
+	limit, err = resolver.ResolveLimit(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), limit)
+
+	state = loomchain.NewStoreState(nil, memStore, abci.Header{Height: 2}, nil, nil)
+	limit, err = resolver.ResolveLimit(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), limit)
+
+	// The next session starts with a fresh count under the higher limit.
+	now = now.Add(time.Duration(sessionDuration) * time.Second)
+	for i := int64(1); i <= limit; i++ {
+		require.Equal(t, i, th.countTx(callBudget, origin.String(), uint64(100+i), 1, 1, limit, now))
+	}
+	require.True(t, th.countTx(callBudget, origin.String(), uint64(100+limit+1), 1, 1, limit, now) > limit)
+
+	// Dropping back below the boundary moves the origin back to the lowest tier.
+	stake = tokens(10)
+	state = loomchain.NewStoreState(nil, memStore, abci.Header{Height: 3}, nil, nil)
+	limit, err = resolver.ResolveLimit(state, origin)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), limit)
+}
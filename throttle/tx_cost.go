@@ -0,0 +1,141 @@
+package throttle
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	lauth "github.com/loomnetwork/go-loom/auth"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/pkg/errors"
+)
+
+// TxCostFunc returns how much of the budget of an origin the given tx consumes, the tx bytes are
+// those of a NonceTx. Costs less than one are rounded up to one.
+type TxCostFunc func(txBytes []byte) int64
+
+// TxCostMode selects one of the built-in tx cost functions.
+type TxCostMode string
+
+const (
+	// Every tx costs one.
+	UnitTxCost TxCostMode = "unit"
+	// Deploy & call txs have separately configured costs.
+	KindTxCost TxCostMode = "kind"
+	// Txs cost one for every started KB.
+	SizeTxCost TxCostMode = "size"
+)
+
+func (m TxCostMode) IsValid() bool {
+	return m == UnitTxCost || m == KindTxCost || m == SizeTxCost
+}
+
+// TxUnitCost returns a cost function that charges one for every tx.
+func TxUnitCost() TxCostFunc {
+	return func(txBytes []byte) int64 {
+		return 1
+	}
+}
+
+// TxKindCost returns a cost function that charges deployCost for deploy txs, and callCost for all
+// other txs. Txs that can't be decoded are charged callCost.
+func TxKindCost(callCost int64, deployCost int64) TxCostFunc {
+	return func(txBytes []byte) int64 {
+		if isDeployTxBytes(txBytes) {
+			return deployCost
+		}
+		return callCost
+	}
+}
+
+// TxSizeCost returns a cost function that charges one for every started KB of a tx.
+func TxSizeCost() TxCostFunc {
+	return func(txBytes []byte) int64 {
+		return (int64(len(txBytes)) + 1023) / 1024
+	}
+}
+
+// NewTxCostFunc returns the built-in cost function for the given mode, callCost & deployCost are
+// only used by KindTxCost.
+func NewTxCostFunc(mode TxCostMode, callCost int64, deployCost int64) (TxCostFunc, error) {
+	switch mode {
+	case UnitTxCost:
+		return TxUnitCost(), nil
+	case KindTxCost:
+		if callCost <= 0 || deployCost <= 0 {
+			return nil, errors.Errorf("tx costs must be positive, call %d, deploy %d", callCost, deployCost)
+		}
+		return TxKindCost(callCost, deployCost), nil
+	case SizeTxCost:
+		return TxSizeCost(), nil
+	}
+	return nil, errors.Errorf("invalid tx cost mode %s", mode)
+}
+
+func isDeployTxBytes(txBytes []byte) bool {
+	var nonceTx lauth.NonceTx
+	if err := proto.Unmarshal(txBytes, &nonceTx); err != nil {
+		return false
+	}
+	var tx loomchain.Transaction
+	if err := proto.Unmarshal(nonceTx.Inner, &tx); err != nil {
+		return false
+	}
+	switch types.TxID(tx.Id) {
+	case types.TxID_DEPLOY:
+		return true
+	case types.TxID_ETHEREUM:
+		var msg vm.MessageTx
+		if err := proto.Unmarshal(tx.Data, &msg); err != nil {
+			return false
+		}
+		isDeploy, _ := isEthDeploy(msg.Data)
+		return isDeploy
+	}
+	return false
+}
+
+// Returns the cost of the given tx.
+func (t *Throttle) txCostOf(txBytes []byte) int64 {
+	t.paramsMtx.RLock()
+	txCost := t.txCost
+	t.paramsMtx.RUnlock()
+	if txCost == nil {
+		return 1
+	}
+	if cost := txCost(txBytes); cost > 1 {
+		return cost
+	}
+	return 1
+}
+
+// TxCostExceedsLimitError is returned when the cost of a single tx exceeds the whole limit of the
+// origin, so the tx will never be accepted no matter how long the origin waits.
+type TxCostExceedsLimitError struct {
+	Origin loom.Address
+	// Budget the tx was counted against: call | deploy | bytes
+	Budget string
+	// Cost of the tx, or its size in bytes if Budget is bytes.
+	Cost  int64
+	Limit int64
+	// Help text configured by the operator, appended to the message.
+	Help string
+}
+
+func (e *TxCostExceedsLimitError) Error() string {
+	if e.Budget == bytesBudget.String() {
+		return withHelp(fmt.Sprintf(
+			"tx size %d exceeds the limit of %d bytes of txs per session of origin %s", e.Cost, e.Limit, e.Origin,
+		), e.Help)
+	}
+	return withHelp(fmt.Sprintf(
+		"tx cost %d exceeds the %s tx limit %d of origin %s", e.Cost, e.Budget, e.Limit, e.Origin,
+	), e.Help)
+}
+
+// ABCICode returns the code the error should be reported with in ABCI responses.
+func (e *TxCostExceedsLimitError) ABCICode() uint32 {
+	return TxCostExceedsLimitCode
+}
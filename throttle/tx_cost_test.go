@@ -0,0 +1,123 @@
+// +build evm
+
+package throttle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/auth"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	loomAuth "github.com/loomnetwork/loomchain/auth"
+	"github.com/loomnetwork/loomchain/builtin/plugins/karma"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestTxCostFuncs(t *testing.T) {
+	callTx := mockSignedTx(t, 1, types.TxID_CALL, vm.VMType_EVM, contract).Inner
+	deployTx := mockSignedTx(t, 2, types.TxID_DEPLOY, vm.VMType_EVM, contract).Inner
+	ethDeployTx := mockSignedTx(t, 3, types.TxID_ETHEREUM, vm.VMType_EVM, loom.Address{}).Inner
+
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	require.Equal(t, int64(1), th.txCostOf(deployTx))
+
+	th.txCost = TxUnitCost()
+	require.Equal(t, int64(1), th.txCostOf(deployTx))
+
+	th.txCost = TxKindCost(2, 50)
+	require.Equal(t, int64(2), th.txCostOf(callTx))
+	require.Equal(t, int64(50), th.txCostOf(deployTx))
+	require.Equal(t, int64(50), th.txCostOf(ethDeployTx))
+	require.Equal(t, int64(2), th.txCostOf([]byte("garbage")))
+
+	th.txCost = TxSizeCost()
+	require.Equal(t, int64(1), th.txCostOf(nil))
+	require.Equal(t, int64(1), th.txCostOf(make([]byte, 1024)))
+	require.Equal(t, int64(2), th.txCostOf(make([]byte, 1025)))
+	require.Equal(t, int64(200), th.txCostOf(make([]byte, 200*1024)))
+
+	_, err := NewTxCostFunc(KindTxCost, 0, 5)
+	require.Error(t, err)
+	_, err = NewTxCostFunc("gas", 1, 1)
+	require.Error(t, err)
+}
+
+func TestThrottleMixedTxCosts(t *testing.T) {
+	th := NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	callTxID := uint32(types.TxID_CALL)
+
+	require.NoError(t, th.runThrottle(nil, callBudget, 1, origin, maxCallCount, callTxID, 3))
+	require.NoError(t, th.runThrottle(nil, callBudget, 2, origin, maxCallCount, callTxID, 1))
+	require.NoError(t, th.runThrottle(nil, callBudget, 3, origin, maxCallCount, callTxID, 4))
+
+	// 8 of 10 used, a tx that costs 3 doesn't fit.
+	err := th.runThrottle(nil, callBudget, 4, origin, maxCallCount, callTxID, 3)
+	limitErr, ok := err.(*TxLimitReachedError)
+	require.True(t, ok)
+	require.Equal(t, int64(8), limitErr.Used)
+	require.Equal(t, maxCallCount, limitErr.Limit)
+
+	// A tx that costs more than the whole limit is rejected without being counted.
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	err = th.throttleTx(state, callBudget, 5, addr1, maxCallCount, callTxID, maxCallCount+1)
+	costErr, ok := err.(*TxCostExceedsLimitError)
+	require.True(t, ok)
+	require.Equal(t, maxCallCount+1, costErr.Cost)
+	require.NoError(t, th.throttleTx(state, callBudget, 6, addr1, maxCallCount, callTxID, maxCallCount))
+
+	// Costs are charged in block session mode too.
+	th = NewThrottle(sessionDuration, maxCallCount, 0, 0)
+	WithBlockSessions(10, 0)(th)
+	require.NoError(t, th.throttleTx(state, callBudget, 1, origin, maxCallCount, callTxID, 6))
+	_, ok = th.throttleTx(state, callBudget, 2, origin, maxCallCount, callTxID, 5).(*TxLimitReachedError)
+	require.True(t, ok)
+	require.NoError(t, th.throttleTx(state, callBudget, 3, origin, maxCallCount, callTxID, 4))
+}
+
+func TestKarmaMiddlewareCustomTxCost(t *testing.T) {
+	contractContext, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+	require.NoError(t, karma.AddKarma(contractContext, origin, sourceStates))
+
+	// Odd nonces cost 1, even nonces cost 3.
+	txCost := func(txBytes []byte) int64 {
+		var nonceTx auth.NonceTx
+		require.NoError(t, proto.Unmarshal(txBytes, &nonceTx))
+		if nonceTx.Sequence%2 == 0 {
+			return 3
+		}
+		return 1
+	}
+	tmx := GetKarmaMiddleWare(
+		true, maxCallCount, sessionDuration, 0, 0, nil, createKarmaContractCtx, WithTxCost(txCost),
+	)
+
+	state := loomchain.NewStoreState(nil, store.NewMemStore(), abci.Header{Height: 1}, nil, nil)
+	ctx := context.WithValue(state.Context(), loomAuth.ContextKeyOrigin, origin)
+	limit := maxCallCount + userState.CallKarmaTotal.Value.Int64()
+	var used int64
+	for nonce := uint64(1); ; nonce++ {
+		txSigned := mockSignedTx(t, nonce, types.TxID_CALL, vm.VMType_PLUGIN, contract)
+		cost := txCost(txSigned.Inner)
+		_, err := throttleMiddlewareHandler(tmx, state, txSigned, ctx)
+		if used+cost > limit {
+			limitErr, ok := err.(*TxLimitReachedError)
+			require.True(t, ok)
+			require.Equal(t, used, limitErr.Used)
+			break
+		}
+		require.NoError(t, err)
+		used += cost
+	}
+	// 9 txs alternating between 1 & 3 use up the whole limit of 17.
+	require.Equal(t, limit, used)
+}
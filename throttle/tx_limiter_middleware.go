@@ -85,7 +85,7 @@ func NewTxLimiterMiddleware(cfg *TxLimiterConfig) loomchain.TxMiddlewareFunc {
 		}
 
 		if txl.isAccountLimitReached(origin) {
-			return loomchain.TxHandlerResult{}, errors.New("tx limit reached, try again later")
+			return loomchain.TxHandlerResult{}, ErrTxLimitReached
 		}
 
 		return next(state, txBytes, isCheckTx)
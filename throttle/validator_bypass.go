@@ -0,0 +1,149 @@
+package throttle
+
+import (
+	"sync"
+
+	"github.com/loomnetwork/go-loom"
+	"github.com/loomnetwork/go-loom/plugin/contractpb"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/builtin/plugins/dposv3"
+	"github.com/pkg/errors"
+)
+
+// ValidatorPolicy determines how the throttle treats txs sent by the current validators.
+type ValidatorPolicy string
+
+const (
+	// Validators aren't throttled at all.
+	ValidatorExempt ValidatorPolicy = "exempt"
+	// Validators get their own call limit instead of the limits that apply to other origins.
+	ValidatorLimit ValidatorPolicy = "limit"
+)
+
+func (p ValidatorPolicy) IsValid() bool {
+	return p == ValidatorExempt || p == ValidatorLimit
+}
+
+// Identifies the origins that correspond to the current validators, the validator set is resolved
+// once per block so the policy follows the validator set as it changes.
+type validatorBypass struct {
+	policy ValidatorPolicy
+	// Call limit of validators when the policy is ValidatorLimit.
+	callLimit int64
+	// Creates a context for the DPOS contract, nil if validators are only identified by the address
+	// derived from their node key.
+	createDPOSContractCtx func(state loomchain.State) (contractpb.StaticContext, error)
+	// Addresses of the validators resolved at height, guarded by mtx.
+	height     int64
+	validators map[string]struct{}
+	mtx        sync.Mutex
+}
+
+// WithValidatorPolicy makes the middleware treat txs sent by the current validators (read from the
+// validator set of the app state) according to the given policy, so oracle submissions & DPOS
+// housekeeping txs aren't starved by the limits of end users. callLimit is the call limit of
+// validators when the policy is ValidatorLimit. Validators are identified by the address derived from
+// their node key, and if createDPOSContractCtx isn't nil by the address of the candidate they're
+// registered as in the DPOS contract too, so txs signed by the operator account of a validator are
+// covered as well. Origin overrides & limit table entries don't apply to exempt validators, while
+// origin overrides take precedence over the call limit of validators.
+func WithValidatorPolicy(
+	policy ValidatorPolicy,
+	callLimit int64,
+	createDPOSContractCtx func(state loomchain.State) (contractpb.StaticContext, error),
+) KarmaMiddlewareOption {
+	return func(th *Throttle) {
+		th.validatorBypass = &validatorBypass{
+			policy:                policy,
+			callLimit:             callLimit,
+			createDPOSContractCtx: createDPOSContractCtx,
+		}
+	}
+}
+
+// Returns true if the given origin corresponds to one of the validators as of the given state. If
+// the validators can't be resolved only the addresses derived from their node keys are considered,
+// and the error is logged once per block.
+func (t *Throttle) isValidator(state loomchain.State, origin loom.Address) bool {
+	if t.validatorBypass == nil {
+		return false
+	}
+	b := t.validatorBypass
+	height := state.Block().Height
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.validators == nil || b.height != height {
+		validators, err := b.resolveValidators(state)
+		if err != nil {
+			t.logger.Error("Failed to resolve validator operators", "height", height, "err", err)
+		}
+		b.height = height
+		b.validators = validators
+	}
+	_, ok := b.validators[origin.String()]
+	return ok
+}
+
+// Returns true if the given origin is exempted by the validator policy.
+func (t *Throttle) isValidatorExempt(state loomchain.State, origin loom.Address) bool {
+	return t.validatorBypass != nil && t.validatorBypass.policy == ValidatorExempt && t.isValidator(state, origin)
+}
+
+// Returns the call limit set by the validator policy for the given origin, false if the origin isn't
+// a validator or validators don't have their own limit.
+func (t *Throttle) validatorCallLimit(state loomchain.State, origin loom.Address) (int64, bool) {
+	if t.validatorBypass == nil || t.validatorBypass.policy != ValidatorLimit || !t.isValidator(state, origin) {
+		return 0, false
+	}
+	return t.validatorBypass.callLimit, true
+}
+
+// Returns the addresses of the current validators keyed by address, always includes the addresses
+// derived from the node keys of the validators even if an error is returned.
+func (b *validatorBypass) resolveValidators(state loomchain.State) (map[string]struct{}, error) {
+	chainID := state.Block().ChainID
+	validators := state.Validators()
+	addrs := make(map[string]struct{}, 2*len(validators))
+	for _, v := range validators {
+		addr := loom.Address{ChainID: chainID, Local: loom.LocalAddressFromPublicKey(v.PubKey)}
+		addrs[addr.String()] = struct{}{}
+	}
+	if b.createDPOSContractCtx == nil || len(validators) == 0 {
+		return addrs, nil
+	}
+
+	ctx, err := b.createDPOSContractCtx(state)
+	if err != nil {
+		return addrs, errors.Wrap(err, "failed to create DPOS contract context")
+	}
+	candidates, err := dposv3.LoadCandidateList(ctx)
+	if err != nil {
+		return addrs, errors.Wrap(err, "failed to load DPOS candidates")
+	}
+	pubKeys := make(map[string]struct{}, len(validators))
+	for _, v := range validators {
+		pubKeys[string(v.PubKey)] = struct{}{}
+	}
+	for _, candidate := range candidates {
+		if _, ok := pubKeys[string(candidate.PubKey)]; ok && candidate.Address != nil {
+			addrs[loom.UnmarshalAddressPB(candidate.Address).String()] = struct{}{}
+		}
+	}
+	return addrs, nil
+}
+
+// Resolves the call limit of validators from the validator policy, and the limits of other origins
+// with the wrapped resolver.
+type validatorLimitResolver struct {
+	throttle *Throttle
+	next     LimitResolver
+}
+
+func (r *validatorLimitResolver) ResolveLimit(state loomchain.State, origin loom.Address) (int64, error) {
+	if limit, ok := r.throttle.validatorCallLimit(state, origin); ok {
+		return limit, nil
+	}
+	return r.next.ResolveLimit(state, origin)
+}
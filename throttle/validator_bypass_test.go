@@ -0,0 +1,100 @@
+// +build evm
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loomnetwork/go-loom"
+	ktypes "github.com/loomnetwork/go-loom/builtin/types/karma"
+	goloomplugin "github.com/loomnetwork/go-loom/plugin"
+	"github.com/loomnetwork/go-loom/types"
+	"github.com/loomnetwork/loomchain"
+	"github.com/loomnetwork/loomchain/store"
+	"github.com/loomnetwork/loomchain/vm"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestValidatorPolicy(t *testing.T) {
+	_, createKarmaContractCtx := newKarmaContractCtx(
+		t, goloomplugin.CreateFakeContext(addr1, addr1), &ktypes.KarmaInitRequest{Sources: sources},
+	)
+
+	const chainID = "chain"
+	newValidator := func() (*loom.Validator, loom.Address) {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		return &loom.Validator{PubKey: pubKey, Power: 10},
+			loom.Address{ChainID: chainID, Local: loom.LocalAddressFromPublicKey(pubKey)}
+	}
+	validator1, validatorAddr1 := newValidator()
+	validator2, validatorAddr2 := newValidator()
+	validators := []*loom.Validator{validator1}
+
+	now := time.Unix(1500000000, 0)
+	newSender := func(opts ...KarmaMiddlewareOption) func(height int64, from loom.Address) error {
+		opts = append(opts, WithClock(ClockFunc(func() time.Time { return now })))
+		tmx := GetKarmaMiddleWare(
+			true, 1, sessionDuration, 0, 0, StaticLimitResolver(1), createKarmaContractCtx, opts...,
+		)
+		memStore := store.NewMemStore()
+		nonces := map[string]uint64{}
+		return func(height int64, from loom.Address) error {
+			nonces[from.String()]++
+			state := loomchain.NewStoreState(
+				nil, memStore, abci.Header{ChainID: chainID, Height: height}, nil,
+				func(state loomchain.State) (loom.ValidatorSet, error) {
+					return loom.NewValidatorSet(validators...), nil
+				},
+			)
+			return processTxFrom(
+				tmx, state, from, mockSignedTx(t, nonces[from.String()], types.TxID_CALL, vm.VMType_PLUGIN, contract), nopTxHandler, true,
+			)
+		}
+	}
+	isLimitReached := func(err error) bool {
+		_, ok := err.(*TxLimitReachedError)
+		return ok
+	}
+
+	// Current validators aren't throttled.
+	sendTx := newSender(WithValidatorPolicy(ValidatorExempt, 0, nil))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx(1, validatorAddr1))
+	}
+	require.NoError(t, sendTx(1, origin))
+	require.True(t, isLimitReached(sendTx(1, origin)))
+
+	// The validator set is only resolved once per block...
+	validators = []*loom.Validator{validator2}
+	require.NoError(t, sendTx(1, validatorAddr1))
+	require.NoError(t, sendTx(1, validatorAddr2))
+	require.True(t, isLimitReached(sendTx(1, validatorAddr2)))
+
+	// ...so the policy follows a change to the validator set from the next block.
+	require.NoError(t, sendTx(2, validatorAddr1))
+	require.True(t, isLimitReached(sendTx(2, validatorAddr1)))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx(2, validatorAddr2))
+	}
+
+	// Validators can get their own limit instead.
+	validators = []*loom.Validator{validator1}
+	sendTx = newSender(WithValidatorPolicy(ValidatorLimit, 3, nil))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTx(1, validatorAddr1))
+	}
+	require.True(t, isLimitReached(sendTx(1, validatorAddr1)))
+	require.NoError(t, sendTx(1, validatorAddr2))
+	require.True(t, isLimitReached(sendTx(1, validatorAddr2)))
+
+	// A validator that leaves the set gets the limit of other origins, and one that joins the set gets
+	// the limit of validators, while the txs they've already sent keep counting.
+	validators = []*loom.Validator{validator2}
+	require.True(t, isLimitReached(sendTx(2, validatorAddr1)))
+	require.NoError(t, sendTx(2, validatorAddr2))
+	require.True(t, isLimitReached(sendTx(2, validatorAddr2)))
+}
@@ -0,0 +1,184 @@
+package throttle
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// WindowMode determines how the txs an origin sends are grouped into sessions.
+type WindowMode string
+
+const (
+	// A session starts with the first tx an origin sends and lasts a fixed duration, which lets an
+	// origin send up to twice its limit in a short burst around the end of a session.
+	FixedWindow WindowMode = "fixed"
+	// The number of txs an origin sent in the last session duration is approximated from the counts
+	// of the current & previous sessions, the count of the previous session is weighted by how much
+	// of it still overlaps with the sliding window. Only two counts are stored per origin.
+	SlidingWindow WindowMode = "sliding"
+	// Each tx an origin sends fills a bucket by its cost, and the bucket leaks at a constant rate, so
+	// an origin can send txs as long as they fit in the bucket, whose capacity is the limit of the
+	// origin. Lets the sustained rate be a fraction of a tx per second, e.g. one tx every 2 seconds.
+	// Txs that overflow the bucket are rejected without being added to it. Only applies to the call
+	// budget, the other budgets & the contract limits use fixed windows.
+	LeakyBucket WindowMode = "leaky"
+)
+
+func (m WindowMode) IsValid() bool {
+	return m == FixedWindow || m == SlidingWindow || m == LeakyBucket
+}
+
+// In leaky bucket mode the level of a bucket is kept in micro-units of cost, so it can leak a
+// fraction of the cost of a tx at a time.
+const microUnits = 1000000
+
+// Starts a new session if the current one has ended, the utilization of the ended session is
+// recorded in the given metrics. In leaky bucket mode the bucket is drained instead, the window is
+// the time it takes the bucket to leak one unit of cost.
+func (s *budgetSession) advance(mode WindowMode, window time.Duration, now time.Time, metrics *Metrics, budget txBudget) {
+	if mode == LeakyBucket {
+		s.drain(window, now)
+		return
+	}
+	elapsed := now.Sub(s.start)
+	if elapsed < window {
+		return
+	}
+	metrics.sessionEnded(budget, s)
+	// In sliding window mode the next session starts right after the current one so its count can
+	// be carried over, unless the origin has been idle for a whole session.
+	if mode == SlidingWindow && elapsed < 2*window {
+		*s = budgetSession{start: s.start.Add(window), prevAccessCount: s.accessCount}
+		return
+	}
+	*s = budgetSession{start: now}
+}
+
+// Returns the total cost of the txs the origin has sent in the last session duration (including the
+// txs sent during the current session), or in leaky bucket mode the cost of the txs still in the
+// bucket.
+func (s *budgetSession) count(mode WindowMode, window time.Duration, now time.Time) int64 {
+	if mode == LeakyBucket {
+		bucket := *s
+		bucket.drain(window, now)
+		return costOfUnits(bucket.accessCount)
+	}
+	if mode != SlidingWindow || s.prevAccessCount == 0 {
+		return s.accessCount
+	}
+	return addCapped(s.accessCount, weightedCount(s.prevAccessCount, window-now.Sub(s.start), window))
+}
+
+// Returns the given count weighted by the fraction of the window that overlaps the sliding window,
+// rounded up so the origin never gets to send more than its limit within any window.
+func weightedCount(count int64, overlap time.Duration, window time.Duration) int64 {
+	if overlap <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(float64(count) * float64(overlap) / float64(window)))
+}
+
+// Returns the earliest time at which the origin will be able to send another tx with the given cost
+// without exceeding the given limit, assuming it doesn't send any txs until then.
+func (s *budgetSession) retryAt(mode WindowMode, window time.Duration, limit int64, cost int64) time.Time {
+	if mode == LeakyBucket {
+		// The bucket has to leak until the tx fits in it.
+		excess := s.accessCount - unitsOfCost(limit-cost)
+		if excess <= 0 {
+			return s.start
+		}
+		return s.start.Add(leakTime(excess, window))
+	}
+	sessionEnd := s.start.Add(window)
+	if mode != SlidingWindow {
+		return sessionEnd
+	}
+	// A tx is allowed once ceil(prev * (window - elapsed) / window) + current + cost <= limit
+	if available := limit - s.accessCount - cost; available >= 0 {
+		return s.start.Add(overlapEndsAt(s.prevAccessCount, available, window))
+	}
+	// Otherwise the origin has to wait until the current session becomes the previous one.
+	return sessionEnd.Add(overlapEndsAt(s.accessCount, limit-cost, window))
+}
+
+// Returns how far into a session the weighted count of the previous session drops to the given
+// cost.
+func overlapEndsAt(prevCount int64, available int64, window time.Duration) time.Duration {
+	if prevCount <= available {
+		return 0
+	}
+	return time.Duration(math.Ceil(float64(window) * (1 - float64(available)/float64(prevCount))))
+}
+
+// Drains the bucket by what has leaked out of it since it was last drained, the interval is the time
+// it takes the bucket to leak one unit of cost. The bucket is only ever drained forward in time, so
+// if the clock is read out of order the same time is never leaked twice. The time it took to leak the
+// whole micro-units drained is all that's deducted, so the remainder isn't lost when the bucket is
+// drained often.
+func (s *budgetSession) drain(interval time.Duration, now time.Time) {
+	elapsed := now.Sub(s.start)
+	if elapsed <= 0 {
+		return
+	}
+	leaked, took := leakedUnits(elapsed, interval)
+	if leaked >= s.accessCount {
+		s.accessCount = 0
+		s.start = now
+		return
+	}
+	s.accessCount -= leaked
+	s.start = s.start.Add(took)
+}
+
+// Returns how many micro-units leak out of a bucket that leaks a unit every interval over the given
+// time, rounded down, and how long it takes to leak exactly that many.
+func leakedUnits(elapsed time.Duration, interval time.Duration) (int64, time.Duration) {
+	hi, lo := bits.Mul64(uint64(elapsed), microUnits)
+	if hi >= uint64(interval) {
+		return math.MaxInt64, elapsed
+	}
+	leaked, _ := bits.Div64(hi, lo, uint64(interval))
+	if leaked > math.MaxInt64 {
+		return math.MaxInt64, elapsed
+	}
+	return int64(leaked), leakTime(int64(leaked), interval)
+}
+
+// Returns how long it takes a bucket that leaks a unit every interval to leak the given number of
+// micro-units, rounded up.
+func leakTime(units int64, interval time.Duration) time.Duration {
+	hi, lo := bits.Mul64(uint64(units), uint64(interval))
+	if hi >= microUnits {
+		return math.MaxInt64
+	}
+	took, rem := bits.Div64(hi, lo, microUnits)
+	if rem > 0 {
+		took++
+	}
+	if took > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(took)
+}
+
+// Returns the given cost in micro-units, capped at math.MaxInt64.
+func unitsOfCost(cost int64) int64 {
+	if cost > math.MaxInt64/microUnits {
+		return math.MaxInt64
+	}
+	if cost < math.MinInt64/microUnits {
+		return math.MinInt64
+	}
+	return cost * microUnits
+}
+
+// Returns the given micro-units as a cost, rounded up so a bucket that isn't quite empty still counts
+// the tx that partly fills it.
+func costOfUnits(units int64) int64 {
+	cost := units / microUnits
+	if units%microUnits > 0 {
+		cost++
+	}
+	return cost
+}